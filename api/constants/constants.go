@@ -14,6 +14,9 @@ const KilometersToMiles = float64(1.60934)
 // MaxVideoFileSizeMB dictates the maximum size of video files Seneca will accept.
 const MaxVideoFileSizeMB int64 = 250
 
+// MaxTelemetryFileSizeMB dictates the maximum size of GPS log files Seneca will accept.
+const MaxTelemetryFileSizeMB int64 = 50
+
 // HeartbeatEndpoint defines the HTTP endpoint that the server will answer heartbeat requests on.
 const HeartbeatEndpoint = "heartbeat"
 
@@ -24,21 +27,31 @@ const SenecaAPIKey = "lSfsjS3nebraYqbzbpFS"
 type TableName string
 
 const (
-	UsersTable            TableName = "Users"
-	RawVideosTable        TableName = "RawVideos"
-	RawLocationsTable     TableName = "RawLocations"
-	RawMotionsTable       TableName = "RawMotions"
-	RawFramesTable        TableName = "RawFrames"
-	EventTable            TableName = "Events"
-	DrivingConditionTable TableName = "DrivingConditions"
-	TripTable             TableName = "Trips"
+	UsersTable             TableName = "Users"
+	RawVideosTable         TableName = "RawVideos"
+	RawLocationsTable      TableName = "RawLocations"
+	RawMotionsTable        TableName = "RawMotions"
+	RawFramesTable         TableName = "RawFrames"
+	RawTelemetryFilesTable TableName = "RawTelemetryFiles"
+	RawVehicleSignalsTable TableName = "RawVehicleSignals"
+	EventTable             TableName = "Events"
+	DrivingConditionTable  TableName = "DrivingConditions"
+	TripTable              TableName = "Trips"
+	MigrationsTable        TableName = "Migrations"
+	TombstonesTable        TableName = "Tombstones"
+	AuditTable             TableName = "Audit"
+	LeasesTable            TableName = "Leases"
+	JobsTable              TableName = "Jobs"
 )
 
 func (tn TableName) String() string {
 	return string(tn)
 }
 
-var DataTableNames = []TableName{UsersTable, RawVideosTable, RawLocationsTable, RawMotionsTable, EventTable, DrivingConditionTable, TripTable, RawFramesTable}
+var DataTableNames = []TableName{UsersTable, RawVideosTable, RawLocationsTable, RawMotionsTable, EventTable, DrivingConditionTable, TripTable, RawFramesTable, RawTelemetryFilesTable, RawVehicleSignalsTable}
+
+// MetadataTableNames are the tables that describe the database itself rather than user data.
+var MetadataTableNames = []TableName{MigrationsTable, TombstonesTable, AuditTable, LeasesTable, JobsTable}
 
 type SenecaTypeFieldName string
 
@@ -0,0 +1,59 @@
+// Package main in checkintegrity reports the objects whose user or trip doesn't exist or belongs to another user,
+// and the dangling or cyclic chains of Sources, across all tables, e.g.
+// 	$ go run ./cmd/checkintegrity --database=bolt --bolt_path=seneca.db
+// It doesn't change the database, and exits with status 1 if there are any issues.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"seneca/internal/client/database/backend"
+	"seneca/internal/client/logging"
+	"seneca/internal/dao/integrity"
+	"text/tabwriter"
+)
+
+var (
+	databaseBackend = flag.String("database", "datastore", "The database backend to use, one of [datastore, postgres, bolt].")
+	postgresDSN     = flag.String("postgres_dsn", "", "The PostgreSQL connection string, required when --database=postgres.")
+	boltPath        = flag.String("bolt_path", "seneca.db", "The path to the local database file used when --database=bolt.")
+)
+
+func main() {
+	flag.Parse()
+
+	sqlService, err := backend.New(context.TODO(), backend.Config{Backend: *databaseBackend, PostgresDSN: *postgresDSN, BoltPath: *boltPath})
+	if err != nil {
+		log.Fatalf("backend.New() returns err: %v", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	report, err := integrity.NewChecker(sqlService, logging.NewLocalLogger(false)).Check(ctx)
+	if err != nil {
+		log.Fatalf("Check() returns err: %v", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TABLE\tID\tUSER\tPROBLEM")
+	for _, issue := range report.Issues {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", issue.TableName, issue.ID, issue.UserID, issue.Problem)
+	}
+	if err := w.Flush(); err != nil {
+		log.Fatalf("Flush() returns err: %v", err)
+	}
+
+	scanned := 0
+	for _, count := range report.Scanned {
+		scanned += count
+	}
+	fmt.Printf("Found %d issues in %d objects.\n", len(report.Issues), scanned)
+	if len(report.Issues) > 0 {
+		os.Exit(1)
+	}
+}
+
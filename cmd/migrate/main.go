@@ -0,0 +1,100 @@
+// Package main in migrate lists and applies the data migrations in seneca/internal/migration, e.g.
+// 	$ go run ./cmd/migrate --database=bolt --bolt_path=seneca.db list
+// 	$ go run ./cmd/migrate --database=bolt --bolt_path=seneca.db --dry_run apply
+// An interrupted apply resumes where it stopped when run again.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"seneca/internal/audit"
+	"seneca/internal/client/database/backend"
+	"seneca/internal/client/logging"
+	"seneca/internal/migration"
+	"seneca/internal/util"
+	"text/tabwriter"
+)
+
+var (
+	databaseBackend = flag.String("database", "datastore", "The database backend to use, one of [datastore, postgres, bolt].")
+	postgresDSN     = flag.String("postgres_dsn", "", "The PostgreSQL connection string, required when --database=postgres.")
+	boltPath        = flag.String("bolt_path", "seneca.db", "The path to the local database file used when --database=bolt.")
+	dryRun          = flag.Bool("dry_run", false, "Count the objects the next pending migration would change, without writing anything.")
+	toVersion       = flag.Int64("to_version", 0, "The last migration version to apply, 0 applies all of them.")
+	pageSize        = flag.Int("page_size", migration.DefaultPageSize, "How many objects are migrated and committed at a time.")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] list|apply\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	registry, err := migration.Default()
+	if err != nil {
+		log.Fatalf("migration.Default() returns err: %v", err)
+	}
+
+	sqlService, err := backend.New(context.TODO(), backend.Config{Backend: *databaseBackend, PostgresDSN: *postgresDSN, BoltPath: *boltPath})
+	if err != nil {
+		log.Fatalf("backend.New() returns err: %v", err)
+	}
+
+	runner := migration.NewRunner(audit.NewSQL(sqlService, audit.SystemActor("migrate")), registry, logging.NewLocalLogger(false), *pageSize)
+
+	switch flag.Arg(0) {
+	case "list":
+		if err := list(runner); err != nil {
+			log.Fatalf("list() returns err: %v", err)
+		}
+	case "apply":
+		// Interrupting stops the migration between pages, the next apply resumes it.
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer cancel()
+
+		results, err := runner.Apply(ctx, *toVersion, *dryRun)
+		for _, result := range results {
+			fmt.Printf("%d %s: scanned %d, changed %d (dry run: %t, resumed: %t)\n", result.Migration.Version, result.Migration.Name, result.ObjectsScanned, result.ObjectsMigrated, result.DryRun, result.Resumed)
+		}
+		if err != nil {
+			log.Fatalf("Apply() returns err: %v", err)
+		}
+		if len(results) == 0 {
+			fmt.Println("No pending migrations.")
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func list(runner *migration.Runner) error {
+	statuses, err := runner.Status()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tTABLE\tSTATE\tSCANNED\tCHANGED\tCOMPLETED")
+	for _, status := range statuses {
+		scanned, changed, completed := int64(0), int64(0), ""
+		if status.Record != nil {
+			scanned, changed = status.Record.ObjectsScanned, status.Record.ObjectsMigrated
+		}
+		if status.Applied() {
+			completed = util.MillisecondsToTime(status.Record.CompleteTimeMs).Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%d\t%s\n", status.Migration.Version, status.Migration.Name, status.Migration.Table, status.State(), scanned, changed, completed)
+	}
+	return w.Flush()
+}
+
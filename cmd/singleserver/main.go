@@ -5,17 +5,28 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
 	"seneca/api/constants"
+	"seneca/api/senecaerror"
 	st "seneca/api/type"
 	"seneca/env"
+	"seneca/internal/audit"
 	"seneca/internal/authenticator"
+	"seneca/internal/client/cloud"
+	"seneca/internal/client/cloud/aws"
 	"seneca/internal/client/cloud/gcp"
-	"seneca/internal/client/cloud/gcp/datastore"
+	"seneca/internal/client/cloud/local"
+	"seneca/internal/client/database"
+	"seneca/internal/client/database/backend"
 	"seneca/internal/client/googledrive"
 	"seneca/internal/client/intraseneca"
 	senecahttp "seneca/internal/client/intraseneca/http"
@@ -25,20 +36,31 @@ import (
 	"seneca/internal/controller/runner"
 	"seneca/internal/controller/syncer"
 	"seneca/internal/dao"
+	"seneca/internal/dao/cacheddao"
 	"seneca/internal/dao/drivingconditiondao"
 	"seneca/internal/dao/eventdao"
+	"seneca/internal/dao/integrity"
 	"seneca/internal/dao/rawframedao"
 	"seneca/internal/dao/rawlocationdao"
 	"seneca/internal/dao/rawmotiondao"
+	"seneca/internal/dao/rawtelemetryfiledao"
+	"seneca/internal/dao/rawvehiclesignaldao"
 	"seneca/internal/dao/rawvideodao"
+	"seneca/internal/dao/sqldaoset"
 	"seneca/internal/dao/tripdao"
 	"seneca/internal/dao/userdao"
 	"seneca/internal/dataaggregator/sanitizer"
 	"seneca/internal/datagatherer/rawvideohandler"
+	"seneca/internal/datagatherer/telemetryhandler"
 	"seneca/internal/dataprocessor"
 	"seneca/internal/dataprocessor/algorithms"
+	"seneca/internal/jobqueue"
+	"seneca/internal/retention"
+	"seneca/internal/userarchive"
 	"seneca/internal/util"
 	"seneca/internal/util/mp4"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -47,9 +69,38 @@ import (
 
 const (
 	port = "6060"
+	// downloadsPath serves signed URLs for --storage=local.  It's routed around API key authorization.
+	downloadsPath = "/downloads/"
+	// defaultAuditLimit is how many audit records are listed if the request doesn't set limit.
+	defaultAuditLimit = 100
+	// defaultJobsLimit is how many jobs are listed if the request doesn't set limit.
+	defaultJobsLimit = 100
+)
+
+var (
+	databaseBackend = flag.String("database", "datastore", "The database backend to use, one of [datastore, postgres, bolt].")
+	postgresDSN     = flag.String("postgres_dsn", "", "The PostgreSQL connection string, required when --database=postgres.")
+	boltPath        = flag.String("bolt_path", "seneca.db", "The path to the local database file used when --database=bolt.")
+	storageBackend  = flag.String("storage", "gcs", "The file storage backend to use, one of [gcs, s3, local].")
+	storageRoot     = flag.String("storage_root", "seneca_storage", "The directory buckets are stored in when --storage=local.")
+	s3Endpoint      = flag.String("s3_endpoint", "", "The S3 endpoint used when --storage=s3, e.g. http://localhost:9000 for MinIO. Defaults to AWS.")
+	s3Region        = flag.String("s3_region", "", "The S3 region used when --storage=s3.")
+	s3PathStyle     = flag.Bool("s3_path_style", false, "Whether to use path style S3 addressing, which MinIO requires.")
+	downloadBaseURL = flag.String("download_base_url", fmt.Sprintf("http://localhost:%s%s", port, downloadsPath), "The URL signed downloads are served from when --storage=local.")
+	downloadKey     = flag.String("download_signing_key", "", "The key download URLs are signed with when --storage=local. If empty, SENECA_DOWNLOAD_SIGNING_KEY is used, one of which must be set unless --dev.")
+	videoURLExpiry  = flag.Duration("video_url_expiry", time.Hour, "How long signed video URLs are valid for, unless a request sets video_url_expiry.")
+	daoCacheSize    = flag.Int("dao_cache_size", 10000, "How many objects of each type the DAOs cache, 0 disables caching.")
+	daoCacheTTL     = flag.Duration("dao_cache_ttl", time.Minute*5, "How long the DAOs cache objects for.  Objects written around the DAOs, e.g. by other servers, may be this stale.")
+	retentionPolicy = flag.String("retention_policy", "", "The path to the JSON retention policy, see retention.Policy. If empty, objects are kept forever and soft deleted objects are purged after 30 days.")
+	reaperInterval  = flag.Duration("reaper_interval", time.Hour*24, "How often the retention policy is applied, 0 only applies it on POST /reaper.")
+	jobQueueBackend = flag.String("job_queue", "database", "Where background jobs are queued, one of [database, memory]. Jobs queued in memory are lost on restart.")
+	jobWorkers      = flag.Int("job_concurrency", jobqueue.DefaultConcurrency, "How many background jobs, e.g. users the runner processes, are run at a time.")
+	devMode         = flag.Bool("dev", false, "Whether this is a development server, which generates a random --download_signing_key if none is set.  URLs signed with it stop working on restart.")
 )
 
 func main() {
+	flag.Parse()
+
 	if err := env.ValidateEnvironmentVariables(); err != nil {
 		log.Fatalf("Error in ValidateEnvironmentVariables: %v", err)
 	}
@@ -80,26 +131,32 @@ func main() {
 
 	logger.Log(fmt.Sprintf("Starting singleserver"))
 
-	gcsc, err := gcp.NewGoogleCloudStorageClient(context.TODO(), projectID, time.Second*10, time.Minute)
+	simpleStorage, err := newSimpleStorage(projectID)
 	if err != nil {
-		logger.Critical(fmt.Sprintf("cloud.NewGoogleCloudStorageClient() returns - err: %v", err))
+		logger.Critical(fmt.Sprintf("newSimpleStorage() returns - err: %v", err))
 		return
 	}
 
-	sqlService, err := datastore.New(context.TODO(), projectID)
+	sqlService, err := backend.New(context.TODO(), backend.Config{Backend: *databaseBackend, PostgresDSN: *postgresDSN, BoltPath: *boltPath})
 	if err != nil {
-		logger.Critical(fmt.Sprintf("datastore.New() returns - err: %v", err))
+		logger.Critical(fmt.Sprintf("backend.New() returns - err: %v", err))
 		return
 	}
 
-	rawVideoDAO := rawvideodao.NewSQLRawVideoDAO(sqlService, logger, (time.Second * 5))
-	rawLocationDAO := rawlocationdao.NewSQLRawLocationDAO(sqlService)
-	rawMotionDAO := rawmotiondao.NewSQLRawMotionDAO(sqlService, logger)
-	rawFrameDAO := rawframedao.NewSQLRawFrameDAO(sqlService)
-	userDAO := userdao.NewSQLUserDAO(sqlService)
-	tripDAO := tripdao.NewSQLTripDAO(sqlService, logger)
-	eventDAO := eventdao.NewSQLEventDAO(sqlService, tripDAO, logger)
-	drivingConditionDAO := drivingconditiondao.NewSQLDrivingConditionDAO(sqlService, tripDAO, eventDAO)
+	// Changes are attributed to the user who owns the data, unless they're made by the algorithms, the API or the reaper.
+	auditedSQL := audit.NewSQL(sqlService, "")
+	// Objects whose user, trip or source doesn't exist or belongs to another user are refused.
+	validatedSQL := integrity.NewSQL(auditedSQL)
+	rawVideoDAO := rawvideodao.NewSQLRawVideoDAO(validatedSQL, logger, (time.Second * 5))
+	rawLocationDAO := rawlocationdao.NewSQLRawLocationDAO(validatedSQL)
+	rawMotionDAO := rawmotiondao.NewSQLRawMotionDAO(validatedSQL, logger)
+	rawFrameDAO := rawframedao.NewSQLRawFrameDAO(validatedSQL)
+	userDAO := userdao.NewSQLUserDAO(validatedSQL)
+	tripDAO := tripdao.NewSQLTripDAO(validatedSQL, logger)
+	eventDAO := eventdao.NewSQLEventDAO(validatedSQL, tripDAO, logger)
+	drivingConditionDAO := drivingconditiondao.NewSQLDrivingConditionDAO(validatedSQL, drivingconditiondao.SQLTripDAOs(logger))
+	rawTelemetryFileDAO := rawtelemetryfiledao.NewSQLRawTelemetryFileDAO(validatedSQL)
+	rawVehicleSignalDAO := rawvehiclesignaldao.NewSQLRawVehicleSignalDAO(validatedSQL)
 	allDAOSet := &dao.AllDAOSet{
 		UserDAO:             userDAO,
 		RawVideoDAO:         rawVideoDAO,
@@ -109,6 +166,18 @@ func main() {
 		TripDAO:             tripDAO,
 		EventDAO:            eventDAO,
 		DrivingConditionDAO: drivingConditionDAO,
+		RawTelemetryFileDAO: rawTelemetryFileDAO,
+		RawVehicleSignalDAO: rawVehicleSignalDAO,
+	}
+	algoTags := []string{"00000", "00001", "00002", "00003", "00004", "00005"}
+	algoDAOSet := sqldaoset.New(integrity.NewSQL(auditedSQL.WithActor(audit.AlgoActor(algoTags...))), logger, time.Second*5)
+	apiDAOSet := sqldaoset.New(integrity.NewSQL(auditedSQL.WithActor(audit.APIKeyActor(constants.SenecaAPIKey))), logger, time.Second*5)
+	var daoCaches *cacheddao.Caches
+	if *daoCacheSize > 0 {
+		daoCaches = cacheddao.NewCaches(*daoCacheSize, *daoCacheTTL)
+		allDAOSet = cacheddao.Wrap(allDAOSet, daoCaches)
+		algoDAOSet = cacheddao.Wrap(algoDAOSet, daoCaches)
+		apiDAOSet = cacheddao.Wrap(apiDAOSet, daoCaches)
 	}
 
 	mp4Tool, err := mp4.NewMP4Tool(logger)
@@ -116,14 +185,27 @@ func main() {
 		logger.Critical(fmt.Sprintf("mp4.NewMP4Tool() returns - err: %v", err))
 		return
 	}
-	rawVideoHandler, err := rawvideohandler.NewRawVideoHandler(gcsc, mp4Tool, rawVideoDAO, rawLocationDAO, rawMotionDAO, rawFrameDAO, logger, projectID)
+	var jobQueue jobqueue.Queue
+	switch *jobQueueBackend {
+	case "database":
+		jobQueue = jobqueue.NewSQL(sqlService, jobqueue.DefaultOptions())
+	case "memory":
+		jobQueue = jobqueue.NewMemory(jobqueue.DefaultOptions())
+	default:
+		logger.Critical(fmt.Sprintf("unsupported --job_queue %q", *jobQueueBackend))
+		return
+	}
+
+	rawVideoHandler, err := rawvideohandler.NewRawVideoHandler(simpleStorage, mp4Tool, allDAOSet.RawVideoDAO, sqldaoset.NewTransactionRunner(validatedSQL, logger, time.Second*5), jobQueue, logger, projectID)
 	if err != nil {
 		logger.Critical(fmt.Sprintf("cloud.NewRawVideoHandler() returns - err: %v", err))
 		return
 	}
 
+	telemetryHandler := telemetryhandler.NewTelemetryHandler(simpleStorage, sqldaoset.NewTransactionRunner(validatedSQL, logger, time.Second*5), jobQueue, logger)
+
 	gDriveFactory := &googledrive.UserClientFactory{}
-	syncer := syncer.New(rawVideoHandler, gDriveFactory, userDAO, logger)
+	syncer := syncer.New(rawVideoHandler, telemetryHandler, gDriveFactory, allDAOSet.UserDAO, jobQueue, logger)
 
 	algoFactory, err := algorithms.NewFactory(weatherservice.NewWeatherStackService(time.Second*10), intraSenecaClient)
 	if err != nil {
@@ -131,7 +213,6 @@ func main() {
 		return
 	}
 	algos := []dataprocessor.AlgorithmInterface{}
-	algoTags := []string{"00000", "00001", "00002", "00003", "00004"}
 	for _, tag := range algoTags {
 		algo, err := algoFactory.GetAlgorithm(tag)
 		if err != nil {
@@ -140,25 +221,64 @@ func main() {
 		algos = append(algos, algo)
 	}
 
-	dataprocessor, err := dataprocessor.New(algos, allDAOSet, logger)
+	dataprocessor, err := dataprocessor.New(algos, algoDAOSet, logger)
 	if err != nil {
 		logger.Critical(fmt.Sprintf("dataprocessor.New() returns - err: %v", err))
 		return
 	}
-	runner := runner.New(userDAO, dataprocessor, logger)
-	sanitizer := sanitizer.New(rawMotionDAO, rawLocationDAO, rawVideoDAO, rawFrameDAO, eventDAO, drivingConditionDAO)
-	apiserver := apiserver.New(sanitizer, tripDAO)
+	runner := runner.New(allDAOSet.UserDAO, dataprocessor, sqlService, jobQueue, *jobWorkers, logger)
+
+	worker := jobqueue.NewWorker(jobQueue, *jobWorkers, logger)
+	worker.Handle(jobqueue.SyncUser, syncer.HandleSyncUserJob)
+	worker.Handle(jobqueue.ProcessRawVideo, syncer.HandleProcessRawVideoJob)
+	worker.Handle(jobqueue.ProcessTelemetry, syncer.HandleProcessTelemetryJob)
+	worker.Handle(jobqueue.RunAlgorithms, runner.HandleRunAlgorithmsJob)
+	go worker.Run(context.Background())
+
+	urlSigner, ok := simpleStorage.(cloud.SignedURLInterface)
+	if !ok {
+		logger.Critical(fmt.Sprintf("--storage=%s does not support signed URLs", *storageBackend))
+		return
+	}
+	sanitizer := sanitizer.New(allDAOSet.RawMotionDAO, allDAOSet.RawLocationDAO, allDAOSet.RawVideoDAO, allDAOSet.RawFrameDAO, allDAOSet.EventDAO, allDAOSet.DrivingConditionDAO, urlSigner)
+	apiserver := apiserver.New(sanitizer, allDAOSet.TripDAO)
+
+	policy := retention.DefaultPolicy()
+	if *retentionPolicy != "" {
+		policyFile, err := os.Open(*retentionPolicy)
+		if err != nil {
+			logger.Critical(fmt.Sprintf("os.Open(%q) returns - err: %v", *retentionPolicy, err))
+			return
+		}
+		policy, err = retention.LoadPolicy(policyFile)
+		policyFile.Close()
+		if err != nil {
+			logger.Critical(fmt.Sprintf("retention.LoadPolicy(%q) returns - err: %v", *retentionPolicy, err))
+			return
+		}
+	}
+	reaper := retention.NewReaper(auditedSQL.WithActor(retention.ReaperActor), simpleStorage, policy, logger)
+	if *reaperInterval > 0 {
+		go reaper.RunPeriodically(context.Background(), *reaperInterval)
+	}
 
 	handler := &HTTPHandler{
-		syncer:              syncer,
-		runner:              runner,
-		eventDAO:            eventDAO,
-		drivingconditionDAO: drivingConditionDAO,
+		jobQueue:            jobQueue,
+		reaper:              reaper,
+		eventDAO:            apiDAOSet.EventDAO,
+		drivingconditionDAO: apiDAOSet.DrivingConditionDAO,
 		apiserver:           apiserver,
+		telemetryHandler:    telemetryHandler,
+		exporter:            userarchive.NewExporter(sqlService, simpleStorage, logger),
+		sql:                 sqlService,
+		daoCaches:           daoCaches,
 		logger:              logger,
 	}
 
 	http.HandleFunc("/", handler.handleHTTP)
+	if localStorage, ok := simpleStorage.(*local.FileSystemStorageClient); ok {
+		http.HandleFunc(downloadsPath, localStorage.ServeSignedURL)
+	}
 
 	fmt.Printf("Starting server at port %s\n", port)
 	if err := http.ListenAndServe(fmt.Sprintf(":%s", port), nil); err != nil {
@@ -166,13 +286,64 @@ func main() {
 	}
 }
 
+// newSimpleStorage initializes the file storage backend chosen by the --storage flag.
+func newSimpleStorage(projectID string) (cloud.SimpleStorageInterface, error) {
+	switch *storageBackend {
+	case "gcs":
+		return gcp.NewGoogleCloudStorageClient(context.TODO(), projectID, time.Second*10, time.Minute)
+	case "s3":
+		// Credentials are read from the standard AWS environment variables and config files.
+		return aws.NewS3StorageClient(&aws.S3Config{
+			Endpoint:       *s3Endpoint,
+			Region:         *s3Region,
+			ForcePathStyle: *s3PathStyle,
+		}, projectID, time.Second*10, time.Minute*5)
+	case "local":
+		signingKey, err := downloadSigningKey()
+		if err != nil {
+			return nil, err
+		}
+		return local.NewFileSystemStorageClient(*storageRoot, &local.SignedURLConfig{
+			BaseURL:    *downloadBaseURL,
+			SigningKey: signingKey,
+		})
+	default:
+		return nil, fmt.Errorf("unsupported --storage %q", *storageBackend)
+	}
+}
+
+// downloadSigningKey returns the key set by flag or environment variable, or generates one for development servers.
+func downloadSigningKey() ([]byte, error) {
+	if *downloadKey != "" {
+		return []byte(*downloadKey), nil
+	}
+	if key := os.Getenv("SENECA_DOWNLOAD_SIGNING_KEY"); key != "" {
+		return []byte(key), nil
+	}
+	if !*devMode {
+		return nil, fmt.Errorf("--download_signing_key or SENECA_DOWNLOAD_SIGNING_KEY must be set when --storage=local, unless --dev")
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("error generating download signing key: %w", err)
+	}
+	return key, nil
+}
+
 type HTTPHandler struct {
-	syncer              *syncer.Syncer
-	runner              *runner.Runner
+	jobQueue            jobqueue.Queue
+	reaper              *retention.Reaper
 	eventDAO            dao.EventDAO
 	drivingconditionDAO dao.DrivingConditionDAO
 	apiserver           *apiserver.APIServer
-	logger              logging.LoggingInterface
+	telemetryHandler    *telemetryhandler.TelemetryHandler
+	exporter            *userarchive.Exporter
+	// sql is only read from.
+	sql database.SQLInterface
+	// daoCaches is nil if the DAOs aren't cached.
+	daoCaches *cacheddao.Caches
+	logger    logging.LoggingInterface
 }
 
 func (handler *HTTPHandler) handleHTTP(w http.ResponseWriter, r *http.Request) {
@@ -188,12 +359,26 @@ func (handler *HTTPHandler) handleHTTP(w http.ResponseWriter, r *http.Request) {
 		handler.runSyncer(w, r)
 	} else if matchesRoute("/runner", r.URL.Path) {
 		handler.runRunner(w, r)
+	} else if matchesRoute("/jobs", r.URL.Path) {
+		handler.handleJobsRequest(w, r)
+	} else if matchesRoute("/jobs/*", r.URL.Path) {
+		handler.handleJobRequest(w, r)
+	} else if matchesRoute("/reaper", r.URL.Path) {
+		handler.runReaper(w, r)
+	} else if matchesRoute("/cache_stats", r.URL.Path) {
+		handler.handleCacheStats(w, r)
 	} else if matchesRoute("/users/*/events", r.URL.Path) {
 		handler.handleEventRequest(w, r)
 	} else if matchesRoute("/users/*/driving_conditions", r.URL.Path) {
 		handler.handleDrivingConditionRequest(w, r)
 	} else if matchesRoute("/users/*/trips", r.URL.Path) {
 		handler.handleTripsRequest(w, r)
+	} else if matchesRoute("/users/*/telemetry", r.URL.Path) {
+		handler.handleTelemetryRequest(w, r)
+	} else if matchesRoute("/users/*/export", r.URL.Path) {
+		handler.handleExportRequest(w, r)
+	} else if matchesRoute("/users/*/audit", r.URL.Path) {
+		handler.handleAuditRequest(w, r)
 	} else {
 		fmt.Fprintf(w, "Unsupported request URL path.  Refer to discovery/discovery.json in the common repo.")
 		w.WriteHeader(400)
@@ -206,8 +391,7 @@ func (handler *HTTPHandler) runSyncer(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(400)
 		return
 	}
-	go handler.syncer.ScanAllUsers()
-	w.WriteHeader(200)
+	handler.enqueueJob(w, jobqueue.SyncUser)
 }
 
 func (handler *HTTPHandler) runRunner(w http.ResponseWriter, r *http.Request) {
@@ -216,10 +400,119 @@ func (handler *HTTPHandler) runRunner(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(400)
 		return
 	}
-	go handler.runner.Run()
+	handler.enqueueJob(w, jobqueue.RunAlgorithms)
+}
+
+// enqueueJob queues a job of the type for all users, which the worker runs, and responds with its ID.
+func (handler *HTTPHandler) enqueueJob(w http.ResponseWriter, jobType string) {
+	job, err := jobqueue.NewJob(jobType, "", nil)
+	if err == nil {
+		job, err = handler.jobQueue.Enqueue(context.Background(), job)
+	}
+	if err != nil {
+		senecaerror.WriteErrorToHTTPResponse(w, err)
+		logging.LogSenecaError(handler.logger, err)
+		return
+	}
+	handler.writeJSON(w, &jobqueue.EnqueueResponse{JobID: job.Id})
+}
+
+// handleJobsRequest lists the jobs of the user in the user query parameter, or the jobs for all users if it's empty.
+// The other query parameters are limit (defaults to 100) and cursor (the next_cursor of the previous page).
+func (handler *HTTPHandler) handleJobsRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		fmt.Fprintf(w, "/jobs only supports GET methods")
+		w.WriteHeader(400)
+		return
+	}
+
+	query := r.URL.Query()
+	userID := query.Get("user")
+	limit := defaultJobsLimit
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, "limit must be an integer", 400)
+			return
+		}
+		limit = parsed
+	}
+	statuses, nextCursor, err := jobqueue.ListStatuses(r.Context(), handler.jobQueue, userID, query.Get("cursor"), limit)
+	if err != nil {
+		handler.logger.Error(fmt.Sprintf("ListStatuses() for user %q returns err: %v", userID, err))
+		senecaerror.WriteErrorToHTTPResponse(w, err)
+		return
+	}
+	handler.writeJSON(w, &jobqueue.ListResponse{Jobs: statuses, NextCursor: nextCursor})
+}
+
+// handleJobRequest reports the job, along with the per-user and per-file jobs it enqueued.
+func (handler *HTTPHandler) handleJobRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		fmt.Fprintf(w, "/jobs/* only supports GET methods")
+		w.WriteHeader(400)
+		return
+	}
+
+	jobID := strings.Split(r.URL.Path, "/")[2]
+	status, err := jobqueue.GetStatus(r.Context(), handler.jobQueue, jobID)
+	if err != nil {
+		var nfe *senecaerror.NotFoundError
+		if errors.As(err, &nfe) {
+			http.Error(w, fmt.Sprintf("job %q not found", jobID), 404)
+			return
+		}
+		handler.logger.Error(fmt.Sprintf("GetStatus(%q) returns err: %v", jobID, err))
+		senecaerror.WriteErrorToHTTPResponse(w, err)
+		return
+	}
+	handler.writeJSON(w, status)
+}
+
+func (handler *HTTPHandler) writeJSON(w http.ResponseWriter, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		handler.logger.Error(fmt.Sprintf("Error writing %T: %v", response, err))
+	}
+}
+
+func (handler *HTTPHandler) runReaper(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		fmt.Fprintf(w, "/reaper only supports POST methods")
+		w.WriteHeader(400)
+		return
+	}
+	go func() {
+		if _, err := handler.reaper.Run(context.Background()); err != nil {
+			handler.logger.Error(fmt.Sprintf("Reaper.Run() returns err: %v", err))
+		}
+	}()
 	w.WriteHeader(200)
 }
 
+func (handler *HTTPHandler) handleCacheStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		fmt.Fprintf(w, "/cache_stats only supports GET methods")
+		w.WriteHeader(400)
+		return
+	}
+	if handler.daoCaches == nil {
+		fmt.Fprintf(w, "DAO caching is disabled, see --dao_cache_size.\n")
+		return
+	}
+
+	stats := handler.daoCaches.Stats()
+	tableNames := []string{}
+	for tableName := range stats {
+		tableNames = append(tableNames, tableName.String())
+	}
+	sort.Strings(tableNames)
+	for _, tableName := range tableNames {
+		tableStats := stats[constants.TableName(tableName)]
+		fmt.Fprintf(w, "%s: hits=%d misses=%d evictions=%d\n", tableName, tableStats.Hits, tableStats.Misses, tableStats.Evictions)
+	}
+}
+
 func (handler *HTTPHandler) handleTripsRequest(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		fmt.Fprintf(w, "/users/*/trips only supports GET methods")
@@ -238,7 +531,15 @@ func (handler *HTTPHandler) handleTripsRequest(w http.ResponseWriter, r *http.Re
 			return nil, fmt.Errorf("unable to unmarshal request body into TripListRequest")
 		}
 
-		trips, err := handler.apiserver.ListTrips(request.UserId, util.MillisecondsToTime(request.StartTimeMs), util.MillisecondsToTime(request.EndTimeMs))
+		expiry := *videoURLExpiry
+		if expiryParam := r.URL.Query().Get("video_url_expiry"); expiryParam != "" {
+			expiry, err = time.ParseDuration(expiryParam)
+			if err != nil || expiry <= 0 || expiry > cloud.MaxSignedURLExpiry {
+				return nil, fmt.Errorf("video_url_expiry must be a duration in (0, %s]", cloud.MaxSignedURLExpiry)
+			}
+		}
+
+		trips, err := handler.apiserver.ListTrips(request.UserId, util.MillisecondsToTime(request.StartTimeMs), util.MillisecondsToTime(request.EndTimeMs), expiry)
 		if err != nil {
 			return nil, fmt.Errorf("error listing trips: %w", err)
 		}
@@ -274,6 +575,120 @@ func (handler *HTTPHandler) handleTripsRequest(w http.ResponseWriter, r *http.Re
 	w.WriteHeader(int(response.Header.Code))
 }
 
+// handleTelemetryRequest stores the GPS log uploaded in the "telemetry" form field for the user.
+func (handler *HTTPHandler) handleTelemetryRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		fmt.Fprintf(w, "/users/*/telemetry only supports POST methods")
+		w.WriteHeader(400)
+		return
+	}
+
+	userID := strings.Split(r.URL.Path, "/")[2]
+	handler.telemetryHandler.HandleTelemetryHTTPRequest(w, r, userID)
+}
+
+// handleExportRequest streams the archive of the user's data, see package userarchive.
+// The query parameters are format (json or proto, defaults to json) and media (true to include files from storage).
+func (handler *HTTPHandler) handleExportRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		fmt.Fprintf(w, "/users/*/export only supports GET methods")
+		w.WriteHeader(400)
+		return
+	}
+
+	userID := strings.Split(r.URL.Path, "/")[2]
+	options := &userarchive.ExportOptions{RecordFormat: userarchive.JSONRecordFormat}
+	if formatParam := r.URL.Query().Get("format"); formatParam != "" {
+		format, err := userarchive.ParseRecordFormat(formatParam)
+		if err != nil {
+			senecaerror.WriteErrorToHTTPResponse(w, err)
+			return
+		}
+		options.RecordFormat = format
+	}
+	if mediaParam := r.URL.Query().Get("media"); mediaParam != "" {
+		includeMedia, err := strconv.ParseBool(mediaParam)
+		if err != nil {
+			http.Error(w, "media must be true or false", 400)
+			return
+		}
+		options.IncludeMedia = includeMedia
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("seneca-export-%s.zip", userID)))
+	counter := &countingWriter{w: w}
+	if _, err := handler.exporter.Export(r.Context(), userID, options, counter); err != nil {
+		handler.logger.Error(fmt.Sprintf("Export() for user %q returns err: %v", userID, err))
+		if counter.n > 0 {
+			// The status was already sent, the client sees a truncated archive.
+			return
+		}
+		w.Header().Del("Content-Disposition")
+		var nfe *senecaerror.NotFoundError
+		if errors.As(err, &nfe) {
+			http.Error(w, fmt.Sprintf("User %q not found.", userID), 404)
+			return
+		}
+		http.Error(w, "Error exporting user data.", 500)
+	}
+}
+
+// auditResponse is the JSON body of responses to /users/*/audit.
+type auditResponse struct {
+	Records    []*database.AuditRecord `json:"records"`
+	NextCursor string                  `json:"next_cursor,omitempty"`
+}
+
+// handleAuditRequest lists the audit records of changes to the user's data, oldest first.
+// The query parameters are start_ms and end_ms (the time range, defaults to all time), limit (defaults to 100) and
+// cursor (the next_cursor of the previous page).
+func (handler *HTTPHandler) handleAuditRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		fmt.Fprintf(w, "/users/*/audit only supports GET methods")
+		w.WriteHeader(400)
+		return
+	}
+
+	userID := strings.Split(r.URL.Path, "/")[2]
+	query := r.URL.Query()
+	params := map[string]int64{"start_ms": 0, "end_ms": util.TimeToMilliseconds(time.Now()) + 1, "limit": defaultAuditLimit}
+	for name := range params {
+		if value := query.Get(name); value != "" {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("%s must be an integer", name), 400)
+				return
+			}
+			params[name] = parsed
+		}
+	}
+
+	records, nextCursor, err := audit.ListRecords(handler.sql, userID, util.MillisecondsToTime(params["start_ms"]), util.MillisecondsToTime(params["end_ms"]), query.Get("cursor"), int(params["limit"]))
+	if err != nil {
+		handler.logger.Error(fmt.Sprintf("ListRecords() for user %q returns err: %v", userID, err))
+		senecaerror.WriteErrorToHTTPResponse(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&auditResponse{Records: records, NextCursor: nextCursor}); err != nil {
+		handler.logger.Error(fmt.Sprintf("Error writing audit records of user %q: %v", userID, err))
+	}
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
 func (handler *HTTPHandler) handleEventRequest(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		fmt.Fprintf(w, "/users/*/events only supports POST methods")
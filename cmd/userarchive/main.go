@@ -0,0 +1,180 @@
+// Package main in userarchive exports users' data into archives and imports archives, see seneca/internal/userarchive, e.g.
+// 	$ go run ./cmd/userarchive --database=bolt --bolt_path=seneca.db --storage=local --include_media --user_id=1234 --archive=export.zip export
+// 	$ go run ./cmd/userarchive --database=bolt --bolt_path=seneca.db --storage=local --include_media --archive=export.zip import
+// Importing creates the user in the archive, unless --user_id is set to restore the data into an existing user.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"seneca/api/constants"
+	"seneca/internal/audit"
+	"seneca/internal/client/cloud"
+	"seneca/internal/client/cloud/aws"
+	"seneca/internal/client/cloud/gcp"
+	"seneca/internal/client/cloud/local"
+	"seneca/internal/client/database"
+	"seneca/internal/client/database/backend"
+	"seneca/internal/client/logging"
+	"seneca/internal/dao/integrity"
+	"seneca/internal/dao/sqldaoset"
+	"seneca/internal/userarchive"
+	"time"
+)
+
+var (
+	userID          = flag.String("user_id", "", "The ID of the user to export, or of the existing user to import into.")
+	archivePath     = flag.String("archive", "", "The path of the archive to write or read.")
+	format          = flag.String("format", string(userarchive.JSONRecordFormat), "How objects are encoded in exported archives, one of [json, proto].")
+	includeMedia    = flag.Bool("include_media", false, "Whether to export the user's videos and frames from storage, or upload them when importing.")
+	databaseBackend = flag.String("database", "datastore", "The database backend to use, one of [datastore, postgres, bolt].")
+	postgresDSN     = flag.String("postgres_dsn", "", "The PostgreSQL connection string, required when --database=postgres.")
+	boltPath        = flag.String("bolt_path", "seneca.db", "The path to the local database file used when --database=bolt.")
+	storageBackend  = flag.String("storage", "gcs", "The file storage backend to use with --include_media, one of [gcs, s3, local].")
+	storageRoot     = flag.String("storage_root", "seneca_storage", "The directory buckets are stored in when --storage=local.")
+	s3Endpoint      = flag.String("s3_endpoint", "", "The S3 endpoint used when --storage=s3, e.g. http://localhost:9000 for MinIO. Defaults to AWS.")
+	s3Region        = flag.String("s3_region", "", "The S3 region used when --storage=s3.")
+	s3PathStyle     = flag.Bool("s3_path_style", false, "Whether to use path style S3 addressing, which MinIO requires.")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] export|import\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 || *archivePath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	sqlService, err := backend.New(context.TODO(), backend.Config{Backend: *databaseBackend, PostgresDSN: *postgresDSN, BoltPath: *boltPath})
+	if err != nil {
+		log.Fatalf("backend.New() returns err: %v", err)
+	}
+	var simpleStorage cloud.SimpleStorageInterface
+	if *includeMedia {
+		simpleStorage, err = newSimpleStorage()
+		if err != nil {
+			log.Fatalf("newSimpleStorage() returns err: %v", err)
+		}
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	switch flag.Arg(0) {
+	case "export":
+		if *userID == "" {
+			flag.Usage()
+			os.Exit(2)
+		}
+		if err := export(ctx, sqlService, simpleStorage); err != nil {
+			log.Fatalf("export() returns err: %v", err)
+		}
+	case "import":
+		if err := importArchive(ctx, sqlService, simpleStorage); err != nil {
+			log.Fatalf("importArchive() returns err: %v", err)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func export(ctx context.Context, sqlService database.SQLInterface, simpleStorage cloud.SimpleStorageInterface) error {
+	recordFormat, err := userarchive.ParseRecordFormat(*format)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(*archivePath)
+	if err != nil {
+		return err
+	}
+	exporter := userarchive.NewExporter(sqlService, simpleStorage, logging.NewLocalLogger(false))
+	manifest, err := exporter.Export(ctx, *userID, &userarchive.ExportOptions{RecordFormat: recordFormat, IncludeMedia: *includeMedia}, f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(*archivePath)
+		return err
+	}
+
+	for _, table := range manifest.Tables {
+		fmt.Printf("%s: %d\n", table.TableName, table.Count)
+	}
+	fmt.Printf("Wrote %d media files to %s\n", len(manifest.Media), *archivePath)
+	return nil
+}
+
+func importArchive(ctx context.Context, sqlService database.SQLInterface, simpleStorage cloud.SimpleStorageInterface) error {
+	f, err := os.Open(*archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	logger := logging.NewLocalLogger(false)
+	// The project ID is only used to name the buckets of uploaded frames.
+	importer := userarchive.NewImporter(sqldaoset.New(integrity.NewSQL(audit.NewSQL(sqlService, audit.SystemActor("userarchive"))), logger, time.Second*5), simpleStorage, logger, os.Getenv("GOOGLE_CLOUD_PROJECT"))
+	result, err := importer.Import(ctx, f, info.Size(), &userarchive.ImportOptions{UserID: *userID, IncludeMedia: *includeMedia})
+	if result != nil && result.UserID != "" {
+		for _, tableName := range constants.DataTableNames {
+			fmt.Printf("%s: %d\n", tableName, len(result.IDs[tableName]))
+		}
+		fmt.Printf("Imported into user %s with %d media files\n", result.UserID, result.MediaUploaded)
+	}
+	if err != nil {
+		if result != nil && result.UserID != "" {
+			return fmt.Errorf("%w (the partially imported data of user %s can be deleted with data.DeleteAllUserData)", err, result.UserID)
+		}
+		return err
+	}
+	return nil
+}
+
+// newSimpleStorage initializes the file storage backend chosen by the --storage flag.
+func newSimpleStorage() (cloud.SimpleStorageInterface, error) {
+	switch *storageBackend {
+	case "gcs":
+		projectID, err := projectID()
+		if err != nil {
+			return nil, err
+		}
+		return gcp.NewGoogleCloudStorageClient(context.TODO(), projectID, time.Second*10, time.Minute)
+	case "s3":
+		projectID, err := projectID()
+		if err != nil {
+			return nil, err
+		}
+		// Credentials are read from the standard AWS environment variables and config files.
+		return aws.NewS3StorageClient(&aws.S3Config{
+			Endpoint:       *s3Endpoint,
+			Region:         *s3Region,
+			ForcePathStyle: *s3PathStyle,
+		}, projectID, time.Second*10, time.Minute*5)
+	case "local":
+		// Signed URLs aren't needed to read files.
+		return local.NewFileSystemStorageClient(*storageRoot, nil)
+	default:
+		return nil, fmt.Errorf("unsupported --storage %q", *storageBackend)
+	}
+}
+
+func projectID() (string, error) {
+	projectID := os.Getenv("GOOGLE_CLOUD_PROJECT")
+	if projectID == "" {
+		return "", fmt.Errorf("GOOGLE_CLOUD_PROJECT environment variable must be set when --database=datastore or --storage=gcs|s3")
+	}
+	return projectID, nil
+}
@@ -7,14 +7,17 @@ require (
 	cloud.google.com/go/datastore v1.1.0
 	cloud.google.com/go/logging v1.3.0
 	cloud.google.com/go/storage v1.14.0
+	github.com/aws/aws-sdk-go v1.40.0
 	github.com/cenkalti/backoff v2.2.1+incompatible
 	github.com/golang/groupcache v0.0.0-20210331224755-41bb18bfe9da // indirect
 	github.com/golang/protobuf v1.5.2
 	github.com/google/go-cmp v0.5.5
+	github.com/lib/pq v1.10.2
 	github.com/ugjka/go-tz v1.0.23
-	golang.org/x/net v0.0.0-20210405180319-a5a99cb37ef4 // indirect
+	go.etcd.io/bbolt v1.3.6
+	golang.org/x/net v0.0.0-20210614182718-04defd469f4e // indirect
 	golang.org/x/oauth2 v0.0.0-20210402161424-2e8d93401602
-	golang.org/x/sys v0.0.0-20210403161142-5e06dd20ab57 // indirect
+	golang.org/x/sys v0.0.0-20210423082822-04245dca01da // indirect
 	golang.org/x/text v0.3.6 // indirect
 	google.golang.org/api v0.43.0
 	google.golang.org/genproto v0.0.0-20210406143921-e86de6bf7a46 // indirect
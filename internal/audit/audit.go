@@ -0,0 +1,39 @@
+// Package audit records every change to the data tables in constants.AuditTable, with who made it and what changed.
+//
+// Changes are recorded by wrapping the database.SQLInterface the DAOs are built on with an SQLService, which writes
+// each change and its database.AuditRecord in one transaction.
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// apiKeyFingerprintLength is how many hex characters of the hash of an API key identify it.
+const apiKeyFingerprintLength = 12
+
+const algoActorPrefix = "algo:"
+
+//	UserActor is the actor of changes made by the user.
+func UserActor(userID string) string {
+	return "user:" + userID
+}
+
+//	AlgoActor is the actor of changes made by the algorithms with the given tags.  An SQLService with an AlgoActor
+//	attributes changes to objects with an AlgoTag, i.e. events and driving conditions, to the algorithm in it instead.
+func AlgoActor(algoTags ...string) string {
+	return algoActorPrefix + strings.Join(algoTags, ",")
+}
+
+//	APIKeyActor is the actor of changes made by requests with the API key.  The key is identified by a prefix of its
+//	hash, so that audit records don't leak it.
+func APIKeyActor(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return "api_key:" + hex.EncodeToString(sum[:])[:apiKeyFingerprintLength]
+}
+
+//	SystemActor is the actor of changes made by Seneca itself, e.g. SystemActor("reaper").
+func SystemActor(name string) string {
+	return "system:" + name
+}
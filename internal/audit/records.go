@@ -0,0 +1,128 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"seneca/api/constants"
+	"seneca/api/senecaerror"
+	"seneca/internal/client/database"
+	"seneca/internal/util"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+)
+
+// MaxListLimit is the most records ListRecords returns at a time.
+const MaxListLimit = 1000
+
+//	ListRecords lists one page of the audit records of changes to the user's data in [start, end), oldest first.
+//	Params:
+//		sql database.SQLInterface
+//		userID string
+//		start time.Time
+//		end time.Time
+//		cursor string: "" for the first page
+//		limit int: at most MaxListLimit
+//	Returns:
+//		[]*database.AuditRecord: with their Ids set
+//		string: the cursor of the next page, "" if there are no more records
+//		senecaerror.UserError: if the limit is out of range
+//		error
+func ListRecords(sql database.SQLInterface, userID string, start, end time.Time, cursor string, limit int) ([]*database.AuditRecord, string, error) {
+	if limit <= 0 || limit > MaxListLimit {
+		return nil, "", senecaerror.NewUserError(userID, fmt.Errorf("limit %d out of range", limit), fmt.Sprintf("The limit must be in [1, %d].", MaxListLimit))
+	}
+
+	query := database.NewQuery(constants.AuditTable).
+		Where(constants.UserIDFieldName, "=", userID).
+		Range(constants.TimestampFieldName, util.TimeToMilliseconds(start), util.TimeToMilliseconds(end)).
+		OrderBy(constants.TimestampFieldName).
+		WithLimit(limit).
+		WithCursor(cursor)
+	ids, nextCursor, err := sql.ListIDsByQuery(query)
+	if err != nil {
+		return nil, "", fmt.Errorf("error listing audit records of user %q: %w", userID, err)
+	}
+	if len(ids) == 0 {
+		return []*database.AuditRecord{}, nextCursor, nil
+	}
+
+	objects, err := sql.GetByIDs(constants.AuditTable, ids)
+	if err != nil {
+		return nil, "", fmt.Errorf("error getting %d audit records: %w", len(ids), err)
+	}
+	records := []*database.AuditRecord{}
+	for i, object := range objects {
+		record, ok := object.(*database.AuditRecord)
+		if !ok {
+			return nil, "", senecaerror.NewBadStateError(fmt.Errorf("got object of type %T from table %q", object, constants.AuditTable))
+		}
+		record.Id = ids[i]
+		records = append(records, record)
+	}
+	return records, nextCursor, nil
+}
+
+// diff returns JSON objects of the fields that differ between before and after, with their values in each.
+// A nil object gives "", and unchanged objects give "{}".
+func diff(before, after interface{}) (string, string, error) {
+	beforeFields, err := jsonFields(before)
+	if err != nil {
+		return "", "", err
+	}
+	afterFields, err := jsonFields(after)
+	if err != nil {
+		return "", "", err
+	}
+
+	for field, value := range beforeFields {
+		if afterValue, ok := afterFields[field]; ok && bytes.Equal(value, afterValue) {
+			delete(beforeFields, field)
+			delete(afterFields, field)
+		}
+	}
+
+	beforeJSON, err := marshalFields(beforeFields)
+	if err != nil {
+		return "", "", err
+	}
+	afterJSON, err := marshalFields(afterFields)
+	if err != nil {
+		return "", "", err
+	}
+	return beforeJSON, afterJSON, nil
+}
+
+// jsonFields returns the fields of the object in the protobuf JSON mapping, or nil for a nil object.
+func jsonFields(object interface{}) (map[string]json.RawMessage, error) {
+	if object == nil {
+		return nil, nil
+	}
+	message, ok := object.(proto.Message)
+	if !ok {
+		return nil, senecaerror.NewDevError(fmt.Errorf("object of type %T is not a proto.Message", object))
+	}
+	s, err := (&jsonpb.Marshaler{OrigName: true}).MarshalToString(message)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling %T to JSON - err: %w", object, err)
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(s), &fields); err != nil {
+		return nil, fmt.Errorf("error unmarshalling JSON of %T - err: %w", object, err)
+	}
+	return fields, nil
+}
+
+func marshalFields(fields map[string]json.RawMessage) (string, error) {
+	if fields == nil {
+		return "", nil
+	}
+	// Maps are marshalled with sorted keys, so records are deterministic.
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,82 @@
+package audit
+
+import (
+	"errors"
+	"seneca/api/constants"
+	"seneca/api/senecaerror"
+	st "seneca/api/type"
+	"seneca/internal/client/database"
+	"testing"
+	"time"
+)
+
+func TestListRecords(t *testing.T) {
+	fakeSQL := database.NewFake()
+	sql := NewSQL(fakeSQL, "")
+	start := time.Date(2021, time.May, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		sql.now = func() time.Time { return start.Add(time.Hour * time.Duration(i)) }
+		for _, userID := range []string{"1", "2"} {
+			if _, err := sql.Create(constants.TripTable, &st.TripInternal{UserId: userID}); err != nil {
+				t.Fatalf("Create() returns err: %v", err)
+			}
+		}
+	}
+
+	// Hours [2, 8) in pages of 4.
+	cursor := ""
+	got := []*database.AuditRecord{}
+	for page := 0; ; page++ {
+		records, nextCursor, err := ListRecords(fakeSQL, "1", start.Add(time.Hour*2), start.Add(time.Hour*8), cursor, 4)
+		if err != nil {
+			t.Fatalf("ListRecords() returns err: %v", err)
+		}
+		got = append(got, records...)
+		if nextCursor == "" {
+			break
+		}
+		if page > 2 {
+			t.Fatalf("Too many pages")
+		}
+		cursor = nextCursor
+	}
+	if len(got) != 6 {
+		t.Fatalf("Want 6 records, got %d", len(got))
+	}
+	for i, record := range got {
+		if record.UserId != "1" || record.TimestampMs != start.Add(time.Hour*time.Duration(i+2)).UnixNano()/int64(time.Millisecond) {
+			t.Fatalf("Want the records of user 1 in order, got %v at %d", record, i)
+		}
+	}
+
+	var ue *senecaerror.UserError
+	if _, _, err := ListRecords(fakeSQL, "1", start, start, "", MaxListLimit+1); !errors.As(err, &ue) {
+		t.Fatalf("Want UserError for a limit over %d, got %v", MaxListLimit, err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	for _, tc := range []struct {
+		desc       string
+		before     interface{}
+		after      interface{}
+		wantBefore string
+		wantAfter  string
+	}{
+		{"create", nil, &st.User{Id: "1", Email: "a@seneca.ai"}, "", `{"email":"a@seneca.ai","id":"1"}`},
+		{"update", &st.User{Id: "1", Email: "a@seneca.ai"}, &st.User{Id: "1", Email: "b@seneca.ai"}, `{"email":"a@seneca.ai"}`, `{"email":"b@seneca.ai"}`},
+		{"cleared field", &st.User{Id: "1", Email: "a@seneca.ai"}, &st.User{Id: "1"}, `{"email":"a@seneca.ai"}`, "{}"},
+		{"unchanged", &st.User{Id: "1"}, &st.User{Id: "1"}, "{}", "{}"},
+		{"delete", &st.User{Id: "1"}, nil, `{"id":"1"}`, ""},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			gotBefore, gotAfter, err := diff(tc.before, tc.after)
+			if err != nil {
+				t.Fatalf("diff() returns err: %v", err)
+			}
+			if gotBefore != tc.wantBefore || gotAfter != tc.wantAfter {
+				t.Fatalf("Want diff() = %s, %s, got %s, %s", tc.wantBefore, tc.wantAfter, gotBefore, gotAfter)
+			}
+		})
+	}
+}
@@ -0,0 +1,338 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"seneca/api/constants"
+	"seneca/api/senecaerror"
+	"seneca/internal/client/database"
+	"seneca/internal/util"
+	"strings"
+	"time"
+)
+
+// maxObjectsPerTransaction is how many objects the multi writes change per transaction when they aren't called in
+// one.  Each change is committed with its audit record, so this keeps both within Datastore's 500 entities per commit.
+const maxObjectsPerTransaction = 250
+
+// 	SQLService is a database.SQLInterface that records every change to the constants.DataTableNames, and refuses
+// 	to update or delete audit records.  Changes to other tables, e.g. constants.TombstonesTable, aren't recorded.
+type SQLService struct {
+	sql database.SQLInterface
+	// actor is who changes are attributed to, or "" to attribute them to the user who owns the object.
+	actor string
+	// inTransaction is whether sql is a transaction.
+	inTransaction bool
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+//	NewSQL wraps sqlInterface so that its changes are recorded.
+//	Params:
+//		sqlInterface database.SQLInterface
+//		actor string: who changes are attributed to, e.g. AlgoActor("00001"), or "" to attribute them to the user who owns the changed object
+//	Returns:
+//		*SQLService
+func NewSQL(sqlInterface database.SQLInterface, actor string) *SQLService {
+	return &SQLService{
+		sql:   sqlInterface,
+		actor: actor,
+		now:   time.Now,
+	}
+}
+
+//	WithActor returns an SQLService on the same database whose changes are attributed to actor.
+func (s *SQLService) WithActor(actor string) *SQLService {
+	return &SQLService{
+		sql:           s.sql,
+		actor:         actor,
+		inTransaction: s.inTransaction,
+		now:           s.now,
+	}
+}
+
+func (s *SQLService) ListIDs(tableName constants.TableName, queryParams []*database.QueryParam) ([]string, error) {
+	return s.sql.ListIDs(tableName, queryParams)
+}
+
+func (s *SQLService) ListIDsByQuery(query *database.Query) ([]string, string, error) {
+	return s.sql.ListIDsByQuery(query)
+}
+
+func (s *SQLService) GetByID(tableName constants.TableName, id string) (interface{}, error) {
+	return s.sql.GetByID(tableName, id)
+}
+
+func (s *SQLService) GetByIDs(tableName constants.TableName, ids []string) ([]interface{}, error) {
+	return s.sql.GetByIDs(tableName, ids)
+}
+
+func (s *SQLService) Create(tableName constants.TableName, object interface{}) (string, error) {
+	if !isAudited(tableName) {
+		return s.sql.Create(tableName, object)
+	}
+
+	var id string
+	err := s.RunInTransaction(context.TODO(), func(tx database.SQLInterface) error {
+		txService := tx.(*SQLService)
+		var err error
+		id, err = txService.sql.Create(tableName, object)
+		if err != nil {
+			return err
+		}
+		return txService.record(database.CreateAction, tableName, id, nil, object)
+	})
+	return id, err
+}
+
+func (s *SQLService) Insert(tableName constants.TableName, id string, object interface{}) error {
+	if err := checkNotAuditTable(tableName); err != nil {
+		return err
+	}
+	if !isAudited(tableName) {
+		return s.sql.Insert(tableName, id, object)
+	}
+
+	return s.RunInTransaction(context.TODO(), func(tx database.SQLInterface) error {
+		txService := tx.(*SQLService)
+		before, err := txService.sql.GetByID(tableName, id)
+		if err != nil && !isNotFound(err) {
+			return fmt.Errorf("error getting object %q from table %q: %w", id, tableName, err)
+		}
+		if err := txService.sql.Insert(tableName, id, object); err != nil {
+			return err
+		}
+		return txService.record(database.UpdateAction, tableName, id, before, object)
+	})
+}
+
+func (s *SQLService) Put(tableName constants.TableName, id string, object interface{}) error {
+	if err := checkNotAuditTable(tableName); err != nil {
+		return err
+	}
+	if !isAudited(tableName) {
+		return s.sql.Put(tableName, id, object)
+	}
+
+	return s.RunInTransaction(context.TODO(), func(tx database.SQLInterface) error {
+		txService := tx.(*SQLService)
+		before, err := txService.sql.GetByID(tableName, id)
+		if err != nil && !isNotFound(err) {
+			return fmt.Errorf("error getting object %q from table %q: %w", id, tableName, err)
+		}
+		if err := txService.sql.Put(tableName, id, object); err != nil {
+			return err
+		}
+		if before == nil {
+			return txService.record(database.CreateAction, tableName, id, nil, object)
+		}
+		return txService.record(database.UpdateAction, tableName, id, before, object)
+	})
+}
+
+func (s *SQLService) DeleteByID(tableName constants.TableName, id string) error {
+	if err := checkNotAuditTable(tableName); err != nil {
+		return err
+	}
+	if !isAudited(tableName) {
+		return s.sql.DeleteByID(tableName, id)
+	}
+
+	return s.RunInTransaction(context.TODO(), func(tx database.SQLInterface) error {
+		txService := tx.(*SQLService)
+		before, err := txService.sql.GetByID(tableName, id)
+		if err != nil && !isNotFound(err) {
+			return fmt.Errorf("error getting object %q from table %q: %w", id, tableName, err)
+		}
+		if err := txService.sql.DeleteByID(tableName, id); err != nil {
+			return err
+		}
+		// Nothing changed if the object didn't exist.
+		if before == nil {
+			return nil
+		}
+		return txService.record(database.DeleteAction, tableName, id, before, nil)
+	})
+}
+
+func (s *SQLService) CreateMulti(tableName constants.TableName, objects []interface{}) ([]string, error) {
+	if !isAudited(tableName) {
+		return s.sql.CreateMulti(tableName, objects)
+	}
+
+	// IDs are set by index since a batch's transaction may be retried.
+	ids := make([]string, len(objects))
+	err := s.inBatches(len(objects), func(tx *SQLService, start, end int) error {
+		batchIDs, err := tx.sql.CreateMulti(tableName, objects[start:end])
+		if err != nil {
+			return err
+		}
+		for i, id := range batchIDs {
+			ids[start+i] = id
+			if err := tx.record(database.CreateAction, tableName, id, nil, objects[start+i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (s *SQLService) InsertMulti(tableName constants.TableName, ids []string, objects []interface{}) error {
+	if err := checkNotAuditTable(tableName); err != nil {
+		return err
+	}
+	if !isAudited(tableName) {
+		return s.sql.InsertMulti(tableName, ids, objects)
+	}
+	if len(ids) != len(objects) {
+		return senecaerror.NewDevError(fmt.Errorf("got %d ids for %d objects", len(ids), len(objects)))
+	}
+
+	return s.inBatches(len(ids), func(tx *SQLService, start, end int) error {
+		befores, err := database.GetExisting(tx.sql, tableName, ids[start:end])
+		if err != nil {
+			return err
+		}
+		if err := tx.sql.InsertMulti(tableName, ids[start:end], objects[start:end]); err != nil {
+			return err
+		}
+		for i, id := range ids[start:end] {
+			if err := tx.record(database.UpdateAction, tableName, id, befores[i], objects[start+i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *SQLService) DeleteMulti(tableName constants.TableName, ids []string) error {
+	if err := checkNotAuditTable(tableName); err != nil {
+		return err
+	}
+	if !isAudited(tableName) {
+		return s.sql.DeleteMulti(tableName, ids)
+	}
+
+	return s.inBatches(len(ids), func(tx *SQLService, start, end int) error {
+		befores, err := database.GetExisting(tx.sql, tableName, ids[start:end])
+		if err != nil {
+			return err
+		}
+		if err := tx.sql.DeleteMulti(tableName, ids[start:end]); err != nil {
+			return err
+		}
+		for i, id := range ids[start:end] {
+			if befores[i] == nil {
+				continue
+			}
+			if err := tx.record(database.DeleteAction, tableName, id, befores[i], nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RunInTransaction calls f with an SQLService on the transaction, so that changes and their records are committed together.
+func (s *SQLService) RunInTransaction(ctx context.Context, f func(tx database.SQLInterface) error) error {
+	return s.sql.RunInTransaction(ctx, func(tx database.SQLInterface) error {
+		return f(&SQLService{
+			sql:           tx,
+			actor:         s.actor,
+			inTransaction: true,
+			now:           s.now,
+		})
+	})
+}
+
+// inBatches calls f with the whole range [0, n) in the current transaction, or outside of one with ranges of at most
+// maxObjectsPerTransaction, each in its own transaction.  So multi writes outside of a transaction are only all or
+// nothing per batch, like the backends' own.
+func (s *SQLService) inBatches(n int, f func(tx *SQLService, start, end int) error) error {
+	if s.inTransaction {
+		return f(s, 0, n)
+	}
+
+	for start := 0; start < n; start += maxObjectsPerTransaction {
+		end := start + maxObjectsPerTransaction
+		if end > n {
+			end = n
+		}
+		if err := s.RunInTransaction(context.TODO(), func(tx database.SQLInterface) error {
+			return f(tx.(*SQLService), start, end)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// record appends the audit record of a change, before is nil for created objects and after is nil for deleted objects.
+func (s *SQLService) record(action string, tableName constants.TableName, id string, before, after interface{}) error {
+	beforeJSON, afterJSON, err := diff(before, after)
+	if err != nil {
+		return fmt.Errorf("error diffing object %q in table %q: %w", id, tableName, err)
+	}
+
+	userID := database.ObjectUserID(tableName, id, after)
+	if userID == "" {
+		userID = database.ObjectUserID(tableName, id, before)
+	}
+	actor := s.actor
+	if actor == "" {
+		actor = UserActor(userID)
+	} else if strings.HasPrefix(actor, algoActorPrefix) {
+		// Events and driving conditions are attributed to the algorithm that found them.
+		if algoTag := algoTagOf(after, before); algoTag != "" {
+			actor = AlgoActor(algoTag)
+		}
+	}
+
+	_, err = database.CreateAuditRecord(s.sql, &database.AuditRecord{
+		TimestampMs: util.TimeToMilliseconds(s.now()),
+		Actor:       actor,
+		Action:      action,
+		TableName:   tableName.String(),
+		ObjectId:    id,
+		UserId:      userID,
+		Before:      beforeJSON,
+		After:       afterJSON,
+	})
+	return err
+}
+
+// algoTagOf returns the AlgoTag of the first of the objects that has one, or "".
+func algoTagOf(objects ...interface{}) string {
+	for _, object := range objects {
+		if algoTagged, ok := object.(interface{ GetAlgoTag() string }); ok && algoTagged.GetAlgoTag() != "" {
+			return algoTagged.GetAlgoTag()
+		}
+	}
+	return ""
+}
+
+func isAudited(tableName constants.TableName) bool {
+	for _, dataTableName := range constants.DataTableNames {
+		if tableName == dataTableName {
+			return true
+		}
+	}
+	return false
+}
+
+func checkNotAuditTable(tableName constants.TableName) error {
+	if tableName == constants.AuditTable {
+		return senecaerror.NewDevError(fmt.Errorf("table %q is append-only", tableName))
+	}
+	return nil
+}
+
+func isNotFound(err error) bool {
+	var nfe *senecaerror.NotFoundError
+	return errors.As(err, &nfe)
+}
@@ -0,0 +1,209 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"seneca/api/constants"
+	"seneca/api/senecaerror"
+	st "seneca/api/type"
+	"seneca/internal/client/database"
+	"seneca/internal/client/logging"
+	"seneca/internal/dao/sqldaoset"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSQLServiceRecordsChanges(t *testing.T) {
+	fakeSQL := database.NewFake()
+	userSQL := NewSQL(fakeSQL, "")
+	logger := logging.NewLocalLogger(true)
+	userDAOs := sqldaoset.New(userSQL, logger, time.Second)
+	algoDAOs := sqldaoset.New(userSQL.WithActor(AlgoActor("00001", "00002")), logger, time.Second)
+
+	rawVideo, err := userDAOs.RawVideoDAO.InsertUniqueRawVideo(&st.RawVideo{UserId: "1", CreateTimeMs: 10})
+	if err != nil {
+		t.Fatalf("InsertUniqueRawVideo() returns err: %v", err)
+	}
+	event, err := algoDAOs.EventDAO.CreateEvent(context.Background(), &st.EventInternal{UserId: "1", TimestampMs: 10, AlgoTag: "00001"})
+	if err != nil {
+		t.Fatalf("CreateEvent() returns err: %v", err)
+	}
+	if err := userDAOs.EventDAO.DeleteEventByID(context.Background(), "1", event.TripId, event.Id); err != nil {
+		t.Fatalf("DeleteEventByID() returns err: %v", err)
+	}
+
+	records, _, err := ListRecords(fakeSQL, "1", time.Unix(0, 0), time.Now().Add(time.Minute), "", MaxListLimit)
+	if err != nil {
+		t.Fatalf("ListRecords() returns err: %v", err)
+	}
+	byObject := map[string][]*database.AuditRecord{}
+	for _, record := range records {
+		if record.Id == "" || record.UserId != "1" || record.TimestampMs == 0 {
+			t.Fatalf("Want records of user 1 with IDs and timestamps, got %v", record)
+		}
+		byObject[record.TableName+"/"+record.ObjectId] = append(byObject[record.TableName+"/"+record.ObjectId], record)
+	}
+
+	// InsertUniqueRawVideo creates the video and then sets its ID.
+	videoRecords := byObject[constants.RawVideosTable.String()+"/"+rawVideo.Id]
+	if len(videoRecords) != 2 {
+		t.Fatalf("Want 2 records of the raw video, got %v", videoRecords)
+	}
+	if got := videoRecords[0]; got.Action != database.CreateAction || got.Actor != UserActor("1") || got.Before != "" || got.After != `{"create_time_ms":"10","user_id":"1"}` {
+		t.Fatalf("Want a create record by user 1, got %v", got)
+	}
+	if got := videoRecords[1]; got.Action != database.UpdateAction || got.Actor != UserActor("1") {
+		t.Fatalf("Want an update record by user 1, got %v", got)
+	}
+
+	// The event is created and then deleted into a tombstone, which isn't recorded itself.
+	eventRecords := byObject[constants.EventTable.String()+"/"+event.Id]
+	if len(eventRecords) != 3 {
+		t.Fatalf("Want 3 records of the event, got %v", eventRecords)
+	}
+	if got := eventRecords[0]; got.Action != database.CreateAction || got.Actor != AlgoActor("00001") {
+		t.Fatalf("Want a create record by the algorithm that found the event, got %v", got)
+	}
+	if got := eventRecords[2]; got.Action != database.DeleteAction || got.Actor != UserActor("1") || got.After != "" || got.Before == "" {
+		t.Fatalf("Want a delete record by user 1, got %v", got)
+	}
+	for key := range byObject {
+		if strings.HasPrefix(key, constants.TombstonesTable.String()) {
+			t.Fatalf("Want no records of tombstones, got %v", byObject[key])
+		}
+	}
+}
+
+func TestSQLServiceRecordsUpdateDiffs(t *testing.T) {
+	fakeSQL := database.NewFake()
+	sql := NewSQL(fakeSQL, APIKeyActor("key"))
+
+	id, err := sql.Create(constants.UsersTable, &st.User{Email: "a@seneca.ai"})
+	if err != nil {
+		t.Fatalf("Create() returns err: %v", err)
+	}
+	if err := sql.Insert(constants.UsersTable, id, &st.User{Id: id, Email: "b@seneca.ai"}); err != nil {
+		t.Fatalf("Insert() returns err: %v", err)
+	}
+
+	records, _, err := ListRecords(fakeSQL, id, time.Unix(0, 0), time.Now().Add(time.Minute), "", MaxListLimit)
+	if err != nil {
+		t.Fatalf("ListRecords() returns err: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Want 2 records, got %v", records)
+	}
+	if got := records[1]; got.Action != database.UpdateAction || got.Actor != APIKeyActor("key") || got.Before != `{"email":"a@seneca.ai"}` || got.After != `{"email":"b@seneca.ai","id":"`+id+`"}` {
+		t.Fatalf("Want an update record of the changed fields, got %v", got)
+	}
+	if actor := APIKeyActor("secret"); strings.Contains(actor, "secret") {
+		t.Fatalf("Want the API key hidden in its actor, got %q", actor)
+	}
+}
+
+func TestSQLServiceTransactions(t *testing.T) {
+	fakeSQL := database.NewFake()
+	sql := NewSQL(fakeSQL, SystemActor("test"))
+
+	wantErr := errors.New("rolled back")
+	if err := sql.RunInTransaction(context.Background(), func(tx database.SQLInterface) error {
+		if _, err := tx.Create(constants.EventTable, &st.EventInternal{UserId: "1"}); err != nil {
+			return err
+		}
+		return wantErr
+	}); err != wantErr {
+		t.Fatalf("Want %v from RunInTransaction(), got %v", wantErr, err)
+	}
+	if ids, _, _ := fakeSQL.ListIDsByQuery(database.NewQuery(constants.AuditTable)); len(ids) != 0 {
+		t.Fatalf("Want no records of rolled back changes, got %d", len(ids))
+	}
+
+	ids, err := sql.CreateMulti(constants.EventTable, []interface{}{&st.EventInternal{UserId: "1"}, &st.EventInternal{UserId: "2"}})
+	if err != nil {
+		t.Fatalf("CreateMulti() returns err: %v", err)
+	}
+	if err := sql.DeleteMulti(constants.EventTable, ids); err != nil {
+		t.Fatalf("DeleteMulti() returns err: %v", err)
+	}
+	for _, userID := range []string{"1", "2"} {
+		records, _, err := ListRecords(fakeSQL, userID, time.Unix(0, 0), time.Now().Add(time.Minute), "", MaxListLimit)
+		if err != nil {
+			t.Fatalf("ListRecords() returns err: %v", err)
+		}
+		if len(records) != 2 || records[0].Action != database.CreateAction || records[1].Action != database.DeleteAction || records[0].Actor != SystemActor("test") {
+			t.Fatalf("Want a create and a delete record of user %q, got %v", userID, records)
+		}
+	}
+}
+
+// countingTransactionsSQL counts the transactions run on it.
+type countingTransactionsSQL struct {
+	*database.FakeSQLDBService
+	transactions int
+}
+
+func (c *countingTransactionsSQL) RunInTransaction(ctx context.Context, f func(tx database.SQLInterface) error) error {
+	c.transactions++
+	return c.FakeSQLDBService.RunInTransaction(ctx, f)
+}
+
+func TestSQLServiceBatchesMultiWrites(t *testing.T) {
+	countingSQL := &countingTransactionsSQL{FakeSQLDBService: database.NewFake()}
+	sql := NewSQL(countingSQL, SystemActor("test"))
+
+	objects := []interface{}{}
+	for i := 0; i < maxObjectsPerTransaction*2+1; i++ {
+		objects = append(objects, &st.EventInternal{UserId: "1"})
+	}
+	ids, err := sql.CreateMulti(constants.EventTable, objects)
+	if err != nil {
+		t.Fatalf("CreateMulti() returns err: %v", err)
+	}
+	if len(ids) != len(objects) || ids[0] == "" || ids[len(ids)-1] == "" {
+		t.Fatalf("Want %d IDs, got %v", len(objects), ids)
+	}
+	if countingSQL.transactions != 3 {
+		t.Fatalf("Want the %d objects created in 3 transactions, got %d", len(objects), countingSQL.transactions)
+	}
+
+	// Within a transaction, everything is written in it.
+	countingSQL.transactions = 0
+	if err := sql.RunInTransaction(context.Background(), func(tx database.SQLInterface) error {
+		return tx.DeleteMulti(constants.EventTable, ids)
+	}); err != nil {
+		t.Fatalf("DeleteMulti() returns err: %v", err)
+	}
+	if countingSQL.transactions != 1 {
+		t.Fatalf("Want the %d objects deleted in 1 transaction, got %d", len(objects), countingSQL.transactions)
+	}
+	if recordIDs, _, err := countingSQL.ListIDsByQuery(database.NewQuery(constants.AuditTable)); err != nil || len(recordIDs) != len(objects)*2 {
+		t.Fatalf("Want a create and a delete record of each object, got %d records, %v", len(recordIDs), err)
+	}
+}
+
+func TestSQLServiceAuditTableIsAppendOnly(t *testing.T) {
+	fakeSQL := database.NewFake()
+	sql := NewSQL(fakeSQL, "")
+	id, err := database.CreateAuditRecord(sql, &database.AuditRecord{UserId: "1"})
+	if err != nil {
+		t.Fatalf("CreateAuditRecord() returns err: %v", err)
+	}
+
+	var de *senecaerror.DevError
+	if err := sql.Insert(constants.AuditTable, id, &database.AuditRecord{}); !errors.As(err, &de) {
+		t.Fatalf("Want DevError from Insert(), got %v", err)
+	}
+	if err := sql.InsertMulti(constants.AuditTable, []string{id}, []interface{}{&database.AuditRecord{}}); !errors.As(err, &de) {
+		t.Fatalf("Want DevError from InsertMulti(), got %v", err)
+	}
+	if err := sql.DeleteByID(constants.AuditTable, id); !errors.As(err, &de) {
+		t.Fatalf("Want DevError from DeleteByID(), got %v", err)
+	}
+	if err := sql.DeleteMulti(constants.AuditTable, []string{id}); !errors.As(err, &de) {
+		t.Fatalf("Want DevError from DeleteMulti(), got %v", err)
+	}
+	if object, err := fakeSQL.GetByID(constants.AuditTable, id); err != nil || object == nil {
+		t.Fatalf("Want the record kept, got %v, %v", object, err)
+	}
+}
@@ -0,0 +1,473 @@
+// Package aws implements cloud interfaces with S3 compatible services like AWS S3 and MinIO.
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"seneca/api/senecaerror"
+	"seneca/internal/client/cloud"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+const (
+	// 	DefaultPartSize is the size of the parts large files are uploaded in.  Files smaller than
+	// 	a part are uploaded with a single request.
+	DefaultPartSize = s3manager.MinUploadPartSize * 2
+	// 	defaultRegion is used when S3Config.Region is empty, MinIO ignores it.
+	defaultRegion = "us-east-1"
+)
+
+// errUploadAborted fails the body of aborted uploads.
+var errUploadAborted = errors.New("upload aborted")
+
+// 	S3Config configures the S3StorageClient.
+type S3Config struct {
+	// Endpoint overrides the AWS endpoint, e.g. http://localhost:9000 for MinIO.
+	Endpoint string
+	Region   string
+	// AccessKeyID and SecretAccessKey are used when set, otherwise the default AWS credential chain is.
+	AccessKeyID     string
+	SecretAccessKey string
+	// ForcePathStyle addresses buckets as endpoint/bucket instead of bucket.endpoint, which MinIO requires.
+	ForcePathStyle bool
+	// PartSize is the multipart upload part size, DefaultPartSize is used when zero.
+	PartSize int64
+}
+
+// 	S3StorageClient implements SimpleStorageInterface with S3 compatible object storage.
+type S3StorageClient struct {
+	client       *s3.S3
+	uploader     *s3manager.Uploader
+	projectID    string
+	quickTimeOut time.Duration
+	longTimeOut  time.Duration
+}
+
+// 	NewS3StorageClient initializes a new S3 client with the given parameters.
+// 	Params:
+// 		config *S3Config
+// 		projectID string: prefixed onto bucket names, like with GCS
+// 		quickTimeOut time.Duration: the time out used for operations that should be quick, like reading metadata or creating a bucket.
+// 		longTimeOut time.Duration: the time out used for operations that may take some time, like uploading a file.
+// 	Returns:
+//		*S3StorageClient
+// 		senecaerror.CloudError
+func NewS3StorageClient(config *S3Config, projectID string, quickTimeOut, longTimeOut time.Duration) (*S3StorageClient, error) {
+	awsConfig := aws.NewConfig().WithRegion(defaultRegion).WithS3ForcePathStyle(config.ForcePathStyle)
+	if config.Region != "" {
+		awsConfig = awsConfig.WithRegion(config.Region)
+	}
+	if config.Endpoint != "" {
+		awsConfig = awsConfig.WithEndpoint(config.Endpoint)
+	}
+	if config.AccessKeyID != "" {
+		awsConfig = awsConfig.WithCredentials(credentials.NewStaticCredentials(config.AccessKeyID, config.SecretAccessKey, ""))
+	}
+
+	sess, err := session.NewSession(awsConfig)
+	if err != nil {
+		return nil, senecaerror.NewCloudError(fmt.Errorf("error initializing NewS3StorageClient - err: %v", err))
+	}
+
+	partSize := config.PartSize
+	if partSize == 0 {
+		partSize = DefaultPartSize
+	}
+	if partSize < s3manager.MinUploadPartSize {
+		return nil, senecaerror.NewDevError(fmt.Errorf("part size %d is less than the minimum %d", partSize, s3manager.MinUploadPartSize))
+	}
+
+	client := s3.New(sess)
+	return &S3StorageClient{
+		client: client,
+		uploader: s3manager.NewUploaderWithClient(client, func(u *s3manager.Uploader) {
+			u.PartSize = partSize
+		}),
+		projectID:    projectID,
+		quickTimeOut: quickTimeOut,
+		longTimeOut:  longTimeOut,
+	}, nil
+}
+
+// 	CreateBucket creates a bucket with the given name.
+//	Params:
+//		bucketName cloud.BucketName
+//	Returns:
+//		senecaerror.CloudError
+func (s3sc *S3StorageClient) CreateBucket(bucketName cloud.BucketName) error {
+	ctx, cancel := context.WithTimeout(context.TODO(), s3sc.quickTimeOut)
+	defer cancel()
+
+	input := &s3.CreateBucketInput{
+		Bucket: aws.String(s3sc.realName(bucketName)),
+	}
+	// us-east-1 is the default location and is rejected if given explicitly.
+	if region := aws.StringValue(s3sc.client.Config.Region); region != defaultRegion {
+		input.CreateBucketConfiguration = &s3.CreateBucketConfiguration{
+			LocationConstraint: aws.String(region),
+		}
+	}
+
+	if _, err := s3sc.client.CreateBucketWithContext(ctx, input); err != nil {
+		return senecaerror.NewCloudError(fmt.Errorf("error creating bucket %q - err: %w", bucketName, err))
+	}
+	return nil
+}
+
+// 	BucketExists checks if a bucket with the given name already exists.
+//	Params:
+//		bucketName cloud.BucketName
+//	Returns:
+//		bool
+//		senecaerror.CloudError
+func (s3sc *S3StorageClient) BucketExists(bucketName cloud.BucketName) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), s3sc.quickTimeOut)
+	defer cancel()
+
+	if _, err := s3sc.client.HeadBucketWithContext(ctx, &s3.HeadBucketInput{Bucket: aws.String(s3sc.realName(bucketName))}); err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, senecaerror.NewCloudError(fmt.Errorf("error checking bucket %q - err: %w", bucketName, err))
+	}
+	return true, nil
+}
+
+// 	BucketFileExists checks if a file with the given name exists in the given bucket.
+// 	This is done by reading the metadata of the file.
+//	Params:
+//		bucketName cloud.BucketName
+//		bucketFileName string
+//	Returns:
+//		bool
+//		senecaerror.CloudError, senecaerror.BadStateError
+func (s3sc *S3StorageClient) BucketFileExists(bucketName cloud.BucketName, bucketFileName string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), s3sc.quickTimeOut)
+	defer cancel()
+
+	if _, err := s3sc.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s3sc.realName(bucketName)),
+		Key:    aws.String(bucketFileName),
+	}); err != nil {
+		if !isNotFound(err) {
+			return false, senecaerror.NewCloudError(fmt.Errorf("error checking file %q in bucket %q - err: %w", bucketFileName, bucketName, err))
+		}
+		// HEAD responses have no body, so a missing bucket looks like a missing file.
+		if bucketExists, bucketErr := s3sc.BucketExists(bucketName); bucketErr == nil && !bucketExists {
+			return false, senecaerror.NewBadStateError(fmt.Errorf("bucket %q does not exist - err: %w", bucketName, err))
+		}
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// 	WriteBucketFile writes the given local file to the given bucket with the bucketFileName.
+// 	Files larger than the part size are uploaded in parts.
+//	Params:
+//		bucketName cloud.BucketName
+//		localFileNameAndPath string
+//		bucketFileName string
+//	Returns:
+//		senecaerror.BadStateError, senecaerror.CloudError
+func (s3sc *S3StorageClient) WriteBucketFile(bucketName cloud.BucketName, localFileNameAndPath, bucketFileName string) error {
+	defer os.Remove(localFileNameAndPath)
+
+	if localFileNameAndPath == "" {
+		return senecaerror.NewBadStateError(fmt.Errorf("received empty localFileName"))
+	}
+
+	if bucketFileName == "" {
+		return senecaerror.NewBadStateError(fmt.Errorf("received empty bucketFileName"))
+	}
+
+	f, err := os.Open(localFileNameAndPath)
+	if err != nil {
+		return senecaerror.NewBadStateError(fmt.Errorf("error opening local file %q - err: %v", localFileNameAndPath, err))
+	}
+	defer f.Close()
+
+	ctx, cancel := context.WithTimeout(context.TODO(), s3sc.longTimeOut)
+	defer cancel()
+	if _, err := s3sc.uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket: aws.String(s3sc.realName(bucketName)),
+		Key:    aws.String(bucketFileName),
+		Body:   f,
+	}); err != nil {
+		if hasCode(err, s3.ErrCodeNoSuchBucket) {
+			return senecaerror.NewBadStateError(fmt.Errorf("bucket %q does not exist - err: %w", bucketName, err))
+		}
+		return senecaerror.NewCloudError(fmt.Errorf("error uploading file %q to bucket %q - err: %w", bucketFileName, bucketName, err))
+	}
+
+	return nil
+}
+
+// 	GetBucketFile downloads the file with the given bucketFileName, stores it in a temp file, and returns that file's path.
+//	Params:
+//		bucketName cloud.BucketName
+//		bucketFileName string
+//	Returns:
+//		string: the name of the temporary file downloaded
+//		error, senecaerror.CloudError, senecaerror.BadStateError, senecaerror.NotFoundError
+func (s3sc *S3StorageClient) GetBucketFile(bucketName cloud.BucketName, bucketFileName string) (string, error) {
+	rc, err := s3sc.NewBucketFileReader(bucketName, bucketFileName)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	tempFile, err := ioutil.TempFile("", tempFilePattern(bucketFileName))
+	if err != nil {
+		return "", fmt.Errorf("error creating temp file for file %q in bucket %q - err: %w", bucketFileName, bucketName, err)
+	}
+	defer tempFile.Close()
+
+	if _, err := io.Copy(tempFile, rc); err != nil {
+		os.Remove(tempFile.Name())
+		return "", fmt.Errorf("error writing bytes to temp file for file %q in bucket %q - err: %w", bucketFileName, bucketName, err)
+	}
+
+	return tempFile.Name(), nil
+}
+
+// 	DeleteBucketFile deletes the bucket file from remote storage.
+// 	S3 deletes succeed for missing files, so existence is checked first.
+//	Params:
+//		bucketName cloud.BucketName
+//		bucketFileName string
+//	Returns:
+//		senecaerror.CloudError, senecaerror.BadStateError, senecaerror.NotFoundError
+func (s3sc *S3StorageClient) DeleteBucketFile(bucketName cloud.BucketName, bucketFileName string) error {
+	exists, err := s3sc.BucketFileExists(bucketName, bucketFileName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return senecaerror.NewNotFoundError(fmt.Errorf("bucketFile %q does not exist", bucketFileName))
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), s3sc.quickTimeOut)
+	defer cancel()
+	if _, err := s3sc.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s3sc.realName(bucketName)),
+		Key:    aws.String(bucketFileName),
+	}); err != nil {
+		return senecaerror.NewCloudError(fmt.Errorf("error deleting file %q in bucket %q: %w", bucketFileName, bucketName, err))
+	}
+	return nil
+}
+
+// 	NewBucketFileWriter opens a writer streaming to the file with the bucketFileName in the given bucket.
+// 	Data is uploaded in parts as it is written, and the upload is completed on Close.
+//	Params:
+//		bucketName cloud.BucketName
+//		bucketFileName string
+//	Returns:
+//		cloud.BucketFileWriter
+//		senecaerror.BadStateError
+func (s3sc *S3StorageClient) NewBucketFileWriter(bucketName cloud.BucketName, bucketFileName string) (cloud.BucketFileWriter, error) {
+	if bucketFileName == "" {
+		return nil, senecaerror.NewBadStateError(fmt.Errorf("received empty bucketFileName"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), s3sc.longTimeOut)
+	pr, pw := io.Pipe()
+	w := &uploadWriter{
+		pw:     pw,
+		cancel: cancel,
+		done:   make(chan error, 1),
+	}
+
+	go func() {
+		_, err := s3sc.uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+			Bucket: aws.String(s3sc.realName(bucketName)),
+			Key:    aws.String(bucketFileName),
+			Body:   pr,
+		})
+		if err != nil {
+			if hasCode(err, s3.ErrCodeNoSuchBucket) {
+				err = senecaerror.NewBadStateError(fmt.Errorf("bucket %q does not exist - err: %w", bucketName, err))
+			} else {
+				err = senecaerror.NewCloudError(fmt.Errorf("error uploading file %q to bucket %q - err: %w", bucketFileName, bucketName, err))
+			}
+		}
+		// Unblock any pending writes if the upload failed part way through.
+		pr.CloseWithError(err)
+		w.done <- err
+	}()
+
+	return w, nil
+}
+
+// 	NewBucketFileReader opens a reader streaming the file with the bucketFileName from the given bucket.
+//	Params:
+//		bucketName cloud.BucketName
+//		bucketFileName string
+//	Returns:
+//		io.ReadCloser
+//		senecaerror.CloudError, senecaerror.BadStateError, senecaerror.NotFoundError
+func (s3sc *S3StorageClient) NewBucketFileReader(bucketName cloud.BucketName, bucketFileName string) (io.ReadCloser, error) {
+	return s3sc.NewBucketFileRangeReader(bucketName, bucketFileName, 0, -1)
+}
+
+// 	NewBucketFileRangeReader opens a reader streaming length bytes of the file starting at offset.
+//	Params:
+//		bucketName cloud.BucketName
+//		bucketFileName string
+//		offset int64
+//		length int64: negative to read until the end of the file
+//	Returns:
+//		io.ReadCloser
+//		senecaerror.CloudError, senecaerror.BadStateError, senecaerror.NotFoundError
+func (s3sc *S3StorageClient) NewBucketFileRangeReader(bucketName cloud.BucketName, bucketFileName string, offset, length int64) (io.ReadCloser, error) {
+	if length == 0 {
+		// HTTP ranges can't be empty.
+		return ioutil.NopCloser(strings.NewReader("")), nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), s3sc.longTimeOut)
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s3sc.realName(bucketName)),
+		Key:    aws.String(bucketFileName),
+	}
+	if offset > 0 || length > 0 {
+		byteRange := fmt.Sprintf("bytes=%d-", offset)
+		if length > 0 {
+			byteRange = fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+		}
+		input.Range = aws.String(byteRange)
+	}
+
+	output, err := s3sc.client.GetObjectWithContext(ctx, input)
+	if err != nil {
+		cancel()
+		if hasCode(err, s3.ErrCodeNoSuchBucket) {
+			return nil, senecaerror.NewBadStateError(fmt.Errorf("bucket %q does not exist - err: %w", bucketName, err))
+		} else if isNotFound(err) {
+			return nil, senecaerror.NewNotFoundError(fmt.Errorf("bucketFile %q does not exist: %w", bucketFileName, err))
+		}
+		return nil, senecaerror.NewCloudError(fmt.Errorf("error reading from bucket %q for file %q - err: %w", bucketName, bucketFileName, err))
+	}
+
+	return &cancelOnCloseReader{
+		ReadCloser: output.Body,
+		cancel:     cancel,
+	}, nil
+}
+
+// uploadWriter feeds writes through a pipe into an upload running in the background.
+type uploadWriter struct {
+	pw     *io.PipeWriter
+	cancel context.CancelFunc
+	done   chan error
+}
+
+func (w *uploadWriter) Write(p []byte) (int, error) {
+	return w.pw.Write(p)
+}
+
+// Close ends the input and waits for the upload to complete.
+func (w *uploadWriter) Close() error {
+	defer w.cancel()
+	w.pw.Close()
+	return <-w.done
+}
+
+// Abort fails the input, so the uploader aborts the multipart upload instead of completing it, and waits for it to
+// stop.
+func (w *uploadWriter) Abort() {
+	defer w.cancel()
+	w.pw.CloseWithError(errUploadAborted)
+	<-w.done
+}
+
+// cancelOnCloseReader releases the context of the wrapped reader once it is closed.
+type cancelOnCloseReader struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (r *cancelOnCloseReader) Close() error {
+	defer r.cancel()
+	return r.ReadCloser.Close()
+}
+
+// 	SignedURL returns a presigned URL to GET the file.
+//	Params:
+//		bucketName cloud.BucketName
+//		bucketFileName string
+//		expiry time.Duration: at most cloud.MaxSignedURLExpiry
+//	Returns:
+//		string: the signed URL
+//		senecaerror.DevError, senecaerror.CloudError
+func (s3sc *S3StorageClient) SignedURL(bucketName cloud.BucketName, bucketFileName string, expiry time.Duration) (string, error) {
+	if expiry <= 0 || expiry > cloud.MaxSignedURLExpiry {
+		return "", senecaerror.NewDevError(fmt.Errorf("expiry %s must be in (0, %s]", expiry, cloud.MaxSignedURLExpiry))
+	}
+
+	req, _ := s3sc.client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(s3sc.realName(bucketName)),
+		Key:    aws.String(bucketFileName),
+	})
+	url, err := req.Presign(expiry)
+	if err != nil {
+		return "", senecaerror.NewCloudError(fmt.Errorf("error signing URL for file %q in bucket %q - err: %w", bucketFileName, bucketName, err))
+	}
+	return url, nil
+}
+
+// 	URLScheme returns cloud.S3URLScheme.
+func (s3sc *S3StorageClient) URLScheme() cloud.URLScheme {
+	return cloud.S3URLScheme
+}
+
+func (s3sc *S3StorageClient) realName(bucketName cloud.BucketName) string {
+	return bucketName.RealNameForScheme(cloud.S3URLScheme, s3sc.projectID)
+}
+
+// isNotFound checks for a 404, which is all that HEAD requests return for missing buckets and files.
+func isNotFound(err error) bool {
+	var requestFailure awserr.RequestFailure
+	if errors.As(err, &requestFailure) && requestFailure.StatusCode() == http.StatusNotFound {
+		return true
+	}
+	return hasCode(err, s3.ErrCodeNoSuchKey) || hasCode(err, s3.ErrCodeNoSuchBucket)
+}
+
+func hasCode(err error, code string) bool {
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		if awsErr.Code() == code {
+			return true
+		}
+		// s3manager wraps the errors of the underlying requests.
+		if origErr := awsErr.OrigErr(); origErr != nil && origErr != err {
+			return hasCode(origErr, code)
+		}
+	}
+	return false
+}
+
+// tempFilePattern keeps the extension of the file name, since tools like ffmpeg and exiftool rely on it.
+func tempFilePattern(bucketFileName string) string {
+	base := filepath.Base(bucketFileName)
+	ext := filepath.Ext(base)
+	return fmt.Sprintf("%s.*%s", strings.TrimSuffix(base, ext), ext)
+}
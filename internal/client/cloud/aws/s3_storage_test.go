@@ -0,0 +1,419 @@
+package aws
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"seneca/api/senecaerror"
+	"seneca/internal/client/cloud"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+const testProjectID = "project"
+
+// fakeS3Server is a MinIO-style stand-in implementing the subset of the path style S3 API the client uses.
+type fakeS3Server struct {
+	mu sync.Mutex
+	// key is bucket, value is files
+	buckets      map[string]map[string][]byte
+	uploads      map[string]map[int][]byte
+	nextUploadID int
+	partsPut     int
+}
+
+func newFakeS3Server() *fakeS3Server {
+	return &fakeS3Server{
+		buckets: map[string]map[string][]byte{},
+		uploads: map[string]map[int][]byte{},
+	}
+}
+
+func (f *fakeS3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	pathParts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	bucket := pathParts[0]
+	key := ""
+	if len(pathParts) == 2 {
+		key = pathParts[1]
+	}
+	query := r.URL.Query()
+	body, _ := ioutil.ReadAll(r.Body)
+
+	files, bucketExists := f.buckets[bucket]
+	if key == "" {
+		switch r.Method {
+		case http.MethodPut:
+			if bucketExists {
+				writeS3Error(w, r, http.StatusConflict, "BucketAlreadyOwnedByYou")
+				return
+			}
+			f.buckets[bucket] = map[string][]byte{}
+		case http.MethodHead:
+			if !bucketExists {
+				writeS3Error(w, r, http.StatusNotFound, "NoSuchBucket")
+				return
+			}
+		default:
+			writeS3Error(w, r, http.StatusNotImplemented, "NotImplemented")
+		}
+		return
+	}
+
+	if !bucketExists {
+		writeS3Error(w, r, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && hasQuery(query, "uploads"):
+		f.nextUploadID++
+		uploadID := strconv.Itoa(f.nextUploadID)
+		f.uploads[uploadID] = map[int][]byte{}
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>", bucket, key, uploadID)
+	case r.Method == http.MethodPut && hasQuery(query, "uploadId"):
+		parts, ok := f.uploads[query.Get("uploadId")]
+		if !ok {
+			writeS3Error(w, r, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		partNumber, _ := strconv.Atoi(query.Get("partNumber"))
+		parts[partNumber] = body
+		f.partsPut++
+		w.Header().Set("ETag", fmt.Sprintf("\"part-%d\"", partNumber))
+	case r.Method == http.MethodPost && hasQuery(query, "uploadId"):
+		parts, ok := f.uploads[query.Get("uploadId")]
+		if !ok {
+			writeS3Error(w, r, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		partNumbers := []int{}
+		for partNumber := range parts {
+			partNumbers = append(partNumbers, partNumber)
+		}
+		sort.Ints(partNumbers)
+		var data bytes.Buffer
+		for _, partNumber := range partNumbers {
+			data.Write(parts[partNumber])
+		}
+		files[key] = data.Bytes()
+		delete(f.uploads, query.Get("uploadId"))
+		fmt.Fprintf(w, "<CompleteMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><ETag>\"etag\"</ETag></CompleteMultipartUploadResult>", bucket, key)
+	case r.Method == http.MethodDelete && hasQuery(query, "uploadId"):
+		delete(f.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		files[key] = body
+		w.Header().Set("ETag", "\"etag\"")
+	case r.Method == http.MethodHead, r.Method == http.MethodGet:
+		data, ok := files[key]
+		if !ok {
+			writeS3Error(w, r, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		status := http.StatusOK
+		if byteRange := r.Header.Get("Range"); byteRange != "" && r.Method == http.MethodGet {
+			start, end := 0, len(data)-1
+			fmt.Sscanf(byteRange, "bytes=%d-%d", &start, &end)
+			if end >= len(data) {
+				end = len(data) - 1
+			}
+			data = data[start : end+1]
+			status = http.StatusPartialContent
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.WriteHeader(status)
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	case r.Method == http.MethodDelete:
+		delete(files, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeS3Error(w, r, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+func hasQuery(query url.Values, key string) bool {
+	_, ok := query[key]
+	return ok
+}
+
+func writeS3Error(w http.ResponseWriter, r *http.Request, status int, code string) {
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+	}
+}
+
+func newTestClient(t *testing.T, partSize int64) (*S3StorageClient, *fakeS3Server) {
+	fake := newFakeS3Server()
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	s3sc, err := NewS3StorageClient(&S3Config{
+		Endpoint:        server.URL,
+		AccessKeyID:     "access",
+		SecretAccessKey: "secret",
+		ForcePathStyle:  true,
+		PartSize:        partSize,
+	}, testProjectID, time.Second*10, time.Minute)
+	if err != nil {
+		t.Fatalf("NewS3StorageClient() returns err: %v", err)
+	}
+	return s3sc, fake
+}
+
+func writeLocalFile(t *testing.T, data []byte) string {
+	f, err := ioutil.TempFile(t.TempDir(), "local.*.mp4")
+	if err != nil {
+		t.Fatalf("TempFile() returns err: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		t.Fatalf("Write() returns err: %v", err)
+	}
+	return f.Name()
+}
+
+func TestBucketLifecycle(t *testing.T) {
+	s3sc, fake := newTestClient(t, 0)
+
+	exists, err := s3sc.BucketExists(cloud.RawVideoBucketName)
+	if err != nil {
+		t.Fatalf("BucketExists() returns err: %v", err)
+	}
+	if exists {
+		t.Fatalf("Want bucket to not exist before CreateBucket()")
+	}
+
+	var bse *senecaerror.BadStateError
+	if _, err := s3sc.BucketFileExists(cloud.RawVideoBucketName, "video.mp4"); !errors.As(err, &bse) {
+		t.Fatalf("Want BadStateError from BucketFileExists() for missing bucket, got %v", err)
+	}
+
+	if err := s3sc.CreateBucket(cloud.RawVideoBucketName); err != nil {
+		t.Fatalf("CreateBucket() returns err: %v", err)
+	}
+	if _, ok := fake.buckets["project-raw-videos"]; !ok {
+		t.Fatalf("Want bucket named %q, got %v", "project-raw-videos", fake.buckets)
+	}
+	if exists, err := s3sc.BucketExists(cloud.RawVideoBucketName); err != nil || !exists {
+		t.Fatalf("Want bucket to exist after CreateBucket(), got %t, %v", exists, err)
+	}
+}
+
+func TestWriteGetDeleteBucketFile(t *testing.T) {
+	s3sc, fake := newTestClient(t, 0)
+	if err := s3sc.CreateBucket(cloud.RawFrameBucketName); err != nil {
+		t.Fatalf("CreateBucket() returns err: %v", err)
+	}
+
+	localFile := writeLocalFile(t, []byte("frame data"))
+	if err := s3sc.WriteBucketFile(cloud.RawFrameBucketName, localFile, "user.video.0.png"); err != nil {
+		t.Fatalf("WriteBucketFile() returns err: %v", err)
+	}
+	if _, err := os.Stat(localFile); !os.IsNotExist(err) {
+		t.Fatalf("Want local file removed after WriteBucketFile(), got %v", err)
+	}
+	if fake.partsPut != 0 {
+		t.Fatalf("Want small file uploaded without parts, got %d parts", fake.partsPut)
+	}
+
+	if exists, err := s3sc.BucketFileExists(cloud.RawFrameBucketName, "user.video.0.png"); err != nil || !exists {
+		t.Fatalf("Want bucket file to exist after WriteBucketFile(), got %t, %v", exists, err)
+	}
+
+	tempPath, err := s3sc.GetBucketFile(cloud.RawFrameBucketName, "user.video.0.png")
+	if err != nil {
+		t.Fatalf("GetBucketFile() returns err: %v", err)
+	}
+	defer os.Remove(tempPath)
+	if !strings.HasSuffix(tempPath, ".png") {
+		t.Fatalf("Want temp file with .png extension, got %q", tempPath)
+	}
+	data, err := ioutil.ReadFile(tempPath)
+	if err != nil {
+		t.Fatalf("ReadFile() returns err: %v", err)
+	}
+	if string(data) != "frame data" {
+		t.Fatalf("Want contents %q, got %q", "frame data", data)
+	}
+
+	if err := s3sc.DeleteBucketFile(cloud.RawFrameBucketName, "user.video.0.png"); err != nil {
+		t.Fatalf("DeleteBucketFile() returns err: %v", err)
+	}
+
+	var nfe *senecaerror.NotFoundError
+	if _, err := s3sc.GetBucketFile(cloud.RawFrameBucketName, "user.video.0.png"); !errors.As(err, &nfe) {
+		t.Fatalf("Want NotFoundError from GetBucketFile() for deleted file, got %v", err)
+	}
+	if err := s3sc.DeleteBucketFile(cloud.RawFrameBucketName, "user.video.0.png"); !errors.As(err, &nfe) {
+		t.Fatalf("Want NotFoundError from DeleteBucketFile() for deleted file, got %v", err)
+	}
+}
+
+func TestMultipartUpload(t *testing.T) {
+	s3sc, fake := newTestClient(t, s3manager.MinUploadPartSize)
+	if err := s3sc.CreateBucket(cloud.RawVideoBucketName); err != nil {
+		t.Fatalf("CreateBucket() returns err: %v", err)
+	}
+
+	want := make([]byte, s3manager.MinUploadPartSize*2+1024)
+	for i := range want {
+		want[i] = byte(i % 251)
+	}
+	if err := s3sc.WriteBucketFile(cloud.RawVideoBucketName, writeLocalFile(t, want), "user.123.RAW_VIDEO.mp4"); err != nil {
+		t.Fatalf("WriteBucketFile() returns err: %v", err)
+	}
+	if fake.partsPut != 3 {
+		t.Fatalf("Want 3 parts uploaded, got %d", fake.partsPut)
+	}
+
+	tempPath, err := s3sc.GetBucketFile(cloud.RawVideoBucketName, "user.123.RAW_VIDEO.mp4")
+	if err != nil {
+		t.Fatalf("GetBucketFile() returns err: %v", err)
+	}
+	defer os.Remove(tempPath)
+	got, err := ioutil.ReadFile(tempPath)
+	if err != nil {
+		t.Fatalf("ReadFile() returns err: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("Want %d bytes uploaded in parts to round trip, got %d different bytes", len(want), len(got))
+	}
+}
+
+func TestNewS3StorageClientRejectsSmallParts(t *testing.T) {
+	var de *senecaerror.DevError
+	if _, err := NewS3StorageClient(&S3Config{PartSize: 1024}, testProjectID, time.Second, time.Second); !errors.As(err, &de) {
+		t.Fatalf("Want DevError from NewS3StorageClient() for small part size, got %v", err)
+	}
+}
+
+func TestStreamingWriterAndRangeReader(t *testing.T) {
+	s3sc, fake := newTestClient(t, s3manager.MinUploadPartSize)
+	if err := s3sc.CreateBucket(cloud.RawVideoBucketName); err != nil {
+		t.Fatalf("CreateBucket() returns err: %v", err)
+	}
+
+	want := make([]byte, s3manager.MinUploadPartSize+100)
+	for i := range want {
+		want[i] = byte(i % 251)
+	}
+
+	w, err := s3sc.NewBucketFileWriter(cloud.RawVideoBucketName, "user.123.RAW_VIDEO.mp4")
+	if err != nil {
+		t.Fatalf("NewBucketFileWriter() returns err: %v", err)
+	}
+	// Write in small chunks, like a request body being streamed.
+	for i := 0; i < len(want); i += 4096 {
+		end := i + 4096
+		if end > len(want) {
+			end = len(want)
+		}
+		if _, err := w.Write(want[i:end]); err != nil {
+			t.Fatalf("Write() returns err: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() returns err: %v", err)
+	}
+	if fake.partsPut != 2 {
+		t.Fatalf("Want 2 parts uploaded, got %d", fake.partsPut)
+	}
+
+	for _, tc := range []struct {
+		offset int64
+		length int64
+		want   []byte
+	}{
+		{0, -1, want},
+		{10, 20, want[10:30]},
+		{int64(len(want)) - 5, -1, want[len(want)-5:]},
+		{10, 0, []byte{}},
+	} {
+		rc, err := s3sc.NewBucketFileRangeReader(cloud.RawVideoBucketName, "user.123.RAW_VIDEO.mp4", tc.offset, tc.length)
+		if err != nil {
+			t.Fatalf("NewBucketFileRangeReader(%d, %d) returns err: %v", tc.offset, tc.length, err)
+		}
+		got, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("ReadAll() returns err: %v", err)
+		}
+		if !bytes.Equal(got, tc.want) {
+			t.Fatalf("Want %d bytes for range (%d, %d), got %d different bytes", len(tc.want), tc.offset, tc.length, len(got))
+		}
+	}
+
+	var nfe *senecaerror.NotFoundError
+	if _, err := s3sc.NewBucketFileReader(cloud.RawVideoBucketName, "missing.mp4"); !errors.As(err, &nfe) {
+		t.Fatalf("Want NotFoundError from NewBucketFileReader() for missing file, got %v", err)
+	}
+
+	w, err = s3sc.NewBucketFileWriter(cloud.RawFrameBucketName, "user.video.0.png")
+	if err != nil {
+		t.Fatalf("NewBucketFileWriter() returns err: %v", err)
+	}
+	w.Write([]byte("frame"))
+	var bse *senecaerror.BadStateError
+	if err := w.Close(); !errors.As(err, &bse) {
+		t.Fatalf("Want BadStateError from Close() for missing bucket, got %v", err)
+	}
+}
+
+func TestSignedURL(t *testing.T) {
+	s3sc, _ := newTestClient(t, 0)
+	if err := s3sc.CreateBucket(cloud.RawVideoBucketName); err != nil {
+		t.Fatalf("CreateBucket() returns err: %v", err)
+	}
+	if err := s3sc.WriteBucketFile(cloud.RawVideoBucketName, writeLocalFile(t, []byte("video data")), "user.123.RAW_VIDEO.mp4"); err != nil {
+		t.Fatalf("WriteBucketFile() returns err: %v", err)
+	}
+
+	signedURL, err := s3sc.SignedURL(cloud.RawVideoBucketName, "user.123.RAW_VIDEO.mp4", time.Minute*15)
+	if err != nil {
+		t.Fatalf("SignedURL() returns err: %v", err)
+	}
+	parsedURL, err := url.Parse(signedURL)
+	if err != nil {
+		t.Fatalf("url.Parse(%s) returns err: %v", signedURL, err)
+	}
+	if parsedURL.Path != "/project-raw-videos/user.123.RAW_VIDEO.mp4" {
+		t.Fatalf("Want signed URL for the real bucket and file, got %q", signedURL)
+	}
+	if got := parsedURL.Query().Get("X-Amz-Expires"); got != "900" {
+		t.Fatalf("Want X-Amz-Expires 900, got %q", got)
+	}
+
+	// The stand-in doesn't check signatures, but the URL should fetch the file without any extra headers.
+	resp, err := http.Get(signedURL)
+	if err != nil {
+		t.Fatalf("http.Get() returns err: %v", err)
+	}
+	defer resp.Body.Close()
+	data, _ := ioutil.ReadAll(resp.Body)
+	if string(data) != "video data" {
+		t.Fatalf("Want %q from signed URL, got %q", "video data", data)
+	}
+
+	var de *senecaerror.DevError
+	if _, err := s3sc.SignedURL(cloud.RawVideoBucketName, "user.123.RAW_VIDEO.mp4", cloud.MaxSignedURLExpiry+time.Second); !errors.As(err, &de) {
+		t.Fatalf("Want DevError from SignedURL() for expiry over the max, got %v", err)
+	}
+}
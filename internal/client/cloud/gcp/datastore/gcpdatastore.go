@@ -11,6 +11,7 @@ import (
 	"strconv"
 
 	"cloud.google.com/go/datastore"
+	"google.golang.org/api/iterator"
 )
 
 const (
@@ -23,8 +24,21 @@ const (
 	rawLocationKind      = "RawLocation"
 	rawFrameKind         = "RawFrame"
 	userKind             = "User"
+	migrationKind        = "Migration"
+	tombstoneKind        = "Tombstone"
+	auditKind            = "Audit"
+	leaseKind            = "Lease"
+	jobKind              = "Job"
+	rawTelemetryFileKind = "RawTelemetryFile"
+	rawVehicleSignalKind = "RawVehicleSignal"
 )
 
+// maxKeysPerGetMulti is the most keys Datastore looks up in one call.
+const maxKeysPerGetMulti = 1000
+
+// maxMutationsPerCommit is the most entities Datastore writes or deletes in one commit.
+const maxMutationsPerCommit = 500
+
 var (
 	tripKey = datastore.Key{
 		Kind: tripKind,
@@ -58,16 +72,51 @@ var (
 		Kind: userKind,
 		Name: constants.UsersTable.String(),
 	}
+	migrationKey = datastore.Key{
+		Kind: migrationKind,
+		Name: constants.MigrationsTable.String(),
+	}
+	tombstoneKey = datastore.Key{
+		Kind: tombstoneKind,
+		Name: constants.TombstonesTable.String(),
+	}
+	auditKey = datastore.Key{
+		Kind: auditKind,
+		Name: constants.AuditTable.String(),
+	}
+	leaseKey = datastore.Key{
+		Kind: leaseKind,
+		Name: constants.LeasesTable.String(),
+	}
+	jobKey = datastore.Key{
+		Kind: jobKind,
+		Name: constants.JobsTable.String(),
+	}
+	rawTelemetryFileKey = datastore.Key{
+		Kind: rawTelemetryFileKind,
+		Name: constants.RawTelemetryFilesTable.String(),
+	}
+	rawVehicleSignalKey = datastore.Key{
+		Kind: rawVehicleSignalKind,
+		Name: constants.RawVehicleSignalsTable.String(),
+	}
 
 	tableNameToDatastoreKey = map[constants.TableName]datastore.Key{
-		constants.UsersTable:            userKey,
-		constants.RawVideosTable:        rawVideoKey,
-		constants.RawLocationsTable:     rawLocationKey,
-		constants.RawFramesTable:        rawFrameKey,
-		constants.RawMotionsTable:       rawMotionKey,
-		constants.EventTable:            eventKey,
-		constants.TripTable:             tripKey,
-		constants.DrivingConditionTable: drivingConditionKey,
+		constants.UsersTable:             userKey,
+		constants.RawVideosTable:         rawVideoKey,
+		constants.RawLocationsTable:      rawLocationKey,
+		constants.RawFramesTable:         rawFrameKey,
+		constants.RawMotionsTable:        rawMotionKey,
+		constants.EventTable:             eventKey,
+		constants.TripTable:              tripKey,
+		constants.DrivingConditionTable:  drivingConditionKey,
+		constants.MigrationsTable:        migrationKey,
+		constants.TombstonesTable:        tombstoneKey,
+		constants.AuditTable:             auditKey,
+		constants.LeasesTable:            leaseKey,
+		constants.JobsTable:              jobKey,
+		constants.RawTelemetryFilesTable: rawTelemetryFileKey,
+		constants.RawVehicleSignalsTable: rawVehicleSignalKey,
 	}
 )
 
@@ -75,6 +124,8 @@ var (
 type Service struct {
 	client    *datastore.Client
 	projectID string
+	// tx is set on the Service passed to RunInTransaction() callbacks.
+	tx *datastore.Transaction
 }
 
 // 	New returns a new datastore Service object.
@@ -95,7 +146,8 @@ func New(ctx context.Context, projectID string) (*Service, error) {
 	}, nil
 }
 
-// 	ListIDs lists the IDs of the objects that satisfy the query.
+// 	ListIDs lists the IDs of the objects that satisfy the query.  Datastore only allows ancestor queries
+// 	in transactions, so this reads outside of the transaction even when called in RunInTransaction().
 //	Params:
 //		tableName constants.TableName
 //		queryParams []*database.QueryParam: the parameters for the query to execute
@@ -127,6 +179,135 @@ func (s *Service) ListIDs(tableName constants.TableName, queryParams []*database
 	return ids, nil
 }
 
+//	ListIDsByQuery lists one page of the IDs that satisfy the query.  Queries whose filters Datastore can
+//	serve from its indexes run keys-only with Datastore cursors.  IN filters, which this client doesn't support,
+//	run as one query per value, and inequality filters outside of the query's range field are applied to the
+//	loaded objects.  Those queries read every candidate object and page with offset cursors.
+//	Params:
+//		query *database.Query
+//	Returns:
+//		[]string: the IDs in the page
+//		string: the cursor of the next page, "" if this is the last one
+//		senecaerror.DevError, senecaerror.CloudError, senecaerror.UserError
+func (s *Service) ListIDsByQuery(query *database.Query) ([]string, string, error) {
+	if err := query.Validate(); err != nil {
+		return nil, "", err
+	}
+	key, ok := tableNameToDatastoreKey[query.TableName]
+	if !ok {
+		return nil, "", senecaerror.NewDevError(fmt.Errorf("no Datastore key found for table %q", query.TableName))
+	}
+
+	rangeField, _ := query.RangeField()
+	indexed := []*database.QueryParam{}
+	var inFilter *database.QueryParam
+	native := true
+	for _, qp := range query.Filters {
+		switch {
+		case qp.Operand == database.InOperand:
+			inFilter = qp
+			native = false
+		case qp.Operand == "=" || qp.FieldName == rangeField:
+			indexed = append(indexed, qp)
+		default:
+			native = false
+		}
+	}
+
+	baseQuery := datastore.NewQuery(key.Kind)
+	for _, qp := range indexed {
+		baseQuery = baseQuery.Filter(fmt.Sprintf("%s%s", qp.FieldName, qp.Operand), qp.Value)
+	}
+
+	if native {
+		return s.listIDsPage(query, baseQuery)
+	}
+
+	subQueries := []*datastore.Query{baseQuery}
+	if inFilter != nil {
+		subQueries = nil
+		for _, value := range inFilter.Value.([]interface{}) {
+			subQueries = append(subQueries, baseQuery.Filter(fmt.Sprintf("%s=", inFilter.FieldName), value))
+		}
+	}
+
+	ids := []string{}
+	objects := []interface{}{}
+	seen := map[int64]bool{}
+	for _, subQuery := range subQueries {
+		it := s.client.Run(context.TODO(), subQuery)
+		for {
+			object, err := database.NewObjectForTable(query.TableName)
+			if err != nil {
+				return nil, "", err
+			}
+			k, err := it.Next(object)
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				return nil, "", senecaerror.NewCloudError(fmt.Errorf("error running query %v - err: %w", subQuery, err))
+			}
+			// Repeated IN values match the same objects again.
+			if seen[k.ID] {
+				continue
+			}
+			seen[k.ID] = true
+			ids = append(ids, fmt.Sprintf("%d", k.ID))
+			objects = append(objects, object)
+		}
+	}
+
+	return database.ApplyQuery(query, ids, objects)
+}
+
+// listIDsPage runs the query natively, keys-only, with one extra result to tell whether there is a next page.
+func (s *Service) listIDsPage(query *database.Query, dsQuery *datastore.Query) ([]string, string, error) {
+	dsQuery = dsQuery.KeysOnly()
+	for _, order := range query.Orders {
+		if order.Descending {
+			dsQuery = dsQuery.Order(fmt.Sprintf("-%s", order.FieldName))
+		} else {
+			dsQuery = dsQuery.Order(order.FieldName.String())
+		}
+	}
+	if query.Limit > 0 {
+		dsQuery = dsQuery.Limit(query.Limit + 1)
+	}
+	if query.Cursor != "" {
+		cursor, err := datastore.DecodeCursor(query.Cursor)
+		if err != nil {
+			return nil, "", senecaerror.NewUserError("", fmt.Errorf("invalid cursor %q - err: %w", query.Cursor, err), "Invalid page cursor.")
+		}
+		dsQuery = dsQuery.Start(cursor)
+	}
+
+	ids := []string{}
+	nextCursor := ""
+	it := s.client.Run(context.TODO(), dsQuery)
+	for {
+		k, err := it.Next(nil)
+		if err == iterator.Done {
+			return ids, "", nil
+		}
+		if err != nil {
+			return nil, "", senecaerror.NewCloudError(fmt.Errorf("error running query %v - err: %w", dsQuery, err))
+		}
+		if query.Limit > 0 && len(ids) == query.Limit {
+			return ids, nextCursor, nil
+		}
+
+		ids = append(ids, fmt.Sprintf("%d", k.ID))
+		if query.Limit > 0 && len(ids) == query.Limit {
+			cursor, err := it.Cursor()
+			if err != nil {
+				return nil, "", senecaerror.NewCloudError(fmt.Errorf("error getting cursor for query %v - err: %w", dsQuery, err))
+			}
+			nextCursor = cursor.String()
+		}
+	}
+}
+
 //	GetByID gets the object with the given id from the table with the given tableName.
 //	Params:
 //		tableName constants.TableName
@@ -196,15 +377,113 @@ func (s *Service) GetByID(tableName constants.TableName, id string) (interface{}
 			return nil, fmt.Errorf("error getting object with ID %q from table %q: %w", id, tableName, err)
 		}
 		return out, nil
+	case constants.MigrationsTable:
+		out := &database.MigrationRecord{}
+		if err := s.get(context.TODO(), idKey, out); err != nil {
+			return nil, fmt.Errorf("error getting object with ID %q from table %q: %w", id, tableName, err)
+		}
+		return out, nil
+	case constants.TombstonesTable:
+		out := &database.Tombstone{}
+		if err := s.get(context.TODO(), idKey, out); err != nil {
+			return nil, fmt.Errorf("error getting object with ID %q from table %q: %w", id, tableName, err)
+		}
+		return out, nil
+	case constants.AuditTable:
+		out := &database.AuditRecord{}
+		if err := s.get(context.TODO(), idKey, out); err != nil {
+			return nil, fmt.Errorf("error getting object with ID %q from table %q: %w", id, tableName, err)
+		}
+		return out, nil
+	case constants.LeasesTable:
+		out := &database.Lease{}
+		if err := s.get(context.TODO(), idKey, out); err != nil {
+			return nil, fmt.Errorf("error getting object with ID %q from table %q: %w", id, tableName, err)
+		}
+		return out, nil
+	case constants.JobsTable:
+		out := &database.Job{}
+		if err := s.get(context.TODO(), idKey, out); err != nil {
+			return nil, fmt.Errorf("error getting object with ID %q from table %q: %w", id, tableName, err)
+		}
+		return out, nil
+	case constants.RawTelemetryFilesTable:
+		out := &database.RawTelemetryFile{}
+		if err := s.get(context.TODO(), idKey, out); err != nil {
+			return nil, fmt.Errorf("error getting object with ID %q from table %q: %w", id, tableName, err)
+		}
+		return out, nil
+	case constants.RawVehicleSignalsTable:
+		out := &database.RawVehicleSignal{}
+		if err := s.get(context.TODO(), idKey, out); err != nil {
+			return nil, fmt.Errorf("error getting object with ID %q from table %q: %w", id, tableName, err)
+		}
+		return out, nil
 	default:
 		return nil, senecaerror.NewDevError(fmt.Errorf("getting type not supported for %q", tableName))
 	}
 }
 
+//	GetByIDs gets the objects with the given ids from the table, in batches of at most maxKeysPerGetMulti.
+//	Params:
+//		tableName constants.TableName
+//		ids []string
+//	Returns:
+//		[]interface{}: the untyped objects, in the same order as ids
+//		senecaerror.DevError, senecaerror.BadStateError, senecaerror.CloudError, senecaerror.NotFoundError
+func (s *Service) GetByIDs(tableName constants.TableName, ids []string) ([]interface{}, error) {
+	keys, err := s.idKeys(tableName, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := []interface{}{}
+	for start := 0; start < len(keys); start += maxKeysPerGetMulti {
+		end := start + maxKeysPerGetMulti
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		batch := []interface{}{}
+		for range keys[start:end] {
+			object, err := database.NewObjectForTable(tableName)
+			if err != nil {
+				return nil, err
+			}
+			batch = append(batch, object)
+		}
+
+		if s.tx != nil {
+			err = s.tx.GetMulti(keys[start:end], batch)
+		} else {
+			err = s.client.GetMulti(context.TODO(), keys[start:end], batch)
+		}
+		if err != nil {
+			var multiErr datastore.MultiError
+			if errors.As(err, &multiErr) {
+				for i, e := range multiErr {
+					if e == datastore.ErrNoSuchEntity {
+						return nil, senecaerror.NewNotFoundError(fmt.Errorf("object with ID %q not found in table %q", ids[start+i], tableName))
+					}
+				}
+			}
+			return nil, senecaerror.NewCloudError(fmt.Errorf("error getting %d objects from table %q - err: %w", end-start, tableName, err))
+		}
+		objects = append(objects, batch...)
+	}
+
+	return objects, nil
+}
+
 // get adapts datastore errors to senecaerrors.
 func (s *Service) get(ctx context.Context, key *datastore.Key, dst interface{}) error {
 	// TODO(lucaloncar): better error handling here
-	err := s.client.Get(ctx, key, dst)
+	var err error
+	if s.tx != nil {
+		err = s.tx.Get(key, dst)
+	} else {
+		err = s.client.Get(ctx, key, dst)
+	}
 	if err != nil {
 		dneErr := &datastore.ErrNoSuchEntity
 		if errors.As(err, dneErr) {
@@ -223,6 +502,14 @@ func (s *Service) Create(tableName constants.TableName, object interface{}) (str
 
 	incompleteKey := datastore.IncompleteKey(key.Kind, &key)
 
+	if s.tx != nil {
+		ids, err := s.CreateMulti(tableName, []interface{}{object})
+		if err != nil {
+			return "", err
+		}
+		return ids[0], nil
+	}
+
 	fullKey, err := s.client.Put(context.TODO(), incompleteKey, object)
 	if err != nil {
 		return "", senecaerror.NewCloudError(fmt.Errorf("error putting %v for table %q", object, tableName))
@@ -243,13 +530,23 @@ func (s *Service) Insert(tableName constants.TableName, id string, object interf
 	}
 
 	idKey := datastore.IDKey(key.Kind, idInt, &key)
-	if _, err = s.client.Put(context.TODO(), idKey, object); err != nil {
+	if s.tx != nil {
+		_, err = s.tx.Put(idKey, object)
+	} else {
+		_, err = s.client.Put(context.TODO(), idKey, object)
+	}
+	if err != nil {
 		return senecaerror.NewCloudError(fmt.Errorf("error putting %v with id %q for table %q - err: %w", object, id, tableName, err))
 	}
 
 	return nil
 }
 
+// Put is Insert, since Datastore's Put creates entities that don't exist yet.
+func (s *Service) Put(tableName constants.TableName, id string, object interface{}) error {
+	return s.Insert(tableName, id, object)
+}
+
 func (s *Service) DeleteByID(tableName constants.TableName, id string) error {
 	key, ok := tableNameToDatastoreKey[tableName]
 	if !ok {
@@ -262,9 +559,171 @@ func (s *Service) DeleteByID(tableName constants.TableName, id string) error {
 	}
 
 	idKey := datastore.IDKey(key.Kind, idInt, &key)
-	if err := s.client.Delete(context.TODO(), idKey); err != nil {
+	if s.tx != nil {
+		err = s.tx.Delete(idKey)
+	} else {
+		err = s.client.Delete(context.TODO(), idKey)
+	}
+	if err != nil {
 		return senecaerror.NewCloudError(fmt.Errorf("error deleting object with ID %q from table %q: %w", id, tableName, err))
 	}
 
 	return nil
 }
+
+//	CreateMulti puts the objects with newly allocated IDs.  Outside of a transaction they're put in one
+//	transaction per maxMutationsPerCommit objects, so if one fails the batches before it stay committed.
+//	Within a transaction they're all put in it, which Datastore refuses to commit past maxMutationsPerCommit.
+//	Params:
+//		tableName constants.TableName
+//		objects []interface{}
+//	Returns:
+//		[]string: the new IDs, in the same order as objects
+//		senecaerror.DevError, senecaerror.CloudError
+func (s *Service) CreateMulti(tableName constants.TableName, objects []interface{}) ([]string, error) {
+	key, ok := tableNameToDatastoreKey[tableName]
+	if !ok {
+		return nil, senecaerror.NewDevError(fmt.Errorf("no Datastore key found for table %q", tableName))
+	}
+
+	// IDs are set by index since a batch's transaction may be retried.
+	ids := make([]string, len(objects))
+	err := s.inBatches(len(objects), func(tx *datastore.Transaction, start, end int) error {
+		incompleteKeys := []*datastore.Key{}
+		for range objects[start:end] {
+			incompleteKeys = append(incompleteKeys, datastore.IncompleteKey(key.Kind, &key))
+		}
+
+		// Keys put in a transaction are only completed on commit, so the IDs are allocated up front.
+		fullKeys, err := s.client.AllocateIDs(context.TODO(), incompleteKeys)
+		if err != nil {
+			return senecaerror.NewCloudError(fmt.Errorf("error allocating %d IDs for table %q - err: %w", end-start, tableName, err))
+		}
+
+		if _, err := tx.PutMulti(fullKeys, objects[start:end]); err != nil {
+			return senecaerror.NewCloudError(fmt.Errorf("error putting %d objects for table %q - err: %w", end-start, tableName, err))
+		}
+
+		for i, k := range fullKeys {
+			ids[start+i] = fmt.Sprintf("%d", k.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+//	InsertMulti puts the objects with the given IDs, in batches like CreateMulti.
+//	Params:
+//		tableName constants.TableName
+//		ids []string
+//		objects []interface{}: objects[i] is written to ids[i]
+//	Returns:
+//		senecaerror.DevError, senecaerror.BadStateError, senecaerror.CloudError
+func (s *Service) InsertMulti(tableName constants.TableName, ids []string, objects []interface{}) error {
+	if len(ids) != len(objects) {
+		return senecaerror.NewDevError(fmt.Errorf("got %d ids for %d objects", len(ids), len(objects)))
+	}
+
+	keys, err := s.idKeys(tableName, ids)
+	if err != nil {
+		return err
+	}
+
+	return s.inBatches(len(keys), func(tx *datastore.Transaction, start, end int) error {
+		if _, err := tx.PutMulti(keys[start:end], objects[start:end]); err != nil {
+			return senecaerror.NewCloudError(fmt.Errorf("error putting %d objects for table %q - err: %w", end-start, tableName, err))
+		}
+		return nil
+	})
+}
+
+//	DeleteMulti deletes the objects with the given IDs, in batches like CreateMulti.
+//	Params:
+//		tableName constants.TableName
+//		ids []string
+//	Returns:
+//		senecaerror.DevError, senecaerror.BadStateError, senecaerror.CloudError
+func (s *Service) DeleteMulti(tableName constants.TableName, ids []string) error {
+	keys, err := s.idKeys(tableName, ids)
+	if err != nil {
+		return err
+	}
+
+	return s.inBatches(len(keys), func(tx *datastore.Transaction, start, end int) error {
+		if err := tx.DeleteMulti(keys[start:end]); err != nil {
+			return senecaerror.NewCloudError(fmt.Errorf("error deleting %d objects from table %q - err: %w", end-start, tableName, err))
+		}
+		return nil
+	})
+}
+
+// inBatches calls f with the whole range [0, n) in the current transaction, or outside of one with ranges of at most
+// maxMutationsPerCommit, each in its own transaction.
+func (s *Service) inBatches(n int, f func(tx *datastore.Transaction, start, end int) error) error {
+	if s.tx != nil {
+		return f(s.tx, 0, n)
+	}
+
+	for start := 0; start < n; start += maxMutationsPerCommit {
+		end := start + maxMutationsPerCommit
+		if end > n {
+			end = n
+		}
+		if err := s.RunInTransaction(context.TODO(), func(tx database.SQLInterface) error {
+			return f(tx.(*Service).tx, start, end)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//	RunInTransaction runs f in a Datastore transaction.  Datastore retries f when the transaction
+//	conflicts with another one, so f must be safe to run more than once.
+//	Params:
+//		ctx context.Context
+//		f func(tx database.SQLInterface) error
+//	Returns:
+//		error: the error from f, or senecaerror.CloudError if committing fails
+func (s *Service) RunInTransaction(ctx context.Context, f func(tx database.SQLInterface) error) error {
+	if s.tx != nil {
+		return f(s)
+	}
+
+	var fErr error
+	_, err := s.client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		fErr = f(&Service{
+			client:    s.client,
+			projectID: s.projectID,
+			tx:        tx,
+		})
+		return fErr
+	})
+	if fErr != nil {
+		return fErr
+	}
+	if err != nil {
+		return senecaerror.NewCloudError(fmt.Errorf("error running transaction - err: %w", err))
+	}
+	return nil
+}
+
+func (s *Service) idKeys(tableName constants.TableName, ids []string) ([]*datastore.Key, error) {
+	key, ok := tableNameToDatastoreKey[tableName]
+	if !ok {
+		return nil, senecaerror.NewDevError(fmt.Errorf("no Datastore key found for table %q", tableName))
+	}
+
+	keys := []*datastore.Key{}
+	for _, id := range ids {
+		idInt, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return nil, senecaerror.NewBadStateError(fmt.Errorf("error parsing id %q into int64", id))
+		}
+		keys = append(keys, datastore.IDKey(key.Kind, idInt, &key))
+	}
+	return keys, nil
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"time"
 
@@ -14,6 +15,8 @@ import (
 	mp4util "seneca/internal/util/mp4/util"
 
 	"cloud.google.com/go/storage"
+	"golang.org/x/oauth2/google"
+	"golang.org/x/oauth2/jwt"
 	"google.golang.org/api/iterator"
 )
 
@@ -35,6 +38,9 @@ type GoogleCloudStorageClient struct {
 	projectID    string
 	quickTimeOut time.Duration
 	longTimeOut  time.Duration
+	// signer holds the service account key URLs are signed with, it's nil if signerErr isn't.
+	signer    *jwt.Config
+	signerErr error
 }
 
 // 	NewGoogleCloudStorageClient initializes a new Google storage.Client with the given parameters.
@@ -51,14 +57,32 @@ func NewGoogleCloudStorageClient(ctx context.Context, projectID string, quickTim
 	if err != nil {
 		return nil, senecaerror.NewCloudError(fmt.Errorf("error initializing NewGoogleCloudStorageClient - err: %v", err))
 	}
+	// Credentials without a service account key can still read and write, so only SignedURL() fails without one.
+	signer, signerErr := loadSigner()
 	return &GoogleCloudStorageClient{
 		client:       client,
 		projectID:    projectID,
 		quickTimeOut: quickTimeOut,
 		longTimeOut:  longTimeOut,
+		signer:       signer,
+		signerErr:    signerErr,
 	}, nil
 }
 
+// loadSigner reads the service account key from the credentials file in GOOGLE_APPLICATION_CREDENTIALS.
+func loadSigner() (*jwt.Config, error) {
+	credentialsPath := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	credentialsJSON, err := ioutil.ReadFile(credentialsPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading credentials %q for signing - err: %w", credentialsPath, err)
+	}
+	jwtConfig, err := google.JWTConfigFromJSON(credentialsJSON)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing service account credentials %q for signing - err: %w", credentialsPath, err)
+	}
+	return jwtConfig, nil
+}
+
 // 	CreateBucket creates a bucket in the project with the given name.
 //	Params:
 //		bucketName cloud.BucketName
@@ -232,3 +256,127 @@ func (gcsc *GoogleCloudStorageClient) DeleteBucketFile(bucketName cloud.BucketNa
 	}
 	return nil
 }
+
+// 	NewBucketFileWriter opens a writer streaming to the file with the bucketFileName in the given bucket.
+// 	The upload is committed on Close, and must finish within the long time out.
+//	Params:
+//		bucketName cloud.BucketName
+//		bucketFileName string
+//	Returns:
+//		cloud.BucketFileWriter
+//		senecaerror.BadStateError
+func (gcsc *GoogleCloudStorageClient) NewBucketFileWriter(bucketName cloud.BucketName, bucketFileName string) (cloud.BucketFileWriter, error) {
+	if bucketFileName == "" {
+		return nil, senecaerror.NewBadStateError(fmt.Errorf("received empty bucketFileName"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), gcsc.longTimeOut)
+	return &cancelOnCloseWriter{
+		WriteCloser: gcsc.client.Bucket(bucketName.RealName(gcsc.projectID)).Object(bucketFileName).NewWriter(ctx),
+		cancel:      cancel,
+	}, nil
+}
+
+// 	NewBucketFileReader opens a reader streaming the file with the bucketFileName from the given bucket.
+//	Params:
+//		bucketName cloud.BucketName
+//		bucketFileName string
+//	Returns:
+//		io.ReadCloser
+//		senecaerror.CloudError, senecaerror.BadStateError, senecaerror.NotFoundError
+func (gcsc *GoogleCloudStorageClient) NewBucketFileReader(bucketName cloud.BucketName, bucketFileName string) (io.ReadCloser, error) {
+	return gcsc.NewBucketFileRangeReader(bucketName, bucketFileName, 0, -1)
+}
+
+// 	NewBucketFileRangeReader opens a reader streaming length bytes of the file starting at offset.
+//	Params:
+//		bucketName cloud.BucketName
+//		bucketFileName string
+//		offset int64
+//		length int64: negative to read until the end of the file
+//	Returns:
+//		io.ReadCloser
+//		senecaerror.CloudError, senecaerror.BadStateError, senecaerror.NotFoundError
+func (gcsc *GoogleCloudStorageClient) NewBucketFileRangeReader(bucketName cloud.BucketName, bucketFileName string, offset, length int64) (io.ReadCloser, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), gcsc.longTimeOut)
+
+	rc, err := gcsc.client.Bucket(bucketName.RealName(gcsc.projectID)).Object(bucketFileName).NewRangeReader(ctx, offset, length)
+	if err != nil {
+		cancel()
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return nil, senecaerror.NewNotFoundError(fmt.Errorf("bucketFile %q does not exist: %w", bucketFileName, err))
+		} else if errors.Is(err, storage.ErrBucketNotExist) {
+			return nil, senecaerror.NewBadStateError(fmt.Errorf("bucket %q does not exist - err: %w", bucketName, err))
+		}
+		return nil, senecaerror.NewCloudError(fmt.Errorf("error reading range [%d, %d) from bucket %q for file %q - err: %w", offset, offset+length, bucketName, bucketFileName, err))
+	}
+
+	return &cancelOnCloseReader{
+		ReadCloser: rc,
+		cancel:     cancel,
+	}, nil
+}
+
+// cancelOnCloseWriter releases the context of the wrapped writer once it is closed.
+type cancelOnCloseWriter struct {
+	io.WriteCloser
+	cancel context.CancelFunc
+}
+
+func (w *cancelOnCloseWriter) Close() error {
+	defer w.cancel()
+	return w.WriteCloser.Close()
+}
+
+// Abort cancels the upload, which GCS then never commits.
+func (w *cancelOnCloseWriter) Abort() {
+	w.cancel()
+	w.WriteCloser.Close()
+}
+
+// cancelOnCloseReader releases the context of the wrapped reader once it is closed.
+type cancelOnCloseReader struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (r *cancelOnCloseReader) Close() error {
+	defer r.cancel()
+	return r.ReadCloser.Close()
+}
+
+// 	SignedURL returns a V4 signed URL to GET the file, signed with the service account key
+// 	in GOOGLE_APPLICATION_CREDENTIALS.
+//	Params:
+//		bucketName cloud.BucketName
+//		bucketFileName string
+//		expiry time.Duration: at most cloud.MaxSignedURLExpiry
+//	Returns:
+//		string: the signed URL
+//		senecaerror.DevError, senecaerror.CloudError
+func (gcsc *GoogleCloudStorageClient) SignedURL(bucketName cloud.BucketName, bucketFileName string, expiry time.Duration) (string, error) {
+	if expiry <= 0 || expiry > cloud.MaxSignedURLExpiry {
+		return "", senecaerror.NewDevError(fmt.Errorf("expiry %s must be in (0, %s]", expiry, cloud.MaxSignedURLExpiry))
+	}
+
+	if gcsc.signerErr != nil {
+		return "", senecaerror.NewCloudError(gcsc.signerErr)
+	}
+
+	url, err := storage.SignedURL(bucketName.RealName(gcsc.projectID), bucketFileName, &storage.SignedURLOptions{
+		GoogleAccessID: gcsc.signer.Email,
+		PrivateKey:     gcsc.signer.PrivateKey,
+		Method:         http.MethodGet,
+		Expires:        time.Now().Add(expiry),
+		Scheme:         storage.SigningSchemeV4,
+	})
+	if err != nil {
+		return "", senecaerror.NewCloudError(fmt.Errorf("error signing URL for file %q in bucket %q - err: %w", bucketFileName, bucketName, err))
+	}
+	return url, nil
+}
+
+// 	URLScheme returns cloud.GCSURLScheme.
+func (gcsc *GoogleCloudStorageClient) URLScheme() cloud.URLScheme {
+	return cloud.GCSURLScheme
+}
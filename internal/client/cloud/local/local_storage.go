@@ -0,0 +1,477 @@
+// Package local implements cloud interfaces on the local file system, for offline deployments and hermetic tests.
+package local
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"seneca/api/senecaerror"
+	"seneca/internal/client/cloud"
+	"seneca/internal/util/data"
+)
+
+const (
+	expiresQueryKey   = "expires"
+	signatureQueryKey = "signature"
+)
+
+// 	FileSystemStorageClient implements SimpleStorageInterface on the local disk.  Each BucketName
+// 	maps to a directory under the root directory, and each bucket file to a file in that directory.
+type FileSystemStorageClient struct {
+	rootDir         string
+	signedURLConfig *SignedURLConfig
+}
+
+// 	SignedURLConfig configures the signed URLs handed out by a FileSystemStorageClient, which are
+// 	served by its ServeSignedURL handler.
+type SignedURLConfig struct {
+	// BaseURL is where ServeSignedURL is reachable, e.g. http://localhost:6060/downloads.
+	BaseURL string
+	// SigningKey is the HMAC key URLs are signed with.
+	SigningKey []byte
+}
+
+// 	NewFileSystemStorageClient initializes a FileSystemStorageClient storing all buckets under rootDir.
+// 	Params:
+//		rootDir string: the directory buckets are created in, created if it doesn't exist
+//		signedURLConfig *SignedURLConfig: nil if signed URLs aren't served
+// 	Returns:
+//		*FileSystemStorageClient
+// 		senecaerror.ServerError, senecaerror.DevError
+func NewFileSystemStorageClient(rootDir string, signedURLConfig *SignedURLConfig) (*FileSystemStorageClient, error) {
+	if signedURLConfig != nil {
+		if len(signedURLConfig.SigningKey) == 0 {
+			return nil, senecaerror.NewDevError(fmt.Errorf("signedURLConfig has an empty SigningKey"))
+		}
+		if _, err := url.Parse(signedURLConfig.BaseURL); err != nil {
+			return nil, senecaerror.NewDevError(fmt.Errorf("signedURLConfig has an invalid BaseURL %q - err: %w", signedURLConfig.BaseURL, err))
+		}
+	}
+
+	absRootDir, err := filepath.Abs(rootDir)
+	if err != nil {
+		return nil, senecaerror.NewServerError(fmt.Errorf("error resolving root dir %q - err: %w", rootDir, err))
+	}
+
+	if err := os.MkdirAll(absRootDir, 0755); err != nil {
+		return nil, senecaerror.NewServerError(fmt.Errorf("error creating root dir %q - err: %w", absRootDir, err))
+	}
+
+	return &FileSystemStorageClient{
+		rootDir:         absRootDir,
+		signedURLConfig: signedURLConfig,
+	}, nil
+}
+
+// 	CreateBucket creates the directory for the bucket.
+//	Params:
+//		bucketName cloud.BucketName
+//	Returns:
+//		senecaerror.ServerError
+func (fssc *FileSystemStorageClient) CreateBucket(bucketName cloud.BucketName) error {
+	if err := os.MkdirAll(fssc.bucketPath(bucketName), 0755); err != nil {
+		return senecaerror.NewServerError(fmt.Errorf("error creating bucket %q - err: %w", bucketName, err))
+	}
+	return nil
+}
+
+// 	BucketExists checks if the directory for the bucket exists.
+//	Params:
+//		bucketName cloud.BucketName
+//	Returns:
+//		bool
+//		senecaerror.ServerError
+func (fssc *FileSystemStorageClient) BucketExists(bucketName cloud.BucketName) (bool, error) {
+	info, err := os.Stat(fssc.bucketPath(bucketName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, senecaerror.NewServerError(fmt.Errorf("error checking bucket %q - err: %w", bucketName, err))
+	}
+	return info.IsDir(), nil
+}
+
+// 	BucketFileExists checks if a file with the given name exists in the given bucket.
+//	Params:
+//		bucketName cloud.BucketName
+//		bucketFileName string
+//	Returns:
+//		bool
+//		senecaerror.ServerError, senecaerror.BadStateError
+func (fssc *FileSystemStorageClient) BucketFileExists(bucketName cloud.BucketName, bucketFileName string) (bool, error) {
+	filePath, err := fssc.bucketFilePath(bucketName, bucketFileName)
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := os.Stat(filePath); err != nil {
+		if !os.IsNotExist(err) {
+			return false, senecaerror.NewServerError(fmt.Errorf("error checking file %q in bucket %q - err: %w", bucketFileName, bucketName, err))
+		}
+		if bucketExists, bucketErr := fssc.BucketExists(bucketName); bucketErr == nil && !bucketExists {
+			return false, senecaerror.NewBadStateError(fmt.Errorf("bucket %q does not exist", bucketName))
+		}
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// 	WriteBucketFile atomically copies the given local file into the bucket with the bucketFileName.
+// 	Like the GCS client, the local file is removed afterwards.
+//	Params:
+//		bucketName cloud.BucketName
+//		localFileNameAndPath string
+//		bucketFileName string
+//	Returns:
+//		senecaerror.BadStateError, senecaerror.ServerError
+func (fssc *FileSystemStorageClient) WriteBucketFile(bucketName cloud.BucketName, localFileNameAndPath, bucketFileName string) error {
+	defer os.Remove(localFileNameAndPath)
+
+	if localFileNameAndPath == "" {
+		return senecaerror.NewBadStateError(fmt.Errorf("received empty localFileName"))
+	}
+
+	f, err := os.Open(localFileNameAndPath)
+	if err != nil {
+		return senecaerror.NewBadStateError(fmt.Errorf("error opening local file %q - err: %v", localFileNameAndPath, err))
+	}
+	defer f.Close()
+
+	w, err := fssc.NewBucketFileWriter(bucketName, bucketFileName)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, f); err != nil {
+		w.Abort()
+		return senecaerror.NewServerError(fmt.Errorf("error writing file %q to bucket %q - err: %w", bucketFileName, bucketName, err))
+	}
+	if err := w.Close(); err != nil {
+		return senecaerror.NewServerError(fmt.Errorf("error writing file %q to bucket %q - err: %w", bucketFileName, bucketName, err))
+	}
+
+	return nil
+}
+
+// 	GetBucketFile copies the file with the given bucketFileName to a temp file and returns that file's path.
+//	Params:
+//		bucketName cloud.BucketName
+//		bucketFileName string
+//	Returns:
+//		string: the name of the temporary file
+//		senecaerror.ServerError, senecaerror.BadStateError, senecaerror.NotFoundError
+func (fssc *FileSystemStorageClient) GetBucketFile(bucketName cloud.BucketName, bucketFileName string) (string, error) {
+	rc, err := fssc.NewBucketFileReader(bucketName, bucketFileName)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	tempFile, err := ioutil.TempFile("", tempFilePattern(bucketFileName))
+	if err != nil {
+		return "", senecaerror.NewServerError(fmt.Errorf("error creating temp file for file %q in bucket %q - err: %w", bucketFileName, bucketName, err))
+	}
+	defer tempFile.Close()
+
+	if _, err := io.Copy(tempFile, rc); err != nil {
+		os.Remove(tempFile.Name())
+		return "", senecaerror.NewServerError(fmt.Errorf("error copying file %q in bucket %q to temp file - err: %w", bucketFileName, bucketName, err))
+	}
+
+	return tempFile.Name(), nil
+}
+
+// 	DeleteBucketFile deletes the file from the bucket.
+//	Params:
+//		bucketName cloud.BucketName
+//		bucketFileName string
+//	Returns:
+//		senecaerror.ServerError, senecaerror.BadStateError, senecaerror.NotFoundError
+func (fssc *FileSystemStorageClient) DeleteBucketFile(bucketName cloud.BucketName, bucketFileName string) error {
+	filePath, err := fssc.bucketFilePath(bucketName, bucketFileName)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(filePath); err != nil {
+		if os.IsNotExist(err) {
+			return senecaerror.NewNotFoundError(fmt.Errorf("bucketFile %q does not exist in bucket %q", bucketFileName, bucketName))
+		}
+		return senecaerror.NewServerError(fmt.Errorf("error deleting file %q in bucket %q - err: %w", bucketFileName, bucketName, err))
+	}
+	return nil
+}
+
+// 	NewBucketFileWriter opens a writer to a temp file in the bucket, which is renamed to bucketFileName on Close,
+// 	so readers never observe a partially written file.
+//	Params:
+//		bucketName cloud.BucketName
+//		bucketFileName string
+//	Returns:
+//		cloud.BucketFileWriter
+//		senecaerror.ServerError, senecaerror.BadStateError
+func (fssc *FileSystemStorageClient) NewBucketFileWriter(bucketName cloud.BucketName, bucketFileName string) (cloud.BucketFileWriter, error) {
+	filePath, err := fssc.bucketFilePath(bucketName, bucketFileName)
+	if err != nil {
+		return nil, err
+	}
+
+	if bucketExists, err := fssc.BucketExists(bucketName); err != nil {
+		return nil, err
+	} else if !bucketExists {
+		return nil, senecaerror.NewBadStateError(fmt.Errorf("bucket %q does not exist", bucketName))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return nil, senecaerror.NewServerError(fmt.Errorf("error creating directory for file %q in bucket %q - err: %w", bucketFileName, bucketName, err))
+	}
+	tempFile, err := ioutil.TempFile(filepath.Dir(filePath), fmt.Sprintf(".%s.*.tmp", filepath.Base(filePath)))
+	if err != nil {
+		return nil, senecaerror.NewServerError(fmt.Errorf("error creating temp file for file %q in bucket %q - err: %w", bucketFileName, bucketName, err))
+	}
+
+	return &atomicFileWriter{
+		tempFile: tempFile,
+		filePath: filePath,
+	}, nil
+}
+
+// 	NewBucketFileReader opens the file with the bucketFileName for reading.
+//	Params:
+//		bucketName cloud.BucketName
+//		bucketFileName string
+//	Returns:
+//		io.ReadCloser
+//		senecaerror.ServerError, senecaerror.BadStateError, senecaerror.NotFoundError
+func (fssc *FileSystemStorageClient) NewBucketFileReader(bucketName cloud.BucketName, bucketFileName string) (io.ReadCloser, error) {
+	return fssc.NewBucketFileRangeReader(bucketName, bucketFileName, 0, -1)
+}
+
+// 	NewBucketFileRangeReader opens the file with the bucketFileName for reading length bytes starting at offset.
+//	Params:
+//		bucketName cloud.BucketName
+//		bucketFileName string
+//		offset int64
+//		length int64: negative to read until the end of the file
+//	Returns:
+//		io.ReadCloser
+//		senecaerror.ServerError, senecaerror.BadStateError, senecaerror.NotFoundError
+func (fssc *FileSystemStorageClient) NewBucketFileRangeReader(bucketName cloud.BucketName, bucketFileName string, offset, length int64) (io.ReadCloser, error) {
+	filePath, err := fssc.bucketFilePath(bucketName, bucketFileName)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, senecaerror.NewNotFoundError(fmt.Errorf("bucketFile %q does not exist in bucket %q", bucketFileName, bucketName))
+		}
+		return nil, senecaerror.NewServerError(fmt.Errorf("error opening file %q in bucket %q - err: %w", bucketFileName, bucketName, err))
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, senecaerror.NewServerError(fmt.Errorf("error reading size of file %q in bucket %q - err: %w", bucketFileName, bucketName, err))
+	}
+	if offset < 0 || offset > info.Size() {
+		f.Close()
+		return nil, senecaerror.NewBadStateError(fmt.Errorf("offset %d is outside of file %q of size %d", offset, bucketFileName, info.Size()))
+	}
+	if length < 0 || offset+length > info.Size() {
+		length = info.Size() - offset
+	}
+
+	return &sectionReadCloser{
+		Reader: io.NewSectionReader(f, offset, length),
+		Closer: f,
+	}, nil
+}
+
+// 	SignedURL returns a URL to GET the file from ServeSignedURL, with an HMAC signature over the file and expiry time.
+//	Params:
+//		bucketName cloud.BucketName
+//		bucketFileName string
+//		expiry time.Duration: at most cloud.MaxSignedURLExpiry
+//	Returns:
+//		string: the signed URL
+//		senecaerror.DevError, senecaerror.BadStateError
+func (fssc *FileSystemStorageClient) SignedURL(bucketName cloud.BucketName, bucketFileName string, expiry time.Duration) (string, error) {
+	if fssc.signedURLConfig == nil {
+		return "", senecaerror.NewDevError(fmt.Errorf("FileSystemStorageClient was not configured with a SignedURLConfig"))
+	}
+	if expiry <= 0 || expiry > cloud.MaxSignedURLExpiry {
+		return "", senecaerror.NewDevError(fmt.Errorf("expiry %s must be in (0, %s]", expiry, cloud.MaxSignedURLExpiry))
+	}
+	if _, err := fssc.bucketFilePath(bucketName, bucketFileName); err != nil {
+		return "", err
+	}
+
+	objectPath := path.Join(bucketName.String(), bucketFileName)
+	expires := strconv.FormatInt(time.Now().Add(expiry).Unix(), 10)
+
+	query := url.Values{}
+	query.Set(expiresQueryKey, expires)
+	query.Set(signatureQueryKey, fssc.sign(objectPath, expires))
+	return fmt.Sprintf("%s/%s?%s", strings.TrimSuffix(fssc.signedURLConfig.BaseURL, "/"), (&url.URL{Path: objectPath}).EscapedPath(), query.Encode()), nil
+}
+
+// 	ServeSignedURL serves files for URLs from SignedURL, supporting range requests.  The signature is the
+// 	only authorization, so this must be routed around any other authorization.
+//	Params:
+//		w http.ResponseWriter
+//		r *http.Request
+func (fssc *FileSystemStorageClient) ServeSignedURL(w http.ResponseWriter, r *http.Request) {
+	if fssc.signedURLConfig == nil {
+		http.Error(w, "signed URLs are not enabled", http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "only GET and HEAD are supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	baseURL, _ := url.Parse(fssc.signedURLConfig.BaseURL)
+	objectPath := strings.TrimPrefix(r.URL.Path, strings.TrimSuffix(baseURL.Path, "/")+"/")
+
+	expires := r.URL.Query().Get(expiresQueryKey)
+	signature := r.URL.Query().Get(signatureQueryKey)
+	if !hmac.Equal([]byte(signature), []byte(fssc.sign(objectPath, expires))) {
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+	expiresUnix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresUnix {
+		http.Error(w, "URL has expired", http.StatusForbidden)
+		return
+	}
+
+	objectParts := strings.SplitN(objectPath, "/", 2)
+	if len(objectParts) != 2 {
+		http.Error(w, "malformed path", http.StatusBadRequest)
+		return
+	}
+	bucketName, err := cloud.ParseBucketName(objectParts[0])
+	if err != nil {
+		http.Error(w, "unknown bucket", http.StatusNotFound)
+		return
+	}
+	filePath, err := fssc.bucketFilePath(bucketName, objectParts[1])
+	if err != nil {
+		http.Error(w, "malformed path", http.StatusBadRequest)
+		return
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		http.Error(w, "file not found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, "error reading file", http.StatusInternalServerError)
+		return
+	}
+
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+func (fssc *FileSystemStorageClient) sign(objectPath, expires string) string {
+	mac := hmac.New(sha256.New, fssc.signedURLConfig.SigningKey)
+	mac.Write([]byte(fmt.Sprintf("%s\n%s", objectPath, expires)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// 	URLScheme returns cloud.FileURLScheme.
+func (fssc *FileSystemStorageClient) URLScheme() cloud.URLScheme {
+	return cloud.FileURLScheme
+}
+
+// 	LocalPath resolves a CloudStorageFileName URL, as stored on RawVideos and RawFrames, to its path on disk.
+//	Params:
+//		cloudStorageFileName string
+//	Returns:
+//		string: the absolute path to the file
+//		error
+func (fssc *FileSystemStorageClient) LocalPath(cloudStorageFileName string) (string, error) {
+	bucketName, fileName, err := data.GCSURLToBucketNameAndFileName(cloudStorageFileName)
+	if err != nil {
+		return "", fmt.Errorf("GCSURLToBucketNameAndFileName(%s) returns err: %w", cloudStorageFileName, err)
+	}
+	return fssc.bucketFilePath(bucketName, fileName)
+}
+
+func (fssc *FileSystemStorageClient) bucketPath(bucketName cloud.BucketName) string {
+	return filepath.Join(fssc.rootDir, bucketName.String())
+}
+
+// bucketFilePath joins the bucketFileName onto the bucket's directory, rejecting names that would escape it.
+func (fssc *FileSystemStorageClient) bucketFilePath(bucketName cloud.BucketName, bucketFileName string) (string, error) {
+	if bucketFileName == "" {
+		return "", senecaerror.NewBadStateError(fmt.Errorf("received empty bucketFileName"))
+	}
+
+	bucketPath := fssc.bucketPath(bucketName)
+	filePath := filepath.Join(bucketPath, filepath.FromSlash(bucketFileName))
+	if !strings.HasPrefix(filePath, bucketPath+string(filepath.Separator)) {
+		return "", senecaerror.NewBadStateError(fmt.Errorf("bucketFileName %q escapes bucket %q", bucketFileName, bucketName))
+	}
+
+	return filePath, nil
+}
+
+// atomicFileWriter writes to a temp file and renames it into place on Close.
+type atomicFileWriter struct {
+	tempFile *os.File
+	filePath string
+}
+
+func (w *atomicFileWriter) Write(p []byte) (int, error) {
+	return w.tempFile.Write(p)
+}
+
+func (w *atomicFileWriter) Close() error {
+	defer os.Remove(w.tempFile.Name())
+
+	if err := w.tempFile.Sync(); err != nil {
+		w.tempFile.Close()
+		return err
+	}
+	if err := w.tempFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(w.tempFile.Name(), w.filePath)
+}
+
+// Abort removes the temp file, leaving any file already at filePath untouched.
+func (w *atomicFileWriter) Abort() {
+	w.tempFile.Close()
+	os.Remove(w.tempFile.Name())
+}
+
+type sectionReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// tempFilePattern keeps the extension of the file name, since tools like ffmpeg and exiftool rely on it.
+func tempFilePattern(bucketFileName string) string {
+	base := filepath.Base(filepath.FromSlash(bucketFileName))
+	ext := filepath.Ext(base)
+	return fmt.Sprintf("%s.*%s", strings.TrimSuffix(base, ext), ext)
+}
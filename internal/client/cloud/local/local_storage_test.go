@@ -0,0 +1,284 @@
+package local
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"seneca/api/senecaerror"
+	"seneca/internal/client/cloud"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T) *FileSystemStorageClient {
+	fssc, err := NewFileSystemStorageClient(filepath.Join(t.TempDir(), "storage"), &SignedURLConfig{BaseURL: "http://localhost/downloads", SigningKey: []byte("key")})
+	if err != nil {
+		t.Fatalf("NewFileSystemStorageClient() returns err: %v", err)
+	}
+	return fssc
+}
+
+func writeLocalFile(t *testing.T, contents string) string {
+	f, err := ioutil.TempFile(t.TempDir(), "local.*.mp4")
+	if err != nil {
+		t.Fatalf("TempFile() returns err: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(contents); err != nil {
+		t.Fatalf("WriteString() returns err: %v", err)
+	}
+	return f.Name()
+}
+
+func TestBucketLifecycle(t *testing.T) {
+	fssc := newTestClient(t)
+
+	exists, err := fssc.BucketExists(cloud.RawVideoBucketName)
+	if err != nil {
+		t.Fatalf("BucketExists() returns err: %v", err)
+	}
+	if exists {
+		t.Fatalf("Want bucket to not exist before CreateBucket()")
+	}
+
+	var bse *senecaerror.BadStateError
+	if _, err := fssc.BucketFileExists(cloud.RawVideoBucketName, "video.mp4"); !errors.As(err, &bse) {
+		t.Fatalf("Want BadStateError from BucketFileExists() for missing bucket, got %v", err)
+	}
+	if err := fssc.WriteBucketFile(cloud.RawVideoBucketName, writeLocalFile(t, "data"), "video.mp4"); !errors.As(err, &bse) {
+		t.Fatalf("Want BadStateError from WriteBucketFile() for missing bucket, got %v", err)
+	}
+
+	if err := fssc.CreateBucket(cloud.RawVideoBucketName); err != nil {
+		t.Fatalf("CreateBucket() returns err: %v", err)
+	}
+	if exists, err := fssc.BucketExists(cloud.RawVideoBucketName); err != nil || !exists {
+		t.Fatalf("Want bucket to exist after CreateBucket(), got %t, %v", exists, err)
+	}
+}
+
+func TestWriteGetDeleteBucketFile(t *testing.T) {
+	fssc := newTestClient(t)
+	if err := fssc.CreateBucket(cloud.RawVideoBucketName); err != nil {
+		t.Fatalf("CreateBucket() returns err: %v", err)
+	}
+
+	localFile := writeLocalFile(t, "video data")
+	if err := fssc.WriteBucketFile(cloud.RawVideoBucketName, localFile, "user.123.RAW_VIDEO.mp4"); err != nil {
+		t.Fatalf("WriteBucketFile() returns err: %v", err)
+	}
+	if _, err := os.Stat(localFile); !os.IsNotExist(err) {
+		t.Fatalf("Want local file removed after WriteBucketFile(), got %v", err)
+	}
+
+	exists, err := fssc.BucketFileExists(cloud.RawVideoBucketName, "user.123.RAW_VIDEO.mp4")
+	if err != nil {
+		t.Fatalf("BucketFileExists() returns err: %v", err)
+	}
+	if !exists {
+		t.Fatalf("Want bucket file to exist after WriteBucketFile()")
+	}
+
+	tempPath, err := fssc.GetBucketFile(cloud.RawVideoBucketName, "user.123.RAW_VIDEO.mp4")
+	if err != nil {
+		t.Fatalf("GetBucketFile() returns err: %v", err)
+	}
+	defer os.Remove(tempPath)
+	if !strings.HasSuffix(tempPath, ".mp4") {
+		t.Fatalf("Want temp file with .mp4 extension, got %q", tempPath)
+	}
+	contents, err := ioutil.ReadFile(tempPath)
+	if err != nil {
+		t.Fatalf("ReadFile() returns err: %v", err)
+	}
+	if string(contents) != "video data" {
+		t.Fatalf("Want contents %q, got %q", "video data", contents)
+	}
+
+	if err := fssc.DeleteBucketFile(cloud.RawVideoBucketName, "user.123.RAW_VIDEO.mp4"); err != nil {
+		t.Fatalf("DeleteBucketFile() returns err: %v", err)
+	}
+
+	var nfe *senecaerror.NotFoundError
+	if _, err := fssc.GetBucketFile(cloud.RawVideoBucketName, "user.123.RAW_VIDEO.mp4"); !errors.As(err, &nfe) {
+		t.Fatalf("Want NotFoundError from GetBucketFile() for deleted file, got %v", err)
+	}
+	if err := fssc.DeleteBucketFile(cloud.RawVideoBucketName, "user.123.RAW_VIDEO.mp4"); !errors.As(err, &nfe) {
+		t.Fatalf("Want NotFoundError from DeleteBucketFile() for deleted file, got %v", err)
+	}
+}
+
+func TestRejectsPathTraversal(t *testing.T) {
+	fssc := newTestClient(t)
+	if err := fssc.CreateBucket(cloud.RawFrameBucketName); err != nil {
+		t.Fatalf("CreateBucket() returns err: %v", err)
+	}
+
+	var bse *senecaerror.BadStateError
+	for _, name := range []string{"", "../escape.png", "a/../../escape.png", ".."} {
+		if _, err := fssc.BucketFileExists(cloud.RawFrameBucketName, name); !errors.As(err, &bse) {
+			t.Fatalf("Want BadStateError from BucketFileExists(%q), got %v", name, err)
+		}
+	}
+}
+
+func TestLocalPath(t *testing.T) {
+	fssc := newTestClient(t)
+
+	path, err := fssc.LocalPath("gs://raw_videos/user.123.RAW_VIDEO.mp4")
+	if err != nil {
+		t.Fatalf("LocalPath() returns err: %v", err)
+	}
+	want := filepath.Join(fssc.rootDir, cloud.RawVideoBucketName.String(), "user.123.RAW_VIDEO.mp4")
+	if path != want {
+		t.Fatalf("Want path %q, got %q", want, path)
+	}
+
+	if _, err := fssc.LocalPath("https://example.com/video.mp4"); err == nil {
+		t.Fatalf("Want err from LocalPath() for non-GCS URL, got nil")
+	}
+}
+
+func TestStreamingWriterAndRangeReader(t *testing.T) {
+	fssc := newTestClient(t)
+	if err := fssc.CreateBucket(cloud.RawVideoBucketName); err != nil {
+		t.Fatalf("CreateBucket() returns err: %v", err)
+	}
+
+	w, err := fssc.NewBucketFileWriter(cloud.RawVideoBucketName, "user.123.RAW_VIDEO.mp4")
+	if err != nil {
+		t.Fatalf("NewBucketFileWriter() returns err: %v", err)
+	}
+	if _, err := w.Write([]byte("0123456789")); err != nil {
+		t.Fatalf("Write() returns err: %v", err)
+	}
+	if exists, err := fssc.BucketFileExists(cloud.RawVideoBucketName, "user.123.RAW_VIDEO.mp4"); err != nil || exists {
+		t.Fatalf("Want bucket file to not exist before Close(), got %t, %v", exists, err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() returns err: %v", err)
+	}
+
+	for _, tc := range []struct {
+		offset int64
+		length int64
+		want   string
+	}{
+		{0, -1, "0123456789"},
+		{2, 3, "234"},
+		{8, 100, "89"},
+		{10, -1, ""},
+	} {
+		rc, err := fssc.NewBucketFileRangeReader(cloud.RawVideoBucketName, "user.123.RAW_VIDEO.mp4", tc.offset, tc.length)
+		if err != nil {
+			t.Fatalf("NewBucketFileRangeReader(%d, %d) returns err: %v", tc.offset, tc.length, err)
+		}
+		got, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("ReadAll() returns err: %v", err)
+		}
+		if string(got) != tc.want {
+			t.Fatalf("Want %q for range (%d, %d), got %q", tc.want, tc.offset, tc.length, got)
+		}
+	}
+
+	// An aborted write leaves the existing file untouched.
+	w, err = fssc.NewBucketFileWriter(cloud.RawVideoBucketName, "user.123.RAW_VIDEO.mp4")
+	if err != nil {
+		t.Fatalf("NewBucketFileWriter() returns err: %v", err)
+	}
+	if _, err := w.Write([]byte("truncated")); err != nil {
+		t.Fatalf("Write() returns err: %v", err)
+	}
+	w.Abort()
+	rc, err := fssc.NewBucketFileReader(cloud.RawVideoBucketName, "user.123.RAW_VIDEO.mp4")
+	if err != nil {
+		t.Fatalf("NewBucketFileReader() returns err: %v", err)
+	}
+	got, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil || string(got) != "0123456789" {
+		t.Fatalf("Want the file written before to survive Abort(), got %q, err %v", got, err)
+	}
+
+	var bse *senecaerror.BadStateError
+	if _, err := fssc.NewBucketFileRangeReader(cloud.RawVideoBucketName, "user.123.RAW_VIDEO.mp4", 11, -1); !errors.As(err, &bse) {
+		t.Fatalf("Want BadStateError from NewBucketFileRangeReader() past the end of the file, got %v", err)
+	}
+	var nfe *senecaerror.NotFoundError
+	if _, err := fssc.NewBucketFileReader(cloud.RawVideoBucketName, "missing.mp4"); !errors.As(err, &nfe) {
+		t.Fatalf("Want NotFoundError from NewBucketFileReader() for missing file, got %v", err)
+	}
+}
+
+func TestSignedURL(t *testing.T) {
+	fssc := newTestClient(t)
+	if err := fssc.CreateBucket(cloud.RawVideoBucketName); err != nil {
+		t.Fatalf("CreateBucket() returns err: %v", err)
+	}
+	if err := fssc.WriteBucketFile(cloud.RawVideoBucketName, writeLocalFile(t, "0123456789"), "user.123.RAW_VIDEO.mp4"); err != nil {
+		t.Fatalf("WriteBucketFile() returns err: %v", err)
+	}
+
+	signedURL, err := fssc.SignedURL(cloud.RawVideoBucketName, "user.123.RAW_VIDEO.mp4", time.Minute)
+	if err != nil {
+		t.Fatalf("SignedURL() returns err: %v", err)
+	}
+	if !strings.HasPrefix(signedURL, "http://localhost/downloads/raw_videos/user.123.RAW_VIDEO.mp4?") {
+		t.Fatalf("Want signed URL under the base URL, got %q", signedURL)
+	}
+
+	serve := func(target string, header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		for k, v := range header {
+			r.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		fssc.ServeSignedURL(w, r)
+		return w
+	}
+
+	if w := serve(signedURL, nil); w.Code != http.StatusOK || w.Body.String() != "0123456789" {
+		t.Fatalf("Want 200 with the file from the signed URL, got %d %q", w.Code, w.Body.String())
+	}
+	if w := serve(signedURL, http.Header{"Range": []string{"bytes=2-4"}}); w.Code != http.StatusPartialContent || w.Body.String() != "234" {
+		t.Fatalf("Want 206 with bytes 2-4 from the signed URL, got %d %q", w.Code, w.Body.String())
+	}
+
+	parsedURL, _ := url.Parse(signedURL)
+	query := parsedURL.Query()
+
+	tampered := *parsedURL
+	tampered.Path = "/downloads/raw_videos/other.mp4"
+	if w := serve(tampered.String(), nil); w.Code != http.StatusForbidden {
+		t.Fatalf("Want 403 for a signature of another file, got %d", w.Code)
+	}
+
+	query.Set("expires", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+	tampered = *parsedURL
+	tampered.RawQuery = query.Encode()
+	if w := serve(tampered.String(), nil); w.Code != http.StatusForbidden {
+		t.Fatalf("Want 403 for an extended expiry, got %d", w.Code)
+	}
+
+	expiredURL, err := fssc.SignedURL(cloud.RawVideoBucketName, "user.123.RAW_VIDEO.mp4", time.Nanosecond)
+	if err != nil {
+		t.Fatalf("SignedURL() returns err: %v", err)
+	}
+	time.Sleep(time.Second)
+	if w := serve(expiredURL, nil); w.Code != http.StatusForbidden {
+		t.Fatalf("Want 403 for an expired URL, got %d", w.Code)
+	}
+
+	var de *senecaerror.DevError
+	if _, err := fssc.SignedURL(cloud.RawVideoBucketName, "user.123.RAW_VIDEO.mp4", cloud.MaxSignedURLExpiry+time.Second); !errors.As(err, &de) {
+		t.Fatalf("Want DevError from SignedURL() for expiry over the max, got %v", err)
+	}
+}
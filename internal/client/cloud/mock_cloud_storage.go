@@ -2,6 +2,8 @@ package cloud
 
 import (
 	"fmt"
+	"io"
+	"time"
 )
 
 // FakeSimpleStorageClient implements a fake SimpleStorageInterface for testing.
@@ -15,6 +17,12 @@ type FakeSimpleStorageClient struct {
 	WriteBucketFileMock  func(bucketName BucketName, localFileNameAndPath, bucketFileName string) error
 	GetBucketFileMock    func(bucketName BucketName, bucketFileName string) (string, error)
 	DeleteBucketFileMock func(bucketName BucketName, bucketFileName string) error
+	URLSchemeMock        func() URLScheme
+
+	NewBucketFileWriterMock      func(bucketName BucketName, bucketFileName string) (BucketFileWriter, error)
+	NewBucketFileReaderMock      func(bucketName BucketName, bucketFileName string) (io.ReadCloser, error)
+	NewBucketFileRangeReaderMock func(bucketName BucketName, bucketFileName string, offset, length int64) (io.ReadCloser, error)
+	SignedURLMock                func(bucketName BucketName, bucketFileName string, expiry time.Duration) (string, error)
 }
 
 // NewFakeSimpleStorageClient returns an instance of FakeSimpleStorageClient.
@@ -71,3 +79,43 @@ func (fssc *FakeSimpleStorageClient) DeleteBucketFile(bucketName BucketName, buc
 	}
 	return fssc.DeleteBucketFileMock(bucketName, bucketFileName)
 }
+
+// NewBucketFileWriter returns the writer from NewBucketFileWriterMock.
+func (fssc *FakeSimpleStorageClient) NewBucketFileWriter(bucketName BucketName, bucketFileName string) (BucketFileWriter, error) {
+	if fssc.NewBucketFileWriterMock == nil {
+		return nil, fmt.Errorf("NewBucketFileWriterMock not set")
+	}
+	return fssc.NewBucketFileWriterMock(bucketName, bucketFileName)
+}
+
+// NewBucketFileReader returns the reader from NewBucketFileReaderMock.
+func (fssc *FakeSimpleStorageClient) NewBucketFileReader(bucketName BucketName, bucketFileName string) (io.ReadCloser, error) {
+	if fssc.NewBucketFileReaderMock == nil {
+		return nil, fmt.Errorf("NewBucketFileReaderMock not set")
+	}
+	return fssc.NewBucketFileReaderMock(bucketName, bucketFileName)
+}
+
+// NewBucketFileRangeReader returns the reader from NewBucketFileRangeReaderMock.
+func (fssc *FakeSimpleStorageClient) NewBucketFileRangeReader(bucketName BucketName, bucketFileName string, offset, length int64) (io.ReadCloser, error) {
+	if fssc.NewBucketFileRangeReaderMock == nil {
+		return nil, fmt.Errorf("NewBucketFileRangeReaderMock not set")
+	}
+	return fssc.NewBucketFileRangeReaderMock(bucketName, bucketFileName, offset, length)
+}
+
+// SignedURL returns the URL from SignedURLMock.
+func (fssc *FakeSimpleStorageClient) SignedURL(bucketName BucketName, bucketFileName string, expiry time.Duration) (string, error) {
+	if fssc.SignedURLMock == nil {
+		return "", fmt.Errorf("SignedURLMock not set")
+	}
+	return fssc.SignedURLMock(bucketName, bucketFileName, expiry)
+}
+
+// URLScheme returns GCSURLScheme unless URLSchemeMock is set.
+func (fssc *FakeSimpleStorageClient) URLScheme() URLScheme {
+	if fssc.URLSchemeMock == nil {
+		return GCSURLScheme
+	}
+	return fssc.URLSchemeMock()
+}
@@ -0,0 +1,24 @@
+package cloud
+
+import (
+	"time"
+)
+
+const (
+	// MaxSignedURLExpiry is the longest a signed URL may be valid for, which is the limit for GCS V4 signatures.
+	MaxSignedURLExpiry = time.Hour * 24 * 7
+)
+
+// SignedURLInterface is implemented by storage that can grant time limited HTTP access to its files,
+// for clients that can't read them directly.
+type SignedURLInterface interface {
+	// SignedURL returns an HTTP URL that can be used to GET the file until it expires.
+	// Params:
+	// 		bucketName BucketName: the name of the bucket
+	//		bucketFileName string: the name of the file
+	//		expiry time.Duration: how long the URL is valid for, at most MaxSignedURLExpiry
+	// Returns:
+	//		string: the signed URL
+	//		error
+	SignedURL(bucketName BucketName, bucketFileName string, expiry time.Duration) (string, error)
+}
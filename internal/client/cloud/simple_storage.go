@@ -2,6 +2,7 @@ package cloud
 
 import (
 	"fmt"
+	"io"
 	"strings"
 )
 
@@ -13,9 +14,11 @@ const (
 	RawVideoBucketName BucketName = "raw_videos"
 	// RawVideoBucketName defines the bucket used for directories of raw frames.
 	RawFrameBucketName BucketName = "raw_frames"
+	// RawTelemetryBucketName defines the bucket used for uploaded GPS logs.
+	RawTelemetryBucketName BucketName = "raw_telemetry"
 )
 
-var Bucketnames = []BucketName{RawVideoBucketName, RawFrameBucketName}
+var Bucketnames = []BucketName{RawVideoBucketName, RawFrameBucketName, RawTelemetryBucketName}
 
 func (bn BucketName) String() string {
 	return string(bn)
@@ -25,15 +28,74 @@ func (bn BucketName) RealName(projectID string) string {
 	return fmt.Sprintf("%s-%s", projectID, string(bn))
 }
 
+// RealNameForScheme returns the name of the bucket in the storage system the scheme refers to.
+// S3 bucket names may not contain underscores, so they are replaced with hyphens.
+func (bn BucketName) RealNameForScheme(scheme URLScheme, projectID string) string {
+	if scheme == S3URLScheme {
+		return strings.ReplaceAll(strings.ToLower(bn.RealName(projectID)), "_", "-")
+	}
+	return bn.RealName(projectID)
+}
+
+// ParseBucketName parses the BucketName out of a bare or real bucket name, for any URLScheme.
 func ParseBucketName(potentialBucketName string) (BucketName, error) {
 	for _, bname := range Bucketnames {
-		if strings.HasSuffix(potentialBucketName, bname.String()) {
+		if strings.HasSuffix(potentialBucketName, bname.String()) || strings.HasSuffix(potentialBucketName, strings.ReplaceAll(bname.String(), "_", "-")) {
 			return bname, nil
 		}
 	}
 	return "", fmt.Errorf("%q is not a bucket name", potentialBucketName)
 }
 
+// URLScheme is the scheme of the URLs stored in CloudStorageFileName fields, which identifies
+// the storage system holding the file.
+type URLScheme string
+
+const (
+	// GCSURLScheme is used for files in Google Cloud Storage.
+	GCSURLScheme URLScheme = "gs"
+	// S3URLScheme is used for files in S3 compatible storage.
+	S3URLScheme URLScheme = "s3"
+	// FileURLScheme is used for files on the local file system.
+	FileURLScheme URLScheme = "file"
+)
+
+var URLSchemes = []URLScheme{GCSURLScheme, S3URLScheme, FileURLScheme}
+
+func (us URLScheme) String() string {
+	return string(us)
+}
+
+// BucketFileURL formats the URL for the file in the bucket, like gs://bucket/file.
+func (us URLScheme) BucketFileURL(bucket, bucketFileName string) string {
+	return fmt.Sprintf("%s://%s/%s", us, bucket, bucketFileName)
+}
+
+// ParseBucketFileURL splits a URL formatted with BucketFileURL into its scheme, BucketName and file name.
+func ParseBucketFileURL(url string) (URLScheme, BucketName, string, error) {
+	for _, scheme := range URLSchemes {
+		prefix := fmt.Sprintf("%s://", scheme)
+		if !strings.HasPrefix(url, prefix) {
+			continue
+		}
+
+		urlParts := strings.Split(strings.TrimPrefix(url, prefix), "/")
+		bucketName, err := ParseBucketName(urlParts[0])
+		if err != nil {
+			return "", "", "", fmt.Errorf("%q is not a bucket file URL: %w", url, err)
+		}
+		return scheme, bucketName, strings.Join(urlParts[1:], "/"), nil
+	}
+	return "", "", "", fmt.Errorf("%q is not a bucket file URL", url)
+}
+
+// BucketFileWriter streams a file to a bucket.  The file is committed by Close, or discarded by Abort.
+type BucketFileWriter interface {
+	io.WriteCloser
+	// Abort discards everything written so far without committing the file.  The writer can't be used afterwards.
+	Abort()
+}
+
 // SimpleStorageInterface is the interface used for interacting with
 // S3 like files across Seneca.
 type SimpleStorageInterface interface {
@@ -75,4 +137,35 @@ type SimpleStorageInterface interface {
 	//		error
 	GetBucketFile(bucketName BucketName, bucketFileName string) (string, error)
 	DeleteBucketFile(bucketName BucketName, bucketFileName string) error
+	// NewBucketFileWriter opens a writer streaming to the file with the bucketFileName in the given bucket.
+	// The file is only committed when the writer is closed without error, writers that fail must be aborted.
+	// Params:
+	// 		bucketName BucketName: the name of the bucket
+	//		bucketFileName string: the name of the file
+	// Returns:
+	//		BucketFileWriter: the writer, which must be closed or aborted
+	//		error
+	NewBucketFileWriter(bucketName BucketName, bucketFileName string) (BucketFileWriter, error)
+	// NewBucketFileReader opens a reader streaming the file with the bucketFileName from the given bucket.
+	// Params:
+	// 		bucketName BucketName: the name of the bucket
+	//		bucketFileName string: the name of the file
+	// Returns:
+	//		io.ReadCloser: the reader, which must be closed
+	//		error
+	NewBucketFileReader(bucketName BucketName, bucketFileName string) (io.ReadCloser, error)
+	// NewBucketFileRangeReader opens a reader streaming length bytes of the file starting at offset.
+	// Params:
+	// 		bucketName BucketName: the name of the bucket
+	//		bucketFileName string: the name of the file
+	//		offset int64: the first byte to read
+	//		length int64: the number of bytes to read, negative to read until the end of the file
+	// Returns:
+	//		io.ReadCloser: the reader, which must be closed
+	//		error
+	NewBucketFileRangeReader(bucketName BucketName, bucketFileName string, offset, length int64) (io.ReadCloser, error)
+	// URLScheme returns the scheme used in URLs for files in this storage.
+	// Returns:
+	//		URLScheme
+	URLScheme() URLScheme
 }
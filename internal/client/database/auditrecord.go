@@ -0,0 +1,58 @@
+package database
+
+import (
+	"fmt"
+	"seneca/api/constants"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// The Actions of AuditRecords.
+const (
+	CreateAction = "create"
+	UpdateAction = "update"
+	DeleteAction = "delete"
+	// PurgeAction is the Action of records of tombstones that were purged, see Tombstone.
+	PurgeAction = "purge"
+)
+
+// 	AuditRecord is stored in constants.AuditTable, one per recorded change to the data.  The table is append-only,
+// 	so records are never updated, and Id is only set on records that were read.
+type AuditRecord struct {
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// TimestampMs is when the change was made.
+	TimestampMs int64 `protobuf:"varint,2,opt,name=timestamp_ms,proto3" json:"timestamp_ms,omitempty"`
+	// Actor is who made the change, e.g. "user:1234", "algo:00001" or "system:reaper".
+	Actor string `protobuf:"bytes,3,opt,name=actor,proto3" json:"actor,omitempty"`
+	// Action is what was done, e.g. "update".
+	Action    string `protobuf:"bytes,4,opt,name=action,proto3" json:"action,omitempty"`
+	TableName string `protobuf:"bytes,5,opt,name=table_name,proto3" json:"table_name,omitempty"`
+	ObjectId  string `protobuf:"bytes,6,opt,name=object_id,proto3" json:"object_id,omitempty"`
+	// UserId is the user whose data was changed.
+	UserId string `protobuf:"bytes,7,opt,name=user_id,proto3" json:"user_id,omitempty"`
+	// Details describes the change in free form.  It isn't indexed, since Datastore only indexes short values.
+	Details string `protobuf:"bytes,8,opt,name=details,proto3" json:"details,omitempty" datastore:",noindex"`
+	// Before and After are JSON objects of the fields that changed, with their values before and after the change.
+	// Before is empty for created objects, and After is empty for deleted objects.
+	Before string `protobuf:"bytes,9,opt,name=before,proto3" json:"before,omitempty" datastore:",noindex"`
+	After  string `protobuf:"bytes,10,opt,name=after,proto3" json:"after,omitempty" datastore:",noindex"`
+}
+
+func (m *AuditRecord) Reset()         { *m = AuditRecord{} }
+func (m *AuditRecord) String() string { return proto.CompactTextString(m) }
+func (*AuditRecord) ProtoMessage()    {}
+
+//	CreateAuditRecord appends the record to constants.AuditTable.
+//	Params:
+//		sql SQLInterface: may be a transaction, so that the record is only written with the change it describes
+//		record *AuditRecord
+//	Returns:
+//		string: the ID of the record
+//		error
+func CreateAuditRecord(sql SQLInterface, record *AuditRecord) (string, error) {
+	id, err := sql.Create(constants.AuditTable, record)
+	if err != nil {
+		return "", fmt.Errorf("error creating audit record: %w", err)
+	}
+	return id, nil
+}
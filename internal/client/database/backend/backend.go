@@ -0,0 +1,47 @@
+// Package backend initializes the database backend the binaries are configured with.
+package backend
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"seneca/internal/client/cloud/gcp/datastore"
+	"seneca/internal/client/database"
+	"seneca/internal/client/database/boltdb"
+	"seneca/internal/client/database/postgres"
+)
+
+// Config chooses the database backend, usually from the --database, --postgres_dsn and --bolt_path flags.
+type Config struct {
+	// Backend is one of [datastore, postgres, bolt].  Datastore uses the project in GOOGLE_CLOUD_PROJECT.
+	Backend     string
+	PostgresDSN string
+	BoltPath    string
+}
+
+//	New initializes the database backend chosen by config.
+//	Params:
+//		ctx context.Context
+//		config Config
+//	Returns:
+//		database.SQLInterface
+//		error
+func New(ctx context.Context, config Config) (database.SQLInterface, error) {
+	switch config.Backend {
+	case "datastore":
+		projectID := os.Getenv("GOOGLE_CLOUD_PROJECT")
+		if projectID == "" {
+			return nil, fmt.Errorf("GOOGLE_CLOUD_PROJECT environment variable must be set when --database=datastore")
+		}
+		return datastore.New(ctx, projectID)
+	case "postgres":
+		if config.PostgresDSN == "" {
+			return nil, fmt.Errorf("--postgres_dsn must be set when --database=postgres")
+		}
+		return postgres.New(ctx, config.PostgresDSN)
+	case "bolt":
+		return boltdb.New(config.BoltPath)
+	default:
+		return nil, fmt.Errorf("unsupported --database %q", config.Backend)
+	}
+}
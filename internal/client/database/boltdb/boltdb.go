@@ -0,0 +1,528 @@
+// Package boltdb implements database.SQLInterface on a single local bbolt file, for deployments without any cloud dependencies.
+package boltdb
+
+import (
+	"context"
+	"fmt"
+	"seneca/api/constants"
+	"seneca/api/senecaerror"
+	"seneca/internal/client/database"
+	"strconv"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// openTimeOut is how long to wait for the file lock held by another process.
+	openTimeOut = time.Second * 5
+)
+
+// 	Service implements database.SQLInterface with bbolt.  Each table is stored in its own bucket,
+// 	keyed by ID, with serialized protos as values.
+type Service struct {
+	db *bolt.DB
+	// tx is set on the Service passed to RunInTransaction() callbacks, all of its calls go through it.
+	tx *bolt.Tx
+}
+
+// 	New opens (or creates) the database file at the given path and creates a bucket for each constants.TableName.
+//	Params:
+//		path string: path to the database file
+//	Returns:
+//		*boltdb.Service
+//		senecaerror.ServerError
+func New(path string) (*Service, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: openTimeOut})
+	if err != nil {
+		return nil, senecaerror.NewServerError(fmt.Errorf("error opening bolt database at %q - err: %w", path, err))
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		for _, tableName := range append(constants.DataTableNames, constants.MetadataTableNames...) {
+			if _, err := tx.CreateBucketIfNotExists([]byte(tableName.String())); err != nil {
+				return fmt.Errorf("error creating bucket for table %q - err: %w", tableName, err)
+			}
+		}
+		return nil
+	}); err != nil {
+		db.Close()
+		return nil, senecaerror.NewServerError(err)
+	}
+
+	return &Service{
+		db: db,
+	}, nil
+}
+
+// 	Close releases the database file.
+func (s *Service) Close() error {
+	return s.db.Close()
+}
+
+// 	ListIDs lists the IDs of the objects that satisfy the query.  Every object in the table is scanned.
+//	Params:
+//		tableName constants.TableName
+//		queryParams []*database.QueryParam: the parameters for the query to execute
+//	Returns:
+//		[]string: the list of IDs
+//		senecaerror.DevError, senecaerror.BadStateError
+func (s *Service) ListIDs(tableName constants.TableName, queryParams []*database.QueryParam) ([]string, error) {
+	ids := []string{}
+	err := s.view(func(tx *bolt.Tx) error {
+		bucket, err := getBucket(tx, tableName)
+		if err != nil {
+			return err
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			object, err := unmarshal(tableName, v)
+			if err != nil {
+				return fmt.Errorf("error reading object with ID %q: %w", k, err)
+			}
+
+			satisfied, err := database.SatisfiesQueryParams(object, queryParams)
+			if err != nil {
+				return err
+			}
+			if satisfied {
+				ids = append(ids, string(k))
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing IDs in table %q: %w", tableName, err)
+	}
+
+	return ids, nil
+}
+
+// 	ListIDsByQuery lists one page of the IDs that satisfy the query.  Every object in the table is scanned
+// 	and the query is applied in memory, cursors are offsets into the ordered results.
+//	Params:
+//		query *database.Query
+//	Returns:
+//		[]string: the IDs in the page
+//		string: the cursor of the next page, "" if this is the last one
+//		senecaerror.DevError, senecaerror.BadStateError, senecaerror.UserError
+func (s *Service) ListIDsByQuery(query *database.Query) ([]string, string, error) {
+	if err := query.Validate(); err != nil {
+		return nil, "", err
+	}
+
+	ids := []string{}
+	objects := []interface{}{}
+	err := s.view(func(tx *bolt.Tx) error {
+		bucket, err := getBucket(tx, query.TableName)
+		if err != nil {
+			return err
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			object, err := unmarshal(query.TableName, v)
+			if err != nil {
+				return fmt.Errorf("error reading object with ID %q: %w", k, err)
+			}
+			ids = append(ids, string(k))
+			objects = append(objects, object)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("error querying table %q: %w", query.TableName, err)
+	}
+
+	return database.ApplyQuery(query, ids, objects)
+}
+
+//	GetByID gets the object with the given id from the table with the given tableName.
+//	Params:
+//		tableName constants.TableName
+//		id string
+//	Returns:
+//		interface{}: the untyped object
+//		senecaerror.DevError, senecaerror.BadStateError, senecaerror.NotFoundError
+func (s *Service) GetByID(tableName constants.TableName, id string) (interface{}, error) {
+	var object interface{}
+	err := s.view(func(tx *bolt.Tx) error {
+		bucket, err := getBucket(tx, tableName)
+		if err != nil {
+			return err
+		}
+
+		data := bucket.Get([]byte(id))
+		if data == nil {
+			return senecaerror.NewNotFoundError(fmt.Errorf("object with ID %q not found in table %q", id, tableName))
+		}
+
+		object, err = unmarshal(tableName, data)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting object with ID %q from table %q: %w", id, tableName, err)
+	}
+
+	return object, nil
+}
+
+//	GetByIDs gets the objects with the given ids from the table, in one read transaction.
+//	Params:
+//		tableName constants.TableName
+//		ids []string
+//	Returns:
+//		[]interface{}: the untyped objects, in the same order as ids
+//		senecaerror.DevError, senecaerror.BadStateError, senecaerror.NotFoundError
+func (s *Service) GetByIDs(tableName constants.TableName, ids []string) ([]interface{}, error) {
+	objects := []interface{}{}
+	err := s.view(func(tx *bolt.Tx) error {
+		bucket, err := getBucket(tx, tableName)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			data := bucket.Get([]byte(id))
+			if data == nil {
+				return senecaerror.NewNotFoundError(fmt.Errorf("object with ID %q not found in table %q", id, tableName))
+			}
+
+			object, err := unmarshal(tableName, data)
+			if err != nil {
+				return err
+			}
+			objects = append(objects, object)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting %d objects from table %q: %w", len(ids), tableName, err)
+	}
+
+	return objects, nil
+}
+
+//	Create inserts the object into the table with a newly generated ID.
+//	Params:
+//		tableName constants.TableName
+//		object interface{}
+//	Returns:
+//		string: the new ID
+//		senecaerror.DevError, senecaerror.ServerError
+func (s *Service) Create(tableName constants.TableName, object interface{}) (string, error) {
+	data, err := marshal(object)
+	if err != nil {
+		return "", err
+	}
+
+	id := ""
+	err = s.update(func(tx *bolt.Tx) error {
+		bucket, err := getBucket(tx, tableName)
+		if err != nil {
+			return err
+		}
+
+		id, err = put(bucket, data)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("error creating %v in table %q: %w", object, tableName, err)
+	}
+
+	return id, nil
+}
+
+//	Insert overwrites the object with the given ID.
+//	Params:
+//		tableName constants.TableName
+//		id string
+//		object interface{}
+//	Returns:
+//		senecaerror.DevError, senecaerror.NotFoundError
+func (s *Service) Insert(tableName constants.TableName, id string, object interface{}) error {
+	data, err := marshal(object)
+	if err != nil {
+		return err
+	}
+
+	err = s.update(func(tx *bolt.Tx) error {
+		bucket, err := getBucket(tx, tableName)
+		if err != nil {
+			return err
+		}
+
+		return replace(bucket, tableName, id, data)
+	})
+	if err != nil {
+		return fmt.Errorf("error putting %v with id %q for table %q: %w", object, id, tableName, err)
+	}
+
+	return nil
+}
+
+//	DeleteByID deletes the object with the given ID.
+//	Params:
+//		tableName constants.TableName
+//		id string
+//	Returns:
+//		senecaerror.DevError, senecaerror.NotFoundError
+func (s *Service) DeleteByID(tableName constants.TableName, id string) error {
+	err := s.update(func(tx *bolt.Tx) error {
+		bucket, err := getBucket(tx, tableName)
+		if err != nil {
+			return err
+		}
+
+		return remove(bucket, tableName, id)
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting object with ID %q from table %q: %w", id, tableName, err)
+	}
+
+	return nil
+}
+
+//	CreateMulti inserts the objects into the table with newly generated IDs, all in one bbolt transaction.
+//	Params:
+//		tableName constants.TableName
+//		objects []interface{}
+//	Returns:
+//		[]string: the new IDs, in the same order as objects
+//		senecaerror.DevError, senecaerror.ServerError
+func (s *Service) CreateMulti(tableName constants.TableName, objects []interface{}) ([]string, error) {
+	datas := [][]byte{}
+	for _, object := range objects {
+		data, err := marshal(object)
+		if err != nil {
+			return nil, err
+		}
+		datas = append(datas, data)
+	}
+
+	ids := []string{}
+	err := s.update(func(tx *bolt.Tx) error {
+		bucket, err := getBucket(tx, tableName)
+		if err != nil {
+			return err
+		}
+
+		for _, data := range datas {
+			id, err := put(bucket, data)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating %d objects in table %q: %w", len(objects), tableName, err)
+	}
+
+	return ids, nil
+}
+
+//	Put writes the object with the given ID, creating it if it doesn't exist yet.  The bucket's sequence isn't
+//	advanced, so IDs chosen by the caller may later collide with ones from Create().
+//	Params:
+//		tableName constants.TableName
+//		id string: an integer, like the IDs from Create()
+//		object interface{}
+//	Returns:
+//		senecaerror.DevError
+func (s *Service) Put(tableName constants.TableName, id string, object interface{}) error {
+	if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+		return senecaerror.NewDevError(fmt.Errorf("ID %q for table %q isn't an integer", id, tableName))
+	}
+	data, err := marshal(object)
+	if err != nil {
+		return err
+	}
+
+	err = s.update(func(tx *bolt.Tx) error {
+		bucket, err := getBucket(tx, tableName)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(id), data)
+	})
+	if err != nil {
+		return fmt.Errorf("error putting %v with id %q for table %q: %w", object, id, tableName, err)
+	}
+	return nil
+}
+
+//	InsertMulti overwrites the objects with the given IDs, all in one bbolt transaction.
+//	Params:
+//		tableName constants.TableName
+//		ids []string
+//		objects []interface{}: objects[i] is written to ids[i]
+//	Returns:
+//		senecaerror.DevError, senecaerror.NotFoundError
+func (s *Service) InsertMulti(tableName constants.TableName, ids []string, objects []interface{}) error {
+	if len(ids) != len(objects) {
+		return senecaerror.NewDevError(fmt.Errorf("got %d ids for %d objects", len(ids), len(objects)))
+	}
+
+	datas := [][]byte{}
+	for _, object := range objects {
+		data, err := marshal(object)
+		if err != nil {
+			return err
+		}
+		datas = append(datas, data)
+	}
+
+	err := s.update(func(tx *bolt.Tx) error {
+		bucket, err := getBucket(tx, tableName)
+		if err != nil {
+			return err
+		}
+
+		for i, id := range ids {
+			if err := replace(bucket, tableName, id, datas[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error putting %d objects in table %q: %w", len(objects), tableName, err)
+	}
+
+	return nil
+}
+
+//	DeleteMulti deletes the objects with the given IDs, all in one bbolt transaction.
+//	Params:
+//		tableName constants.TableName
+//		ids []string
+//	Returns:
+//		senecaerror.DevError, senecaerror.NotFoundError
+func (s *Service) DeleteMulti(tableName constants.TableName, ids []string) error {
+	err := s.update(func(tx *bolt.Tx) error {
+		bucket, err := getBucket(tx, tableName)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			if err := remove(bucket, tableName, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting %d objects from table %q: %w", len(ids), tableName, err)
+	}
+
+	return nil
+}
+
+//	RunInTransaction runs f in one read-write bbolt transaction.  bbolt allows a single writer at a time,
+//	so f blocks every other write until it returns and should only do database work.
+//	Params:
+//		ctx context.Context: checked before committing, a canceled ctx rolls back
+//		f func(tx database.SQLInterface) error
+//	Returns:
+//		error: the error from f, or senecaerror.ServerError if committing fails
+func (s *Service) RunInTransaction(ctx context.Context, f func(tx database.SQLInterface) error) error {
+	if s.tx != nil {
+		return f(s)
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := f(&Service{db: s.db, tx: tx}); err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return senecaerror.NewServerError(fmt.Errorf("rolling back transaction - err: %w", err))
+		}
+		return nil
+	})
+}
+
+// view runs fn in the open transaction, or in a new read-only one.
+func (s *Service) view(fn func(tx *bolt.Tx) error) error {
+	if s.tx != nil {
+		return fn(s.tx)
+	}
+	return s.db.View(fn)
+}
+
+// update runs fn in the open transaction, or in a new read-write one.
+func (s *Service) update(fn func(tx *bolt.Tx) error) error {
+	if s.tx != nil {
+		return fn(s.tx)
+	}
+	return s.db.Update(fn)
+}
+
+// put stores the data under the bucket's next sequence number and returns it as the ID.
+func put(bucket *bolt.Bucket, data []byte) (string, error) {
+	sequence, err := bucket.NextSequence()
+	if err != nil {
+		return "", senecaerror.NewServerError(fmt.Errorf("error generating ID - err: %w", err))
+	}
+	id := strconv.FormatUint(sequence, 10)
+
+	if err := bucket.Put([]byte(id), data); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func replace(bucket *bolt.Bucket, tableName constants.TableName, id string, data []byte) error {
+	if bucket.Get([]byte(id)) == nil {
+		return senecaerror.NewNotFoundError(fmt.Errorf("object with ID %q not found in table %q", id, tableName))
+	}
+	return bucket.Put([]byte(id), data)
+}
+
+func remove(bucket *bolt.Bucket, tableName constants.TableName, id string) error {
+	if bucket.Get([]byte(id)) == nil {
+		return senecaerror.NewNotFoundError(fmt.Errorf("object with ID %q not found in table %q", id, tableName))
+	}
+	return bucket.Delete([]byte(id))
+}
+
+func getBucket(tx *bolt.Tx, tableName constants.TableName) (*bolt.Bucket, error) {
+	bucket := tx.Bucket([]byte(tableName.String()))
+	if bucket == nil {
+		return nil, senecaerror.NewDevError(fmt.Errorf("no bucket for table %q", tableName))
+	}
+	return bucket, nil
+}
+
+func marshal(object interface{}) ([]byte, error) {
+	message, ok := object.(proto.Message)
+	if !ok {
+		return nil, senecaerror.NewDevError(fmt.Errorf("object of type %T is not a proto.Message", object))
+	}
+
+	data, err := proto.Marshal(message)
+	if err != nil {
+		return nil, senecaerror.NewDevError(fmt.Errorf("error marshalling %v - err: %w", object, err))
+	}
+	return data, nil
+}
+
+func unmarshal(tableName constants.TableName, data []byte) (interface{}, error) {
+	object, err := database.NewObjectForTable(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	message, ok := object.(proto.Message)
+	if !ok {
+		return nil, senecaerror.NewDevError(fmt.Errorf("object of type %T for table %q is not a proto.Message", object, tableName))
+	}
+
+	if err := proto.Unmarshal(data, message); err != nil {
+		return nil, senecaerror.NewBadStateError(fmt.Errorf("error unmarshalling object for table %q - err: %w", tableName, err))
+	}
+
+	return message, nil
+}
@@ -0,0 +1,291 @@
+package boltdb_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"seneca/api/constants"
+	"seneca/api/senecaerror"
+	st "seneca/api/type"
+	"seneca/internal/client/database"
+	"seneca/internal/client/database/boltdb"
+	"seneca/internal/client/logging"
+	"seneca/internal/dao/rawmotiondao"
+	"seneca/internal/util"
+	"seneca/test/testutil"
+	"sort"
+	"testing"
+	"time"
+)
+
+var createTime = time.Date(1996, time.May, 23, 0, 0, 0, 0, time.UTC)
+
+func TestCRUD(t *testing.T) {
+	service, err := boltdb.New(filepath.Join(t.TempDir(), "seneca.db"))
+	if err != nil {
+		t.Fatalf("New() returns err: %v", err)
+	}
+	defer service.Close()
+
+	var nfe *senecaerror.NotFoundError
+	if _, err := service.GetByID(constants.UsersTable, "1"); !errors.As(err, &nfe) {
+		t.Fatalf("Want NotFoundError from GetByID() for non-existant ID, got %v", err)
+	}
+	if err := service.Insert(constants.UsersTable, "1", &st.User{}); !errors.As(err, &nfe) {
+		t.Fatalf("Want NotFoundError from Insert() for non-existant ID, got %v", err)
+	}
+
+	id, err := service.Create(constants.UsersTable, &st.User{Email: "lucaloncar@seneca.ai"})
+	if err != nil {
+		t.Fatalf("Create() returns err: %v", err)
+	}
+
+	// Put() creates objects with IDs chosen by the caller.
+	if err := service.Put(constants.UsersTable, "123456789", &st.User{Email: "put@seneca.ai"}); err != nil {
+		t.Fatalf("Put() for a new ID returns err: %v", err)
+	}
+	if putObj, err := service.GetByID(constants.UsersTable, "123456789"); err != nil || putObj.(*st.User).Email != "put@seneca.ai" {
+		t.Fatalf("Want the user from Put(), got %v, %v", putObj, err)
+	}
+	if err := service.DeleteByID(constants.UsersTable, "123456789"); err != nil {
+		t.Fatalf("DeleteByID() returns err: %v", err)
+	}
+
+	if err := service.Insert(constants.UsersTable, id, &st.User{Id: id, Email: "lucaloncar@seneca.ai"}); err != nil {
+		t.Fatalf("Insert() returns err: %v", err)
+	}
+
+	userObj, err := service.GetByID(constants.UsersTable, id)
+	if err != nil {
+		t.Fatalf("GetByID() returns err: %v", err)
+	}
+	user, ok := userObj.(*st.User)
+	if !ok {
+		t.Fatalf("Want *st.User, got %T", userObj)
+	}
+	if user.Id != id || user.Email != "lucaloncar@seneca.ai" {
+		t.Fatalf("Unexpected user %v", user)
+	}
+
+	otherID, err := service.Create(constants.UsersTable, &st.User{Email: "other@seneca.ai"})
+	if err != nil {
+		t.Fatalf("Create() returns err: %v", err)
+	}
+	userObjs, err := service.GetByIDs(constants.UsersTable, []string{otherID, id})
+	if err != nil {
+		t.Fatalf("GetByIDs() returns err: %v", err)
+	}
+	if len(userObjs) != 2 || userObjs[0].(*st.User).Email != "other@seneca.ai" || userObjs[1].(*st.User).Id != id {
+		t.Fatalf("Want users %q and %q in order, got %v", otherID, id, userObjs)
+	}
+	if _, err := service.GetByIDs(constants.UsersTable, []string{id, "12345"}); !errors.As(err, &nfe) {
+		t.Fatalf("Want NotFoundError from GetByIDs() with a non-existant ID, got %v", err)
+	}
+	if err := service.DeleteByID(constants.UsersTable, otherID); err != nil {
+		t.Fatalf("DeleteByID() returns err: %v", err)
+	}
+
+	ids, err := service.ListIDs(constants.UsersTable, []*database.QueryParam{{FieldName: constants.EmailFieldName, Operand: "=", Value: "lucaloncar@seneca.ai"}})
+	if err != nil {
+		t.Fatalf("ListIDs() returns err: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != id {
+		t.Fatalf("Want IDs [%s], got %v", id, ids)
+	}
+
+	if err := service.DeleteByID(constants.UsersTable, id); err != nil {
+		t.Fatalf("DeleteByID() returns err: %v", err)
+	}
+	if err := service.DeleteByID(constants.UsersTable, id); !errors.As(err, &nfe) {
+		t.Fatalf("Want NotFoundError from DeleteByID() for deleted ID, got %v", err)
+	}
+
+	var devErr *senecaerror.DevError
+	if _, err := service.ListIDs(constants.UsersTable, []*database.QueryParam{{FieldName: constants.TimestampFieldName, Operand: "=", Value: int64(0)}}); err != nil {
+		// No users left, so the bad field is never evaluated.
+		t.Fatalf("ListIDs() on empty table returns err: %v", err)
+	}
+	if _, err := service.Create(constants.UsersTable, &st.User{}); err != nil {
+		t.Fatalf("Create() returns err: %v", err)
+	}
+	if _, err := service.ListIDs(constants.UsersTable, []*database.QueryParam{{FieldName: constants.TimestampFieldName, Operand: "=", Value: int64(0)}}); !errors.As(err, &devErr) {
+		t.Fatalf("Want DevError from ListIDs() for field User doesn't have, got %v", err)
+	}
+}
+
+func TestQueryOperands(t *testing.T) {
+	service, err := boltdb.New(filepath.Join(t.TempDir(), "seneca.db"))
+	if err != nil {
+		t.Fatalf("New() returns err: %v", err)
+	}
+	defer service.Close()
+
+	timestamps := map[string]int64{}
+	for i := int64(0); i < 5; i++ {
+		id, err := service.Create(constants.RawMotionsTable, &st.RawMotion{UserId: testutil.TestUserID, TimestampMs: i})
+		if err != nil {
+			t.Fatalf("Create() returns err: %v", err)
+		}
+		timestamps[id] = i
+	}
+
+	for _, tc := range []struct {
+		operand string
+		value   int64
+		want    int
+	}{
+		{"=", 2, 1},
+		{"<", 2, 2},
+		{"<=", 2, 3},
+		{">", 2, 2},
+		{">=", 2, 3},
+	} {
+		ids, err := service.ListIDs(constants.RawMotionsTable, []*database.QueryParam{
+			{FieldName: constants.UserIDFieldName, Operand: "=", Value: testutil.TestUserID},
+			{FieldName: constants.TimestampFieldName, Operand: tc.operand, Value: tc.value},
+		})
+		if err != nil {
+			t.Fatalf("ListIDs(TimestampMs %s %d) returns err: %v", tc.operand, tc.value, err)
+		}
+		if len(ids) != tc.want {
+			t.Fatalf("Want %d IDs for TimestampMs %s %d, got %d", tc.want, tc.operand, tc.value, len(ids))
+		}
+	}
+}
+
+func TestPersistsAcrossRestartsWithDAO(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seneca.db")
+	logger := logging.NewLocalLogger(true)
+
+	service, err := boltdb.New(path)
+	if err != nil {
+		t.Fatalf("New() returns err: %v", err)
+	}
+
+	rawMotionDAO := rawmotiondao.NewSQLRawMotionDAO(service, logger)
+	wantIDs := []string{}
+	for i := 0; i < 3; i++ {
+		rawMotion, err := rawMotionDAO.InsertUniqueRawMotion(&st.RawMotion{
+			UserId:      testutil.TestUserID,
+			TimestampMs: util.TimeToMilliseconds(createTime) + int64(i),
+		})
+		if err != nil {
+			t.Fatalf("InsertUniqueRawMotion() returns err: %v", err)
+		}
+		wantIDs = append(wantIDs, rawMotion.Id)
+	}
+
+	if err := service.Close(); err != nil {
+		t.Fatalf("Close() returns err: %v", err)
+	}
+
+	service, err = boltdb.New(path)
+	if err != nil {
+		t.Fatalf("New() after restart returns err: %v", err)
+	}
+	defer service.Close()
+
+	rawMotionDAO = rawmotiondao.NewSQLRawMotionDAO(service, logger)
+	gotIDs, err := rawMotionDAO.ListUnprocessedRawMotionIDs(testutil.TestUserID, 0.01)
+	if err != nil {
+		t.Fatalf("ListUnprocessedRawMotionIDs() returns err: %v", err)
+	}
+
+	sort.Strings(gotIDs)
+	sort.Strings(wantIDs)
+	if len(gotIDs) != len(wantIDs) {
+		t.Fatalf("Want IDs %v after restart, got %v", wantIDs, gotIDs)
+	}
+	for i := range wantIDs {
+		if wantIDs[i] != gotIDs[i] {
+			t.Fatalf("Want IDs %v after restart, got %v", wantIDs, gotIDs)
+		}
+	}
+
+	if _, err := rawMotionDAO.InsertUniqueRawMotion(&st.RawMotion{UserId: testutil.TestUserID, TimestampMs: util.TimeToMilliseconds(createTime)}); err == nil {
+		t.Fatalf("Want err from InsertUniqueRawMotion() for duplicate after restart, got nil")
+	}
+}
+
+func TestMultiAndTransactions(t *testing.T) {
+	service, err := boltdb.New(filepath.Join(t.TempDir(), "seneca.db"))
+	if err != nil {
+		t.Fatalf("New() returns err: %v", err)
+	}
+	defer service.Close()
+
+	ids, err := service.CreateMulti(constants.UsersTable, []interface{}{&st.User{Email: "a@seneca.ai"}, &st.User{Email: "b@seneca.ai"}})
+	if err != nil {
+		t.Fatalf("CreateMulti() returns err: %v", err)
+	}
+	if len(ids) != 2 || ids[0] == ids[1] {
+		t.Fatalf("Want 2 distinct IDs from CreateMulti(), got %v", ids)
+	}
+
+	var nfe *senecaerror.NotFoundError
+	if err := service.InsertMulti(constants.UsersTable, []string{ids[0], "missing"}, []interface{}{&st.User{Email: "changed@seneca.ai"}, &st.User{}}); !errors.As(err, &nfe) {
+		t.Fatalf("Want NotFoundError from InsertMulti() with a missing ID, got %v", err)
+	}
+	if err := service.DeleteMulti(constants.UsersTable, []string{ids[1], "missing"}); !errors.As(err, &nfe) {
+		t.Fatalf("Want NotFoundError from DeleteMulti() with a missing ID, got %v", err)
+	}
+	userObj, err := service.GetByID(constants.UsersTable, ids[0])
+	if err != nil {
+		t.Fatalf("GetByID() returns err: %v", err)
+	}
+	if email := userObj.(*st.User).Email; email != "a@seneca.ai" {
+		t.Fatalf("Want failed InsertMulti() to write nothing, got email %q", email)
+	}
+	if _, err := service.GetByID(constants.UsersTable, ids[1]); err != nil {
+		t.Fatalf("Want failed DeleteMulti() to delete nothing, got %v", err)
+	}
+
+	err = service.RunInTransaction(context.Background(), func(tx database.SQLInterface) error {
+		if _, err := tx.Create(constants.UsersTable, &st.User{Email: "c@seneca.ai"}); err != nil {
+			return err
+		}
+		if err := tx.DeleteMulti(constants.UsersTable, ids); err != nil {
+			return err
+		}
+		// Reads in the transaction see its own writes.
+		txIDs, err := tx.ListIDs(constants.UsersTable, nil)
+		if err != nil {
+			return err
+		}
+		if len(txIDs) != 1 {
+			t.Fatalf("Want 1 user in the transaction, got %v", txIDs)
+		}
+		return fmt.Errorf("roll back")
+	})
+	if err == nil {
+		t.Fatalf("Want err from RunInTransaction(), got nil")
+	}
+	if allIDs, err := service.ListIDs(constants.UsersTable, nil); err != nil || len(allIDs) != 2 {
+		t.Fatalf("Want the 2 original users after rollback, got %v, %v", allIDs, err)
+	}
+
+	err = service.RunInTransaction(context.Background(), func(tx database.SQLInterface) error {
+		return tx.RunInTransaction(context.Background(), func(nested database.SQLInterface) error {
+			return nested.DeleteMulti(constants.UsersTable, ids)
+		})
+	})
+	if err != nil {
+		t.Fatalf("RunInTransaction() returns err: %v", err)
+	}
+	if allIDs, err := service.ListIDs(constants.UsersTable, nil); err != nil || len(allIDs) != 0 {
+		t.Fatalf("Want no users after committed delete, got %v, %v", allIDs, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := service.RunInTransaction(ctx, func(tx database.SQLInterface) error {
+		_, err := tx.Create(constants.UsersTable, &st.User{})
+		return err
+	}); err == nil {
+		t.Fatalf("Want err from RunInTransaction() with canceled context, got nil")
+	}
+	if allIDs, err := service.ListIDs(constants.UsersTable, nil); err != nil || len(allIDs) != 0 {
+		t.Fatalf("Want no users after canceled transaction, got %v, %v", allIDs, err)
+	}
+}
@@ -1,16 +1,38 @@
 package database
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"seneca/api/constants"
+	"seneca/api/senecaerror"
 	"time"
 )
 
 type SQLInterface interface {
 	ListIDs(tableName constants.TableName, queryParams []*QueryParam) ([]string, error)
+	// ListIDsByQuery lists one page of the IDs that satisfy the query, and the cursor of the next page,
+	// which is "" if there are no more results.
+	ListIDsByQuery(query *Query) ([]string, string, error)
 	GetByID(tableName constants.TableName, id string) (interface{}, error)
+	// GetByIDs gets the objects with the given IDs, in the same order, and fails if any of them doesn't exist.
+	GetByIDs(tableName constants.TableName, ids []string) ([]interface{}, error)
 	Create(tableName constants.TableName, object interface{}) (string, error)
 	Insert(tableName constants.TableName, id string, object interface{}) error
+	// Put writes the object with the given ID whether or not it exists yet, for objects whose IDs are derived from
+	// what they're about, e.g. Leases.  The ID must be an integer.
+	Put(tableName constants.TableName, id string, object interface{}) error
 	DeleteByID(tableName constants.TableName, id string) error
+	// CreateMulti, InsertMulti and DeleteMulti are all-or-nothing within a transaction.  Outside of one, backends that
+	// limit the size of a commit, like Datastore's 500 entities, write large batches in several commits, so a failure
+	// may leave the earlier ones written.
+	CreateMulti(tableName constants.TableName, objects []interface{}) ([]string, error)
+	InsertMulti(tableName constants.TableName, ids []string, objects []interface{}) error
+	DeleteMulti(tableName constants.TableName, ids []string) error
+	// RunInTransaction calls f with an SQLInterface whose writes are committed together if f returns nil,
+	// and rolled back if it returns an error.  f may be retried, so it must not have side effects outside of tx.
+	// Calling RunInTransaction on tx runs f in the same transaction.
+	RunInTransaction(ctx context.Context, f func(tx SQLInterface) error) error
 }
 
 type QueryParam struct {
@@ -33,3 +55,36 @@ func GenerateTimeOffsetParams(fieldName constants.SenecaTypeFieldName, createTim
 		},
 	}
 }
+
+//	GetExisting gets the objects with the given IDs, with nil for the ones that don't exist.  GetByIDs fails if any
+//	object is missing, so then they're gotten one at a time to find which.
+//	Params:
+//		sql SQLInterface
+//		tableName constants.TableName
+//		ids []string
+//	Returns:
+//		[]interface{}: the objects in the same order as ids
+//		error
+func GetExisting(sql SQLInterface, tableName constants.TableName, ids []string) ([]interface{}, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	objects, err := sql.GetByIDs(tableName, ids)
+	var nfe *senecaerror.NotFoundError
+	if err == nil {
+		return objects, nil
+	}
+	if !errors.As(err, &nfe) {
+		return nil, fmt.Errorf("error getting %d objects from table %q: %w", len(ids), tableName, err)
+	}
+
+	objects = make([]interface{}, len(ids))
+	for i, id := range ids {
+		object, err := sql.GetByID(tableName, id)
+		if err != nil && !errors.As(err, &nfe) {
+			return nil, fmt.Errorf("error getting object %q from table %q: %w", id, tableName, err)
+		}
+		objects[i] = object
+	}
+	return objects, nil
+}
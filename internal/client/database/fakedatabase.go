@@ -1,12 +1,16 @@
 package database
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"seneca/api/constants"
+	"seneca/api/senecaerror"
 	st "seneca/api/type"
 	"strings"
 	"time"
+
+	"github.com/golang/protobuf/proto"
 )
 
 type FakeSQLDBService struct {
@@ -16,6 +20,8 @@ type FakeSQLDBService struct {
 	// no error will be induced, if true, error will be induced.
 	// See existing code for usage.
 	ErrorCalls chan bool
+	// RoundTrips counts the calls that would each be a round trip to a real database.
+	RoundTrips int
 }
 
 func NewFake() *FakeSQLDBService {
@@ -25,12 +31,21 @@ func NewFake() *FakeSQLDBService {
 	}
 }
 
-func (fs *FakeSQLDBService) ListIDs(tableName constants.TableName, queryParams []*QueryParam) ([]string, error) {
+// roundTrip counts a call, and induces an error if ErrorCalls says so.
+func (fs *FakeSQLDBService) roundTrip() error {
+	fs.RoundTrips++
 	if fs.ErrorCalls != nil {
 		if <-fs.ErrorCalls {
-			return nil, fmt.Errorf("errorMode")
+			return fmt.Errorf("errorMode")
 		}
 	}
+	return nil
+}
+
+func (fs *FakeSQLDBService) ListIDs(tableName constants.TableName, queryParams []*QueryParam) ([]string, error) {
+	if err := fs.roundTrip(); err != nil {
+		return nil, err
+	}
 
 	ids := []string{}
 	for k, v := range fs.data {
@@ -45,11 +60,29 @@ func (fs *FakeSQLDBService) ListIDs(tableName constants.TableName, queryParams [
 	return ids, nil
 }
 
-func (fs *FakeSQLDBService) GetByID(tableName constants.TableName, id string) (interface{}, error) {
-	if fs.ErrorCalls != nil {
-		if <-fs.ErrorCalls {
-			return nil, fmt.Errorf("errorMode")
+func (fs *FakeSQLDBService) ListIDsByQuery(query *Query) ([]string, string, error) {
+	if err := fs.roundTrip(); err != nil {
+		return nil, "", err
+	}
+
+	ids := []string{}
+	objects := []interface{}{}
+	for k, v := range fs.data {
+		keyParts := strings.Split(k, "/")
+		if len(keyParts) != 2 {
+			log.Fatalf("Got %d key parts in FakeSQLDBService, must have 2", len(keyParts))
 		}
+		if keyParts[0] == query.TableName.String() {
+			ids = append(ids, keyParts[1])
+			objects = append(objects, v)
+		}
+	}
+	return ApplyQuery(query, ids, objects)
+}
+
+func (fs *FakeSQLDBService) GetByID(tableName constants.TableName, id string) (interface{}, error) {
+	if err := fs.roundTrip(); err != nil {
+		return nil, err
 	}
 
 	key := fmt.Sprintf("%s/%s", tableName.String(), id)
@@ -107,30 +140,95 @@ func (fs *FakeSQLDBService) GetByID(tableName constants.TableName, id string) (i
 			log.Fatalf("got object of type %T for key %q", obj, key)
 		}
 		return out, nil
+	case constants.MigrationsTable:
+		out, ok := obj.(*MigrationRecord)
+		if !ok {
+			log.Fatalf("got object of type %T for key %q", obj, key)
+		}
+		return out, nil
+	case constants.TombstonesTable:
+		out, ok := obj.(*Tombstone)
+		if !ok {
+			log.Fatalf("got object of type %T for key %q", obj, key)
+		}
+		return out, nil
+	case constants.AuditTable:
+		out, ok := obj.(*AuditRecord)
+		if !ok {
+			log.Fatalf("got object of type %T for key %q", obj, key)
+		}
+		return out, nil
+	case constants.LeasesTable:
+		out, ok := obj.(*Lease)
+		if !ok {
+			log.Fatalf("got object of type %T for key %q", obj, key)
+		}
+		return out, nil
+	case constants.JobsTable:
+		out, ok := obj.(*Job)
+		if !ok {
+			log.Fatalf("got object of type %T for key %q", obj, key)
+		}
+		return out, nil
+	case constants.RawTelemetryFilesTable:
+		out, ok := obj.(*RawTelemetryFile)
+		if !ok {
+			log.Fatalf("got object of type %T for key %q", obj, key)
+		}
+		return out, nil
+	case constants.RawVehicleSignalsTable:
+		out, ok := obj.(*RawVehicleSignal)
+		if !ok {
+			log.Fatalf("got object of type %T for key %q", obj, key)
+		}
+		return out, nil
 	default:
 		log.Fatalf("Invalid tableName %q", tableName)
 	}
 	return nil, nil
 }
 
-func (fs *FakeSQLDBService) Create(tableName constants.TableName, object interface{}) (string, error) {
-	if fs.ErrorCalls != nil {
-		if <-fs.ErrorCalls {
-			return "", fmt.Errorf("errorMode")
+func (fs *FakeSQLDBService) GetByIDs(tableName constants.TableName, ids []string) ([]interface{}, error) {
+	if err := fs.roundTrip(); err != nil {
+		return nil, err
+	}
+
+	objects := []interface{}{}
+	for _, id := range ids {
+		obj, ok := fs.data[fmt.Sprintf("%s/%s", tableName.String(), id)]
+		if !ok {
+			return nil, senecaerror.NewNotFoundError(fmt.Errorf("object with ID %q not found in table %q", id, tableName))
 		}
+		objects = append(objects, obj)
 	}
+	return objects, nil
+}
 
-	newID := fmt.Sprintf("%d", time.Now().UnixNano())
+func (fs *FakeSQLDBService) Create(tableName constants.TableName, object interface{}) (string, error) {
+	if err := fs.roundTrip(); err != nil {
+		return "", err
+	}
+
+	newID := fs.newID(tableName)
 	key := fmt.Sprintf("%s/%s", tableName.String(), newID)
 	fs.data[key] = object
 	return newID, nil
 }
 
-func (fs *FakeSQLDBService) Insert(tableName constants.TableName, id string, object interface{}) error {
-	if fs.ErrorCalls != nil {
-		if <-fs.ErrorCalls {
-			return fmt.Errorf("errorMode")
+// newID returns an ID that isn't taken yet in the table, even when called several times in the same nanosecond.
+func (fs *FakeSQLDBService) newID(tableName constants.TableName) string {
+	id := time.Now().UnixNano()
+	for {
+		if _, ok := fs.data[fmt.Sprintf("%s/%d", tableName.String(), id)]; !ok {
+			return fmt.Sprintf("%d", id)
 		}
+		id++
+	}
+}
+
+func (fs *FakeSQLDBService) Insert(tableName constants.TableName, id string, object interface{}) error {
+	if err := fs.roundTrip(); err != nil {
+		return err
 	}
 
 	key := fmt.Sprintf("%s/%s", tableName.String(), id)
@@ -141,11 +239,18 @@ func (fs *FakeSQLDBService) Insert(tableName constants.TableName, id string, obj
 	return nil
 }
 
+func (fs *FakeSQLDBService) Put(tableName constants.TableName, id string, object interface{}) error {
+	if err := fs.roundTrip(); err != nil {
+		return err
+	}
+
+	fs.data[fmt.Sprintf("%s/%s", tableName.String(), id)] = object
+	return nil
+}
+
 func (fs *FakeSQLDBService) DeleteByID(tableName constants.TableName, id string) error {
-	if fs.ErrorCalls != nil {
-		if <-fs.ErrorCalls {
-			return fmt.Errorf("errorMode")
-		}
+	if err := fs.roundTrip(); err != nil {
+		return err
 	}
 
 	key := fmt.Sprintf("%s/%s", tableName.String(), id)
@@ -156,6 +261,76 @@ func (fs *FakeSQLDBService) DeleteByID(tableName constants.TableName, id string)
 	return nil
 }
 
+func (fs *FakeSQLDBService) CreateMulti(tableName constants.TableName, objects []interface{}) ([]string, error) {
+	if err := fs.roundTrip(); err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	for _, object := range objects {
+		newID := fs.newID(tableName)
+		fs.data[fmt.Sprintf("%s/%s", tableName.String(), newID)] = object
+		ids = append(ids, newID)
+	}
+	return ids, nil
+}
+
+func (fs *FakeSQLDBService) InsertMulti(tableName constants.TableName, ids []string, objects []interface{}) error {
+	if err := fs.roundTrip(); err != nil {
+		return err
+	}
+
+	if len(ids) != len(objects) {
+		return fmt.Errorf("got %d ids for %d objects", len(ids), len(objects))
+	}
+	for _, id := range ids {
+		key := fmt.Sprintf("%s/%s", tableName.String(), id)
+		if _, ok := fs.data[key]; !ok {
+			return fmt.Errorf("no value for key %q", key)
+		}
+	}
+	for i, id := range ids {
+		fs.data[fmt.Sprintf("%s/%s", tableName.String(), id)] = objects[i]
+	}
+	return nil
+}
+
+func (fs *FakeSQLDBService) DeleteMulti(tableName constants.TableName, ids []string) error {
+	if err := fs.roundTrip(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		key := fmt.Sprintf("%s/%s", tableName.String(), id)
+		if _, ok := fs.data[key]; !ok {
+			return fmt.Errorf("no value for key %q", key)
+		}
+	}
+	for _, id := range ids {
+		delete(fs.data, fmt.Sprintf("%s/%s", tableName.String(), id))
+	}
+	return nil
+}
+
+// RunInTransaction snapshots the data and restores it if f returns an error.  It doesn't consume ErrorCalls,
+// only the calls made inside f do.
+func (fs *FakeSQLDBService) RunInTransaction(ctx context.Context, f func(tx SQLInterface) error) error {
+	// The fake hands out the stored pointers, so objects are copied in case f modifies them in place.
+	snapshot := map[string]interface{}{}
+	for k, v := range fs.data {
+		if message, ok := v.(proto.Message); ok {
+			v = proto.Clone(message)
+		}
+		snapshot[k] = v
+	}
+
+	if err := f(fs); err != nil {
+		fs.data = snapshot
+		return err
+	}
+	return nil
+}
+
 func satisfiesQueryParams(tableName constants.TableName, object interface{}, queryParams []*QueryParam) bool {
 	for _, qp := range queryParams {
 		evaluateResult := func() bool {
@@ -176,6 +351,12 @@ func satisfiesQueryParams(tableName constants.TableName, object interface{}, que
 				return evaluateOperand(getEventField(qp.FieldName, object), qp.Value, qp.Operand)
 			case constants.DrivingConditionTable:
 				return evaluateOperand(getDrivingConditionField(qp.FieldName, object), qp.Value, qp.Operand)
+			case constants.TombstonesTable, constants.AuditTable, constants.LeasesTable, constants.JobsTable, constants.RawTelemetryFilesTable, constants.RawVehicleSignalsTable:
+				satisfied, err := SatisfiesQueryParams(object, []*QueryParam{qp})
+				if err != nil {
+					log.Fatalf("satisfiesQueryParams() returns err: %v", err)
+				}
+				return satisfied
 			default:
 				log.Fatalf("satisfiesQueryParams() not yet implemented for table %q", tableName)
 			}
@@ -0,0 +1,38 @@
+package database
+
+import (
+	"github.com/golang/protobuf/proto"
+)
+
+// 	Job is a unit of background work stored in constants.JobsTable by jobqueue, e.g. processing one raw video,
+// 	so that work that was queued or running survives restarts.
+type Job struct {
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// Type selects the handler that runs the job, e.g. "ProcessRawVideo".
+	Type string `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	// UserId is the user the job works on, if any.
+	UserId string `protobuf:"bytes,3,opt,name=user_id,proto3" json:"user_id,omitempty"`
+	// Payload is the job's JSON encoded parameters.
+	Payload     string `protobuf:"bytes,4,opt,name=payload,proto3" json:"payload,omitempty" datastore:",noindex"`
+	State       string `protobuf:"bytes,5,opt,name=state,proto3" json:"state,omitempty"`
+	Attempts    int64  `protobuf:"varint,6,opt,name=attempts,proto3" json:"attempts,omitempty"`
+	MaxAttempts int64  `protobuf:"varint,7,opt,name=max_attempts,proto3" json:"max_attempts,omitempty"`
+	// CreateTimeMs is when the job was enqueued.
+	CreateTimeMs int64 `protobuf:"varint,8,opt,name=create_time_ms,proto3" json:"create_time_ms,omitempty"`
+	// StartTimeMs is when the job's first attempt started.
+	StartTimeMs int64 `protobuf:"varint,9,opt,name=start_time_ms,proto3" json:"start_time_ms,omitempty"`
+	// EndTimeMs is when the job succeeded or was dead-lettered.
+	EndTimeMs int64 `protobuf:"varint,10,opt,name=end_time_ms,proto3" json:"end_time_ms,omitempty"`
+	// TimestampMs is when the job is next dequeued: when it's enqueued, when its backoff after a failure ends,
+	// or when the visibility timeout of its running attempt expires.  It's 0 once the job has ended.  It's
+	// stored in the timestamp field because that's indexed by every backend.
+	TimestampMs int64 `protobuf:"varint,11,opt,name=timestamp_ms,proto3" json:"timestamp_ms,omitempty"`
+	// LastError is the error of the latest failed attempt.
+	LastError string `protobuf:"bytes,12,opt,name=last_error,proto3" json:"last_error,omitempty" datastore:",noindex"`
+	// Result is what the handler returned for the latest attempt.
+	Result string `protobuf:"bytes,13,opt,name=result,proto3" json:"result,omitempty" datastore:",noindex"`
+}
+
+func (m *Job) Reset()         { *m = Job{} }
+func (m *Job) String() string { return proto.CompactTextString(m) }
+func (*Job) ProtoMessage()    {}
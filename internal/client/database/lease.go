@@ -0,0 +1,164 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"seneca/api/constants"
+	"seneca/api/senecaerror"
+	"seneca/internal/util"
+	"strconv"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// 	Lease is stored in constants.LeasesTable while a holder, e.g. one run of the runner, works on a user's data,
+// 	so that no other holder works on it under the same name at the same time.  Leases expire unless renewed, so
+// 	the data isn't locked forever by a holder that crashed.
+type Lease struct {
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// Name is what the lease is for, e.g. "runner".
+	Name   string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	UserId string `protobuf:"bytes,3,opt,name=user_id,proto3" json:"user_id,omitempty"`
+	// Holder identifies who holds the lease.
+	Holder       string `protobuf:"bytes,4,opt,name=holder,proto3" json:"holder,omitempty"`
+	ExpireTimeMs int64  `protobuf:"varint,5,opt,name=expire_time_ms,proto3" json:"expire_time_ms,omitempty"`
+}
+
+func (m *Lease) Reset()         { *m = Lease{} }
+func (m *Lease) String() string { return proto.CompactTextString(m) }
+func (*Lease) ProtoMessage()    {}
+
+func (m *Lease) heldBy(holder string, now time.Time) bool {
+	return m.Holder == holder || m.ExpireTimeMs <= util.TimeToMilliseconds(now)
+}
+
+//	AcquireLease acquires the user's lease with the given name for holder, unless another holder has it.
+//	Expired leases are taken over.  The lease is read and written in one transaction under an ID derived from
+//	name and userID, so holders acquiring it at the same time conflict, and only one of them gets it.
+//	Params:
+//		ctx context.Context
+//		sql SQLInterface
+//		name string
+//		userID string
+//		holder string
+//		now time.Time
+//		ttl time.Duration: how long the lease lasts unless renewed
+//	Returns:
+//		*Lease: nil if another holder has the lease
+//		error
+func AcquireLease(ctx context.Context, sql SQLInterface, name, userID, holder string, now time.Time, ttl time.Duration) (*Lease, error) {
+	id := leaseID(name, userID)
+	var acquired *Lease
+	err := sql.RunInTransaction(ctx, func(tx SQLInterface) error {
+		acquired = nil
+		lease, err := getLease(tx, id)
+		if err != nil {
+			return err
+		}
+		if lease != nil && (lease.Name != name || lease.UserId != userID) {
+			return senecaerror.NewBadStateError(fmt.Errorf("lease %q is %q of user %q, not %q of user %q", id, lease.Name, lease.UserId, name, userID))
+		}
+		if lease != nil && !lease.heldBy(holder, now) {
+			return nil
+		}
+
+		lease = &Lease{
+			Id:           id,
+			Name:         name,
+			UserId:       userID,
+			Holder:       holder,
+			ExpireTimeMs: util.TimeToMilliseconds(now.Add(ttl)),
+		}
+		if err := tx.Put(constants.LeasesTable, id, lease); err != nil {
+			return fmt.Errorf("error putting lease %q: %w", id, err)
+		}
+		acquired = lease
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return acquired, nil
+}
+
+//	RenewLease extends the lease to ttl from now.
+//	Params:
+//		ctx context.Context
+//		sql SQLInterface
+//		lease *Lease: as returned by AcquireLease, it's updated
+//		now time.Time
+//		ttl time.Duration
+//	Returns:
+//		senecaerror.BadStateError: if the lease expired and was taken over, or was deleted
+//		error
+func RenewLease(ctx context.Context, sql SQLInterface, lease *Lease, now time.Time, ttl time.Duration) error {
+	return sql.RunInTransaction(ctx, func(tx SQLInterface) error {
+		stored, err := getLease(tx, lease.Id)
+		if err != nil {
+			return err
+		}
+		if stored == nil || stored.Holder != lease.Holder {
+			return senecaerror.NewBadStateError(fmt.Errorf("lease %q of user %q was lost by %q", lease.Id, lease.UserId, lease.Holder))
+		}
+		stored.ExpireTimeMs = util.TimeToMilliseconds(now.Add(ttl))
+		if err := tx.Insert(constants.LeasesTable, stored.Id, stored); err != nil {
+			return fmt.Errorf("error updating lease %q: %w", stored.Id, err)
+		}
+		lease.ExpireTimeMs = stored.ExpireTimeMs
+		return nil
+	})
+}
+
+//	ReleaseLease deletes the lease, unless it was taken over by another holder.
+//	Params:
+//		ctx context.Context
+//		sql SQLInterface
+//		lease *Lease: as returned by AcquireLease
+//	Returns:
+//		error
+func ReleaseLease(ctx context.Context, sql SQLInterface, lease *Lease) error {
+	return sql.RunInTransaction(ctx, func(tx SQLInterface) error {
+		stored, err := getLease(tx, lease.Id)
+		if err != nil || stored == nil || stored.Holder != lease.Holder {
+			return err
+		}
+		if err := tx.DeleteByID(constants.LeasesTable, lease.Id); err != nil {
+			return fmt.Errorf("error deleting lease %q: %w", lease.Id, err)
+		}
+		return nil
+	})
+}
+
+// getLease gets the lease with its Id set, or nil if it doesn't exist.
+func getLease(sql SQLInterface, id string) (*Lease, error) {
+	object, err := sql.GetByID(constants.LeasesTable, id)
+	var nfe *senecaerror.NotFoundError
+	if err != nil && !errors.As(err, &nfe) {
+		return nil, fmt.Errorf("error getting lease %q: %w", id, err)
+	}
+	stored, ok := object.(*Lease)
+	if !ok || stored == nil {
+		return nil, nil
+	}
+	// Some backends hand out the stored object, so it's copied before it's modified.
+	lease := *stored
+	lease.Id = id
+	return &lease, nil
+}
+
+// leaseID derives the ID of the user's lease with the given name.  IDs are positive integers on every backend.
+func leaseID(name, userID string) string {
+	hash := fnv.New64a()
+	hash.Write([]byte(name))
+	hash.Write([]byte{0})
+	hash.Write([]byte(userID))
+	id := hash.Sum64() & math.MaxInt64
+	if id == 0 {
+		id = 1
+	}
+	return strconv.FormatUint(id, 10)
+}
@@ -0,0 +1,23 @@
+package database
+
+import "github.com/golang/protobuf/proto"
+
+// 	MigrationRecord is stored in constants.MigrationsTable, one per migration that has been started.
+// 	It's a hand-written proto message so that every backend can store it like the seneca_type messages.
+type MigrationRecord struct {
+	Id      string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Version int64  `protobuf:"varint,2,opt,name=version,proto3" json:"version,omitempty"`
+	Name    string `protobuf:"bytes,3,opt,name=name,proto3" json:"name,omitempty"`
+	// StartTimeMs is when the migration was first started.
+	StartTimeMs int64 `protobuf:"varint,4,opt,name=start_time_ms,proto3" json:"start_time_ms,omitempty"`
+	// CompleteTimeMs is when the migration finished, 0 while it hasn't.
+	CompleteTimeMs int64 `protobuf:"varint,5,opt,name=complete_time_ms,proto3" json:"complete_time_ms,omitempty"`
+	// Cursor is where a migration that was interrupted resumes.
+	Cursor          string `protobuf:"bytes,6,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	ObjectsScanned  int64  `protobuf:"varint,7,opt,name=objects_scanned,proto3" json:"objects_scanned,omitempty"`
+	ObjectsMigrated int64  `protobuf:"varint,8,opt,name=objects_migrated,proto3" json:"objects_migrated,omitempty"`
+}
+
+func (m *MigrationRecord) Reset()         { *m = MigrationRecord{} }
+func (m *MigrationRecord) String() string { return proto.CompactTextString(m) }
+func (*MigrationRecord) ProtoMessage()    {}
@@ -0,0 +1,216 @@
+package database
+
+import (
+	"fmt"
+	"reflect"
+	"seneca/api/constants"
+	"seneca/api/senecaerror"
+	st "seneca/api/type"
+	"strings"
+)
+
+//	NewObjectForTable returns an empty object of the type stored in the given table.
+//	Params:
+//		tableName constants.TableName
+//	Returns:
+//		interface{}: a pointer to the empty object
+//		senecaerror.DevError
+func NewObjectForTable(tableName constants.TableName) (interface{}, error) {
+	switch tableName {
+	case constants.UsersTable:
+		return &st.User{}, nil
+	case constants.RawVideosTable:
+		return &st.RawVideo{}, nil
+	case constants.RawLocationsTable:
+		return &st.RawLocation{}, nil
+	case constants.RawFramesTable:
+		return &st.RawFrame{}, nil
+	case constants.RawMotionsTable:
+		return &st.RawMotion{}, nil
+	case constants.RawTelemetryFilesTable:
+		return &RawTelemetryFile{}, nil
+	case constants.RawVehicleSignalsTable:
+		return &RawVehicleSignal{}, nil
+	case constants.EventTable:
+		return &st.EventInternal{}, nil
+	case constants.DrivingConditionTable:
+		return &st.DrivingConditionInternal{}, nil
+	case constants.TripTable:
+		return &st.TripInternal{}, nil
+	case constants.MigrationsTable:
+		return &MigrationRecord{}, nil
+	case constants.TombstonesTable:
+		return &Tombstone{}, nil
+	case constants.AuditTable:
+		return &AuditRecord{}, nil
+	case constants.LeasesTable:
+		return &Lease{}, nil
+	case constants.JobsTable:
+		return &Job{}, nil
+	default:
+		return nil, senecaerror.NewDevError(fmt.Errorf("no object type registered for table %q", tableName))
+	}
+}
+
+//	FieldValue returns the value of the field with the given name in the object, if it has one.
+//	Field names match the names of the struct fields, which is also how Datastore indexes them.
+//	Params:
+//		object interface{}: a pointer to a struct
+//		fieldName constants.SenecaTypeFieldName
+//	Returns:
+//		interface{}: the value of the field
+//		bool: false if the object has no such field
+func FieldValue(object interface{}, fieldName constants.SenecaTypeFieldName) (interface{}, bool) {
+	value := reflect.ValueOf(object)
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil, false
+		}
+		value = value.Elem()
+	}
+
+	if value.Kind() != reflect.Struct {
+		return nil, false
+	}
+
+	field := value.FieldByName(fieldName.String())
+	if !field.IsValid() || !field.CanInterface() {
+		return nil, false
+	}
+
+	return field.Interface(), true
+}
+
+//	ObjectUserID returns the ID of the user the object belongs to.  Users are keyed by their ID rather than having a
+//	UserId field, so the ID of a user is its own.
+//	Params:
+//		tableName constants.TableName
+//		id string: the ID of the object
+//		object interface{}: a pointer to a struct, may be nil
+//	Returns:
+//		string: "" if the object has no user
+func ObjectUserID(tableName constants.TableName, id string, object interface{}) string {
+	if tableName == constants.UsersTable {
+		return id
+	}
+	userID, _ := FieldValue(object, constants.UserIDFieldName)
+	s, _ := userID.(string)
+	return s
+}
+
+//	SatisfiesQueryParams checks whether the object satisfies all of the AND-ed queryParams.
+//	Params:
+//		object interface{}: a pointer to a struct
+//		queryParams []*QueryParam
+//	Returns:
+//		bool: true if all queryParams are satisfied
+//		senecaerror.DevError
+func SatisfiesQueryParams(object interface{}, queryParams []*QueryParam) (bool, error) {
+	for _, qp := range queryParams {
+		lhs, ok := FieldValue(object, qp.FieldName)
+		if !ok {
+			return false, senecaerror.NewDevError(fmt.Errorf("object of type %T has no field %q", object, qp.FieldName))
+		}
+
+		satisfied, err := satisfiesQueryParam(lhs, qp)
+		if err != nil {
+			return false, senecaerror.NewDevError(fmt.Errorf("error evaluating %s %s %v on %T - err: %w", qp.FieldName, qp.Operand, qp.Value, object, err))
+		}
+		if !satisfied {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func satisfiesQueryParam(lhs interface{}, qp *QueryParam) (bool, error) {
+	if qp.Operand != InOperand {
+		return compareValues(lhs, qp.Value, qp.Operand)
+	}
+
+	values, ok := qp.Value.([]interface{})
+	if !ok {
+		return false, fmt.Errorf("IN takes a []interface{}, got %T", qp.Value)
+	}
+	for _, value := range values {
+		if equal, err := compareValues(lhs, value, "="); err != nil || equal {
+			return equal, err
+		}
+	}
+	return false, nil
+}
+
+// compareValues evaluates (lhs operand rhs) for the types Datastore supports in queries.
+func compareValues(lhs, rhs interface{}, operand string) (bool, error) {
+	// The int type is widened to int64 so callers don't have to match types exactly.
+	if lhsInt, ok := lhs.(int); ok {
+		lhs = int64(lhsInt)
+	}
+	if rhsInt, ok := rhs.(int); ok {
+		rhs = int64(rhsInt)
+	}
+
+	var cmp int
+	switch lhsValue := lhs.(type) {
+	case string:
+		rhsValue, ok := rhs.(string)
+		if !ok {
+			return false, fmt.Errorf("mismatched types %T and %T", lhs, rhs)
+		}
+		cmp = strings.Compare(lhsValue, rhsValue)
+	case int64:
+		rhsValue, ok := rhs.(int64)
+		if !ok {
+			return false, fmt.Errorf("mismatched types %T and %T", lhs, rhs)
+		}
+		switch {
+		case lhsValue < rhsValue:
+			cmp = -1
+		case lhsValue > rhsValue:
+			cmp = 1
+		}
+	case float64:
+		rhsValue, ok := rhs.(float64)
+		if !ok {
+			return false, fmt.Errorf("mismatched types %T and %T", lhs, rhs)
+		}
+		switch {
+		case lhsValue < rhsValue:
+			cmp = -1
+		case lhsValue > rhsValue:
+			cmp = 1
+		}
+	case bool:
+		rhsValue, ok := rhs.(bool)
+		if !ok {
+			return false, fmt.Errorf("mismatched types %T and %T", lhs, rhs)
+		}
+		switch operand {
+		case "=":
+			return lhsValue == rhsValue, nil
+		case "!=":
+			return lhsValue != rhsValue, nil
+		default:
+			return false, fmt.Errorf("unsupported operand %q on type bool", operand)
+		}
+	default:
+		return false, fmt.Errorf("unsupported type %T", lhs)
+	}
+
+	switch operand {
+	case "=":
+		return cmp == 0, nil
+	case "!=":
+		return cmp != 0, nil
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	default:
+		return false, fmt.Errorf("unsupported operand %q", operand)
+	}
+}
@@ -0,0 +1,256 @@
+package database
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"seneca/api/constants"
+	"seneca/api/senecaerror"
+	"strconv"
+	"strings"
+)
+
+const (
+	// InOperand matches a field against any of the values in a []interface{}.
+	InOperand = "in"
+
+	offsetCursorPrefix = "offset:"
+)
+
+var (
+	queryOperands = map[string]bool{
+		"=":       true,
+		"<":       true,
+		"<=":      true,
+		">":       true,
+		">=":      true,
+		InOperand: true,
+	}
+	inequalityOperands = map[string]bool{
+		"<":  true,
+		"<=": true,
+		">":  true,
+		">=": true,
+	}
+)
+
+// 	Query selects one page of IDs from a table.  Build it with NewQuery() and its chainable methods, e.g.
+// 		database.NewQuery(constants.TripTable).
+// 			Where(constants.UserIDFieldName, "=", userID).
+// 			Range(constants.StartTimeFieldName, startMs, endMs).
+// 			OrderBy(constants.StartTimeFieldName).
+// 			WithLimit(100)
+// 	Filters are AND-ed.  Like Datastore, a query ranges over one field: the first field with an inequality
+// 	filter is the one served by the index, and any ordering has to start with it.  Backends that can't serve
+// 	inequality filters on other fields, or IN filters, natively apply them to the loaded objects instead.
+type Query struct {
+	TableName constants.TableName
+	Filters   []*QueryParam
+	Orders    []*QueryOrder
+	// Limit is the maximum number of IDs in a page, 0 means no limit.
+	Limit int
+	// Cursor is where the page starts, as returned by the previous page.
+	Cursor string
+	err    error
+}
+
+// 	QueryOrder orders query results by a field.  Results that compare equal on every order are ordered by ID.
+type QueryOrder struct {
+	FieldName  constants.SenecaTypeFieldName
+	Descending bool
+}
+
+// 	NewQuery returns a Query that selects every ID in the table.
+func NewQuery(tableName constants.TableName) *Query {
+	return &Query{
+		TableName: tableName,
+	}
+}
+
+// 	Where adds the filter (fieldName operand value).
+func (q *Query) Where(fieldName constants.SenecaTypeFieldName, operand string, value interface{}) *Query {
+	q.Filters = append(q.Filters, &QueryParam{FieldName: fieldName, Operand: operand, Value: value})
+	return q
+}
+
+// 	In adds a filter that matches fieldName against any of the values.
+func (q *Query) In(fieldName constants.SenecaTypeFieldName, values ...interface{}) *Query {
+	if len(values) == 0 && q.err == nil {
+		q.err = fmt.Errorf("IN filter on %q has no values", fieldName)
+	}
+	return q.Where(fieldName, InOperand, values)
+}
+
+// 	Range adds filters for start <= fieldName < end.
+func (q *Query) Range(fieldName constants.SenecaTypeFieldName, start, end interface{}) *Query {
+	return q.Where(fieldName, ">=", start).Where(fieldName, "<", end)
+}
+
+// 	OrderBy orders the results by fieldName, ascending.  Calls after the first break ties.
+func (q *Query) OrderBy(fieldName constants.SenecaTypeFieldName) *Query {
+	q.Orders = append(q.Orders, &QueryOrder{FieldName: fieldName})
+	return q
+}
+
+// 	OrderByDescending orders the results by fieldName, descending.  Calls after the first break ties.
+func (q *Query) OrderByDescending(fieldName constants.SenecaTypeFieldName) *Query {
+	q.Orders = append(q.Orders, &QueryOrder{FieldName: fieldName, Descending: true})
+	return q
+}
+
+// 	WithLimit sets the maximum number of IDs in a page.
+func (q *Query) WithLimit(limit int) *Query {
+	q.Limit = limit
+	return q
+}
+
+// 	WithCursor starts the page at the cursor returned with the previous page.
+func (q *Query) WithCursor(cursor string) *Query {
+	q.Cursor = cursor
+	return q
+}
+
+// 	RangeField returns the first field with an inequality filter, if there is one.
+func (q *Query) RangeField() (constants.SenecaTypeFieldName, bool) {
+	for _, qp := range q.Filters {
+		if inequalityOperands[qp.Operand] {
+			return qp.FieldName, true
+		}
+	}
+	return "", false
+}
+
+//	Validate checks that every backend can run the query.
+//	Returns:
+//		senecaerror.DevError
+func (q *Query) Validate() error {
+	if q.err != nil {
+		return senecaerror.NewDevError(fmt.Errorf("invalid query on table %q - err: %w", q.TableName, q.err))
+	}
+	if q.Limit < 0 {
+		return senecaerror.NewDevError(fmt.Errorf("negative limit %d for query on table %q", q.Limit, q.TableName))
+	}
+
+	inFilters := 0
+	for _, qp := range q.Filters {
+		if !queryOperands[qp.Operand] {
+			return senecaerror.NewDevError(fmt.Errorf("unsupported operand %q for query on table %q", qp.Operand, q.TableName))
+		}
+		if qp.Operand == InOperand {
+			if _, ok := qp.Value.([]interface{}); !ok {
+				return senecaerror.NewDevError(fmt.Errorf("IN filter on %q takes a []interface{}, got %T", qp.FieldName, qp.Value))
+			}
+			inFilters++
+		}
+	}
+	if inFilters > 1 {
+		return senecaerror.NewDevError(fmt.Errorf("query on table %q has %d IN filters, at most 1 is supported", q.TableName, inFilters))
+	}
+
+	if rangeField, ok := q.RangeField(); ok && len(q.Orders) > 0 && q.Orders[0].FieldName != rangeField {
+		return senecaerror.NewDevError(fmt.Errorf("query on table %q ranges over %q, so it must be ordered by it first, not by %q", q.TableName, rangeField, q.Orders[0].FieldName))
+	}
+
+	return nil
+}
+
+//	ApplyQuery runs the query in memory over the objects in its table.
+//	Params:
+//		query *Query
+//		ids []string
+//		objects []interface{}: objects[i] has ID ids[i]
+//	Returns:
+//		[]string: the IDs in the page
+//		string: the cursor of the next page, "" if this is the last one
+//		senecaerror.DevError
+func ApplyQuery(query *Query, ids []string, objects []interface{}) ([]string, string, error) {
+	if err := query.Validate(); err != nil {
+		return nil, "", err
+	}
+	offset, err := DecodeOffsetCursor(query.Cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	type match struct {
+		id     string
+		object interface{}
+	}
+	matches := []*match{}
+	for i, object := range objects {
+		satisfied, err := SatisfiesQueryParams(object, query.Filters)
+		if err != nil {
+			return nil, "", err
+		}
+		if satisfied {
+			matches = append(matches, &match{id: ids[i], object: object})
+		}
+	}
+
+	var sortErr error
+	sort.SliceStable(matches, func(i, j int) bool {
+		for _, order := range query.Orders {
+			lhs, _ := FieldValue(matches[i].object, order.FieldName)
+			rhs, _ := FieldValue(matches[j].object, order.FieldName)
+			if equal, err := compareValues(lhs, rhs, "="); err != nil {
+				sortErr = err
+				return false
+			} else if equal {
+				continue
+			}
+			less, _ := compareValues(lhs, rhs, "<")
+			return less != order.Descending
+		}
+		return compareIDs(matches[i].id, matches[j].id)
+	})
+	if sortErr != nil {
+		return nil, "", senecaerror.NewDevError(fmt.Errorf("error ordering query on table %q - err: %w", query.TableName, sortErr))
+	}
+
+	page := []string{}
+	for i := offset; i < len(matches) && (query.Limit == 0 || len(page) < query.Limit); i++ {
+		page = append(page, matches[i].id)
+	}
+
+	nextCursor := ""
+	if end := offset + len(page); query.Limit > 0 && end < len(matches) {
+		nextCursor = EncodeOffsetCursor(end)
+	}
+	return page, nextCursor, nil
+}
+
+// 	EncodeOffsetCursor returns a cursor for backends that page by skipping the first offset results.
+func EncodeOffsetCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%s%d", offsetCursorPrefix, offset)))
+}
+
+//	DecodeOffsetCursor reverses EncodeOffsetCursor(), the empty cursor is offset 0.
+//	Params:
+//		cursor string
+//	Returns:
+//		int: the offset
+//		senecaerror.UserError: cursors come from clients, so a bad one is their error
+func DecodeOffsetCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil && strings.HasPrefix(string(decoded), offsetCursorPrefix) {
+		offset, err := strconv.Atoi(strings.TrimPrefix(string(decoded), offsetCursorPrefix))
+		if err == nil && offset >= 0 {
+			return offset, nil
+		}
+	}
+	return 0, senecaerror.NewUserError("", fmt.Errorf("invalid cursor %q", cursor), "Invalid page cursor.")
+}
+
+// compareIDs orders numeric IDs numerically, and anything else lexically.
+func compareIDs(lhs, rhs string) bool {
+	lhsInt, lhsErr := strconv.ParseInt(lhs, 10, 64)
+	rhsInt, rhsErr := strconv.ParseInt(rhs, 10, 64)
+	if lhsErr == nil && rhsErr == nil {
+		return lhsInt < rhsInt
+	}
+	return lhs < rhs
+}
@@ -0,0 +1,161 @@
+package database_test
+
+import (
+	"errors"
+	"seneca/api/constants"
+	"seneca/api/senecaerror"
+	st "seneca/api/type"
+	"seneca/internal/client/database"
+	"seneca/test/testutil"
+	"testing"
+)
+
+func TestApplyQuery(t *testing.T) {
+	ids := []string{"1", "2", "3", "4", "5", "10"}
+	objects := []interface{}{
+		&st.TripInternal{UserId: testutil.TestUserID, StartTimeMs: 30, EndTimeMs: 40},
+		&st.TripInternal{UserId: testutil.TestUserID, StartTimeMs: 10, EndTimeMs: 20},
+		&st.TripInternal{UserId: "otheruser", StartTimeMs: 10, EndTimeMs: 20},
+		&st.TripInternal{UserId: testutil.TestUserID, StartTimeMs: 50, EndTimeMs: 60},
+		&st.TripInternal{UserId: testutil.TestUserID, StartTimeMs: 30, EndTimeMs: 35},
+		&st.TripInternal{UserId: testutil.TestUserID, StartTimeMs: 30, EndTimeMs: 36},
+	}
+
+	testCases := []struct {
+		desc    string
+		query   *database.Query
+		wantIDs []string
+	}{
+		{
+			desc:    "all IDs ordered by ID",
+			query:   database.NewQuery(constants.TripTable),
+			wantIDs: []string{"1", "2", "3", "4", "5", "10"},
+		},
+		{
+			desc:    "ties broken by ID",
+			query:   database.NewQuery(constants.TripTable).Where(constants.UserIDFieldName, "=", testutil.TestUserID).OrderBy(constants.StartTimeFieldName),
+			wantIDs: []string{"2", "1", "5", "10", "4"},
+		},
+		{
+			desc:    "descending with secondary order",
+			query:   database.NewQuery(constants.TripTable).OrderByDescending(constants.StartTimeFieldName).OrderBy(constants.EndTimeFieldName),
+			wantIDs: []string{"4", "5", "10", "1", "2", "3"},
+		},
+		{
+			desc:    "range on one field",
+			query:   database.NewQuery(constants.TripTable).Range(constants.StartTimeFieldName, int64(10), int64(50)).Where(constants.UserIDFieldName, "=", testutil.TestUserID),
+			wantIDs: []string{"1", "2", "5", "10"},
+		},
+		{
+			desc:    "range on another field applied too",
+			query:   database.NewQuery(constants.TripTable).Where(constants.StartTimeFieldName, "<=", int64(30)).Where(constants.EndTimeFieldName, ">=", int64(36)),
+			wantIDs: []string{"1", "10"},
+		},
+		{
+			desc:    "IN",
+			query:   database.NewQuery(constants.TripTable).In(constants.StartTimeFieldName, int64(10), int64(50)).Where(constants.UserIDFieldName, "=", testutil.TestUserID),
+			wantIDs: []string{"2", "4"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			gotIDs, nextCursor, err := database.ApplyQuery(tc.query, ids, objects)
+			if err != nil {
+				t.Fatalf("ApplyQuery() returns err: %v", err)
+			}
+			if nextCursor != "" {
+				t.Fatalf("Want no next cursor without a limit, got %q", nextCursor)
+			}
+			if len(gotIDs) != len(tc.wantIDs) {
+				t.Fatalf("Want IDs %v, got %v", tc.wantIDs, gotIDs)
+			}
+			for i := range gotIDs {
+				if gotIDs[i] != tc.wantIDs[i] {
+					t.Fatalf("Want IDs %v, got %v", tc.wantIDs, gotIDs)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyQueryPages(t *testing.T) {
+	ids := []string{}
+	objects := []interface{}{}
+	for i := 0; i < 5; i++ {
+		ids = append(ids, string(rune('a'+i)))
+		objects = append(objects, &st.RawMotion{UserId: testutil.TestUserID, TimestampMs: int64(100 - i)})
+	}
+
+	query := database.NewQuery(constants.RawMotionsTable).OrderBy(constants.TimestampFieldName).WithLimit(2)
+	gotIDs := []string{}
+	pages := 0
+	for {
+		page, nextCursor, err := database.ApplyQuery(query, ids, objects)
+		if err != nil {
+			t.Fatalf("ApplyQuery() returns err: %v", err)
+		}
+		pages++
+		gotIDs = append(gotIDs, page...)
+		if nextCursor == "" {
+			break
+		}
+		query.WithCursor(nextCursor)
+	}
+
+	if pages != 3 {
+		t.Fatalf("Want 3 pages, got %d", pages)
+	}
+	wantIDs := []string{"e", "d", "c", "b", "a"}
+	for i := range wantIDs {
+		if i >= len(gotIDs) || gotIDs[i] != wantIDs[i] {
+			t.Fatalf("Want IDs %v, got %v", wantIDs, gotIDs)
+		}
+	}
+
+	var ue *senecaerror.UserError
+	if _, _, err := database.ApplyQuery(query.WithCursor("garbage"), ids, objects); !errors.As(err, &ue) {
+		t.Fatalf("Want UserError for invalid cursor, got %v", err)
+	}
+}
+
+func TestQueryValidate(t *testing.T) {
+	testCases := []struct {
+		desc  string
+		query *database.Query
+	}{
+		{
+			desc:  "unsupported operand",
+			query: database.NewQuery(constants.TripTable).Where(constants.UserIDFieldName, "!=", testutil.TestUserID),
+		},
+		{
+			desc:  "empty IN",
+			query: database.NewQuery(constants.TripTable).In(constants.UserIDFieldName),
+		},
+		{
+			desc:  "two IN filters",
+			query: database.NewQuery(constants.TripTable).In(constants.UserIDFieldName, "a").In(constants.TripIDFieldName, "b"),
+		},
+		{
+			desc:  "ordered by a field other than the range field",
+			query: database.NewQuery(constants.TripTable).Where(constants.StartTimeFieldName, ">", int64(0)).OrderBy(constants.EndTimeFieldName),
+		},
+		{
+			desc:  "negative limit",
+			query: database.NewQuery(constants.TripTable).WithLimit(-1),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			var de *senecaerror.DevError
+			if err := tc.query.Validate(); !errors.As(err, &de) {
+				t.Fatalf("Want DevError from Validate(), got %v", err)
+			}
+		})
+	}
+
+	if err := database.NewQuery(constants.TripTable).Where(constants.StartTimeFieldName, ">", int64(0)).OrderBy(constants.StartTimeFieldName).OrderBy(constants.EndTimeFieldName).Validate(); err != nil {
+		t.Fatalf("Validate() returns err: %v", err)
+	}
+}
@@ -0,0 +1,33 @@
+package database
+
+import (
+	st "seneca/api/type"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// RawTelemetryFileSourceType is the st.Source_SourceType of Sources that refer to a RawTelemetryFile.  It's numbered
+// after the types in the protos, which don't have one.
+const RawTelemetryFileSourceType st.Source_SourceType = 5
+
+// 	RawTelemetryFile is a GPS log uploaded without a video, e.g. a GPX track, or a vehicle's OBD-II or CAN log, stored
+// 	in constants.RawTelemetryFilesTable.  The RawLocations, RawMotions and RawVehicleSignals read from it have it
+// 	as their Source.
+type RawTelemetryFile struct {
+	Id     string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	UserId string `protobuf:"bytes,2,opt,name=user_id,proto3" json:"user_id,omitempty"`
+	// OriginalFileName is the name of the file as it was uploaded.
+	OriginalFileName string `protobuf:"bytes,3,opt,name=original_file_name,proto3" json:"original_file_name,omitempty"`
+	// Format is how the file is encoded, one of telemetry.Formats or vehiclelog.Formats, e.g. "gpx".
+	Format string `protobuf:"bytes,4,opt,name=format,proto3" json:"format,omitempty"`
+	// CloudStorageFileName is the URL of the uploaded file in simple storage.
+	CloudStorageFileName string `protobuf:"bytes,5,opt,name=cloud_storage_file_name,proto3" json:"cloud_storage_file_name,omitempty"`
+	// CreateTimeMs is the time of the first sample stored from the file, in local time like every other time.
+	CreateTimeMs int64 `protobuf:"varint,6,opt,name=create_time_ms,proto3" json:"create_time_ms,omitempty"`
+	// DurationMs is the time between the file's first and last samples.
+	DurationMs int64 `protobuf:"varint,7,opt,name=duration_ms,proto3" json:"duration_ms,omitempty"`
+}
+
+func (m *RawTelemetryFile) Reset()         { *m = RawTelemetryFile{} }
+func (m *RawTelemetryFile) String() string { return proto.CompactTextString(m) }
+func (*RawTelemetryFile) ProtoMessage()    {}
@@ -0,0 +1,29 @@
+package database
+
+import (
+	st "seneca/api/type"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// RawVehicleSignalSourceType is the st.Source_SourceType of Sources that refer to a RawVehicleSignal.  It's numbered
+// after RawTelemetryFileSourceType.
+const RawVehicleSignalSourceType st.Source_SourceType = 6
+
+// 	RawVehicleSignal is one reading of a signal the vehicle reported itself, e.g. its speed, read from an OBD-II
+// 	or CAN log and stored in constants.RawVehicleSignalsTable.  Its Source is the RawTelemetryFile of the log.
+type RawVehicleSignal struct {
+	Id     string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	UserId string `protobuf:"bytes,2,opt,name=user_id,proto3" json:"user_id,omitempty"`
+	// Signal is what was read, one of vehiclelog.Signals.
+	Signal string `protobuf:"bytes,3,opt,name=signal,proto3" json:"signal,omitempty"`
+	// Value is in the unit of the Signal, e.g. mph for speeds.
+	Value        float64    `protobuf:"fixed64,4,opt,name=value,proto3" json:"value,omitempty"`
+	TimestampMs  int64      `protobuf:"varint,5,opt,name=timestamp_ms,proto3" json:"timestamp_ms,omitempty"`
+	Source       *st.Source `protobuf:"bytes,6,opt,name=source,proto3" json:"source,omitempty"`
+	AlgosVersion float64    `protobuf:"fixed64,7,opt,name=algos_version,proto3" json:"algos_version,omitempty"`
+}
+
+func (m *RawVehicleSignal) Reset()         { *m = RawVehicleSignal{} }
+func (m *RawVehicleSignal) String() string { return proto.CompactTextString(m) }
+func (*RawVehicleSignal) ProtoMessage()    {}
@@ -0,0 +1,111 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"seneca/api/constants"
+	"seneca/api/senecaerror"
+	"seneca/internal/util"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+const (
+	// DeleteReason is the Reason of tombstones of objects deleted through the DAOs.
+	DeleteReason = "delete"
+	// RetentionReason is the Reason of tombstones of objects that outlived their retention policy.
+	RetentionReason = "retention"
+)
+
+// 	Tombstone is stored in constants.TombstonesTable, one per soft deleted object.  The object is moved out of its
+// 	table into the tombstone, so readers of the table don't see it, until the tombstone is purged.
+type Tombstone struct {
+	Id        string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	TableName string `protobuf:"bytes,2,opt,name=table_name,proto3" json:"table_name,omitempty"`
+	ObjectId  string `protobuf:"bytes,3,opt,name=object_id,proto3" json:"object_id,omitempty"`
+	UserId    string `protobuf:"bytes,4,opt,name=user_id,proto3" json:"user_id,omitempty"`
+	// TimestampMs is when the object was deleted.
+	TimestampMs int64 `protobuf:"varint,5,opt,name=timestamp_ms,proto3" json:"timestamp_ms,omitempty"`
+	// Reason is why the object was deleted, e.g. "api" or "retention".
+	Reason string `protobuf:"bytes,6,opt,name=reason,proto3" json:"reason,omitempty"`
+	// Object is the deleted object in the protobuf wire format.  It isn't indexed, since Datastore only indexes short values.
+	Object []byte `protobuf:"bytes,7,opt,name=object,proto3" json:"object,omitempty" datastore:",noindex"`
+}
+
+func (m *Tombstone) Reset()         { *m = Tombstone{} }
+func (m *Tombstone) String() string { return proto.CompactTextString(m) }
+func (*Tombstone) ProtoMessage()    {}
+
+//	SoftDelete moves the object out of its table into a new tombstone, in one transaction.
+//	Params:
+//		ctx context.Context
+//		sql SQLInterface
+//		tableName constants.TableName
+//		id string
+//		reason string: why the object is deleted
+//	Returns:
+//		*Tombstone
+//		senecaerror.NotFoundError: if the object doesn't exist
+//		senecaerror.DevError, error
+func SoftDelete(ctx context.Context, sql SQLInterface, tableName constants.TableName, id, reason string) (*Tombstone, error) {
+	var tombstone *Tombstone
+	err := sql.RunInTransaction(ctx, func(tx SQLInterface) error {
+		object, err := tx.GetByID(tableName, id)
+		if err != nil {
+			return fmt.Errorf("error getting object %q from table %q: %w", id, tableName, err)
+		}
+		if object == nil {
+			return senecaerror.NewNotFoundError(fmt.Errorf("object %q not found in table %q", id, tableName))
+		}
+		message, ok := object.(proto.Message)
+		if !ok {
+			return senecaerror.NewDevError(fmt.Errorf("object %q in table %q of type %T is not a proto.Message", id, tableName, object))
+		}
+		data, err := proto.Marshal(message)
+		if err != nil {
+			return senecaerror.NewDevError(fmt.Errorf("error marshalling object %q in table %q - err: %w", id, tableName, err))
+		}
+
+		tombstone = &Tombstone{
+			TableName:   tableName.String(),
+			ObjectId:    id,
+			UserId:      ObjectUserID(tableName, id, object),
+			TimestampMs: util.TimeToMilliseconds(time.Now()),
+			Reason:      reason,
+			Object:      data,
+		}
+		tombstoneID, err := tx.Create(constants.TombstonesTable, tombstone)
+		if err != nil {
+			return fmt.Errorf("error creating tombstone for object %q in table %q: %w", id, tableName, err)
+		}
+		tombstone.Id = tombstoneID
+		if err := tx.Insert(constants.TombstonesTable, tombstoneID, tombstone); err != nil {
+			return fmt.Errorf("error updating tombstone %q: %w", tombstoneID, err)
+		}
+
+		if err := tx.DeleteByID(tableName, id); err != nil {
+			return fmt.Errorf("error deleting object %q from table %q: %w", id, tableName, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tombstone, nil
+}
+
+//	UnmarshalObject returns the object the tombstone holds.
+//	Returns:
+//		interface{}: a pointer to the object, of the type stored in the tombstone's table
+//		senecaerror.DevError, senecaerror.BadStateError
+func (m *Tombstone) UnmarshalObject() (interface{}, error) {
+	object, err := NewObjectForTable(constants.TableName(m.TableName))
+	if err != nil {
+		return nil, err
+	}
+	if err := proto.Unmarshal(m.Object, object.(proto.Message)); err != nil {
+		return nil, senecaerror.NewBadStateError(fmt.Errorf("error unmarshalling object of tombstone %q - err: %w", m.Id, err))
+	}
+	return object, nil
+}
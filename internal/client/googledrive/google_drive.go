@@ -9,6 +9,8 @@ import (
 	"seneca/api/constants"
 	st "seneca/api/type"
 	mp4util "seneca/internal/util/mp4/util"
+	"seneca/internal/util/telemetry"
+	"seneca/internal/util/vehiclelog"
 	"strings"
 
 	"golang.org/x/oauth2"
@@ -51,6 +53,9 @@ type GDriveQuery string
 const (
 	AllMP4s         GDriveQuery = "ALL_MP4s"
 	UnprocessedMP4s GDriveQuery = "UNPROCESSED_MP4s"
+	// UnprocessedTelemetry are the GPS logs of vehicles without a dashcam, in any telemetry.Format, and vehicle logs
+	// in any vehiclelog.Format.
+	UnprocessedTelemetry GDriveQuery = "UNPROCESSED_TELEMETRY"
 )
 
 func (gdq GDriveQuery) String() string {
@@ -243,15 +248,23 @@ func (gduc *GoogleDriveUserClient) MarkFileByID(fileID string, prefix FilePrefix
 
 func (gduc *GoogleDriveUserClient) generateQuery(gdq GDriveQuery) string {
 	allQueriesPrefix := fmt.Sprintf("parents in '%s' and trashed = false and title contains '.mp4'", gduc.folderID)
+	unprocessedSuffix := ""
+	for _, prefix := range FilePrefixes {
+		unprocessedSuffix = unprocessedSuffix + fmt.Sprintf(" and not title contains '%s'", prefix.String())
+	}
 	switch gdq.String() {
 	case AllMP4s.String():
 		return allQueriesPrefix
 	case UnprocessedMP4s.String():
-		query := allQueriesPrefix
-		for _, prefix := range FilePrefixes {
-			query = query + fmt.Sprintf(" and not title contains '%s'", prefix.String())
+		return allQueriesPrefix + unprocessedSuffix
+	case UnprocessedTelemetry.String():
+		extensions := []string{}
+		for _, format := range telemetry.Formats {
+			extensions = append(extensions, fmt.Sprintf("title contains '.%s'", format))
 		}
-		return query
+		// ELM327 exports are CSVs, which are already queried.
+		extensions = append(extensions, fmt.Sprintf("title contains '.%s'", vehiclelog.Candump.Extension()))
+		return fmt.Sprintf("parents in '%s' and trashed = false and (%s)", gduc.folderID, strings.Join(extensions, " or ")) + unprocessedSuffix
 	default:
 		// This can trigger the error in the gdrive client.
 		return "ERROR"
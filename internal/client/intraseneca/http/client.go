@@ -2,14 +2,17 @@ package http
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
 	"seneca/api/constants"
 	st "seneca/api/type"
 	"seneca/internal/authenticator"
 	"seneca/internal/client/intraseneca"
+	"seneca/internal/jobqueue"
 
 	"github.com/golang/protobuf/proto"
 )
@@ -129,6 +132,70 @@ func (ct *Client) ProcessObjectsInVideo(req *st.ObjectsInFrameRequest) (*st.Obje
 	return respProto, nil
 }
 
+// StartSyncer enqueues a sync of all users, and returns the ID of its job.
+func (ct *Client) StartSyncer() (string, error) {
+	return ct.startJob("/syncer")
+}
+
+// StartRunner enqueues a run of the algorithms on all users, and returns the ID of its job.
+func (ct *Client) StartRunner() (string, error) {
+	return ct.startJob("/runner")
+}
+
+// GetJob reports the job, along with the jobs it enqueued.
+func (ct *Client) GetJob(jobID string) (*jobqueue.Status, error) {
+	status := &jobqueue.Status{}
+	if err := ct.doJSON(http.MethodGet, fmt.Sprintf("/jobs/%s", url.PathEscape(jobID)), status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// ListJobs reports the user's jobs, or the jobs for all users if userID is "".
+func (ct *Client) ListJobs(userID string) ([]*jobqueue.Status, error) {
+	resp := &jobqueue.ListResponse{}
+	if err := ct.doJSON(http.MethodGet, fmt.Sprintf("/jobs?user=%s", url.QueryEscape(userID)), resp); err != nil {
+		return nil, err
+	}
+	return resp.Jobs, nil
+}
+
+func (ct *Client) startJob(path string) (string, error) {
+	resp := &jobqueue.EnqueueResponse{}
+	if err := ct.doJSON(http.MethodPost, path, resp); err != nil {
+		return "", err
+	}
+	return resp.JobID, nil
+}
+
+// doJSON sends a request without a body to the SenecaServer, and decodes its JSON response into out.
+func (ct *Client) doJSON(method, path string, out interface{}) error {
+	httpReq, err := http.NewRequest(method, fmt.Sprintf("http://%s:%s%s", ct.serverConfig.SenecaServerHostName, ct.serverConfig.SenecaServerHostPort, path), nil)
+	if err != nil {
+		return fmt.Errorf("error initializing HTTP request: %w", err)
+	}
+
+	httpReq = authenticator.AddRequestAuth(httpReq)
+
+	resp, err := ct.senecaServerHTTPClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading bytes: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("got status code %d with message %q", resp.StatusCode, string(bodyBytes))
+	}
+	if err := json.Unmarshal(bodyBytes, out); err != nil {
+		return fmt.Errorf("error unmarshalling response: %w - string message: %q", err, string(bodyBytes))
+	}
+	return nil
+}
+
 func sendHeartBeat(hostname, port string, httpClient *http.Client) error {
 	// TODO(lucaloncar): define http/https protocol as a type
 	request, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://%s:%s/%s", hostname, port, constants.HeartbeatEndpoint), nil)
@@ -20,7 +20,8 @@ func New(sanitizer *sanitizer.Sanitizer, tripDAO dao.TripDAO) *APIServer {
 	}
 }
 
-func (srv *APIServer) ListTrips(userID string, startTime time.Time, endTime time.Time) ([]*st.Trip, error) {
+// ListTrips lists the user's trips in the time range, with source video URLs valid for videoURLExpiry.
+func (srv *APIServer) ListTrips(userID string, startTime time.Time, endTime time.Time, videoURLExpiry time.Duration) ([]*st.Trip, error) {
 	trips := []*st.Trip{}
 
 	tripIDs, err := srv.tripDAO.ListUserTripIDsByTime(userID, startTime, endTime)
@@ -28,12 +29,13 @@ func (srv *APIServer) ListTrips(userID string, startTime time.Time, endTime time
 		return nil, fmt.Errorf("ListUserTripIDsByTime(%s, %s, %s) returns err: %w", userID, startTime, endTime, err)
 	}
 
-	for _, tid := range tripIDs {
-		tripInternal, err := srv.tripDAO.GetTripByID(userID, tid)
-		if err != nil {
-			return nil, fmt.Errorf("GetTripByID(%s) returns err: %w", tid, err)
-		}
-		tripExternal, err := srv.sanitizer.TripInternalToTripExternal(tripInternal)
+	tripInternals, err := srv.tripDAO.GetTripsByIDs(userID, tripIDs)
+	if err != nil {
+		return nil, fmt.Errorf("GetTripsByIDs(%s, %v) returns err: %w", userID, tripIDs, err)
+	}
+
+	for _, tripInternal := range tripInternals {
+		tripExternal, err := srv.sanitizer.TripInternalToTripExternal(tripInternal, videoURLExpiry)
 		if err != nil {
 			return nil, fmt.Errorf("error converting internal trip %v to external trip: %w", tripInternal, err)
 		}
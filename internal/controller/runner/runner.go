@@ -1,33 +1,286 @@
 package runner
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"seneca/api/senecaerror"
+	"seneca/internal/client/database"
 	"seneca/internal/client/logging"
 	"seneca/internal/dao"
 	"seneca/internal/dataprocessor"
+	"seneca/internal/jobqueue"
+	"sync"
+	"time"
 )
 
+const (
+	// leaseName is the name of the leases users are processed under.
+	leaseName = "runner"
+	// leaseTTL is how long a lease lasts, it's renewed every leaseTTL/3 while the user is processed.
+	leaseTTL = time.Minute * 30
+)
+
+// The statuses of the users in a Report.
+const (
+	SucceededStatus = "succeeded"
+	FailedStatus    = "failed"
+	// SkippedStatus is the status of users that were being processed by another run.
+	SkippedStatus = "skipped"
+	// CanceledStatus is the status of users that weren't processed because the run was canceled.
+	CanceledStatus = "canceled"
+)
+
+// 	UserResult is the outcome of processing one user.
+type UserResult struct {
+	UserID string `json:"user_id"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Errors are all the failures the dataprocessor collected, if it ran.
+	Errors     []string `json:"errors,omitempty"`
+	DurationMs int64    `json:"duration_ms"`
+}
+
+// 	Report is the outcome of a run of the Runner.
+type Report struct {
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+	// Users are in the order they were listed.
+	Users []*UserResult `json:"users"`
+}
+
+// Count returns how many users have the status.
+func (r *Report) Count(status string) int {
+	count := 0
+	for _, user := range r.Users {
+		if user.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// userProcessor is implemented by *dataprocessor.DataProcessor.
+type userProcessor interface {
+	Run(ctx context.Context, userID string) error
+}
+
+// 	Runner runs the dataprocessor on every user, concurrently.  Each user is processed under a lease stored in
+// 	the database, so that overlapping runs, in this or another process, never process the same user at once.
 type Runner struct {
-	dataprocessor *dataprocessor.DataProcessor
+	dataprocessor userProcessor
 	userDAO       dao.UserDAO
-	logger        logging.LoggingInterface
+	sql           database.SQLInterface
+	// jobQueue receives the RunAlgorithms jobs the Runner enqueues.
+	jobQueue    jobqueue.Queue
+	concurrency int
+	// holder identifies this Runner in the leases it holds.
+	holder string
+	logger logging.LoggingInterface
+	// now is replaced in tests.
+	now func() time.Time
 }
 
-func New(userDAO dao.UserDAO, dataprocessor *dataprocessor.DataProcessor, logger logging.LoggingInterface) *Runner {
+//	New creates a Runner.
+//	Params:
+//		userDAO dao.UserDAO
+//		dataprocessor *dataprocessor.DataProcessor
+//		sqlInterface database.SQLInterface: where the leases are stored
+//		jobQueue jobqueue.Queue
+//		concurrency int: how many users are processed at a time, jobqueue.DefaultConcurrency if not positive
+//		logger logging.LoggingInterface
+//	Returns:
+//		*Runner
+func New(userDAO dao.UserDAO, dataprocessor *dataprocessor.DataProcessor, sqlInterface database.SQLInterface, jobQueue jobqueue.Queue, concurrency int, logger logging.LoggingInterface) *Runner {
+	if concurrency <= 0 {
+		concurrency = jobqueue.DefaultConcurrency
+	}
 	return &Runner{
 		dataprocessor: dataprocessor,
 		userDAO:       userDAO,
+		sql:           sqlInterface,
+		jobQueue:      jobQueue,
+		concurrency:   concurrency,
+		holder:        newHolder(),
 		logger:        logger,
+		now:           time.Now,
 	}
 }
 
-func (rnr *Runner) Run() {
+//	Run processes every user.  Canceling ctx stops the run, users that weren't processed yet are reported canceled.
+//	Params:
+//		ctx context.Context
+//	Returns:
+//		*Report: with a result for every user
+//		error: if the users couldn't be listed
+func (rnr *Runner) Run(ctx context.Context) (*Report, error) {
+	report := &Report{StartTime: rnr.now()}
 	userIDs, err := rnr.userDAO.ListAllUserIDs()
 	if err != nil {
-		rnr.logger.Error(fmt.Sprintf("ListAllUserIDs() returns err: %v", err))
+		return nil, fmt.Errorf("error listing users: %w", err)
+	}
+
+	report.Users = make([]*UserResult, len(userIDs))
+	indexes := make(chan int)
+	wg := sync.WaitGroup{}
+	for i := 0; i < rnr.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				report.Users[index] = rnr.runUser(ctx, userIDs[index])
+			}
+		}()
+	}
+
+	for i := range userIDs {
+		if ctx.Err() != nil {
+			report.Users[i] = &UserResult{UserID: userIDs[i], Status: CanceledStatus, Error: ctx.Err().Error()}
+			continue
+		}
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			report.Users[i] = &UserResult{UserID: userIDs[i], Status: CanceledStatus, Error: ctx.Err().Error()}
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	report.EndTime = rnr.now()
+	rnr.logger.Log(fmt.Sprintf("Runner processed %d users: %d succeeded, %d failed, %d skipped, %d canceled", len(report.Users), report.Count(SucceededStatus), report.Count(FailedStatus), report.Count(SkippedStatus), report.Count(CanceledStatus)))
+	return report, nil
+}
+
+//	HandleRunAlgorithmsJob consumes jobqueue.RunAlgorithms jobs.  It processes the job's user, or enqueues a
+//	RunAlgorithms job for every user that doesn't have one pending if the job has no user.
+//	Params:
+//		ctx context.Context
+//		job *database.Job
+//	Returns:
+//		string: the JSON encoded *UserResult, also if it failed, or jobqueue.ChildJobs
+//		error: also if the user is being processed by another run, so the job is retried after it
+func (rnr *Runner) HandleRunAlgorithmsJob(ctx context.Context, job *database.Job) (string, error) {
+	if job.UserId == "" {
+		userIDs, err := rnr.userDAO.ListAllUserIDs()
+		if err != nil {
+			return "", fmt.Errorf("error listing users: %w", err)
+		}
+		children := &jobqueue.ChildJobs{JobIDs: []string{}}
+		for _, userID := range userIDs {
+			child, err := jobqueue.NewJob(jobqueue.RunAlgorithms, userID, nil)
+			if err != nil {
+				return "", err
+			}
+			if child, err = jobqueue.EnqueueUnlessPending(ctx, rnr.jobQueue, child); err != nil {
+				return "", fmt.Errorf("error enqueuing RunAlgorithms job for user %q: %w", userID, err)
+			}
+			children.JobIDs = append(children.JobIDs, child.Id)
+		}
+		return encodeResult(children)
+	}
+
+	userResult := rnr.runUser(ctx, job.UserId)
+	result, err := encodeResult(userResult)
+	if err != nil {
+		return "", err
+	}
+	switch userResult.Status {
+	case SucceededStatus:
+		return result, nil
+	case SkippedStatus:
+		return result, fmt.Errorf("user %q is being processed by another run", job.UserId)
+	default:
+		return result, errors.New(userResult.Error)
+	}
+}
+
+func encodeResult(result interface{}) (string, error) {
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return "", senecaerror.NewDevError(fmt.Errorf("error encoding job result: %w", err))
+	}
+	return string(encoded), nil
+}
+
+// runUser processes the user under its lease, renewing the lease until it's done.
+func (rnr *Runner) runUser(ctx context.Context, userID string) *UserResult {
+	start := rnr.now()
+	result := &UserResult{UserID: userID}
+	defer func() {
+		result.DurationMs = rnr.now().Sub(start).Milliseconds()
+	}()
+
+	lease, err := database.AcquireLease(ctx, rnr.sql, leaseName, userID, rnr.holder, start, leaseTTL)
+	if err != nil {
+		result.Status = FailedStatus
+		result.Error = fmt.Sprintf("error acquiring lease: %v", err)
+		return result
+	}
+	if lease == nil {
+		result.Status = SkippedStatus
+		return result
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		ticker := time.NewTicker(leaseTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-runCtx.Done():
+				return
+			case <-ticker.C:
+				if err := database.RenewLease(runCtx, rnr.sql, lease, rnr.now(), leaseTTL); err != nil {
+					rnr.logger.Error(fmt.Sprintf("RenewLease() for user %q returns err: %v", userID, err))
+					// Another run may process the user now, so this one stops.
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	err = rnr.dataprocessor.Run(runCtx, userID)
+	cancel()
+	<-renewed
+	// The lease is released even if the run was canceled.
+	if releaseErr := database.ReleaseLease(context.Background(), rnr.sql, lease); releaseErr != nil {
+		rnr.logger.Error(fmt.Sprintf("ReleaseLease() for user %q returns err: %v", userID, releaseErr))
 	}
 
-	for _, uid := range userIDs {
-		rnr.dataprocessor.Run(uid)
+	switch {
+	case err == nil:
+		result.Status = SucceededStatus
+	case ctx.Err() != nil:
+		result.Status = CanceledStatus
+		result.Error = err.Error()
+	default:
+		result.Status = FailedStatus
+		result.Error = err.Error()
+		var runErr *dataprocessor.RunError
+		if errors.As(err, &runErr) {
+			result.Errors = runErr.Errors
+		}
+	}
+	return result
+}
+
+// newHolder identifies a Runner by its host, process and a random suffix.
+func newHolder() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Sprintf("%s/%d", hostname, os.Getpid())
 	}
+	return fmt.Sprintf("%s/%d/%s", hostname, os.Getpid(), hex.EncodeToString(suffix))
 }
@@ -0,0 +1,323 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"seneca/api/constants"
+	"seneca/internal/client/database"
+	"seneca/internal/client/logging"
+	"seneca/internal/dao/userdao"
+	"seneca/internal/jobqueue"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeProcessor records the users it processes and how many it processes at once.
+type fakeProcessor struct {
+	mu          sync.Mutex
+	processed   []string
+	running     int
+	maxRunning  int
+	failUserIDs map[string]bool
+	// release blocks every Run until it's closed, if it's set.
+	release chan struct{}
+	started chan string
+}
+
+func (fp *fakeProcessor) Run(ctx context.Context, userID string) error {
+	fp.mu.Lock()
+	fp.running++
+	if fp.running > fp.maxRunning {
+		fp.maxRunning = fp.running
+	}
+	fp.mu.Unlock()
+	defer func() {
+		fp.mu.Lock()
+		fp.running--
+		fp.processed = append(fp.processed, userID)
+		fp.mu.Unlock()
+	}()
+
+	if fp.started != nil {
+		fp.started <- userID
+	}
+	if fp.release != nil {
+		select {
+		case <-fp.release:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	} else {
+		time.Sleep(time.Millisecond * 5)
+	}
+	if fp.failUserIDs[userID] {
+		return errors.New("failed")
+	}
+	return nil
+}
+
+// lockedSQL serializes the calls to the fake database, which isn't safe for concurrent use.
+type lockedSQL struct {
+	mu  sync.Mutex
+	sql database.SQLInterface
+}
+
+func (l *lockedSQL) ListIDs(tableName constants.TableName, queryParams []*database.QueryParam) ([]string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.sql.ListIDs(tableName, queryParams)
+}
+
+func (l *lockedSQL) ListIDsByQuery(query *database.Query) ([]string, string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.sql.ListIDsByQuery(query)
+}
+
+func (l *lockedSQL) GetByID(tableName constants.TableName, id string) (interface{}, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.sql.GetByID(tableName, id)
+}
+
+func (l *lockedSQL) GetByIDs(tableName constants.TableName, ids []string) ([]interface{}, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.sql.GetByIDs(tableName, ids)
+}
+
+func (l *lockedSQL) Create(tableName constants.TableName, object interface{}) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.sql.Create(tableName, object)
+}
+
+func (l *lockedSQL) Insert(tableName constants.TableName, id string, object interface{}) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.sql.Insert(tableName, id, object)
+}
+
+func (l *lockedSQL) Put(tableName constants.TableName, id string, object interface{}) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.sql.Put(tableName, id, object)
+}
+
+func (l *lockedSQL) DeleteByID(tableName constants.TableName, id string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.sql.DeleteByID(tableName, id)
+}
+
+func (l *lockedSQL) CreateMulti(tableName constants.TableName, objects []interface{}) ([]string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.sql.CreateMulti(tableName, objects)
+}
+
+func (l *lockedSQL) InsertMulti(tableName constants.TableName, ids []string, objects []interface{}) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.sql.InsertMulti(tableName, ids, objects)
+}
+
+func (l *lockedSQL) DeleteMulti(tableName constants.TableName, ids []string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.sql.DeleteMulti(tableName, ids)
+}
+
+// RunInTransaction holds the lock for the whole transaction, so f uses the database directly.
+func (l *lockedSQL) RunInTransaction(ctx context.Context, f func(tx database.SQLInterface) error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.sql.RunInTransaction(ctx, f)
+}
+
+func newRunnerForTest(userIDs []string, processor *fakeProcessor, sql database.SQLInterface, concurrency int) *Runner {
+	rnr := New(&userdao.MockUserDAO{ListAllUserIDsMock: func() ([]string, error) { return userIDs, nil }}, nil, &lockedSQL{sql: sql}, jobqueue.NewMemory(jobqueue.DefaultOptions()), concurrency, logging.NewLocalLogger(true))
+	rnr.dataprocessor = processor
+	return rnr
+}
+
+func TestRun(t *testing.T) {
+	userIDs := []string{}
+	for i := 0; i < 10; i++ {
+		userIDs = append(userIDs, fmt.Sprintf("%d", i))
+	}
+	fakeSQL := database.NewFake()
+	// User 2 is being processed by another run.
+	if lease, err := database.AcquireLease(context.Background(), fakeSQL, leaseName, "2", "other", time.Now(), time.Hour); err != nil || lease == nil {
+		t.Fatalf("AcquireLease() returns %v, %v", lease, err)
+	}
+	processor := &fakeProcessor{failUserIDs: map[string]bool{"5": true}}
+	rnr := newRunnerForTest(userIDs, processor, fakeSQL, 3)
+
+	report, err := rnr.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() returns err: %v", err)
+	}
+
+	if len(report.Users) != len(userIDs) {
+		t.Fatalf("Want %d results, got %d", len(userIDs), len(report.Users))
+	}
+	for i, result := range report.Users {
+		wantStatus := SucceededStatus
+		if result.UserID == "2" {
+			wantStatus = SkippedStatus
+		} else if result.UserID == "5" {
+			wantStatus = FailedStatus
+		}
+		if result.UserID != userIDs[i] || result.Status != wantStatus {
+			t.Fatalf("Want user %q %s, got %v", userIDs[i], wantStatus, result)
+		}
+		if wantStatus == FailedStatus && result.Error == "" {
+			t.Fatalf("Want the failure of user %q reported, got %v", result.UserID, result)
+		}
+	}
+	if processor.maxRunning < 2 || processor.maxRunning > 3 {
+		t.Fatalf("Want 2 or 3 users processed at once, got %d", processor.maxRunning)
+	}
+
+	// Only the other run's lease is left.
+	ids, _, err := fakeSQL.ListIDsByQuery(database.NewQuery(constants.LeasesTable))
+	if err != nil {
+		t.Fatalf("ListIDsByQuery() returns err: %v", err)
+	}
+	if len(ids) != 1 {
+		t.Fatalf("Want the leases released, got %d leases", len(ids))
+	}
+}
+
+func TestRunCancellation(t *testing.T) {
+	processor := &fakeProcessor{release: make(chan struct{}), started: make(chan string, 1)}
+	rnr := newRunnerForTest([]string{"1", "2", "3"}, processor, database.NewFake(), 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reports := make(chan *Report)
+	go func() {
+		report, err := rnr.Run(ctx)
+		if err != nil {
+			t.Errorf("Run() returns err: %v", err)
+		}
+		reports <- report
+	}()
+	<-processor.started
+	cancel()
+	report := <-reports
+
+	for _, result := range report.Users {
+		if result.Status != CanceledStatus {
+			t.Fatalf("Want every user canceled, got %v", result)
+		}
+	}
+	if len(processor.processed) != 1 {
+		t.Fatalf("Want 1 user started, got %v", processor.processed)
+	}
+}
+
+func TestAcquireLease(t *testing.T) {
+	fakeSQL := database.NewFake()
+	now := time.Now()
+
+	lease, err := database.AcquireLease(context.Background(), fakeSQL, leaseName, "1", "a", now, time.Minute)
+	if err != nil || lease == nil {
+		t.Fatalf("AcquireLease() returns %v, %v", lease, err)
+	}
+	if other, err := database.AcquireLease(context.Background(), fakeSQL, leaseName, "1", "b", now, time.Minute); err != nil || other != nil {
+		t.Fatalf("Want the held lease not acquired, got %v, %v", other, err)
+	}
+	if other, err := database.AcquireLease(context.Background(), fakeSQL, "other", "1", "b", now, time.Minute); err != nil || other == nil {
+		t.Fatalf("Want leases with other names acquired, got %v, %v", other, err)
+	}
+
+	// Expired leases are taken over, and can't be renewed by their old holder.
+	taken, err := database.AcquireLease(context.Background(), fakeSQL, leaseName, "1", "b", now.Add(time.Minute*2), time.Minute)
+	if err != nil || taken == nil || taken.Holder != "b" {
+		t.Fatalf("Want the expired lease taken over, got %v, %v", taken, err)
+	}
+	if err := database.RenewLease(context.Background(), fakeSQL, &database.Lease{Id: lease.Id, Holder: "a"}, now, time.Minute); err == nil {
+		t.Fatalf("Want err from RenewLease() of a lost lease")
+	}
+	if err := database.ReleaseLease(context.Background(), fakeSQL, taken); err != nil {
+		t.Fatalf("ReleaseLease() returns err: %v", err)
+	}
+	if lease, err := database.AcquireLease(context.Background(), fakeSQL, leaseName, "1", "a", now, time.Minute); err != nil || lease == nil {
+		t.Fatalf("Want the released lease acquired, got %v, %v", lease, err)
+	}
+}
+
+func TestAcquireLeaseConcurrently(t *testing.T) {
+	sql := &lockedSQL{sql: database.NewFake()}
+	holders := 10
+	leases := make(chan *database.Lease, holders)
+	var wg sync.WaitGroup
+	for i := 0; i < holders; i++ {
+		wg.Add(1)
+		go func(holder string) {
+			defer wg.Done()
+			lease, err := database.AcquireLease(context.Background(), sql, leaseName, "1", holder, time.Now(), time.Minute)
+			if err != nil {
+				t.Errorf("AcquireLease() returns err: %v", err)
+			}
+			leases <- lease
+		}(fmt.Sprintf("holder%d", i))
+	}
+	wg.Wait()
+	close(leases)
+
+	acquired := 0
+	for lease := range leases {
+		if lease != nil {
+			acquired++
+		}
+	}
+	if acquired != 1 {
+		t.Fatalf("Want the lease acquired by 1 holder, got %d", acquired)
+	}
+}
+
+func TestHandleRunAlgorithmsJob(t *testing.T) {
+	fakeSQL := database.NewFake()
+	processor := &fakeProcessor{failUserIDs: map[string]bool{"2": true}}
+	rnr := newRunnerForTest([]string{"1", "2", "3"}, processor, fakeSQL, 1)
+	ctx := context.Background()
+	if lease, err := database.AcquireLease(ctx, fakeSQL, leaseName, "3", "other", time.Now(), time.Hour); err != nil || lease == nil {
+		t.Fatalf("AcquireLease() returns %v, %v", lease, err)
+	}
+
+	allUsersJob, _ := jobqueue.NewJob(jobqueue.RunAlgorithms, "", nil)
+	for i := 0; i < 2; i++ {
+		if _, err := rnr.HandleRunAlgorithmsJob(ctx, allUsersJob); err != nil {
+			t.Fatalf("HandleRunAlgorithmsJob() returns err: %v", err)
+		}
+	}
+	// The second run found the first run's jobs pending.
+	wantErrs := map[string]bool{"1": false, "2": true, "3": true}
+	for i := 0; i < 3; i++ {
+		job, err := rnr.jobQueue.Dequeue(ctx, []string{jobqueue.RunAlgorithms}, time.Minute)
+		if err != nil || job == nil {
+			t.Fatalf("Want a RunAlgorithms job, got %v, %v", job, err)
+		}
+		result, err := rnr.HandleRunAlgorithmsJob(ctx, job)
+		if (err != nil) != wantErrs[job.UserId] {
+			t.Fatalf("HandleRunAlgorithmsJob() of user %q returns %q, %v", job.UserId, result, err)
+		}
+		// The outcome is reported even if the user failed.
+		userResult := &UserResult{}
+		if err := json.Unmarshal([]byte(result), userResult); err != nil || userResult.UserID != job.UserId {
+			t.Fatalf("Want the UserResult of user %q, got %q, %v", job.UserId, result, err)
+		}
+	}
+	if job, err := rnr.jobQueue.Dequeue(ctx, []string{jobqueue.RunAlgorithms}, time.Minute); err != nil || job != nil {
+		t.Fatalf("Want no more jobs, got %v, %v", job, err)
+	}
+	// User 3 is leased by another run.
+	if len(processor.processed) != 2 {
+		t.Fatalf("Want 2 users processed, got %v", processor.processed)
+	}
+}
@@ -1,11 +1,18 @@
 package syncer
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"os"
+	"seneca/api/senecaerror"
 	st "seneca/api/type"
+	"seneca/internal/client/database"
 	"seneca/internal/client/googledrive"
 	"seneca/internal/client/logging"
 	"seneca/internal/dao"
+	"seneca/internal/datagatherer/telemetryhandler"
+	"seneca/internal/jobqueue"
 	"time"
 )
 
@@ -13,23 +20,51 @@ type intraSenecaRequestInterface interface {
 	HandleRawVideoProcessRequest(req *st.RawVideoProcessRequest) (*st.RawVideoProcessResponse, error)
 }
 
+type telemetryHandlerInterface interface {
+	HandleProcessRequest(req *telemetryhandler.ProcessRequest) (*telemetryhandler.ProcessResponse, error)
+}
+
 type UserClientFactory interface {
 	New(user *st.User) (googledrive.GoogleDriveUserInterface, error)
 }
 
+// processRawVideoPayload is the payload of jobqueue.ProcessRawVideo jobs.
+type processRawVideoPayload struct {
+	FileID    string `json:"file_id"`
+	VideoName string `json:"video_name"`
+}
+
+// processTelemetryPayload is the payload of jobqueue.ProcessTelemetry jobs.
+type processTelemetryPayload struct {
+	FileID   string `json:"file_id"`
+	FileName string `json:"file_name"`
+}
+
+// syncUserResult is the result of the SyncUser jobs of users.
+type syncUserResult struct {
+	jobqueue.ChildJobs
+	// FailedFiles are the errors of the files that weren't queued, by file ID.
+	FailedFiles map[string]string `json:"failed_files,omitempty"`
+}
+
 type Syncer struct {
-	intraSeneca   intraSenecaRequestInterface
-	gdriveFactory UserClientFactory
-	userDAO       dao.UserDAO
-	logger        logging.LoggingInterface
+	intraSeneca      intraSenecaRequestInterface
+	telemetryHandler telemetryHandlerInterface
+	gdriveFactory    UserClientFactory
+	userDAO          dao.UserDAO
+	// jobQueue receives the ProcessRawVideo, ProcessTelemetry and SyncUser jobs the Syncer enqueues.
+	jobQueue jobqueue.Queue
+	logger   logging.LoggingInterface
 }
 
-func New(intraSeneca intraSenecaRequestInterface, gdriveFactory UserClientFactory, userDAO dao.UserDAO, logger logging.LoggingInterface) *Syncer {
+func New(intraSeneca intraSenecaRequestInterface, telemetryHandler telemetryHandlerInterface, gdriveFactory UserClientFactory, userDAO dao.UserDAO, jobQueue jobqueue.Queue, logger logging.LoggingInterface) *Syncer {
 	return &Syncer{
-		intraSeneca:   intraSeneca,
-		gdriveFactory: gdriveFactory,
-		userDAO:       userDAO,
-		logger:        logger,
+		intraSeneca:      intraSeneca,
+		telemetryHandler: telemetryHandler,
+		gdriveFactory:    gdriveFactory,
+		userDAO:          userDAO,
+		jobQueue:         jobQueue,
+		logger:           logger,
 	}
 }
 
@@ -68,45 +103,250 @@ func (sync *Syncer) SyncUser(id string) error {
 	sync.logger.Log(fmt.Sprintf("User with ID %q has %d files to process.", id, len(fileIDs)))
 
 	for _, fid := range fileIDs {
-
 		err := func() error {
 			fileInfo, err := userDriveClient.GetFileInfo(fid)
 			if err != nil {
 				return fmt.Errorf("userDriveClient.GetFileInfo(%s) for user %q returns err: %w", fid, user.Id, err)
 			}
-			if err := userDriveClient.MarkFileByID(fid, googledrive.WorkInProgress, false); err != nil {
-				sync.logger.Error(fmt.Sprintf("Error MarkFileByID(%s, %s, false) for user %q returns err: %v", fid, googledrive.WorkInProgress, id, err))
-			}
-			pathToFile, err := userDriveClient.DownloadFileByID(fid)
+			sync.markFile(userDriveClient, id, fid, googledrive.WorkInProgress)
+			_, err = sync.processVideo(userDriveClient, id, fid, fileInfo.FileName)
+			return err
+		}()
+
+		if err != nil {
+			// TODO(lucaloncar): add DUPLICATE_ prefix
+			sync.markFile(userDriveClient, id, fid, googledrive.Error)
+		} else {
+			sync.markFile(userDriveClient, id, fid, googledrive.Success)
+		}
+	}
+	sync.logger.Log(fmt.Sprintf("Finished syncing user %q", user.Email))
+	return nil
+}
+
+//	HandleSyncUserJob consumes jobqueue.SyncUser jobs.  It marks every new video and GPS log in the user's Google
+//	Drive as work in progress and enqueues a jobqueue.ProcessRawVideo or jobqueue.ProcessTelemetry job for it.  Jobs
+//	without a user enqueue a SyncUser job for every user instead.
+//	Params:
+//		ctx context.Context
+//		job *database.Job
+//	Returns:
+//		string: the JSON encoded jobqueue.ChildJobs, along with the errors of the files that weren't queued
+//		error: if any files weren't queued, the job is retried for them
+func (sync *Syncer) HandleSyncUserJob(ctx context.Context, job *database.Job) (string, error) {
+	if job.UserId == "" {
+		children := &jobqueue.ChildJobs{JobIDs: []string{}}
+		userIDs, err := sync.userDAO.ListAllUserIDs()
+		if err != nil {
+			return "", fmt.Errorf("error listing all users: %w", err)
+		}
+		for _, id := range userIDs {
+			child, err := sync.enqueue(ctx, jobqueue.SyncUser, id, nil)
 			if err != nil {
-				return fmt.Errorf("userDriveClient.DownloadFileByID(%s) for user %q returns err: %w", fid, user.Id, err)
+				return "", err
 			}
+			children.JobIDs = append(children.JobIDs, child.Id)
+		}
+		return encodeResult(children)
+	}
 
-			rawVideoProcessRequest := &st.RawVideoProcessRequest{
-				UserId:    id,
-				LocalPath: pathToFile,
-				VideoName: fileInfo.FileName,
-			}
+	user, err := sync.userDAO.GetUserByID(job.UserId)
+	if err != nil {
+		return "", fmt.Errorf("GetUserByID(%s) returns err: %w", job.UserId, err)
+	}
+	userDriveClient, err := sync.gdriveFactory.New(user)
+	if err != nil {
+		return "", fmt.Errorf("error initializing NewGoogleDriveUserClient - err: %w", err)
+	}
+	fileIDs, err := userDriveClient.ListFileIDs(googledrive.UnprocessedMP4s)
+	if err != nil {
+		return "", fmt.Errorf("ListFileIDs() returns err: %w", err)
+	}
+	telemetryFileIDs, err := userDriveClient.ListFileIDs(googledrive.UnprocessedTelemetry)
+	if err != nil {
+		return "", fmt.Errorf("ListFileIDs(%s) returns err: %w", googledrive.UnprocessedTelemetry, err)
+	}
+	isTelemetry := map[string]bool{}
+	for _, fid := range telemetryFileIDs {
+		isTelemetry[fid] = true
+	}
+	fileIDs = append(fileIDs, telemetryFileIDs...)
 
-			if _, err = sync.intraSeneca.HandleRawVideoProcessRequest(rawVideoProcessRequest); err != nil {
-				sync.logger.Error(fmt.Sprintf("Error in HandleRawVideoProcessRequest for user %q: %v", id, err))
+	result := &syncUserResult{ChildJobs: jobqueue.ChildJobs{JobIDs: []string{}}, FailedFiles: map[string]string{}}
+	var firstErr error
+	for _, fid := range fileIDs {
+		err := func() error {
+			// The name is read before it's prefixed.
+			fileInfo, err := userDriveClient.GetFileInfo(fid)
+			if err != nil {
+				return fmt.Errorf("userDriveClient.GetFileInfo(%s) for user %q returns err: %w", fid, user.Id, err)
+			}
+			// Marking the file first keeps it from being queued again by another sync.
+			if err := userDriveClient.MarkFileByID(fid, googledrive.WorkInProgress, false); err != nil {
+				return fmt.Errorf("MarkFileByID(%s, %s, false) for user %q returns err: %w", fid, googledrive.WorkInProgress, user.Id, err)
+			}
+			var child *database.Job
+			if isTelemetry[fid] {
+				child, err = sync.enqueue(ctx, jobqueue.ProcessTelemetry, user.Id, &processTelemetryPayload{FileID: fid, FileName: fileInfo.FileName})
+			} else {
+				child, err = sync.enqueue(ctx, jobqueue.ProcessRawVideo, user.Id, &processRawVideoPayload{FileID: fid, VideoName: fileInfo.FileName})
+			}
+			if err != nil {
+				// The file is unmarked, so the next sync queues it.
+				if err := userDriveClient.MarkFileByID(fid, googledrive.WorkInProgress, true); err != nil {
+					sync.logger.Error(fmt.Sprintf("Error MarkFileByID(%s, %s, true) for user %q returns err: %v", fid, googledrive.WorkInProgress, user.Id, err))
+				}
 				return err
 			}
-
+			result.JobIDs = append(result.JobIDs, child.Id)
 			return nil
 		}()
-
 		if err != nil {
-			// TODO(lucaloncar): add DUPLICATE_ prefix
-			if err := userDriveClient.MarkFileByID(fid, googledrive.Error, false); err != nil {
-				sync.logger.Error(fmt.Sprintf("Error MarkFileByID(%s, %s, false) for user %q returns err: %v", fid, googledrive.Error, id, err))
-			}
-		} else {
-			if err := userDriveClient.MarkFileByID(fid, googledrive.Success, false); err != nil {
-				sync.logger.Error(fmt.Sprintf("Error MarkFileByID(%s, %s, false) for user %q returns err: %v", fid, googledrive.Success, id, err))
+			if firstErr == nil {
+				firstErr = err
 			}
+			result.FailedFiles[fid] = err.Error()
 		}
 	}
-	sync.logger.Log(fmt.Sprintf("Finished syncing user %q", user.Email))
-	return nil
+	sync.logger.Log(fmt.Sprintf("Queued %d of %d files of user %q", len(result.JobIDs), len(fileIDs), user.Id))
+	encoded, err := encodeResult(result)
+	if err != nil {
+		return "", err
+	}
+	if firstErr != nil {
+		return encoded, fmt.Errorf("%d of %d files of user %q weren't queued, the first: %w", len(result.FailedFiles), len(fileIDs), user.Id, firstErr)
+	}
+	return encoded, nil
+}
+
+//	HandleProcessRawVideoJob consumes jobqueue.ProcessRawVideo jobs.  It downloads the video, processes it and marks
+//	it with the outcome in the user's Google Drive, though failures are only marked on the job's last attempt.
+//	Params:
+//		ctx context.Context
+//		job *database.Job
+//	Returns:
+//		string: the JSON encoded *st.RawVideoProcessResponse
+//		error
+func (sync *Syncer) HandleProcessRawVideoJob(ctx context.Context, job *database.Job) (string, error) {
+	payload := &processRawVideoPayload{}
+	if err := jobqueue.DecodePayload(job, payload); err != nil {
+		return "", err
+	}
+	user, err := sync.userDAO.GetUserByID(job.UserId)
+	if err != nil {
+		return "", fmt.Errorf("GetUserByID(%s) returns err: %w", job.UserId, err)
+	}
+	userDriveClient, err := sync.gdriveFactory.New(user)
+	if err != nil {
+		return "", fmt.Errorf("error initializing NewGoogleDriveUserClient - err: %w", err)
+	}
+
+	response, err := sync.processVideo(userDriveClient, user.Id, payload.FileID, payload.VideoName)
+	if err != nil {
+		if jobqueue.IsLastAttempt(job, err) {
+			sync.markFile(userDriveClient, user.Id, payload.FileID, googledrive.Error)
+		}
+		return "", err
+	}
+	sync.markFile(userDriveClient, user.Id, payload.FileID, googledrive.Success)
+	return encodeResult(response)
+}
+
+//	HandleProcessTelemetryJob consumes jobqueue.ProcessTelemetry jobs.  Like HandleProcessRawVideoJob, it downloads
+//	the GPS log, processes it and marks it with the outcome in the user's Google Drive.
+//	Params:
+//		ctx context.Context
+//		job *database.Job
+//	Returns:
+//		string: the JSON encoded *telemetryhandler.ProcessResponse
+//		error
+func (sync *Syncer) HandleProcessTelemetryJob(ctx context.Context, job *database.Job) (string, error) {
+	payload := &processTelemetryPayload{}
+	if err := jobqueue.DecodePayload(job, payload); err != nil {
+		return "", err
+	}
+	user, err := sync.userDAO.GetUserByID(job.UserId)
+	if err != nil {
+		return "", fmt.Errorf("GetUserByID(%s) returns err: %w", job.UserId, err)
+	}
+	userDriveClient, err := sync.gdriveFactory.New(user)
+	if err != nil {
+		return "", fmt.Errorf("error initializing NewGoogleDriveUserClient - err: %w", err)
+	}
+
+	response, err := sync.processTelemetry(userDriveClient, user.Id, payload.FileID, payload.FileName)
+	if err != nil {
+		if jobqueue.IsLastAttempt(job, err) {
+			sync.markFile(userDriveClient, user.Id, payload.FileID, googledrive.Error)
+		}
+		return "", err
+	}
+	sync.markFile(userDriveClient, user.Id, payload.FileID, googledrive.Success)
+	return encodeResult(response)
+}
+
+// processTelemetry downloads and processes the GPS log.
+func (sync *Syncer) processTelemetry(userDriveClient googledrive.GoogleDriveUserInterface, userID, fileID, fileName string) (*telemetryhandler.ProcessResponse, error) {
+	pathToFile, err := userDriveClient.DownloadFileByID(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("userDriveClient.DownloadFileByID(%s) for user %q returns err: %w", fileID, userID, err)
+	}
+	defer os.Remove(pathToFile)
+
+	response, err := sync.telemetryHandler.HandleProcessRequest(&telemetryhandler.ProcessRequest{
+		UserID:    userID,
+		FileName:  fileName,
+		LocalPath: pathToFile,
+	})
+	if err != nil {
+		sync.logger.Error(fmt.Sprintf("Error in HandleProcessRequest for telemetry file %q of user %q: %v", fileName, userID, err))
+		return nil, err
+	}
+	return response, nil
+}
+
+// processVideo downloads and processes the file.
+func (sync *Syncer) processVideo(userDriveClient googledrive.GoogleDriveUserInterface, userID, fileID, videoName string) (*st.RawVideoProcessResponse, error) {
+	pathToFile, err := userDriveClient.DownloadFileByID(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("userDriveClient.DownloadFileByID(%s) for user %q returns err: %w", fileID, userID, err)
+	}
+
+	rawVideoProcessRequest := &st.RawVideoProcessRequest{
+		UserId:    userID,
+		LocalPath: pathToFile,
+		VideoName: videoName,
+	}
+	response, err := sync.intraSeneca.HandleRawVideoProcessRequest(rawVideoProcessRequest)
+	if err != nil {
+		sync.logger.Error(fmt.Sprintf("Error in HandleRawVideoProcessRequest for user %q: %v", userID, err))
+		return nil, err
+	}
+	return response, nil
+}
+
+// markFile marks the file with the prefix, logging failures.
+func (sync *Syncer) markFile(userDriveClient googledrive.GoogleDriveUserInterface, userID, fileID string, prefix googledrive.FilePrefix) {
+	if err := userDriveClient.MarkFileByID(fileID, prefix, false); err != nil {
+		sync.logger.Error(fmt.Sprintf("Error MarkFileByID(%s, %s, false) for user %q returns err: %v", fileID, prefix, userID, err))
+	}
+}
+
+func (sync *Syncer) enqueue(ctx context.Context, jobType, userID string, payload interface{}) (*database.Job, error) {
+	job, err := jobqueue.NewJob(jobType, userID, payload)
+	if err != nil {
+		return nil, err
+	}
+	if job, err = sync.jobQueue.Enqueue(ctx, job); err != nil {
+		return nil, fmt.Errorf("error enqueuing %s job for user %q: %w", jobType, userID, err)
+	}
+	return job, nil
+}
+
+func encodeResult(result interface{}) (string, error) {
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return "", senecaerror.NewDevError(fmt.Errorf("error encoding job result: %w", err))
+	}
+	return string(encoded), nil
 }
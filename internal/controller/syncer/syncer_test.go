@@ -1,14 +1,20 @@
 package syncer
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"log"
+	"seneca/api/senecaerror"
 	st "seneca/api/type"
 	"seneca/internal/client/googledrive"
 	"seneca/internal/client/logging"
 	"seneca/internal/dao/userdao"
+	"seneca/internal/datagatherer/telemetryhandler"
+	"seneca/internal/jobqueue"
 	"seneca/test/testutil"
 	"testing"
+	"time"
 )
 
 func TestErrorHandling(t *testing.T) {
@@ -149,16 +155,202 @@ func (fis *fakeIntraSeneca) HandleRawVideoProcessRequest(req *st.RawVideoProcess
 	return fis.HandleRawVideoProcessRequestMock(req)
 }
 
+type fakeTelemetryHandler struct {
+	HandleProcessRequestMock func(req *telemetryhandler.ProcessRequest) (*telemetryhandler.ProcessResponse, error)
+}
+
+func (fth *fakeTelemetryHandler) HandleProcessRequest(req *telemetryhandler.ProcessRequest) (*telemetryhandler.ProcessResponse, error) {
+	if fth.HandleProcessRequestMock == nil {
+		log.Fatal("HandleProcessRequestMock not set.")
+	}
+	return fth.HandleProcessRequestMock(req)
+}
+
 func newSyncerForTests(logger logging.LoggingInterface) (*Syncer, *fakeIntraSeneca, *googledrive.FakeUserClientFactory, *userdao.MockUserDAO) {
 	intraSeneca := &fakeIntraSeneca{}
 	fakeGDrive := googledrive.NewFakeUserClientFactory()
 	mockUserDAO := &userdao.MockUserDAO{}
 
 	fakeSyncer := &Syncer{
-		intraSeneca:   intraSeneca,
-		gdriveFactory: fakeGDrive,
-		userDAO:       mockUserDAO,
-		logger:        logger,
+		intraSeneca:      intraSeneca,
+		telemetryHandler: &fakeTelemetryHandler{},
+		gdriveFactory:    fakeGDrive,
+		userDAO:          mockUserDAO,
+		logger:           logger,
 	}
 	return fakeSyncer, intraSeneca, fakeGDrive, mockUserDAO
 }
+
+func TestSyncJobs(t *testing.T) {
+	syncer, intraSeneca, fakeGDrive, mockUserDAO := newSyncerForTests(logging.NewLocalLogger(true))
+	queue := jobqueue.NewMemory(jobqueue.DefaultOptions())
+	syncer.jobQueue = queue
+	ctx := context.Background()
+
+	mockUserDAO.ListAllUserIDsMock = func() ([]string, error) {
+		return []string{testutil.TestUserID}, nil
+	}
+	mockUserDAO.GetUserByIDMock = func(id string) (*st.User, error) {
+		return &st.User{Id: id}, nil
+	}
+	marks := map[string]googledrive.FilePrefix{}
+	fakeClient := &googledrive.FakeGoogleDriveUserClient{}
+	fakeClient.ListFileIDsMock = func(gdQuery googledrive.GDriveQuery) ([]string, error) {
+		if gdQuery == googledrive.UnprocessedTelemetry {
+			return nil, nil
+		}
+		return []string{"good", "bad"}, nil
+	}
+	fakeClient.GetFileInfoMock = func(fileID string) (*googledrive.FileInfo, error) {
+		return &googledrive.FileInfo{FileName: fileID + ".mp4"}, nil
+	}
+	fakeClient.MarkFileByIDMock = func(fileID string, prefix googledrive.FilePrefix, remove bool) error {
+		marks[fileID] = prefix
+		return nil
+	}
+	fakeClient.DownloadFileByIDMock = func(fileID string) (string, error) {
+		return "/tmp/" + fileID, nil
+	}
+	fakeGDrive.InsertFakeClient(testutil.TestUserID, fakeClient, nil)
+	intraSeneca.HandleRawVideoProcessRequestMock = func(req *st.RawVideoProcessRequest) (*st.RawVideoProcessResponse, error) {
+		if req.VideoName == "bad.mp4" {
+			return nil, fmt.Errorf("error")
+		}
+		return &st.RawVideoProcessResponse{RawVideoId: "rv"}, nil
+	}
+
+	// A job without a user queues a job for every user.
+	allUsersJob, _ := jobqueue.NewJob(jobqueue.SyncUser, "", nil)
+	result, err := syncer.HandleSyncUserJob(ctx, allUsersJob)
+	if err != nil {
+		t.Fatalf("HandleSyncUserJob() returns err: %v", err)
+	}
+	children := &jobqueue.ChildJobs{}
+	if err := json.Unmarshal([]byte(result), children); err != nil || len(children.JobIDs) != 1 {
+		t.Fatalf("Want 1 SyncUser job queued, got %q, %v", result, err)
+	}
+	userJob, err := queue.Dequeue(ctx, []string{jobqueue.SyncUser}, time.Minute)
+	if err != nil || userJob == nil || userJob.UserId != testutil.TestUserID {
+		t.Fatalf("Want the user's SyncUser job, got %v, %v", userJob, err)
+	}
+
+	// Files that can't be marked aren't queued, and are reported.
+	fakeClient.MarkFileByIDMock = func(fileID string, prefix googledrive.FilePrefix, remove bool) error {
+		if fileID == "bad" {
+			return fmt.Errorf("error")
+		}
+		marks[fileID] = prefix
+		return nil
+	}
+	result, err = syncer.HandleSyncUserJob(ctx, userJob)
+	userResult := &syncUserResult{}
+	if err == nil || json.Unmarshal([]byte(result), userResult) != nil || len(userResult.JobIDs) != 1 || userResult.FailedFiles["bad"] == "" {
+		t.Fatalf("Want the bad file reported, got %q, %v", result, err)
+	}
+	// The retry only lists the file that wasn't queued.
+	fakeClient.ListFileIDsMock = func(gdQuery googledrive.GDriveQuery) ([]string, error) {
+		if gdQuery == googledrive.UnprocessedTelemetry {
+			return nil, nil
+		}
+		return []string{"bad"}, nil
+	}
+	fakeClient.MarkFileByIDMock = func(fileID string, prefix googledrive.FilePrefix, remove bool) error {
+		marks[fileID] = prefix
+		return nil
+	}
+	if _, err := syncer.HandleSyncUserJob(ctx, userJob); err != nil {
+		t.Fatalf("HandleSyncUserJob() returns err: %v", err)
+	}
+	if marks["good"] != googledrive.WorkInProgress || marks["bad"] != googledrive.WorkInProgress {
+		t.Fatalf("Want the queued files marked in progress, got %v", marks)
+	}
+
+	for i := 0; i < 2; i++ {
+		job, err := queue.Dequeue(ctx, []string{jobqueue.ProcessRawVideo}, time.Minute)
+		if err != nil || job == nil {
+			t.Fatalf("Want a ProcessRawVideo job, got %v, %v", job, err)
+		}
+		payload := &processRawVideoPayload{}
+		if err := jobqueue.DecodePayload(job, payload); err != nil {
+			t.Fatalf("DecodePayload() returns err: %v", err)
+		}
+		result, err := syncer.HandleProcessRawVideoJob(ctx, job)
+		if payload.FileID == "good" {
+			if err != nil || result != `{"raw_video_id":"rv"}` || marks["good"] != googledrive.Success {
+				t.Fatalf("Want the good file processed and marked, got %q, %v, %v", result, err, marks)
+			}
+			continue
+		}
+		// Failures are only marked once the job runs out of attempts.
+		if err == nil || marks["bad"] != googledrive.WorkInProgress {
+			t.Fatalf("Want the bad file failed but still in progress, got %v, %v", err, marks)
+		}
+		job.Attempts = job.MaxAttempts
+		if _, err := syncer.HandleProcessRawVideoJob(ctx, job); err == nil || marks["bad"] != googledrive.Error {
+			t.Fatalf("Want the bad file marked failed on the last attempt, got %v, %v", err, marks)
+		}
+	}
+}
+
+func TestSyncTelemetryJobs(t *testing.T) {
+	syncer, _, fakeGDrive, mockUserDAO := newSyncerForTests(logging.NewLocalLogger(true))
+	queue := jobqueue.NewMemory(jobqueue.DefaultOptions())
+	syncer.jobQueue = queue
+	ctx := context.Background()
+
+	mockUserDAO.GetUserByIDMock = func(id string) (*st.User, error) {
+		return &st.User{Id: id}, nil
+	}
+	marks := map[string]googledrive.FilePrefix{}
+	fakeClient := &googledrive.FakeGoogleDriveUserClient{}
+	fakeClient.ListFileIDsMock = func(gdQuery googledrive.GDriveQuery) ([]string, error) {
+		if gdQuery == googledrive.UnprocessedTelemetry {
+			return []string{"track", "duplicate"}, nil
+		}
+		return nil, nil
+	}
+	fakeClient.GetFileInfoMock = func(fileID string) (*googledrive.FileInfo, error) {
+		return &googledrive.FileInfo{FileName: fileID + ".gpx"}, nil
+	}
+	fakeClient.MarkFileByIDMock = func(fileID string, prefix googledrive.FilePrefix, remove bool) error {
+		marks[fileID] = prefix
+		return nil
+	}
+	fakeClient.DownloadFileByIDMock = func(fileID string) (string, error) {
+		return "/tmp/" + fileID, nil
+	}
+	fakeGDrive.InsertFakeClient(testutil.TestUserID, fakeClient, nil)
+	syncer.telemetryHandler.(*fakeTelemetryHandler).HandleProcessRequestMock = func(req *telemetryhandler.ProcessRequest) (*telemetryhandler.ProcessResponse, error) {
+		if req.FileName == "duplicate.gpx" {
+			return nil, senecaerror.NewUserError(req.UserID, fmt.Errorf("error"), "The file has no new samples.")
+		}
+		return &telemetryhandler.ProcessResponse{RawTelemetryFileID: "rtf", Samples: 10}, nil
+	}
+
+	userJob, _ := jobqueue.NewJob(jobqueue.SyncUser, testutil.TestUserID, nil)
+	if _, err := syncer.HandleSyncUserJob(ctx, userJob); err != nil {
+		t.Fatalf("HandleSyncUserJob() returns err: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		job, err := queue.Dequeue(ctx, []string{jobqueue.ProcessTelemetry}, time.Minute)
+		if err != nil || job == nil {
+			t.Fatalf("Want a ProcessTelemetry job, got %v, %v", job, err)
+		}
+		payload := &processTelemetryPayload{}
+		if err := jobqueue.DecodePayload(job, payload); err != nil {
+			t.Fatalf("DecodePayload() returns err: %v", err)
+		}
+		result, err := syncer.HandleProcessTelemetryJob(ctx, job)
+		if payload.FileID == "track" {
+			if err != nil || result != `{"raw_telemetry_file_id":"rtf","samples":10,"duplicates":0}` || marks["track"] != googledrive.Success {
+				t.Fatalf("Want the track processed and marked, got %q, %v, %v", result, err, marks)
+			}
+			continue
+		}
+		// Files without new samples can't succeed on a retry, so they're marked failed at once.
+		if err == nil || marks["duplicate"] != googledrive.Error {
+			t.Fatalf("Want the duplicate file marked failed, got %v, %v", err, marks)
+		}
+	}
+}
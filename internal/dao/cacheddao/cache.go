@@ -0,0 +1,131 @@
+package cacheddao
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// 	Stats counts the lookups and evictions of a Cache.
+type Stats struct {
+	Hits   int64
+	Misses int64
+	// Evictions counts entries dropped to stay within the size bound, not expired or invalidated ones.
+	Evictions int64
+}
+
+// 	Cache is a least recently used cache whose entries also expire after a TTL.  It's safe for concurrent use.
+type Cache struct {
+	mu         sync.Mutex
+	maxEntries int
+	ttl        time.Duration
+	// now is replaced in tests.
+	now     func() time.Time
+	order   *list.List
+	entries map[string]*list.Element
+	stats   Stats
+}
+
+type entry struct {
+	key       string
+	value     interface{}
+	expiresAt time.Time
+}
+
+//	NewCache returns an empty Cache.
+//	Params:
+//		maxEntries int: the least recently used entries are evicted past this many, must be positive
+//		ttl time.Duration: how long entries are served for after they're set, 0 for no expiry
+//	Returns:
+//		*Cache
+func NewCache(maxEntries int, ttl time.Duration) *Cache {
+	return &Cache{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		now:        time.Now,
+		order:      list.New(),
+		entries:    map[string]*list.Element{},
+	}
+}
+
+// 	Get returns the value set for key, if it's still there and hasn't expired, and counts a hit or miss.
+func (c *Cache) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if ok && c.ttl > 0 && !c.now().Before(element.Value.(*entry).expiresAt) {
+		c.remove(element)
+		ok = false
+	}
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+
+	c.stats.Hits++
+	c.order.MoveToFront(element)
+	return element.Value.(*entry).value, true
+}
+
+// 	Set sets the value of key, evicting the least recently used entry if the cache is full.
+func (c *Cache) Set(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := c.now().Add(c.ttl)
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*entry).value = value
+		element.Value.(*entry).expiresAt = expiresAt
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&entry{key: key, value: value, expiresAt: expiresAt})
+	for c.order.Len() > c.maxEntries {
+		c.remove(c.order.Back())
+		c.stats.Evictions++
+	}
+}
+
+// 	Delete removes key from the cache.
+func (c *Cache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+}
+
+// 	DeleteFunc removes every entry for which f returns true.
+func (c *Cache) DeleteFunc(f func(key string, value interface{}) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, element := range c.entries {
+		if f(key, element.Value.(*entry).value) {
+			c.remove(element)
+		}
+	}
+}
+
+// 	Len returns the number of entries, including expired ones that haven't been looked up since.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// 	Stats returns the counts so far.
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// remove must be called with mu held.
+func (c *Cache) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*entry).key)
+}
@@ -0,0 +1,73 @@
+package cacheddao
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewCache(2, 0)
+	cache.Set("a", 1)
+	cache.Set("b", 2)
+	if _, ok := cache.Get("a"); !ok {
+		t.Fatalf("Want a hit for %q", "a")
+	}
+	cache.Set("c", 3)
+
+	if _, ok := cache.Get("b"); ok {
+		t.Fatalf("Want %q evicted as the least recently used entry", "b")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := cache.Get(key); !ok {
+			t.Fatalf("Want a hit for %q", key)
+		}
+	}
+
+	if want, got := (Stats{Hits: 3, Misses: 1, Evictions: 1}), cache.Stats(); got != want {
+		t.Fatalf("Want stats %+v, got %+v", want, got)
+	}
+}
+
+func TestCacheExpiresEntries(t *testing.T) {
+	now := time.Date(2021, time.January, 10, 0, 0, 0, 0, time.UTC)
+	cache := NewCache(10, time.Minute)
+	cache.now = func() time.Time { return now }
+
+	cache.Set("a", 1)
+	now = now.Add(time.Second * 59)
+	if value, ok := cache.Get("a"); !ok || value != 1 {
+		t.Fatalf("Want 1 before the TTL, got %v, %t", value, ok)
+	}
+
+	// Setting again restarts the TTL.
+	cache.Set("a", 2)
+	now = now.Add(time.Second * 59)
+	if value, ok := cache.Get("a"); !ok || value != 2 {
+		t.Fatalf("Want 2 before the TTL, got %v, %t", value, ok)
+	}
+
+	now = now.Add(time.Second)
+	if _, ok := cache.Get("a"); ok {
+		t.Fatalf("Want a miss after the TTL")
+	}
+	if cache.Len() != 0 {
+		t.Fatalf("Want the expired entry removed, got %d entries", cache.Len())
+	}
+}
+
+func TestCacheDelete(t *testing.T) {
+	cache := NewCache(10, 0)
+	for _, key := range []string{"a", "b", "c"} {
+		cache.Set(key, key)
+	}
+
+	cache.Delete("a")
+	cache.Delete("missing")
+	cache.DeleteFunc(func(key string, value interface{}) bool {
+		return value == "b"
+	})
+
+	if _, ok := cache.Get("c"); !ok || cache.Len() != 1 {
+		t.Fatalf("Want only %q left, got %d entries", "c", cache.Len())
+	}
+}
@@ -0,0 +1,570 @@
+// Package cacheddao decorates the DAOs with read-through caches of the objects they get by ID.
+// Objects are invalidated when they're put or deleted through the decorators, and expire after the
+// caches' TTL, which bounds how stale objects written around the decorators can be.  Lists of IDs
+// aren't cached, since any insert can change them.
+package cacheddao
+
+import (
+	"context"
+	"seneca/api/constants"
+	st "seneca/api/type"
+	"seneca/internal/dao"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// 	Caches holds one Cache per table.
+type Caches struct {
+	Users             *Cache
+	RawVideos         *Cache
+	RawLocations      *Cache
+	RawFrames         *Cache
+	RawMotions        *Cache
+	Trips             *Cache
+	Events            *Cache
+	DrivingConditions *Cache
+}
+
+// 	NewCaches returns empty caches, each bounded by maxEntries and ttl as in NewCache().
+func NewCaches(maxEntries int, ttl time.Duration) *Caches {
+	return &Caches{
+		Users:             NewCache(maxEntries, ttl),
+		RawVideos:         NewCache(maxEntries, ttl),
+		RawLocations:      NewCache(maxEntries, ttl),
+		RawFrames:         NewCache(maxEntries, ttl),
+		RawMotions:        NewCache(maxEntries, ttl),
+		Trips:             NewCache(maxEntries, ttl),
+		Events:            NewCache(maxEntries, ttl),
+		DrivingConditions: NewCache(maxEntries, ttl),
+	}
+}
+
+// 	Stats returns the stats of each cache by the table it caches.
+func (c *Caches) Stats() map[constants.TableName]Stats {
+	return map[constants.TableName]Stats{
+		constants.UsersTable:            c.Users.Stats(),
+		constants.RawVideosTable:        c.RawVideos.Stats(),
+		constants.RawLocationsTable:     c.RawLocations.Stats(),
+		constants.RawFramesTable:        c.RawFrames.Stats(),
+		constants.RawMotionsTable:       c.RawMotions.Stats(),
+		constants.TripTable:             c.Trips.Stats(),
+		constants.EventTable:            c.Events.Stats(),
+		constants.DrivingConditionTable: c.DrivingConditions.Stats(),
+	}
+}
+
+// 	Wrap returns the DAOs decorated with the caches.
+func Wrap(daos *dao.AllDAOSet, caches *Caches) *dao.AllDAOSet {
+	return &dao.AllDAOSet{
+		UserDAO:             NewCachedUserDAO(daos.UserDAO, caches),
+		RawVideoDAO:         NewCachedRawVideoDAO(daos.RawVideoDAO, caches),
+		RawLocationDAO:      NewCachedRawLocationDAO(daos.RawLocationDAO, caches),
+		RawFrameDAO:         NewCachedRawFrameDAO(daos.RawFrameDAO, caches),
+		RawMotionDAO:        NewCachedRawMotionDAO(daos.RawMotionDAO, caches),
+		TripDAO:             NewCachedTripDAO(daos.TripDAO, caches),
+		EventDAO:            NewCachedEventDAO(daos.EventDAO, caches),
+		DrivingConditionDAO: NewCachedDrivingConditionDAO(daos.DrivingConditionDAO, caches),
+		// RawTelemetryFiles are only read when a user's data is deleted or exported, so they aren't cached.
+		RawTelemetryFileDAO: daos.RawTelemetryFileDAO,
+		// RawVehicleSignals are read once, by the dataprocessor, so they aren't cached either.
+		RawVehicleSignalDAO: daos.RawVehicleSignalDAO,
+	}
+}
+
+// getCached returns a copy of the cached object, so callers can modify it like one fresh from the store.
+// Objects valid() rejects, e.g. because they've been moved to another trip since, are dropped.
+func getCached(cache *Cache, id string, valid func(proto.Message) bool) (proto.Message, bool) {
+	value, ok := cache.Get(id)
+	if !ok {
+		return nil, false
+	}
+	message := value.(proto.Message)
+	if valid != nil && !valid(message) {
+		cache.Delete(id)
+		return nil, false
+	}
+	return proto.Clone(message), true
+}
+
+func setCached(cache *Cache, id string, message proto.Message) {
+	cache.Set(id, proto.Clone(message))
+}
+
+// getMulti serves what it can of ids from the cache, and the rest with one call to getMissing.
+func getMulti(cache *Cache, ids []string, valid func(proto.Message) bool, getMissing func(missingIDs []string) ([]proto.Message, error)) ([]proto.Message, error) {
+	messages := make([]proto.Message, len(ids))
+	missingIDs := []string{}
+	missingIndexes := []int{}
+	for i, id := range ids {
+		if message, ok := getCached(cache, id, valid); ok {
+			messages[i] = message
+			continue
+		}
+		missingIDs = append(missingIDs, id)
+		missingIndexes = append(missingIndexes, i)
+	}
+	if len(missingIDs) == 0 {
+		return messages, nil
+	}
+
+	missing, err := getMissing(missingIDs)
+	if err != nil {
+		return nil, err
+	}
+	for j, message := range missing {
+		messages[missingIndexes[j]] = message
+		setCached(cache, missingIDs[j], message)
+	}
+	return messages, nil
+}
+
+// invalidateUser drops the user's objects from the cache.
+func invalidateUser(cache *Cache, userID string) {
+	cache.DeleteFunc(func(key string, value interface{}) bool {
+		object, ok := value.(interface{ GetUserId() string })
+		return ok && object.GetUserId() == userID
+	})
+}
+
+// 	CachedUserDAO caches GetUserByID().
+type CachedUserDAO struct {
+	dao.UserDAO
+	cache *Cache
+}
+
+func NewCachedUserDAO(userDAO dao.UserDAO, caches *Caches) *CachedUserDAO {
+	return &CachedUserDAO{
+		UserDAO: userDAO,
+		cache:   caches.Users,
+	}
+}
+
+func (c *CachedUserDAO) GetUserByID(id string) (*st.User, error) {
+	if message, ok := getCached(c.cache, id, nil); ok {
+		return message.(*st.User), nil
+	}
+	user, err := c.UserDAO.GetUserByID(id)
+	if err != nil {
+		return nil, err
+	}
+	setCached(c.cache, id, user)
+	return user, nil
+}
+
+// 	CachedRawVideoDAO caches RawVideos by ID.
+type CachedRawVideoDAO struct {
+	dao.RawVideoDAO
+	cache *Cache
+}
+
+func NewCachedRawVideoDAO(rawVideoDAO dao.RawVideoDAO, caches *Caches) *CachedRawVideoDAO {
+	return &CachedRawVideoDAO{
+		RawVideoDAO: rawVideoDAO,
+		cache:       caches.RawVideos,
+	}
+}
+
+func (c *CachedRawVideoDAO) GetRawVideoByID(id string) (*st.RawVideo, error) {
+	if message, ok := getCached(c.cache, id, nil); ok {
+		return message.(*st.RawVideo), nil
+	}
+	rawVideo, err := c.RawVideoDAO.GetRawVideoByID(id)
+	if err != nil {
+		return nil, err
+	}
+	setCached(c.cache, id, rawVideo)
+	return rawVideo, nil
+}
+
+func (c *CachedRawVideoDAO) GetRawVideosByIDs(ids []string) ([]*st.RawVideo, error) {
+	messages, err := getMulti(c.cache, ids, nil, func(missingIDs []string) ([]proto.Message, error) {
+		rawVideos, err := c.RawVideoDAO.GetRawVideosByIDs(missingIDs)
+		messages := []proto.Message{}
+		for _, rawVideo := range rawVideos {
+			messages = append(messages, rawVideo)
+		}
+		return messages, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rawVideos := []*st.RawVideo{}
+	for _, message := range messages {
+		rawVideos = append(rawVideos, message.(*st.RawVideo))
+	}
+	return rawVideos, nil
+}
+
+func (c *CachedRawVideoDAO) PutRawVideoByID(ctx context.Context, rawVideoID string, rawVideo *st.RawVideo) error {
+	defer c.cache.Delete(rawVideoID)
+	return c.RawVideoDAO.PutRawVideoByID(ctx, rawVideoID, rawVideo)
+}
+
+func (c *CachedRawVideoDAO) DeleteRawVideoByID(id string) error {
+	defer c.cache.Delete(id)
+	return c.RawVideoDAO.DeleteRawVideoByID(id)
+}
+
+// 	CachedRawLocationDAO caches RawLocations by ID.
+type CachedRawLocationDAO struct {
+	dao.RawLocationDAO
+	cache *Cache
+}
+
+func NewCachedRawLocationDAO(rawLocationDAO dao.RawLocationDAO, caches *Caches) *CachedRawLocationDAO {
+	return &CachedRawLocationDAO{
+		RawLocationDAO: rawLocationDAO,
+		cache:          caches.RawLocations,
+	}
+}
+
+func (c *CachedRawLocationDAO) GetRawLocationByID(id string) (*st.RawLocation, error) {
+	if message, ok := getCached(c.cache, id, nil); ok {
+		return message.(*st.RawLocation), nil
+	}
+	rawLocation, err := c.RawLocationDAO.GetRawLocationByID(id)
+	if err != nil {
+		return nil, err
+	}
+	setCached(c.cache, id, rawLocation)
+	return rawLocation, nil
+}
+
+func (c *CachedRawLocationDAO) GetRawLocationsByIDs(ids []string) ([]*st.RawLocation, error) {
+	messages, err := getMulti(c.cache, ids, nil, func(missingIDs []string) ([]proto.Message, error) {
+		rawLocations, err := c.RawLocationDAO.GetRawLocationsByIDs(missingIDs)
+		messages := []proto.Message{}
+		for _, rawLocation := range rawLocations {
+			messages = append(messages, rawLocation)
+		}
+		return messages, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rawLocations := []*st.RawLocation{}
+	for _, message := range messages {
+		rawLocations = append(rawLocations, message.(*st.RawLocation))
+	}
+	return rawLocations, nil
+}
+
+func (c *CachedRawLocationDAO) PutRawLocationByID(ctx context.Context, rawLocationID string, rawLocation *st.RawLocation) error {
+	defer c.cache.Delete(rawLocationID)
+	return c.RawLocationDAO.PutRawLocationByID(ctx, rawLocationID, rawLocation)
+}
+
+func (c *CachedRawLocationDAO) DeleteRawLocationByID(id string) error {
+	defer c.cache.Delete(id)
+	return c.RawLocationDAO.DeleteRawLocationByID(id)
+}
+
+// 	CachedRawFrameDAO caches RawFrames by ID.
+type CachedRawFrameDAO struct {
+	dao.RawFrameDAO
+	cache *Cache
+}
+
+func NewCachedRawFrameDAO(rawFrameDAO dao.RawFrameDAO, caches *Caches) *CachedRawFrameDAO {
+	return &CachedRawFrameDAO{
+		RawFrameDAO: rawFrameDAO,
+		cache:       caches.RawFrames,
+	}
+}
+
+func (c *CachedRawFrameDAO) GetRawFrameByID(id string) (*st.RawFrame, error) {
+	if message, ok := getCached(c.cache, id, nil); ok {
+		return message.(*st.RawFrame), nil
+	}
+	rawFrame, err := c.RawFrameDAO.GetRawFrameByID(id)
+	if err != nil {
+		return nil, err
+	}
+	setCached(c.cache, id, rawFrame)
+	return rawFrame, nil
+}
+
+func (c *CachedRawFrameDAO) GetRawFramesByIDs(ids []string) ([]*st.RawFrame, error) {
+	messages, err := getMulti(c.cache, ids, nil, func(missingIDs []string) ([]proto.Message, error) {
+		rawFrames, err := c.RawFrameDAO.GetRawFramesByIDs(missingIDs)
+		messages := []proto.Message{}
+		for _, rawFrame := range rawFrames {
+			messages = append(messages, rawFrame)
+		}
+		return messages, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rawFrames := []*st.RawFrame{}
+	for _, message := range messages {
+		rawFrames = append(rawFrames, message.(*st.RawFrame))
+	}
+	return rawFrames, nil
+}
+
+func (c *CachedRawFrameDAO) PutRawFrameByID(ctx context.Context, rawFrameID string, rawFrame *st.RawFrame) error {
+	defer c.cache.Delete(rawFrameID)
+	return c.RawFrameDAO.PutRawFrameByID(ctx, rawFrameID, rawFrame)
+}
+
+func (c *CachedRawFrameDAO) DeleteRawFrameByID(id string) error {
+	defer c.cache.Delete(id)
+	return c.RawFrameDAO.DeleteRawFrameByID(id)
+}
+
+// 	CachedRawMotionDAO caches RawMotions by ID.
+type CachedRawMotionDAO struct {
+	dao.RawMotionDAO
+	cache *Cache
+}
+
+func NewCachedRawMotionDAO(rawMotionDAO dao.RawMotionDAO, caches *Caches) *CachedRawMotionDAO {
+	return &CachedRawMotionDAO{
+		RawMotionDAO: rawMotionDAO,
+		cache:        caches.RawMotions,
+	}
+}
+
+func (c *CachedRawMotionDAO) GetRawMotionByID(id string) (*st.RawMotion, error) {
+	if message, ok := getCached(c.cache, id, nil); ok {
+		return message.(*st.RawMotion), nil
+	}
+	rawMotion, err := c.RawMotionDAO.GetRawMotionByID(id)
+	if err != nil {
+		return nil, err
+	}
+	setCached(c.cache, id, rawMotion)
+	return rawMotion, nil
+}
+
+func (c *CachedRawMotionDAO) GetRawMotionsByIDs(ids []string) ([]*st.RawMotion, error) {
+	messages, err := getMulti(c.cache, ids, nil, func(missingIDs []string) ([]proto.Message, error) {
+		rawMotions, err := c.RawMotionDAO.GetRawMotionsByIDs(missingIDs)
+		messages := []proto.Message{}
+		for _, rawMotion := range rawMotions {
+			messages = append(messages, rawMotion)
+		}
+		return messages, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rawMotions := []*st.RawMotion{}
+	for _, message := range messages {
+		rawMotions = append(rawMotions, message.(*st.RawMotion))
+	}
+	return rawMotions, nil
+}
+
+func (c *CachedRawMotionDAO) PutRawMotionByID(ctx context.Context, rawMotionID string, rawMotion *st.RawMotion) error {
+	defer c.cache.Delete(rawMotionID)
+	return c.RawMotionDAO.PutRawMotionByID(ctx, rawMotionID, rawMotion)
+}
+
+func (c *CachedRawMotionDAO) DeleteRawMotionByID(id string) error {
+	defer c.cache.Delete(id)
+	return c.RawMotionDAO.DeleteRawMotionByID(id)
+}
+
+// 	CachedTripDAO caches trips by ID.
+type CachedTripDAO struct {
+	dao.TripDAO
+	cache *Cache
+}
+
+func NewCachedTripDAO(tripDAO dao.TripDAO, caches *Caches) *CachedTripDAO {
+	return &CachedTripDAO{
+		TripDAO: tripDAO,
+		cache:   caches.Trips,
+	}
+}
+
+func (c *CachedTripDAO) GetTripByID(userID, tripID string) (*st.TripInternal, error) {
+	if message, ok := getCached(c.cache, tripID, tripOf(userID)); ok {
+		return message.(*st.TripInternal), nil
+	}
+	trip, err := c.TripDAO.GetTripByID(userID, tripID)
+	if err != nil {
+		return nil, err
+	}
+	setCached(c.cache, tripID, trip)
+	return trip, nil
+}
+
+func (c *CachedTripDAO) GetTripsByIDs(userID string, tripIDs []string) ([]*st.TripInternal, error) {
+	messages, err := getMulti(c.cache, tripIDs, tripOf(userID), func(missingIDs []string) ([]proto.Message, error) {
+		trips, err := c.TripDAO.GetTripsByIDs(userID, missingIDs)
+		messages := []proto.Message{}
+		for _, trip := range trips {
+			messages = append(messages, trip)
+		}
+		return messages, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	trips := []*st.TripInternal{}
+	for _, message := range messages {
+		trips = append(trips, message.(*st.TripInternal))
+	}
+	return trips, nil
+}
+
+func (c *CachedTripDAO) PutTripByID(ctx context.Context, tripID string, trip *st.TripInternal) error {
+	defer c.cache.Delete(tripID)
+	return c.TripDAO.PutTripByID(ctx, tripID, trip)
+}
+
+func (c *CachedTripDAO) DeleteTripByID(ctx context.Context, tripID string) error {
+	defer c.cache.Delete(tripID)
+	return c.TripDAO.DeleteTripByID(ctx, tripID)
+}
+
+// tripOf accepts cached trips of the user.
+func tripOf(userID string) func(proto.Message) bool {
+	return func(message proto.Message) bool {
+		return message.(*st.TripInternal).UserId == userID
+	}
+}
+
+// 	CachedEventDAO caches events by ID.
+type CachedEventDAO struct {
+	dao.EventDAO
+	cache *Cache
+}
+
+func NewCachedEventDAO(eventDAO dao.EventDAO, caches *Caches) *CachedEventDAO {
+	return &CachedEventDAO{
+		EventDAO: eventDAO,
+		cache:    caches.Events,
+	}
+}
+
+func (c *CachedEventDAO) GetEventByID(userID, tripID, eventID string) (*st.EventInternal, error) {
+	if message, ok := getCached(c.cache, eventID, eventOf(userID, tripID)); ok {
+		return message.(*st.EventInternal), nil
+	}
+	event, err := c.EventDAO.GetEventByID(userID, tripID, eventID)
+	if err != nil {
+		return nil, err
+	}
+	setCached(c.cache, eventID, event)
+	return event, nil
+}
+
+func (c *CachedEventDAO) GetEventsByIDs(userID, tripID string, eventIDs []string) ([]*st.EventInternal, error) {
+	messages, err := getMulti(c.cache, eventIDs, eventOf(userID, tripID), func(missingIDs []string) ([]proto.Message, error) {
+		events, err := c.EventDAO.GetEventsByIDs(userID, tripID, missingIDs)
+		messages := []proto.Message{}
+		for _, event := range events {
+			messages = append(messages, event)
+		}
+		return messages, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	events := []*st.EventInternal{}
+	for _, message := range messages {
+		events = append(events, message.(*st.EventInternal))
+	}
+	return events, nil
+}
+
+func (c *CachedEventDAO) PutEventByID(ctx context.Context, userID, tripID, eventID string, event *st.EventInternal) error {
+	defer c.cache.Delete(eventID)
+	return c.EventDAO.PutEventByID(ctx, userID, tripID, eventID, event)
+}
+
+func (c *CachedEventDAO) DeleteEventByID(ctx context.Context, userID, tripID, eventID string) error {
+	defer c.cache.Delete(eventID)
+	return c.EventDAO.DeleteEventByID(ctx, userID, tripID, eventID)
+}
+
+// eventOf accepts cached events of the user's trip.
+func eventOf(userID, tripID string) func(proto.Message) bool {
+	return func(message proto.Message) bool {
+		event := message.(*st.EventInternal)
+		return event.UserId == userID && event.TripId == tripID
+	}
+}
+
+// 	CachedDrivingConditionDAO caches driving conditions by ID.
+type CachedDrivingConditionDAO struct {
+	dao.DrivingConditionDAO
+	cache  *Cache
+	caches *Caches
+}
+
+func NewCachedDrivingConditionDAO(drivingConditionDAO dao.DrivingConditionDAO, caches *Caches) *CachedDrivingConditionDAO {
+	return &CachedDrivingConditionDAO{
+		DrivingConditionDAO: drivingConditionDAO,
+		cache:               caches.DrivingConditions,
+		caches:              caches,
+	}
+}
+
+// 	CreateDrivingCondition may merge the user's trips, which rewrites trips, and moves events and driving
+// 	conditions between them, so all of those are invalidated for the user.
+func (c *CachedDrivingConditionDAO) CreateDrivingCondition(ctx context.Context, drivingCondition *st.DrivingConditionInternal) (*st.DrivingConditionInternal, error) {
+	userID := drivingCondition.UserId
+	defer func() {
+		invalidateUser(c.caches.Trips, userID)
+		invalidateUser(c.caches.Events, userID)
+		invalidateUser(c.caches.DrivingConditions, userID)
+	}()
+	return c.DrivingConditionDAO.CreateDrivingCondition(ctx, drivingCondition)
+}
+
+func (c *CachedDrivingConditionDAO) GetDrivingConditionByID(userID, tripID, drivingConditionID string) (*st.DrivingConditionInternal, error) {
+	if message, ok := getCached(c.cache, drivingConditionID, drivingConditionOf(userID, tripID)); ok {
+		return message.(*st.DrivingConditionInternal), nil
+	}
+	drivingCondition, err := c.DrivingConditionDAO.GetDrivingConditionByID(userID, tripID, drivingConditionID)
+	if err != nil {
+		return nil, err
+	}
+	setCached(c.cache, drivingConditionID, drivingCondition)
+	return drivingCondition, nil
+}
+
+func (c *CachedDrivingConditionDAO) GetDrivingConditionsByIDs(userID, tripID string, drivingConditionIDs []string) ([]*st.DrivingConditionInternal, error) {
+	messages, err := getMulti(c.cache, drivingConditionIDs, drivingConditionOf(userID, tripID), func(missingIDs []string) ([]proto.Message, error) {
+		drivingConditions, err := c.DrivingConditionDAO.GetDrivingConditionsByIDs(userID, tripID, missingIDs)
+		messages := []proto.Message{}
+		for _, drivingCondition := range drivingConditions {
+			messages = append(messages, drivingCondition)
+		}
+		return messages, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	drivingConditions := []*st.DrivingConditionInternal{}
+	for _, message := range messages {
+		drivingConditions = append(drivingConditions, message.(*st.DrivingConditionInternal))
+	}
+	return drivingConditions, nil
+}
+
+func (c *CachedDrivingConditionDAO) DeleteDrivingConditionByID(ctx context.Context, userID, tripID, drivingConditionID string) error {
+	defer c.cache.Delete(drivingConditionID)
+	return c.DrivingConditionDAO.DeleteDrivingConditionByID(ctx, userID, tripID, drivingConditionID)
+}
+
+// drivingConditionOf accepts cached driving conditions of the user's trip.
+func drivingConditionOf(userID, tripID string) func(proto.Message) bool {
+	return func(message proto.Message) bool {
+		drivingCondition := message.(*st.DrivingConditionInternal)
+		return drivingCondition.UserId == userID && drivingCondition.TripId == tripID
+	}
+}
@@ -0,0 +1,123 @@
+package cacheddao_test
+
+import (
+	"context"
+	"errors"
+	"seneca/api/constants"
+	"seneca/api/senecaerror"
+	st "seneca/api/type"
+	"seneca/internal/client/database"
+	"seneca/internal/client/logging"
+	"seneca/internal/dao/cacheddao"
+	"seneca/internal/dao/sqldaoset"
+	"seneca/internal/util"
+	"seneca/test/testutil"
+	"testing"
+	"time"
+)
+
+func TestCachedRawVideoDAO(t *testing.T) {
+	fakeSQL := database.NewFake()
+	caches := cacheddao.NewCaches(100, time.Hour)
+	daos := cacheddao.Wrap(sqldaoset.New(fakeSQL, logging.NewLocalLogger(true), time.Minute), caches)
+
+	rawVideo, err := daos.RawVideoDAO.InsertUniqueRawVideo(&st.RawVideo{UserId: testutil.TestUserID, CloudStorageFileName: "gs://bucket/a.mp4"})
+	if err != nil {
+		t.Fatalf("InsertUniqueRawVideo() returns err: %v", err)
+	}
+
+	fakeSQL.RoundTrips = 0
+	for i := 0; i < 3; i++ {
+		got, err := daos.RawVideoDAO.GetRawVideoByID(rawVideo.Id)
+		if err != nil {
+			t.Fatalf("GetRawVideoByID() returns err: %v", err)
+		}
+		// Callers get copies, so they can't change the cached object.
+		got.CloudStorageFileName = "changed"
+	}
+	if fakeSQL.RoundTrips != 1 {
+		t.Fatalf("Want 1 round trip for 3 gets, got %d", fakeSQL.RoundTrips)
+	}
+	if want, got := (cacheddao.Stats{Hits: 2, Misses: 1}), caches.Stats()[constants.RawVideosTable]; got != want {
+		t.Fatalf("Want stats %+v, got %+v", want, got)
+	}
+
+	rawVideo.CloudStorageFileName = "gs://bucket/b.mp4"
+	if err := daos.RawVideoDAO.PutRawVideoByID(context.TODO(), rawVideo.Id, rawVideo); err != nil {
+		t.Fatalf("PutRawVideoByID() returns err: %v", err)
+	}
+	got, err := daos.RawVideoDAO.GetRawVideoByID(rawVideo.Id)
+	if err != nil || got.CloudStorageFileName != "gs://bucket/b.mp4" {
+		t.Fatalf("Want the put RawVideo after PutRawVideoByID(), got %v, %v", got, err)
+	}
+
+	otherRawVideo, err := daos.RawVideoDAO.InsertUniqueRawVideo(&st.RawVideo{UserId: testutil.TestUserID, CloudStorageFileName: "gs://bucket/c.mp4", CreateTimeMs: 1000000})
+	if err != nil {
+		t.Fatalf("InsertUniqueRawVideo() returns err: %v", err)
+	}
+	fakeSQL.RoundTrips = 0
+	rawVideos, err := daos.RawVideoDAO.GetRawVideosByIDs([]string{otherRawVideo.Id, rawVideo.Id})
+	if err != nil {
+		t.Fatalf("GetRawVideosByIDs() returns err: %v", err)
+	}
+	if len(rawVideos) != 2 || rawVideos[0].Id != otherRawVideo.Id || rawVideos[1].Id != rawVideo.Id {
+		t.Fatalf("Want RawVideos in the order of their IDs, got %v", rawVideos)
+	}
+	if fakeSQL.RoundTrips != 1 {
+		t.Fatalf("Want 1 round trip for the uncached RawVideo, got %d", fakeSQL.RoundTrips)
+	}
+
+	if err := daos.RawVideoDAO.DeleteRawVideoByID(rawVideo.Id); err != nil {
+		t.Fatalf("DeleteRawVideoByID() returns err: %v", err)
+	}
+	var nfe *senecaerror.NotFoundError
+	if _, err := daos.RawVideoDAO.GetRawVideoByID(rawVideo.Id); !errors.As(err, &nfe) {
+		t.Fatalf("Want NotFoundError after DeleteRawVideoByID(), got %v", err)
+	}
+}
+
+func TestCachedDAOsInvalidateMergedTrips(t *testing.T) {
+	userID := testutil.TestUserID
+	fakeSQL := database.NewFake()
+	daos := cacheddao.Wrap(sqldaoset.New(fakeSQL, logging.NewLocalLogger(true), time.Minute), cacheddao.NewCaches(100, time.Hour))
+
+	day := func(d int) int64 {
+		return util.TimeToMilliseconds(time.Date(2021, time.January, d, 0, 0, 0, 0, time.UTC))
+	}
+	first, err := daos.DrivingConditionDAO.CreateDrivingCondition(context.TODO(), &st.DrivingConditionInternal{UserId: userID, StartTimeMs: day(10), EndTimeMs: day(12)})
+	if err != nil {
+		t.Fatalf("CreateDrivingCondition() returns err: %v", err)
+	}
+	if _, err := daos.DrivingConditionDAO.CreateDrivingCondition(context.TODO(), &st.DrivingConditionInternal{UserId: userID, StartTimeMs: day(14), EndTimeMs: day(16)}); err != nil {
+		t.Fatalf("CreateDrivingCondition() returns err: %v", err)
+	}
+	event, err := daos.EventDAO.CreateEvent(context.TODO(), &st.EventInternal{UserId: userID, TimestampMs: day(11)})
+	if err != nil {
+		t.Fatalf("CreateEvent() returns err: %v", err)
+	}
+
+	// Cache the trip and its event before the merge.
+	if _, err := daos.TripDAO.GetTripByID(userID, first.TripId); err != nil {
+		t.Fatalf("GetTripByID() returns err: %v", err)
+	}
+	if _, err := daos.EventDAO.GetEventsByIDs(userID, first.TripId, []string{event.Id}); err != nil {
+		t.Fatalf("GetEventsByIDs() returns err: %v", err)
+	}
+
+	bridge, err := daos.DrivingConditionDAO.CreateDrivingCondition(context.TODO(), &st.DrivingConditionInternal{UserId: userID, StartTimeMs: day(12), EndTimeMs: day(14)})
+	if err != nil {
+		t.Fatalf("CreateDrivingCondition() returns err: %v", err)
+	}
+
+	trip, err := daos.TripDAO.GetTripByID(userID, bridge.TripId)
+	if err != nil {
+		t.Fatalf("GetTripByID() returns err: %v", err)
+	}
+	if trip.StartTimeMs != day(10) || trip.EndTimeMs != day(16) {
+		t.Fatalf("Want the merged trip to span both trips, got %v", trip)
+	}
+	events, err := daos.EventDAO.GetEventsByIDs(userID, bridge.TripId, []string{event.Id})
+	if err != nil || len(events) != 1 || events[0].TripId != bridge.TripId {
+		t.Fatalf("Want the event moved to the merged trip, got %v, %v", events, err)
+	}
+}
@@ -4,10 +4,11 @@ package dao
 import (
 	"context"
 	st "seneca/api/type"
+	"seneca/internal/client/database"
 	"time"
 )
 
-// TODO(lucaloncar): remove parent ID params, but enforce parent IDs upon insertion
+// TODO(lucaloncar): remove parent ID params, now that integrity.SQLService enforces parent IDs upon insertion
 
 type AllDAOSet struct {
 	UserDAO             UserDAO
@@ -18,6 +19,13 @@ type AllDAOSet struct {
 	TripDAO             TripDAO
 	EventDAO            EventDAO
 	DrivingConditionDAO DrivingConditionDAO
+	RawTelemetryFileDAO RawTelemetryFileDAO
+	RawVehicleSignalDAO RawVehicleSignalDAO
+}
+
+// TransactionRunner runs f with DAOs whose writes are committed together, or not at all if f returns an error.
+type TransactionRunner interface {
+	RunInTransaction(ctx context.Context, f func(daos *AllDAOSet) error) error
 }
 
 type UserDAO interface {
@@ -31,43 +39,78 @@ type RawVideoDAO interface {
 	InsertUniqueRawVideo(rawVideo *st.RawVideo) (*st.RawVideo, error)
 	PutRawVideoByID(ctx context.Context, rawVideoID string, rawVideo *st.RawVideo) error
 	GetRawVideoByID(id string) (*st.RawVideo, error)
+	GetRawVideosByIDs(ids []string) ([]*st.RawVideo, error)
 	ListUnprocessedRawVideoIDs(userID string, latestVersion float64) ([]string, error)
 	ListUserRawVideoIDs(userID string) ([]string, error)
+	ListUserRawVideoIDsPage(userID, cursor string, limit int) ([]string, string, error)
 	DeleteRawVideoByID(id string) error
 }
 
 type RawLocationDAO interface {
 	InsertUniqueRawLocation(rawLocation *st.RawLocation) (*st.RawLocation, error)
+	InsertUniqueRawLocations(rawLocations []*st.RawLocation) ([]*st.RawLocation, error)
 	PutRawLocationByID(ctx context.Context, rawLocationID string, rawLocation *st.RawLocation) error
 	GetRawLocationByID(id string) (*st.RawLocation, error)
+	GetRawLocationsByIDs(ids []string) ([]*st.RawLocation, error)
 	ListUnprocessedRawLocationsIDs(userID string, latestVersion float64) ([]string, error)
 	ListUserRawLocationIDs(userID string) ([]string, error)
+	ListUserRawLocationIDsPage(userID, cursor string, limit int) ([]string, string, error)
+	ListUserRawLocationIDsByTime(userID string, startTime time.Time, endTime time.Time) ([]string, error)
 	DeleteRawLocationByID(id string) error
 }
 
 type RawFrameDAO interface {
 	InsertUniqueRawFrame(rawFrame *st.RawFrame) (*st.RawFrame, error)
+	InsertUniqueRawFrames(rawFrames []*st.RawFrame) ([]*st.RawFrame, error)
 	PutRawFrameByID(ctx context.Context, rawFrameID string, rawFrame *st.RawFrame) error
 	GetRawFrameByID(id string) (*st.RawFrame, error)
+	GetRawFramesByIDs(ids []string) ([]*st.RawFrame, error)
 	ListUnprocessedRawFramesIDs(userID string, latestVersion float64) ([]string, error)
 	ListUserRawFrameIDs(userID string) ([]string, error)
+	ListUserRawFrameIDsPage(userID, cursor string, limit int) ([]string, string, error)
+	ListUserRawFrameIDsByTime(userID string, startTime time.Time, endTime time.Time) ([]string, error)
 	DeleteRawFrameByID(id string) error
 }
 
 type RawMotionDAO interface {
 	InsertUniqueRawMotion(rawMotion *st.RawMotion) (*st.RawMotion, error)
+	InsertUniqueRawMotions(rawMotions []*st.RawMotion) ([]*st.RawMotion, error)
 	PutRawMotionByID(ctx context.Context, rawMotionID string, rawMotion *st.RawMotion) error
 	ListUnprocessedRawMotionIDs(userID string, latestVersion float64) ([]string, error)
 	GetRawMotionByID(id string) (*st.RawMotion, error)
+	GetRawMotionsByIDs(ids []string) ([]*st.RawMotion, error)
 	ListUserRawMotionIDs(userID string) ([]string, error)
+	ListUserRawMotionIDsPage(userID, cursor string, limit int) ([]string, string, error)
+	ListUserRawMotionIDsByTime(userID string, startTime time.Time, endTime time.Time) ([]string, error)
 	DeleteRawMotionByID(id string) error
 }
 
+type RawTelemetryFileDAO interface {
+	InsertUniqueRawTelemetryFile(rawTelemetryFile *database.RawTelemetryFile) (*database.RawTelemetryFile, error)
+	GetRawTelemetryFileByID(id string) (*database.RawTelemetryFile, error)
+	ListUserRawTelemetryFileIDs(userID string) ([]string, error)
+	DeleteRawTelemetryFileByID(id string) error
+}
+
+type RawVehicleSignalDAO interface {
+	InsertUniqueRawVehicleSignals(rawVehicleSignals []*database.RawVehicleSignal) ([]*database.RawVehicleSignal, error)
+	PutRawVehicleSignalByID(ctx context.Context, rawVehicleSignalID string, rawVehicleSignal *database.RawVehicleSignal) error
+	PutRawVehicleSignalsByIDs(ctx context.Context, rawVehicleSignalIDs []string, rawVehicleSignals []*database.RawVehicleSignal) error
+	ListUnprocessedRawVehicleSignalIDs(userID string, latestVersion float64) ([]string, error)
+	GetRawVehicleSignalByID(id string) (*database.RawVehicleSignal, error)
+	GetRawVehicleSignalsByIDs(ids []string) ([]*database.RawVehicleSignal, error)
+	ListUserRawVehicleSignalIDs(userID string) ([]string, error)
+	ListUserRawVehicleSignalIDsByTime(userID string, startTime time.Time, endTime time.Time) ([]string, error)
+	DeleteRawVehicleSignalByID(id string) error
+}
+
 type TripDAO interface {
 	CreateUniqueTrip(ctx context.Context, trip *st.TripInternal) (*st.TripInternal, error)
 	PutTripByID(ctx context.Context, tripID string, trip *st.TripInternal) error
 	GetTripByID(userID, tripID string) (*st.TripInternal, error)
+	GetTripsByIDs(userID string, tripIDs []string) ([]*st.TripInternal, error)
 	ListUserTripIDs(userID string) ([]string, error)
+	ListUserTripIDsPage(userID, cursor string, limit int) ([]string, string, error)
 	ListUserTripIDsByTime(userID string, startTime time.Time, endTime time.Time) ([]string, error)
 	DeleteTripByID(ctx context.Context, tripID string) error
 }
@@ -75,7 +118,9 @@ type TripDAO interface {
 type EventDAO interface {
 	CreateEvent(ctx context.Context, event *st.EventInternal) (*st.EventInternal, error)
 	GetEventByID(userID, tripID, eventID string) (*st.EventInternal, error)
+	GetEventsByIDs(userID, tripID string, eventIDs []string) ([]*st.EventInternal, error)
 	ListTripEventIDs(userID, tripID string) ([]string, error)
+	ListTripEventIDsPage(userID, tripID, cursor string, limit int) ([]string, string, error)
 	DeleteEventByID(ctx context.Context, userID, tripID, eventID string) error
 	PutEventByID(ctx context.Context, userID, tripID, eventID string, event *st.EventInternal) error
 }
@@ -83,6 +128,7 @@ type EventDAO interface {
 type DrivingConditionDAO interface {
 	CreateDrivingCondition(ctx context.Context, drivingCondition *st.DrivingConditionInternal) (*st.DrivingConditionInternal, error)
 	GetDrivingConditionByID(userID, tripID, drivingConditionID string) (*st.DrivingConditionInternal, error)
+	GetDrivingConditionsByIDs(userID, tripID string, drivingConditionIDs []string) ([]*st.DrivingConditionInternal, error)
 	ListTripDrivingConditionIDs(userID, tripID string) ([]string, error)
 	DeleteDrivingConditionByID(ctx context.Context, userID, tripID, eventID string) error
 }
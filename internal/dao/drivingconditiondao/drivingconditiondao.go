@@ -7,7 +7,10 @@ import (
 	"seneca/api/senecaerror"
 	st "seneca/api/type"
 	"seneca/internal/client/database"
+	"seneca/internal/client/logging"
 	"seneca/internal/dao"
+	"seneca/internal/dao/eventdao"
+	"seneca/internal/dao/tripdao"
 	"seneca/internal/util"
 	"sort"
 	"time"
@@ -15,40 +18,61 @@ import (
 
 type SQLDrivingConditionDAO struct {
 	sql      database.SQLInterface
-	tripDAO  dao.TripDAO
-	eventDAO dao.EventDAO
+	tripDAOs TripDAOsFunc
 }
 
-func NewSQLDrivingConditionDAO(sql database.SQLInterface, tripDAO dao.TripDAO, eventDAO dao.EventDAO) *SQLDrivingConditionDAO {
+// TripDAOsFunc returns the trip and event DAOs that driving conditions' trips are merged with, built on sql.  It's
+// called with the transaction a driving condition is created in, so that merging trips is all or nothing.
+type TripDAOsFunc func(sql database.SQLInterface) (dao.TripDAO, dao.EventDAO)
+
+// SQLTripDAOs returns a TripDAOsFunc for the plain SQL trip and event DAOs.
+func SQLTripDAOs(logger logging.LoggingInterface) TripDAOsFunc {
+	return func(sql database.SQLInterface) (dao.TripDAO, dao.EventDAO) {
+		tripDAO := tripdao.NewSQLTripDAO(sql, logger)
+		return tripDAO, eventdao.NewSQLEventDAO(sql, tripDAO, logger)
+	}
+}
+
+func NewSQLDrivingConditionDAO(sql database.SQLInterface, tripDAOs TripDAOsFunc) *SQLDrivingConditionDAO {
 	return &SQLDrivingConditionDAO{
 		sql:      sql,
-		tripDAO:  tripDAO,
-		eventDAO: eventDAO,
+		tripDAOs: tripDAOs,
 	}
 }
 
 func (ddao *SQLDrivingConditionDAO) CreateDrivingCondition(ctx context.Context, drivingCondition *st.DrivingConditionInternal) (*st.DrivingConditionInternal, error) {
-	// Check if there're a existing trips.
-	tripIDs, err := ddao.tripDAO.ListUserTripIDsByTime(drivingCondition.UserId, util.MillisecondsToTime(drivingCondition.StartTimeMs), util.MillisecondsToTime(drivingCondition.EndTimeMs))
-	if err != nil {
-		return nil, fmt.Errorf("error checking for existing trip: %w", err)
-	}
+	// The trips are merged and the condition is created together, so a failure never leaves half-merged trips.
+	err := ddao.sql.RunInTransaction(ctx, func(tx database.SQLInterface) error {
+		txDAO := NewSQLDrivingConditionDAO(tx, ddao.tripDAOs)
+		tripDAO, eventDAO := ddao.tripDAOs(tx)
 
-	tripID, err := ddao.mergeTrips(drivingCondition, tripIDs)
-	if err != nil {
-		return nil, fmt.Errorf("error trying to merge parent trips: %w", err)
-	}
+		// Check if there're a existing trips.
+		tripIDs, err := tripDAO.ListUserTripIDsByTime(drivingCondition.UserId, util.MillisecondsToTime(drivingCondition.StartTimeMs), util.MillisecondsToTime(drivingCondition.EndTimeMs))
+		if err != nil {
+			return fmt.Errorf("error checking for existing trip: %w", err)
+		}
 
-	drivingCondition.TripId = tripID
+		tripID, err := txDAO.mergeTrips(tripDAO, eventDAO, drivingCondition, tripIDs)
+		if err != nil {
+			return fmt.Errorf("error trying to merge parent trips: %w", err)
+		}
 
-	drivingConditionID, err := ddao.sql.Create(constants.DrivingConditionTable, drivingCondition)
-	if err != nil {
-		return nil, fmt.Errorf("error creating drivingCondition %v - err: %w", drivingCondition, err)
-	}
+		drivingCondition.TripId = tripID
+
+		drivingConditionID, err := tx.Create(constants.DrivingConditionTable, drivingCondition)
+		if err != nil {
+			return fmt.Errorf("error creating drivingCondition %v - err: %w", drivingCondition, err)
+		}
 
-	drivingCondition.Id = drivingConditionID
-	if err := ddao.sql.Insert(constants.DrivingConditionTable, drivingCondition.Id, drivingCondition); err != nil {
-		return nil, fmt.Errorf("error updating drivingConditionID %q: %w", drivingCondition.Id, err)
+		drivingCondition.Id = drivingConditionID
+		if err := tx.Insert(constants.DrivingConditionTable, drivingCondition.Id, drivingCondition); err != nil {
+			return fmt.Errorf("error updating drivingConditionID %q: %w", drivingCondition.Id, err)
+		}
+		return nil
+	})
+	if err != nil {
+		drivingCondition.Id = ""
+		return nil, err
 	}
 
 	return drivingCondition, nil
@@ -75,14 +99,37 @@ func (ddao *SQLDrivingConditionDAO) GetDrivingConditionByID(userID, tripID, driv
 	return drivingCondition, nil
 }
 
+func (ddao *SQLDrivingConditionDAO) GetDrivingConditionsByIDs(userID, tripID string, drivingConditionIDs []string) ([]*st.DrivingConditionInternal, error) {
+	objects, err := ddao.sql.GetByIDs(constants.DrivingConditionTable, drivingConditionIDs)
+	if err != nil {
+		return nil, fmt.Errorf("error getting %d drivingConditions by ID: %w", len(drivingConditionIDs), err)
+	}
+
+	drivingConditions := []*st.DrivingConditionInternal{}
+	for _, object := range objects {
+		drivingCondition, ok := object.(*st.DrivingConditionInternal)
+		if !ok {
+			return nil, fmt.Errorf("want type DrivingConditionInternal, got %T", object)
+		}
+		if drivingCondition.UserId != userID || drivingCondition.TripId != tripID {
+			return nil, senecaerror.NewBadStateError(fmt.Errorf("mismatch between user or trip IDs (want, got) tripIDs(%s, %s) userIDs(%s, %s)", tripID, drivingCondition.TripId, userID, drivingCondition.UserId))
+		}
+		drivingConditions = append(drivingConditions, drivingCondition)
+	}
+
+	return drivingConditions, nil
+}
+
 func (ddao *SQLDrivingConditionDAO) ListTripDrivingConditionIDs(userID, tripID string) ([]string, error) {
 	return ddao.sql.ListIDs(constants.DrivingConditionTable, []*database.QueryParam{{FieldName: constants.TripIDFieldName, Operand: "=", Value: tripID}})
 }
 func (ddao *SQLDrivingConditionDAO) DeleteDrivingConditionByID(ctx context.Context, userID, tripID, drivingConditionID string) error {
-	return ddao.sql.DeleteByID(constants.DrivingConditionTable, drivingConditionID)
+	_, err := database.SoftDelete(ctx, ddao.sql, constants.DrivingConditionTable, drivingConditionID, database.DeleteReason)
+	return err
 }
 
-func (ddao SQLDrivingConditionDAO) mergeTrips(drivingCondition *st.DrivingConditionInternal, tripIDs []string) (string, error) {
+// mergeTrips must be called on a DAO, and with trip and event DAOs, built on a transaction.
+func (ddao *SQLDrivingConditionDAO) mergeTrips(tripDAO dao.TripDAO, eventDAO dao.EventDAO, drivingCondition *st.DrivingConditionInternal, tripIDs []string) (string, error) {
 	// Merge and sort.
 	trips := []*st.TripInternal{
 		{
@@ -93,7 +140,7 @@ func (ddao SQLDrivingConditionDAO) mergeTrips(drivingCondition *st.DrivingCondit
 	}
 	if len(tripIDs) > 0 {
 		for _, tid := range tripIDs {
-			trip, err := ddao.tripDAO.GetTripByID(drivingCondition.UserId, tid)
+			trip, err := tripDAO.GetTripByID(drivingCondition.UserId, tid)
 			if err != nil {
 				return "", fmt.Errorf("error getting trip by ID %q - err: %w", tid, err)
 			}
@@ -113,7 +160,7 @@ func (ddao SQLDrivingConditionDAO) mergeTrips(drivingCondition *st.DrivingCondit
 	}
 
 	if winnerTrip == nil {
-		newTrip, err := ddao.tripDAO.CreateUniqueTrip(context.TODO(), trips[0])
+		newTrip, err := tripDAO.CreateUniqueTrip(context.TODO(), trips[0])
 		if err != nil {
 			return "", fmt.Errorf("erroring creating new trip: %w", err)
 		}
@@ -135,34 +182,38 @@ func (ddao SQLDrivingConditionDAO) mergeTrips(drivingCondition *st.DrivingCondit
 		}
 
 		// Re-assign children.
-		eventIDs, err := ddao.eventDAO.ListTripEventIDs(drivingCondition.UserId, tp.Id)
+		eventIDs, err := eventDAO.ListTripEventIDs(drivingCondition.UserId, tp.Id)
 		if err != nil {
 			return "", fmt.Errorf("error listing eventIDs for tripID %q - err: %w", tp.Id, err)
 		}
+		events := []interface{}{}
 		for _, eid := range eventIDs {
-			event, err := ddao.eventDAO.GetEventByID(drivingCondition.UserId, tp.Id, eid)
+			event, err := eventDAO.GetEventByID(drivingCondition.UserId, tp.Id, eid)
 			if err != nil {
 				return "", fmt.Errorf("error getting event by ID %q - err: %w", eid, err)
 			}
 			event.TripId = winnerTrip.Id
-			if err := ddao.eventDAO.PutEventByID(context.TODO(), event.UserId, event.TripId, event.Id, event); err != nil {
-				return "", fmt.Errorf("error putting event %v - err: %w", event, err)
-			}
+			events = append(events, event)
+		}
+		if err := ddao.sql.InsertMulti(constants.EventTable, eventIDs, events); err != nil {
+			return "", fmt.Errorf("error putting %d events for tripID %q - err: %w", len(events), tp.Id, err)
 		}
 
 		existingDrivingConditionIDs, err := ddao.ListTripDrivingConditionIDs(drivingCondition.UserId, tp.Id)
 		if err != nil {
 			return "", fmt.Errorf("error listing existingDrivingConditionIDs for tripID %q - err: %w", tp.Id, err)
 		}
+		conditions := []interface{}{}
 		for _, edci := range existingDrivingConditionIDs {
 			condition, err := ddao.GetDrivingConditionByID(drivingCondition.UserId, tp.Id, edci)
 			if err != nil {
 				return "", fmt.Errorf("error getting existingDrivingCondition with userID %q, tripID %q, ID %q  - err: %w", tp.UserId, tp.Id, edci, err)
 			}
 			condition.TripId = winnerTrip.Id
-			if err := ddao.sql.Insert(constants.DrivingConditionTable, condition.Id, condition); err != nil {
-				return "", fmt.Errorf("error putting existingDrivingCondition %v - err: %w", condition, err)
-			}
+			conditions = append(conditions, condition)
+		}
+		if err := ddao.sql.InsertMulti(constants.DrivingConditionTable, existingDrivingConditionIDs, conditions); err != nil {
+			return "", fmt.Errorf("error putting %d existingDrivingConditions for tripID %q - err: %w", len(conditions), tp.Id, err)
 		}
 	}
 
@@ -173,18 +224,20 @@ func (ddao SQLDrivingConditionDAO) mergeTrips(drivingCondition *st.DrivingCondit
 		EndTimeMs:   newEndTime,
 	}
 
-	if err := ddao.tripDAO.PutTripByID(context.TODO(), winnerTrip.Id, winnerTrip); err != nil {
+	if err := tripDAO.PutTripByID(context.TODO(), winnerTrip.Id, winnerTrip); err != nil {
 		return "", fmt.Errorf("error updating new trip with ID %q: %w", winnerTrip.Id, err)
 	}
 
 	// Delete old trips.
+	oldTripIDs := []string{}
 	for _, tp := range trips {
 		if tp.Id != winnerTrip.Id && tp.Id != "" {
-			if err := ddao.tripDAO.DeleteTripByID(context.TODO(), tp.Id); err != nil {
-				return "", fmt.Errorf("error deleting trip %q by ID: %w", tp.Id, err)
-			}
+			oldTripIDs = append(oldTripIDs, tp.Id)
 		}
 	}
+	if err := ddao.sql.DeleteMulti(constants.TripTable, oldTripIDs); err != nil {
+		return "", fmt.Errorf("error deleting trips %v by ID: %w", oldTripIDs, err)
+	}
 
 	return winnerTrip.Id, nil
 }
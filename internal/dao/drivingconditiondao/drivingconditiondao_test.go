@@ -2,11 +2,14 @@ package drivingconditiondao_test
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"math/rand"
+	"seneca/api/constants"
 	st "seneca/api/type"
 	"seneca/internal/client/database"
 	"seneca/internal/client/logging"
+	"seneca/internal/dao"
 	"seneca/internal/dao/drivingconditiondao"
 	"seneca/internal/dao/eventdao"
 	"seneca/internal/dao/tripdao"
@@ -102,5 +105,99 @@ func newDrivingConditionDAOForTest() (*drivingconditiondao.SQLDrivingConditionDA
 	tripDAO := tripdao.NewSQLTripDAO(fakeSQLService, logger)
 	eventDAO := eventdao.NewSQLEventDAO(fakeSQLService, tripDAO, logger)
 
-	return drivingconditiondao.NewSQLDrivingConditionDAO(fakeSQLService, tripDAO, eventDAO), tripDAO, eventDAO, fakeSQLService
+	return drivingconditiondao.NewSQLDrivingConditionDAO(fakeSQLService, drivingconditiondao.SQLTripDAOs(logger)), tripDAO, eventDAO, fakeSQLService
+}
+
+func TestCreateDrivingConditionRollsBackFailedMerge(t *testing.T) {
+	userID := testutil.TestUserID
+	fakeSQLService := database.NewFake()
+	logger := logging.NewLocalLogger(true)
+	tripDAO := tripdao.NewSQLTripDAO(fakeSQLService, logger)
+	eventDAO := eventdao.NewSQLEventDAO(fakeSQLService, tripDAO, logger)
+
+	drivingConditionDAO := drivingconditiondao.NewSQLDrivingConditionDAO(fakeSQLService, drivingconditiondao.SQLTripDAOs(logger))
+	for _, day := range []int{10, 20} {
+		if _, err := drivingConditionDAO.CreateDrivingCondition(context.TODO(), &st.DrivingConditionInternal{
+			UserId:      userID,
+			StartTimeMs: util.TimeToMilliseconds(time.Date(2021, time.January, day, 0, 0, 0, 0, time.UTC)),
+			EndTimeMs:   util.TimeToMilliseconds(time.Date(2021, time.January, day+5, 0, 0, 0, 0, time.UTC)),
+		}); err != nil {
+			t.Fatalf("CreateDrivingCondition() returns err: %v", err)
+		}
+		if _, err := eventDAO.CreateEvent(context.TODO(), &st.EventInternal{
+			UserId:      userID,
+			TimestampMs: util.TimeToMilliseconds(time.Date(2021, time.January, day+1, 0, 0, 0, 0, time.UTC)),
+		}); err != nil {
+			t.Fatalf("CreateEvent() returns err: %v", err)
+		}
+	}
+
+	tripIDs, err := tripDAO.ListUserTripIDs(userID)
+	if err != nil || len(tripIDs) != 2 {
+		t.Fatalf("Want 2 trips before the merge, got %v, %v", tripIDs, err)
+	}
+
+	// Bridging the two trips fails once the children are re-parented, when the old trip is deleted.
+	failingDAO := drivingconditiondao.NewSQLDrivingConditionDAO(&failingDeleteMultiSQL{fakeSQLService}, drivingconditiondao.SQLTripDAOs(logger))
+	bridge := &st.DrivingConditionInternal{
+		UserId:      userID,
+		StartTimeMs: util.TimeToMilliseconds(time.Date(2021, time.January, 14, 0, 0, 0, 0, time.UTC)),
+		EndTimeMs:   util.TimeToMilliseconds(time.Date(2021, time.January, 21, 0, 0, 0, 0, time.UTC)),
+	}
+	if _, err := failingDAO.CreateDrivingCondition(context.TODO(), bridge); err == nil {
+		t.Fatalf("Want err from CreateDrivingCondition() when DeleteMulti() fails, got nil")
+	}
+
+	gotTripIDs, err := tripDAO.ListUserTripIDs(userID)
+	if err != nil || len(gotTripIDs) != 2 {
+		t.Fatalf("Want both trips after the failed merge, got %v, %v", gotTripIDs, err)
+	}
+	for _, tripID := range tripIDs {
+		eventIDs, err := eventDAO.ListTripEventIDs(userID, tripID)
+		if err != nil || len(eventIDs) != 1 {
+			t.Fatalf("Want trip %q to keep its 1 event, got %v, %v", tripID, eventIDs, err)
+		}
+		conditionIDs, err := drivingConditionDAO.ListTripDrivingConditionIDs(userID, tripID)
+		if err != nil || len(conditionIDs) != 1 {
+			t.Fatalf("Want trip %q to keep its 1 drivingCondition, got %v, %v", tripID, conditionIDs, err)
+		}
+	}
+}
+
+func TestCreateDrivingConditionUsesInjectedTripDAOs(t *testing.T) {
+	fakeSQLService := database.NewFake()
+	logger := logging.NewLocalLogger(false)
+	sqlTripDAOs := drivingconditiondao.SQLTripDAOs(logger)
+	calls := 0
+	tripDAOs := func(sql database.SQLInterface) (dao.TripDAO, dao.EventDAO) {
+		calls++
+		return sqlTripDAOs(sql)
+	}
+
+	drivingConditionDAO := drivingconditiondao.NewSQLDrivingConditionDAO(fakeSQLService, tripDAOs)
+	if _, err := drivingConditionDAO.CreateDrivingCondition(context.TODO(), &st.DrivingConditionInternal{
+		UserId:      testutil.TestUserID,
+		StartTimeMs: util.TimeToMilliseconds(time.Date(2021, time.January, 10, 0, 0, 0, 0, time.UTC)),
+		EndTimeMs:   util.TimeToMilliseconds(time.Date(2021, time.January, 11, 0, 0, 0, 0, time.UTC)),
+	}); err != nil {
+		t.Fatalf("CreateDrivingCondition() returns err: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Want the injected trip DAOs built once, got %d times", calls)
+	}
+}
+
+// failingDeleteMultiSQL fails every DeleteMulti(), also inside transactions.
+type failingDeleteMultiSQL struct {
+	*database.FakeSQLDBService
+}
+
+func (f *failingDeleteMultiSQL) DeleteMulti(tableName constants.TableName, ids []string) error {
+	return fmt.Errorf("induced DeleteMulti() failure")
+}
+
+func (f *failingDeleteMultiSQL) RunInTransaction(ctx context.Context, fn func(tx database.SQLInterface) error) error {
+	return f.FakeSQLDBService.RunInTransaction(ctx, func(tx database.SQLInterface) error {
+		return fn(f)
+	})
 }
@@ -92,10 +92,42 @@ func (edao *SQLEventDAO) GetEventByID(userID, tripID, eventID string) (*st.Event
 	return event, nil
 }
 
+func (edao *SQLEventDAO) GetEventsByIDs(userID, tripID string, eventIDs []string) ([]*st.EventInternal, error) {
+	objects, err := edao.sql.GetByIDs(constants.EventTable, eventIDs)
+	if err != nil {
+		return nil, fmt.Errorf("error getting %d events by ID: %w", len(eventIDs), err)
+	}
+
+	events := []*st.EventInternal{}
+	for _, object := range objects {
+		event, ok := object.(*st.EventInternal)
+		if !ok {
+			return nil, fmt.Errorf("want type EventInternal, got %T", object)
+		}
+		if event.UserId != userID || event.TripId != tripID {
+			return nil, senecaerror.NewBadStateError(fmt.Errorf("mismatch between user or trip IDs (want, got) tripIDs(%s, %s) userIDs(%s, %s)", tripID, event.TripId, userID, event.UserId))
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
 func (edao *SQLEventDAO) ListTripEventIDs(userID, tripID string) ([]string, error) {
 	return edao.sql.ListIDs(constants.EventTable, []*database.QueryParam{{FieldName: constants.TripIDFieldName, Operand: "=", Value: tripID}})
 }
 
+func (edao *SQLEventDAO) ListTripEventIDsPage(userID, tripID, cursor string, limit int) ([]string, string, error) {
+	query := database.NewQuery(constants.EventTable).
+		Where(constants.UserIDFieldName, "=", userID).
+		Where(constants.TripIDFieldName, "=", tripID).
+		OrderBy(constants.TimestampFieldName).
+		WithLimit(limit).
+		WithCursor(cursor)
+	return edao.sql.ListIDsByQuery(query)
+}
+
 func (edao *SQLEventDAO) DeleteEventByID(ctx context.Context, userID, tripID, eventID string) error {
-	return edao.sql.DeleteByID(constants.EventTable, eventID)
+	_, err := database.SoftDelete(ctx, edao.sql, constants.EventTable, eventID, database.DeleteReason)
+	return err
 }
@@ -2,6 +2,8 @@ package eventdao_test
 
 import (
 	"context"
+	"errors"
+	"seneca/api/senecaerror"
 	st "seneca/api/type"
 	"seneca/internal/client/database"
 	"seneca/internal/client/logging"
@@ -137,6 +139,18 @@ func TestGetListEventByID(t *testing.T) {
 		t.Fatalf("Want eventIDs of length 1, got %d", len(eventIDs))
 	}
 
+	events, err := eventDAO.GetEventsByIDs(eventWithID.UserId, eventWithID.TripId, eventIDs)
+	if err != nil {
+		t.Fatalf("GetEventsByIDs() returns err: %v", err)
+	}
+	if len(events) != 1 || events[0].Id != eventWithID.Id {
+		t.Fatalf("Want event %q, got %v", eventWithID.Id, events)
+	}
+	var bse *senecaerror.BadStateError
+	if _, err := eventDAO.GetEventsByIDs(eventWithID.UserId, "othertrip", eventIDs); !errors.As(err, &bse) {
+		t.Fatalf("Want BadStateError from GetEventsByIDs() for trip ID mismatch, got %v", err)
+	}
+
 	if err := eventDAO.DeleteEventByID(context.TODO(), eventWithID.UserId, eventWithID.TripId, eventWithID.Id); err != nil {
 		t.Fatalf("DeleteEventByID() returns err: %v", err)
 	}
@@ -147,7 +161,7 @@ func newEventDAOForTest() (*eventdao.SQLEventDAO, dao.TripDAO, dao.DrivingCondit
 	logger := logging.NewLocalLogger(false)
 	tripDAO := tripdao.NewSQLTripDAO(fakeSQLService, logger)
 	eventDAO := eventdao.NewSQLEventDAO(fakeSQLService, tripDAO, logger)
-	drivingConditionDAO := drivingconditiondao.NewSQLDrivingConditionDAO(fakeSQLService, tripDAO, eventDAO)
+	drivingConditionDAO := drivingconditiondao.NewSQLDrivingConditionDAO(fakeSQLService, drivingconditiondao.SQLTripDAOs(logger))
 
 	return eventDAO, tripDAO, drivingConditionDAO
 }
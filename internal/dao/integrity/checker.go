@@ -0,0 +1,108 @@
+package integrity
+
+import (
+	"context"
+	"fmt"
+	"seneca/api/constants"
+	"seneca/internal/client/database"
+	"seneca/internal/client/logging"
+)
+
+// checkPageSize is how many objects are read from the database at a time.
+const checkPageSize = 500
+
+// 	Issue is an invalid reference of an object.
+type Issue struct {
+	TableName constants.TableName
+	ID        string
+	UserID    string
+	// Problem describes the reference, e.g. that the object's user doesn't exist.
+	Problem string
+}
+
+func (i *Issue) String() string {
+	return fmt.Sprintf("%s %q of user %q: %s", i.TableName, i.ID, i.UserID, i.Problem)
+}
+
+// 	Report is the result of a run of the Checker.
+type Report struct {
+	// Scanned counts the objects that were checked by table.
+	Scanned map[constants.TableName]int
+	Issues  []*Issue
+}
+
+// 	Checker checks the references of every object in the database, reporting orphans, i.e. objects whose user or
+// 	trip doesn't exist or belongs to another user, and dangling or cyclic chains of Sources.
+type Checker struct {
+	sql    database.SQLInterface
+	logger logging.LoggingInterface
+}
+
+func NewChecker(sqlInterface database.SQLInterface, logger logging.LoggingInterface) *Checker {
+	return &Checker{
+		sql:    sqlInterface,
+		logger: logger,
+	}
+}
+
+//	Check checks every object in the constants.DataTableNames.  It doesn't change the database.
+//	Params:
+//		ctx context.Context
+//	Returns:
+//		*Report
+//		error
+func (c *Checker) Check(ctx context.Context) (*Report, error) {
+	report := &Report{
+		Scanned: map[constants.TableName]int{},
+		Issues:  []*Issue{},
+	}
+	// The validator is shared across tables, so that each referenced object is only read once.
+	v := newValidator(c.sql)
+	for _, tableName := range constants.DataTableNames {
+		if err := c.checkTable(ctx, v, tableName, report); err != nil {
+			return nil, fmt.Errorf("error checking table %q: %w", tableName, err)
+		}
+		c.logger.Log(fmt.Sprintf("Checked %d objects in table %q.", report.Scanned[tableName], tableName))
+	}
+	return report, nil
+}
+
+func (c *Checker) checkTable(ctx context.Context, v *validator, tableName constants.TableName, report *Report) error {
+	query := database.NewQuery(tableName).WithLimit(checkPageSize)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		ids, nextCursor, err := c.sql.ListIDsByQuery(query)
+		if err != nil {
+			return fmt.Errorf("error listing IDs: %w", err)
+		}
+		objects, err := database.GetExisting(c.sql, tableName, ids)
+		if err != nil {
+			return err
+		}
+		for i, object := range objects {
+			// The object was deleted since it was listed.
+			if object == nil {
+				continue
+			}
+			report.Scanned[tableName]++
+			problems, err := v.problems(tableName, ids[i], object, true)
+			if err != nil {
+				return err
+			}
+			for _, problem := range problems {
+				report.Issues = append(report.Issues, &Issue{
+					TableName: tableName,
+					ID:        ids[i],
+					UserID:    userIDOf(object),
+					Problem:   problem,
+				})
+			}
+		}
+		if nextCursor == "" {
+			return nil
+		}
+		query.WithCursor(nextCursor)
+	}
+}
@@ -0,0 +1,72 @@
+package integrity
+
+import (
+	"context"
+	"seneca/api/constants"
+	st "seneca/api/type"
+	"seneca/internal/client/database"
+	"seneca/internal/client/logging"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	fakeSQL := database.NewFake()
+	create := func(tableName constants.TableName, object interface{}) string {
+		id, err := fakeSQL.Create(tableName, object)
+		if err != nil {
+			t.Fatalf("Create() returns err: %v", err)
+		}
+		return id
+	}
+	user := create(constants.UsersTable, &st.User{Email: "a@seneca.ai"})
+	trip := create(constants.TripTable, &st.TripInternal{UserId: user})
+	rawVideo := create(constants.RawVideosTable, &st.RawVideo{UserId: user})
+	rawFrame := create(constants.RawFramesTable, &st.RawFrame{UserId: user, Source: &st.Source{SourceId: rawVideo, SourceType: st.Source_RAW_VIDEO}})
+	create(constants.EventTable, &st.EventInternal{UserId: user, TripId: trip, Source: &st.Source{SourceId: rawFrame, SourceType: st.Source_RAW_FRAME}})
+
+	// Orphans.
+	orphanTrip := create(constants.TripTable, &st.TripInternal{UserId: "deleted"})
+	orphanEvent := create(constants.EventTable, &st.EventInternal{UserId: user, TripId: "deleted"})
+	// A chain of sources that ends at a deleted raw video.
+	deletedVideo := create(constants.RawVideosTable, &st.RawVideo{UserId: user})
+	danglingFrame := create(constants.RawFramesTable, &st.RawFrame{UserId: user, Source: &st.Source{SourceId: deletedVideo, SourceType: st.Source_RAW_VIDEO}})
+	danglingEvent := create(constants.EventTable, &st.EventInternal{UserId: user, TripId: trip, Source: &st.Source{SourceId: danglingFrame, SourceType: st.Source_RAW_FRAME}})
+	if err := fakeSQL.DeleteByID(constants.RawVideosTable, deletedVideo); err != nil {
+		t.Fatalf("DeleteByID() returns err: %v", err)
+	}
+	// A cycle of raw motions.
+	motion1 := create(constants.RawMotionsTable, &st.RawMotion{UserId: user})
+	motion2 := create(constants.RawMotionsTable, &st.RawMotion{UserId: user, Source: &st.Source{SourceId: motion1, SourceType: st.Source_RAW_MOTION}})
+	if err := fakeSQL.Insert(constants.RawMotionsTable, motion1, &st.RawMotion{UserId: user, Source: &st.Source{SourceId: motion2, SourceType: st.Source_RAW_MOTION}}); err != nil {
+		t.Fatalf("Insert() returns err: %v", err)
+	}
+
+	report, err := NewChecker(fakeSQL, logging.NewLocalLogger(true)).Check(context.Background())
+	if err != nil {
+		t.Fatalf("Check() returns err: %v", err)
+	}
+
+	if report.Scanned[constants.EventTable] != 3 || report.Scanned[constants.TripTable] != 2 || report.Scanned[constants.UsersTable] != 1 {
+		t.Fatalf("Want every object scanned, got %v", report.Scanned)
+	}
+	got := []string{}
+	for _, issue := range report.Issues {
+		got = append(got, issue.ID)
+	}
+	sort.Strings(got)
+	want := []string{orphanTrip, orphanEvent, danglingFrame, danglingEvent, motion1, motion2}
+	sort.Strings(want)
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("Want issues with %v, got %v", want, report.Issues)
+	}
+	for _, issue := range report.Issues {
+		if issue.ID == danglingEvent && !strings.Contains(issue.Problem, "dangling") {
+			t.Fatalf("Want the event's Source chain reported dangling, got %q", issue.Problem)
+		}
+		if issue.ID == motion1 && !strings.Contains(issue.Problem, "cycle") {
+			t.Fatalf("Want the raw motion's Source chain reported as a cycle, got %q", issue.Problem)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+// Package integrity checks the references between objects: every object must belong to a user that exists, and the
+// trip and Source it references must exist and belong to the same user.
+//
+// New objects are checked by wrapping the database.SQLInterface the DAOs are built on with an SQLService, and the
+// whole database is checked offline by a Checker.
+package integrity
+
+import (
+	"errors"
+	"fmt"
+	"seneca/api/constants"
+	"seneca/api/senecaerror"
+	st "seneca/api/type"
+	"seneca/internal/client/database"
+	"strings"
+)
+
+// sourceFieldName is the field of the objects that have a Source.
+const sourceFieldName constants.SenecaTypeFieldName = "Source"
+
+// sourceTables maps the types of Sources to the tables of the objects they refer to.
+var sourceTables = map[st.Source_SourceType]constants.TableName{
+	st.Source_RAW_VIDEO:                 constants.RawVideosTable,
+	st.Source_RAW_MOTION:                constants.RawMotionsTable,
+	st.Source_RAW_LOCATION:              constants.RawLocationsTable,
+	st.Source_RAW_FRAME:                 constants.RawFramesTable,
+	database.RawTelemetryFileSourceType: constants.RawTelemetryFilesTable,
+	database.RawVehicleSignalSourceType: constants.RawVehicleSignalsTable,
+}
+
+//	SourceTableName returns the table of the objects Sources of the type refer to.
+//	Params:
+//		sourceType st.Source_SourceType
+//	Returns:
+//		constants.TableName
+//		bool: false if the type doesn't refer to a table
+func SourceTableName(sourceType st.Source_SourceType) (constants.TableName, bool) {
+	tableName, ok := sourceTables[sourceType]
+	return tableName, ok
+}
+
+//	Validate checks that the user, trip and source the object references exist and belong to the same user.
+//	Params:
+//		sql database.SQLInterface
+//		tableName constants.TableName
+//		object interface{}
+//	Returns:
+//		senecaerror.BadStateError: describing every invalid reference
+//		error
+func Validate(sql database.SQLInterface, tableName constants.TableName, object interface{}) error {
+	return newValidator(sql).validate(tableName, object)
+}
+
+// summary is what the validator remembers of the objects it looked up.
+type summary struct {
+	userID string
+	source *st.Source
+}
+
+// validator looks up referenced objects, remembering them so that each is only read once.
+type validator struct {
+	sql database.SQLInterface
+	// summaries are by table and ID, nil for objects that don't exist.
+	summaries map[string]*summary
+}
+
+func newValidator(sql database.SQLInterface) *validator {
+	return &validator{
+		sql:       sql,
+		summaries: map[string]*summary{},
+	}
+}
+
+func (v *validator) validate(tableName constants.TableName, object interface{}) error {
+	problems, err := v.problems(tableName, "", object, false)
+	if err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return senecaerror.NewBadStateError(fmt.Errorf("invalid %s object %v: %s", tableName, object, strings.Join(problems, "; ")))
+	}
+	return nil
+}
+
+// problems describes the invalid references of the object.  If followChains, the whole chain of Sources is checked,
+// otherwise only the object's own Source.
+func (v *validator) problems(tableName constants.TableName, id string, object interface{}, followChains bool) ([]string, error) {
+	// Users don't reference anything.
+	if tableName == constants.UsersTable {
+		return nil, nil
+	}
+
+	problems := []string{}
+	userID := userIDOf(object)
+	if userID == "" {
+		problems = append(problems, "it has no UserId")
+	} else {
+		user, err := v.get(constants.UsersTable, userID)
+		if err != nil {
+			return nil, err
+		}
+		if user == nil {
+			problems = append(problems, fmt.Sprintf("user %q doesn't exist", userID))
+		}
+	}
+
+	if tripIDValue, ok := database.FieldValue(object, constants.TripIDFieldName); ok {
+		if tripID, _ := tripIDValue.(string); tripID != "" {
+			trip, err := v.get(constants.TripTable, tripID)
+			if err != nil {
+				return nil, err
+			}
+			if trip == nil {
+				problems = append(problems, fmt.Sprintf("trip %q doesn't exist", tripID))
+			} else if trip.userID != userID {
+				problems = append(problems, fmt.Sprintf("trip %q belongs to user %q", tripID, trip.userID))
+			}
+		}
+	}
+
+	sourceProblem, err := v.sourceProblem(tableName, id, userID, sourceOf(object), followChains)
+	if err != nil {
+		return nil, err
+	}
+	if sourceProblem != "" {
+		problems = append(problems, sourceProblem)
+	}
+	return problems, nil
+}
+
+// sourceProblem describes what's wrong with the chain of Sources starting at source, or returns "".
+func (v *validator) sourceProblem(tableName constants.TableName, id, userID string, source *st.Source, followChains bool) (string, error) {
+	chain := []string{fmt.Sprintf("%s %q", tableName, id)}
+	visited := map[string]bool{key(tableName, id): true}
+	for source != nil && source.SourceId != "" {
+		sourceTableName, ok := SourceTableName(source.SourceType)
+		if !ok {
+			return fmt.Sprintf("source %q has unknown type %v", source.SourceId, source.SourceType), nil
+		}
+		chain = append(chain, fmt.Sprintf("%s %q", sourceTableName, source.SourceId))
+		if visited[key(sourceTableName, source.SourceId)] {
+			return fmt.Sprintf("Source chain %s has a cycle", strings.Join(chain, " -> ")), nil
+		}
+		visited[key(sourceTableName, source.SourceId)] = true
+
+		sourceSummary, err := v.get(sourceTableName, source.SourceId)
+		if err != nil {
+			return "", err
+		}
+		if sourceSummary == nil {
+			if len(chain) == 2 {
+				return fmt.Sprintf("source %s %q doesn't exist", sourceTableName, source.SourceId), nil
+			}
+			return fmt.Sprintf("Source chain %s is dangling", strings.Join(chain, " -> ")), nil
+		}
+		if sourceSummary.userID != userID {
+			return fmt.Sprintf("source %s %q belongs to user %q", sourceTableName, source.SourceId, sourceSummary.userID), nil
+		}
+
+		if !followChains {
+			return "", nil
+		}
+		source = sourceSummary.source
+	}
+	return "", nil
+}
+
+// get returns the summary of the object, or nil if it doesn't exist.
+func (v *validator) get(tableName constants.TableName, id string) (*summary, error) {
+	if s, ok := v.summaries[key(tableName, id)]; ok {
+		return s, nil
+	}
+
+	object, err := v.sql.GetByID(tableName, id)
+	var nfe *senecaerror.NotFoundError
+	if err != nil && !errors.As(err, &nfe) {
+		return nil, fmt.Errorf("error getting object %q from table %q: %w", id, tableName, err)
+	}
+	var s *summary
+	if object != nil {
+		s = &summary{userID: userIDOf(object), source: sourceOf(object)}
+		if tableName == constants.UsersTable {
+			s.userID = id
+		}
+	}
+	v.summaries[key(tableName, id)] = s
+	return s, nil
+}
+
+func key(tableName constants.TableName, id string) string {
+	return tableName.String() + "/" + id
+}
+
+func userIDOf(object interface{}) string {
+	userID, _ := database.FieldValue(object, constants.UserIDFieldName)
+	s, _ := userID.(string)
+	return s
+}
+
+func sourceOf(object interface{}) *st.Source {
+	source, _ := database.FieldValue(object, sourceFieldName)
+	s, _ := source.(*st.Source)
+	return s
+}
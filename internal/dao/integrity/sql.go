@@ -0,0 +1,115 @@
+package integrity
+
+import (
+	"context"
+	"seneca/api/constants"
+	"seneca/internal/client/database"
+)
+
+// 	SQLService is a database.SQLInterface that refuses to create objects in the constants.DataTableNames whose user,
+// 	trip or source doesn't exist or belongs to another user.  Updates aren't validated, since the DAOs only set the
+// 	IDs and derived fields of the objects they've created.
+type SQLService struct {
+	database.SQLInterface
+	// created are the summaries of the objects created in the current transaction, by table and ID, since some
+	// databases don't read a transaction's own writes.  It's nil outside of transactions.
+	created map[string]*summary
+}
+
+//	NewSQL wraps sqlInterface so that the references of the objects created through it are validated.
+//	Params:
+//		sqlInterface database.SQLInterface
+//	Returns:
+//		*SQLService
+func NewSQL(sqlInterface database.SQLInterface) *SQLService {
+	return &SQLService{SQLInterface: sqlInterface}
+}
+
+func (s *SQLService) Create(tableName constants.TableName, object interface{}) (string, error) {
+	if err := s.validate(tableName, []interface{}{object}); err != nil {
+		return "", err
+	}
+	id, err := s.SQLInterface.Create(tableName, object)
+	if err != nil {
+		return "", err
+	}
+	s.remember(tableName, id, object)
+	return id, nil
+}
+
+func (s *SQLService) CreateMulti(tableName constants.TableName, objects []interface{}) ([]string, error) {
+	if err := s.validate(tableName, objects); err != nil {
+		return nil, err
+	}
+	ids, err := s.SQLInterface.CreateMulti(tableName, objects)
+	if err != nil {
+		return nil, err
+	}
+	for i, id := range ids {
+		s.remember(tableName, id, objects[i])
+	}
+	return ids, nil
+}
+
+// Put validates the object like Create, since it may create it.
+func (s *SQLService) Put(tableName constants.TableName, id string, object interface{}) error {
+	if err := s.validate(tableName, []interface{}{object}); err != nil {
+		return err
+	}
+	if err := s.SQLInterface.Put(tableName, id, object); err != nil {
+		return err
+	}
+	s.remember(tableName, id, object)
+	return nil
+}
+
+// RunInTransaction calls f with an SQLService on the transaction, so that references are read in the transaction.
+func (s *SQLService) RunInTransaction(ctx context.Context, f func(tx database.SQLInterface) error) error {
+	// Calls on a transaction run in the same transaction, so they share what it has created.
+	if s.created != nil {
+		return s.SQLInterface.RunInTransaction(ctx, func(tx database.SQLInterface) error {
+			return f(&SQLService{SQLInterface: tx, created: s.created})
+		})
+	}
+	return s.SQLInterface.RunInTransaction(ctx, func(tx database.SQLInterface) error {
+		// f may be retried, so each attempt starts afresh.
+		return f(&SQLService{SQLInterface: tx, created: map[string]*summary{}})
+	})
+}
+
+// validate checks the references of the objects, which all-or-nothing calls either create together or not at all.
+func (s *SQLService) validate(tableName constants.TableName, objects []interface{}) error {
+	if !isDataTable(tableName) {
+		return nil
+	}
+	v := newValidator(s.SQLInterface)
+	for k, created := range s.created {
+		v.summaries[k] = created
+	}
+	for _, object := range objects {
+		if err := v.validate(tableName, object); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLService) remember(tableName constants.TableName, id string, object interface{}) {
+	if s.created == nil || !isDataTable(tableName) {
+		return
+	}
+	created := &summary{userID: userIDOf(object), source: sourceOf(object)}
+	if tableName == constants.UsersTable {
+		created.userID = id
+	}
+	s.created[key(tableName, id)] = created
+}
+
+func isDataTable(tableName constants.TableName) bool {
+	for _, dataTableName := range constants.DataTableNames {
+		if tableName == dataTableName {
+			return true
+		}
+	}
+	return false
+}
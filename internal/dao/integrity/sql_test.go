@@ -0,0 +1,100 @@
+package integrity
+
+import (
+	"context"
+	"errors"
+	"seneca/api/constants"
+	"seneca/api/senecaerror"
+	st "seneca/api/type"
+	"seneca/internal/client/database"
+	"seneca/internal/client/logging"
+	"seneca/internal/dao/sqldaoset"
+	"testing"
+	"time"
+)
+
+func TestSQLServiceValidatesCreates(t *testing.T) {
+	fakeSQL := database.NewFake()
+	sql := NewSQL(fakeSQL)
+	user1, err := sql.Create(constants.UsersTable, &st.User{Email: "a@seneca.ai"})
+	if err != nil {
+		t.Fatalf("Create() returns err: %v", err)
+	}
+	user2, err := sql.Create(constants.UsersTable, &st.User{Email: "b@seneca.ai"})
+	if err != nil {
+		t.Fatalf("Create() returns err: %v", err)
+	}
+	trip, err := sql.Create(constants.TripTable, &st.TripInternal{UserId: user1})
+	if err != nil {
+		t.Fatalf("Create() returns err: %v", err)
+	}
+	rawVideo, err := sql.Create(constants.RawVideosTable, &st.RawVideo{UserId: user1})
+	if err != nil {
+		t.Fatalf("Create() returns err: %v", err)
+	}
+	videoSource := &st.Source{SourceId: rawVideo, SourceType: st.Source_RAW_VIDEO}
+
+	for _, tc := range []struct {
+		desc      string
+		tableName constants.TableName
+		object    interface{}
+		wantErr   bool
+	}{
+		{"valid raw frame", constants.RawFramesTable, &st.RawFrame{UserId: user1, Source: videoSource}, false},
+		{"valid event", constants.EventTable, &st.EventInternal{UserId: user1, TripId: trip, Source: videoSource}, false},
+		{"no user", constants.RawMotionsTable, &st.RawMotion{}, true},
+		{"missing user", constants.TripTable, &st.TripInternal{UserId: "missing"}, true},
+		{"missing trip", constants.EventTable, &st.EventInternal{UserId: user1, TripId: "missing"}, true},
+		{"other user's trip", constants.DrivingConditionTable, &st.DrivingConditionInternal{UserId: user2, TripId: trip}, true},
+		{"missing source", constants.RawFramesTable, &st.RawFrame{UserId: user1, Source: &st.Source{SourceId: "missing", SourceType: st.Source_RAW_VIDEO}}, true},
+		{"unknown source type", constants.RawFramesTable, &st.RawFrame{UserId: user1, Source: &st.Source{SourceId: rawVideo}}, true},
+		{"other user's source", constants.RawFramesTable, &st.RawFrame{UserId: user2, Source: videoSource}, true},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := sql.Create(tc.tableName, tc.object)
+			var bse *senecaerror.BadStateError
+			if tc.wantErr != errors.As(err, &bse) || (!tc.wantErr && err != nil) {
+				t.Fatalf("Want BadStateError from Create(): %t, got %v", tc.wantErr, err)
+			}
+		})
+	}
+
+	// CreateMulti creates nothing if any object is invalid.
+	var bse *senecaerror.BadStateError
+	if _, err := sql.CreateMulti(constants.RawMotionsTable, []interface{}{&st.RawMotion{UserId: user1}, &st.RawMotion{UserId: "missing"}}); !errors.As(err, &bse) {
+		t.Fatalf("Want BadStateError from CreateMulti(), got %v", err)
+	}
+	if ids, _, _ := fakeSQL.ListIDsByQuery(database.NewQuery(constants.RawMotionsTable)); len(ids) != 0 {
+		t.Fatalf("Want no raw motions created, got %d", len(ids))
+	}
+}
+
+func TestSQLServiceTransactions(t *testing.T) {
+	fakeSQL := database.NewFake()
+	sql := NewSQL(fakeSQL)
+	user, err := sql.Create(constants.UsersTable, &st.User{Email: "a@seneca.ai"})
+	if err != nil {
+		t.Fatalf("Create() returns err: %v", err)
+	}
+
+	// References to objects created earlier in the transaction are valid.
+	if err := sql.RunInTransaction(context.Background(), func(tx database.SQLInterface) error {
+		trip, err := tx.Create(constants.TripTable, &st.TripInternal{UserId: user})
+		if err != nil {
+			return err
+		}
+		_, err = tx.Create(constants.EventTable, &st.EventInternal{UserId: user, TripId: trip})
+		return err
+	}); err != nil {
+		t.Fatalf("RunInTransaction() returns err: %v", err)
+	}
+
+	daos := sqldaoset.New(sql, logging.NewLocalLogger(true), time.Second)
+	if _, err := daos.DrivingConditionDAO.CreateDrivingCondition(context.Background(), &st.DrivingConditionInternal{UserId: user, StartTimeMs: 10, EndTimeMs: 20}); err != nil {
+		t.Fatalf("CreateDrivingCondition() returns err: %v", err)
+	}
+	var bse *senecaerror.BadStateError
+	if _, err := daos.EventDAO.CreateEvent(context.Background(), &st.EventInternal{UserId: "missing", TimestampMs: 10}); !errors.As(err, &bse) {
+		t.Fatalf("Want BadStateError from CreateEvent() for a missing user, got %v", err)
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"seneca/api/senecaerror"
 	st "seneca/api/type"
 	"seneca/internal/client/database"
+	"seneca/internal/util"
+	"time"
 )
 
 type SQLRawFrameDAO struct {
@@ -56,6 +58,64 @@ func (rdao *SQLRawFrameDAO) InsertUniqueRawFrame(RawFrame *st.RawFrame) (*st.Raw
 	return RawFrame, nil
 }
 
+// InsertUniqueRawFrames inserts the rawFrames in one transaction, so either all of them are stored or none are.
+func (rdao *SQLRawFrameDAO) InsertUniqueRawFrames(rawFrames []*st.RawFrame) ([]*st.RawFrame, error) {
+	err := rdao.sql.RunInTransaction(context.TODO(), func(tx database.SQLInterface) error {
+		objects := []interface{}{}
+		seen := map[string]bool{}
+		for _, rawFrame := range rawFrames {
+			// The batch isn't in the store yet, so duplicates within it are checked here.
+			key := fmt.Sprintf("%s/%d", rawFrame.UserId, rawFrame.TimestampMs)
+			if seen[key] {
+				return fmt.Errorf("rawFrame with timestamp %d is in the batch twice for user %q", rawFrame.TimestampMs, rawFrame.UserId)
+			}
+			seen[key] = true
+
+			ids, err := tx.ListIDs(constants.RawFramesTable, []*database.QueryParam{
+				{
+					FieldName: constants.UserIDFieldName,
+					Operand:   "=",
+					Value:     rawFrame.UserId,
+				},
+				{
+					FieldName: constants.TimestampFieldName,
+					Operand:   "=",
+					Value:     rawFrame.TimestampMs,
+				},
+			})
+			if err != nil {
+				return fmt.Errorf("error checking for existing rawFrame %v - err: %w", rawFrame, err)
+			}
+			if len(ids) != 0 {
+				return fmt.Errorf("rawFrame with timestamp %d already exists for user %q", rawFrame.TimestampMs, rawFrame.UserId)
+			}
+			objects = append(objects, rawFrame)
+		}
+
+		newRawFrameIDs, err := tx.CreateMulti(constants.RawFramesTable, objects)
+		if err != nil {
+			return fmt.Errorf("error inserting %d rawFrames into store: %w", len(rawFrames), err)
+		}
+		for i := range rawFrames {
+			rawFrames[i].Id = newRawFrameIDs[i]
+		}
+
+		// Now set the IDs in the datastore objects.
+		if err := tx.InsertMulti(constants.RawFramesTable, newRawFrameIDs, objects); err != nil {
+			return fmt.Errorf("error updating IDs for %d rawFrames - err: %w", len(rawFrames), err)
+		}
+		return nil
+	})
+	if err != nil {
+		for _, rawFrame := range rawFrames {
+			rawFrame.Id = ""
+		}
+		return nil, err
+	}
+
+	return rawFrames, nil
+}
+
 func (rdao *SQLRawFrameDAO) PutRawFrameByID(ctx context.Context, RawFrameID string, RawFrame *st.RawFrame) error {
 	return rdao.sql.Insert(constants.RawFramesTable, RawFrameID, RawFrame)
 }
@@ -78,14 +138,56 @@ func (rdao *SQLRawFrameDAO) GetRawFrameByID(id string) (*st.RawFrame, error) {
 	return RawFrame, nil
 }
 
+func (rdao *SQLRawFrameDAO) GetRawFramesByIDs(ids []string) ([]*st.RawFrame, error) {
+	objects, err := rdao.sql.GetByIDs(constants.RawFramesTable, ids)
+	if err != nil {
+		return nil, fmt.Errorf("error getting %d rawFrames by ID: %w", len(ids), err)
+	}
+
+	rawFrames := []*st.RawFrame{}
+	for _, object := range objects {
+		rawFrame, ok := object.(*st.RawFrame)
+		if !ok {
+			return nil, fmt.Errorf("expected RawFrame, got %T", object)
+		}
+		rawFrames = append(rawFrames, rawFrame)
+	}
+
+	return rawFrames, nil
+}
+
 func (rdao *SQLRawFrameDAO) ListUserRawFrameIDs(userID string) ([]string, error) {
 	return rdao.sql.ListIDs(constants.RawFramesTable, []*database.QueryParam{{FieldName: constants.UserIDFieldName, Operand: "=", Value: userID}})
 }
 
+func (rdao *SQLRawFrameDAO) ListUserRawFrameIDsPage(userID, cursor string, limit int) ([]string, string, error) {
+	query := database.NewQuery(constants.RawFramesTable).
+		Where(constants.UserIDFieldName, "=", userID).
+		OrderBy(constants.TimestampFieldName).
+		WithLimit(limit).
+		WithCursor(cursor)
+	return rdao.sql.ListIDsByQuery(query)
+}
+
+// ListUserRawFrameIDsByTime lists the IDs of the user's rawFrames with timestamps in [startTime, endTime), oldest first.
+func (rdao *SQLRawFrameDAO) ListUserRawFrameIDsByTime(userID string, startTime time.Time, endTime time.Time) ([]string, error) {
+	query := database.NewQuery(constants.RawFramesTable).
+		Where(constants.UserIDFieldName, "=", userID).
+		Range(constants.TimestampFieldName, util.TimeToMilliseconds(startTime), util.TimeToMilliseconds(endTime)).
+		OrderBy(constants.TimestampFieldName)
+
+	rawFrameIDs, _, err := rdao.sql.ListIDsByQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("error listing rawFrameIDs between %q and %q for user %q: %w", startTime, endTime, userID, err)
+	}
+	return rawFrameIDs, nil
+}
+
 func (rdao *SQLRawFrameDAO) ListUnprocessedRawFramesIDs(userID string, latestVersion float64) ([]string, error) {
 	return rdao.sql.ListIDs(constants.RawFramesTable, []*database.QueryParam{{FieldName: constants.UserIDFieldName, Operand: "=", Value: userID}, {FieldName: constants.AlgosVersionFieldName, Operand: "<", Value: latestVersion}})
 }
 
 func (rdao *SQLRawFrameDAO) DeleteRawFrameByID(id string) error {
-	return rdao.sql.DeleteByID(constants.RawFramesTable, id)
+	_, err := database.SoftDelete(context.TODO(), rdao.sql, constants.RawFramesTable, id, database.DeleteReason)
+	return err
 }
@@ -123,6 +123,17 @@ func TestListUserRawFrameIDs(t *testing.T) {
 	}
 }
 
+func TestListUserRawFrameIDsByTime(t *testing.T) {
+	dao, _ := newRawFrameDAOForTest()
+	testutil.CheckListUserIDsByTime(t, func(userID string, timestamp time.Time) (string, error) {
+		rawFrame, err := dao.InsertUniqueRawFrame(&st.RawFrame{UserId: userID, TimestampMs: util.TimeToMilliseconds(timestamp)})
+		if err != nil {
+			return "", err
+		}
+		return rawFrame.Id, nil
+	}, dao.ListUserRawFrameIDsByTime)
+}
+
 func TestGetRawFrameByID(t *testing.T) {
 	RawFrame := &st.RawFrame{
 		UserId:      testutil.TestUserID,
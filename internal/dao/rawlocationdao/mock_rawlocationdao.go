@@ -4,13 +4,18 @@ import (
 	"context"
 	"log"
 	st "seneca/api/type"
+	"time"
 )
 
 type MockRawLocatinDAO struct {
 	InsertUniqueRawLocationMock        func(rawLocation *st.RawLocation) (*st.RawLocation, error)
+	InsertUniqueRawLocationsMock       func(rawLocations []*st.RawLocation) ([]*st.RawLocation, error)
 	PutRawLocationByIDMock             func(ctx context.Context, rawLocationID string, rawLocation *st.RawLocation) error
 	GetRawLocationByIDMock             func(id string) (*st.RawLocation, error)
+	GetRawLocationsByIDsMock           func(ids []string) ([]*st.RawLocation, error)
 	ListUserRawLocationIDsMock         func(userID string) ([]string, error)
+	ListUserRawLocationIDsPageMock     func(userID, cursor string, limit int) ([]string, string, error)
+	ListUserRawLocationIDsByTimeMock   func(userID string, startTime time.Time, endTime time.Time) ([]string, error)
 	DeleteRawLocationByIDMock          func(id string) error
 	ListUnprocessedRawLocationsIDsMock func(userID string, latestVersion float64) ([]string, error)
 }
@@ -29,6 +34,13 @@ func (mrld *MockRawLocatinDAO) GetRawLocationByID(id string) (*st.RawLocation, e
 	return mrld.GetRawLocationByIDMock(id)
 }
 
+func (mrld *MockRawLocatinDAO) GetRawLocationsByIDs(ids []string) ([]*st.RawLocation, error) {
+	if mrld.GetRawLocationsByIDsMock == nil {
+		log.Fatal("GetRawLocationsByIDsMock called but not set")
+	}
+	return mrld.GetRawLocationsByIDsMock(ids)
+}
+
 func (mrld *MockRawLocatinDAO) ListUserRawLocationIDs(userID string) ([]string, error) {
 	if mrld.ListUserRawLocationIDsMock == nil {
 		log.Fatal("ListUserRawLocationIDsMock called but not set")
@@ -36,6 +48,13 @@ func (mrld *MockRawLocatinDAO) ListUserRawLocationIDs(userID string) ([]string,
 	return mrld.ListUserRawLocationIDsMock(userID)
 }
 
+func (mrld *MockRawLocatinDAO) ListUserRawLocationIDsPage(userID, cursor string, limit int) ([]string, string, error) {
+	if mrld.ListUserRawLocationIDsPageMock == nil {
+		log.Fatal("ListUserRawLocationIDsPageMock called but not set")
+	}
+	return mrld.ListUserRawLocationIDsPageMock(userID, cursor, limit)
+}
+
 func (mrld *MockRawLocatinDAO) ListUnprocessedRawLocationsIDs(userID string, latestVersion float64) ([]string, error) {
 	if mrld.ListUnprocessedRawLocationsIDsMock == nil {
 		log.Fatal("ListUnprocessedRawLocationsIDsMock called but not set")
@@ -56,3 +75,17 @@ func (mrld *MockRawLocatinDAO) PutRawLocationByID(ctx context.Context, rawLocati
 	}
 	return mrld.PutRawLocationByIDMock(ctx, rawLocationID, rawLocation)
 }
+
+func (mrld *MockRawLocatinDAO) InsertUniqueRawLocations(rawLocations []*st.RawLocation) ([]*st.RawLocation, error) {
+	if mrld.InsertUniqueRawLocationsMock == nil {
+		log.Fatal("InsertUniqueRawLocationsMock called but not set")
+	}
+	return mrld.InsertUniqueRawLocationsMock(rawLocations)
+}
+
+func (mrld *MockRawLocatinDAO) ListUserRawLocationIDsByTime(userID string, startTime time.Time, endTime time.Time) ([]string, error) {
+	if mrld.ListUserRawLocationIDsByTimeMock == nil {
+		log.Fatal("ListUserRawLocationIDsByTimeMock called but not set")
+	}
+	return mrld.ListUserRawLocationIDsByTimeMock(userID, startTime, endTime)
+}
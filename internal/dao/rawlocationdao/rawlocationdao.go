@@ -7,6 +7,8 @@ import (
 	"seneca/api/senecaerror"
 	st "seneca/api/type"
 	"seneca/internal/client/database"
+	"seneca/internal/util"
+	"time"
 )
 
 type SQLRawLocationDAO struct {
@@ -56,6 +58,64 @@ func (rdao *SQLRawLocationDAO) InsertUniqueRawLocation(rawLocation *st.RawLocati
 	return rawLocation, nil
 }
 
+// InsertUniqueRawLocations inserts the rawLocations in one transaction, so either all of them are stored or none are.
+func (rdao *SQLRawLocationDAO) InsertUniqueRawLocations(rawLocations []*st.RawLocation) ([]*st.RawLocation, error) {
+	err := rdao.sql.RunInTransaction(context.TODO(), func(tx database.SQLInterface) error {
+		objects := []interface{}{}
+		seen := map[string]bool{}
+		for _, rawLocation := range rawLocations {
+			// The batch isn't in the store yet, so duplicates within it are checked here.
+			key := fmt.Sprintf("%s/%d", rawLocation.UserId, rawLocation.TimestampMs)
+			if seen[key] {
+				return fmt.Errorf("rawLocation with timestamp %d is in the batch twice for user %q", rawLocation.TimestampMs, rawLocation.UserId)
+			}
+			seen[key] = true
+
+			ids, err := tx.ListIDs(constants.RawLocationsTable, []*database.QueryParam{
+				{
+					FieldName: constants.UserIDFieldName,
+					Operand:   "=",
+					Value:     rawLocation.UserId,
+				},
+				{
+					FieldName: constants.TimestampFieldName,
+					Operand:   "=",
+					Value:     rawLocation.TimestampMs,
+				},
+			})
+			if err != nil {
+				return fmt.Errorf("error checking for existing rawLocation %v - err: %w", rawLocation, err)
+			}
+			if len(ids) != 0 {
+				return fmt.Errorf("rawLocation with timestamp %d already exists for user %q", rawLocation.TimestampMs, rawLocation.UserId)
+			}
+			objects = append(objects, rawLocation)
+		}
+
+		newRawLocationIDs, err := tx.CreateMulti(constants.RawLocationsTable, objects)
+		if err != nil {
+			return fmt.Errorf("error inserting %d rawLocations into store: %w", len(rawLocations), err)
+		}
+		for i := range rawLocations {
+			rawLocations[i].Id = newRawLocationIDs[i]
+		}
+
+		// Now set the IDs in the datastore objects.
+		if err := tx.InsertMulti(constants.RawLocationsTable, newRawLocationIDs, objects); err != nil {
+			return fmt.Errorf("error updating IDs for %d rawLocations - err: %w", len(rawLocations), err)
+		}
+		return nil
+	})
+	if err != nil {
+		for _, rawLocation := range rawLocations {
+			rawLocation.Id = ""
+		}
+		return nil, err
+	}
+
+	return rawLocations, nil
+}
+
 func (rdao *SQLRawLocationDAO) PutRawLocationByID(ctx context.Context, rawLocationID string, rawLocation *st.RawLocation) error {
 	return rdao.sql.Insert(constants.RawLocationsTable, rawLocationID, rawLocation)
 }
@@ -78,14 +138,56 @@ func (rdao *SQLRawLocationDAO) GetRawLocationByID(id string) (*st.RawLocation, e
 	return rawLocation, nil
 }
 
+func (rdao *SQLRawLocationDAO) GetRawLocationsByIDs(ids []string) ([]*st.RawLocation, error) {
+	objects, err := rdao.sql.GetByIDs(constants.RawLocationsTable, ids)
+	if err != nil {
+		return nil, fmt.Errorf("error getting %d rawLocations by ID: %w", len(ids), err)
+	}
+
+	rawLocations := []*st.RawLocation{}
+	for _, object := range objects {
+		rawLocation, ok := object.(*st.RawLocation)
+		if !ok {
+			return nil, fmt.Errorf("expected RawLocation, got %T", object)
+		}
+		rawLocations = append(rawLocations, rawLocation)
+	}
+
+	return rawLocations, nil
+}
+
 func (rdao *SQLRawLocationDAO) ListUserRawLocationIDs(userID string) ([]string, error) {
 	return rdao.sql.ListIDs(constants.RawLocationsTable, []*database.QueryParam{{FieldName: constants.UserIDFieldName, Operand: "=", Value: userID}})
 }
 
+func (rdao *SQLRawLocationDAO) ListUserRawLocationIDsPage(userID, cursor string, limit int) ([]string, string, error) {
+	query := database.NewQuery(constants.RawLocationsTable).
+		Where(constants.UserIDFieldName, "=", userID).
+		OrderBy(constants.TimestampFieldName).
+		WithLimit(limit).
+		WithCursor(cursor)
+	return rdao.sql.ListIDsByQuery(query)
+}
+
+// ListUserRawLocationIDsByTime lists the IDs of the user's rawLocations with timestamps in [startTime, endTime), oldest first.
+func (rdao *SQLRawLocationDAO) ListUserRawLocationIDsByTime(userID string, startTime time.Time, endTime time.Time) ([]string, error) {
+	query := database.NewQuery(constants.RawLocationsTable).
+		Where(constants.UserIDFieldName, "=", userID).
+		Range(constants.TimestampFieldName, util.TimeToMilliseconds(startTime), util.TimeToMilliseconds(endTime)).
+		OrderBy(constants.TimestampFieldName)
+
+	rawLocationIDs, _, err := rdao.sql.ListIDsByQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("error listing rawLocationIDs between %q and %q for user %q: %w", startTime, endTime, userID, err)
+	}
+	return rawLocationIDs, nil
+}
+
 func (rdao *SQLRawLocationDAO) ListUnprocessedRawLocationsIDs(userID string, latestVersion float64) ([]string, error) {
 	return rdao.sql.ListIDs(constants.RawLocationsTable, []*database.QueryParam{{FieldName: constants.UserIDFieldName, Operand: "=", Value: userID}, {FieldName: constants.AlgosVersionFieldName, Operand: "<", Value: latestVersion}})
 }
 
 func (rdao *SQLRawLocationDAO) DeleteRawLocationByID(id string) error {
-	return rdao.sql.DeleteByID(constants.RawLocationsTable, id)
+	_, err := database.SoftDelete(context.TODO(), rdao.sql, constants.RawLocationsTable, id, database.DeleteReason)
+	return err
 }
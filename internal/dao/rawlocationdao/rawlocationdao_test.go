@@ -17,6 +17,57 @@ import (
 
 var createTime = time.Date(1996, time.May, 23, 0, 0, 0, 0, time.UTC)
 
+func TestInsertUniqueRawLocations(t *testing.T) {
+	dao, _ := newRawLocationDAOForTest()
+
+	rawLocations := []*st.RawLocation{}
+	for i := 0; i < 3; i++ {
+		rawLocations = append(rawLocations, &st.RawLocation{
+			UserId:      testutil.TestUserID,
+			TimestampMs: util.TimeToMilliseconds(createTime.Add(time.Second * time.Duration(i))),
+		})
+	}
+
+	rawLocationsWithIDs, err := dao.InsertUniqueRawLocations(rawLocations)
+	if err != nil {
+		t.Fatalf("InsertUniqueRawLocations() returns err: %v", err)
+	}
+	seenIDs := map[string]bool{}
+	for _, rawLocation := range rawLocationsWithIDs {
+		if rawLocation.Id == "" || seenIDs[rawLocation.Id] {
+			t.Fatalf("Want distinct IDs assigned, got %v", rawLocationsWithIDs)
+		}
+		seenIDs[rawLocation.Id] = true
+	}
+
+	// One of the batch already exists, so none of it should be stored.
+	conflicting := []*st.RawLocation{
+		{UserId: testutil.TestUserID, TimestampMs: util.TimeToMilliseconds(createTime.Add(time.Hour))},
+		{UserId: testutil.TestUserID, TimestampMs: rawLocations[1].TimestampMs},
+	}
+	if _, err := dao.InsertUniqueRawLocations(conflicting); err == nil {
+		t.Fatalf("Want err from InsertUniqueRawLocations() with an existing RawLocation, got nil")
+	}
+	for _, rawLocation := range conflicting {
+		if rawLocation.Id != "" {
+			t.Fatalf("Want IDs reset after failed InsertUniqueRawLocations(), got %q", rawLocation.Id)
+		}
+	}
+
+	// Duplicates within the batch are rejected too.
+	if _, err := dao.InsertUniqueRawLocations([]*st.RawLocation{conflicting[0], {UserId: testutil.TestUserID, TimestampMs: conflicting[0].TimestampMs}}); err == nil {
+		t.Fatalf("Want err from InsertUniqueRawLocations() with duplicates in the batch, got nil")
+	}
+
+	ids, err := dao.ListUserRawLocationIDs(testutil.TestUserID)
+	if err != nil {
+		t.Fatalf("ListUserRawLocationIDs() returns err: %v", err)
+	}
+	if len(ids) != 3 {
+		t.Fatalf("Want 3 RawLocations stored, got %d", len(ids))
+	}
+}
+
 func TestInsertUniqueRawLocation(t *testing.T) {
 	rawLocation := &st.RawLocation{
 		UserId:      testutil.TestUserID,
@@ -123,6 +174,17 @@ func TestListUserRawLocationIDs(t *testing.T) {
 	}
 }
 
+func TestListUserRawLocationIDsByTime(t *testing.T) {
+	dao, _ := newRawLocationDAOForTest()
+	testutil.CheckListUserIDsByTime(t, func(userID string, timestamp time.Time) (string, error) {
+		rawLocation, err := dao.InsertUniqueRawLocation(&st.RawLocation{UserId: userID, TimestampMs: util.TimeToMilliseconds(timestamp)})
+		if err != nil {
+			return "", err
+		}
+		return rawLocation.Id, nil
+	}, dao.ListUserRawLocationIDsByTime)
+}
+
 func TestGetRawLocationByID(t *testing.T) {
 	rawLocation := &st.RawLocation{
 		UserId:      testutil.TestUserID,
@@ -4,12 +4,17 @@ import (
 	"context"
 	"log"
 	st "seneca/api/type"
+	"time"
 )
 
 type MockRawMotionDAO struct {
 	InsertUniqueRawMotionMock       func(rawMotion *st.RawMotion) (*st.RawMotion, error)
+	InsertUniqueRawMotionsMock      func(rawMotions []*st.RawMotion) ([]*st.RawMotion, error)
 	GetRawMotionByIDMock            func(id string) (*st.RawMotion, error)
+	GetRawMotionsByIDsMock          func(ids []string) ([]*st.RawMotion, error)
 	ListUserRawMotionIDsMock        func(userID string) ([]string, error)
+	ListUserRawMotionIDsPageMock    func(userID, cursor string, limit int) ([]string, string, error)
+	ListUserRawMotionIDsByTimeMock  func(userID string, startTime time.Time, endTime time.Time) ([]string, error)
 	DeleteRawMotionByIDMock         func(id string) error
 	PutRawMotionByIDMock            func(ctx context.Context, rawMotionID string, rawMotion *st.RawMotion) error
 	ListUnprocessedRawMotionIDsMock func(userID string, latestVersion float64) ([]string, error)
@@ -29,6 +34,13 @@ func (mrmd *MockRawMotionDAO) GetRawMotionByID(id string) (*st.RawMotion, error)
 	return mrmd.GetRawMotionByIDMock(id)
 }
 
+func (mrmd *MockRawMotionDAO) GetRawMotionsByIDs(ids []string) ([]*st.RawMotion, error) {
+	if mrmd.GetRawMotionsByIDsMock == nil {
+		log.Fatal("GetRawMotionsByIDsMock called but not set")
+	}
+	return mrmd.GetRawMotionsByIDsMock(ids)
+}
+
 func (mrmd *MockRawMotionDAO) ListUserRawMotionIDs(userID string) ([]string, error) {
 	if mrmd.ListUserRawMotionIDsMock == nil {
 		log.Fatal("ListUserRawMotionIDsMock called but not set")
@@ -36,6 +48,13 @@ func (mrmd *MockRawMotionDAO) ListUserRawMotionIDs(userID string) ([]string, err
 	return mrmd.ListUserRawMotionIDsMock(userID)
 }
 
+func (mrmd *MockRawMotionDAO) ListUserRawMotionIDsPage(userID, cursor string, limit int) ([]string, string, error) {
+	if mrmd.ListUserRawMotionIDsPageMock == nil {
+		log.Fatal("ListUserRawMotionIDsPageMock called but not set")
+	}
+	return mrmd.ListUserRawMotionIDsPageMock(userID, cursor, limit)
+}
+
 func (mrmd *MockRawMotionDAO) DeleteRawMotionByID(id string) error {
 	if mrmd.DeleteRawMotionByIDMock == nil {
 		log.Fatal("DeleteRawMotionByIDMock called but not set")
@@ -56,3 +75,17 @@ func (mrmd *MockRawMotionDAO) ListUnprocessedRawMotionIDs(userID string, latestV
 	}
 	return mrmd.ListUnprocessedRawMotionIDsMock(userID, latestVersion)
 }
+
+func (mrmd *MockRawMotionDAO) InsertUniqueRawMotions(rawMotions []*st.RawMotion) ([]*st.RawMotion, error) {
+	if mrmd.InsertUniqueRawMotionsMock == nil {
+		log.Fatal("InsertUniqueRawMotionsMock called but not set")
+	}
+	return mrmd.InsertUniqueRawMotionsMock(rawMotions)
+}
+
+func (mrmd *MockRawMotionDAO) ListUserRawMotionIDsByTime(userID string, startTime time.Time, endTime time.Time) ([]string, error) {
+	if mrmd.ListUserRawMotionIDsByTimeMock == nil {
+		log.Fatal("ListUserRawMotionIDsByTimeMock called but not set")
+	}
+	return mrmd.ListUserRawMotionIDsByTimeMock(userID, startTime, endTime)
+}
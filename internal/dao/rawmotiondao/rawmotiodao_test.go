@@ -124,6 +124,17 @@ func TestListUserRawMotionIDs(t *testing.T) {
 	}
 }
 
+func TestListUserRawMotionIDsByTime(t *testing.T) {
+	dao, _ := newRawMotionDAOForTest()
+	testutil.CheckListUserIDsByTime(t, func(userID string, timestamp time.Time) (string, error) {
+		rawMotion, err := dao.InsertUniqueRawMotion(&st.RawMotion{UserId: userID, TimestampMs: util.TimeToMilliseconds(timestamp)})
+		if err != nil {
+			return "", err
+		}
+		return rawMotion.Id, nil
+	}, dao.ListUserRawMotionIDsByTime)
+}
+
 func TestGetRawMotionByID(t *testing.T) {
 	rawMotion := &st.RawMotion{
 		UserId:      testutil.TestUserID,
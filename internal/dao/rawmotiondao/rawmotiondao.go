@@ -8,6 +8,8 @@ import (
 	st "seneca/api/type"
 	"seneca/internal/client/database"
 	"seneca/internal/client/logging"
+	"seneca/internal/util"
+	"time"
 )
 
 type SQLRawMotionDAO struct {
@@ -58,6 +60,64 @@ func (rdao *SQLRawMotionDAO) InsertUniqueRawMotion(rawMotion *st.RawMotion) (*st
 	return rawMotion, nil
 }
 
+// InsertUniqueRawMotions inserts the rawMotions in one transaction, so either all of them are stored or none are.
+func (rdao *SQLRawMotionDAO) InsertUniqueRawMotions(rawMotions []*st.RawMotion) ([]*st.RawMotion, error) {
+	err := rdao.sql.RunInTransaction(context.TODO(), func(tx database.SQLInterface) error {
+		objects := []interface{}{}
+		seen := map[string]bool{}
+		for _, rawMotion := range rawMotions {
+			// The batch isn't in the store yet, so duplicates within it are checked here.
+			key := fmt.Sprintf("%s/%d", rawMotion.UserId, rawMotion.TimestampMs)
+			if seen[key] {
+				return fmt.Errorf("rawMotion with timestamp %d is in the batch twice for user %q", rawMotion.TimestampMs, rawMotion.UserId)
+			}
+			seen[key] = true
+
+			ids, err := tx.ListIDs(constants.RawMotionsTable, []*database.QueryParam{
+				{
+					FieldName: constants.UserIDFieldName,
+					Operand:   "=",
+					Value:     rawMotion.UserId,
+				},
+				{
+					FieldName: constants.TimestampFieldName,
+					Operand:   "=",
+					Value:     rawMotion.TimestampMs,
+				},
+			})
+			if err != nil {
+				return fmt.Errorf("error checking for existing rawMotion %v - err: %w", rawMotion, err)
+			}
+			if len(ids) != 0 {
+				return fmt.Errorf("rawMotion with timestamp %d already exists for user %q", rawMotion.TimestampMs, rawMotion.UserId)
+			}
+			objects = append(objects, rawMotion)
+		}
+
+		newRawMotionIDs, err := tx.CreateMulti(constants.RawMotionsTable, objects)
+		if err != nil {
+			return fmt.Errorf("error inserting %d rawMotions into store: %w", len(rawMotions), err)
+		}
+		for i := range rawMotions {
+			rawMotions[i].Id = newRawMotionIDs[i]
+		}
+
+		// Now set the IDs in the datastore objects.
+		if err := tx.InsertMulti(constants.RawMotionsTable, newRawMotionIDs, objects); err != nil {
+			return fmt.Errorf("error updating IDs for %d rawMotions - err: %w", len(rawMotions), err)
+		}
+		return nil
+	})
+	if err != nil {
+		for _, rawMotion := range rawMotions {
+			rawMotion.Id = ""
+		}
+		return nil, err
+	}
+
+	return rawMotions, nil
+}
+
 func (rdao *SQLRawMotionDAO) PutRawMotionByID(ctx context.Context, rawMotionID string, rawMotion *st.RawMotion) error {
 	return rdao.sql.Insert(constants.RawMotionsTable, rawMotionID, rawMotion)
 }
@@ -84,10 +144,52 @@ func (rdao *SQLRawMotionDAO) GetRawMotionByID(id string) (*st.RawMotion, error)
 	return rawMotion, nil
 }
 
+func (rdao *SQLRawMotionDAO) GetRawMotionsByIDs(ids []string) ([]*st.RawMotion, error) {
+	objects, err := rdao.sql.GetByIDs(constants.RawMotionsTable, ids)
+	if err != nil {
+		return nil, fmt.Errorf("error getting %d rawMotions by ID: %w", len(ids), err)
+	}
+
+	rawMotions := []*st.RawMotion{}
+	for _, object := range objects {
+		rawMotion, ok := object.(*st.RawMotion)
+		if !ok {
+			return nil, fmt.Errorf("expected RawMotion, got %T", object)
+		}
+		rawMotions = append(rawMotions, rawMotion)
+	}
+
+	return rawMotions, nil
+}
+
 func (rdao *SQLRawMotionDAO) ListUserRawMotionIDs(userID string) ([]string, error) {
 	return rdao.sql.ListIDs(constants.RawMotionsTable, []*database.QueryParam{{FieldName: constants.UserIDFieldName, Operand: "=", Value: userID}})
 }
 
+func (rdao *SQLRawMotionDAO) ListUserRawMotionIDsPage(userID, cursor string, limit int) ([]string, string, error) {
+	query := database.NewQuery(constants.RawMotionsTable).
+		Where(constants.UserIDFieldName, "=", userID).
+		OrderBy(constants.TimestampFieldName).
+		WithLimit(limit).
+		WithCursor(cursor)
+	return rdao.sql.ListIDsByQuery(query)
+}
+
+// ListUserRawMotionIDsByTime lists the IDs of the user's rawMotions with timestamps in [startTime, endTime), oldest first.
+func (rdao *SQLRawMotionDAO) ListUserRawMotionIDsByTime(userID string, startTime time.Time, endTime time.Time) ([]string, error) {
+	query := database.NewQuery(constants.RawMotionsTable).
+		Where(constants.UserIDFieldName, "=", userID).
+		Range(constants.TimestampFieldName, util.TimeToMilliseconds(startTime), util.TimeToMilliseconds(endTime)).
+		OrderBy(constants.TimestampFieldName)
+
+	rawMotionIDs, _, err := rdao.sql.ListIDsByQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("error listing rawMotionIDs between %q and %q for user %q: %w", startTime, endTime, userID, err)
+	}
+	return rawMotionIDs, nil
+}
+
 func (rdao *SQLRawMotionDAO) DeleteRawMotionByID(id string) error {
-	return rdao.sql.DeleteByID(constants.RawMotionsTable, id)
+	_, err := database.SoftDelete(context.TODO(), rdao.sql, constants.RawMotionsTable, id, database.DeleteReason)
+	return err
 }
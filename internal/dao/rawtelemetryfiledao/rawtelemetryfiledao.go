@@ -0,0 +1,90 @@
+package rawtelemetryfiledao
+
+import (
+	"context"
+	"fmt"
+	"seneca/api/constants"
+	"seneca/api/senecaerror"
+	"seneca/internal/client/database"
+)
+
+// formatFieldName is the field RawTelemetryFiles are told apart by when they're created at the same time, e.g. the
+// GPS and OBD-II logs of a drive.
+const formatFieldName constants.SenecaTypeFieldName = "Format"
+
+type SQLRawTelemetryFileDAO struct {
+	sql database.SQLInterface
+}
+
+func NewSQLRawTelemetryFileDAO(sqlInterface database.SQLInterface) *SQLRawTelemetryFileDAO {
+	return &SQLRawTelemetryFileDAO{
+		sql: sqlInterface,
+	}
+}
+
+func (rdao *SQLRawTelemetryFileDAO) InsertUniqueRawTelemetryFile(rawTelemetryFile *database.RawTelemetryFile) (*database.RawTelemetryFile, error) {
+	ids, err := rdao.sql.ListIDs(constants.RawTelemetryFilesTable, []*database.QueryParam{
+		{
+			FieldName: constants.UserIDFieldName,
+			Operand:   "=",
+			Value:     rawTelemetryFile.UserId,
+		},
+		{
+			FieldName: constants.CreateTimeFieldName,
+			Operand:   "=",
+			Value:     rawTelemetryFile.CreateTimeMs,
+		},
+		{
+			FieldName: formatFieldName,
+			Operand:   "=",
+			Value:     rawTelemetryFile.Format,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error checking for existing rawTelemetryFile %v - err: %w", rawTelemetryFile, err)
+	}
+
+	if len(ids) != 0 {
+		return nil, fmt.Errorf("%s rawTelemetryFile with create time %d already exists for user %q", rawTelemetryFile.Format, rawTelemetryFile.CreateTimeMs, rawTelemetryFile.UserId)
+	}
+
+	newRawTelemetryFileID, err := rdao.sql.Create(constants.RawTelemetryFilesTable, rawTelemetryFile)
+	if err != nil {
+		return nil, fmt.Errorf("error inserting rawTelemetryFile %v into store: %w", rawTelemetryFile, err)
+	}
+	rawTelemetryFile.Id = newRawTelemetryFileID
+
+	// Now set the ID in the datastore object.
+	if err := rdao.sql.Insert(constants.RawTelemetryFilesTable, rawTelemetryFile.Id, rawTelemetryFile); err != nil {
+		return nil, fmt.Errorf("error updating rawTelemetryFileID for rawTelemetryFile %v - err: %w", rawTelemetryFile, err)
+	}
+
+	return rawTelemetryFile, nil
+}
+
+func (rdao *SQLRawTelemetryFileDAO) GetRawTelemetryFileByID(id string) (*database.RawTelemetryFile, error) {
+	rawTelemetryFileObj, err := rdao.sql.GetByID(constants.RawTelemetryFilesTable, id)
+	if err != nil {
+		return nil, fmt.Errorf("error getting rawTelemetryFile %q by ID: %w", id, err)
+	}
+
+	if rawTelemetryFileObj == nil {
+		return nil, senecaerror.NewNotFoundError(fmt.Errorf("rawTelemetryFile with ID %q not found in the store", id))
+	}
+
+	rawTelemetryFile, ok := rawTelemetryFileObj.(*database.RawTelemetryFile)
+	if !ok {
+		return nil, fmt.Errorf("expected RawTelemetryFile, got %T", rawTelemetryFileObj)
+	}
+
+	return rawTelemetryFile, nil
+}
+
+func (rdao *SQLRawTelemetryFileDAO) ListUserRawTelemetryFileIDs(userID string) ([]string, error) {
+	return rdao.sql.ListIDs(constants.RawTelemetryFilesTable, []*database.QueryParam{{FieldName: constants.UserIDFieldName, Operand: "=", Value: userID}})
+}
+
+func (rdao *SQLRawTelemetryFileDAO) DeleteRawTelemetryFileByID(id string) error {
+	_, err := database.SoftDelete(context.TODO(), rdao.sql, constants.RawTelemetryFilesTable, id, database.DeleteReason)
+	return err
+}
@@ -0,0 +1,139 @@
+package rawtelemetryfiledao_test
+
+import (
+	"errors"
+	"seneca/api/constants"
+	"seneca/api/senecaerror"
+	"seneca/internal/client/database"
+	"seneca/internal/dao/rawtelemetryfiledao"
+	"seneca/internal/util"
+	"seneca/test/testutil"
+	"sort"
+	"testing"
+	"time"
+)
+
+var createTime = time.Date(1996, time.May, 23, 0, 0, 0, 0, time.UTC)
+
+func TestInsertUniqueRawTelemetryFile(t *testing.T) {
+	rawTelemetryFile := &database.RawTelemetryFile{
+		UserId:       testutil.TestUserID,
+		CreateTimeMs: util.TimeToMilliseconds(createTime),
+	}
+
+	dao, sql := newRawTelemetryFileDAOForTest()
+
+	alreadyExistingRawTelemetryFile := &database.RawTelemetryFile{
+		UserId:       testutil.TestUserID,
+		CreateTimeMs: util.TimeToMilliseconds(createTime),
+	}
+
+	// Already exists.
+	existingID, err := sql.Create(constants.RawTelemetryFilesTable, alreadyExistingRawTelemetryFile)
+	if err != nil {
+		t.Fatalf("sql.Create(_, alreadyExistingRawTelemetryFile) returns err: %v", err)
+	}
+
+	if _, err := dao.InsertUniqueRawTelemetryFile(rawTelemetryFile); err == nil {
+		t.Fatalf("Expected err for InsertUniqueRawTelemetryFile() when already exists, got nil")
+	}
+
+	// No conflict with another format, e.g. the vehicle log of the same drive.
+	if _, err := dao.InsertUniqueRawTelemetryFile(&database.RawTelemetryFile{
+		UserId:       testutil.TestUserID,
+		Format:       "candump",
+		CreateTimeMs: util.TimeToMilliseconds(createTime),
+	}); err != nil {
+		t.Fatalf("InsertUniqueRawTelemetryFile() for another format returns err: %v", err)
+	}
+
+	// No conflict with time difference.
+	alreadyExistingRawTelemetryFile.CreateTimeMs += time.Minute.Milliseconds()
+	if err := sql.Insert(constants.RawTelemetryFilesTable, existingID, alreadyExistingRawTelemetryFile); err != nil {
+		t.Fatalf("Insert() returns err: %v", err)
+	}
+
+	rawTelemetryFileWithID, err := dao.InsertUniqueRawTelemetryFile(rawTelemetryFile)
+	if err != nil {
+		t.Fatalf("InsertUniqueRawTelemetryFile() returns err: %v", err)
+	}
+	if rawTelemetryFileWithID.Id == "" {
+		t.Fatalf("Newly created RawTelemetryFile not assigned ID")
+	}
+
+	// Now induce errors for coverage.
+	if err := dao.DeleteRawTelemetryFileByID(rawTelemetryFileWithID.Id); err != nil {
+		t.Fatalf("DeleteRawTelemetryFileByID() returns err: %v", err)
+	}
+
+	for i := 1; i < 4; i++ {
+		sql.ErrorCalls = make(chan bool, 3)
+
+		for j := 0; j < i; j++ {
+			sql.ErrorCalls <- j == i-1
+		}
+
+		if _, err := dao.InsertUniqueRawTelemetryFile(rawTelemetryFile); err == nil {
+			t.Fatalf("Expected err from InsertUniqueRawTelemetryFile() when call %d fails, got nil", i)
+		}
+
+		close(sql.ErrorCalls)
+	}
+}
+
+func TestGetAndListRawTelemetryFiles(t *testing.T) {
+	dao, _ := newRawTelemetryFileDAOForTest()
+
+	if _, err := dao.GetRawTelemetryFileByID("nonexistent"); err == nil {
+		t.Fatalf("Want err from GetRawTelemetryFileByID() for non-existant ID, got nil")
+	} else {
+		var nfe *senecaerror.NotFoundError
+		if !errors.As(err, &nfe) {
+			t.Fatalf("Want NotFoundError from GetRawTelemetryFileByID() for non-existant ID, got %v", err)
+		}
+	}
+
+	wantIDs := []string{}
+	for i := 0; i < 3; i++ {
+		rawTelemetryFile, err := dao.InsertUniqueRawTelemetryFile(&database.RawTelemetryFile{
+			UserId:           testutil.TestUserID,
+			OriginalFileName: "track.gpx",
+			CreateTimeMs:     util.TimeToMilliseconds(createTime.Add(time.Duration(i) * time.Hour)),
+		})
+		if err != nil {
+			t.Fatalf("InsertUniqueRawTelemetryFile() returns err: %v", err)
+		}
+		wantIDs = append(wantIDs, rawTelemetryFile.Id)
+	}
+	if _, err := dao.InsertUniqueRawTelemetryFile(&database.RawTelemetryFile{UserId: "otherUser", CreateTimeMs: util.TimeToMilliseconds(createTime)}); err != nil {
+		t.Fatalf("InsertUniqueRawTelemetryFile() for another user returns err: %v", err)
+	}
+
+	rawTelemetryFile, err := dao.GetRawTelemetryFileByID(wantIDs[1])
+	if err != nil {
+		t.Fatalf("GetRawTelemetryFileByID() returns err: %v", err)
+	}
+	if rawTelemetryFile.Id != wantIDs[1] || rawTelemetryFile.OriginalFileName != "track.gpx" {
+		t.Errorf("Want RawTelemetryFile %q of track.gpx, got %v", wantIDs[1], rawTelemetryFile)
+	}
+
+	ids, err := dao.ListUserRawTelemetryFileIDs(testutil.TestUserID)
+	if err != nil {
+		t.Fatalf("ListUserRawTelemetryFileIDs() returns err: %v", err)
+	}
+	sort.Strings(ids)
+	sort.Strings(wantIDs)
+	if len(ids) != len(wantIDs) {
+		t.Fatalf("Want IDs %v, got %v", wantIDs, ids)
+	}
+	for i := range ids {
+		if ids[i] != wantIDs[i] {
+			t.Fatalf("Want IDs %v, got %v", wantIDs, ids)
+		}
+	}
+}
+
+func newRawTelemetryFileDAOForTest() (*rawtelemetryfiledao.SQLRawTelemetryFileDAO, *database.FakeSQLDBService) {
+	fakeSQLService := database.NewFake()
+	return rawtelemetryfiledao.NewSQLRawTelemetryFileDAO(fakeSQLService), fakeSQLService
+}
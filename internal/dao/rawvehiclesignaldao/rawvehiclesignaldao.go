@@ -0,0 +1,190 @@
+package rawvehiclesignaldao
+
+import (
+	"context"
+	"fmt"
+	"seneca/api/constants"
+	"seneca/api/senecaerror"
+	"seneca/internal/client/database"
+	"seneca/internal/util"
+	"time"
+)
+
+// signalFieldName is the field RawVehicleSignals are told apart by when they share a timestamp.
+const signalFieldName constants.SenecaTypeFieldName = "Signal"
+
+type SQLRawVehicleSignalDAO struct {
+	sql database.SQLInterface
+}
+
+func NewSQLRawVehicleSignalDAO(sqlInterface database.SQLInterface) *SQLRawVehicleSignalDAO {
+	return &SQLRawVehicleSignalDAO{
+		sql: sqlInterface,
+	}
+}
+
+// InsertUniqueRawVehicleSignals inserts the rawVehicleSignals in one transaction, so either all of them are stored or
+// none are.  A user can only have one reading of each signal at a time, which is checked with one query over the
+// time range of the batch per user, rather than one per rawVehicleSignal.
+func (rdao *SQLRawVehicleSignalDAO) InsertUniqueRawVehicleSignals(rawVehicleSignals []*database.RawVehicleSignal) ([]*database.RawVehicleSignal, error) {
+	err := rdao.sql.RunInTransaction(context.TODO(), func(tx database.SQLInterface) error {
+		type key struct {
+			userID      string
+			timestampMs int64
+			signal      string
+		}
+		// spans are the earliest and latest timestamps of the batch by user.
+		type span struct {
+			startMs, endMs int64
+		}
+		objects := []interface{}{}
+		seen := map[key]bool{}
+		spans := map[string]*span{}
+		for _, rawVehicleSignal := range rawVehicleSignals {
+			// The batch isn't in the store yet, so duplicates within it are checked here.
+			k := key{userID: rawVehicleSignal.UserId, timestampMs: rawVehicleSignal.TimestampMs, signal: rawVehicleSignal.Signal}
+			if seen[k] {
+				return fmt.Errorf("rawVehicleSignal %q with timestamp %d is in the batch twice for user %q", rawVehicleSignal.Signal, rawVehicleSignal.TimestampMs, rawVehicleSignal.UserId)
+			}
+			seen[k] = true
+
+			if s, ok := spans[rawVehicleSignal.UserId]; !ok {
+				spans[rawVehicleSignal.UserId] = &span{startMs: rawVehicleSignal.TimestampMs, endMs: rawVehicleSignal.TimestampMs}
+			} else if rawVehicleSignal.TimestampMs < s.startMs {
+				s.startMs = rawVehicleSignal.TimestampMs
+			} else if rawVehicleSignal.TimestampMs > s.endMs {
+				s.endMs = rawVehicleSignal.TimestampMs
+			}
+			objects = append(objects, rawVehicleSignal)
+		}
+
+		for userID, s := range spans {
+			query := database.NewQuery(constants.RawVehicleSignalsTable).
+				Where(constants.UserIDFieldName, "=", userID).
+				Range(constants.TimestampFieldName, s.startMs, s.endMs+1)
+			ids, _, err := tx.ListIDsByQuery(query)
+			if err != nil {
+				return fmt.Errorf("error checking for existing rawVehicleSignals of user %q - err: %w", userID, err)
+			}
+			if len(ids) == 0 {
+				continue
+			}
+			existingObjects, err := tx.GetByIDs(constants.RawVehicleSignalsTable, ids)
+			if err != nil {
+				return fmt.Errorf("error getting %d existing rawVehicleSignals of user %q - err: %w", len(ids), userID, err)
+			}
+			for _, existingObject := range existingObjects {
+				existing, ok := existingObject.(*database.RawVehicleSignal)
+				if !ok {
+					return fmt.Errorf("expected RawVehicleSignal, got %T", existingObject)
+				}
+				if seen[key{userID: existing.UserId, timestampMs: existing.TimestampMs, signal: existing.Signal}] {
+					return fmt.Errorf("rawVehicleSignal %q with timestamp %d already exists for user %q", existing.Signal, existing.TimestampMs, existing.UserId)
+				}
+			}
+		}
+
+		newRawVehicleSignalIDs, err := tx.CreateMulti(constants.RawVehicleSignalsTable, objects)
+		if err != nil {
+			return fmt.Errorf("error inserting %d rawVehicleSignals into store: %w", len(rawVehicleSignals), err)
+		}
+		for i := range rawVehicleSignals {
+			rawVehicleSignals[i].Id = newRawVehicleSignalIDs[i]
+		}
+
+		// Now set the IDs in the datastore objects.
+		if err := tx.InsertMulti(constants.RawVehicleSignalsTable, newRawVehicleSignalIDs, objects); err != nil {
+			return fmt.Errorf("error updating IDs for %d rawVehicleSignals - err: %w", len(rawVehicleSignals), err)
+		}
+		return nil
+	})
+	if err != nil {
+		for _, rawVehicleSignal := range rawVehicleSignals {
+			rawVehicleSignal.Id = ""
+		}
+		return nil, err
+	}
+
+	return rawVehicleSignals, nil
+}
+
+func (rdao *SQLRawVehicleSignalDAO) PutRawVehicleSignalByID(ctx context.Context, rawVehicleSignalID string, rawVehicleSignal *database.RawVehicleSignal) error {
+	return rdao.sql.Insert(constants.RawVehicleSignalsTable, rawVehicleSignalID, rawVehicleSignal)
+}
+
+// PutRawVehicleSignalsByIDs puts the rawVehicleSignals with the given IDs in one multi write, e.g. to mark them
+// processed.
+func (rdao *SQLRawVehicleSignalDAO) PutRawVehicleSignalsByIDs(ctx context.Context, rawVehicleSignalIDs []string, rawVehicleSignals []*database.RawVehicleSignal) error {
+	objects := make([]interface{}, len(rawVehicleSignals))
+	for i, rawVehicleSignal := range rawVehicleSignals {
+		objects[i] = rawVehicleSignal
+	}
+	if err := rdao.sql.InsertMulti(constants.RawVehicleSignalsTable, rawVehicleSignalIDs, objects); err != nil {
+		return fmt.Errorf("error putting %d rawVehicleSignals - err: %w", len(rawVehicleSignals), err)
+	}
+	return nil
+}
+
+func (rdao *SQLRawVehicleSignalDAO) ListUnprocessedRawVehicleSignalIDs(userID string, latestVersion float64) ([]string, error) {
+	return rdao.sql.ListIDs(constants.RawVehicleSignalsTable, []*database.QueryParam{{FieldName: constants.UserIDFieldName, Operand: "=", Value: userID}, {FieldName: constants.AlgosVersionFieldName, Operand: "<", Value: latestVersion}})
+}
+
+func (rdao *SQLRawVehicleSignalDAO) GetRawVehicleSignalByID(id string) (*database.RawVehicleSignal, error) {
+	rawVehicleSignalObj, err := rdao.sql.GetByID(constants.RawVehicleSignalsTable, id)
+	if err != nil {
+		return nil, fmt.Errorf("error getting rawVehicleSignal %q by ID: %w", id, err)
+	}
+
+	if rawVehicleSignalObj == nil {
+		return nil, senecaerror.NewNotFoundError(fmt.Errorf("rawVehicleSignal with ID %q not found in the store", id))
+	}
+
+	rawVehicleSignal, ok := rawVehicleSignalObj.(*database.RawVehicleSignal)
+	if !ok {
+		return nil, fmt.Errorf("expected RawVehicleSignal, got %T", rawVehicleSignalObj)
+	}
+
+	return rawVehicleSignal, nil
+}
+
+func (rdao *SQLRawVehicleSignalDAO) GetRawVehicleSignalsByIDs(ids []string) ([]*database.RawVehicleSignal, error) {
+	objects, err := rdao.sql.GetByIDs(constants.RawVehicleSignalsTable, ids)
+	if err != nil {
+		return nil, fmt.Errorf("error getting %d rawVehicleSignals by ID: %w", len(ids), err)
+	}
+
+	rawVehicleSignals := []*database.RawVehicleSignal{}
+	for _, object := range objects {
+		rawVehicleSignal, ok := object.(*database.RawVehicleSignal)
+		if !ok {
+			return nil, fmt.Errorf("expected RawVehicleSignal, got %T", object)
+		}
+		rawVehicleSignals = append(rawVehicleSignals, rawVehicleSignal)
+	}
+
+	return rawVehicleSignals, nil
+}
+
+func (rdao *SQLRawVehicleSignalDAO) ListUserRawVehicleSignalIDs(userID string) ([]string, error) {
+	return rdao.sql.ListIDs(constants.RawVehicleSignalsTable, []*database.QueryParam{{FieldName: constants.UserIDFieldName, Operand: "=", Value: userID}})
+}
+
+// ListUserRawVehicleSignalIDsByTime lists the IDs of the user's rawVehicleSignals with timestamps in
+// [startTime, endTime), oldest first.
+func (rdao *SQLRawVehicleSignalDAO) ListUserRawVehicleSignalIDsByTime(userID string, startTime time.Time, endTime time.Time) ([]string, error) {
+	query := database.NewQuery(constants.RawVehicleSignalsTable).
+		Where(constants.UserIDFieldName, "=", userID).
+		Range(constants.TimestampFieldName, util.TimeToMilliseconds(startTime), util.TimeToMilliseconds(endTime)).
+		OrderBy(constants.TimestampFieldName)
+
+	rawVehicleSignalIDs, _, err := rdao.sql.ListIDsByQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("error listing rawVehicleSignalIDs between %q and %q for user %q: %w", startTime, endTime, userID, err)
+	}
+	return rawVehicleSignalIDs, nil
+}
+
+func (rdao *SQLRawVehicleSignalDAO) DeleteRawVehicleSignalByID(id string) error {
+	_, err := database.SoftDelete(context.TODO(), rdao.sql, constants.RawVehicleSignalsTable, id, database.DeleteReason)
+	return err
+}
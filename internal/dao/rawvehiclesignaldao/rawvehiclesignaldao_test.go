@@ -0,0 +1,171 @@
+package rawvehiclesignaldao_test
+
+import (
+	"context"
+	"errors"
+	"seneca/api/constants"
+	"seneca/api/senecaerror"
+	"seneca/internal/client/database"
+	"seneca/internal/dao/rawvehiclesignaldao"
+	"seneca/internal/util"
+	"seneca/test/testutil"
+	"testing"
+	"time"
+)
+
+var createTime = time.Date(1996, time.May, 23, 0, 0, 0, 0, time.UTC)
+
+func TestInsertUniqueRawVehicleSignals(t *testing.T) {
+	dao, sql := newRawVehicleSignalDAOForTest()
+
+	alreadyExistingRawVehicleSignal := &database.RawVehicleSignal{
+		UserId:      testutil.TestUserID,
+		Signal:      "speed_mph",
+		TimestampMs: util.TimeToMilliseconds(createTime),
+	}
+	if _, err := sql.Create(constants.RawVehicleSignalsTable, alreadyExistingRawVehicleSignal); err != nil {
+		t.Fatalf("sql.Create(_, alreadyExistingRawVehicleSignal) returns err: %v", err)
+	}
+
+	// Already exists, so none of the batch is stored.
+	if _, err := dao.InsertUniqueRawVehicleSignals([]*database.RawVehicleSignal{
+		{UserId: testutil.TestUserID, Signal: "brake_percent", TimestampMs: util.TimeToMilliseconds(createTime)},
+		{UserId: testutil.TestUserID, Signal: "speed_mph", TimestampMs: util.TimeToMilliseconds(createTime)},
+	}); err == nil {
+		t.Fatalf("Expected err for InsertUniqueRawVehicleSignals() when already exists, got nil")
+	}
+	if ids, err := dao.ListUserRawVehicleSignalIDs(testutil.TestUserID); err != nil || len(ids) != 1 {
+		t.Fatalf("Want 1 RawVehicleSignal after failed insert, got %v, %v", ids, err)
+	}
+
+	// Twice in the batch.
+	if _, err := dao.InsertUniqueRawVehicleSignals([]*database.RawVehicleSignal{
+		{UserId: testutil.TestUserID, Signal: "rpm", TimestampMs: util.TimeToMilliseconds(createTime)},
+		{UserId: testutil.TestUserID, Signal: "rpm", TimestampMs: util.TimeToMilliseconds(createTime)},
+	}); err == nil {
+		t.Fatalf("Expected err for InsertUniqueRawVehicleSignals() with a duplicate in the batch, got nil")
+	}
+
+	// Other signals at the same time don't conflict.
+	rawVehicleSignals, err := dao.InsertUniqueRawVehicleSignals([]*database.RawVehicleSignal{
+		{UserId: testutil.TestUserID, Signal: "brake_percent", TimestampMs: util.TimeToMilliseconds(createTime)},
+		{UserId: testutil.TestUserID, Signal: "rpm", TimestampMs: util.TimeToMilliseconds(createTime)},
+	})
+	if err != nil {
+		t.Fatalf("InsertUniqueRawVehicleSignals() returns err: %v", err)
+	}
+	for _, rawVehicleSignal := range rawVehicleSignals {
+		if rawVehicleSignal.Id == "" {
+			t.Fatalf("Newly created RawVehicleSignal not assigned ID")
+		}
+	}
+
+	// Now induce errors for coverage.
+	if err := dao.DeleteRawVehicleSignalByID(rawVehicleSignals[0].Id); err != nil {
+		t.Fatalf("DeleteRawVehicleSignalByID() returns err: %v", err)
+	}
+
+	batch := []*database.RawVehicleSignal{{UserId: testutil.TestUserID, Signal: "throttle_percent", TimestampMs: util.TimeToMilliseconds(createTime)}}
+	for i := 1; i < 4; i++ {
+		sql.ErrorCalls = make(chan bool, 3)
+
+		for j := 0; j < i; j++ {
+			sql.ErrorCalls <- j == i-1
+		}
+
+		if _, err := dao.InsertUniqueRawVehicleSignals(batch); err == nil {
+			t.Fatalf("Expected err from InsertUniqueRawVehicleSignals() when call %d fails, got nil", i)
+		}
+		if batch[0].Id != "" {
+			t.Fatalf("Want no ID after a failed InsertUniqueRawVehicleSignals(), got %q", batch[0].Id)
+		}
+
+		close(sql.ErrorCalls)
+	}
+}
+
+func TestGetAndListRawVehicleSignals(t *testing.T) {
+	dao, _ := newRawVehicleSignalDAOForTest()
+
+	_, err := dao.GetRawVehicleSignalByID("nonexistent")
+	var nfe *senecaerror.NotFoundError
+	if !errors.As(err, &nfe) {
+		t.Fatalf("Want NotFoundError from GetRawVehicleSignalByID() for non-existant ID, got %v", err)
+	}
+
+	batch := []*database.RawVehicleSignal{}
+	for i := 0; i < 10; i++ {
+		for _, userID := range []string{testutil.TestUserID, "546"} {
+			batch = append(batch, &database.RawVehicleSignal{
+				UserId:      userID,
+				Signal:      "speed_mph",
+				Value:       float64(i),
+				TimestampMs: util.TimeToMilliseconds(createTime.Add(time.Second * time.Duration(i))),
+			})
+		}
+	}
+	if _, err := dao.InsertUniqueRawVehicleSignals(batch); err != nil {
+		t.Fatalf("InsertUniqueRawVehicleSignals() returns err: %v", err)
+	}
+
+	ids, err := dao.ListUserRawVehicleSignalIDs(testutil.TestUserID)
+	if err != nil {
+		t.Fatalf("ListUserRawVehicleSignalIDs() returns err: %v", err)
+	}
+	rawVehicleSignals, err := dao.GetRawVehicleSignalsByIDs(ids)
+	if err != nil {
+		t.Fatalf("GetRawVehicleSignalsByIDs() returns err: %v", err)
+	}
+	if len(rawVehicleSignals) != 10 {
+		t.Fatalf("Want 10 RawVehicleSignals, got %d", len(rawVehicleSignals))
+	}
+	for i, rawVehicleSignal := range rawVehicleSignals {
+		if rawVehicleSignal.UserId != testutil.TestUserID || rawVehicleSignal.Id != ids[i] {
+			t.Fatalf("Want RawVehicleSignal %q of user %q at %d, got %v", ids[i], testutil.TestUserID, i, rawVehicleSignal)
+		}
+	}
+
+	// Processing a signal takes it out of the unprocessed list.
+	rawVehicleSignal, err := dao.GetRawVehicleSignalByID(ids[0])
+	if err != nil {
+		t.Fatalf("GetRawVehicleSignalByID() returns err: %v", err)
+	}
+	rawVehicleSignal.AlgosVersion = 1
+	if err := dao.PutRawVehicleSignalByID(context.TODO(), rawVehicleSignal.Id, rawVehicleSignal); err != nil {
+		t.Fatalf("PutRawVehicleSignalByID() returns err: %v", err)
+	}
+	unprocessedIDs, err := dao.ListUnprocessedRawVehicleSignalIDs(testutil.TestUserID, 1)
+	if err != nil {
+		t.Fatalf("ListUnprocessedRawVehicleSignalIDs() returns err: %v", err)
+	}
+	if len(unprocessedIDs) != 9 {
+		t.Errorf("Want 9 unprocessed RawVehicleSignals, got %d", len(unprocessedIDs))
+	}
+
+	// So does processing them all at once.
+	for _, rawVehicleSignal := range rawVehicleSignals {
+		rawVehicleSignal.AlgosVersion = 1
+	}
+	if err := dao.PutRawVehicleSignalsByIDs(context.TODO(), ids, rawVehicleSignals); err != nil {
+		t.Fatalf("PutRawVehicleSignalsByIDs() returns err: %v", err)
+	}
+	if unprocessedIDs, err := dao.ListUnprocessedRawVehicleSignalIDs(testutil.TestUserID, 1); err != nil || len(unprocessedIDs) != 0 {
+		t.Errorf("Want no unprocessed RawVehicleSignals, got %v, %v", unprocessedIDs, err)
+	}
+}
+
+func TestListUserRawVehicleSignalIDsByTime(t *testing.T) {
+	dao, _ := newRawVehicleSignalDAOForTest()
+	testutil.CheckListUserIDsByTime(t, func(userID string, timestamp time.Time) (string, error) {
+		rawVehicleSignals, err := dao.InsertUniqueRawVehicleSignals([]*database.RawVehicleSignal{{UserId: userID, Signal: "speed_mph", TimestampMs: util.TimeToMilliseconds(timestamp)}})
+		if err != nil {
+			return "", err
+		}
+		return rawVehicleSignals[0].Id, nil
+	}, dao.ListUserRawVehicleSignalIDsByTime)
+}
+
+func newRawVehicleSignalDAOForTest() (*rawvehiclesignaldao.SQLRawVehicleSignalDAO, *database.FakeSQLDBService) {
+	fakeSQLService := database.NewFake()
+	return rawvehiclesignaldao.NewSQLRawVehicleSignalDAO(fakeSQLService), fakeSQLService
+}
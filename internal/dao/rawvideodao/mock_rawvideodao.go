@@ -9,7 +9,9 @@ import (
 type MockRawVideoDAO struct {
 	InsertUniqueRawVideoMock       func(rawVideo *st.RawVideo) (*st.RawVideo, error)
 	GetRawVideoByIDMock            func(id string) (*st.RawVideo, error)
+	GetRawVideosByIDsMock          func(ids []string) ([]*st.RawVideo, error)
 	ListUserRawVideoIDsMock        func(userID string) ([]string, error)
+	ListUserRawVideoIDsPageMock    func(userID, cursor string, limit int) ([]string, string, error)
 	DeleteRawVideoByIDMock         func(id string) error
 	PutRawVideoByIDMock            func(ctx context.Context, rawVideoID string, rawVideo *st.RawVideo) error
 	ListUnprocessedRawVideoIDsMock func(userID string, latestVersion float64) ([]string, error)
@@ -29,6 +31,13 @@ func (mrvd *MockRawVideoDAO) GetRawVideoByID(id string) (*st.RawVideo, error) {
 	return mrvd.GetRawVideoByIDMock(id)
 }
 
+func (mrvd *MockRawVideoDAO) GetRawVideosByIDs(ids []string) ([]*st.RawVideo, error) {
+	if mrvd.GetRawVideosByIDsMock == nil {
+		log.Fatal("GetRawVideosByIDsMock called but not set")
+	}
+	return mrvd.GetRawVideosByIDsMock(ids)
+}
+
 func (mrvd *MockRawVideoDAO) ListUserRawVideoIDs(userID string) ([]string, error) {
 	if mrvd.ListUserRawVideoIDsMock == nil {
 		log.Fatal("ListUserRawVideoIDsMock called but not set")
@@ -36,6 +45,13 @@ func (mrvd *MockRawVideoDAO) ListUserRawVideoIDs(userID string) ([]string, error
 	return mrvd.ListUserRawVideoIDsMock(userID)
 }
 
+func (mrvd *MockRawVideoDAO) ListUserRawVideoIDsPage(userID, cursor string, limit int) ([]string, string, error) {
+	if mrvd.ListUserRawVideoIDsPageMock == nil {
+		log.Fatal("ListUserRawVideoIDsPageMock called but not set")
+	}
+	return mrvd.ListUserRawVideoIDsPageMock(userID, cursor, limit)
+}
+
 func (mrvd *MockRawVideoDAO) DeleteRawVideoByID(id string) error {
 	if mrvd.DeleteRawVideoByIDMock == nil {
 		log.Fatal("DeleteRawVideoByIDMock called but not set")
@@ -93,10 +93,38 @@ func (rdao *SQLRawVideoDAO) GetRawVideoByID(id string) (*st.RawVideo, error) {
 	return rawVideo, nil
 }
 
+func (rdao *SQLRawVideoDAO) GetRawVideosByIDs(ids []string) ([]*st.RawVideo, error) {
+	objects, err := rdao.sql.GetByIDs(constants.RawVideosTable, ids)
+	if err != nil {
+		return nil, fmt.Errorf("error getting %d rawVideos by ID: %w", len(ids), err)
+	}
+
+	rawVideos := []*st.RawVideo{}
+	for _, object := range objects {
+		rawVideo, ok := object.(*st.RawVideo)
+		if !ok {
+			return nil, fmt.Errorf("expected RawVideo, got %T", object)
+		}
+		rawVideos = append(rawVideos, rawVideo)
+	}
+
+	return rawVideos, nil
+}
+
 func (rdao *SQLRawVideoDAO) ListUserRawVideoIDs(userID string) ([]string, error) {
 	return rdao.sql.ListIDs(constants.RawVideosTable, []*database.QueryParam{{FieldName: constants.UserIDFieldName, Operand: "=", Value: userID}})
 }
 
+func (rdao *SQLRawVideoDAO) ListUserRawVideoIDsPage(userID, cursor string, limit int) ([]string, string, error) {
+	query := database.NewQuery(constants.RawVideosTable).
+		Where(constants.UserIDFieldName, "=", userID).
+		OrderBy(constants.CreateTimeFieldName).
+		WithLimit(limit).
+		WithCursor(cursor)
+	return rdao.sql.ListIDsByQuery(query)
+}
+
 func (rdao *SQLRawVideoDAO) DeleteRawVideoByID(id string) error {
-	return rdao.sql.DeleteByID(constants.RawVideosTable, id)
+	_, err := database.SoftDelete(context.TODO(), rdao.sql, constants.RawVideosTable, id, database.DeleteReason)
+	return err
 }
@@ -0,0 +1,59 @@
+// Package sqldaoset builds the SQL implementation of every DAO on top of one database.SQLInterface.
+package sqldaoset
+
+import (
+	"context"
+	"seneca/internal/client/database"
+	"seneca/internal/client/logging"
+	"seneca/internal/dao"
+	"seneca/internal/dao/drivingconditiondao"
+	"seneca/internal/dao/eventdao"
+	"seneca/internal/dao/rawframedao"
+	"seneca/internal/dao/rawlocationdao"
+	"seneca/internal/dao/rawmotiondao"
+	"seneca/internal/dao/rawtelemetryfiledao"
+	"seneca/internal/dao/rawvehiclesignaldao"
+	"seneca/internal/dao/rawvideodao"
+	"seneca/internal/dao/tripdao"
+	"seneca/internal/dao/userdao"
+	"time"
+)
+
+// New returns the SQL DAOs on top of sqlInterface.
+func New(sqlInterface database.SQLInterface, logger logging.LoggingInterface, rawVideoCreateTimeOffset time.Duration) *dao.AllDAOSet {
+	tripDAO := tripdao.NewSQLTripDAO(sqlInterface, logger)
+	return &dao.AllDAOSet{
+		UserDAO:             userdao.NewSQLUserDAO(sqlInterface),
+		RawVideoDAO:         rawvideodao.NewSQLRawVideoDAO(sqlInterface, logger, rawVideoCreateTimeOffset),
+		RawLocationDAO:      rawlocationdao.NewSQLRawLocationDAO(sqlInterface),
+		RawFrameDAO:         rawframedao.NewSQLRawFrameDAO(sqlInterface),
+		RawMotionDAO:        rawmotiondao.NewSQLRawMotionDAO(sqlInterface, logger),
+		TripDAO:             tripDAO,
+		EventDAO:            eventdao.NewSQLEventDAO(sqlInterface, tripDAO, logger),
+		DrivingConditionDAO: drivingconditiondao.NewSQLDrivingConditionDAO(sqlInterface, drivingconditiondao.SQLTripDAOs(logger)),
+		RawTelemetryFileDAO: rawtelemetryfiledao.NewSQLRawTelemetryFileDAO(sqlInterface),
+		RawVehicleSignalDAO: rawvehiclesignaldao.NewSQLRawVehicleSignalDAO(sqlInterface),
+	}
+}
+
+// TransactionRunner implements dao.TransactionRunner with SQLInterface.RunInTransaction().
+type TransactionRunner struct {
+	sql                      database.SQLInterface
+	logger                   logging.LoggingInterface
+	rawVideoCreateTimeOffset time.Duration
+}
+
+func NewTransactionRunner(sqlInterface database.SQLInterface, logger logging.LoggingInterface, rawVideoCreateTimeOffset time.Duration) *TransactionRunner {
+	return &TransactionRunner{
+		sql:                      sqlInterface,
+		logger:                   logger,
+		rawVideoCreateTimeOffset: rawVideoCreateTimeOffset,
+	}
+}
+
+// RunInTransaction calls f with DAOs built on the transaction.
+func (tr *TransactionRunner) RunInTransaction(ctx context.Context, f func(daos *dao.AllDAOSet) error) error {
+	return tr.sql.RunInTransaction(ctx, func(tx database.SQLInterface) error {
+		return f(New(tx, tr.logger, tr.rawVideoCreateTimeOffset))
+	})
+}
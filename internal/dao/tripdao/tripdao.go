@@ -70,6 +70,27 @@ func (tdao *SQLTripDAO) GetTripByID(userID, tripID string) (*st.TripInternal, er
 	return trip, nil
 }
 
+func (tdao *SQLTripDAO) GetTripsByIDs(userID string, tripIDs []string) ([]*st.TripInternal, error) {
+	objects, err := tdao.sql.GetByIDs(constants.TripTable, tripIDs)
+	if err != nil {
+		return nil, fmt.Errorf("error getting %d trips from store: %w", len(tripIDs), err)
+	}
+
+	trips := []*st.TripInternal{}
+	for _, object := range objects {
+		trip, ok := object.(*st.TripInternal)
+		if !ok {
+			return nil, fmt.Errorf("expected type TripInternal, got %T", object)
+		}
+		if trip.UserId != userID {
+			return nil, senecaerror.NewBadStateError(fmt.Errorf("mistmatch between UserID and tripID.UserID (UserID, tripID.UserID)(%s, %s)", userID, trip.UserId))
+		}
+		trips = append(trips, trip)
+	}
+
+	return trips, nil
+}
+
 func (tdao *SQLTripDAO) PutTripByID(ctx context.Context, tripID string, trip *st.TripInternal) error {
 	err := tdao.sql.Insert(constants.TripTable, tripID, trip)
 	if err == nil {
@@ -82,62 +103,48 @@ func (tdao *SQLTripDAO) ListUserTripIDs(userID string) ([]string, error) {
 	return tdao.sql.ListIDs(constants.TripTable, []*database.QueryParam{{FieldName: constants.UserIDFieldName, Operand: "=", Value: userID}})
 }
 
-func (tdao *SQLTripDAO) ListUserTripIDsByTime(userID string, startTime time.Time, endTime time.Time) ([]string, error) {
-	overLappingStartQuery := []*database.QueryParam{
-		{
-			FieldName: constants.UserIDFieldName,
-			Operand:   "=",
-			Value:     userID,
-		},
-		{
-			FieldName: constants.EndTimeFieldName,
-			Operand:   ">=",
-			Value:     util.TimeToMilliseconds(startTime),
-		},
-	}
+func (tdao *SQLTripDAO) ListUserTripIDsPage(userID, cursor string, limit int) ([]string, string, error) {
+	query := database.NewQuery(constants.TripTable).
+		Where(constants.UserIDFieldName, "=", userID).
+		OrderBy(constants.StartTimeFieldName).
+		WithLimit(limit).
+		WithCursor(cursor)
+	return tdao.sql.ListIDsByQuery(query)
+}
 
-	overLappingEndQuery := []*database.QueryParam{
-		{
-			FieldName: constants.UserIDFieldName,
-			Operand:   "=",
-			Value:     userID,
-		},
-		{
-			FieldName: constants.StartTimeFieldName,
-			Operand:   "<=",
-			Value:     util.TimeToMilliseconds(endTime),
-		},
-	}
+func (tdao *SQLTripDAO) ListUserTripIDsByTime(userID string, startTime time.Time, endTime time.Time) ([]string, error) {
+	query := database.NewQuery(constants.TripTable).
+		Where(constants.UserIDFieldName, "=", userID).
+		Where(constants.StartTimeFieldName, "<=", util.TimeToMilliseconds(endTime)).
+		Where(constants.EndTimeFieldName, ">=", util.TimeToMilliseconds(startTime)).
+		OrderBy(constants.StartTimeFieldName)
 
-	overLappingStartIDs, err := tdao.sql.ListIDs(constants.TripTable, overLappingStartQuery)
+	tripIDs, _, err := tdao.sql.ListIDsByQuery(query)
 	if err != nil {
 		return nil, fmt.Errorf("error listing tripIDs between %q and %q for user %q: %w", startTime, endTime, userID, err)
 	}
-	overLappingEndIDs, err := tdao.sql.ListIDs(constants.TripTable, overLappingEndQuery)
-	if err != nil {
-		return nil, fmt.Errorf("error listing tripIDs between %q and %q for user %q: %w", startTime, endTime, userID, err)
-	}
-
-	uniqueTripIDs := map[string]int{}
-
-	for _, sid := range overLappingStartIDs {
-		uniqueTripIDs[sid]++
-	}
-	for _, eid := range overLappingEndIDs {
-		uniqueTripIDs[eid]++
-	}
+	return tripIDs, nil
+}
 
-	allTripIDs := []string{}
-	for k, v := range uniqueTripIDs {
-		if v > 1 {
-			allTripIDs = append(allTripIDs, k)
+//	DeleteTripByID soft deletes the trip, see database.SoftDelete.  Only trips without events or driving conditions can be deleted.
+//	Params:
+//		ctx context.Context
+//		tripID string
+//	Returns:
+//		senecaerror.UserError: if the trip isn't empty
+//		senecaerror.NotFoundError: if the trip doesn't exist
+//		error
+func (tdao *SQLTripDAO) DeleteTripByID(ctx context.Context, tripID string) error {
+	for _, tableName := range []constants.TableName{constants.EventTable, constants.DrivingConditionTable} {
+		ids, _, err := tdao.sql.ListIDsByQuery(database.NewQuery(tableName).Where(constants.TripIDFieldName, "=", tripID).WithLimit(1))
+		if err != nil {
+			return fmt.Errorf("error listing %s of trip %q: %w", tableName, tripID, err)
+		}
+		if len(ids) > 0 {
+			return senecaerror.NewUserError("", fmt.Errorf("trip %q has %s", tripID, tableName), "Only trips without events or driving conditions can be deleted.")
 		}
 	}
 
-	return allTripIDs, nil
-}
-
-// TODO(lucaloncar): disallow deletion of non-empty trips.
-func (tdao *SQLTripDAO) DeleteTripByID(ctx context.Context, tripID string) error {
-	return tdao.sql.DeleteByID(constants.TripTable, tripID)
+	_, err := database.SoftDelete(ctx, tdao.sql, constants.TripTable, tripID, database.DeleteReason)
+	return err
 }
@@ -87,6 +87,66 @@ func TestCreateUniqueTrip(t *testing.T) {
 	}
 }
 
+func TestDeleteTripByID(t *testing.T) {
+	dao, sql := newTripDAOForTest()
+
+	trip, err := dao.CreateUniqueTrip(context.TODO(), &st.TripInternal{
+		UserId:      testutil.TestUserID,
+		StartTimeMs: util.TimeToMilliseconds(startTime),
+		EndTimeMs:   util.TimeToMilliseconds(endTime),
+	})
+	if err != nil {
+		t.Fatalf("CreateUniqueTrip() returns err: %v", err)
+	}
+	eventID, err := sql.Create(constants.EventTable, &st.EventInternal{UserId: testutil.TestUserID, TripId: trip.Id})
+	if err != nil {
+		t.Fatalf("Create() returns err: %v", err)
+	}
+
+	var ue *senecaerror.UserError
+	if err := dao.DeleteTripByID(context.TODO(), trip.Id); !errors.As(err, &ue) {
+		t.Fatalf("Want UserError from DeleteTripByID() of a non-empty trip, got %v", err)
+	}
+
+	if err := sql.DeleteByID(constants.EventTable, eventID); err != nil {
+		t.Fatalf("DeleteByID() returns err: %v", err)
+	}
+	if err := dao.DeleteTripByID(context.TODO(), trip.Id); err != nil {
+		t.Fatalf("DeleteTripByID() returns err: %v", err)
+	}
+	if object, err := sql.GetByID(constants.TripTable, trip.Id); err != nil || object != nil {
+		t.Fatalf("Want the trip to be deleted, got %v, %v", object, err)
+	}
+
+	tombstoneIDs, err := sql.ListIDs(constants.TombstonesTable, []*database.QueryParam{{FieldName: constants.UserIDFieldName, Operand: "=", Value: testutil.TestUserID}})
+	if err != nil {
+		t.Fatalf("ListIDs() returns err: %v", err)
+	}
+	if len(tombstoneIDs) != 1 {
+		t.Fatalf("Want 1 tombstone, got %d", len(tombstoneIDs))
+	}
+	tombstoneObj, err := sql.GetByID(constants.TombstonesTable, tombstoneIDs[0])
+	if err != nil {
+		t.Fatalf("GetByID() returns err: %v", err)
+	}
+	tombstone := tombstoneObj.(*database.Tombstone)
+	if tombstone.TableName != constants.TripTable.String() || tombstone.ObjectId != trip.Id || tombstone.Reason != database.DeleteReason || tombstone.TimestampMs == 0 {
+		t.Fatalf("Want a tombstone of trip %q, got %v", trip.Id, tombstone)
+	}
+	deletedTrip, err := tombstone.UnmarshalObject()
+	if err != nil {
+		t.Fatalf("UnmarshalObject() returns err: %v", err)
+	}
+	if deletedTrip.(*st.TripInternal).StartTimeMs != trip.StartTimeMs {
+		t.Fatalf("Want the deleted trip %v in the tombstone, got %v", trip, deletedTrip)
+	}
+
+	var nfe *senecaerror.NotFoundError
+	if err := dao.DeleteTripByID(context.TODO(), trip.Id); !errors.As(err, &nfe) {
+		t.Fatalf("Want NotFoundError from DeleteTripByID() of a deleted trip, got %v", err)
+	}
+}
+
 func TestListUserTripIDs(t *testing.T) {
 	dao, _ := newTripDAOForTest()
 
@@ -132,6 +192,51 @@ func TestListUserTripIDs(t *testing.T) {
 	}
 }
 
+func TestListUserTripIDsPage(t *testing.T) {
+	dao, _ := newTripDAOForTest()
+
+	wantIDs := []string{}
+	for i := 0; i < 5; i++ {
+		// Created latest first, so the pages have to be ordered by start time rather than ID.
+		offset := time.Hour.Milliseconds() * int64(100*(5-i))
+		tripInternal, err := dao.CreateUniqueTrip(context.TODO(), &st.TripInternal{
+			UserId:      testutil.TestUserID,
+			StartTimeMs: util.TimeToMilliseconds(startTime) + offset,
+			EndTimeMs:   util.TimeToMilliseconds(endTime) + offset,
+		})
+		if err != nil {
+			t.Fatalf("CreateUniqueTrip(%d) returns err: %v", i, err)
+		}
+		wantIDs = append([]string{tripInternal.Id}, wantIDs...)
+	}
+
+	gotIDs := []string{}
+	cursor := ""
+	for pages := 1; ; pages++ {
+		page, nextCursor, err := dao.ListUserTripIDsPage(testutil.TestUserID, cursor, 2)
+		if err != nil {
+			t.Fatalf("ListUserTripIDsPage() returns err: %v", err)
+		}
+		gotIDs = append(gotIDs, page...)
+		if nextCursor == "" {
+			if pages != 3 {
+				t.Fatalf("Want 3 pages, got %d", pages)
+			}
+			break
+		}
+		cursor = nextCursor
+	}
+
+	if len(gotIDs) != len(wantIDs) {
+		t.Fatalf("Want trip IDs %v, got %v", wantIDs, gotIDs)
+	}
+	for i := range wantIDs {
+		if gotIDs[i] != wantIDs[i] {
+			t.Fatalf("Want trip IDs %v, got %v", wantIDs, gotIDs)
+		}
+	}
+}
+
 func TestGetTripByID(t *testing.T) {
 	tripInternal := &st.TripInternal{
 		UserId:      testutil.TestUserID,
@@ -1,13 +1,21 @@
 package sanitizer
 
 import (
+	"errors"
 	"fmt"
 	"seneca/api/senecaerror"
 	st "seneca/api/type"
+	"seneca/internal/client/cloud"
+	"seneca/internal/client/database"
 	"seneca/internal/dao"
+	"seneca/internal/util/data"
 	"sort"
+	"time"
 )
 
+// maxSourceHops is how many sources are followed before giving up on finding a RawVideo.
+const maxSourceHops = 10
+
 type Sanitizer struct {
 	rawMotionDAO        dao.RawMotionDAO
 	rawLocationDAO      dao.RawLocationDAO
@@ -15,12 +23,17 @@ type Sanitizer struct {
 	rawFrameDAO         dao.RawFrameDAO
 	eventDAO            dao.EventDAO
 	drivingConditionDAO dao.DrivingConditionDAO
-	// Cache the URL of sources.  The source video URL will always be the same if it exists.
-	// Keys will be in the form SOURCE_TYPE/SOURCE_ID , eg 'RAW_MOTION/123'.
-	videoURLCache map[string]string
+	// urlSigner turns storage URLs into playback URLs.  If nil, storage URLs are returned as is.
+	urlSigner cloud.SignedURLInterface
 }
 
-func New(rawMotionDAO dao.RawMotionDAO, rawLocationDAO dao.RawLocationDAO, rawVideoDAO dao.RawVideoDAO, rawFrameDAO dao.RawFrameDAO, eventDAO dao.EventDAO, drivingConditionDAO dao.DrivingConditionDAO) *Sanitizer {
+// videoURLs maps sources to the storage URLs of their RawVideos while a trip is converted.  A source's video
+// URL is always the same if it exists, so every source in a chain gets the URL found at its end.
+// Keys will be in the form SOURCE_TYPE/SOURCE_ID , eg 'RAW_MOTION/123'.  Lookups across trips are served
+// by the DAOs, which may be cached.
+type videoURLs map[string]string
+
+func New(rawMotionDAO dao.RawMotionDAO, rawLocationDAO dao.RawLocationDAO, rawVideoDAO dao.RawVideoDAO, rawFrameDAO dao.RawFrameDAO, eventDAO dao.EventDAO, drivingConditionDAO dao.DrivingConditionDAO, urlSigner cloud.SignedURLInterface) *Sanitizer {
 	return &Sanitizer{
 		rawMotionDAO:        rawMotionDAO,
 		rawLocationDAO:      rawLocationDAO,
@@ -28,121 +41,340 @@ func New(rawMotionDAO dao.RawMotionDAO, rawLocationDAO dao.RawLocationDAO, rawVi
 		rawFrameDAO:         rawFrameDAO,
 		eventDAO:            eventDAO,
 		drivingConditionDAO: drivingConditionDAO,
-		videoURLCache:       map[string]string{},
+		urlSigner:           urlSigner,
 	}
 }
 
-func (san *Sanitizer) TripInternalToTripExternal(tripInternal *st.TripInternal) (*st.Trip, error) {
-	externalEvents := []*st.Event{}
+// 	TripInternalToTripExternal converts the trip with its events and driving conditions to the external format.
+// 	Source videos are given signed playback URLs valid for videoURLExpiry.
+// 	Params:
+//		tripInternal *st.TripInternal
+//		videoURLExpiry time.Duration: how long video URLs are valid for, at most cloud.MaxSignedURLExpiry
+// 	Returns:
+//		*st.Trip
+//		error
+func (san *Sanitizer) TripInternalToTripExternal(tripInternal *st.TripInternal, videoURLExpiry time.Duration) (*st.Trip, error) {
 	internalEventIDs, err := san.eventDAO.ListTripEventIDs(tripInternal.UserId, tripInternal.Id)
 	if err != nil {
 		return nil, fmt.Errorf("error listing event IDs: %w", err)
 	}
-
-	for _, ieid := range internalEventIDs {
-		internalEvent, err := san.eventDAO.GetEventByID(tripInternal.UserId, tripInternal.Id, ieid)
-		if err != nil {
-			return nil, fmt.Errorf("error getting event by ID %q - err: %w", ieid, err)
-		}
-		externalEvent, err := san.eventInternalToEventExternal(internalEvent)
-		if err != nil {
-			return nil, fmt.Errorf("error converting EventInternal %v to Event %v - err: %w", internalEvent, externalEvent, err)
-		}
-		externalEvents = append(externalEvents, externalEvent)
+	internalEvents, err := san.eventDAO.GetEventsByIDs(tripInternal.UserId, tripInternal.Id, internalEventIDs)
+	if err != nil {
+		return nil, fmt.Errorf("error getting events by ID - err: %w", err)
 	}
-	sort.Slice(externalEvents, func(i, j int) bool { return externalEvents[i].TimestampMs < externalEvents[j].TimestampMs })
 
 	internalDrivingConditionIDs, err := san.drivingConditionDAO.ListTripDrivingConditionIDs(tripInternal.UserId, tripInternal.Id)
 	if err != nil {
 		return nil, fmt.Errorf("error listing drivingCondition IDs: %w", err)
 	}
-	internalDrivingConditions := []*st.DrivingConditionInternal{}
-	for _, idcid := range internalDrivingConditionIDs {
-		internalDrivingCondition, err := san.drivingConditionDAO.GetDrivingConditionByID(tripInternal.UserId, tripInternal.Id, idcid)
+	internalDrivingConditions, err := san.drivingConditionDAO.GetDrivingConditionsByIDs(tripInternal.UserId, tripInternal.Id, internalDrivingConditionIDs)
+	if err != nil {
+		return nil, fmt.Errorf("error getting drivingConditions by ID - err: %w", err)
+	}
+
+	sources := []*st.Source{}
+	for _, internalEvent := range internalEvents {
+		sources = append(sources, internalEvent.Source)
+	}
+	for _, internalDrivingCondition := range internalDrivingConditions {
+		sources = append(sources, internalDrivingCondition.Source)
+	}
+	urls, err := san.resolveVideoLinks(sources)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving source video links: %w", err)
+	}
+
+	externalEvents := []*st.Event{}
+	for _, internalEvent := range internalEvents {
+		externalEvent, err := san.eventInternalToEventExternal(internalEvent, urls)
 		if err != nil {
-			return nil, fmt.Errorf("error getting drivingCondition by ID %q - err: %w", internalDrivingCondition, err)
+			return nil, fmt.Errorf("error converting EventInternal %v to Event %v - err: %w", internalEvent, externalEvent, err)
 		}
-		internalDrivingConditions = append(internalDrivingConditions, internalDrivingCondition)
+		externalEvents = append(externalEvents, externalEvent)
 	}
-	externalDrivingConditions, err := san.drivingConditionsInternalToDrivingConditionsExternal(internalDrivingConditions)
+	sort.Slice(externalEvents, func(i, j int) bool { return externalEvents[i].TimestampMs < externalEvents[j].TimestampMs })
+
+	externalDrivingConditions, err := san.drivingConditionsInternalToDrivingConditionsExternal(internalDrivingConditions, urls)
 	if err != nil {
 		return nil, fmt.Errorf("error converting from internal to external drivingConditions: %w", err)
 	}
 
-	return &st.Trip{
+	tripExternal := &st.Trip{
 		StartTimeMs:      tripInternal.StartTimeMs,
 		EndTimeMs:        tripInternal.EndTimeMs,
 		Event:            externalEvents,
 		DrivingCondition: externalDrivingConditions,
-	}, nil
+	}
+	if err := san.signVideoURLs(tripExternal, videoURLExpiry); err != nil {
+		return nil, fmt.Errorf("error signing video URLs: %w", err)
+	}
+
+	return tripExternal, nil
 }
 
-// Walk the chain of sources until the RawVideo is found.
-func (san *Sanitizer) findVideoLink(source *st.Source) (string, error) {
-	if source == nil {
-		return "", fmt.Errorf("source is nil")
+// signVideoURLs replaces the storage URLs in the trip's ExternalSources with signed playback URLs.
+// This is done once the trip is assembled, since driving conditions are merged by comparing URLs,
+// and each URL is only signed once so that they stay comparable for clients too.
+func (san *Sanitizer) signVideoURLs(tripExternal *st.Trip, videoURLExpiry time.Duration) error {
+	if san.urlSigner == nil {
+		return nil
 	}
 
-	// First check the cache.
-	if videoURL, ok := san.videoURLCache[fmt.Sprintf("%s/%s", source.SourceType, source.SourceId)]; ok {
-		return videoURL, nil
+	signedURLs := map[string]string{}
+	sign := func(externalSource *st.ExternalSource) error {
+		if externalSource == nil || externalSource.VideoUrl == "" {
+			return nil
+		}
+		if signedURL, ok := signedURLs[externalSource.VideoUrl]; ok {
+			externalSource.VideoUrl = signedURL
+			return nil
+		}
+
+		bucketName, fileName, err := data.GCSURLToBucketNameAndFileName(externalSource.VideoUrl)
+		if err != nil {
+			return senecaerror.NewBadStateError(fmt.Errorf("GCSURLToBucketNameAndFileName(%s) returns err: %w", externalSource.VideoUrl, err))
+		}
+		signedURL, err := san.urlSigner.SignedURL(bucketName, fileName, videoURLExpiry)
+		if err != nil {
+			return fmt.Errorf("SignedURL(%s, %s, %s) returns err: %w", bucketName, fileName, videoURLExpiry, err)
+		}
+		signedURLs[externalSource.VideoUrl] = signedURL
+		externalSource.VideoUrl = signedURL
+		return nil
 	}
 
-	url, sourceKeys, err := func(maxAttempts int) (string, []string, error) {
-		videoURL := ""
-		keys := []string{}
-		attempts := 0
-		// Hop through sources until we find a RawVideoURL.
-		for {
-			if source == nil || attempts > maxAttempts {
-				return "", nil, fmt.Errorf("could not find video URL for source")
+	for _, event := range tripExternal.Event {
+		if err := sign(event.ExternalSource); err != nil {
+			return err
+		}
+	}
+	for _, drivingCondition := range tripExternal.DrivingCondition {
+		for _, externalSource := range drivingCondition.ExternalSource {
+			if err := sign(externalSource); err != nil {
+				return err
 			}
-			attempts++
-
-			keys = append(keys, fmt.Sprintf("%s/%s", source.SourceType, source.SourceId))
-			switch source.SourceType {
-			case st.Source_RAW_VIDEO:
-				rawVideo, err := san.rawVideoDAO.GetRawVideoByID(source.SourceId)
-				if err != nil {
-					return "", nil, fmt.Errorf("GetRawVideoByID(%s) returns err: %w", source.SourceId, err)
-				}
-				videoURL = rawVideo.CloudStorageFileName
-				return videoURL, keys, nil
-			case st.Source_RAW_MOTION:
-				rawMotion, err := san.rawMotionDAO.GetRawMotionByID(source.SourceId)
-				if err != nil {
-					return "", nil, fmt.Errorf("GetRawMotionByID(%s) returns err: %w", source.SourceId, err)
-				}
-				source = rawMotion.Source
-			case st.Source_RAW_LOCATION:
-				rawLocation, err := san.rawLocationDAO.GetRawLocationByID(source.SourceId)
-				if err != nil {
-					return "", nil, fmt.Errorf("GetRawLocationByID(%s) returns err: %w", source.SourceId, err)
-				}
-				source = rawLocation.Source
-			case st.Source_RAW_FRAME:
-				rawFrame, err := san.rawFrameDAO.GetRawFrameByID(source.SourceId)
-				if err != nil {
-					return "", nil, fmt.Errorf("GetRawFrameByID(%s) returns err: %w", source.SourceId, err)
+		}
+	}
+	return nil
+}
+
+// resolveVideoLinks walks the chains of all the sources together until their RawVideos are found,
+// with one bulk get per source type and hop, and returns the video URLs for findVideoLink().
+// Sources that can't be resolved are left to findVideoLink() to report.
+func (san *Sanitizer) resolveVideoLinks(sources []*st.Source) (videoURLs, error) {
+	urls := videoURLs{}
+	// The keys of the sources at the current hop, to the keys earlier in their chains.
+	chains := map[string][]string{}
+	frontier := map[st.Source_SourceType]map[string]bool{}
+	addSource := func(source *st.Source, chain []string) {
+		key := fmt.Sprintf("%s/%s", source.SourceType, source.SourceId)
+		if videoURL, ok := urls[key]; ok {
+			for _, k := range chain {
+				urls[k] = videoURL
+			}
+			return
+		}
+		if frontier[source.SourceType] == nil {
+			frontier[source.SourceType] = map[string]bool{}
+		}
+		frontier[source.SourceType][source.SourceId] = true
+		chains[key] = append(chains[key], append(chain, key)...)
+	}
+
+	for _, source := range sources {
+		if source != nil {
+			addSource(source, nil)
+		}
+	}
+
+	for hop := 0; hop <= maxSourceHops && len(frontier) > 0; hop++ {
+		currentChains := chains
+		currentFrontier := frontier
+		chains = map[string][]string{}
+		frontier = map[st.Source_SourceType]map[string]bool{}
+
+		for sourceType, idSet := range currentFrontier {
+			ids := []string{}
+			for id := range idSet {
+				ids = append(ids, id)
+			}
+			sort.Strings(ids)
+
+			nextSources, err := san.getSources(sourceType, ids)
+			if err != nil {
+				return nil, err
+			}
+			for i, id := range ids {
+				chain := currentChains[fmt.Sprintf("%s/%s", sourceType, id)]
+				switch next := nextSources[i].(type) {
+				case string:
+					for _, k := range chain {
+						urls[k] = next
+					}
+				case *st.Source:
+					if next != nil {
+						addSource(next, chain)
+					}
 				}
-				source = rawFrame.Source
-			default:
-				return "", nil, fmt.Errorf("unsupported source type %q", source.SourceType)
 			}
 		}
-	}(10)
+	}
+	return urls, nil
+}
+
+// getSources gets the objects of sourceType with the given ids in one call.  For each ID it returns
+// the video URL if the object is a RawVideo, its source otherwise, or nil for unsupported types.  If a source
+// doesn't exist the batch fails, so they're gotten one at a time with getSource() instead.
+func (san *Sanitizer) getSources(sourceType st.Source_SourceType, ids []string) ([]interface{}, error) {
+	nextSources := []interface{}{}
+	var err error
+	switch sourceType {
+	case st.Source_RAW_VIDEO:
+		var rawVideos []*st.RawVideo
+		if rawVideos, err = san.rawVideoDAO.GetRawVideosByIDs(ids); err == nil {
+			for _, rawVideo := range rawVideos {
+				nextSources = append(nextSources, rawVideo.CloudStorageFileName)
+			}
+		}
+	case st.Source_RAW_MOTION:
+		var rawMotions []*st.RawMotion
+		if rawMotions, err = san.rawMotionDAO.GetRawMotionsByIDs(ids); err == nil {
+			for _, rawMotion := range rawMotions {
+				nextSources = append(nextSources, rawMotion.Source)
+			}
+		}
+	case st.Source_RAW_LOCATION:
+		var rawLocations []*st.RawLocation
+		if rawLocations, err = san.rawLocationDAO.GetRawLocationsByIDs(ids); err == nil {
+			for _, rawLocation := range rawLocations {
+				nextSources = append(nextSources, rawLocation.Source)
+			}
+		}
+	case st.Source_RAW_FRAME:
+		var rawFrames []*st.RawFrame
+		if rawFrames, err = san.rawFrameDAO.GetRawFramesByIDs(ids); err == nil {
+			for _, rawFrame := range rawFrames {
+				nextSources = append(nextSources, rawFrame.Source)
+			}
+		}
+	default:
+		// Logs and unsupported types aren't gotten in bulk.
+		return san.getEachSource(sourceType, ids)
+	}
 	if err != nil {
-		return "", err
+		var nfe *senecaerror.NotFoundError
+		if !errors.As(err, &nfe) {
+			return nil, fmt.Errorf("error getting %d sources of type %s: %w", len(ids), sourceType, err)
+		}
+		return san.getEachSource(sourceType, ids)
+	}
+	return nextSources, nil
+}
+
+// getEachSource gets the objects of sourceType with the given ids one at a time, and returns like getSources().
+func (san *Sanitizer) getEachSource(sourceType st.Source_SourceType, ids []string) ([]interface{}, error) {
+	nextSources := []interface{}{}
+	for _, id := range ids {
+		nextSource, err := san.getSource(&st.Source{SourceType: sourceType, SourceId: id})
+		if err != nil {
+			return nil, err
+		}
+		nextSources = append(nextSources, nextSource)
+	}
+	return nextSources, nil
+}
+
+// getSource gets the object of the source and returns like getSources().  Sources that don't exist, e.g. raw data
+// expired by the retention policy before the events and driving conditions derived from it, have no video.
+func (san *Sanitizer) getSource(source *st.Source) (interface{}, error) {
+	var nfe *senecaerror.NotFoundError
+	switch source.SourceType {
+	case st.Source_RAW_VIDEO:
+		rawVideo, err := san.rawVideoDAO.GetRawVideoByID(source.SourceId)
+		if errors.As(err, &nfe) {
+			return "", nil
+		} else if err != nil {
+			return nil, fmt.Errorf("GetRawVideoByID(%s) returns err: %w", source.SourceId, err)
+		}
+		return rawVideo.CloudStorageFileName, nil
+	case st.Source_RAW_MOTION:
+		rawMotion, err := san.rawMotionDAO.GetRawMotionByID(source.SourceId)
+		if errors.As(err, &nfe) {
+			return "", nil
+		} else if err != nil {
+			return nil, fmt.Errorf("GetRawMotionByID(%s) returns err: %w", source.SourceId, err)
+		}
+		return rawMotion.Source, nil
+	case st.Source_RAW_LOCATION:
+		rawLocation, err := san.rawLocationDAO.GetRawLocationByID(source.SourceId)
+		if errors.As(err, &nfe) {
+			return "", nil
+		} else if err != nil {
+			return nil, fmt.Errorf("GetRawLocationByID(%s) returns err: %w", source.SourceId, err)
+		}
+		return rawLocation.Source, nil
+	case st.Source_RAW_FRAME:
+		rawFrame, err := san.rawFrameDAO.GetRawFrameByID(source.SourceId)
+		if errors.As(err, &nfe) {
+			return "", nil
+		} else if err != nil {
+			return nil, fmt.Errorf("GetRawFrameByID(%s) returns err: %w", source.SourceId, err)
+		}
+		return rawFrame.Source, nil
+	case database.RawTelemetryFileSourceType, database.RawVehicleSignalSourceType:
+		// GPS and vehicle logs have no video, so the chains ending at them have no URL.  RawVehicleSignals always
+		// come from a log.
+		return "", nil
+	default:
+		return nil, nil
+	}
+}
+
+// Walk the chain of sources until the RawVideo is found.
+func (san *Sanitizer) findVideoLink(source *st.Source, urls videoURLs) (string, error) {
+	if source == nil {
+		return "", fmt.Errorf("source is nil")
 	}
 
-	for _, k := range sourceKeys {
-		san.videoURLCache[k] = url
+	// First check the URLs found so far.
+	if videoURL, ok := urls[fmt.Sprintf("%s/%s", source.SourceType, source.SourceId)]; ok {
+		return videoURL, nil
 	}
 
-	return url, nil
+	keys := []string{}
+	videoURL := ""
+	// Hop through sources until we find a RawVideoURL.
+	for attempts := 0; ; attempts++ {
+		if attempts > maxSourceHops {
+			return "", fmt.Errorf("could not find video URL for source")
+		}
+		keys = append(keys, fmt.Sprintf("%s/%s", source.SourceType, source.SourceId))
+		next, err := san.getSource(source)
+		if err != nil {
+			return "", err
+		}
+		if url, ok := next.(string); ok {
+			videoURL = url
+			break
+		}
+		nextSource, _ := next.(*st.Source)
+		if next == nil {
+			return "", fmt.Errorf("unsupported source type %q", source.SourceType)
+		}
+		if nextSource == nil {
+			return "", fmt.Errorf("could not find video URL for source")
+		}
+		source = nextSource
+	}
+
+	for _, k := range keys {
+		urls[k] = videoURL
+	}
+
+	return videoURL, nil
 }
 
-func (san *Sanitizer) eventInternalToEventExternal(eventInternal *st.EventInternal) (*st.Event, error) {
+func (san *Sanitizer) eventInternalToEventExternal(eventInternal *st.EventInternal, urls videoURLs) (*st.Event, error) {
 	eventExternal := &st.Event{}
 
 	if eventInternal.EventType == st.EventType_UNKNOWN_EVENT_TYPE {
@@ -159,13 +391,15 @@ func (san *Sanitizer) eventInternalToEventExternal(eventInternal *st.EventIntern
 
 	eventExternal.TimestampMs = eventInternal.TimestampMs
 
-	sourceVideoLink, err := san.findVideoLink(eventInternal.Source)
+	sourceVideoLink, err := san.findVideoLink(eventInternal.Source, urls)
 	if err != nil {
 		return nil, fmt.Errorf("error finding source video link: %w", err)
 	}
-	eventExternal.ExternalSource = &st.ExternalSource{
-		SourceType: st.ExternalSource_DASHCAM_VIDEO,
-		VideoUrl:   sourceVideoLink,
+	if sourceVideoLink != "" {
+		eventExternal.ExternalSource = &st.ExternalSource{
+			SourceType: st.ExternalSource_DASHCAM_VIDEO,
+			VideoUrl:   sourceVideoLink,
+		}
 	}
 
 	return eventExternal, nil
@@ -176,7 +410,7 @@ type conditionAndSource struct {
 	sourceVideoURL string
 }
 
-func (san *Sanitizer) drivingConditionsInternalToDrivingConditionsExternal(drivingConditionsInternal []*st.DrivingConditionInternal) ([]*st.DrivingCondition, error) {
+func (san *Sanitizer) drivingConditionsInternalToDrivingConditionsExternal(drivingConditionsInternal []*st.DrivingConditionInternal, urls videoURLs) ([]*st.DrivingCondition, error) {
 	drivingConditionsExternal := []*st.DrivingCondition{}
 
 	points := map[int64]map[conditionAndSource]float64{}
@@ -195,7 +429,7 @@ func (san *Sanitizer) drivingConditionsInternalToDrivingConditionsExternal(drivi
 	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
 
 	for _, dci := range drivingConditionsInternal {
-		sourceVideoURL, err := san.findVideoLink(dci.Source)
+		sourceVideoURL, err := san.findVideoLink(dci.Source, urls)
 		if err != nil {
 			return nil, fmt.Errorf("error finding source video link: %w", err)
 		}
@@ -234,10 +468,12 @@ func (san *Sanitizer) drivingConditionsInternalToDrivingConditionsExternal(drivi
 				dcExternal.ConditionType = append(dcExternal.ConditionType, condAndSrc.condition)
 				dcExternal.Severity = append(dcExternal.Severity, severity)
 			}
-			dcExternal.ExternalSource = append(dcExternal.ExternalSource, &st.ExternalSource{
-				SourceType: st.ExternalSource_DASHCAM_VIDEO,
-				VideoUrl:   condAndSrc.sourceVideoURL,
-			})
+			if condAndSrc.sourceVideoURL != "" {
+				dcExternal.ExternalSource = append(dcExternal.ExternalSource, &st.ExternalSource{
+					SourceType: st.ExternalSource_DASHCAM_VIDEO,
+					VideoUrl:   condAndSrc.sourceVideoURL,
+				})
+			}
 		}
 
 		if i != 0 && len(lastMap) == 0 && lastMapSize == len(currentMap) {
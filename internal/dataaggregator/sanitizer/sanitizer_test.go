@@ -6,9 +6,11 @@ import (
 	"log"
 	"math/rand"
 	st "seneca/api/type"
+	"seneca/internal/client/cloud"
 	"seneca/internal/client/database"
 	"seneca/internal/client/logging"
 	"seneca/internal/dao"
+	"seneca/internal/dao/cacheddao"
 	"seneca/internal/dao/drivingconditiondao"
 	"seneca/internal/dao/eventdao"
 	"seneca/internal/dao/rawframedao"
@@ -35,7 +37,7 @@ func TestListTrips(t *testing.T) {
 
 	tripStart := time.Date(2021, time.January, 10, 0, 0, 0, 0, time.UTC)
 
-	sanitizer, rawVideoDAO, rawMotionDAO, tripDAO, eventDAO, dcDAO := newSanitizerForTests()
+	sanitizer, rawVideoDAO, rawMotionDAO, tripDAO, eventDAO, dcDAO := newSanitizerForTests(nil)
 
 	rawVideo := &st.RawVideo{
 		UserId:               userID,
@@ -223,7 +225,7 @@ func TestListTrips(t *testing.T) {
 		log.Fatalf("tripDAO.GetTripByID() returns err: %v", err)
 	}
 
-	tripExternal, err := sanitizer.TripInternalToTripExternal(tripInternal)
+	tripExternal, err := sanitizer.TripInternalToTripExternal(tripInternal, time.Hour)
 	if err != nil {
 		log.Fatalf("sanitizer.ListTrips() returns err: %v", err)
 	}
@@ -249,7 +251,7 @@ func TestListTrips(t *testing.T) {
 	}
 }
 
-func newSanitizerForTests() (*Sanitizer, dao.RawVideoDAO, dao.RawMotionDAO, dao.TripDAO, dao.EventDAO, dao.DrivingConditionDAO) {
+func newSanitizerForTests(urlSigner cloud.SignedURLInterface) (*Sanitizer, dao.RawVideoDAO, dao.RawMotionDAO, dao.TripDAO, dao.EventDAO, dao.DrivingConditionDAO) {
 	fakeSQL := database.NewFake()
 	logger := logging.NewLocalLogger(false)
 	rawVideoDAO := rawvideodao.NewSQLRawVideoDAO(fakeSQL, logger, time.Minute)
@@ -258,8 +260,8 @@ func newSanitizerForTests() (*Sanitizer, dao.RawVideoDAO, dao.RawMotionDAO, dao.
 	rawFrameDAO := rawframedao.NewSQLRawFrameDAO(fakeSQL)
 	tripDAO := tripdao.NewSQLTripDAO(fakeSQL, logger)
 	eventDAO := eventdao.NewSQLEventDAO(fakeSQL, tripDAO, logger)
-	dcDAO := drivingconditiondao.NewSQLDrivingConditionDAO(fakeSQL, tripDAO, eventDAO)
-	return New(rawMotionDAO, rawLocationDAO, rawVideoDAO, rawFrameDAO, eventDAO, dcDAO), rawVideoDAO, rawMotionDAO, tripDAO, eventDAO, dcDAO
+	dcDAO := drivingconditiondao.NewSQLDrivingConditionDAO(fakeSQL, drivingconditiondao.SQLTripDAOs(logger))
+	return New(rawMotionDAO, rawLocationDAO, rawVideoDAO, rawFrameDAO, eventDAO, dcDAO, urlSigner), rawVideoDAO, rawMotionDAO, tripDAO, eventDAO, dcDAO
 }
 
 func drivingConditionExternalEqual(lhs *st.DrivingCondition, rhs *st.DrivingCondition) bool {
@@ -297,3 +299,320 @@ func prettyPrintDrivingConditionList(drivingConditions []*st.DrivingCondition) s
 	output += "]\n"
 	return output
 }
+
+func TestTripVideoURLsAreSigned(t *testing.T) {
+	userID := testutil.TestUserID
+	tripStart := time.Date(2021, time.January, 10, 0, 0, 0, 0, time.UTC)
+
+	fakeSSC := cloud.NewFakeSimpleStorageClient()
+	signCalls := 0
+	fakeSSC.SignedURLMock = func(bucketName cloud.BucketName, bucketFileName string, expiry time.Duration) (string, error) {
+		signCalls++
+		return fmt.Sprintf("https://signed/%s/%s?expiry=%s&call=%d", bucketName, bucketFileName, expiry, signCalls), nil
+	}
+	sanitizer, rawVideoDAO, rawMotionDAO, tripDAO, eventDAO, dcDAO := newSanitizerForTests(fakeSSC)
+
+	rawVideo, err := rawVideoDAO.InsertUniqueRawVideo(&st.RawVideo{
+		UserId:               userID,
+		CloudStorageFileName: "gs://raw_videos/user.123.RAW_VIDEO.mp4",
+	})
+	if err != nil {
+		t.Fatalf("InsertUniqueRawVideo() returns err: %v", err)
+	}
+	rawMotion, err := rawMotionDAO.InsertUniqueRawMotion(&st.RawMotion{
+		UserId: userID,
+		Source: &st.Source{SourceId: rawVideo.Id, SourceType: st.Source_RAW_VIDEO},
+	})
+	if err != nil {
+		t.Fatalf("InsertUniqueRawMotion() returns err: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := eventDAO.CreateEvent(context.TODO(), &st.EventInternal{
+			UserId:      userID,
+			EventType:   st.EventType(1),
+			TimestampMs: util.TimeToMilliseconds(tripStart.Add(time.Minute * time.Duration(i))),
+			Source:      &st.Source{SourceId: rawMotion.Id, SourceType: st.Source_RAW_MOTION},
+		}); err != nil {
+			t.Fatalf("CreateEvent() returns err: %v", err)
+		}
+	}
+	if _, err := dcDAO.CreateDrivingCondition(context.TODO(), &st.DrivingConditionInternal{
+		UserId:        userID,
+		StartTimeMs:   util.TimeToMilliseconds(tripStart),
+		EndTimeMs:     util.TimeToMilliseconds(tripStart.Add(time.Minute * 5)),
+		ConditionType: st.ConditionType_NIGHT,
+		Severity:      1,
+		Source:        &st.Source{SourceId: rawVideo.Id, SourceType: st.Source_RAW_VIDEO},
+	}); err != nil {
+		t.Fatalf("CreateDrivingCondition() returns err: %v", err)
+	}
+
+	tripIDs, err := tripDAO.ListUserTripIDs(userID)
+	if err != nil || len(tripIDs) != 1 {
+		t.Fatalf("Want 1 trip from ListUserTripIDs(), got %v, %v", tripIDs, err)
+	}
+	tripInternal, err := tripDAO.GetTripByID(userID, tripIDs[0])
+	if err != nil {
+		t.Fatalf("GetTripByID() returns err: %v", err)
+	}
+
+	tripExternal, err := sanitizer.TripInternalToTripExternal(tripInternal, time.Minute*15)
+	if err != nil {
+		t.Fatalf("TripInternalToTripExternal() returns err: %v", err)
+	}
+
+	wantURL := "https://signed/raw_videos/user.123.RAW_VIDEO.mp4?expiry=15m0s&call=1"
+	if signCalls != 1 {
+		t.Fatalf("Want the one source video signed once, got %d calls", signCalls)
+	}
+	for _, event := range tripExternal.Event {
+		if event.ExternalSource.VideoUrl != wantURL {
+			t.Fatalf("Want %q for event.ExternalSource.VideoUrl, got %q", wantURL, event.ExternalSource.VideoUrl)
+		}
+	}
+	for _, dc := range tripExternal.DrivingCondition {
+		for _, es := range dc.ExternalSource {
+			if es.VideoUrl != wantURL {
+				t.Fatalf("Want %q for drivingCondition.ExternalSource.VideoUrl, got %q", wantURL, es.VideoUrl)
+			}
+		}
+	}
+
+	fakeSSC.SignedURLMock = func(bucketName cloud.BucketName, bucketFileName string, expiry time.Duration) (string, error) {
+		return "", fmt.Errorf("error")
+	}
+	if _, err := sanitizer.TripInternalToTripExternal(tripInternal, time.Minute*15); err == nil {
+		t.Fatalf("Want err from TripInternalToTripExternal() when SignedURL returns err, got nil")
+	}
+}
+
+func TestTelemetrySourcesHaveNoVideo(t *testing.T) {
+	userID := testutil.TestUserID
+	tripStart := time.Date(2021, time.January, 10, 0, 0, 0, 0, time.UTC)
+
+	sanitizer, _, rawMotionDAO, tripDAO, eventDAO, dcDAO := newSanitizerForTests(cloud.NewFakeSimpleStorageClient())
+
+	telemetrySource := &st.Source{SourceId: "rawTelemetryFileID", SourceType: database.RawTelemetryFileSourceType}
+	rawMotion, err := rawMotionDAO.InsertUniqueRawMotion(&st.RawMotion{
+		UserId:      userID,
+		TimestampMs: util.TimeToMilliseconds(tripStart),
+		Source:      telemetrySource,
+	})
+	if err != nil {
+		t.Fatalf("InsertUniqueRawMotion() returns err: %v", err)
+	}
+	if _, err := eventDAO.CreateEvent(context.TODO(), &st.EventInternal{
+		UserId:      userID,
+		EventType:   st.EventType_FAST_ACCELERATION,
+		TimestampMs: util.TimeToMilliseconds(tripStart.Add(time.Minute)),
+		Source:      &st.Source{SourceId: rawMotion.Id, SourceType: st.Source_RAW_MOTION},
+	}); err != nil {
+		t.Fatalf("CreateEvent() returns err: %v", err)
+	}
+	// Hard braking found in a vehicle log.
+	if _, err := eventDAO.CreateEvent(context.TODO(), &st.EventInternal{
+		UserId:      userID,
+		EventType:   st.EventType_FAST_DECELERATION,
+		TimestampMs: util.TimeToMilliseconds(tripStart.Add(time.Minute * 2)),
+		Source:      &st.Source{SourceId: "rawVehicleSignalID", SourceType: database.RawVehicleSignalSourceType},
+	}); err != nil {
+		t.Fatalf("CreateEvent() returns err: %v", err)
+	}
+	if _, err := dcDAO.CreateDrivingCondition(context.TODO(), &st.DrivingConditionInternal{
+		UserId:        userID,
+		StartTimeMs:   util.TimeToMilliseconds(tripStart),
+		EndTimeMs:     util.TimeToMilliseconds(tripStart.Add(time.Minute * 5)),
+		ConditionType: st.ConditionType_NIGHT,
+		Severity:      1,
+		Source:        telemetrySource,
+	}); err != nil {
+		t.Fatalf("CreateDrivingCondition() returns err: %v", err)
+	}
+
+	tripIDs, err := tripDAO.ListUserTripIDs(userID)
+	if err != nil || len(tripIDs) != 1 {
+		t.Fatalf("Want 1 trip from ListUserTripIDs(), got %v, %v", tripIDs, err)
+	}
+	tripInternal, err := tripDAO.GetTripByID(userID, tripIDs[0])
+	if err != nil {
+		t.Fatalf("GetTripByID() returns err: %v", err)
+	}
+
+	tripExternal, err := sanitizer.TripInternalToTripExternal(tripInternal, time.Minute*15)
+	if err != nil {
+		t.Fatalf("TripInternalToTripExternal() returns err: %v", err)
+	}
+	if len(tripExternal.Event) != 2 || tripExternal.Event[0].ExternalSource != nil || tripExternal.Event[1].ExternalSource != nil {
+		t.Errorf("Want 2 events without an ExternalSource, got %v", tripExternal.Event)
+	}
+	if len(tripExternal.DrivingCondition) != 1 || len(tripExternal.DrivingCondition[0].ExternalSource) != 0 {
+		t.Errorf("Want 1 driving condition without ExternalSources, got %v", tripExternal.DrivingCondition)
+	}
+}
+
+func TestExpiredSourcesHaveNoVideo(t *testing.T) {
+	userID := testutil.TestUserID
+	tripStart := time.Date(2021, time.January, 10, 0, 0, 0, 0, time.UTC)
+
+	fakeSSC := cloud.NewFakeSimpleStorageClient()
+	fakeSSC.SignedURLMock = func(bucketName cloud.BucketName, bucketFileName string, expiry time.Duration) (string, error) {
+		return fmt.Sprintf("https://signed/%s/%s", bucketName, bucketFileName), nil
+	}
+	sanitizer, rawVideoDAO, rawMotionDAO, tripDAO, eventDAO, _ := newSanitizerForTests(fakeSSC)
+
+	rawVideo, err := rawVideoDAO.InsertUniqueRawVideo(&st.RawVideo{
+		UserId:               userID,
+		CloudStorageFileName: "gs://raw_videos/user.123.RAW_VIDEO.mp4",
+	})
+	if err != nil {
+		t.Fatalf("InsertUniqueRawVideo() returns err: %v", err)
+	}
+	sourceIDs := []string{}
+	for i := 0; i < 2; i++ {
+		rawMotion, err := rawMotionDAO.InsertUniqueRawMotion(&st.RawMotion{
+			UserId:      userID,
+			TimestampMs: util.TimeToMilliseconds(tripStart.Add(time.Minute * time.Duration(i))),
+			Source:      &st.Source{SourceId: rawVideo.Id, SourceType: st.Source_RAW_VIDEO},
+		})
+		if err != nil {
+			t.Fatalf("InsertUniqueRawMotion() returns err: %v", err)
+		}
+		sourceIDs = append(sourceIDs, rawMotion.Id)
+		if _, err := eventDAO.CreateEvent(context.TODO(), &st.EventInternal{
+			UserId:      userID,
+			EventType:   st.EventType_FAST_ACCELERATION,
+			TimestampMs: util.TimeToMilliseconds(tripStart),
+			Source:      &st.Source{SourceId: rawMotion.Id, SourceType: st.Source_RAW_MOTION},
+		}); err != nil {
+			t.Fatalf("CreateEvent() returns err: %v", err)
+		}
+	}
+	// The retention policy expired the raw motion of the first event, but kept the event.
+	if err := rawMotionDAO.DeleteRawMotionByID(sourceIDs[0]); err != nil {
+		t.Fatalf("DeleteRawMotionByID() returns err: %v", err)
+	}
+
+	tripIDs, err := tripDAO.ListUserTripIDs(userID)
+	if err != nil || len(tripIDs) != 1 {
+		t.Fatalf("Want 1 trip from ListUserTripIDs(), got %v, %v", tripIDs, err)
+	}
+	tripInternal, err := tripDAO.GetTripByID(userID, tripIDs[0])
+	if err != nil {
+		t.Fatalf("GetTripByID() returns err: %v", err)
+	}
+
+	tripExternal, err := sanitizer.TripInternalToTripExternal(tripInternal, time.Minute*15)
+	if err != nil {
+		t.Fatalf("TripInternalToTripExternal() returns err: %v", err)
+	}
+	withVideo := 0
+	for _, event := range tripExternal.Event {
+		if event.ExternalSource != nil && event.ExternalSource.VideoUrl != "" {
+			withVideo++
+		}
+	}
+	if len(tripExternal.Event) != 2 || withVideo != 1 {
+		t.Errorf("Want 2 events with only the one whose source was kept having a video, got %v", tripExternal.Event)
+	}
+}
+
+// BenchmarkTripInternalToTripExternal reports the round trips to the fake database per trip, which
+// should stay the same as the number of events grows.
+func BenchmarkTripInternalToTripExternal(b *testing.B) {
+	for _, bc := range []struct {
+		numEvents int
+		cached    bool
+	}{{10, false}, {100, false}, {1000, false}, {1000, true}} {
+		numEvents := bc.numEvents
+		desc := fmt.Sprintf("%d events", numEvents)
+		if bc.cached {
+			desc += " cached"
+		}
+		b.Run(desc, func(b *testing.B) {
+			userID := testutil.TestUserID
+			tripStart := time.Date(2021, time.January, 10, 0, 0, 0, 0, time.UTC)
+
+			fakeSQL := database.NewFake()
+			logger := logging.NewLocalLogger(false)
+			rawVideoDAO := rawvideodao.NewSQLRawVideoDAO(fakeSQL, logger, time.Minute)
+			rawMotionDAO := rawmotiondao.NewSQLRawMotionDAO(fakeSQL, logger)
+			rawLocationDAO := rawlocationdao.NewSQLRawLocationDAO(fakeSQL)
+			rawFrameDAO := rawframedao.NewSQLRawFrameDAO(fakeSQL)
+			tripDAO := tripdao.NewSQLTripDAO(fakeSQL, logger)
+			eventDAO := eventdao.NewSQLEventDAO(fakeSQL, tripDAO, logger)
+			dcDAO := drivingconditiondao.NewSQLDrivingConditionDAO(fakeSQL, drivingconditiondao.SQLTripDAOs(logger))
+
+			rawVideo, err := rawVideoDAO.InsertUniqueRawVideo(&st.RawVideo{UserId: userID, CloudStorageFileName: "gs://bucket/video.mp4"})
+			if err != nil {
+				b.Fatalf("InsertUniqueRawVideo() returns err: %v", err)
+			}
+			drivingCondition, err := dcDAO.CreateDrivingCondition(context.TODO(), &st.DrivingConditionInternal{
+				UserId:        userID,
+				StartTimeMs:   util.TimeToMilliseconds(tripStart),
+				EndTimeMs:     util.TimeToMilliseconds(tripStart.Add(time.Hour)),
+				ConditionType: st.ConditionType_NIGHT,
+				Source:        &st.Source{SourceType: st.Source_RAW_VIDEO, SourceId: rawVideo.Id},
+			})
+			if err != nil {
+				b.Fatalf("CreateDrivingCondition() returns err: %v", err)
+			}
+
+			// Each event comes from its own RawMotion, so the source chains are two hops long.
+			for i := 0; i < numEvents; i++ {
+				timestampMs := util.TimeToMilliseconds(tripStart.Add(time.Second * time.Duration(i+1)))
+				rawMotion, err := rawMotionDAO.InsertUniqueRawMotion(&st.RawMotion{
+					UserId:      userID,
+					TimestampMs: timestampMs,
+					Source:      &st.Source{SourceType: st.Source_RAW_VIDEO, SourceId: rawVideo.Id},
+				})
+				if err != nil {
+					b.Fatalf("InsertUniqueRawMotion() returns err: %v", err)
+				}
+				if _, err := eventDAO.CreateEvent(context.TODO(), &st.EventInternal{
+					UserId:      userID,
+					EventType:   st.EventType_FAST_ACCELERATION,
+					TimestampMs: timestampMs,
+					Source:      &st.Source{SourceType: st.Source_RAW_MOTION, SourceId: rawMotion.Id},
+				}); err != nil {
+					b.Fatalf("CreateEvent() returns err: %v", err)
+				}
+			}
+
+			trip, err := tripDAO.GetTripByID(userID, drivingCondition.TripId)
+			if err != nil {
+				b.Fatalf("GetTripByID() returns err: %v", err)
+			}
+
+			sanitizer := New(rawMotionDAO, rawLocationDAO, rawVideoDAO, rawFrameDAO, eventDAO, dcDAO, nil)
+			if bc.cached {
+				// The caches are shared across iterations, like across repeated loads of a dashboard.
+				daos := cacheddao.Wrap(&dao.AllDAOSet{
+					RawVideoDAO:         rawVideoDAO,
+					RawLocationDAO:      rawLocationDAO,
+					RawFrameDAO:         rawFrameDAO,
+					RawMotionDAO:        rawMotionDAO,
+					TripDAO:             tripDAO,
+					EventDAO:            eventDAO,
+					DrivingConditionDAO: dcDAO,
+				}, cacheddao.NewCaches(10000, time.Hour))
+				sanitizer = New(daos.RawMotionDAO, daos.RawLocationDAO, daos.RawVideoDAO, daos.RawFrameDAO, daos.EventDAO, daos.DrivingConditionDAO, nil)
+			}
+
+			roundTrips := 0
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				fakeSQL.RoundTrips = 0
+				tripExternal, err := sanitizer.TripInternalToTripExternal(trip, time.Minute)
+				if err != nil {
+					b.Fatalf("TripInternalToTripExternal() returns err: %v", err)
+				}
+				if len(tripExternal.Event) != numEvents {
+					b.Fatalf("Want %d events, got %d", numEvents, len(tripExternal.Event))
+				}
+				roundTrips += fakeSQL.RoundTrips
+			}
+			b.ReportMetric(float64(roundTrips)/float64(b.N), "roundtrips/op")
+		})
+	}
+}
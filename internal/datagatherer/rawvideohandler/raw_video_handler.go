@@ -4,6 +4,7 @@ package rawvideohandler
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -16,6 +17,7 @@ import (
 	"seneca/internal/client/cloud"
 	"seneca/internal/client/logging"
 	"seneca/internal/dao"
+	"seneca/internal/jobqueue"
 	"seneca/internal/util"
 	"seneca/internal/util/data"
 	"seneca/internal/util/mp4"
@@ -40,10 +42,10 @@ type RawVideoHandler struct {
 	logger        logging.LoggingInterface
 	projectID     string
 
-	rawVideoDAO    dao.RawVideoDAO
-	rawLocationDAO dao.RawLocationDAO
-	rawMotionDAO   dao.RawMotionDAO
-	rawFrameDAO    dao.RawFrameDAO
+	rawVideoDAO       dao.RawVideoDAO
+	transactionRunner dao.TransactionRunner
+	// jobQueue receives a RunAlgorithms job for the user of every processed video, if it's set.
+	jobQueue jobqueue.Queue
 }
 
 // NewRawVideoHandler initializes a new RawVideoHandler with the given parameters.
@@ -52,6 +54,8 @@ type RawVideoHandler struct {
 //		simpleStorageInterface cloud.SimpleStorageInterface: client for storing mp4 files
 //		TODO(lucaloncar): fix paramas
 //		mp4ToolInterface mp4.MP4ToolInterface: tool for parsing and manipulating mp4 data
+//		transactionRunner dao.TransactionRunner: stores the data extracted from a video all at once
+//		jobQueue jobqueue.Queue: where the algorithms are queued to run on new data, may be nil
 //		logger logging.LoggingInterface
 // 		projectID string
 // Returns:
@@ -61,21 +65,19 @@ func NewRawVideoHandler(
 	simpleStorageInterface cloud.SimpleStorageInterface,
 	mp4ToolInterface mp4.MP4ToolInterface,
 	rawVideoDAO dao.RawVideoDAO,
-	rawLocationDAO dao.RawLocationDAO,
-	rawMotionDAO dao.RawMotionDAO,
-	rawFrameDAO dao.RawFrameDAO,
+	transactionRunner dao.TransactionRunner,
+	jobQueue jobqueue.Queue,
 	logger logging.LoggingInterface,
 	projectID string,
 ) (*RawVideoHandler, error) {
 	return &RawVideoHandler{
-		simpleStorage:  simpleStorageInterface,
-		mp4Tool:        mp4ToolInterface,
-		logger:         logger,
-		projectID:      projectID,
-		rawVideoDAO:    rawVideoDAO,
-		rawLocationDAO: rawLocationDAO,
-		rawMotionDAO:   rawMotionDAO,
-		rawFrameDAO:    rawFrameDAO,
+		simpleStorage:     simpleStorageInterface,
+		mp4Tool:           mp4ToolInterface,
+		logger:            logger,
+		projectID:         projectID,
+		rawVideoDAO:       rawVideoDAO,
+		transactionRunner: transactionRunner,
+		jobQueue:          jobQueue,
 	}, nil
 }
 
@@ -113,7 +115,7 @@ func (rvh *RawVideoHandler) HandleRawVideoProcessRequest(req *st.RawVideoProcess
 		rvh.logger.Log(fmt.Sprintf("Handling RawVideoRequest took %s", time.Since(startTime)))
 	}(nowTime)
 
-	cleanUp := newCleanUp(rvh.rawVideoDAO, rvh.rawLocationDAO, rvh.rawMotionDAO, rvh.rawFrameDAO, rvh.logger)
+	cleanUp := newCleanUp(rvh.rawVideoDAO, rvh.simpleStorage, rvh.logger)
 	defer cleanUp.cleanUpFailure()
 
 	if req.UserId == "" {
@@ -160,7 +162,7 @@ func (rvh *RawVideoHandler) HandleRawVideoProcessRequest(req *st.RawVideoProcess
 	}
 
 	// Upload firestore data.
-	rawVideo.CloudStorageFileName = fmt.Sprintf("gs://%s/%s", cloud.RawVideoBucketName, fmt.Sprintf("%s.%d.%s.mp4", req.UserId, rawVideo.CreateTimeMs, rawVideoBucketFileNameIdentifier))
+	rawVideo.CloudStorageFileName = rvh.simpleStorage.URLScheme().BucketFileURL(cloud.RawVideoBucketName.String(), fmt.Sprintf("%s.%d.%s.mp4", req.UserId, rawVideo.CreateTimeMs, rawVideoBucketFileNameIdentifier))
 	rawVideo, err = rvh.rawVideoDAO.InsertUniqueRawVideo(rawVideo)
 	if err != nil {
 		cleanUp.clean = true
@@ -177,12 +179,12 @@ func (rvh *RawVideoHandler) HandleRawVideoProcessRequest(req *st.RawVideoProcess
 	}
 
 	// Upload cloud storage data.
-	if err := rvh.writeMP4ToGCS(mp4Path, rawVideo); err != nil {
+	if err := rvh.writeMP4ToGCS(mp4Path, req.VideoBytes, rawVideo, cleanUp); err != nil {
 		cleanUp.clean = true
 		return nil, fmt.Errorf("error writing mp4 to cloud storage: %w", err)
 	}
 
-	rawFrames, err = rvh.writeFramesToGCSAndCloudStorageFileNames(rawFrames, framesFilePaths)
+	rawFrames, err = rvh.writeFramesToGCSAndCloudStorageFileNames(rawFrames, framesFilePaths, cleanUp)
 	if err != nil {
 		cleanUp.clean = true
 		return nil, fmt.Errorf("error writing frames to cloud storage: %w", err)
@@ -208,34 +210,48 @@ func (rvh *RawVideoHandler) HandleRawVideoProcessRequest(req *st.RawVideoProcess
 		cleanUp.clean = true
 		return nil, senecaerror.NewBadStateError(fmt.Errorf("len(rawLocations) %d != len(rawMotions) %d", len(rawLocations), len(rawMotions)))
 	}
-	for i := range rawLocations {
-		cleanUp.rawLocationIDs = append(cleanUp.rawLocationIDs, rawLocations[i].Id)
-		if _, err := rvh.rawLocationDAO.InsertUniqueRawLocation(rawLocations[i]); err != nil {
-			cleanUp.clean = true
-			return nil, fmt.Errorf("InsertUniqueRawLocation(%v) returns err: %w", rawLocations[i], err)
+	// The extracted data is stored in one transaction, so a failure never leaves part of it behind.
+	if err := rvh.transactionRunner.RunInTransaction(context.TODO(), func(daos *dao.AllDAOSet) error {
+		if _, err := daos.RawLocationDAO.InsertUniqueRawLocations(rawLocations); err != nil {
+			return fmt.Errorf("InsertUniqueRawLocations() returns err: %w", err)
 		}
-		cleanUp.rawMotionIDs = append(cleanUp.rawMotionIDs, rawMotions[i].Id)
-		if _, err := rvh.rawMotionDAO.InsertUniqueRawMotion(rawMotions[i]); err != nil {
-			cleanUp.clean = true
-			return nil, fmt.Errorf("InsertUniqueRawMotion(%v) returns err: %w", rawMotions[i], err)
+		if _, err := daos.RawMotionDAO.InsertUniqueRawMotions(rawMotions); err != nil {
+			return fmt.Errorf("InsertUniqueRawMotions() returns err: %w", err)
 		}
-	}
-
-	for i := range rawFrames {
-		cleanUp.rawFrameIDs = append(cleanUp.rawFrameIDs, rawFrames[i].Id)
-		if _, err := rvh.rawFrameDAO.InsertUniqueRawFrame(rawFrames[i]); err != nil {
-			cleanUp.clean = true
-			return nil, fmt.Errorf("InsertUniqueRawFrame(%v) returns err: %w", rawFrames[i], err)
+		if _, err := daos.RawFrameDAO.InsertUniqueRawFrames(rawFrames); err != nil {
+			return fmt.Errorf("InsertUniqueRawFrames() returns err: %w", err)
 		}
+		return nil
+	}); err != nil {
+		cleanUp.clean = true
+		return nil, fmt.Errorf("error storing data extracted from rawVideo %q: %w", rawVideo.Id, err)
 	}
 
 	rvh.logger.Log(fmt.Sprintf("Successfully processed video %q for user %q", rawVideo.CloudStorageFileName, req.UserId))
+	rvh.enqueueRunAlgorithms(req.UserId)
 	return &st.RawVideoProcessResponse{
 		RawVideoId: rawVideo.Id,
 	}, nil
 }
 
-func (rvh *RawVideoHandler) writeMP4ToGCS(mp4Path string, rawVideo *st.RawVideo) error {
+// enqueueRunAlgorithms queues the algorithms to run on the user's new data.  Failures are only logged, since the
+// data is stored and the next run over all users picks it up.
+func (rvh *RawVideoHandler) enqueueRunAlgorithms(userID string) {
+	if rvh.jobQueue == nil {
+		return
+	}
+	job, err := jobqueue.NewJob(jobqueue.RunAlgorithms, userID, nil)
+	if err == nil {
+		_, err = jobqueue.EnqueueUnlessPending(context.TODO(), rvh.jobQueue, job)
+	}
+	if err != nil {
+		rvh.logger.Error(fmt.Sprintf("Error enqueuing RunAlgorithms job for user %q: %v", userID, err))
+	}
+}
+
+// writeMP4ToGCS streams the video to simple storage, from videoBytes when the request carried them so the
+// upload doesn't have to go through disk, otherwise from mp4Path.  Like WriteBucketFile, mp4Path is removed afterwards.
+func (rvh *RawVideoHandler) writeMP4ToGCS(mp4Path string, videoBytes []byte, rawVideo *st.RawVideo, cleanUp *cleanUp) error {
 	bucketName, fileName, err := data.GCSURLToBucketNameAndFileName(rawVideo.CloudStorageFileName)
 	if err != nil {
 		return fmt.Errorf("GCSURLToBucketNameAndFileName(%s) returns err: %w", rawVideo.CloudStorageFileName, err)
@@ -253,18 +269,40 @@ func (rvh *RawVideoHandler) writeMP4ToGCS(mp4Path string, rawVideo *st.RawVideo)
 	if err != nil {
 		return fmt.Errorf("error checking if file %q in bucket %q exists: %w", fileName, bucketName, err)
 	}
-	if !bucketFileExists {
-		if err := rvh.simpleStorage.WriteBucketFile(bucketName, mp4Path, fileName); err != nil {
-			return fmt.Errorf("writeBucketFile(%s, %s, %s) returns err: %v", bucketName, fileName, mp4Path, err)
-		}
-	} else {
+	if bucketFileExists {
 		return senecaerror.NewBadStateError(fmt.Errorf("attempting to overwrite existing file %q", fileName))
 	}
 
+	var video io.Reader
+	if len(videoBytes) > 0 {
+		video = bytes.NewReader(videoBytes)
+	} else {
+		f, err := os.Open(mp4Path)
+		if err != nil {
+			return senecaerror.NewBadStateError(fmt.Errorf("error opening local file %q - err: %v", mp4Path, err))
+		}
+		defer f.Close()
+		video = f
+	}
+	defer os.Remove(mp4Path)
+
+	w, err := rvh.simpleStorage.NewBucketFileWriter(bucketName, fileName)
+	if err != nil {
+		return fmt.Errorf("NewBucketFileWriter(%s, %s) returns err: %w", bucketName, fileName, err)
+	}
+	cleanUp.addBucketFile(bucketName, fileName)
+	if _, err := io.Copy(w, video); err != nil {
+		w.Abort()
+		return fmt.Errorf("error streaming %q to bucket %q - err: %w", fileName, bucketName, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("error closing writer for %q in bucket %q - err: %w", fileName, bucketName, err)
+	}
+
 	return nil
 }
 
-func (rvh *RawVideoHandler) writeFramesToGCSAndCloudStorageFileNames(rawFrames []*st.RawFrame, localFilePaths []string) ([]*st.RawFrame, error) {
+func (rvh *RawVideoHandler) writeFramesToGCSAndCloudStorageFileNames(rawFrames []*st.RawFrame, localFilePaths []string, cleanUp *cleanUp) ([]*st.RawFrame, error) {
 	if bucketExists, err := rvh.simpleStorage.BucketExists(cloud.RawFrameBucketName); err != nil {
 		return nil, fmt.Errorf("bucketExists(_, %s, %s) returned err: %v", rvh.projectID, cloud.RawFrameBucketName, err)
 	} else if !bucketExists {
@@ -286,10 +324,12 @@ func (rvh *RawVideoHandler) writeFramesToGCSAndCloudStorageFileNames(rawFrames [
 			if err := rvh.simpleStorage.WriteBucketFile(cloud.RawFrameBucketName, path, rawFrames[i].CloudStorageFileName); err != nil {
 				return nil, fmt.Errorf("writeBucketFile(%s, %s, %s) returns err: %v", cloud.RawFrameBucketName, path, rawFrames[i].CloudStorageFileName, err)
 			}
+			cleanUp.addBucketFile(cloud.RawFrameBucketName, rawFrames[i].CloudStorageFileName)
 		} else {
 			return nil, senecaerror.NewBadStateError(fmt.Errorf("attempting to overwrite existing file %q", rawFrames[i].CloudStorageFileName))
 		}
-		rawFrames[i].CloudStorageFileName = fmt.Sprintf("gs://%s/%s", cloud.RawFrameBucketName.RealName(rvh.projectID), rawFrames[i].CloudStorageFileName)
+		scheme := rvh.simpleStorage.URLScheme()
+		rawFrames[i].CloudStorageFileName = scheme.BucketFileURL(cloud.RawFrameBucketName.RealNameForScheme(scheme, rvh.projectID), rawFrames[i].CloudStorageFileName)
 	}
 
 	return rawFrames, nil
@@ -349,31 +389,35 @@ func getMP4BytesFromForm(userID string, r *http.Request) ([]byte, string, error)
 	return buf.Bytes(), mp4Name, nil
 }
 
+// cleanUp undoes the parts of a failed request that were stored before the data extracted from the video,
+// which is stored atomically and so never needs cleaning up.
 type cleanUp struct {
-	rawVideoDAO    dao.RawVideoDAO
-	rawLocationDAO dao.RawLocationDAO
-	rawMotionDAO   dao.RawMotionDAO
-	rawFrameDAO    dao.RawFrameDAO
-	logger         logging.LoggingInterface
-
-	clean      bool
-	rawVideoID string
-	// TODO(lucaloncar): also clean up s3 file so none are dangling
-	rawLocationIDs []string
-	rawMotionIDs   []string
-	rawFrameIDs    []string
+	rawVideoDAO   dao.RawVideoDAO
+	simpleStorage cloud.SimpleStorageInterface
+	logger        logging.LoggingInterface
+
+	clean       bool
+	rawVideoID  string
+	bucketFiles []bucketFile
+}
+
+type bucketFile struct {
+	bucketName cloud.BucketName
+	fileName   string
 }
 
-func newCleanUp(rawVideoDAO dao.RawVideoDAO, rawLocationDAO dao.RawLocationDAO, rawMotionDAO dao.RawMotionDAO, rawFrameDAO dao.RawFrameDAO, logger logging.LoggingInterface) *cleanUp {
+func newCleanUp(rawVideoDAO dao.RawVideoDAO, simpleStorage cloud.SimpleStorageInterface, logger logging.LoggingInterface) *cleanUp {
 	return &cleanUp{
-		rawVideoDAO:    rawVideoDAO,
-		rawLocationDAO: rawLocationDAO,
-		rawMotionDAO:   rawMotionDAO,
-		rawFrameDAO:    rawFrameDAO,
-		logger:         logger,
+		rawVideoDAO:   rawVideoDAO,
+		simpleStorage: simpleStorage,
+		logger:        logger,
 	}
 }
 
+func (cu *cleanUp) addBucketFile(bucketName cloud.BucketName, fileName string) {
+	cu.bucketFiles = append(cu.bucketFiles, bucketFile{bucketName: bucketName, fileName: fileName})
+}
+
 func (cu *cleanUp) cleanUpFailure() {
 	if !cu.clean {
 		return
@@ -385,16 +429,14 @@ func (cu *cleanUp) cleanUpFailure() {
 		errs = append(errs, cu.rawVideoDAO.DeleteRawVideoByID(cu.rawVideoID))
 	}
 
-	for _, rlid := range cu.rawLocationIDs {
-		errs = append(errs, cu.rawLocationDAO.DeleteRawLocationByID(rlid))
-	}
-
-	for _, rmid := range cu.rawMotionIDs {
-		errs = append(errs, cu.rawMotionDAO.DeleteRawMotionByID(rmid))
-	}
-
-	for _, rfid := range cu.rawFrameIDs {
-		errs = append(errs, cu.rawFrameDAO.DeleteRawFrameByID(rfid))
+	for _, bf := range cu.bucketFiles {
+		if err := cu.simpleStorage.DeleteBucketFile(bf.bucketName, bf.fileName); err != nil {
+			var nfe *senecaerror.NotFoundError
+			// The writer may have failed before anything was committed.
+			if !errors.As(err, &nfe) {
+				errs = append(errs, err)
+			}
+		}
 	}
 
 	for _, err := range errs {
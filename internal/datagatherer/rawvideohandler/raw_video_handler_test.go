@@ -1,6 +1,7 @@
 package rawvideohandler
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -10,6 +11,7 @@ import (
 	"seneca/internal/client/cloud"
 	"seneca/internal/client/database"
 	"seneca/internal/client/logging"
+	"seneca/internal/dao"
 	"seneca/internal/dao/rawframedao"
 	"seneca/internal/dao/rawlocationdao"
 	"seneca/internal/dao/rawmotiondao"
@@ -146,18 +148,84 @@ func TestInsertRawVideoFromRequestErrorHandling(t *testing.T) {
 		return false, nil
 	}
 
-	fakeSSC.WriteBucketFileMock = func(bucketName cloud.BucketName, localFileNameAndPath, bucketFileName string) error {
-		return fmt.Errorf("")
+	fakeSSC.NewBucketFileWriterMock = func(bucketName cloud.BucketName, bucketFileName string) (cloud.BucketFileWriter, error) {
+		return nil, fmt.Errorf("")
 	}
 	_, err = rawVidHandler.HandleRawVideoProcessRequest(request)
 	if err == nil {
-		t.Errorf("Want err from RawVideoRequest when WriteBucketFile returns err, got nil")
+		t.Errorf("Want err from RawVideoRequest when NewBucketFileWriter returns err, got nil")
+	}
+	fakeSSC.NewBucketFileWriterMock = func(bucketName cloud.BucketName, bucketFileName string) (cloud.BucketFileWriter, error) {
+		return &failingWriteCloser{}, nil
+	}
+	_, err = rawVidHandler.HandleRawVideoProcessRequest(request)
+	if err == nil {
+		t.Errorf("Want err from RawVideoRequest when the bucket file writer fails to Close, got nil")
 	}
 	fakeSSC.WriteBucketFileMock = func(bucketName cloud.BucketName, localFileNameAndPath, bucketFileName string) error {
 		return nil
 	}
 }
 
+func TestWriteMP4AbortsFailedUpload(t *testing.T) {
+	rawVidHandler, _, fakeSSC, mockRawVideoDAO, _, _, err := newRawVideoHandlerForTests()
+	if err != nil {
+		t.Fatalf("newRawVideoHandlerForTests() returns err: %v", err)
+	}
+	fakeSSC.BucketExistsMock = func(bucketName cloud.BucketName) (bool, error) {
+		return true, nil
+	}
+	fakeSSC.BucketFileExistsMock = func(bucketName cloud.BucketName, bucketFileName string) (bool, error) {
+		return false, nil
+	}
+	brokenWriter := &failingWriteCloser{failWrites: true}
+	fakeSSC.NewBucketFileWriterMock = func(bucketName cloud.BucketName, bucketFileName string) (cloud.BucketFileWriter, error) {
+		return brokenWriter, nil
+	}
+
+	rawVideo := &st.RawVideo{CloudStorageFileName: cloud.GCSURLScheme.BucketFileURL(cloud.RawVideoBucketName.String(), "123.456.RAW_VIDEO.mp4")}
+	cleanUp := newCleanUp(mockRawVideoDAO, fakeSSC, logging.NewLocalLogger(true /* silent */))
+	if err := rawVidHandler.writeMP4ToGCS("", []byte("video"), rawVideo, cleanUp); err == nil {
+		t.Fatalf("Want err from writeMP4ToGCS() when the bucket file writer fails to Write, got nil")
+	}
+	// Closing would commit a truncated video on GCS and S3.
+	if !brokenWriter.aborted || brokenWriter.closed {
+		t.Errorf("Want the bucket file writer aborted rather than closed when a Write fails")
+	}
+}
+
+// failingWriteCloser fails to commit writes on Close, and fails the writes themselves if failWrites.
+type failingWriteCloser struct {
+	failWrites bool
+	closed     bool
+	aborted    bool
+}
+
+func (w *failingWriteCloser) Write(p []byte) (int, error) {
+	if w.failWrites {
+		return 0, fmt.Errorf("failed to write")
+	}
+	return len(p), nil
+}
+
+func (w *failingWriteCloser) Close() error {
+	w.closed = true
+	return fmt.Errorf("failed to commit")
+}
+
+func (w *failingWriteCloser) Abort() {
+	w.aborted = true
+}
+
+// passThroughTransactionRunner hands the mocks to the function, they don't roll back.
+type passThroughTransactionRunner struct {
+	daos *dao.AllDAOSet
+}
+
+func (tr *passThroughTransactionRunner) RunInTransaction(ctx context.Context, f func(daos *dao.AllDAOSet) error) error {
+	return f(tr.daos)
+}
+
 func newRawVideoHandlerForTests() (*RawVideoHandler, *mp4.FakeMP4Tool, *cloud.FakeSimpleStorageClient, *rawvideodao.MockRawVideoDAO, *rawlocationdao.MockRawLocatinDAO, *rawmotiondao.MockRawMotionDAO, error) {
 	fakeSimpleStorageClient := cloud.NewFakeSimpleStorageClient()
 	fakeMP4Tool := mp4.NewFakeMP4Tool()
@@ -169,7 +237,14 @@ func newRawVideoHandlerForTests() (*RawVideoHandler, *mp4.FakeMP4Tool, *cloud.Fa
 	sqlInterface := database.NewFake()
 	rawFrameDAO := rawframedao.NewSQLRawFrameDAO(sqlInterface)
 
-	rawVideoHandler, err := NewRawVideoHandler(fakeSimpleStorageClient, fakeMP4Tool, mockRawVideoDAO, mockRawLocationDAO, mockRawMotionDAO, rawFrameDAO, localLogger, "")
+	transactionRunner := &passThroughTransactionRunner{daos: &dao.AllDAOSet{
+		RawVideoDAO:    mockRawVideoDAO,
+		RawLocationDAO: mockRawLocationDAO,
+		RawMotionDAO:   mockRawMotionDAO,
+		RawFrameDAO:    rawFrameDAO,
+	}}
+
+	rawVideoHandler, err := NewRawVideoHandler(fakeSimpleStorageClient, fakeMP4Tool, mockRawVideoDAO, transactionRunner, nil, localLogger, "")
 	if err != nil {
 		return nil, nil, nil, nil, nil, nil, fmt.Errorf("NewRawVideoHandler returns err: %v", err)
 	}
@@ -0,0 +1,560 @@
+// Package telemetryhandler stores the GPS logs of vehicles without a dashcam, e.g. GPX tracks, as RawLocations and
+// RawMotions, the way rawvideohandler stores the GPS data of videos.  It also stores what vehicles report about
+// themselves in OBD-II and CAN logs as RawVehicleSignals.
+package telemetryhandler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"seneca/api/constants"
+	"seneca/api/senecaerror"
+	st "seneca/api/type"
+	"seneca/internal/client/cloud"
+	"seneca/internal/client/database"
+	"seneca/internal/client/logging"
+	"seneca/internal/dao"
+	"seneca/internal/jobqueue"
+	"seneca/internal/util"
+	"seneca/internal/util/data"
+	"seneca/internal/util/telemetry"
+	"seneca/internal/util/vehiclelog"
+	"time"
+)
+
+const (
+	telemetryFormKey                     = "telemetry"
+	timeZoneFormKey                      = "time_zone"
+	rawTelemetryBucketFileNameIdentifier = "RAW_TELEMETRY"
+	// samplesPerTransaction is how many samples of a log are stored per transaction, which keeps each transaction
+	// well below the write limits of the databases however long the log is.
+	samplesPerTransaction = 100
+	// vehicleSignalInterval is how far apart the stored samples of a vehicle signal are.  CAN buses report signals
+	// many times a second, far more often than decelerations need to be measured.
+	vehicleSignalInterval = 500 * time.Millisecond
+)
+
+// 	ProcessRequest is a GPS or vehicle log to store for a user.
+type ProcessRequest struct {
+	UserID string
+	// FileName is the name the file was uploaded with, its extension is its telemetry.Format or vehiclelog.Format.
+	FileName string
+	// FileBytes are the contents of the file, if empty they're read from LocalPath.
+	FileBytes []byte
+	LocalPath string
+	// TimeZone is the IANA time zone, e.g. "America/New_York", of vehicle logs with UTC times and no GPS fixes to
+	// find it from.
+	TimeZone string
+}
+
+// 	ProcessResponse describes what was stored from a log.
+type ProcessResponse struct {
+	RawTelemetryFileID string `json:"raw_telemetry_file_id"`
+	// Samples is how many samples were stored, as a RawLocation and RawMotion each for GPS logs, or as a
+	// RawVehicleSignal each for vehicle logs.
+	Samples int `json:"samples"`
+	// Duplicates is how many samples were skipped because the user already has data at their times.
+	Duplicates int `json:"duplicates"`
+}
+
+// TelemetryHandler implements all logic for handling GPS and vehicle log requests.
+type TelemetryHandler struct {
+	simpleStorage     cloud.SimpleStorageInterface
+	transactionRunner dao.TransactionRunner
+	// jobQueue receives a RunAlgorithms job for the user of every processed file, if it's set.
+	jobQueue jobqueue.Queue
+	logger   logging.LoggingInterface
+}
+
+//	NewTelemetryHandler initializes a new TelemetryHandler with the given parameters.
+//	Params:
+//		simpleStorage cloud.SimpleStorageInterface: where the uploaded files are kept
+//		transactionRunner dao.TransactionRunner: stores the data read from a file in batches
+//		jobQueue jobqueue.Queue: where the algorithms are queued to run on new data, may be nil
+//		logger logging.LoggingInterface
+//	Returns:
+//		*TelemetryHandler
+func NewTelemetryHandler(simpleStorage cloud.SimpleStorageInterface, transactionRunner dao.TransactionRunner, jobQueue jobqueue.Queue, logger logging.LoggingInterface) *TelemetryHandler {
+	return &TelemetryHandler{
+		simpleStorage:     simpleStorage,
+		transactionRunner: transactionRunner,
+		jobQueue:          jobQueue,
+		logger:            logger,
+	}
+}
+
+//	HandleTelemetryHTTPRequest handles a multipart POST of a GPS or vehicle log in the "telemetry" field, with an
+//	optional ProcessRequest.TimeZone in the "time_zone" field, and writes the ProcessResponse as JSON.
+//	Params:
+//		w http.ResponseWriter
+//		r *http.Request
+//		userID string: the user the log belongs to
+//	Returns:
+//		none
+func (th *TelemetryHandler) HandleTelemetryHTTPRequest(w http.ResponseWriter, r *http.Request, userID string) {
+	fileBytes, fileName, err := getFileFromForm(userID, r)
+	if err != nil {
+		senecaerror.WriteErrorToHTTPResponse(w, err)
+		return
+	}
+
+	response, err := th.HandleProcessRequest(&ProcessRequest{
+		UserID:    userID,
+		FileName:  fileName,
+		FileBytes: fileBytes,
+		TimeZone:  r.FormValue(timeZoneFormKey),
+	})
+	if err != nil {
+		senecaerror.WriteErrorToHTTPResponse(w, err)
+		logging.LogSenecaError(th.logger, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		th.logger.Error(fmt.Sprintf("Error writing %T: %v", response, err))
+	}
+}
+
+//	HandleProcessRequest reads the samples of the log and stores those the user doesn't have data for yet, with a
+//	RawTelemetryFile for the log as their Source.  GPS logs are stored as RawLocations and RawMotions, and vehicle
+//	logs as RawVehicleSignals.  Times are shifted from UTC to the local time of the drive, like the GPS times of
+//	videos.
+//	Params:
+//		req *ProcessRequest
+//	Returns:
+//		*ProcessResponse
+//		senecaerror.UserError: if the file can't be read or has no new samples
+//		error
+func (th *TelemetryHandler) HandleProcessRequest(req *ProcessRequest) (*ProcessResponse, error) {
+	defer func(startTime time.Time) {
+		th.logger.Log(fmt.Sprintf("Handling telemetry request took %s", time.Since(startTime)))
+	}(time.Now())
+
+	if req.UserID == "" {
+		return nil, senecaerror.NewUserError("", fmt.Errorf("UserID must not be \"\" in telemetry ProcessRequest"), "UserID not specified in request.")
+	}
+	th.logger.Log(fmt.Sprintf("Handling telemetry request for file %q of user %q", req.FileName, req.UserID))
+
+	fileBytes := req.FileBytes
+	if len(fileBytes) == 0 {
+		var err error
+		if fileBytes, err = ioutil.ReadFile(req.LocalPath); err != nil {
+			return nil, senecaerror.NewServerError(fmt.Errorf("error reading telemetry file %q - err: %w", req.LocalPath, err))
+		}
+	}
+	if format, ok := vehiclelog.FormatFromFile(req.FileName, fileBytes); ok {
+		return th.processVehicleLog(req, format, fileBytes)
+	}
+
+	format, err := telemetry.FormatFromFileName(req.FileName)
+	if err != nil {
+		return nil, senecaerror.NewUserError(req.UserID, err, fmt.Sprintf("Telemetry files must be one of %v, or vehicle logs in one of %v.", telemetry.Formats, vehiclelog.Formats))
+	}
+	samples, err := telemetry.Parse(format, bytes.NewReader(fileBytes))
+	if err != nil {
+		return nil, senecaerror.NewUserError(req.UserID, fmt.Errorf("error parsing %q: %w", req.FileName, err), fmt.Sprintf("Malformed %s file.", format))
+	}
+	locations, motions, times := telemetry.ToLocationsMotionsTimes(samples)
+	tzOffset, err := data.TZOffset(times[0], locations[0])
+	if err != nil {
+		return nil, fmt.Errorf("data.TZOffset(%v, %v) returns err: %w", times[0], locations[0], err)
+	}
+	for i := range times {
+		times[i] = times[i].Add(tzOffset)
+	}
+
+	return th.store(req, format.String(), fileBytes, &gpsSamples{userID: req.UserID, locations: locations, motions: motions, times: times})
+}
+
+// processVehicleLog stores the new samples of a vehicle log as RawVehicleSignals, downsampled to one per signal
+// every vehicleSignalInterval.  UTC times are shifted to the time zone of the first GPS fix in the log, or else to
+// the TimeZone of the request.
+func (th *TelemetryHandler) processVehicleLog(req *ProcessRequest, format vehiclelog.Format, fileBytes []byte) (*ProcessResponse, error) {
+	log, err := vehiclelog.Parse(format, bytes.NewReader(fileBytes))
+	if err != nil {
+		return nil, senecaerror.NewUserError(req.UserID, fmt.Errorf("error parsing %q: %w", req.FileName, err), fmt.Sprintf("Malformed %s file.", format))
+	}
+
+	if !log.LocalTimes {
+		tzOffset, err := vehicleLogTZOffset(req, log)
+		if err != nil {
+			return nil, err
+		}
+		for _, sample := range log.Samples {
+			sample.Time = sample.Time.Add(tzOffset)
+		}
+	}
+
+	samples := vehiclelog.Downsample(log.Samples, vehicleSignalInterval)
+	return th.store(req, format.String(), fileBytes, &vehicleSignalSamples{userID: req.UserID, samples: samples})
+}
+
+func vehicleLogTZOffset(req *ProcessRequest, log *vehiclelog.Log) (time.Duration, error) {
+	t := log.Samples[0].Time
+	if log.Location != nil {
+		tzOffset, err := data.TZOffset(t, log.Location)
+		if err != nil {
+			return 0, fmt.Errorf("data.TZOffset(%v, %v) returns err: %w", t, log.Location, err)
+		}
+		return tzOffset, nil
+	}
+
+	if req.TimeZone == "" {
+		return 0, senecaerror.NewUserError(req.UserID, fmt.Errorf("%q has UTC times without a location or time zone", req.FileName), "Vehicle logs without GPS need a time zone.")
+	}
+	location, err := time.LoadLocation(req.TimeZone)
+	if err != nil {
+		return 0, senecaerror.NewUserError(req.UserID, fmt.Errorf("time.LoadLocation(%s) returns err: %w", req.TimeZone, err), fmt.Sprintf("Unknown time zone %q.", req.TimeZone))
+	}
+	_, offset := t.In(location).Zone()
+	return time.Second * time.Duration(offset), nil
+}
+
+// logSamples are the samples read from a log, in time order.
+type logSamples interface {
+	// len is how many samples there are.
+	len() int
+	// time is the time of the sample at index i.
+	time(i int) time.Time
+	// newIndexes returns those of the indexes, in order, of samples the user doesn't have data at the time of yet.
+	newIndexes(daos *dao.AllDAOSet, indexes []int) ([]int, error)
+	// store stores the samples at the indexes with the source.
+	store(daos *dao.AllDAOSet, source *st.Source, indexes []int) error
+}
+
+// store stores the samples of the log that the user doesn't have yet, and the log itself.  The RawTelemetryFile of
+// the log is created first, spanning those samples, then the file is uploaded, and then the samples are stored
+// samplesPerTransaction at a time with the RawTelemetryFile as their Source.  If a batch fails, the batches before
+// it stay stored, and storing the log again stores the rest.
+func (th *TelemetryHandler) store(req *ProcessRequest, format string, fileBytes []byte, samples logSamples) (*ProcessResponse, error) {
+	var newIndexes []int
+	var rawTelemetryFile *database.RawTelemetryFile
+	var bucketFileName string
+	if err := th.transactionRunner.RunInTransaction(context.TODO(), func(daos *dao.AllDAOSet) error {
+		indexes := make([]int, samples.len())
+		for i := range indexes {
+			indexes[i] = i
+		}
+		var err error
+		if newIndexes, err = samples.newIndexes(daos, indexes); err != nil {
+			return err
+		}
+		if len(newIndexes) == 0 {
+			return senecaerror.NewUserError(req.UserID, fmt.Errorf("all %d samples of %q already exist", samples.len(), req.FileName), "The file has no new samples.")
+		}
+
+		createTimeMs := util.TimeToMilliseconds(samples.time(newIndexes[0]))
+		bucketFileName = fmt.Sprintf("%s.%d.%s.%s", req.UserID, createTimeMs, rawTelemetryBucketFileNameIdentifier, format)
+		rawTelemetryFile, err = daos.RawTelemetryFileDAO.InsertUniqueRawTelemetryFile(&database.RawTelemetryFile{
+			UserId:               req.UserID,
+			OriginalFileName:     req.FileName,
+			Format:               format,
+			CloudStorageFileName: th.simpleStorage.URLScheme().BucketFileURL(cloud.RawTelemetryBucketName.String(), bucketFileName),
+			CreateTimeMs:         createTimeMs,
+			DurationMs:           util.TimeToMilliseconds(samples.time(newIndexes[len(newIndexes)-1])) - createTimeMs,
+		})
+		if err != nil {
+			return fmt.Errorf("InsertUniqueRawTelemetryFile() returns err: %w", err)
+		}
+		return nil
+	}); err != nil {
+		var ue *senecaerror.UserError
+		if errors.As(err, &ue) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("error storing RawTelemetryFile of %q: %w", req.FileName, err)
+	}
+
+	// The upload isn't in a transaction, since transactions may be retried.
+	if err := th.writeFile(bucketFileName, fileBytes); err != nil {
+		th.deleteRawTelemetryFile(rawTelemetryFile.Id)
+		return nil, fmt.Errorf("error writing %q to cloud storage: %w", bucketFileName, err)
+	}
+
+	response := &ProcessResponse{RawTelemetryFileID: rawTelemetryFile.Id}
+	source := &st.Source{
+		SourceId:   rawTelemetryFile.Id,
+		SourceType: database.RawTelemetryFileSourceType,
+	}
+	for start := 0; start < len(newIndexes); start += samplesPerTransaction {
+		end := start + samplesPerTransaction
+		if end > len(newIndexes) {
+			end = len(newIndexes)
+		}
+		stored := 0
+		if err := th.transactionRunner.RunInTransaction(context.TODO(), func(daos *dao.AllDAOSet) error {
+			// Another log of the user may have been stored since.
+			indexes, err := samples.newIndexes(daos, newIndexes[start:end])
+			if err != nil {
+				return err
+			}
+			if len(indexes) > 0 {
+				if err := samples.store(daos, source, indexes); err != nil {
+					return err
+				}
+			}
+			stored = len(indexes)
+			return nil
+		}); err != nil {
+			return nil, fmt.Errorf("error storing samples of %q after storing %d: %w", req.FileName, response.Samples, err)
+		}
+		response.Samples += stored
+	}
+	response.Duplicates = samples.len() - response.Samples
+
+	th.logger.Log(fmt.Sprintf("Stored %d samples of %q for user %q, skipped %d duplicates", response.Samples, req.FileName, req.UserID, response.Duplicates))
+	th.enqueueRunAlgorithms(req.UserID)
+	return response, nil
+}
+
+// gpsSamples are the samples of a GPS log, stored as RawLocations and RawMotions.
+type gpsSamples struct {
+	userID    string
+	locations []*st.Location
+	motions   []*st.Motion
+	times     []time.Time
+}
+
+func (s *gpsSamples) len() int {
+	return len(s.times)
+}
+
+func (s *gpsSamples) time(i int) time.Time {
+	return s.times[i]
+}
+
+// newIndexes drops the samples the user already has a RawLocation or RawMotion at the time of, whichever Source
+// they're from, since the DAOs refuse to insert duplicates.  Times are compared in milliseconds, the precision
+// they're stored in.
+func (s *gpsSamples) newIndexes(daos *dao.AllDAOSet, indexes []int) ([]int, error) {
+	start, end := s.times[indexes[0]], s.times[indexes[len(indexes)-1]].Add(time.Millisecond)
+	existing := map[int64]bool{}
+
+	rawLocationIDs, err := daos.RawLocationDAO.ListUserRawLocationIDsByTime(s.userID, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("ListUserRawLocationIDsByTime() returns err: %w", err)
+	}
+	if len(rawLocationIDs) > 0 {
+		rawLocations, err := daos.RawLocationDAO.GetRawLocationsByIDs(rawLocationIDs)
+		if err != nil {
+			return nil, fmt.Errorf("GetRawLocationsByIDs() returns err: %w", err)
+		}
+		for _, rawLocation := range rawLocations {
+			existing[rawLocation.TimestampMs] = true
+		}
+	}
+
+	rawMotionIDs, err := daos.RawMotionDAO.ListUserRawMotionIDsByTime(s.userID, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("ListUserRawMotionIDsByTime() returns err: %w", err)
+	}
+	if len(rawMotionIDs) > 0 {
+		rawMotions, err := daos.RawMotionDAO.GetRawMotionsByIDs(rawMotionIDs)
+		if err != nil {
+			return nil, fmt.Errorf("GetRawMotionsByIDs() returns err: %w", err)
+		}
+		for _, rawMotion := range rawMotions {
+			existing[rawMotion.TimestampMs] = true
+		}
+	}
+
+	newIndexes := []int{}
+	for _, i := range indexes {
+		timestampMs := util.TimeToMilliseconds(s.times[i])
+		if existing[timestampMs] {
+			continue
+		}
+		// Samples less than a millisecond apart would be stored at the same time.
+		existing[timestampMs] = true
+		newIndexes = append(newIndexes, i)
+	}
+	return newIndexes, nil
+}
+
+func (s *gpsSamples) store(daos *dao.AllDAOSet, source *st.Source, indexes []int) error {
+	locations, motions, times := make([]*st.Location, len(indexes)), make([]*st.Motion, len(indexes)), make([]time.Time, len(indexes))
+	for j, i := range indexes {
+		locations[j], motions[j], times[j] = s.locations[i], s.motions[i], s.times[i]
+	}
+	rawLocations, err := data.ConstructRawLocationDatas(s.userID, source, locations, times)
+	if err != nil {
+		return fmt.Errorf("ConstructRawLocationDatas() returns err: %w", err)
+	}
+	rawMotions, err := data.ConstructRawMotionDatas(s.userID, source, motions, times)
+	if err != nil {
+		return fmt.Errorf("ConstructRawMotionDatas() returns err: %w", err)
+	}
+	if _, err := daos.RawLocationDAO.InsertUniqueRawLocations(rawLocations); err != nil {
+		return fmt.Errorf("InsertUniqueRawLocations() returns err: %w", err)
+	}
+	if _, err := daos.RawMotionDAO.InsertUniqueRawMotions(rawMotions); err != nil {
+		return fmt.Errorf("InsertUniqueRawMotions() returns err: %w", err)
+	}
+	return nil
+}
+
+// vehicleSignalSamples are the samples of a vehicle log, stored as RawVehicleSignals.
+type vehicleSignalSamples struct {
+	userID  string
+	samples []*vehiclelog.Sample
+}
+
+func (s *vehicleSignalSamples) len() int {
+	return len(s.samples)
+}
+
+func (s *vehicleSignalSamples) time(i int) time.Time {
+	return s.samples[i].Time
+}
+
+// newIndexes drops the samples the user already has a RawVehicleSignal of the same signal at the time of, like
+// gpsSamples.newIndexes.
+func (s *vehicleSignalSamples) newIndexes(daos *dao.AllDAOSet, indexes []int) ([]int, error) {
+	type key struct {
+		timestampMs int64
+		signal      string
+	}
+	start, end := s.samples[indexes[0]].Time, s.samples[indexes[len(indexes)-1]].Time.Add(time.Millisecond)
+	existing := map[key]bool{}
+
+	rawVehicleSignalIDs, err := daos.RawVehicleSignalDAO.ListUserRawVehicleSignalIDsByTime(s.userID, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("ListUserRawVehicleSignalIDsByTime() returns err: %w", err)
+	}
+	if len(rawVehicleSignalIDs) > 0 {
+		rawVehicleSignals, err := daos.RawVehicleSignalDAO.GetRawVehicleSignalsByIDs(rawVehicleSignalIDs)
+		if err != nil {
+			return nil, fmt.Errorf("GetRawVehicleSignalsByIDs() returns err: %w", err)
+		}
+		for _, rawVehicleSignal := range rawVehicleSignals {
+			existing[key{timestampMs: rawVehicleSignal.TimestampMs, signal: rawVehicleSignal.Signal}] = true
+		}
+	}
+
+	newIndexes := []int{}
+	for _, i := range indexes {
+		k := key{timestampMs: util.TimeToMilliseconds(s.samples[i].Time), signal: s.samples[i].Signal.String()}
+		if existing[k] {
+			continue
+		}
+		// Samples less than a millisecond apart would be stored at the same time.
+		existing[k] = true
+		newIndexes = append(newIndexes, i)
+	}
+	return newIndexes, nil
+}
+
+func (s *vehicleSignalSamples) store(daos *dao.AllDAOSet, source *st.Source, indexes []int) error {
+	rawVehicleSignals := make([]*database.RawVehicleSignal, len(indexes))
+	for j, i := range indexes {
+		rawVehicleSignals[j] = &database.RawVehicleSignal{
+			UserId:      s.userID,
+			Signal:      s.samples[i].Signal.String(),
+			Value:       s.samples[i].Value,
+			TimestampMs: util.TimeToMilliseconds(s.samples[i].Time),
+			Source:      source,
+		}
+	}
+	if _, err := daos.RawVehicleSignalDAO.InsertUniqueRawVehicleSignals(rawVehicleSignals); err != nil {
+		return fmt.Errorf("InsertUniqueRawVehicleSignals() returns err: %w", err)
+	}
+	return nil
+}
+
+func (th *TelemetryHandler) writeFile(fileName string, fileBytes []byte) error {
+	bucketName := cloud.RawTelemetryBucketName
+	if bucketExists, err := th.simpleStorage.BucketExists(bucketName); err != nil {
+		return fmt.Errorf("BucketExists(%s) returns err: %w", bucketName, err)
+	} else if !bucketExists {
+		if err := th.simpleStorage.CreateBucket(bucketName); err != nil {
+			return fmt.Errorf("CreateBucket(%s) returns err: %w", bucketName, err)
+		}
+	}
+
+	bucketFileExists, err := th.simpleStorage.BucketFileExists(bucketName, fileName)
+	if err != nil {
+		return fmt.Errorf("error checking if file %q in bucket %q exists: %w", fileName, bucketName, err)
+	}
+	if bucketFileExists {
+		return senecaerror.NewBadStateError(fmt.Errorf("attempting to overwrite existing file %q", fileName))
+	}
+
+	w, err := th.simpleStorage.NewBucketFileWriter(bucketName, fileName)
+	if err != nil {
+		return fmt.Errorf("NewBucketFileWriter(%s, %s) returns err: %w", bucketName, fileName, err)
+	}
+	if _, err := io.Copy(w, bytes.NewReader(fileBytes)); err != nil {
+		w.Abort()
+		return fmt.Errorf("error streaming %q to bucket %q - err: %w", fileName, bucketName, err)
+	}
+	if err := w.Close(); err != nil {
+		th.deleteFile(fileName)
+		return fmt.Errorf("error closing writer for %q in bucket %q - err: %w", fileName, bucketName, err)
+	}
+	return nil
+}
+
+// deleteRawTelemetryFile removes the RawTelemetryFile of a request whose file couldn't be uploaded.  Failures are
+// only logged, since the request failed anyway.
+func (th *TelemetryHandler) deleteRawTelemetryFile(id string) {
+	if err := th.transactionRunner.RunInTransaction(context.TODO(), func(daos *dao.AllDAOSet) error {
+		return daos.RawTelemetryFileDAO.DeleteRawTelemetryFileByID(id)
+	}); err != nil {
+		th.logger.Error(fmt.Sprintf("Error cleaning up RawTelemetryFile %q: %v", id, err))
+	}
+}
+
+// deleteFile removes the file of a failed upload.
+func (th *TelemetryHandler) deleteFile(fileName string) {
+	if err := th.simpleStorage.DeleteBucketFile(cloud.RawTelemetryBucketName, fileName); err != nil {
+		var nfe *senecaerror.NotFoundError
+		// The writer may have failed before anything was committed.
+		if !errors.As(err, &nfe) {
+			th.logger.Error(fmt.Sprintf("Error cleaning up telemetry file %q: %v", fileName, err))
+		}
+	}
+}
+
+// enqueueRunAlgorithms queues the algorithms to run on the user's new data.  Failures are only logged, since the
+// data is stored and the next run over all users picks it up.
+func (th *TelemetryHandler) enqueueRunAlgorithms(userID string) {
+	if th.jobQueue == nil {
+		return
+	}
+	job, err := jobqueue.NewJob(jobqueue.RunAlgorithms, userID, nil)
+	if err == nil {
+		_, err = jobqueue.EnqueueUnlessPending(context.TODO(), th.jobQueue, job)
+	}
+	if err != nil {
+		th.logger.Error(fmt.Sprintf("Error enqueuing RunAlgorithms job for user %q: %v", userID, err))
+	}
+}
+
+func getFileFromForm(userID string, r *http.Request) ([]byte, string, error) {
+	maxFileSizeBytes := constants.MaxTelemetryFileSizeMB * 1024 * 1024
+
+	file, header, err := r.FormFile(telemetryFormKey)
+	if err != nil {
+		return nil, "", senecaerror.NewUserError(userID, fmt.Errorf("error parsing form for telemetry file - err: %v", err), fmt.Sprintf("%q not found in request body.", telemetryFormKey))
+	}
+	defer file.Close()
+
+	if header.Size > maxFileSizeBytes {
+		return nil, "", senecaerror.NewUserError(userID, fmt.Errorf("error parsing form for telemetry file - file too large"), fmt.Sprintf("File too large. Max file size is %d MB.", constants.MaxTelemetryFileSizeMB))
+	}
+	fileName, err := util.GetFileNameFromPath(header.Filename)
+	if err != nil || fileName == "" {
+		return nil, "", senecaerror.NewUserError(userID, fmt.Errorf("error parsing form for telemetry file - invalid file name %q", header.Filename), "Telemetry file name invalid.")
+	}
+	fileBytes, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, "", senecaerror.NewUserError(userID, fmt.Errorf("error reading telemetry file - err: %v", err), fmt.Sprintf("Corrupted file: %q.", header.Filename))
+	}
+	return fileBytes, fileName, nil
+}
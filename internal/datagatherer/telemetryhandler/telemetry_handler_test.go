@@ -0,0 +1,310 @@
+package telemetryhandler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"seneca/api/senecaerror"
+	"seneca/internal/client/cloud"
+	"seneca/internal/client/cloud/local"
+	"seneca/internal/client/database"
+	"seneca/internal/client/logging"
+	"seneca/internal/dao"
+	"seneca/internal/dao/sqldaoset"
+	"seneca/internal/util"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testUserID = "user"
+
+// testCSV is a drive in New Jersey, which is 5 hours behind UTC in February.
+var testCSV = strings.Join([]string{
+	"time,lat,lon,speed_mph",
+	"2021-02-13T22:47:50Z,40.4930,-74.4305,10",
+	"2021-02-13T22:47:51Z,40.4931,-74.4306,11",
+	"2021-02-13T22:47:52Z,40.4932,-74.4307,12",
+}, "\n")
+
+// testCandump is the OBD-II speed and RPM of a vehicle at 2021-04-04 15:49:29 UTC.
+var testCandump = strings.Join([]string{
+	"(1617551369.000000) can0 7E8#03410D32AAAAAAAA",
+	"(1617551369.000000) can0 7E8#04410C1F40AAAAAA",
+	"(1617551370.000000) can0 7E8#03410D30AAAAAAAA",
+}, "\n")
+
+func newTelemetryHandlerForTests(t *testing.T) (*TelemetryHandler, *dao.AllDAOSet, *local.FileSystemStorageClient) {
+	logger := logging.NewLocalLogger(true /* silent */)
+	sqlInterface := database.NewFake()
+	simpleStorage, err := local.NewFileSystemStorageClient(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("NewFileSystemStorageClient() returns err: %v", err)
+	}
+	handler := NewTelemetryHandler(simpleStorage, sqldaoset.NewTransactionRunner(sqlInterface, logger, time.Second*5), nil, logger)
+	return handler, sqldaoset.New(sqlInterface, logger, time.Second*5), simpleStorage
+}
+
+func TestHandleProcessRequestStoresNewSamples(t *testing.T) {
+	handler, daos, simpleStorage := newTelemetryHandlerForTests(t)
+
+	response, err := handler.HandleProcessRequest(&ProcessRequest{UserID: testUserID, FileName: "drive.csv", FileBytes: []byte(testCSV)})
+	if err != nil {
+		t.Fatalf("HandleProcessRequest() returns err: %v", err)
+	}
+	if response.Samples != 3 || response.Duplicates != 0 {
+		t.Errorf("Want 3 samples and 0 duplicates, got %+v", response)
+	}
+
+	// The times are stored in local time.
+	start := time.Date(2021, time.February, 13, 17, 47, 50, 0, time.UTC)
+	rawLocationIDs, err := daos.RawLocationDAO.ListUserRawLocationIDsByTime(testUserID, start, start.Add(3*time.Second))
+	if err != nil {
+		t.Fatalf("ListUserRawLocationIDsByTime() returns err: %v", err)
+	}
+	if len(rawLocationIDs) != 3 {
+		t.Fatalf("Want 3 RawLocations from %v, got %d", start, len(rawLocationIDs))
+	}
+	rawLocation, err := daos.RawLocationDAO.GetRawLocationByID(rawLocationIDs[0])
+	if err != nil {
+		t.Fatalf("GetRawLocationByID() returns err: %v", err)
+	}
+	if rawLocation.Source.SourceType != database.RawTelemetryFileSourceType || rawLocation.Source.SourceId != response.RawTelemetryFileID {
+		t.Errorf("Want RawLocation from RawTelemetryFile %q, got %v", response.RawTelemetryFileID, rawLocation.Source)
+	}
+
+	rawTelemetryFile, err := daos.RawTelemetryFileDAO.GetRawTelemetryFileByID(response.RawTelemetryFileID)
+	if err != nil {
+		t.Fatalf("GetRawTelemetryFileByID() returns err: %v", err)
+	}
+	if rawTelemetryFile.CreateTimeMs != util.TimeToMilliseconds(start) || rawTelemetryFile.DurationMs != 2000 || rawTelemetryFile.Format != "csv" {
+		t.Errorf("Want a 2s csv RawTelemetryFile created at %v, got %v", start, rawTelemetryFile)
+	}
+	fileName := strings.TrimPrefix(rawTelemetryFile.CloudStorageFileName, simpleStorage.URLScheme().BucketFileURL(cloud.RawTelemetryBucketName.String(), ""))
+	if exists, err := simpleStorage.BucketFileExists(cloud.RawTelemetryBucketName, fileName); err != nil || !exists {
+		t.Errorf("Want %q in bucket %q, got %t, %v", fileName, cloud.RawTelemetryBucketName, exists, err)
+	}
+}
+
+func TestHandleProcessRequestSkipsExistingSamples(t *testing.T) {
+	handler, _, _ := newTelemetryHandlerForTests(t)
+
+	if _, err := handler.HandleProcessRequest(&ProcessRequest{UserID: testUserID, FileName: "drive.csv", FileBytes: []byte(testCSV)}); err != nil {
+		t.Fatalf("HandleProcessRequest() returns err: %v", err)
+	}
+
+	overlapping := testCSV + "\n2021-02-13T22:47:53Z,40.4933,-74.4308,13"
+	response, err := handler.HandleProcessRequest(&ProcessRequest{UserID: testUserID, FileName: "longer.csv", FileBytes: []byte(overlapping)})
+	if err != nil {
+		t.Fatalf("HandleProcessRequest() with overlapping samples returns err: %v", err)
+	}
+	if response.Samples != 1 || response.Duplicates != 3 {
+		t.Errorf("Want 1 sample and 3 duplicates, got %+v", response)
+	}
+
+	var userError *senecaerror.UserError
+	if _, err := handler.HandleProcessRequest(&ProcessRequest{UserID: testUserID, FileName: "again.csv", FileBytes: []byte(testCSV)}); !errors.As(err, &userError) {
+		t.Errorf("Want UserError from HandleProcessRequest() without new samples, got %v", err)
+	}
+}
+
+// countingTransactionRunner counts the transactions run through it.
+type countingTransactionRunner struct {
+	dao.TransactionRunner
+	transactions int
+}
+
+func (r *countingTransactionRunner) RunInTransaction(ctx context.Context, f func(daos *dao.AllDAOSet) error) error {
+	r.transactions++
+	return r.TransactionRunner.RunInTransaction(ctx, f)
+}
+
+func TestHandleProcessRequestStoresLongLogsInBatches(t *testing.T) {
+	handler, daos, _ := newTelemetryHandlerForTests(t)
+	transactionRunner := &countingTransactionRunner{TransactionRunner: handler.transactionRunner}
+	handler.transactionRunner = transactionRunner
+
+	const samples = 2345
+	start := time.Date(2021, time.February, 13, 22, 47, 50, 0, time.UTC)
+	lines := []string{"time,lat,lon,speed_mph"}
+	for i := 0; i < samples; i++ {
+		lines = append(lines, fmt.Sprintf("%s,%.4f,-74.4305,30", start.Add(time.Second*time.Duration(i)).Format(time.RFC3339), 40.4930+float64(i)*0.0001))
+	}
+	response, err := handler.HandleProcessRequest(&ProcessRequest{UserID: testUserID, FileName: "long.csv", FileBytes: []byte(strings.Join(lines, "\n"))})
+	if err != nil {
+		t.Fatalf("HandleProcessRequest() returns err: %v", err)
+	}
+	if response.Samples != samples || response.Duplicates != 0 {
+		t.Errorf("Want %d samples and 0 duplicates, got %+v", samples, response)
+	}
+	// One transaction creates the RawTelemetryFile, the others store a batch each.
+	if want := 1 + (samples+samplesPerTransaction-1)/samplesPerTransaction; transactionRunner.transactions != want {
+		t.Errorf("Want %d transactions, got %d", want, transactionRunner.transactions)
+	}
+
+	localStart := start.Add(-5 * time.Hour)
+	rawLocationIDs, err := daos.RawLocationDAO.ListUserRawLocationIDsByTime(testUserID, localStart, localStart.Add(samples*time.Second))
+	if err != nil {
+		t.Fatalf("ListUserRawLocationIDsByTime() returns err: %v", err)
+	}
+	rawMotionIDs, err := daos.RawMotionDAO.ListUserRawMotionIDsByTime(testUserID, localStart, localStart.Add(samples*time.Second))
+	if err != nil {
+		t.Fatalf("ListUserRawMotionIDsByTime() returns err: %v", err)
+	}
+	if len(rawLocationIDs) != samples || len(rawMotionIDs) != samples {
+		t.Errorf("Want %d RawLocations and RawMotions, got %d and %d", samples, len(rawLocationIDs), len(rawMotionIDs))
+	}
+}
+
+func TestHandleProcessRequestDeletesRawTelemetryFileIfUploadFails(t *testing.T) {
+	handler, daos, simpleStorage := newTelemetryHandlerForTests(t)
+
+	// The file of another log starting at the same time is in the way.
+	start := time.Date(2021, time.February, 13, 17, 47, 50, 0, time.UTC)
+	if err := simpleStorage.CreateBucket(cloud.RawTelemetryBucketName); err != nil {
+		t.Fatalf("CreateBucket() returns err: %v", err)
+	}
+	w, err := simpleStorage.NewBucketFileWriter(cloud.RawTelemetryBucketName, fmt.Sprintf("%s.%d.%s.csv", testUserID, util.TimeToMilliseconds(start), rawTelemetryBucketFileNameIdentifier))
+	if err != nil {
+		t.Fatalf("NewBucketFileWriter() returns err: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() returns err: %v", err)
+	}
+
+	if _, err := handler.HandleProcessRequest(&ProcessRequest{UserID: testUserID, FileName: "drive.csv", FileBytes: []byte(testCSV)}); err == nil {
+		t.Fatalf("Want err from HandleProcessRequest() when the upload fails, got nil")
+	}
+	rawTelemetryFileIDs, err := daos.RawTelemetryFileDAO.ListUserRawTelemetryFileIDs(testUserID)
+	if err != nil {
+		t.Fatalf("ListUserRawTelemetryFileIDs() returns err: %v", err)
+	}
+	rawLocationIDs, err := daos.RawLocationDAO.ListUserRawLocationIDsByTime(testUserID, start, start.Add(3*time.Second))
+	if err != nil {
+		t.Fatalf("ListUserRawLocationIDsByTime() returns err: %v", err)
+	}
+	if len(rawTelemetryFileIDs) != 0 || len(rawLocationIDs) != 0 {
+		t.Errorf("Want no RawTelemetryFiles or RawLocations, got %d and %d", len(rawTelemetryFileIDs), len(rawLocationIDs))
+	}
+}
+
+func TestHandleProcessRequestRejectsInvalidFiles(t *testing.T) {
+	handler, _, _ := newTelemetryHandlerForTests(t)
+
+	testCases := []struct {
+		desc string
+		req  *ProcessRequest
+	}{
+		{desc: "no user", req: &ProcessRequest{FileName: "drive.csv", FileBytes: []byte(testCSV)}},
+		{desc: "unknown format", req: &ProcessRequest{UserID: testUserID, FileName: "drive.kml", FileBytes: []byte(testCSV)}},
+		{desc: "malformed file", req: &ProcessRequest{UserID: testUserID, FileName: "drive.gpx", FileBytes: []byte(testCSV)}},
+		{desc: "malformed vehicle log", req: &ProcessRequest{UserID: testUserID, FileName: "can0.log", FileBytes: []byte(testCSV)}},
+		{desc: "unknown time zone", req: &ProcessRequest{UserID: testUserID, FileName: "can0.log", FileBytes: []byte(testCandump), TimeZone: "Mars/Olympus_Mons"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			var userError *senecaerror.UserError
+			if _, err := handler.HandleProcessRequest(tc.req); !errors.As(err, &userError) {
+				t.Errorf("Want UserError from HandleProcessRequest(), got %v", err)
+			}
+		})
+	}
+}
+
+func TestHandleProcessRequestStoresVehicleSignals(t *testing.T) {
+	handler, daos, _ := newTelemetryHandlerForTests(t)
+
+	var userError *senecaerror.UserError
+	if _, err := handler.HandleProcessRequest(&ProcessRequest{UserID: testUserID, FileName: "can0.log", FileBytes: []byte(testCandump)}); !errors.As(err, &userError) {
+		t.Fatalf("Want UserError from HandleProcessRequest() without a time zone, got %v", err)
+	}
+
+	response, err := handler.HandleProcessRequest(&ProcessRequest{UserID: testUserID, FileName: "can0.log", FileBytes: []byte(testCandump), TimeZone: "America/New_York"})
+	if err != nil {
+		t.Fatalf("HandleProcessRequest() returns err: %v", err)
+	}
+	if response.Samples != 3 || response.Duplicates != 0 {
+		t.Errorf("Want 3 samples and 0 duplicates, got %+v", response)
+	}
+
+	// The times are stored in local time, 4 hours behind UTC in April.
+	start := time.Date(2021, time.April, 4, 11, 49, 29, 0, time.UTC)
+	ids, err := daos.RawVehicleSignalDAO.ListUserRawVehicleSignalIDsByTime(testUserID, start, start.Add(2*time.Second))
+	if err != nil {
+		t.Fatalf("ListUserRawVehicleSignalIDsByTime() returns err: %v", err)
+	}
+	rawVehicleSignals, err := daos.RawVehicleSignalDAO.GetRawVehicleSignalsByIDs(ids)
+	if err != nil {
+		t.Fatalf("GetRawVehicleSignalsByIDs() returns err: %v", err)
+	}
+	if len(rawVehicleSignals) != 3 {
+		t.Fatalf("Want 3 RawVehicleSignals from %v, got %d", start, len(rawVehicleSignals))
+	}
+	for _, rawVehicleSignal := range rawVehicleSignals {
+		if rawVehicleSignal.Source.SourceType != database.RawTelemetryFileSourceType || rawVehicleSignal.Source.SourceId != response.RawTelemetryFileID {
+			t.Errorf("Want RawVehicleSignal from RawTelemetryFile %q, got %v", response.RawTelemetryFileID, rawVehicleSignal.Source)
+		}
+	}
+
+	rawTelemetryFile, err := daos.RawTelemetryFileDAO.GetRawTelemetryFileByID(response.RawTelemetryFileID)
+	if err != nil {
+		t.Fatalf("GetRawTelemetryFileByID() returns err: %v", err)
+	}
+	if rawTelemetryFile.Format != "candump" || rawTelemetryFile.DurationMs != 1000 {
+		t.Errorf("Want a 1s candump RawTelemetryFile, got %v", rawTelemetryFile)
+	}
+
+	// The same signals are skipped, but other signals at the same times aren't.
+	elm327 := strings.Join([]string{
+		"Time,Speed (km/h),Brake Switch",
+		"2021-04-04 11:49:29,50,off",
+		"2021-04-04 11:49:30,48,on",
+	}, "\n")
+	response, err = handler.HandleProcessRequest(&ProcessRequest{UserID: testUserID, FileName: "obd.csv", FileBytes: []byte(elm327)})
+	if err != nil {
+		t.Fatalf("HandleProcessRequest() with overlapping samples returns err: %v", err)
+	}
+	if response.Samples != 2 || response.Duplicates != 2 {
+		t.Errorf("Want 2 samples and 2 duplicates, got %+v", response)
+	}
+}
+
+func TestHandleTelemetryHTTPRequest(t *testing.T) {
+	handler, _, _ := newTelemetryHandlerForTests(t)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile(telemetryFormKey, "drive.csv")
+	if err != nil {
+		t.Fatalf("CreateFormFile() returns err: %v", err)
+	}
+	part.Write([]byte(testCSV))
+	writer.Close()
+
+	request := httptest.NewRequest(http.MethodPost, "/users/user/telemetry", body)
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+	recorder := httptest.NewRecorder()
+	handler.HandleTelemetryHTTPRequest(recorder, request, testUserID)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Want status %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	response := &ProcessResponse{}
+	if err := json.NewDecoder(recorder.Body).Decode(response); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	if response.RawTelemetryFileID == "" || response.Samples != 3 {
+		t.Errorf("Want a RawTelemetryFile with 3 samples, got %+v", response)
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.HandleTelemetryHTTPRequest(recorder, httptest.NewRequest(http.MethodPost, "/users/user/telemetry", nil), testUserID)
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("Want status %d without a file, got %d", http.StatusBadRequest, recorder.Code)
+	}
+}
@@ -42,6 +42,12 @@ func NewFactory(weatherService weather.WeatherServiceInterface, intraSenecaClien
 	}
 	factory.algorithmsCatalogue[followingDistanceV0.Tag()] = followingDistanceV0
 
+	hardBrakingV0, err := newHardBrakingV0()
+	if err != nil {
+		return nil, fmt.Errorf("newHardBrakingV0() returns err: %w", err)
+	}
+	factory.algorithmsCatalogue[hardBrakingV0.Tag()] = hardBrakingV0
+
 	return factory, nil
 }
 
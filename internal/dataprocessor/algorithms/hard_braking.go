@@ -0,0 +1,198 @@
+package algorithms
+
+import (
+	"fmt"
+	"seneca/api/senecaerror"
+	st "seneca/api/type"
+	"seneca/internal/client/database"
+	"seneca/internal/dataprocessor"
+	"seneca/internal/util"
+	"seneca/internal/util/vehiclelog"
+	"sort"
+	"time"
+)
+
+// hardBrakingV0 finds hard braking in the speeds vehicles report over OBD-II or CAN, which are far less noisy than
+// speeds derived from GPS.  Decelerations are confirmed by the brake pedal when the vehicle log reports it: braking
+// without the pedal pressed, e.g. a misread speed, isn't an event.  Logs without any brake signal are judged by their
+// speed alone.
+type hardBrakingV0 struct {
+	tag      string
+	rangeMap *util.RangeMap
+	// maxSampleGap is the longest time between two speeds that a deceleration is measured over.
+	maxSampleGap time.Duration
+	// brakeWindow is how long before a deceleration the brake pedal is looked at, since the brake is pressed before
+	// the speed drops.
+	brakeWindow time.Duration
+}
+
+func newHardBrakingV0() (*hardBrakingV0, error) {
+	// Unlike accelerometer peaks, wheel speeds rarely drop faster than 1g, about 22 mph/s.
+	keys := []util.Range{
+		{L: -9999999, U: -20},
+		{L: -20, U: -15},
+		{L: -15, U: -12},
+		{L: -12, U: -9},
+		{L: -9, U: -7},
+		{L: -7, U: 9999999},
+	}
+	values := []interface{}{
+		100.0,
+		80.0,
+		50.0,
+		20.0,
+		10.0,
+		0.0,
+	}
+
+	rangeMap, err := util.NewRangeMap(keys, values)
+	if err != nil {
+		return nil, senecaerror.NewDevError(fmt.Errorf("NewRangeMap() returns err: %w", err))
+	}
+
+	return &hardBrakingV0{
+		tag:          "00005",
+		rangeMap:     rangeMap,
+		maxSampleGap: time.Second * 2,
+		brakeWindow:  time.Second,
+	}, nil
+}
+
+// 	braking is a time a user braked hard, from the first to the last speed of the decelerations it's made of.
+type braking struct {
+	event   *st.EventInternal
+	startMs int64
+	endMs   int64
+}
+
+func (hb *hardBrakingV0) GenerateEvents(inputs map[string][]interface{}) ([]*st.EventInternal, error) {
+	brakings, err := hb.findBrakings(inputs[dataprocessor.RawVehicleSignalTypeString], dataprocessor.RawVehicleSignalTypeString)
+	if err != nil {
+		return nil, err
+	}
+
+	events := []*st.EventInternal{}
+	for _, userBrakings := range brakings {
+		for _, b := range userBrakings {
+			events = append(events, b.event)
+		}
+	}
+	return events, nil
+}
+
+// findBrakings returns the hard brakings in the speeds and brakes of signalObjs, the input named inputName, by user.
+func (hb *hardBrakingV0) findBrakings(signalObjs []interface{}, inputName string) (map[string][]*braking, error) {
+	// Speeds and brakes by user, since a run may have several.
+	speeds := map[string][]*database.RawVehicleSignal{}
+	brakes := map[string][]*database.RawVehicleSignal{}
+	// brakeSources are the IDs of the logs that report the brake.
+	brakeSources := map[string]bool{}
+	for _, signalObj := range signalObjs {
+		signal, ok := signalObj.(*database.RawVehicleSignal)
+		if !ok {
+			return nil, fmt.Errorf("found a %T in map entry for %s", signalObj, inputName)
+		}
+		switch vehiclelog.Signal(signal.Signal) {
+		case vehiclelog.Speed:
+			speeds[signal.UserId] = append(speeds[signal.UserId], signal)
+		case vehiclelog.Brake:
+			brakes[signal.UserId] = append(brakes[signal.UserId], signal)
+			brakeSources[signal.Source.GetSourceId()] = true
+		}
+	}
+
+	brakings := map[string][]*braking{}
+	for userID, userSpeeds := range speeds {
+		userBrakings, err := hb.findUserBrakings(userSpeeds, brakes[userID], brakeSources)
+		if err != nil {
+			return nil, err
+		}
+		brakings[userID] = userBrakings
+	}
+	return brakings, nil
+}
+
+// findUserBrakings returns every time a user braked hard, with an event at the speed that dropped the fastest.
+func (hb *hardBrakingV0) findUserBrakings(speeds, brakes []*database.RawVehicleSignal, brakeSources map[string]bool) ([]*braking, error) {
+	sort.Slice(speeds, func(i, j int) bool { return speeds[i].TimestampMs < speeds[j].TimestampMs })
+	sort.Slice(brakes, func(i, j int) bool { return brakes[i].TimestampMs < brakes[j].TimestampMs })
+
+	brakings := []*braking{}
+	// currentBraking is the braking the last decelerations are part of, nil between brakings.
+	var currentBraking *braking
+	for i := 1; i < len(speeds); i++ {
+		previous, current := speeds[i-1], speeds[i]
+		elapsed := util.MillisecondsToTime(current.TimestampMs).Sub(util.MillisecondsToTime(previous.TimestampMs))
+		if elapsed <= 0 || elapsed > hb.maxSampleGap {
+			currentBraking = nil
+			continue
+		}
+
+		decelerationMphS := (current.Value - previous.Value) / elapsed.Seconds()
+		valObj, ok := hb.rangeMap.Get(int64(decelerationMphS))
+		if !ok {
+			return nil, fmt.Errorf("deceleration of %f mph/s for raw vehicle signal is impossible", decelerationMphS)
+		}
+		severity, ok := valObj.(float64)
+		if !ok {
+			return nil, senecaerror.NewDevError(fmt.Errorf("trying to get float64 from rangeMap even though %T was inserted", valObj))
+		}
+		reportsBrake := brakeSources[current.Source.GetSourceId()]
+		if severity == 0.0 || (reportsBrake && !hb.brakePressed(brakes, previous.TimestampMs-hb.brakeWindow.Milliseconds(), current.TimestampMs)) {
+			currentBraking = nil
+			continue
+		}
+
+		if currentBraking != nil {
+			currentBraking.endMs = current.TimestampMs
+			if event := currentBraking.event; decelerationMphS < event.Value {
+				event.Value, event.Severity, event.TimestampMs, event.Source.SourceId = decelerationMphS, severity, current.TimestampMs, current.Id
+			}
+			continue
+		}
+		event := &st.EventInternal{
+			UserId:      current.UserId,
+			EventType:   st.EventType_FAST_DECELERATION,
+			Value:       decelerationMphS,
+			Severity:    severity,
+			TimestampMs: current.TimestampMs,
+			Source: &st.Source{
+				SourceId:   current.Id,
+				SourceType: database.RawVehicleSignalSourceType,
+			},
+			AlgoTag: hb.tag,
+		}
+		currentBraking = &braking{event: event, startMs: previous.TimestampMs, endMs: current.TimestampMs}
+		brakings = append(brakings, currentBraking)
+	}
+	return brakings, nil
+}
+
+// brakePressed returns whether the brake was pressed in [startMs, endMs].  A gap in the brake samples isn't a press.
+func (hb *hardBrakingV0) brakePressed(brakes []*database.RawVehicleSignal, startMs, endMs int64) bool {
+	i := sort.Search(len(brakes), func(i int) bool { return brakes[i].TimestampMs >= startMs })
+	for ; i < len(brakes) && brakes[i].TimestampMs <= endMs; i++ {
+		if brakes[i].Value > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// during returns whether timestampMs is within one of the brakings.
+func during(brakings []*braking, timestampMs int64) bool {
+	for _, b := range brakings {
+		if b.startMs <= timestampMs && timestampMs <= b.endMs {
+			return true
+		}
+	}
+	return false
+}
+
+func (hb *hardBrakingV0) GenerateDrivingConditions(inputs map[string][]interface{}) ([]*st.DrivingConditionInternal, error) {
+	return nil, nil
+}
+
+func (hb *hardBrakingV0) Tag() string {
+	return hb.tag
+}
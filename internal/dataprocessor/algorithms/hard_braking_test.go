@@ -0,0 +1,101 @@
+package algorithms
+
+import (
+	"fmt"
+	"seneca/internal/client/database"
+	"seneca/internal/dataprocessor"
+	"seneca/internal/util/vehiclelog"
+	"testing"
+)
+
+func TestHardBraking(t *testing.T) {
+	hb, err := newHardBrakingV0()
+	if err != nil {
+		t.Fatalf("newHardBrakingV0() returns err: %v", err)
+	}
+
+	testCases := []struct {
+		desc string
+		// speeds are a second apart, from 0ms.
+		speeds []float64
+		// brakes are the brake percent at each ms.
+		brakes        map[int64]float64
+		wantSeverity  float64
+		wantTimestamp int64
+	}{
+		{desc: "gentle braking", speeds: []float64{40, 35, 30}, wantSeverity: 0},
+		{desc: "hard braking without brake signal", speeds: []float64{40, 30, 20}, wantSeverity: 20, wantTimestamp: 1000},
+		{desc: "strongest deceleration of a braking", speeds: []float64{40, 30, 10, 0}, brakes: map[int64]float64{500: 100}, wantSeverity: 80, wantTimestamp: 2000},
+		{desc: "brake released", speeds: []float64{40, 25}, brakes: map[int64]float64{0: 0, 1000: 0}, wantSeverity: 0},
+		{desc: "brake pressed before the drop", speeds: []float64{40, 40, 25}, brakes: map[int64]float64{0: 0, 500: 40, 2000: 0}, wantSeverity: 50, wantTimestamp: 2000},
+		{desc: "gap in brake samples", speeds: []float64{40, 30, 20}, brakes: map[int64]float64{5000: 0}, wantSeverity: 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			signals := []interface{}{}
+			for i, speed := range tc.speeds {
+				signals = append(signals, &database.RawVehicleSignal{Id: fmt.Sprintf("speed%d", i), UserId: "123", Signal: vehiclelog.Speed.String(), Value: speed, TimestampMs: int64(i) * 1000})
+			}
+			for timestampMs, brake := range tc.brakes {
+				signals = append(signals, &database.RawVehicleSignal{Id: fmt.Sprintf("brake%d", timestampMs), UserId: "123", Signal: vehiclelog.Brake.String(), Value: brake, TimestampMs: timestampMs})
+			}
+
+			events, err := hb.GenerateEvents(map[string][]interface{}{dataprocessor.RawVehicleSignalTypeString: signals})
+			if err != nil {
+				t.Fatalf("GenerateEvents() returns err: %v", err)
+			}
+			if tc.wantSeverity == 0 {
+				if len(events) != 0 {
+					t.Errorf("Want no events, got %v", events)
+				}
+				return
+			}
+			if len(events) != 1 {
+				t.Fatalf("Want one event, got %v", events)
+			}
+			if events[0].Severity != tc.wantSeverity || events[0].TimestampMs != tc.wantTimestamp {
+				t.Errorf("Want event with severity %v at %d, got %v", tc.wantSeverity, tc.wantTimestamp, events[0])
+			}
+			if events[0].Source.SourceType != database.RawVehicleSignalSourceType || events[0].Source.SourceId != fmt.Sprintf("speed%d", tc.wantTimestamp/1000) {
+				t.Errorf("Want event from the speed at %d, got %v", tc.wantTimestamp, events[0].Source)
+			}
+		})
+	}
+}
+
+func TestFindBrakings(t *testing.T) {
+	hb, err := newHardBrakingV0()
+	if err != nil {
+		t.Fatalf("newHardBrakingV0() returns err: %v", err)
+	}
+
+	// A stop from 0ms to 3000ms and a shorter braking from 5000ms to 6000ms.
+	signals := []interface{}{}
+	for i, speed := range []float64{40, 30, 10, 0, 0, 15, 5} {
+		signals = append(signals, &database.RawVehicleSignal{Id: fmt.Sprintf("speed%d", i), UserId: "123", Signal: vehiclelog.Speed.String(), Value: speed, TimestampMs: int64(i) * 1000})
+	}
+	brakings, err := hb.findBrakings(signals, dataprocessor.RawVehicleSignalTypeString)
+	if err != nil {
+		t.Fatalf("findBrakings() returns err: %v", err)
+	}
+	if len(brakings["123"]) != 2 {
+		t.Fatalf("Want 2 brakings, got %v", brakings["123"])
+	}
+
+	testCases := []struct {
+		timestampMs int64
+		want        bool
+	}{
+		{timestampMs: -500, want: false},
+		{timestampMs: 0, want: true},
+		{timestampMs: 3000, want: true},
+		{timestampMs: 4000, want: false},
+		{timestampMs: 5500, want: true},
+		{timestampMs: 7000, want: false},
+	}
+	for _, tc := range testCases {
+		if got := during(brakings["123"], tc.timestampMs); got != tc.want {
+			t.Errorf("Want during() at %dms to be %t, got %t", tc.timestampMs, tc.want, got)
+		}
+	}
+}
@@ -11,6 +11,8 @@ import (
 type decelerationV0 struct {
 	tag      string
 	rangeMap *util.RangeMap
+	// hardBraking finds the brakings in the vehicle's own speeds, which aren't counted again from GPS.
+	hardBraking *hardBrakingV0
 }
 
 func newDecelerationV0() (*decelerationV0, error) {
@@ -36,9 +38,15 @@ func newDecelerationV0() (*decelerationV0, error) {
 		return nil, senecaerror.NewDevError(fmt.Errorf("NewRangeMap() returns err: %w", err))
 	}
 
+	hardBraking, err := newHardBrakingV0()
+	if err != nil {
+		return nil, err
+	}
+
 	return &decelerationV0{
-		tag:      "00002",
-		rangeMap: rangeMap,
+		tag:         "00002",
+		rangeMap:    rangeMap,
+		hardBraking: hardBraking,
 	}, nil
 }
 
@@ -48,6 +56,13 @@ func (dec *decelerationV0) GenerateEvents(inputs map[string][]interface{}) ([]*s
 		return nil, nil
 	}
 
+	// hardBrakingV0 has an event for the brakings the vehicle's own speeds show, far more precisely than GPS.  GPS
+	// decelerations elsewhere are still events, even where the vehicle's speeds don't show hard braking.
+	brakings, err := dec.hardBraking.findBrakings(inputs[dataprocessor.VehicleBrakingTypeString], dataprocessor.VehicleBrakingTypeString)
+	if err != nil {
+		return nil, err
+	}
+
 	events := []*st.EventInternal{}
 
 	for _, motionObj := range motionsObjs {
@@ -55,6 +70,9 @@ func (dec *decelerationV0) GenerateEvents(inputs map[string][]interface{}) ([]*s
 		if !ok {
 			return nil, fmt.Errorf("found a %T in map entry for %s", motionObj, dataprocessor.RawMotionTypeString)
 		}
+		if during(brakings[rawMotion.UserId], rawMotion.TimestampMs) {
+			continue
+		}
 
 		valObj, ok := dec.rangeMap.Get(int64(rawMotion.Motion.AccelerationMphS))
 		if !ok {
@@ -0,0 +1,52 @@
+package algorithms
+
+import (
+	st "seneca/api/type"
+	"seneca/internal/dataprocessor"
+	"testing"
+)
+
+func TestRapidAccelerationSeverities(t *testing.T) {
+	dec, err := newDecelerationV0()
+	if err != nil {
+		t.Fatalf("newDecelerationV0() returns err: %v", err)
+	}
+	acc, err := newAccelerationV0()
+	if err != nil {
+		t.Fatalf("newAccelerationV0() returns err: %v", err)
+	}
+
+	testCases := []struct {
+		desc             string
+		accelerationMphS float64
+		algorithm        dataprocessor.AlgorithmInterface
+		wantSeverity     float64
+	}{
+		{desc: "gentle braking", accelerationMphS: -5, algorithm: dec, wantSeverity: 0},
+		{desc: "hard braking", accelerationMphS: -20.5, algorithm: dec, wantSeverity: 20},
+		{desc: "harshest braking", accelerationMphS: -200, algorithm: dec, wantSeverity: 100},
+		{desc: "gentle acceleration", accelerationMphS: 5, algorithm: acc, wantSeverity: 0},
+		{desc: "hard acceleration", accelerationMphS: 12.3, algorithm: acc, wantSeverity: 30},
+		{desc: "harshest acceleration", accelerationMphS: 22, algorithm: acc, wantSeverity: 100},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			inputs := map[string][]interface{}{
+				dataprocessor.RawMotionTypeString: {&st.RawMotion{Id: "1", UserId: "123", Motion: &st.Motion{AccelerationMphS: tc.accelerationMphS}}},
+			}
+			events, err := tc.algorithm.GenerateEvents(inputs)
+			if err != nil {
+				t.Fatalf("GenerateEvents() returns err: %v", err)
+			}
+			if tc.wantSeverity == 0 {
+				if len(events) != 0 {
+					t.Errorf("Want no events, got %v", events)
+				}
+				return
+			}
+			if len(events) != 1 || events[0].Severity != tc.wantSeverity {
+				t.Errorf("Want one event with severity %v, got %v", tc.wantSeverity, events)
+			}
+		})
+	}
+}
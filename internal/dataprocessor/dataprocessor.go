@@ -4,12 +4,19 @@ import (
 	"context"
 	"fmt"
 	st "seneca/api/type"
+	"seneca/internal/client/database"
 	"seneca/internal/client/logging"
 	"seneca/internal/dao"
+	"seneca/internal/util"
+	"seneca/internal/util/vehiclelog"
+	"time"
 )
 
 const (
 	AlgosVersion = 0.01
+	// vehicleBrakingMargin is how long before the first and after the last unprocessed RawMotion the vehicle signals
+	// of the VehicleBrakingTypeString input are from.
+	vehicleBrakingMargin = time.Minute
 )
 
 var (
@@ -17,6 +24,12 @@ var (
 	RawLocationTypeString = fmt.Sprintf("%T", &st.RawLocation{})
 	RawMotionTypeString   = fmt.Sprintf("%T", &st.RawMotion{})
 	RawFrameTypeString    = fmt.Sprintf("%T", &st.RawFrame{})
+	// RawVehicleSignalTypeString is the input of the speed, throttle, brake and RPM the vehicle reported itself.
+	RawVehicleSignalTypeString = fmt.Sprintf("%T", &database.RawVehicleSignal{})
+	// VehicleBrakingTypeString is the input of the RawVehicleSignals of the speeds and brakes vehicles reported
+	// while the unprocessed RawMotions were recorded, whether they're processed or not, so GPS decelerations aren't
+	// counted again where the vehicle's speeds show the same hard braking.
+	VehicleBrakingTypeString = "VehicleBraking"
 )
 
 type DataProcessor struct {
@@ -25,6 +38,7 @@ type DataProcessor struct {
 	rawLocationDAO      dao.RawLocationDAO
 	rawFrameDAO         dao.RawFrameDAO
 	rawVideoDAO         dao.RawVideoDAO
+	rawVehicleSignalDAO dao.RawVehicleSignalDAO
 	eventDAO            dao.EventDAO
 	drivingConditionDAO dao.DrivingConditionDAO
 	logger              logging.LoggingInterface
@@ -47,6 +61,7 @@ func New(algorithmList []AlgorithmInterface, allDaos *dao.AllDAOSet, logger logg
 		rawLocationDAO:      allDaos.RawLocationDAO,
 		rawVideoDAO:         allDaos.RawVideoDAO,
 		rawFrameDAO:         allDaos.RawFrameDAO,
+		rawVehicleSignalDAO: allDaos.RawVehicleSignalDAO,
 		eventDAO:            allDaos.EventDAO,
 		drivingConditionDAO: allDaos.DrivingConditionDAO,
 		logger:              logger,
@@ -59,75 +74,117 @@ func New(algorithmList []AlgorithmInterface, allDaos *dao.AllDAOSet, logger logg
 	return dp, nil
 }
 
-func (dp *DataProcessor) Run(userID string) {
+//	Run runs the algorithms on the user's unprocessed data, stores the events and driving conditions they generate,
+//	and marks the data processed.  Failures are logged and the rest of the data is still processed.
+//	Params:
+//		ctx context.Context: canceling it stops the run before anything is stored
+//		userID string
+//	Returns:
+//		error: *RunError if there were any failures
+func (dp *DataProcessor) Run(ctx context.Context, userID string) error {
+	runErr := &RunError{UserID: userID}
+	logError := func(message string) {
+		dp.logger.Error(message)
+		runErr.Errors = append(runErr.Errors, message)
+	}
+
 	allUnprocessedData := map[string][]interface{}{
-		RawVideoTypeString:    {},
-		RawLocationTypeString: {},
-		RawMotionTypeString:   {},
-		RawFrameTypeString:    {},
+		RawVideoTypeString:         {},
+		RawLocationTypeString:      {},
+		RawMotionTypeString:        {},
+		RawFrameTypeString:         {},
+		RawVehicleSignalTypeString: {},
 	}
 
 	unprocessedRawVideoIDs, err := dp.rawVideoDAO.ListUnprocessedRawVideoIDs(userID, AlgosVersion)
 	if err != nil {
-		dp.logger.Error(fmt.Sprintf("ListUnprocessedRawVideoIDs(%s, %f) returns err: %v", userID, AlgosVersion, err))
+		logError(fmt.Sprintf("ListUnprocessedRawVideoIDs(%s, %f) returns err: %v", userID, AlgosVersion, err))
 	}
 
-	for _, urvid := range unprocessedRawVideoIDs {
-		rawVideo, err := dp.rawVideoDAO.GetRawVideoByID(urvid)
-		if err != nil {
-			dp.logger.Error(fmt.Sprintf("GetRawVideoByID(%s) returns err: %v", urvid, err))
+	allUnprocessedData[RawVideoTypeString] = dp.getAll(unprocessedRawVideoIDs, "RawVideo", func(ids []string) ([]interface{}, error) {
+		rawVideos, err := dp.rawVideoDAO.GetRawVideosByIDs(ids)
+		objects := []interface{}{}
+		for _, rawVideo := range rawVideos {
+			objects = append(objects, rawVideo)
 		}
-		allUnprocessedData[RawVideoTypeString] = append(allUnprocessedData[RawVideoTypeString], rawVideo)
-	}
+		return objects, err
+	}, func(id string) (interface{}, error) {
+		return dp.rawVideoDAO.GetRawVideoByID(id)
+	}, logError)
 
 	unprocessedRawMotionIDs, err := dp.rawMotionDAO.ListUnprocessedRawMotionIDs(userID, AlgosVersion)
 	if err != nil {
-		dp.logger.Error(fmt.Sprintf("ListUnprocessedRawMotionIDs(%s, %f) returns err: %v", userID, AlgosVersion, err))
+		logError(fmt.Sprintf("ListUnprocessedRawMotionIDs(%s, %f) returns err: %v", userID, AlgosVersion, err))
 	}
 
-	for _, urmid := range unprocessedRawMotionIDs {
-		rawMotion, err := dp.rawMotionDAO.GetRawMotionByID(urmid)
-		if err != nil {
-			dp.logger.Error(fmt.Sprintf("GetRawMotionByID(%s) returns err: %v", urmid, err))
+	allUnprocessedData[RawMotionTypeString] = dp.getAll(unprocessedRawMotionIDs, "RawMotion", func(ids []string) ([]interface{}, error) {
+		rawMotions, err := dp.rawMotionDAO.GetRawMotionsByIDs(ids)
+		objects := []interface{}{}
+		for _, rawMotion := range rawMotions {
+			objects = append(objects, rawMotion)
 		}
-		allUnprocessedData[RawMotionTypeString] = append(allUnprocessedData[RawMotionTypeString], rawMotion)
-	}
+		return objects, err
+	}, func(id string) (interface{}, error) {
+		return dp.rawMotionDAO.GetRawMotionByID(id)
+	}, logError)
 
 	locationIDs, err := dp.rawLocationDAO.ListUnprocessedRawLocationsIDs(userID, AlgosVersion)
 	if err != nil {
-		dp.logger.Error(fmt.Sprintf("ListUnprocessedRawLocationsIDs(%s, %f) returns err: %v", userID, AlgosVersion, err))
+		logError(fmt.Sprintf("ListUnprocessedRawLocationsIDs(%s, %f) returns err: %v", userID, AlgosVersion, err))
 	}
 
-	for _, lid := range locationIDs {
-		rawLocation, err := dp.rawLocationDAO.GetRawLocationByID(lid)
-		if err != nil {
-			dp.logger.Error(fmt.Sprintf("GetRawLocationByID(%s) returns err: %v", lid, err))
-			continue
+	allUnprocessedData[RawLocationTypeString] = dp.getAll(locationIDs, "RawLocation", func(ids []string) ([]interface{}, error) {
+		rawLocations, err := dp.rawLocationDAO.GetRawLocationsByIDs(ids)
+		objects := []interface{}{}
+		for _, rawLocation := range rawLocations {
+			objects = append(objects, rawLocation)
 		}
-		allUnprocessedData[RawLocationTypeString] = append(allUnprocessedData[RawLocationTypeString], rawLocation)
-	}
+		return objects, err
+	}, func(id string) (interface{}, error) {
+		return dp.rawLocationDAO.GetRawLocationByID(id)
+	}, logError)
 
 	unprocessedRawFrameIDs, err := dp.rawFrameDAO.ListUnprocessedRawFramesIDs(userID, AlgosVersion)
 	if err != nil {
-		dp.logger.Error(fmt.Sprintf("ListUnprocessedRawFramesIDs(%s, %f) returns err: %v", userID, AlgosVersion, err))
+		logError(fmt.Sprintf("ListUnprocessedRawFramesIDs(%s, %f) returns err: %v", userID, AlgosVersion, err))
 	}
 
-	for _, rfid := range unprocessedRawFrameIDs {
-		rawFrame, err := dp.rawFrameDAO.GetRawFrameByID(rfid)
-		if err != nil {
-			dp.logger.Error(fmt.Sprintf("GetRawFrameByID(%s) returns err: %v", rfid, err))
-			continue
+	allUnprocessedData[RawFrameTypeString] = dp.getAll(unprocessedRawFrameIDs, "RawFrame", func(ids []string) ([]interface{}, error) {
+		rawFrames, err := dp.rawFrameDAO.GetRawFramesByIDs(ids)
+		objects := []interface{}{}
+		for _, rawFrame := range rawFrames {
+			objects = append(objects, rawFrame)
 		}
-		allUnprocessedData[RawFrameTypeString] = append(allUnprocessedData[RawFrameTypeString], rawFrame)
+		return objects, err
+	}, func(id string) (interface{}, error) {
+		return dp.rawFrameDAO.GetRawFrameByID(id)
+	}, logError)
+
+	unprocessedRawVehicleSignalIDs, err := dp.rawVehicleSignalDAO.ListUnprocessedRawVehicleSignalIDs(userID, AlgosVersion)
+	if err != nil {
+		logError(fmt.Sprintf("ListUnprocessedRawVehicleSignalIDs(%s, %f) returns err: %v", userID, AlgosVersion, err))
 	}
 
+	allUnprocessedData[RawVehicleSignalTypeString] = dp.getAll(unprocessedRawVehicleSignalIDs, "RawVehicleSignal", func(ids []string) ([]interface{}, error) {
+		rawVehicleSignals, err := dp.rawVehicleSignalDAO.GetRawVehicleSignalsByIDs(ids)
+		objects := []interface{}{}
+		for _, rawVehicleSignal := range rawVehicleSignals {
+			objects = append(objects, rawVehicleSignal)
+		}
+		return objects, err
+	}, func(id string) (interface{}, error) {
+		return dp.rawVehicleSignalDAO.GetRawVehicleSignalByID(id)
+	}, logError)
+
+	allUnprocessedData[VehicleBrakingTypeString] = dp.vehicleBrakingSignals(userID, allUnprocessedData[RawMotionTypeString], logError)
+
 	allEvents := []*st.EventInternal{}
 	allDrivingConditions := []*st.DrivingConditionInternal{}
 
 	for _, alg := range dp.algorithms {
 		eventsFromAlgo, err := alg.GenerateEvents(allUnprocessedData)
 		if err != nil {
-			dp.logger.Error(fmt.Sprintf("GenerateEvents() for algo %q returns err: %v", alg.Tag(), err))
+			logError(fmt.Sprintf("GenerateEvents() for algo %q returns err: %v", alg.Tag(), err))
 		}
 		if eventsFromAlgo != nil {
 			allEvents = append(allEvents, eventsFromAlgo...)
@@ -135,22 +192,26 @@ func (dp *DataProcessor) Run(userID string) {
 
 		drivingConditionsFromAlg, err := alg.GenerateDrivingConditions(allUnprocessedData)
 		if err != nil {
-			dp.logger.Error(fmt.Sprintf("GenerateDrivingConditions() for algo %q returns err: %v", alg.Tag(), err))
+			logError(fmt.Sprintf("GenerateDrivingConditions() for algo %q returns err: %v", alg.Tag(), err))
 		}
 		if drivingConditionsFromAlg != nil {
 			allDrivingConditions = append(allDrivingConditions, drivingConditionsFromAlg...)
 		}
 	}
 
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	for _, event := range allEvents {
-		if _, err := dp.eventDAO.CreateEvent(context.TODO(), event); err != nil {
-			dp.logger.Error(fmt.Sprintf("CreateEvent() for user %q returns err: %v", userID, err))
+		if _, err := dp.eventDAO.CreateEvent(ctx, event); err != nil {
+			logError(fmt.Sprintf("CreateEvent() for user %q returns err: %v", userID, err))
 		}
 	}
 
 	for _, drivingCondition := range allDrivingConditions {
-		if _, err := dp.drivingConditionDAO.CreateDrivingCondition(context.TODO(), drivingCondition); err != nil {
-			dp.logger.Error(fmt.Sprintf("CreateEvent() for user %q returns err: %v", userID, err))
+		if _, err := dp.drivingConditionDAO.CreateDrivingCondition(ctx, drivingCondition); err != nil {
+			logError(fmt.Sprintf("CreateEvent() for user %q returns err: %v", userID, err))
 		}
 	}
 
@@ -158,38 +219,139 @@ func (dp *DataProcessor) Run(userID string) {
 	for _, rawVideoObj := range allUnprocessedData[RawVideoTypeString] {
 		rawVideo, ok := rawVideoObj.(*st.RawVideo)
 		if !ok {
-			dp.logger.Error(fmt.Sprintf("Found a %T in map entry for %s", rawVideoObj, RawVideoTypeString))
+			logError(fmt.Sprintf("Found a %T in map entry for %s", rawVideoObj, RawVideoTypeString))
 			continue
 		}
 		rawVideo.AlgosVersion = AlgosVersion
-		if err := dp.rawVideoDAO.PutRawVideoByID(context.TODO(), rawVideo.Id, rawVideo); err != nil {
-			dp.logger.Error(fmt.Sprintf("PutRawVideoByID(%s) returns err: %v", rawVideo.Id, err))
+		if err := dp.rawVideoDAO.PutRawVideoByID(ctx, rawVideo.Id, rawVideo); err != nil {
+			logError(fmt.Sprintf("PutRawVideoByID(%s) returns err: %v", rawVideo.Id, err))
 		}
 	}
 
 	for _, rawLocationObj := range allUnprocessedData[RawLocationTypeString] {
 		rawLocation, ok := rawLocationObj.(*st.RawLocation)
 		if !ok {
-			dp.logger.Error(fmt.Sprintf("Found a %T in map entry for %s", rawLocationObj, RawVideoTypeString))
+			logError(fmt.Sprintf("Found a %T in map entry for %s", rawLocationObj, RawVideoTypeString))
 			continue
 		}
 		rawLocation.AlgosVersion = AlgosVersion
-		if err := dp.rawLocationDAO.PutRawLocationByID(context.TODO(), rawLocation.Id, rawLocation); err != nil {
-			dp.logger.Error(fmt.Sprintf("PutRawVideoByID(%s) returns err: %v", rawLocation.Id, err))
+		if err := dp.rawLocationDAO.PutRawLocationByID(ctx, rawLocation.Id, rawLocation); err != nil {
+			logError(fmt.Sprintf("PutRawVideoByID(%s) returns err: %v", rawLocation.Id, err))
 		}
 	}
 
 	for _, rawMotionObj := range allUnprocessedData[RawMotionTypeString] {
 		rawMotion, ok := rawMotionObj.(*st.RawMotion)
 		if !ok {
-			dp.logger.Error(fmt.Sprintf("Found a %T in map entry for %s", rawMotionObj, RawVideoTypeString))
+			logError(fmt.Sprintf("Found a %T in map entry for %s", rawMotionObj, RawVideoTypeString))
 			continue
 		}
 		rawMotion.AlgosVersion = AlgosVersion
-		if err := dp.rawMotionDAO.PutRawMotionByID(context.TODO(), rawMotion.Id, rawMotion); err != nil {
-			dp.logger.Error(fmt.Sprintf("PutRawVideoByID(%s) returns err: %v", rawMotion.Id, err))
+		if err := dp.rawMotionDAO.PutRawMotionByID(ctx, rawMotion.Id, rawMotion); err != nil {
+			logError(fmt.Sprintf("PutRawVideoByID(%s) returns err: %v", rawMotion.Id, err))
+		}
+	}
+
+	// Vehicle logs have far more signals than videos have locations, so they're put in one multi write.
+	rawVehicleSignalIDs, rawVehicleSignals := []string{}, []*database.RawVehicleSignal{}
+	for _, rawVehicleSignalObj := range allUnprocessedData[RawVehicleSignalTypeString] {
+		rawVehicleSignal, ok := rawVehicleSignalObj.(*database.RawVehicleSignal)
+		if !ok {
+			logError(fmt.Sprintf("Found a %T in map entry for %s", rawVehicleSignalObj, RawVehicleSignalTypeString))
+			continue
+		}
+		rawVehicleSignal.AlgosVersion = AlgosVersion
+		rawVehicleSignalIDs = append(rawVehicleSignalIDs, rawVehicleSignal.Id)
+		rawVehicleSignals = append(rawVehicleSignals, rawVehicleSignal)
+	}
+	if len(rawVehicleSignals) > 0 {
+		if err := dp.rawVehicleSignalDAO.PutRawVehicleSignalsByIDs(ctx, rawVehicleSignalIDs, rawVehicleSignals); err != nil {
+			logError(fmt.Sprintf("PutRawVehicleSignalsByIDs() for %d rawVehicleSignals returns err: %v", len(rawVehicleSignals), err))
 		}
 	}
 
 	dp.logger.Log(fmt.Sprintf("Finished running dataprocessor on user with ID %q", userID))
+	if len(runErr.Errors) > 0 {
+		return runErr
+	}
+	return nil
+}
+
+// vehicleBrakingSignals gets the speeds and brakes the user's vehicles reported from vehicleBrakingMargin before the
+// first to vehicleBrakingMargin after the last of the rawMotions.
+func (dp *DataProcessor) vehicleBrakingSignals(userID string, rawMotionObjs []interface{}, logError func(message string)) []interface{} {
+	signals := []interface{}{}
+	var startMs, endMs int64
+	found := false
+	for _, rawMotionObj := range rawMotionObjs {
+		rawMotion, ok := rawMotionObj.(*st.RawMotion)
+		if !ok {
+			// It's logged when the RawMotions are marked processed.
+			continue
+		}
+		if !found || rawMotion.TimestampMs < startMs {
+			startMs = rawMotion.TimestampMs
+		}
+		if !found || rawMotion.TimestampMs > endMs {
+			endMs = rawMotion.TimestampMs
+		}
+		found = true
+	}
+	if !found {
+		return signals
+	}
+
+	start, end := util.MillisecondsToTime(startMs).Add(-vehicleBrakingMargin), util.MillisecondsToTime(endMs).Add(vehicleBrakingMargin)
+	ids, err := dp.rawVehicleSignalDAO.ListUserRawVehicleSignalIDsByTime(userID, start, end)
+	if err != nil {
+		logError(fmt.Sprintf("ListUserRawVehicleSignalIDsByTime(%s, %v, %v) returns err: %v", userID, start, end, err))
+		return signals
+	}
+	if len(ids) == 0 {
+		return signals
+	}
+	rawVehicleSignals, err := dp.rawVehicleSignalDAO.GetRawVehicleSignalsByIDs(ids)
+	if err != nil {
+		logError(fmt.Sprintf("GetRawVehicleSignalsByIDs() for %d vehicle signals returns err: %v", len(ids), err))
+		return signals
+	}
+	for _, rawVehicleSignal := range rawVehicleSignals {
+		switch vehiclelog.Signal(rawVehicleSignal.Signal) {
+		case vehiclelog.Speed, vehiclelog.Brake:
+			signals = append(signals, rawVehicleSignal)
+		}
+	}
+	return signals
+}
+
+// getAll gets the objects with the given IDs in one batch.  If the batch fails they're gotten one at a time, so one
+// missing or corrupt object doesn't keep the rest from being processed.
+func (dp *DataProcessor) getAll(ids []string, typeName string, getBatch func(ids []string) ([]interface{}, error), getOne func(id string) (interface{}, error), logError func(message string)) []interface{} {
+	objects, err := getBatch(ids)
+	if err == nil {
+		return objects
+	}
+	dp.logger.Warning(fmt.Sprintf("Get%ssByIDs(%v) returns err: %v, getting them one at a time", typeName, ids, err))
+
+	objects = []interface{}{}
+	for _, id := range ids {
+		object, err := getOne(id)
+		if err != nil {
+			logError(fmt.Sprintf("Get%sByID(%s) returns err: %v", typeName, id, err))
+			continue
+		}
+		objects = append(objects, object)
+	}
+	return objects
+}
+
+// 	RunError lists the failures of a Run.
+type RunError struct {
+	UserID string
+	// Errors are in the order they happened.
+	Errors []string
+}
+
+func (re *RunError) Error() string {
+	return fmt.Sprintf("%d failures running dataprocessor on user %q, the first: %s", len(re.Errors), re.UserID, re.Errors[0])
 }
@@ -1,8 +1,11 @@
 package dataprocessor_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	st "seneca/api/type"
+	"seneca/internal/client/database"
 	"seneca/internal/client/logging"
 	"seneca/internal/client/weather"
 	"seneca/internal/client/weather/service"
@@ -10,6 +13,7 @@ import (
 	"seneca/internal/dataprocessor"
 	"seneca/internal/dataprocessor/algorithms"
 	"seneca/internal/util"
+	"seneca/internal/util/vehiclelog"
 	"seneca/test/testutil"
 	"sort"
 	"testing"
@@ -68,7 +72,9 @@ func TestRunForRawMotions(t *testing.T) {
 		t.Fatalf("InsertUniqueRawVideo() returns err: %v", err)
 	}
 
-	dp.Run("123")
+	if err := dp.Run(context.Background(), "123"); err != nil {
+		t.Fatalf("Run() returns err: %v", err)
+	}
 
 	// Verify trip and events.
 	tripIDs, err := allDAOSet.TripDAO.ListUserTripIDs("123")
@@ -196,7 +202,9 @@ func TestRunForRawLocations(t *testing.T) {
 		t.Fatalf("InsertUniqueRawVideo() returns err: %v", err)
 	}
 
-	dp.Run("123")
+	if err := dp.Run(context.Background(), "123"); err != nil {
+		t.Fatalf("Run() returns err: %v", err)
+	}
 
 	tripIDs, err := allDAOSet.TripDAO.ListUserTripIDs("123")
 	if err != nil {
@@ -288,7 +296,260 @@ func TestRunForRawLocations(t *testing.T) {
 	}
 }
 
+func TestRunForRawVehicleSignals(t *testing.T) {
+	allDAOSet, logger := newDataProcessorPartsForTest()
+
+	algoFactory, err := algorithms.NewFactory(nil, nil)
+	if err != nil {
+		t.Fatalf("algorithms.NewFactory() returns err: %v", err)
+	}
+	algo, err := algoFactory.GetAlgorithm("00005")
+	if err != nil {
+		t.Fatalf("GetAlgorithm(%q) returns err: %v", "00005", err)
+	}
+	dp, err := dataprocessor.New([]dataprocessor.AlgorithmInterface{algo}, allDAOSet, logger)
+	if err != nil {
+		t.Fatalf("New() returns err: %v", err)
+	}
+
+	// A hard stop with the brake pressed, from 45 mph.
+	startTime := time.Date(2021, 05, 05, 0, 0, 0, 0, time.UTC)
+	rawVehicleSignals := []*database.RawVehicleSignal{}
+	for i, speed := range []float64{45, 45, 32, 18, 6, 0} {
+		rawVehicleSignals = append(rawVehicleSignals, &database.RawVehicleSignal{
+			UserId:      "123",
+			Signal:      vehiclelog.Speed.String(),
+			Value:       speed,
+			TimestampMs: util.TimeToMilliseconds(startTime.Add(time.Second * time.Duration(i))),
+		}, &database.RawVehicleSignal{
+			UserId:      "123",
+			Signal:      vehiclelog.Brake.String(),
+			Value:       100,
+			TimestampMs: util.TimeToMilliseconds(startTime.Add(time.Second * time.Duration(i))),
+		})
+	}
+	if _, err := allDAOSet.RawVehicleSignalDAO.InsertUniqueRawVehicleSignals(rawVehicleSignals); err != nil {
+		t.Fatalf("InsertUniqueRawVehicleSignals() returns err: %v", err)
+	}
+
+	if err := dp.Run(context.Background(), "123"); err != nil {
+		t.Fatalf("Run() returns err: %v", err)
+	}
+
+	tripIDs, err := allDAOSet.TripDAO.ListUserTripIDs("123")
+	if err != nil {
+		t.Fatalf("ListUserTripIDs() returns err: %v", err)
+	}
+	if len(tripIDs) != 1 {
+		t.Fatalf("Want 1 trip ID, got %d", len(tripIDs))
+	}
+	eventIDs, err := allDAOSet.EventDAO.ListTripEventIDs("123", tripIDs[0])
+	if err != nil {
+		t.Fatalf("ListTripEventIDs() returns err: %v", err)
+	}
+	if len(eventIDs) != 1 {
+		t.Fatalf("Want 1 event ID, got %d", len(eventIDs))
+	}
+	event, err := allDAOSet.EventDAO.GetEventByID("123", tripIDs[0], eventIDs[0])
+	if err != nil {
+		t.Fatalf("GetEventByID() returns err: %v", err)
+	}
+	if event.EventType != st.EventType_FAST_DECELERATION || event.Source.SourceType != database.RawVehicleSignalSourceType {
+		t.Fatalf("Want %q event from a RawVehicleSignal, got %v", st.EventType_FAST_DECELERATION, event)
+	}
+
+	unprocessedRawVehicleSignalIDs, err := allDAOSet.RawVehicleSignalDAO.ListUnprocessedRawVehicleSignalIDs("123", dataprocessor.AlgosVersion)
+	if err != nil {
+		t.Fatalf("ListUnprocessedRawVehicleSignalIDs() returns err: %v", err)
+	}
+	if len(unprocessedRawVehicleSignalIDs) != 0 {
+		t.Fatalf("Want 0 unprocessedRawVehicleSignalIDs, got %d", len(unprocessedRawVehicleSignalIDs))
+	}
+}
+
+func TestRunDefersGPSDecelerationsToVehicleSpeeds(t *testing.T) {
+	allDAOSet, logger := newDataProcessorPartsForTest()
+
+	algoFactory, err := algorithms.NewFactory(nil, nil)
+	if err != nil {
+		t.Fatalf("algorithms.NewFactory() returns err: %v", err)
+	}
+	algos := []dataprocessor.AlgorithmInterface{}
+	for _, tag := range []string{"00002", "00005"} {
+		algo, err := algoFactory.GetAlgorithm(tag)
+		if err != nil {
+			t.Fatalf("GetAlgorithm(%q) returns err: %v", tag, err)
+		}
+		algos = append(algos, algo)
+	}
+	dp, err := dataprocessor.New(algos, allDAOSet, logger)
+	if err != nil {
+		t.Fatalf("New() returns err: %v", err)
+	}
+
+	// The vehicle stopped hard twice, once without the brake pressed, e.g. a misread speed, and once with it. Its
+	// signals were processed before the dashcam's video was uploaded.
+	startTime := time.Date(2021, 05, 05, 0, 0, 0, 0, time.UTC)
+	unbrakedTime, brakedTime := startTime.Add(time.Second*2), startTime.Add(time.Minute*5+time.Second*2)
+	rawVehicleSignals := []*database.RawVehicleSignal{}
+	for stop, brake := range []float64{0, 100} {
+		stopTime := startTime.Add(time.Minute * 5 * time.Duration(stop))
+		for i, speed := range []float64{45, 45, 32, 18, 6, 0} {
+			timestampMs := util.TimeToMilliseconds(stopTime.Add(time.Second * time.Duration(i)))
+			rawVehicleSignals = append(rawVehicleSignals, &database.RawVehicleSignal{
+				UserId:       "123",
+				Signal:       vehiclelog.Speed.String(),
+				Value:        speed,
+				TimestampMs:  timestampMs,
+				AlgosVersion: dataprocessor.AlgosVersion,
+			}, &database.RawVehicleSignal{
+				UserId:       "123",
+				Signal:       vehiclelog.Brake.String(),
+				Value:        brake,
+				TimestampMs:  timestampMs,
+				AlgosVersion: dataprocessor.AlgosVersion,
+			})
+		}
+	}
+	if _, err := allDAOSet.RawVehicleSignalDAO.InsertUniqueRawVehicleSignals(rawVehicleSignals); err != nil {
+		t.Fatalf("InsertUniqueRawVehicleSignals() returns err: %v", err)
+	}
+
+	// Only the GPS deceleration during the braking the vehicle's speeds show isn't an event, the ones without vehicle
+	// speeds around them or during a stop without the brake pressed are.
+	uncoveredTime := startTime.Add(time.Minute * 10)
+	for _, timestamp := range []time.Time{unbrakedTime, brakedTime, uncoveredTime} {
+		if _, err := allDAOSet.RawMotionDAO.InsertUniqueRawMotion(&st.RawMotion{
+			UserId:      "123",
+			Motion:      &st.Motion{AccelerationMphS: -35},
+			TimestampMs: util.TimeToMilliseconds(timestamp),
+		}); err != nil {
+			t.Fatalf("InsertUniqueRawMotion() returns err: %v", err)
+		}
+	}
+
+	if err := dp.Run(context.Background(), "123"); err != nil {
+		t.Fatalf("Run() returns err: %v", err)
+	}
+
+	tripIDs, err := allDAOSet.TripDAO.ListUserTripIDs("123")
+	if err != nil {
+		t.Fatalf("ListUserTripIDs() returns err: %v", err)
+	}
+	events := []*st.EventInternal{}
+	for _, tripID := range tripIDs {
+		eventIDs, err := allDAOSet.EventDAO.ListTripEventIDs("123", tripID)
+		if err != nil {
+			t.Fatalf("ListTripEventIDs() returns err: %v", err)
+		}
+		tripEvents, err := allDAOSet.EventDAO.GetEventsByIDs("123", tripID, eventIDs)
+		if err != nil {
+			t.Fatalf("GetEventsByIDs() returns err: %v", err)
+		}
+		events = append(events, tripEvents...)
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].TimestampMs < events[j].TimestampMs })
+	if len(events) != 2 || events[0].TimestampMs != util.TimeToMilliseconds(unbrakedTime) || events[1].TimestampMs != util.TimeToMilliseconds(uncoveredTime) {
+		t.Fatalf("Want events at %v and %v, got %v", unbrakedTime, uncoveredTime, events)
+	}
+}
+
 func newDataProcessorPartsForTest() (*dao.AllDAOSet, logging.LoggingInterface) {
 	logger := logging.NewLocalLogger(false)
 	return testutil.GenerateAllDAOSetWithFakeDB(logger, 0), logger
 }
+
+type failingAlgorithm struct {
+	tag string
+}
+
+func (fa *failingAlgorithm) GenerateEvents(inputs map[string][]interface{}) ([]*st.EventInternal, error) {
+	return nil, fmt.Errorf("events failed")
+}
+
+func (fa *failingAlgorithm) GenerateDrivingConditions(inputs map[string][]interface{}) ([]*st.DrivingConditionInternal, error) {
+	return nil, fmt.Errorf("driving conditions failed")
+}
+
+func (fa *failingAlgorithm) Tag() string {
+	return fa.tag
+}
+
+func TestRunCollectsErrors(t *testing.T) {
+	allDAOSet, logger := newDataProcessorPartsForTest()
+	dp, err := dataprocessor.New([]dataprocessor.AlgorithmInterface{&failingAlgorithm{tag: "a"}, &failingAlgorithm{tag: "b"}}, allDAOSet, logger)
+	if err != nil {
+		t.Fatalf("New() returns err: %v", err)
+	}
+
+	err = dp.Run(context.Background(), "123")
+	var runErr *dataprocessor.RunError
+	if !errors.As(err, &runErr) {
+		t.Fatalf("Want RunError from Run(), got %v", err)
+	}
+	if runErr.UserID != "123" || len(runErr.Errors) != 4 {
+		t.Fatalf("Want the 4 failures of user 123, got %v", runErr)
+	}
+}
+
+// failingBatchRawMotionDAO fails every GetRawMotionsByIDs(), and GetRawMotionByID() for badID.
+type failingBatchRawMotionDAO struct {
+	dao.RawMotionDAO
+	badID string
+}
+
+func (f *failingBatchRawMotionDAO) GetRawMotionsByIDs(ids []string) ([]*st.RawMotion, error) {
+	return nil, fmt.Errorf("induced GetRawMotionsByIDs() failure")
+}
+
+func (f *failingBatchRawMotionDAO) GetRawMotionByID(id string) (*st.RawMotion, error) {
+	if id == f.badID {
+		return nil, fmt.Errorf("induced GetRawMotionByID() failure")
+	}
+	return f.RawMotionDAO.GetRawMotionByID(id)
+}
+
+func TestRunGetsEachRawWhenBatchFails(t *testing.T) {
+	allDAOSet, logger := newDataProcessorPartsForTest()
+	algoFactory, err := algorithms.NewFactory(nil, nil)
+	if err != nil {
+		t.Fatalf("algorithms.NewFactory() returns err: %v", err)
+	}
+	algo, err := algoFactory.GetAlgorithm("00000")
+	if err != nil {
+		t.Fatalf("GetAlgorithm() returns err: %v", err)
+	}
+
+	rawMotionIDs := []string{}
+	for _, second := range []int{1, 2, 3} {
+		rawMotion, err := allDAOSet.RawMotionDAO.InsertUniqueRawMotion(&st.RawMotion{
+			UserId:      "123",
+			Motion:      &st.Motion{AccelerationMphS: 20},
+			TimestampMs: util.TimeToMilliseconds(time.Date(2021, 05, 05, 0, 0, second, 0, time.UTC)),
+		})
+		if err != nil {
+			t.Fatalf("InsertUniqueRawMotion() returns err: %v", err)
+		}
+		rawMotionIDs = append(rawMotionIDs, rawMotion.Id)
+	}
+	allDAOSet.RawMotionDAO = &failingBatchRawMotionDAO{RawMotionDAO: allDAOSet.RawMotionDAO, badID: rawMotionIDs[0]}
+
+	dp, err := dataprocessor.New([]dataprocessor.AlgorithmInterface{algo}, allDAOSet, logger)
+	if err != nil {
+		t.Fatalf("New() returns err: %v", err)
+	}
+
+	// Only the raw motion that can't be gotten is a failure, the others are still processed.
+	err = dp.Run(context.Background(), "123")
+	var runErr *dataprocessor.RunError
+	if !errors.As(err, &runErr) || len(runErr.Errors) != 1 {
+		t.Fatalf("Want a RunError with the 1 failed get from Run(), got %v", err)
+	}
+	unprocessedRawMotionIDs, err := allDAOSet.RawMotionDAO.ListUnprocessedRawMotionIDs("123", dataprocessor.AlgosVersion)
+	if err != nil {
+		t.Fatalf("ListUnprocessedRawMotionIDs() returns err: %v", err)
+	}
+	if len(unprocessedRawMotionIDs) != 1 || unprocessedRawMotionIDs[0] != rawMotionIDs[0] {
+		t.Fatalf("Want only %q unprocessed, got %v", rawMotionIDs[0], unprocessedRawMotionIDs)
+	}
+}
@@ -0,0 +1,265 @@
+// Package jobqueue queues background work as jobs, which are dequeued and run by a Worker.  Jobs are retried with
+// exponential backoff when they fail, and dead-lettered once they run out of attempts.  A dequeued job is hidden
+// from other workers for a visibility timeout, which the Worker extends while the job runs, so that jobs of
+// workers that crashed are run again.
+package jobqueue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"seneca/api/senecaerror"
+	"seneca/internal/client/database"
+	"seneca/internal/util"
+	"time"
+)
+
+// The types of jobs.
+const (
+	// ProcessRawVideo jobs process one video a user uploaded to Google Drive.
+	ProcessRawVideo = "ProcessRawVideo"
+	// ProcessTelemetry jobs process one GPS log a user uploaded to Google Drive.
+	ProcessTelemetry = "ProcessTelemetry"
+	// RunAlgorithms jobs run the dataprocessor on a user, or enqueue a RunAlgorithms job for every user if
+	// they have no user.
+	RunAlgorithms = "RunAlgorithms"
+	// SyncUser jobs enqueue a ProcessRawVideo or ProcessTelemetry job for every new video or GPS log in a user's
+	// Google Drive, or enqueue a SyncUser job for every user if they have no user.
+	SyncUser = "SyncUser"
+)
+
+// The states of jobs.
+const (
+	// PendingState is the state of jobs waiting to be run, including jobs waiting to be retried.
+	PendingState = "pending"
+	// RunningState is the state of jobs that were dequeued.
+	RunningState   = "running"
+	SucceededState = "succeeded"
+	// DeadState is the state of jobs that failed on their last attempt, or failed with a UserError.
+	DeadState = "dead"
+)
+
+// MaxListLimit is the most jobs a page of Queue.List has.
+const MaxListLimit = 1000
+
+// 	Options configure the retries and retention of a Queue.
+type Options struct {
+	// MaxAttempts is how many times jobs that don't set their own MaxAttempts are attempted.
+	MaxAttempts int64
+	// MinBackoff is how long jobs wait before their first retry, it doubles with every attempt.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Retention is how long jobs are kept after they end, before Purge deletes them.  0 keeps them forever.
+	Retention time.Duration
+}
+
+// DefaultOptions retry jobs 4 times, over about 8 minutes, and keep them for 30 days after they end.
+func DefaultOptions() Options {
+	return Options{
+		MaxAttempts: 5,
+		MinBackoff:  time.Second * 30,
+		MaxBackoff:  time.Hour,
+		Retention:   time.Hour * 24 * 30,
+	}
+}
+
+// 	Queue stores jobs until they're run.  The jobs it returns are copies, so they can be modified freely.
+type Queue interface {
+	// Enqueue stores the job, as returned by NewJob, and returns it with its ID set.
+	Enqueue(ctx context.Context, job *database.Job) (*database.Job, error)
+	// Dequeue returns the job of the given types that's been waiting longest, and hides it for the visibility
+	// timeout.  It returns nil if there are none.
+	Dequeue(ctx context.Context, types []string, visibilityTimeout time.Duration) (*database.Job, error)
+	// Extend hides the dequeued job for the visibility timeout from now.
+	Extend(ctx context.Context, job *database.Job, visibilityTimeout time.Duration) error
+	// Complete marks the dequeued job succeeded with the result.
+	Complete(ctx context.Context, job *database.Job, result string) error
+	// Fail retries the dequeued job after a backoff, or dead-letters it.  The result of the failed attempt, e.g.
+	// which parts of it failed, is kept for reporting.
+	Fail(ctx context.Context, job *database.Job, result string, jobErr error) error
+	// FindPending returns a job of the same type, user and payload as job that's waiting for its first attempt, or
+	// nil if there's none.
+	FindPending(ctx context.Context, job *database.Job) (*database.Job, error)
+	// Get returns the job, or a NotFoundError.
+	Get(ctx context.Context, id string) (*database.Job, error)
+	// GetMulti returns the jobs in the same order as ids, with nil for the ones that don't exist, e.g. because
+	// they were purged.
+	GetMulti(ctx context.Context, ids []string) ([]*database.Job, error)
+	// List returns one page of at most limit of the user's jobs, oldest first, and the cursor of the next page,
+	// which is "" if there are no more.
+	List(ctx context.Context, userID, cursor string, limit int) ([]*database.Job, string, error)
+	// Purge deletes the jobs that ended longer than the Options' Retention ago, and returns how many it deleted.
+	Purge(ctx context.Context) (int, error)
+}
+
+//	NewJob creates a job to enqueue.
+//	Params:
+//		jobType string: e.g. ProcessRawVideo
+//		userID string: may be ""
+//		payload interface{}: encoded as JSON, may be nil
+//	Returns:
+//		*database.Job
+//		error
+func NewJob(jobType, userID string, payload interface{}) (*database.Job, error) {
+	job := &database.Job{Type: jobType, UserId: userID}
+	if payload != nil {
+		encoded, err := json.Marshal(payload)
+		if err != nil {
+			return nil, senecaerror.NewDevError(fmt.Errorf("error encoding payload of %s job: %w", jobType, err))
+		}
+		job.Payload = string(encoded)
+	}
+	return job, nil
+}
+
+// DecodePayload decodes the job's payload into v.
+func DecodePayload(job *database.Job, v interface{}) error {
+	if err := json.Unmarshal([]byte(job.Payload), v); err != nil {
+		return senecaerror.NewBadStateError(fmt.Errorf("error decoding payload of %s job %q: %w", job.Type, job.Id, err))
+	}
+	return nil
+}
+
+// 	ChildJobs is the result of jobs that enqueue other jobs.
+type ChildJobs struct {
+	JobIDs []string `json:"job_ids"`
+}
+
+//	EnqueueUnlessPending enqueues the job, unless a job of the same type, user and payload is waiting for its
+//	first attempt, in which case that job is returned.
+//	Params:
+//		ctx context.Context
+//		queue Queue
+//		job *database.Job: as returned by NewJob
+//	Returns:
+//		*database.Job
+//		error
+func EnqueueUnlessPending(ctx context.Context, queue Queue, job *database.Job) (*database.Job, error) {
+	pending, err := queue.FindPending(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+	if pending != nil {
+		return pending, nil
+	}
+	return queue.Enqueue(ctx, job)
+}
+
+// duplicates returns whether other is a job of the same type, user and payload as job that's waiting for its first
+// attempt.  Once a job started, it may have missed what the new one is for.
+func duplicates(other, job *database.Job) bool {
+	return other.Type == job.Type && other.UserId == job.UserId && other.Payload == job.Payload && other.State == PendingState && other.Attempts == 0
+}
+
+// expired returns whether the job ended longer than the retention ago.
+func (o Options) expired(job *database.Job, now time.Time) bool {
+	return o.Retention > 0 && job.EndTimeMs > 0 && job.EndTimeMs < util.TimeToMilliseconds(now.Add(-o.Retention))
+}
+
+// enqueued initializes a job as it's enqueued.
+func (o Options) enqueued(job *database.Job, now time.Time) {
+	job.State = PendingState
+	job.Attempts = 0
+	if job.MaxAttempts <= 0 {
+		job.MaxAttempts = o.MaxAttempts
+	}
+	job.CreateTimeMs = util.TimeToMilliseconds(now)
+	job.StartTimeMs = 0
+	job.EndTimeMs = 0
+	job.TimestampMs = job.CreateTimeMs
+	job.LastError = ""
+	job.Result = ""
+}
+
+// claimable returns whether the job can be dequeued now.
+func claimable(job *database.Job, types []string, now time.Time) bool {
+	if job.State != PendingState && job.State != RunningState {
+		return false
+	}
+	if job.TimestampMs > util.TimeToMilliseconds(now) {
+		return false
+	}
+	for _, jobType := range types {
+		if job.Type == jobType {
+			return true
+		}
+	}
+	return false
+}
+
+// claim starts the next attempt of a claimable job.  Running jobs are claimable once their visibility timeout
+// expired, and are dead-lettered instead if that was their last attempt, in which case claim returns false.
+func claim(job *database.Job, now time.Time, visibilityTimeout time.Duration) bool {
+	if job.State == RunningState {
+		job.LastError = fmt.Sprintf("visibility timeout expired on attempt %d", job.Attempts)
+		if job.Attempts >= job.MaxAttempts {
+			job.State = DeadState
+			job.EndTimeMs = util.TimeToMilliseconds(now)
+			job.TimestampMs = 0
+			return false
+		}
+	}
+	job.Attempts++
+	job.State = RunningState
+	if job.StartTimeMs == 0 {
+		job.StartTimeMs = util.TimeToMilliseconds(now)
+	}
+	job.TimestampMs = util.TimeToMilliseconds(now.Add(visibilityTimeout))
+	return true
+}
+
+// checkHeld returns a BadStateError unless the stored job is still running the attempt of the dequeued job.
+func checkHeld(stored, job *database.Job) error {
+	if stored == nil {
+		return senecaerror.NewBadStateError(fmt.Errorf("job %q was deleted", job.Id))
+	}
+	if stored.State != RunningState || stored.Attempts != job.Attempts {
+		return senecaerror.NewBadStateError(fmt.Errorf("attempt %d of job %q timed out", job.Attempts, job.Id))
+	}
+	return nil
+}
+
+func extend(job *database.Job, now time.Time, visibilityTimeout time.Duration) {
+	job.TimestampMs = util.TimeToMilliseconds(now.Add(visibilityTimeout))
+}
+
+func complete(job *database.Job, now time.Time, result string) {
+	job.State = SucceededState
+	job.EndTimeMs = util.TimeToMilliseconds(now)
+	job.TimestampMs = 0
+	job.Result = result
+}
+
+// IsLastAttempt returns whether the dequeued job is dead-lettered if its attempt fails with jobErr.  Jobs that fail
+// with a UserError are dead-lettered at once, since retrying them can't help.
+func IsLastAttempt(job *database.Job, jobErr error) bool {
+	var userErr *senecaerror.UserError
+	return job.Attempts >= job.MaxAttempts || errors.As(jobErr, &userErr)
+}
+
+// fail schedules the next attempt of the job, or dead-letters it.
+func (o Options) fail(job *database.Job, now time.Time, result string, jobErr error) {
+	job.LastError = jobErr.Error()
+	job.Result = result
+	if IsLastAttempt(job, jobErr) {
+		job.State = DeadState
+		job.EndTimeMs = util.TimeToMilliseconds(now)
+		job.TimestampMs = 0
+		return
+	}
+	job.State = PendingState
+	job.TimestampMs = util.TimeToMilliseconds(now.Add(o.backoff(job.Attempts)))
+}
+
+// backoff returns how long a job waits after its attempt failed.
+func (o Options) backoff(attempt int64) time.Duration {
+	backoff := o.MinBackoff
+	for i := int64(1); i < attempt && backoff < o.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > o.MaxBackoff {
+		return o.MaxBackoff
+	}
+	return backoff
+}
@@ -0,0 +1,356 @@
+package jobqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"seneca/api/constants"
+	"seneca/api/senecaerror"
+	"seneca/internal/client/database"
+	"seneca/internal/client/database/postgres"
+	"sync"
+	"testing"
+	"time"
+)
+
+// postgresDataSourceNameEnvVar points TestConcurrentDequeueAgainstPostgres at a real database, like the postgres
+// package's tests.
+const postgresDataSourceNameEnvVar = "SENECA_POSTGRES_DSN"
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (fc *fakeClock) Now() time.Time {
+	return fc.now
+}
+
+func testOptions() Options {
+	return Options{MaxAttempts: 3, MinBackoff: time.Minute, MaxBackoff: time.Minute * 3, Retention: time.Hour * 24}
+}
+
+// forEachQueue runs the test against each Queue implementation.
+func forEachQueue(t *testing.T, test func(t *testing.T, queue Queue, clock *fakeClock)) {
+	t.Run("memory", func(t *testing.T) {
+		clock := &fakeClock{now: time.Unix(1000, 0)}
+		queue := NewMemory(testOptions())
+		queue.now = clock.Now
+		test(t, queue, clock)
+	})
+	t.Run("sql", func(t *testing.T) {
+		clock := &fakeClock{now: time.Unix(1000, 0)}
+		queue := NewSQL(database.NewFake(), testOptions())
+		queue.now = clock.Now
+		test(t, queue, clock)
+	})
+}
+
+func enqueue(t *testing.T, queue Queue, jobType, userID string, payload interface{}) *database.Job {
+	job, err := NewJob(jobType, userID, payload)
+	if err != nil {
+		t.Fatalf("NewJob() returns err: %v", err)
+	}
+	job, err = queue.Enqueue(context.Background(), job)
+	if err != nil {
+		t.Fatalf("Enqueue() returns err: %v", err)
+	}
+	return job
+}
+
+func dequeue(t *testing.T, queue Queue, types ...string) *database.Job {
+	job, err := queue.Dequeue(context.Background(), types, time.Minute*10)
+	if err != nil {
+		t.Fatalf("Dequeue() returns err: %v", err)
+	}
+	return job
+}
+
+func TestEnqueueDequeue(t *testing.T) {
+	forEachQueue(t, func(t *testing.T, queue Queue, clock *fakeClock) {
+		first := enqueue(t, queue, SyncUser, "1", nil)
+		clock.now = clock.now.Add(time.Second)
+		second := enqueue(t, queue, ProcessRawVideo, "1", map[string]string{"file_id": "f"})
+		clock.now = clock.now.Add(time.Second)
+		third := enqueue(t, queue, SyncUser, "2", nil)
+
+		if job := dequeue(t, queue, RunAlgorithms); job != nil {
+			t.Fatalf("Want no RunAlgorithms job, got %v", job)
+		}
+		job := dequeue(t, queue, ProcessRawVideo, SyncUser)
+		if job == nil || job.Id != first.Id || job.State != RunningState || job.Attempts != 1 {
+			t.Fatalf("Want the oldest job running, got %v", job)
+		}
+		job = dequeue(t, queue, ProcessRawVideo)
+		if job == nil || job.Id != second.Id {
+			t.Fatalf("Want the ProcessRawVideo job, got %v", job)
+		}
+		payload := map[string]string{}
+		if err := DecodePayload(job, &payload); err != nil || payload["file_id"] != "f" {
+			t.Fatalf("DecodePayload() returns %v, %v", payload, err)
+		}
+		if err := queue.Complete(context.Background(), job, "done"); err != nil {
+			t.Fatalf("Complete() returns err: %v", err)
+		}
+		if job := dequeue(t, queue, ProcessRawVideo, SyncUser); job == nil || job.Id != third.Id {
+			t.Fatalf("Want the last job, got %v", job)
+		}
+		if job := dequeue(t, queue, ProcessRawVideo, SyncUser); job != nil {
+			t.Fatalf("Want no jobs left, got %v", job)
+		}
+
+		stored, err := queue.Get(context.Background(), second.Id)
+		if err != nil {
+			t.Fatalf("Get() returns err: %v", err)
+		}
+		if stored.State != SucceededState || stored.Result != "done" || stored.EndTimeMs == 0 {
+			t.Fatalf("Want the job succeeded, got %v", stored)
+		}
+		var nfe *senecaerror.NotFoundError
+		if _, err := queue.Get(context.Background(), "404"); !errors.As(err, &nfe) {
+			t.Fatalf("Want NotFoundError from Get() of a missing job, got %v", err)
+		}
+
+		jobs, cursor, err := queue.List(context.Background(), "1", "", MaxListLimit)
+		if err != nil || cursor != "" {
+			t.Fatalf("List() returns %q, %v", cursor, err)
+		}
+		if len(jobs) != 2 || jobs[0].Id != first.Id || jobs[1].Id != second.Id {
+			t.Fatalf("Want user 1's 2 jobs, got %v", jobs)
+		}
+	})
+}
+
+func TestRetryAndDeadLetter(t *testing.T) {
+	forEachQueue(t, func(t *testing.T, queue Queue, clock *fakeClock) {
+		enqueue(t, queue, SyncUser, "1", nil)
+
+		wantBackoffs := []time.Duration{time.Minute, time.Minute * 2}
+		for attempt := 1; attempt <= 3; attempt++ {
+			job := dequeue(t, queue, SyncUser)
+			if job == nil || job.Attempts != int64(attempt) {
+				t.Fatalf("Want attempt %d, got %v", attempt, job)
+			}
+			if err := queue.Fail(context.Background(), job, "", fmt.Errorf("failure %d", attempt)); err != nil {
+				t.Fatalf("Fail() returns err: %v", err)
+			}
+			if attempt == 3 {
+				break
+			}
+			// The job isn't retried until its backoff ends.
+			clock.now = clock.now.Add(wantBackoffs[attempt-1] - time.Second)
+			if job := dequeue(t, queue, SyncUser); job != nil {
+				t.Fatalf("Want no job during the backoff, got %v", job)
+			}
+			clock.now = clock.now.Add(time.Second)
+		}
+
+		clock.now = clock.now.Add(time.Hour)
+		if job := dequeue(t, queue, SyncUser); job != nil {
+			t.Fatalf("Want the job dead-lettered, got %v", job)
+		}
+		jobs, cursor, err := queue.List(context.Background(), "1", "", MaxListLimit)
+		if err != nil || cursor != "" {
+			t.Fatalf("List() returns %q, %v", cursor, err)
+		}
+		if len(jobs) != 1 || jobs[0].State != DeadState || jobs[0].LastError != "failure 3" {
+			t.Fatalf("Want the dead job with its last error, got %v", jobs)
+		}
+
+		// UserErrors aren't retried.
+		enqueue(t, queue, SyncUser, "2", nil)
+		job := dequeue(t, queue, SyncUser)
+		if err := queue.Fail(context.Background(), job, "", senecaerror.NewUserError("2", errors.New("bad video"), "Bad video.")); err != nil {
+			t.Fatalf("Fail() returns err: %v", err)
+		}
+		if stored, err := queue.Get(context.Background(), job.Id); err != nil || stored.State != DeadState {
+			t.Fatalf("Want the job dead-lettered, got %v, %v", stored, err)
+		}
+	})
+}
+
+func TestVisibilityTimeout(t *testing.T) {
+	forEachQueue(t, func(t *testing.T, queue Queue, clock *fakeClock) {
+		enqueue(t, queue, RunAlgorithms, "1", nil)
+		first := dequeue(t, queue, RunAlgorithms)
+
+		clock.now = clock.now.Add(time.Minute * 5)
+		if err := queue.Extend(context.Background(), first, time.Minute*10); err != nil {
+			t.Fatalf("Extend() returns err: %v", err)
+		}
+		clock.now = clock.now.Add(time.Minute * 9)
+		if job := dequeue(t, queue, RunAlgorithms); job != nil {
+			t.Fatalf("Want the extended job hidden, got %v", job)
+		}
+
+		// The first attempt's worker is presumed dead once the timeout expires.
+		clock.now = clock.now.Add(time.Minute)
+		second := dequeue(t, queue, RunAlgorithms)
+		if second == nil || second.Attempts != 2 {
+			t.Fatalf("Want the job's second attempt, got %v", second)
+		}
+		var bse *senecaerror.BadStateError
+		if err := queue.Complete(context.Background(), first, ""); !errors.As(err, &bse) {
+			t.Fatalf("Want BadStateError from Complete() of a timed out attempt, got %v", err)
+		}
+
+		// Attempts that time out count, and the last one is dead-lettered.
+		clock.now = clock.now.Add(time.Minute * 10)
+		if job := dequeue(t, queue, RunAlgorithms); job == nil || job.Attempts != 3 {
+			t.Fatalf("Want the job's third attempt, got %v", job)
+		}
+		clock.now = clock.now.Add(time.Minute * 10)
+		if job := dequeue(t, queue, RunAlgorithms); job != nil {
+			t.Fatalf("Want the job dead-lettered, got %v", job)
+		}
+		stored, err := queue.Get(context.Background(), second.Id)
+		if err != nil || stored.State != DeadState || stored.LastError == "" {
+			t.Fatalf("Want the job dead-lettered with an error, got %v, %v", stored, err)
+		}
+	})
+}
+
+func TestEnqueueUnlessPending(t *testing.T) {
+	forEachQueue(t, func(t *testing.T, queue Queue, clock *fakeClock) {
+		job, _ := NewJob(RunAlgorithms, "1", nil)
+		first, err := EnqueueUnlessPending(context.Background(), queue, job)
+		if err != nil {
+			t.Fatalf("EnqueueUnlessPending() returns err: %v", err)
+		}
+		if again, err := EnqueueUnlessPending(context.Background(), queue, job); err != nil || again.Id != first.Id {
+			t.Fatalf("Want the pending job returned, got %v, %v", again, err)
+		}
+		// Jobs of other users or with other payloads aren't the same job.
+		for _, other := range []*database.Job{
+			{Type: RunAlgorithms, UserId: "2"},
+			{Type: RunAlgorithms, UserId: "1", Payload: `{"file_id":"a"}`},
+		} {
+			if again, err := EnqueueUnlessPending(context.Background(), queue, other); err != nil || again.Id == first.Id {
+				t.Fatalf("Want a new job enqueued for %v, got %v, %v", other, again, err)
+			}
+		}
+
+		// Once the job started, it may have missed the new data, so another one is enqueued.
+		dequeue(t, queue, RunAlgorithms)
+		if again, err := EnqueueUnlessPending(context.Background(), queue, job); err != nil || again.Id == first.Id {
+			t.Fatalf("Want a new job enqueued, got %v, %v", again, err)
+		}
+	})
+}
+
+func TestListPages(t *testing.T) {
+	forEachQueue(t, func(t *testing.T, queue Queue, clock *fakeClock) {
+		ids := []string{}
+		for i := 0; i < 3; i++ {
+			ids = append(ids, enqueue(t, queue, SyncUser, "1", i).Id)
+			clock.now = clock.now.Add(time.Second)
+		}
+		enqueue(t, queue, SyncUser, "2", nil)
+
+		listed := []string{}
+		cursor := ""
+		for page := 0; page < 2; page++ {
+			jobs, nextCursor, err := queue.List(context.Background(), "1", cursor, 2)
+			if err != nil {
+				t.Fatalf("List() returns err: %v", err)
+			}
+			for _, job := range jobs {
+				listed = append(listed, job.Id)
+			}
+			if cursor = nextCursor; cursor == "" {
+				break
+			}
+		}
+		if cursor != "" || fmt.Sprint(listed) != fmt.Sprint(ids) {
+			t.Fatalf("Want user 1's jobs %v over 2 pages, got %v with cursor %q", ids, listed, cursor)
+		}
+	})
+}
+
+func TestPurge(t *testing.T) {
+	forEachQueue(t, func(t *testing.T, queue Queue, clock *fakeClock) {
+		ctx := context.Background()
+		enqueue(t, queue, SyncUser, "1", nil)
+		ended := dequeue(t, queue, SyncUser)
+		if err := queue.Complete(ctx, ended, ""); err != nil {
+			t.Fatalf("Complete() returns err: %v", err)
+		}
+		pending := enqueue(t, queue, SyncUser, "1", nil)
+
+		// Jobs are kept for the retention after they end.
+		clock.now = clock.now.Add(testOptions().Retention)
+		if purged, err := queue.Purge(ctx); err != nil || purged != 0 {
+			t.Fatalf("Want no jobs purged within the retention, got %d, %v", purged, err)
+		}
+		clock.now = clock.now.Add(time.Second)
+		if purged, err := queue.Purge(ctx); err != nil || purged != 1 {
+			t.Fatalf("Want the ended job purged, got %d, %v", purged, err)
+		}
+
+		jobs, err := queue.GetMulti(ctx, []string{ended.Id, pending.Id})
+		if err != nil {
+			t.Fatalf("GetMulti() returns err: %v", err)
+		}
+		if len(jobs) != 2 || jobs[0] != nil || jobs[1] == nil || jobs[1].Id != pending.Id {
+			t.Fatalf("Want only the pending job left, got %v", jobs)
+		}
+	})
+}
+
+func TestConcurrentDequeueAgainstPostgres(t *testing.T) {
+	dataSourceName := os.Getenv(postgresDataSourceNameEnvVar)
+	if dataSourceName == "" {
+		t.Skipf("%s not set", postgresDataSourceNameEnvVar)
+	}
+
+	service, err := postgres.New(context.Background(), dataSourceName)
+	if err != nil {
+		t.Fatalf("New() returns err: %v", err)
+	}
+	defer service.Close()
+
+	queue := NewSQL(service, testOptions())
+	// The type is unique, so jobs left in the database by other tests aren't dequeued.
+	jobType := fmt.Sprintf("test%d", time.Now().UnixNano())
+	jobs := 5
+	for i := 0; i < jobs; i++ {
+		job := enqueue(t, queue, jobType, "1", nil)
+		defer service.DeleteByID(constants.JobsTable, job.Id)
+	}
+
+	workers := 10
+	claimed := make(chan string, jobs*workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				job, err := queue.Dequeue(context.Background(), []string{jobType}, time.Minute*10)
+				if err != nil {
+					t.Errorf("Dequeue() returns err: %v", err)
+					return
+				}
+				if job == nil {
+					return
+				}
+				claimed <- job.Id
+			}
+		}()
+	}
+	wg.Wait()
+	close(claimed)
+
+	claims := map[string]int{}
+	for id := range claimed {
+		claims[id]++
+	}
+	if len(claims) != jobs {
+		t.Fatalf("Want %d jobs dequeued, got %v", jobs, claims)
+	}
+	for id, count := range claims {
+		if count != 1 {
+			t.Fatalf("Want job %q dequeued once, got %d times", id, count)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package jobqueue
+
+import (
+	"context"
+	"fmt"
+	"seneca/api/senecaerror"
+	"seneca/internal/client/database"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 	MemoryQueue keeps jobs in memory, so they're lost when the process exits.  It's meant for tests and local
+// 	development, SQLQueue is durable.
+type MemoryQueue struct {
+	mu      sync.Mutex
+	jobs    map[string]*database.Job
+	nextID  int
+	options Options
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+//	NewMemory creates a MemoryQueue.
+//	Params:
+//		options Options
+//	Returns:
+//		*MemoryQueue
+func NewMemory(options Options) *MemoryQueue {
+	return &MemoryQueue{
+		jobs:    map[string]*database.Job{},
+		nextID:  1,
+		options: options,
+		now:     time.Now,
+	}
+}
+
+func (mq *MemoryQueue) Enqueue(ctx context.Context, job *database.Job) (*database.Job, error) {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+	stored := *job
+	stored.Id = strconv.Itoa(mq.nextID)
+	mq.nextID++
+	mq.options.enqueued(&stored, mq.now())
+	mq.jobs[stored.Id] = &stored
+	out := stored
+	return &out, nil
+}
+
+func (mq *MemoryQueue) Dequeue(ctx context.Context, types []string, visibilityTimeout time.Duration) (*database.Job, error) {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+	now := mq.now()
+	candidates := []*database.Job{}
+	for _, job := range mq.jobs {
+		if claimable(job, types, now) {
+			candidates = append(candidates, job)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].TimestampMs != candidates[j].TimestampMs {
+			return candidates[i].TimestampMs < candidates[j].TimestampMs
+		}
+		return lessID(candidates[i].Id, candidates[j].Id)
+	})
+	for _, job := range candidates {
+		if claim(job, now, visibilityTimeout) {
+			out := *job
+			return &out, nil
+		}
+	}
+	return nil, nil
+}
+
+func (mq *MemoryQueue) Extend(ctx context.Context, job *database.Job, visibilityTimeout time.Duration) error {
+	return mq.update(job, func(stored *database.Job, now time.Time) {
+		extend(stored, now, visibilityTimeout)
+	})
+}
+
+func (mq *MemoryQueue) Complete(ctx context.Context, job *database.Job, result string) error {
+	return mq.update(job, func(stored *database.Job, now time.Time) {
+		complete(stored, now, result)
+	})
+}
+
+func (mq *MemoryQueue) Fail(ctx context.Context, job *database.Job, result string, jobErr error) error {
+	return mq.update(job, func(stored *database.Job, now time.Time) {
+		mq.options.fail(stored, now, result, jobErr)
+	})
+}
+
+func (mq *MemoryQueue) FindPending(ctx context.Context, job *database.Job) (*database.Job, error) {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+	jobs := []*database.Job{}
+	for _, stored := range mq.jobs {
+		if duplicates(stored, job) {
+			jobs = append(jobs, stored)
+		}
+	}
+	if len(jobs) == 0 {
+		return nil, nil
+	}
+	sortJobs(jobs)
+	out := *jobs[0]
+	return &out, nil
+}
+
+func (mq *MemoryQueue) Get(ctx context.Context, id string) (*database.Job, error) {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+	stored, ok := mq.jobs[id]
+	if !ok {
+		return nil, senecaerror.NewNotFoundError(fmt.Errorf("job %q not found", id))
+	}
+	out := *stored
+	return &out, nil
+}
+
+func (mq *MemoryQueue) GetMulti(ctx context.Context, ids []string) ([]*database.Job, error) {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+	jobs := make([]*database.Job, len(ids))
+	for i, id := range ids {
+		if stored, ok := mq.jobs[id]; ok {
+			out := *stored
+			jobs[i] = &out
+		}
+	}
+	return jobs, nil
+}
+
+// List pages by offset, so jobs purged between pages shift the later ones back.
+func (mq *MemoryQueue) List(ctx context.Context, userID, cursor string, limit int) ([]*database.Job, string, error) {
+	offset, err := database.DecodeOffsetCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+	jobs := []*database.Job{}
+	for _, stored := range mq.jobs {
+		if stored.UserId == userID {
+			out := *stored
+			jobs = append(jobs, &out)
+		}
+	}
+	sortJobs(jobs)
+
+	if offset >= len(jobs) {
+		return []*database.Job{}, "", nil
+	}
+	if offset+limit >= len(jobs) {
+		return jobs[offset:], "", nil
+	}
+	return jobs[offset : offset+limit], database.EncodeOffsetCursor(offset + limit), nil
+}
+
+func (mq *MemoryQueue) Purge(ctx context.Context) (int, error) {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+	now := mq.now()
+	purged := 0
+	for id, stored := range mq.jobs {
+		if mq.options.expired(stored, now) {
+			delete(mq.jobs, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// update applies f to the stored job, if the dequeued job's attempt still holds it.
+func (mq *MemoryQueue) update(job *database.Job, f func(stored *database.Job, now time.Time)) error {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+	stored := mq.jobs[job.Id]
+	if err := checkHeld(stored, job); err != nil {
+		return err
+	}
+	f(stored, mq.now())
+	return nil
+}
+
+// sortJobs sorts jobs oldest first.
+func sortJobs(jobs []*database.Job) {
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].CreateTimeMs != jobs[j].CreateTimeMs {
+			return jobs[i].CreateTimeMs < jobs[j].CreateTimeMs
+		}
+		return lessID(jobs[i].Id, jobs[j].Id)
+	})
+}
+
+// lessID orders numeric IDs by value, and other IDs lexically.
+func lessID(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
@@ -0,0 +1,303 @@
+package jobqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"seneca/api/constants"
+	"seneca/api/senecaerror"
+	"seneca/internal/client/database"
+	"seneca/internal/util"
+	"time"
+)
+
+const (
+	// dequeuePageSize is how many jobs Dequeue considers at a time.
+	dequeuePageSize = 100
+	// purgePageSize is how many jobs Purge deletes per transaction.
+	purgePageSize = 250
+	// pendingPageSize is how many of a user's due jobs FindPending considers at a time.
+	pendingPageSize = 100
+)
+
+// 	SQLQueue stores jobs in constants.JobsTable, so they survive restarts and are shared by every process using
+// 	the database.  Jobs are claimed in transactions, so each attempt is run by one Worker.  This relies on the
+// 	database's transactions failing or retrying when they conflict, as Datastore's, bbolt's and the postgres
+// 	package's do.
+type SQLQueue struct {
+	sql     database.SQLInterface
+	options Options
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+//	NewSQL creates an SQLQueue.
+//	Params:
+//		sqlInterface database.SQLInterface: where the jobs are stored
+//		options Options
+//	Returns:
+//		*SQLQueue
+func NewSQL(sqlInterface database.SQLInterface, options Options) *SQLQueue {
+	return &SQLQueue{
+		sql:     sqlInterface,
+		options: options,
+		now:     time.Now,
+	}
+}
+
+func (sq *SQLQueue) Enqueue(ctx context.Context, job *database.Job) (*database.Job, error) {
+	stored := *job
+	sq.options.enqueued(&stored, sq.now())
+	id, err := sq.sql.Create(constants.JobsTable, &stored)
+	if err != nil {
+		return nil, fmt.Errorf("error creating %s job: %w", stored.Type, err)
+	}
+	stored.Id = id
+	if err := sq.sql.Insert(constants.JobsTable, id, &stored); err != nil {
+		return nil, fmt.Errorf("error updating job %q: %w", id, err)
+	}
+	out := stored
+	return &out, nil
+}
+
+// Dequeue pages through the jobs that are due, oldest first, and claims the first one of the given types that no
+// other Worker claimed in the meantime.  The job is read and claimed in one transaction, which conflicts with any
+// other transaction claiming it, e.g. a serializable one on postgres, so only one Worker gets each attempt.
+func (sq *SQLQueue) Dequeue(ctx context.Context, types []string, visibilityTimeout time.Duration) (*database.Job, error) {
+	now := sq.now()
+	// Ended jobs have a TimestampMs of 0, so they're never listed.
+	query := database.NewQuery(constants.JobsTable).
+		Range(constants.TimestampFieldName, int64(1), util.TimeToMilliseconds(now)+1).
+		OrderBy(constants.TimestampFieldName).
+		WithLimit(dequeuePageSize)
+	for {
+		ids, cursor, err := sq.sql.ListIDsByQuery(query)
+		if err != nil {
+			return nil, fmt.Errorf("error listing due jobs: %w", err)
+		}
+		for _, id := range ids {
+			job, err := getJob(sq.sql, id)
+			if err != nil {
+				return nil, err
+			}
+			if job == nil || !claimable(job, types, now) {
+				continue
+			}
+
+			var claimed *database.Job
+			err = sq.sql.RunInTransaction(ctx, func(tx database.SQLInterface) error {
+				claimed = nil
+				job, err := getJob(tx, id)
+				if err != nil || job == nil || !claimable(job, types, now) {
+					return err
+				}
+				ok := claim(job, now, visibilityTimeout)
+				if err := tx.Insert(constants.JobsTable, id, job); err != nil {
+					return fmt.Errorf("error updating job %q: %w", id, err)
+				}
+				if ok {
+					claimed = job
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			if claimed != nil {
+				return claimed, nil
+			}
+		}
+		if cursor == "" || len(ids) == 0 {
+			return nil, nil
+		}
+		query = query.WithCursor(cursor)
+	}
+}
+
+func (sq *SQLQueue) Extend(ctx context.Context, job *database.Job, visibilityTimeout time.Duration) error {
+	return sq.update(ctx, job, func(stored *database.Job, now time.Time) {
+		extend(stored, now, visibilityTimeout)
+	})
+}
+
+func (sq *SQLQueue) Complete(ctx context.Context, job *database.Job, result string) error {
+	return sq.update(ctx, job, func(stored *database.Job, now time.Time) {
+		complete(stored, now, result)
+	})
+}
+
+func (sq *SQLQueue) Fail(ctx context.Context, job *database.Job, result string, jobErr error) error {
+	return sq.update(ctx, job, func(stored *database.Job, now time.Time) {
+		sq.options.fail(stored, now, result, jobErr)
+	})
+}
+
+// FindPending only looks at the user's due jobs, since a job waiting for its first attempt is due from when it was
+// enqueued.  The jobs that ended, usually most of them, have a TimestampMs of 0, so they're never listed.
+func (sq *SQLQueue) FindPending(ctx context.Context, job *database.Job) (*database.Job, error) {
+	query := database.NewQuery(constants.JobsTable).
+		Where(constants.UserIDFieldName, "=", job.UserId).
+		Range(constants.TimestampFieldName, int64(1), util.TimeToMilliseconds(sq.now())+1).
+		WithLimit(pendingPageSize)
+	for {
+		ids, cursor, err := sq.sql.ListIDsByQuery(query)
+		if err != nil {
+			return nil, fmt.Errorf("error listing due jobs of user %q: %w", job.UserId, err)
+		}
+		jobs, err := sq.GetMulti(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		for _, other := range jobs {
+			if other != nil && duplicates(other, job) {
+				return other, nil
+			}
+		}
+		if cursor == "" || len(ids) == 0 {
+			return nil, nil
+		}
+		query = query.WithCursor(cursor)
+	}
+}
+
+func (sq *SQLQueue) Get(ctx context.Context, id string) (*database.Job, error) {
+	job, err := getJob(sq.sql, id)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		return nil, senecaerror.NewNotFoundError(fmt.Errorf("job %q not found", id))
+	}
+	return job, nil
+}
+
+func (sq *SQLQueue) GetMulti(ctx context.Context, ids []string) ([]*database.Job, error) {
+	objects, err := database.GetExisting(sq.sql, constants.JobsTable, ids)
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]*database.Job, len(ids))
+	for i, object := range objects {
+		stored, ok := object.(*database.Job)
+		if !ok || stored == nil {
+			continue
+		}
+		job := *stored
+		job.Id = ids[i]
+		jobs[i] = &job
+	}
+	return jobs, nil
+}
+
+func (sq *SQLQueue) List(ctx context.Context, userID, cursor string, limit int) ([]*database.Job, string, error) {
+	query := database.NewQuery(constants.JobsTable).
+		Where(constants.UserIDFieldName, "=", userID).
+		OrderBy(constants.CreateTimeFieldName).
+		WithLimit(limit).
+		WithCursor(cursor)
+	ids, nextCursor, err := sq.sql.ListIDsByQuery(query)
+	if err != nil {
+		return nil, "", fmt.Errorf("error listing jobs of user %q: %w", userID, err)
+	}
+	stored, err := sq.GetMulti(ctx, ids)
+	if err != nil {
+		return nil, "", err
+	}
+	// Jobs purged since they were listed are left out.
+	jobs := []*database.Job{}
+	for _, job := range stored {
+		if job != nil {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nextCursor, nil
+}
+
+// Purge deletes a page of expired jobs at a time, each in a transaction, so that Queues purging at the same time
+// don't fail on jobs the other deleted.
+func (sq *SQLQueue) Purge(ctx context.Context) (int, error) {
+	if sq.options.Retention <= 0 {
+		return 0, nil
+	}
+
+	purged := 0
+	for {
+		now := sq.now()
+		// Jobs that haven't ended have an EndTimeMs of 0, so they're never listed.
+		query := database.NewQuery(constants.JobsTable).
+			Range(constants.EndTimeFieldName, int64(1), util.TimeToMilliseconds(now.Add(-sq.options.Retention))).
+			WithLimit(purgePageSize)
+		ids, _, err := sq.sql.ListIDsByQuery(query)
+		if err != nil {
+			return purged, fmt.Errorf("error listing expired jobs: %w", err)
+		}
+		if len(ids) == 0 {
+			return purged, nil
+		}
+
+		deleted := 0
+		err = sq.sql.RunInTransaction(ctx, func(tx database.SQLInterface) error {
+			deleted = 0
+			objects, err := database.GetExisting(tx, constants.JobsTable, ids)
+			if err != nil {
+				return err
+			}
+			expiredIDs := []string{}
+			for i, object := range objects {
+				if job, ok := object.(*database.Job); ok && job != nil && sq.options.expired(job, now) {
+					expiredIDs = append(expiredIDs, ids[i])
+				}
+			}
+			if len(expiredIDs) == 0 {
+				return nil
+			}
+			if err := tx.DeleteMulti(constants.JobsTable, expiredIDs); err != nil {
+				return fmt.Errorf("error deleting %d expired jobs: %w", len(expiredIDs), err)
+			}
+			deleted = len(expiredIDs)
+			return nil
+		})
+		if err != nil {
+			return purged, err
+		}
+		purged += deleted
+		// Another Queue purged the page, or it's the last one.
+		if deleted == 0 || len(ids) < purgePageSize {
+			return purged, nil
+		}
+	}
+}
+
+// update applies f to the stored job in a transaction, if the dequeued job's attempt still holds it.
+func (sq *SQLQueue) update(ctx context.Context, job *database.Job, f func(stored *database.Job, now time.Time)) error {
+	return sq.sql.RunInTransaction(ctx, func(tx database.SQLInterface) error {
+		stored, err := getJob(tx, job.Id)
+		if err != nil {
+			return err
+		}
+		if err := checkHeld(stored, job); err != nil {
+			return err
+		}
+		f(stored, sq.now())
+		if err := tx.Insert(constants.JobsTable, stored.Id, stored); err != nil {
+			return fmt.Errorf("error updating job %q: %w", stored.Id, err)
+		}
+		return nil
+	})
+}
+
+// getJob gets a copy of the job with its Id set, or nil if it doesn't exist.
+func getJob(sql database.SQLInterface, id string) (*database.Job, error) {
+	object, err := sql.GetByID(constants.JobsTable, id)
+	var nfe *senecaerror.NotFoundError
+	if err != nil && !errors.As(err, &nfe) {
+		return nil, fmt.Errorf("error getting job %q: %w", id, err)
+	}
+	stored, ok := object.(*database.Job)
+	if !ok || stored == nil {
+		return nil, nil
+	}
+	job := *stored
+	job.Id = id
+	return &job, nil
+}
@@ -0,0 +1,190 @@
+package jobqueue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"seneca/api/senecaerror"
+	"seneca/internal/client/database"
+	"seneca/internal/util"
+	"time"
+)
+
+const (
+	// maxStatusDepth is how many levels of child jobs GetStatus includes, e.g. the per-user and then per-file jobs
+	// of a SyncUser job for all users.
+	maxStatusDepth = 2
+	// maxStatusChildren is how many children of a job GetStatus includes, they're all counted in ChildStates.
+	// It's also how many children are gotten at a time.
+	maxStatusChildren = 100
+)
+
+// 	Status is how a job is reported by the /jobs endpoints.
+type Status struct {
+	ID          string `json:"id"`
+	Type        string `json:"type"`
+	UserID      string `json:"user_id,omitempty"`
+	State       string `json:"state"`
+	Attempts    int64  `json:"attempts"`
+	MaxAttempts int64  `json:"max_attempts"`
+	// Done is whether the job and all its children ended, so there's nothing left to poll for.
+	Done       bool       `json:"done"`
+	CreateTime time.Time  `json:"create_time"`
+	StartTime  *time.Time `json:"start_time,omitempty"`
+	EndTime    *time.Time `json:"end_time,omitempty"`
+	// NextAttemptTime is when a job waiting for a retry is run again.
+	NextAttemptTime *time.Time `json:"next_attempt_time,omitempty"`
+	Error           string     `json:"error,omitempty"`
+	// Payload and Result are the job's JSON, e.g. the file a ProcessRawVideo job processes and the raw video it
+	// created, or the errors the dataprocessor collected for a RunAlgorithms job.
+	Payload json.RawMessage `json:"payload,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	// ChildStates counts the children by state.
+	ChildStates map[string]int `json:"child_states,omitempty"`
+	// Children are the first maxStatusChildren children.
+	Children []*Status `json:"children,omitempty"`
+}
+
+// 	EnqueueResponse is the response of the endpoints that enqueue a job, e.g. POST /syncer.
+type EnqueueResponse struct {
+	JobID string `json:"job_id"`
+}
+
+// 	ListResponse is the response of GET /jobs.
+type ListResponse struct {
+	Jobs       []*Status `json:"jobs"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+//	NewStatus reports the job, without its children.
+//	Params:
+//		job *database.Job
+//	Returns:
+//		*Status
+func NewStatus(job *database.Job) *Status {
+	status := &Status{
+		ID:          job.Id,
+		Type:        job.Type,
+		UserID:      job.UserId,
+		State:       job.State,
+		Attempts:    job.Attempts,
+		MaxAttempts: job.MaxAttempts,
+		Done:        ended(job),
+		CreateTime:  util.MillisecondsToTime(job.CreateTimeMs),
+		StartTime:   optionalTime(job.StartTimeMs),
+		EndTime:     optionalTime(job.EndTimeMs),
+		Error:       job.LastError,
+		Payload:     rawJSON(job.Payload),
+		Result:      rawJSON(job.Result),
+	}
+	if job.State == PendingState && job.Attempts > 0 {
+		status.NextAttemptTime = optionalTime(job.TimestampMs)
+	}
+	return status
+}
+
+//	GetStatus reports the job, along with the jobs it enqueued and theirs in turn.
+//	Params:
+//		ctx context.Context
+//		queue Queue
+//		id string
+//	Returns:
+//		*Status
+//		error: NotFoundError if the job doesn't exist
+func GetStatus(ctx context.Context, queue Queue, id string) (*Status, error) {
+	job, err := queue.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return getStatus(ctx, queue, job, 0)
+}
+
+//	ListStatuses reports one page of the user's jobs, oldest first, without their children.  Jobs for all users,
+//	e.g. those enqueued by POST /syncer, are listed for the user "".
+//	Params:
+//		ctx context.Context
+//		queue Queue
+//		userID string
+//		cursor string: "" for the first page
+//		limit int: at most MaxListLimit
+//	Returns:
+//		[]*Status
+//		string: the cursor of the next page, "" if there are no more jobs
+//		senecaerror.UserError: if the limit is out of range
+//		error
+func ListStatuses(ctx context.Context, queue Queue, userID, cursor string, limit int) ([]*Status, string, error) {
+	if limit <= 0 || limit > MaxListLimit {
+		return nil, "", senecaerror.NewUserError(userID, fmt.Errorf("limit %d out of range", limit), fmt.Sprintf("The limit must be in [1, %d].", MaxListLimit))
+	}
+	jobs, nextCursor, err := queue.List(ctx, userID, cursor, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	statuses := make([]*Status, len(jobs))
+	for i, job := range jobs {
+		statuses[i] = NewStatus(job)
+	}
+	return statuses, nextCursor, nil
+}
+
+func getStatus(ctx context.Context, queue Queue, job *database.Job, depth int) (*Status, error) {
+	status := NewStatus(job)
+
+	children := &ChildJobs{}
+	if job.Result == "" || json.Unmarshal([]byte(job.Result), children) != nil || len(children.JobIDs) == 0 {
+		return status, nil
+	}
+	status.ChildStates = map[string]int{}
+	for start := 0; start < len(children.JobIDs); start += maxStatusChildren {
+		end := start + maxStatusChildren
+		if end > len(children.JobIDs) {
+			end = len(children.JobIDs)
+		}
+		childJobs, err := queue.GetMulti(ctx, children.JobIDs[start:end])
+		if err != nil {
+			return nil, err
+		}
+		for _, childJob := range childJobs {
+			// The child was purged.
+			if childJob == nil {
+				continue
+			}
+			var child *Status
+			if depth < maxStatusDepth && len(status.Children) < maxStatusChildren {
+				if child, err = getStatus(ctx, queue, childJob, depth+1); err != nil {
+					return nil, err
+				}
+				status.Children = append(status.Children, child)
+			} else {
+				child = NewStatus(childJob)
+			}
+			status.ChildStates[child.State]++
+			status.Done = status.Done && child.Done
+		}
+	}
+	return status, nil
+}
+
+func ended(job *database.Job) bool {
+	return job.State == SucceededState || job.State == DeadState
+}
+
+func optionalTime(ms int64) *time.Time {
+	if ms == 0 {
+		return nil
+	}
+	t := util.MillisecondsToTime(ms)
+	return &t
+}
+
+// rawJSON passes JSON through as is, and encodes anything else as a JSON string.
+func rawJSON(value string) json.RawMessage {
+	if value == "" {
+		return nil
+	}
+	if json.Valid([]byte(value)) {
+		return json.RawMessage(value)
+	}
+	encoded, _ := json.Marshal(value)
+	return encoded
+}
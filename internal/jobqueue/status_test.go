@@ -0,0 +1,116 @@
+package jobqueue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"seneca/api/senecaerror"
+	"testing"
+	"time"
+)
+
+func TestGetStatus(t *testing.T) {
+	forEachQueue(t, func(t *testing.T, queue Queue, clock *fakeClock) {
+		ctx := context.Background()
+		enqueue(t, queue, SyncUser, "", nil)
+		parent := dequeue(t, queue, SyncUser)
+
+		good := enqueue(t, queue, ProcessRawVideo, "1", map[string]string{"file_id": "good"})
+		bad := enqueue(t, queue, ProcessRawVideo, "1", map[string]string{"file_id": "bad"})
+		result, _ := json.Marshal(&ChildJobs{JobIDs: []string{good.Id, bad.Id}})
+		if err := queue.Complete(ctx, parent, string(result)); err != nil {
+			t.Fatalf("Complete() returns err: %v", err)
+		}
+
+		job := dequeue(t, queue, ProcessRawVideo)
+		if err := queue.Complete(ctx, job, `{"raw_video_id":"rv"}`); err != nil {
+			t.Fatalf("Complete() returns err: %v", err)
+		}
+		job = dequeue(t, queue, ProcessRawVideo)
+		if err := queue.Fail(ctx, job, "", errors.New("bad video")); err != nil {
+			t.Fatalf("Fail() returns err: %v", err)
+		}
+
+		status, err := GetStatus(ctx, queue, parent.Id)
+		if err != nil {
+			t.Fatalf("GetStatus() returns err: %v", err)
+		}
+		if status.State != SucceededState || status.Done || status.EndTime == nil {
+			t.Fatalf("Want the job succeeded but not done while a child is retried, got %+v", status)
+		}
+		if len(status.Children) != 2 || status.ChildStates[SucceededState] != 1 || status.ChildStates[PendingState] != 1 {
+			t.Fatalf("Want 1 succeeded and 1 pending child, got %+v", status)
+		}
+		failed := status.Children[1]
+		if failed.Error != "bad video" || failed.NextAttemptTime == nil || string(failed.Payload) != `{"file_id":"bad"}` {
+			t.Fatalf("Want the failed child's error, retry and payload, got %+v", failed)
+		}
+		if string(status.Children[0].Result) != `{"raw_video_id":"rv"}` {
+			t.Fatalf("Want the succeeded child's result, got %+v", status.Children[0])
+		}
+
+		// Once the last attempt fails, there's nothing left to wait for.
+		for i := 0; i < 2; i++ {
+			clock.now = clock.now.Add(time.Hour)
+			job = dequeue(t, queue, ProcessRawVideo)
+			if err := queue.Fail(ctx, job, "not json", errors.New("bad video")); err != nil {
+				t.Fatalf("Fail() returns err: %v", err)
+			}
+		}
+		if status, err = GetStatus(ctx, queue, parent.Id); err != nil || !status.Done || status.ChildStates[DeadState] != 1 {
+			t.Fatalf("Want the job done, got %+v, %v", status, err)
+		}
+		if string(status.Children[1].Result) != `"not json"` {
+			t.Fatalf("Want results that aren't JSON quoted, got %s", status.Children[1].Result)
+		}
+
+		statuses, cursor, err := ListStatuses(ctx, queue, "", "", MaxListLimit)
+		if err != nil || cursor != "" || len(statuses) != 1 || statuses[0].ID != parent.Id || statuses[0].Children != nil {
+			t.Fatalf("Want the job for all users listed without children, got %v, %q, %v", statuses, cursor, err)
+		}
+		var ue *senecaerror.UserError
+		if _, _, err := ListStatuses(ctx, queue, "", "", MaxListLimit+1); !errors.As(err, &ue) {
+			t.Fatalf("Want UserError from ListStatuses() with a limit over MaxListLimit, got %v", err)
+		}
+
+		// Purged children are left out.
+		clock.now = clock.now.Add(testOptions().Retention + time.Hour)
+		if _, err := queue.Purge(ctx); err != nil {
+			t.Fatalf("Purge() returns err: %v", err)
+		}
+		enqueue(t, queue, SyncUser, "", nil)
+		parent = dequeue(t, queue, SyncUser)
+		child := enqueue(t, queue, ProcessRawVideo, "1", nil)
+		result, _ = json.Marshal(&ChildJobs{JobIDs: []string{good.Id, child.Id}})
+		if err := queue.Complete(ctx, parent, string(result)); err != nil {
+			t.Fatalf("Complete() returns err: %v", err)
+		}
+		if status, err = GetStatus(ctx, queue, parent.Id); err != nil || len(status.Children) != 1 || status.Children[0].ID != child.Id {
+			t.Fatalf("Want only the child that wasn't purged, got %+v, %v", status, err)
+		}
+	})
+}
+
+func TestGetStatusLimitsChildren(t *testing.T) {
+	forEachQueue(t, func(t *testing.T, queue Queue, clock *fakeClock) {
+		ctx := context.Background()
+		enqueue(t, queue, SyncUser, "", nil)
+		parent := dequeue(t, queue, SyncUser)
+		children := &ChildJobs{}
+		for i := 0; i < maxStatusChildren+50; i++ {
+			children.JobIDs = append(children.JobIDs, enqueue(t, queue, ProcessRawVideo, "1", i).Id)
+		}
+		result, _ := json.Marshal(children)
+		if err := queue.Complete(ctx, parent, string(result)); err != nil {
+			t.Fatalf("Complete() returns err: %v", err)
+		}
+
+		status, err := GetStatus(ctx, queue, parent.Id)
+		if err != nil {
+			t.Fatalf("GetStatus() returns err: %v", err)
+		}
+		if len(status.Children) != maxStatusChildren || status.ChildStates[PendingState] != len(children.JobIDs) || status.Done {
+			t.Fatalf("Want %d of the %d pending children, got %d children and states %v", maxStatusChildren, len(children.JobIDs), len(status.Children), status.ChildStates)
+		}
+	})
+}
@@ -0,0 +1,158 @@
+package jobqueue
+
+import (
+	"context"
+	"fmt"
+	"seneca/internal/client/database"
+	"seneca/internal/client/logging"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultConcurrency is how many jobs a Worker runs at a time by default.
+	DefaultConcurrency = 4
+	// DefaultVisibilityTimeout is how long a dequeued job is hidden from other Workers, it's extended every
+	// DefaultVisibilityTimeout/3 while the job runs.
+	DefaultVisibilityTimeout = time.Minute * 10
+	// pollInterval is how long a Worker waits before dequeuing again when there were no jobs.
+	pollInterval = time.Second * 5
+	// purgeInterval is how often a Worker purges the jobs that ended longer than the retention ago.
+	purgeInterval = time.Hour
+)
+
+// 	Handler runs a job, returning its result, which is usually JSON.  The result is kept even if the job fails.
+type Handler func(ctx context.Context, job *database.Job) (string, error)
+
+// 	Worker dequeues jobs and runs them with the Handler registered for their type.
+type Worker struct {
+	queue             Queue
+	handlers          map[string]Handler
+	concurrency       int
+	visibilityTimeout time.Duration
+	logger            logging.LoggingInterface
+}
+
+//	NewWorker creates a Worker.  Handlers must be registered before it runs.
+//	Params:
+//		queue Queue
+//		concurrency int: how many jobs are run at a time, DefaultConcurrency if not positive
+//		logger logging.LoggingInterface
+//	Returns:
+//		*Worker
+func NewWorker(queue Queue, concurrency int, logger logging.LoggingInterface) *Worker {
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+	return &Worker{
+		queue:             queue,
+		handlers:          map[string]Handler{},
+		concurrency:       concurrency,
+		visibilityTimeout: DefaultVisibilityTimeout,
+		logger:            logger,
+	}
+}
+
+// Handle registers the handler of the job type.
+func (w *Worker) Handle(jobType string, handler Handler) {
+	w.handlers[jobType] = handler
+}
+
+// Run runs jobs until ctx is canceled, then waits for the running jobs to return.  Jobs that were interrupted
+// are run again once their visibility timeout expires.  It also purges the queue every purgeInterval.
+func (w *Worker) Run(ctx context.Context) {
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			if _, err := w.queue.Purge(ctx); err != nil {
+				w.logger.Error(fmt.Sprintf("Purge() returns err: %v", err))
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(purgeInterval):
+			}
+		}
+	}()
+	for i := 0; i < w.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				worked, err := w.Work(ctx)
+				if err != nil {
+					w.logger.Error(fmt.Sprintf("Worker.Work() returns err: %v", err))
+				}
+				if worked && err == nil {
+					continue
+				}
+				select {
+				case <-ctx.Done():
+				case <-time.After(pollInterval):
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+//	Work runs one job, if there's one due.
+//	Params:
+//		ctx context.Context
+//	Returns:
+//		bool: whether a job was run
+//		error: if the queue failed, failures of the job itself are recorded in the queue
+func (w *Worker) Work(ctx context.Context) (bool, error) {
+	types := []string{}
+	for jobType := range w.handlers {
+		types = append(types, jobType)
+	}
+	sort.Strings(types)
+	job, err := w.queue.Dequeue(ctx, types, w.visibilityTimeout)
+	if err != nil || job == nil {
+		return false, err
+	}
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	extended := make(chan struct{})
+	go func() {
+		defer close(extended)
+		ticker := time.NewTicker(w.visibilityTimeout / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-jobCtx.Done():
+				return
+			case <-ticker.C:
+				if err := w.queue.Extend(jobCtx, job, w.visibilityTimeout); err != nil {
+					w.logger.Error(fmt.Sprintf("Extend() of %s job %q returns err: %v", job.Type, job.Id, err))
+					// Another Worker may run the job now, so this one stops.
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	result, jobErr := w.handlers[job.Type](jobCtx, job)
+	cancel()
+	<-extended
+	if ctx.Err() != nil {
+		return true, nil
+	}
+
+	if jobErr != nil {
+		w.logger.Error(fmt.Sprintf("Attempt %d of %s job %q for user %q returns err: %v", job.Attempts, job.Type, job.Id, job.UserId, jobErr))
+		if err := w.queue.Fail(ctx, job, result, jobErr); err != nil {
+			return true, fmt.Errorf("error failing job %q: %w", job.Id, err)
+		}
+		return true, nil
+	}
+	if err := w.queue.Complete(ctx, job, result); err != nil {
+		return true, fmt.Errorf("error completing job %q: %w", job.Id, err)
+	}
+	return true, nil
+}
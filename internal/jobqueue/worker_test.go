@@ -0,0 +1,48 @@
+package jobqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"seneca/internal/client/database"
+	"seneca/internal/client/logging"
+	"testing"
+	"time"
+)
+
+func TestWorker(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	queue := NewMemory(testOptions())
+	queue.now = clock.Now
+	worker := NewWorker(queue, 1, logging.NewLocalLogger(true))
+
+	calls := 0
+	worker.Handle(SyncUser, func(ctx context.Context, job *database.Job) (string, error) {
+		calls++
+		if calls == 1 {
+			return "", errors.New("failed")
+		}
+		return fmt.Sprintf("synced %s", job.UserId), nil
+	})
+	job := enqueue(t, queue, SyncUser, "1", nil)
+	enqueue(t, queue, ProcessRawVideo, "1", nil)
+
+	if worked, err := worker.Work(context.Background()); !worked || err != nil {
+		t.Fatalf("Work() returns %t, %v", worked, err)
+	}
+	if stored, _ := queue.Get(context.Background(), job.Id); stored.State != PendingState || stored.LastError != "failed" {
+		t.Fatalf("Want the job pending a retry, got %v", stored)
+	}
+	// The job waits for its backoff, and there's no handler for the other job.
+	if worked, err := worker.Work(context.Background()); worked || err != nil {
+		t.Fatalf("Work() returns %t, %v", worked, err)
+	}
+
+	clock.now = clock.now.Add(time.Minute)
+	if worked, err := worker.Work(context.Background()); !worked || err != nil {
+		t.Fatalf("Work() returns %t, %v", worked, err)
+	}
+	if stored, _ := queue.Get(context.Background(), job.Id); stored.State != SucceededState || stored.Result != "synced 1" {
+		t.Fatalf("Want the job succeeded, got %v", stored)
+	}
+}
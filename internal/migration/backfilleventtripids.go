@@ -0,0 +1,43 @@
+package migration
+
+import (
+	"fmt"
+	"seneca/api/constants"
+	"seneca/api/senecaerror"
+	st "seneca/api/type"
+	"seneca/internal/client/database"
+)
+
+// backfillEventTripIDs sets the TripId of events stored without one to the trip that covers their timestamp,
+// the same trip EventDAO.CreateEvent() would pick.  Events no trip covers are left alone.
+var backfillEventTripIDs = &Migration{
+	Version: 1,
+	Name:    "backfill_event_trip_ids",
+	Table:   constants.EventTable,
+	Migrate: func(sql database.SQLInterface, object interface{}) (interface{}, bool, error) {
+		event, ok := object.(*st.EventInternal)
+		if !ok {
+			return nil, false, senecaerror.NewBadStateError(fmt.Errorf("got object of type %T in table %q", object, constants.EventTable))
+		}
+		if event.TripId != "" {
+			return event, false, nil
+		}
+
+		tripIDs, _, err := sql.ListIDsByQuery(database.NewQuery(constants.TripTable).
+			Where(constants.UserIDFieldName, "=", event.UserId).
+			Where(constants.StartTimeFieldName, "<=", event.TimestampMs).
+			Where(constants.EndTimeFieldName, ">=", event.TimestampMs))
+		if err != nil {
+			return nil, false, fmt.Errorf("error listing trips covering event %q: %w", event.Id, err)
+		}
+		if len(tripIDs) > 1 {
+			return nil, false, senecaerror.NewBadStateError(fmt.Errorf("more than one trip covers event %q: %v", event.Id, tripIDs))
+		}
+		if len(tripIDs) == 0 {
+			return event, false, nil
+		}
+
+		event.TripId = tripIDs[0]
+		return event, true, nil
+	},
+}
@@ -0,0 +1,82 @@
+// Package migration evolves stored data, e.g. renaming or backfilling fields, with ordered migrations
+// that each run once over a table and record their progress in constants.MigrationsTable.
+package migration
+
+import (
+	"fmt"
+	"seneca/api/constants"
+	"seneca/api/senecaerror"
+	"seneca/internal/client/database"
+	"sort"
+)
+
+// 	Migration rewrites the objects of one table.
+type Migration struct {
+	// Version orders migrations, they're applied in increasing order.  Versions are never reused.
+	Version int64
+	// Name describes the migration, e.g. "backfill_event_trip_ids".
+	Name  string
+	Table constants.TableName
+	// Migrate is called with a copy of each object in Table, and returns the object to write and whether it
+	// changed.  It may read other tables through sql, but must not write to them: only the returned objects
+	// are written, and nothing is written in a dry run.  Migrate must be idempotent, since a migration that
+	// is resumed after a failure sees the objects of the page it failed on again.
+	Migrate func(sql database.SQLInterface, object interface{}) (interface{}, bool, error)
+}
+
+// 	Registry holds migrations ordered by Version.
+type Registry struct {
+	migrations []*Migration
+}
+
+//	NewRegistry returns a Registry of the migrations.
+//	Params:
+//		migrations ...*Migration: in any order
+//	Returns:
+//		*Registry
+//		senecaerror.DevError: if a version or name is reused, or a migration is incomplete
+func NewRegistry(migrations ...*Migration) (*Registry, error) {
+	dataTables := map[constants.TableName]bool{}
+	for _, tableName := range constants.DataTableNames {
+		dataTables[tableName] = true
+	}
+
+	versions := map[int64]bool{}
+	names := map[string]bool{}
+	for _, m := range migrations {
+		switch {
+		case m.Version <= 0:
+			return nil, senecaerror.NewDevError(fmt.Errorf("migration %q has version %d, versions start at 1", m.Name, m.Version))
+		case m.Name == "":
+			return nil, senecaerror.NewDevError(fmt.Errorf("migration %d has no name", m.Version))
+		case m.Migrate == nil:
+			return nil, senecaerror.NewDevError(fmt.Errorf("migration %d %q has no Migrate func", m.Version, m.Name))
+		case !dataTables[m.Table]:
+			return nil, senecaerror.NewDevError(fmt.Errorf("migration %d %q runs over %q, which isn't a data table", m.Version, m.Name, m.Table))
+		case versions[m.Version]:
+			return nil, senecaerror.NewDevError(fmt.Errorf("migration version %d is used more than once", m.Version))
+		case names[m.Name]:
+			return nil, senecaerror.NewDevError(fmt.Errorf("migration name %q is used more than once", m.Name))
+		}
+		versions[m.Version] = true
+		names[m.Name] = true
+	}
+
+	sorted := append([]*Migration{}, migrations...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+	return &Registry{migrations: sorted}, nil
+}
+
+// 	Migrations returns the migrations in the order they're applied.
+func (r *Registry) Migrations() []*Migration {
+	return append([]*Migration{}, r.migrations...)
+}
+
+// 	Default returns the registry of Seneca's migrations.  New migrations are added here.
+func Default() (*Registry, error) {
+	return NewRegistry(
+		backfillEventTripIDs,
+	)
+}
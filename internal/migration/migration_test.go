@@ -0,0 +1,229 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"seneca/api/constants"
+	"seneca/api/senecaerror"
+	st "seneca/api/type"
+	"seneca/internal/client/database"
+	"seneca/internal/client/database/boltdb"
+	"seneca/internal/client/logging"
+	"seneca/test/testutil"
+	"testing"
+)
+
+func TestBackfillEventTripIDs(t *testing.T) {
+	bolt, err := boltdb.New(filepath.Join(t.TempDir(), "seneca.db"))
+	if err != nil {
+		t.Fatalf("boltdb.New() returns err: %v", err)
+	}
+	defer bolt.Close()
+
+	for name, sql := range map[string]database.SQLInterface{"fake": database.NewFake(), "bolt": bolt} {
+		t.Run(name, func(t *testing.T) {
+			tripID, err := sql.Create(constants.TripTable, &st.TripInternal{UserId: testutil.TestUserID, StartTimeMs: 100, EndTimeMs: 200})
+			if err != nil {
+				t.Fatalf("Create() returns err: %v", err)
+			}
+			eventIDs := []string{}
+			for _, event := range []*st.EventInternal{
+				{UserId: testutil.TestUserID, TimestampMs: 150},
+				{UserId: testutil.TestUserID, TimestampMs: 150, TripId: "other"},
+				{UserId: testutil.TestUserID, TimestampMs: 300},
+				{UserId: "otheruser", TimestampMs: 150},
+			} {
+				id, err := sql.Create(constants.EventTable, event)
+				if err != nil {
+					t.Fatalf("Create() returns err: %v", err)
+				}
+				eventIDs = append(eventIDs, id)
+			}
+
+			runner := NewRunner(sql, mustDefault(t), logging.NewLocalLogger(true), 2)
+
+			results, err := runner.Apply(context.Background(), 0, true)
+			if err != nil {
+				t.Fatalf("Apply() dry run returns err: %v", err)
+			}
+			if len(results) != 1 || results[0].ObjectsScanned != 4 || results[0].ObjectsMigrated != 1 {
+				t.Fatalf("Want a dry run result of 4 scanned and 1 migrated, got %+v", results)
+			}
+			if got := tripIDOfEvent(t, sql, eventIDs[0]); got != "" {
+				t.Fatalf("Want no trip ID after the dry run, got %q", got)
+			}
+			statuses, err := runner.Status()
+			if err != nil || statuses[0].State() != "pending" {
+				t.Fatalf("Want the migration pending after the dry run, got %v, %v", statuses, err)
+			}
+
+			results, err = runner.Apply(context.Background(), 0, false)
+			if err != nil {
+				t.Fatalf("Apply() returns err: %v", err)
+			}
+			if len(results) != 1 || results[0].ObjectsMigrated != 1 {
+				t.Fatalf("Want 1 migrated event, got %+v", results)
+			}
+			wantTripIDs := []string{tripID, "other", "", ""}
+			for i, eventID := range eventIDs {
+				if got := tripIDOfEvent(t, sql, eventID); got != wantTripIDs[i] {
+					t.Fatalf("Want trip ID %q for event %d, got %q", wantTripIDs[i], i, got)
+				}
+			}
+
+			statuses, err = runner.Status()
+			if err != nil || !statuses[0].Applied() || statuses[0].Record.ObjectsScanned != 4 {
+				t.Fatalf("Want the migration applied after scanning 4 events, got %v, %v", statuses, err)
+			}
+			if results, err := runner.Apply(context.Background(), 0, false); err != nil || len(results) != 0 {
+				t.Fatalf("Want nothing to apply the second time, got %v, %v", results, err)
+			}
+		})
+	}
+}
+
+func TestApplyResumes(t *testing.T) {
+	sql := database.NewFake()
+	for i := 0; i < 5; i++ {
+		if _, err := sql.Create(constants.UsersTable, &st.User{Email: fmt.Sprintf("%d@seneca.ai", i)}); err != nil {
+			t.Fatalf("Create() returns err: %v", err)
+		}
+	}
+
+	migrated := map[string]int{}
+	failOn := "2@seneca.ai"
+	renameEmails := &Migration{
+		Version: 1,
+		Name:    "rename_emails",
+		Table:   constants.UsersTable,
+		Migrate: func(sql database.SQLInterface, object interface{}) (interface{}, bool, error) {
+			user := object.(*st.User)
+			if user.Email == failOn {
+				return nil, false, fmt.Errorf("induced failure")
+			}
+			migrated[user.Email]++
+			user.Email = "migrated-" + user.Email
+			return user, true, nil
+		},
+	}
+	registry, err := NewRegistry(renameEmails)
+	if err != nil {
+		t.Fatalf("NewRegistry() returns err: %v", err)
+	}
+	runner := NewRunner(sql, registry, logging.NewLocalLogger(true), 2)
+
+	if _, err := runner.Apply(context.Background(), 0, false); err == nil {
+		t.Fatalf("Want err from Apply() when Migrate fails, got nil")
+	}
+	statuses, err := runner.Status()
+	if err != nil || statuses[0].State() != "in progress" || statuses[0].Record.ObjectsScanned != 2 {
+		t.Fatalf("Want the migration in progress after the first page, got %v, %v", statuses, err)
+	}
+
+	failOn = ""
+	results, err := runner.Apply(context.Background(), 0, false)
+	if err != nil {
+		t.Fatalf("Apply() returns err: %v", err)
+	}
+	if len(results) != 1 || !results[0].Resumed || results[0].ObjectsScanned != 3 {
+		t.Fatalf("Want the migration resumed for the last 3 users, got %+v", results)
+	}
+	for email, count := range migrated {
+		if count != 1 {
+			t.Fatalf("Want every user migrated once, %q was migrated %d times", email, count)
+		}
+	}
+	if len(migrated) != 5 {
+		t.Fatalf("Want 5 users migrated, got %v", migrated)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	registry, err = NewRegistry(renameEmails, &Migration{Version: 2, Name: "noop", Table: constants.UsersTable, Migrate: renameEmails.Migrate})
+	if err != nil {
+		t.Fatalf("NewRegistry() returns err: %v", err)
+	}
+	if _, err := NewRunner(sql, registry, logging.NewLocalLogger(true), 2).Apply(ctx, 0, false); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Want context.Canceled from Apply() with a cancelled context, got %v", err)
+	}
+}
+
+func TestNewRegistry(t *testing.T) {
+	migrate := func(sql database.SQLInterface, object interface{}) (interface{}, bool, error) {
+		return object, false, nil
+	}
+
+	testCases := []struct {
+		desc       string
+		migrations []*Migration
+	}{
+		{
+			desc:       "version 0",
+			migrations: []*Migration{{Name: "a", Table: constants.UsersTable, Migrate: migrate}},
+		},
+		{
+			desc:       "no name",
+			migrations: []*Migration{{Version: 1, Table: constants.UsersTable, Migrate: migrate}},
+		},
+		{
+			desc:       "no Migrate",
+			migrations: []*Migration{{Version: 1, Name: "a", Table: constants.UsersTable}},
+		},
+		{
+			desc:       "metadata table",
+			migrations: []*Migration{{Version: 1, Name: "a", Table: constants.MigrationsTable, Migrate: migrate}},
+		},
+		{
+			desc: "reused version",
+			migrations: []*Migration{
+				{Version: 1, Name: "a", Table: constants.UsersTable, Migrate: migrate},
+				{Version: 1, Name: "b", Table: constants.UsersTable, Migrate: migrate},
+			},
+		},
+		{
+			desc: "reused name",
+			migrations: []*Migration{
+				{Version: 1, Name: "a", Table: constants.UsersTable, Migrate: migrate},
+				{Version: 2, Name: "a", Table: constants.UsersTable, Migrate: migrate},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			var de *senecaerror.DevError
+			if _, err := NewRegistry(tc.migrations...); !errors.As(err, &de) {
+				t.Fatalf("Want DevError from NewRegistry(), got %v", err)
+			}
+		})
+	}
+
+	registry, err := NewRegistry(
+		&Migration{Version: 2, Name: "b", Table: constants.UsersTable, Migrate: migrate},
+		&Migration{Version: 1, Name: "a", Table: constants.UsersTable, Migrate: migrate},
+	)
+	if err != nil {
+		t.Fatalf("NewRegistry() returns err: %v", err)
+	}
+	if migrations := registry.Migrations(); migrations[0].Version != 1 || migrations[1].Version != 2 {
+		t.Fatalf("Want migrations ordered by version, got %v", migrations)
+	}
+}
+
+func mustDefault(t *testing.T) *Registry {
+	registry, err := Default()
+	if err != nil {
+		t.Fatalf("Default() returns err: %v", err)
+	}
+	return registry
+}
+
+func tripIDOfEvent(t *testing.T, sql database.SQLInterface, eventID string) string {
+	objects, err := sql.GetByIDs(constants.EventTable, []string{eventID})
+	if err != nil {
+		t.Fatalf("GetByIDs() returns err: %v", err)
+	}
+	return objects[0].(*st.EventInternal).TripId
+}
@@ -0,0 +1,250 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"seneca/api/constants"
+	"seneca/api/senecaerror"
+	"seneca/internal/client/database"
+	"seneca/internal/client/logging"
+	"seneca/internal/util"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// DefaultPageSize is how many objects are migrated, and committed with the migration's progress, at a time.
+const DefaultPageSize = 100
+
+// 	Status is the state of a migration in the database.
+type Status struct {
+	Migration *Migration
+	// Record is nil if the migration was never started.
+	Record *database.MigrationRecord
+}
+
+// 	Applied returns whether the migration finished.
+func (s *Status) Applied() bool {
+	return s.Record != nil && s.Record.CompleteTimeMs != 0
+}
+
+// 	State returns "applied", "in progress" or "pending".
+func (s *Status) State() string {
+	switch {
+	case s.Applied():
+		return "applied"
+	case s.Record != nil:
+		return "in progress"
+	default:
+		return "pending"
+	}
+}
+
+// 	Result reports what applying a migration did, or would do in a dry run.
+type Result struct {
+	Migration *Migration
+	DryRun    bool
+	// Resumed is set if the migration continued where an earlier run stopped.
+	Resumed bool
+	// ObjectsScanned and ObjectsMigrated only count this run.
+	ObjectsScanned  int64
+	ObjectsMigrated int64
+}
+
+// 	Runner applies the migrations of a Registry to a database.
+type Runner struct {
+	sql      database.SQLInterface
+	registry *Registry
+	logger   logging.LoggingInterface
+	pageSize int
+}
+
+func NewRunner(sqlInterface database.SQLInterface, registry *Registry, logger logging.LoggingInterface, pageSize int) *Runner {
+	return &Runner{
+		sql:      sqlInterface,
+		registry: registry,
+		logger:   logger,
+		pageSize: pageSize,
+	}
+}
+
+//	Status returns the state of every registered migration, in order.
+//	Returns:
+//		[]*Status
+//		senecaerror.BadStateError: if a recorded migration doesn't match the registered one
+func (r *Runner) Status() ([]*Status, error) {
+	records, err := r.records()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []*Status{}
+	for _, m := range r.registry.Migrations() {
+		record := records[m.Version]
+		if record != nil && record.Name != m.Name {
+			return nil, senecaerror.NewBadStateError(fmt.Errorf("migration version %d is recorded as %q, but registered as %q", m.Version, record.Name, m.Name))
+		}
+		statuses = append(statuses, &Status{Migration: m, Record: record})
+	}
+	return statuses, nil
+}
+
+//	Apply applies the migrations that haven't been applied yet, in order, resuming one that was interrupted.
+//	Params:
+//		ctx context.Context: cancelling it stops the run between pages, and it can be resumed later
+//		toVersion int64: the last version to apply, 0 for all of them
+//		dryRun bool: if set, count the objects the next migration would change without writing anything.  Only
+//			one migration is dry run, since the ones after it may depend on its changes.
+//	Returns:
+//		[]*Result: one per migration that was started, including the one that failed
+//		error
+func (r *Runner) Apply(ctx context.Context, toVersion int64, dryRun bool) ([]*Result, error) {
+	statuses, err := r.Status()
+	if err != nil {
+		return nil, err
+	}
+
+	results := []*Result{}
+	for _, status := range statuses {
+		if toVersion > 0 && status.Migration.Version > toVersion {
+			break
+		}
+		if status.Applied() {
+			continue
+		}
+
+		result, err := r.apply(ctx, status.Migration, status.Record, dryRun)
+		results = append(results, result)
+		if err != nil {
+			return results, fmt.Errorf("error applying migration %d %q: %w", status.Migration.Version, status.Migration.Name, err)
+		}
+		if dryRun {
+			break
+		}
+	}
+	return results, nil
+}
+
+// apply runs m one page at a time.  Each page's writes are committed with the record of how far m got,
+// so an interrupted migration resumes after the last committed page.
+func (r *Runner) apply(ctx context.Context, m *Migration, record *database.MigrationRecord, dryRun bool) (*Result, error) {
+	result := &Result{
+		Migration: m,
+		DryRun:    dryRun,
+		Resumed:   record != nil,
+	}
+
+	if record == nil {
+		record = &database.MigrationRecord{
+			Version:     m.Version,
+			Name:        m.Name,
+			StartTimeMs: util.TimeToMilliseconds(time.Now()),
+		}
+		if !dryRun {
+			id, err := r.sql.Create(constants.MigrationsTable, record)
+			if err != nil {
+				return result, fmt.Errorf("error creating record for migration: %w", err)
+			}
+			record.Id = id
+			if err := r.sql.Insert(constants.MigrationsTable, id, record); err != nil {
+				return result, fmt.Errorf("error updating record %q for migration: %w", id, err)
+			}
+		}
+	}
+	r.logger.Log(fmt.Sprintf("Applying migration %d %q to table %q (dry run: %t, resuming: %t)", m.Version, m.Name, m.Table, dryRun, result.Resumed))
+
+	cursor := record.Cursor
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, fmt.Errorf("stopped after %d objects: %w", result.ObjectsScanned, err)
+		}
+
+		ids, nextCursor, err := r.sql.ListIDsByQuery(database.NewQuery(m.Table).WithLimit(r.pageSize).WithCursor(cursor))
+		if err != nil {
+			return result, fmt.Errorf("error listing IDs: %w", err)
+		}
+
+		changedIDs := []string{}
+		changedObjects := []interface{}{}
+		if len(ids) > 0 {
+			objects, err := r.sql.GetByIDs(m.Table, ids)
+			if err != nil {
+				return result, fmt.Errorf("error getting objects: %w", err)
+			}
+			for i, object := range objects {
+				// Migrate gets a copy, so a dry run can't change the objects backends hand out by reference.
+				if message, ok := object.(proto.Message); ok {
+					object = proto.Clone(message)
+				}
+				migrated, changed, err := m.Migrate(r.sql, object)
+				if err != nil {
+					return result, fmt.Errorf("error migrating object %q: %w", ids[i], err)
+				}
+				if changed {
+					changedIDs = append(changedIDs, ids[i])
+					changedObjects = append(changedObjects, migrated)
+				}
+			}
+		}
+
+		if !dryRun {
+			updatedRecord := proto.Clone(record).(*database.MigrationRecord)
+			updatedRecord.Cursor = nextCursor
+			updatedRecord.ObjectsScanned += int64(len(ids))
+			updatedRecord.ObjectsMigrated += int64(len(changedIDs))
+			if nextCursor == "" {
+				updatedRecord.CompleteTimeMs = util.TimeToMilliseconds(time.Now())
+			}
+			if err := r.sql.RunInTransaction(ctx, func(tx database.SQLInterface) error {
+				if len(changedIDs) > 0 {
+					if err := tx.InsertMulti(m.Table, changedIDs, changedObjects); err != nil {
+						return err
+					}
+				}
+				return tx.Insert(constants.MigrationsTable, updatedRecord.Id, updatedRecord)
+			}); err != nil {
+				return result, fmt.Errorf("error committing page of %d objects: %w", len(ids), err)
+			}
+			record = updatedRecord
+		}
+
+		result.ObjectsScanned += int64(len(ids))
+		result.ObjectsMigrated += int64(len(changedIDs))
+		if nextCursor == "" {
+			break
+		}
+		cursor = nextCursor
+	}
+
+	r.logger.Log(fmt.Sprintf("Migration %d %q scanned %d objects and changed %d (dry run: %t)", m.Version, m.Name, result.ObjectsScanned, result.ObjectsMigrated, dryRun))
+	return result, nil
+}
+
+// records returns the recorded migrations by version.
+func (r *Runner) records() (map[int64]*database.MigrationRecord, error) {
+	ids, _, err := r.sql.ListIDsByQuery(database.NewQuery(constants.MigrationsTable))
+	if err != nil {
+		return nil, fmt.Errorf("error listing migration records: %w", err)
+	}
+	if len(ids) == 0 {
+		return map[int64]*database.MigrationRecord{}, nil
+	}
+
+	objects, err := r.sql.GetByIDs(constants.MigrationsTable, ids)
+	if err != nil {
+		return nil, fmt.Errorf("error getting migration records: %w", err)
+	}
+
+	records := map[int64]*database.MigrationRecord{}
+	for i, object := range objects {
+		record, ok := object.(*database.MigrationRecord)
+		if !ok {
+			return nil, senecaerror.NewBadStateError(fmt.Errorf("got object of type %T in table %q", object, constants.MigrationsTable))
+		}
+		if _, ok := records[record.Version]; ok {
+			return nil, senecaerror.NewBadStateError(fmt.Errorf("migration version %d is recorded more than once, again with ID %q", record.Version, ids[i]))
+		}
+		records[record.Version] = record
+	}
+	return records, nil
+}
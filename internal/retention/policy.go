@@ -0,0 +1,161 @@
+// Package retention soft deletes objects that are older than their retention policy allows, and purges soft deleted
+// objects, with their files in storage, once they've been tombstoned for long enough.
+package retention
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"seneca/api/constants"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultTombstoneTTL is how long soft deleted objects are kept if the policy doesn't say.
+const defaultTombstoneTTL = time.Hour * 24 * 30
+
+// 	Duration is a time.Duration that's written in JSON as a string, e.g. "36h" or "30d".
+type Duration time.Duration
+
+//	ParseDuration parses Go durations, e.g. "36h", and whole days, e.g. "30d".
+//	Params:
+//		s string
+//	Returns:
+//		time.Duration
+//		error
+func ParseDuration(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q - err: %w", s, err)
+		}
+		return time.Hour * 24 * time.Duration(days), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q - err: %w", s, err)
+	}
+	return d, nil
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("durations must be strings, e.g. \"30d\" - err: %w", err)
+	}
+	parsed, err := ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// 	Policy is how long objects are kept.  Objects older than the max age of their table are soft deleted, and
+// 	tombstones older than TombstoneTTL are purged.  Tables without a max age are kept forever.
+// 	For example:
+// 		{
+// 			"tombstone_ttl": "7d",
+// 			"tables": {"RawFrames": "30d", "Events": "1095d"},
+// 			"users": {"1234": {"RawFrames": "90d"}}
+// 		}
+// 	purges raw frames after 30 days, or 90 days for user 1234, and keeps events for 3 years.
+type Policy struct {
+	// TombstoneTTL is how long soft deleted objects can be restored before they're purged.
+	TombstoneTTL Duration `json:"tombstone_ttl"`
+	// Tables maps table names to the max age of their objects.
+	Tables map[constants.TableName]Duration `json:"tables"`
+	// Users maps user IDs to the max ages that override Tables for that user.  A max age of 0 keeps the user's objects forever.
+	Users map[string]map[constants.TableName]Duration `json:"users"`
+}
+
+//	DefaultPolicy keeps every object forever and purges tombstones after 30 days.
+func DefaultPolicy() *Policy {
+	return &Policy{TombstoneTTL: Duration(defaultTombstoneTTL)}
+}
+
+//	LoadPolicy reads a JSON Policy, see Policy.
+//	Params:
+//		r io.Reader
+//	Returns:
+//		*Policy
+//		error: if the policy is malformed or invalid
+func LoadPolicy(r io.Reader) (*Policy, error) {
+	policy := DefaultPolicy()
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(policy); err != nil {
+		return nil, fmt.Errorf("error decoding retention policy: %w", err)
+	}
+	if err := policy.validate(); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func (p *Policy) validate() error {
+	if p.TombstoneTTL < 0 {
+		return fmt.Errorf("tombstone_ttl must not be negative, got %v", time.Duration(p.TombstoneTTL))
+	}
+	check := func(tableName constants.TableName, maxAge Duration) error {
+		if _, ok := timeFieldNames[tableName]; !ok {
+			return fmt.Errorf("table %q doesn't support retention, must be one of %v", tableName, expireOrder)
+		}
+		if maxAge < 0 {
+			return fmt.Errorf("the max age of table %q must not be negative, got %v", tableName, time.Duration(maxAge))
+		}
+		return nil
+	}
+	for tableName, maxAge := range p.Tables {
+		if err := check(tableName, maxAge); err != nil {
+			return err
+		}
+	}
+	for userID, tables := range p.Users {
+		for tableName, maxAge := range tables {
+			if err := check(tableName, maxAge); err != nil {
+				return fmt.Errorf("invalid policy of user %q: %w", userID, err)
+			}
+		}
+	}
+	return nil
+}
+
+//	MaxAge returns how long the user's objects in the table are kept.
+//	Params:
+//		userID string
+//		tableName constants.TableName
+//	Returns:
+//		time.Duration
+//		bool: false if the objects are kept forever
+func (p *Policy) MaxAge(userID string, tableName constants.TableName) (time.Duration, bool) {
+	maxAge, ok := p.Users[userID][tableName]
+	if !ok {
+		maxAge, ok = p.Tables[tableName]
+	}
+	return time.Duration(maxAge), ok && maxAge > 0
+}
+
+// minMaxAge returns the shortest max age of the table over all users, which bounds the objects that may be expired.
+func (p *Policy) minMaxAge(tableName constants.TableName) (time.Duration, bool) {
+	var min time.Duration
+	found := false
+	consider := func(maxAge Duration, ok bool) {
+		if ok && maxAge > 0 && (!found || time.Duration(maxAge) < min) {
+			min = time.Duration(maxAge)
+			found = true
+		}
+	}
+	maxAge, ok := p.Tables[tableName]
+	consider(maxAge, ok)
+	for _, tables := range p.Users {
+		maxAge, ok := tables[tableName]
+		consider(maxAge, ok)
+	}
+	return min, found
+}
@@ -0,0 +1,65 @@
+package retention
+
+import (
+	"seneca/api/constants"
+	"strings"
+	"testing"
+	"time"
+)
+
+const day = time.Hour * 24
+
+func TestLoadPolicy(t *testing.T) {
+	policy, err := LoadPolicy(strings.NewReader(`{
+		"tombstone_ttl": "36h",
+		"tables": {"RawFrames": "30d", "Events": "1095d"},
+		"users": {"1234": {"RawFrames": "90d", "Events": "0s"}}
+	}`))
+	if err != nil {
+		t.Fatalf("LoadPolicy() returns err: %v", err)
+	}
+	if time.Duration(policy.TombstoneTTL) != time.Hour*36 {
+		t.Fatalf("Want a tombstone TTL of 36h, got %v", time.Duration(policy.TombstoneTTL))
+	}
+
+	for _, tc := range []struct {
+		userID     string
+		tableName  constants.TableName
+		wantMaxAge time.Duration
+		wantOK     bool
+	}{
+		{"other", constants.RawFramesTable, 30 * day, true},
+		{"other", constants.EventTable, 1095 * day, true},
+		{"other", constants.RawVideosTable, 0, false},
+		{"1234", constants.RawFramesTable, 90 * day, true},
+		{"1234", constants.EventTable, 0, false},
+	} {
+		maxAge, ok := policy.MaxAge(tc.userID, tc.tableName)
+		if ok != tc.wantOK || (ok && maxAge != tc.wantMaxAge) {
+			t.Fatalf("Want MaxAge(%q, %q) = %v, %t, got %v, %t", tc.userID, tc.tableName, tc.wantMaxAge, tc.wantOK, maxAge, ok)
+		}
+	}
+	if minMaxAge, ok := policy.minMaxAge(constants.RawFramesTable); !ok || minMaxAge != 30*day {
+		t.Fatalf("Want minMaxAge() of 30d, got %v, %t", minMaxAge, ok)
+	}
+
+	if policy, err := LoadPolicy(strings.NewReader(`{}`)); err != nil || time.Duration(policy.TombstoneTTL) != defaultTombstoneTTL {
+		t.Fatalf("Want the default tombstone TTL from an empty policy, got %v, %v", policy, err)
+	}
+}
+
+func TestLoadPolicyErrors(t *testing.T) {
+	for _, policy := range []string{
+		`{"tables": {"Users": "30d"}}`,
+		`{"tables": {"RawFrames": "-30d"}}`,
+		`{"tables": {"RawFrames": "thirty days"}}`,
+		`{"tables": {"RawFrames": 30}}`,
+		`{"users": {"1234": {"Migrations": "30d"}}}`,
+		`{"tombstone_ttl": "-1h"}`,
+		`{"retention": "30d"}`,
+	} {
+		if _, err := LoadPolicy(strings.NewReader(policy)); err == nil {
+			t.Fatalf("Want err from LoadPolicy(%s), got nil", policy)
+		}
+	}
+}
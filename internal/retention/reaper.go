@@ -0,0 +1,287 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"seneca/api/constants"
+	"seneca/api/senecaerror"
+	"seneca/internal/audit"
+	"seneca/internal/client/cloud"
+	"seneca/internal/client/database"
+	"seneca/internal/client/logging"
+	"seneca/internal/util"
+	"seneca/internal/util/data"
+	"time"
+)
+
+// reapPageSize is how many objects are read from the database at a time.
+const reapPageSize = 500
+
+var (
+	// ReaperActor is the Actor of the audit records the reaper writes.
+	ReaperActor = audit.SystemActor("reaper")
+
+	// timeFieldNames are the fields the age of objects is measured by.  Users are never expired.
+	timeFieldNames = map[constants.TableName]constants.SenecaTypeFieldName{
+		constants.RawVideosTable:         constants.CreateTimeFieldName,
+		constants.RawLocationsTable:      constants.TimestampFieldName,
+		constants.RawMotionsTable:        constants.TimestampFieldName,
+		constants.RawFramesTable:         constants.TimestampFieldName,
+		constants.EventTable:             constants.TimestampFieldName,
+		constants.DrivingConditionTable:  constants.EndTimeFieldName,
+		constants.TripTable:              constants.EndTimeFieldName,
+		constants.RawTelemetryFilesTable: constants.CreateTimeFieldName,
+		constants.RawVehicleSignalsTable: constants.TimestampFieldName,
+	}
+	// expireOrder expires trips last, since only trips without events or driving conditions are expired.  Raw data may
+	// be expired before the events and driving conditions derived from it, which are then shown without a video.
+	expireOrder = []constants.TableName{
+		constants.RawFramesTable,
+		constants.RawMotionsTable,
+		constants.RawLocationsTable,
+		constants.RawVehicleSignalsTable,
+		constants.RawTelemetryFilesTable,
+		constants.RawVideosTable,
+		constants.EventTable,
+		constants.DrivingConditionTable,
+		constants.TripTable,
+	}
+)
+
+// 	Report counts what a run of the Reaper did.
+type Report struct {
+	// Expired counts the objects that were soft deleted by table.
+	Expired map[constants.TableName]int
+	// Purged counts the tombstones that were purged by the table of their object.
+	Purged map[constants.TableName]int
+	// FilesDeleted counts the files deleted from storage.
+	FilesDeleted int
+}
+
+// 	Reaper applies a Policy to the database.
+type Reaper struct {
+	sql           database.SQLInterface
+	simpleStorage cloud.SimpleStorageInterface
+	policy        *Policy
+	logger        logging.LoggingInterface
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+func NewReaper(sqlInterface database.SQLInterface, simpleStorage cloud.SimpleStorageInterface, policy *Policy, logger logging.LoggingInterface) *Reaper {
+	return &Reaper{
+		sql:           sqlInterface,
+		simpleStorage: simpleStorage,
+		policy:        policy,
+		logger:        logger,
+		now:           time.Now,
+	}
+}
+
+//	Run soft deletes the objects that are older than the policy allows, then purges the tombstones older than the
+//	policy's TombstoneTTL, deleting their files from storage and writing an audit record for each of them.
+//	Params:
+//		ctx context.Context
+//	Returns:
+//		*Report: what was done before any error
+//		error
+func (r *Reaper) Run(ctx context.Context) (*Report, error) {
+	report := &Report{
+		Expired: map[constants.TableName]int{},
+		Purged:  map[constants.TableName]int{},
+	}
+	now := r.now()
+
+	for _, tableName := range expireOrder {
+		if err := r.expireTable(ctx, now, tableName, report); err != nil {
+			return report, err
+		}
+	}
+
+	tombstoneIDs, err := r.listIDsBefore(ctx, constants.TombstonesTable, constants.TimestampFieldName, now.Add(-time.Duration(r.policy.TombstoneTTL)))
+	if err != nil {
+		return report, err
+	}
+	for _, id := range tombstoneIDs {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		if err := r.purgeTombstone(ctx, now, id, report); err != nil {
+			return report, err
+		}
+	}
+
+	r.logger.Log(fmt.Sprintf("Reaper expired %v, purged %v and deleted %d files", report.Expired, report.Purged, report.FilesDeleted))
+	return report, nil
+}
+
+//	RunPeriodically calls Run every interval until ctx is done, logging errors.
+//	Params:
+//		ctx context.Context
+//		interval time.Duration
+func (r *Reaper) RunPeriodically(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.Run(ctx); err != nil {
+				r.logger.Error(fmt.Sprintf("Reaper.Run() returns err: %v", err))
+			}
+		}
+	}
+}
+
+// expireTable soft deletes the objects of the table that are older than the max age of their user.
+func (r *Reaper) expireTable(ctx context.Context, now time.Time, tableName constants.TableName, report *Report) error {
+	minMaxAge, ok := r.policy.minMaxAge(tableName)
+	if !ok {
+		return nil
+	}
+	timeFieldName := timeFieldNames[tableName]
+
+	// The IDs are all listed before deleting, since deleting would move the query's cursor.
+	ids, err := r.listIDsBefore(ctx, tableName, timeFieldName, now.Add(-minMaxAge))
+	if err != nil {
+		return err
+	}
+	expiredIDs := []string{}
+	for start := 0; start < len(ids); start += reapPageSize {
+		end := start + reapPageSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		objects, err := r.sql.GetByIDs(tableName, ids[start:end])
+		if err != nil {
+			return fmt.Errorf("error getting %d objects from table %q: %w", end-start, tableName, err)
+		}
+		for i, object := range objects {
+			userID, _ := database.FieldValue(object, constants.UserIDFieldName)
+			userIDString, _ := userID.(string)
+			maxAge, ok := r.policy.MaxAge(userIDString, tableName)
+			if !ok {
+				continue
+			}
+			timeMs, _ := database.FieldValue(object, timeFieldName)
+			if t, _ := timeMs.(int64); t < util.TimeToMilliseconds(now.Add(-maxAge)) {
+				expiredIDs = append(expiredIDs, ids[start+i])
+			}
+		}
+	}
+
+	for _, id := range expiredIDs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if tableName == constants.TripTable {
+			empty, err := r.isEmptyTrip(id)
+			if err != nil {
+				return err
+			}
+			if !empty {
+				continue
+			}
+		}
+		if _, err := database.SoftDelete(ctx, r.sql, tableName, id, database.RetentionReason); err != nil {
+			var nfe *senecaerror.NotFoundError
+			// The object may have been deleted since it was listed.
+			if errors.As(err, &nfe) {
+				continue
+			}
+			return fmt.Errorf("error soft deleting object %q from table %q: %w", id, tableName, err)
+		}
+		report.Expired[tableName]++
+	}
+	return nil
+}
+
+func (r *Reaper) isEmptyTrip(tripID string) (bool, error) {
+	for _, tableName := range []constants.TableName{constants.EventTable, constants.DrivingConditionTable} {
+		ids, _, err := r.sql.ListIDsByQuery(database.NewQuery(tableName).Where(constants.TripIDFieldName, "=", tripID).WithLimit(1))
+		if err != nil {
+			return false, fmt.Errorf("error listing %s of trip %q: %w", tableName, tripID, err)
+		}
+		if len(ids) > 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// purgeTombstone deletes the file of the tombstone's object and then the tombstone, with an audit record.
+func (r *Reaper) purgeTombstone(ctx context.Context, now time.Time, id string, report *Report) error {
+	tombstoneObj, err := r.sql.GetByID(constants.TombstonesTable, id)
+	var nfe *senecaerror.NotFoundError
+	if err != nil && !errors.As(err, &nfe) {
+		return fmt.Errorf("error getting tombstone %q: %w", id, err)
+	}
+	tombstone, ok := tombstoneObj.(*database.Tombstone)
+	if !ok {
+		// The tombstone was purged since it was listed.
+		return nil
+	}
+	object, err := tombstone.UnmarshalObject()
+	if err != nil {
+		return err
+	}
+
+	details := fmt.Sprintf("Purged tombstone %s of an object deleted at %d for %q.", tombstone.Id, tombstone.TimestampMs, tombstone.Reason)
+	// The file is deleted first, so that it's retried by the next run if anything fails.
+	if url := data.CloudStorageFileName(object); url != "" {
+		bucketName, fileName, err := data.GCSURLToBucketNameAndFileName(url)
+		if err != nil {
+			return senecaerror.NewBadStateError(fmt.Errorf("tombstone %q has invalid CloudStorageFileName %q - err: %w", id, url, err))
+		}
+		if err := r.simpleStorage.DeleteBucketFile(bucketName, fileName); err != nil {
+			if !errors.As(err, &nfe) {
+				return fmt.Errorf("error deleting %q of tombstone %q: %w", url, id, err)
+			}
+		} else {
+			report.FilesDeleted++
+		}
+		details += fmt.Sprintf("  Deleted %s.", url)
+	}
+
+	if err := r.sql.RunInTransaction(ctx, func(tx database.SQLInterface) error {
+		if err := tx.DeleteByID(constants.TombstonesTable, id); err != nil {
+			return fmt.Errorf("error deleting tombstone %q: %w", id, err)
+		}
+		_, err := database.CreateAuditRecord(tx, &database.AuditRecord{
+			TimestampMs: util.TimeToMilliseconds(now),
+			Actor:       ReaperActor,
+			Action:      database.PurgeAction,
+			TableName:   tombstone.TableName,
+			ObjectId:    tombstone.ObjectId,
+			UserId:      tombstone.UserId,
+			Details:     details,
+		})
+		return err
+	}); err != nil {
+		return err
+	}
+	report.Purged[constants.TableName(tombstone.TableName)]++
+	return nil
+}
+
+// listIDsBefore lists the IDs of all objects in the table whose timeFieldName is before t.
+func (r *Reaper) listIDsBefore(ctx context.Context, tableName constants.TableName, timeFieldName constants.SenecaTypeFieldName, t time.Time) ([]string, error) {
+	query := database.NewQuery(tableName).Where(timeFieldName, "<", util.TimeToMilliseconds(t)).WithLimit(reapPageSize)
+	ids := []string{}
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		pageIDs, nextCursor, err := r.sql.ListIDsByQuery(query)
+		if err != nil {
+			return nil, fmt.Errorf("error listing IDs in table %q before %v: %w", tableName, t, err)
+		}
+		ids = append(ids, pageIDs...)
+		if nextCursor == "" {
+			return ids, nil
+		}
+		query.WithCursor(nextCursor)
+	}
+}
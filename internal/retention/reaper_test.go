@@ -0,0 +1,156 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"seneca/api/constants"
+	st "seneca/api/type"
+	"seneca/internal/client/cloud"
+	"seneca/internal/client/cloud/local"
+	"seneca/internal/client/database"
+	"seneca/internal/client/logging"
+	"seneca/internal/util"
+	"testing"
+	"time"
+)
+
+func TestReaperRun(t *testing.T) {
+	sql := database.NewFake()
+	storage, err := local.NewFileSystemStorageClient(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("NewFileSystemStorageClient() returns err: %v", err)
+	}
+	if err := storage.CreateBucket(cloud.RawVideoBucketName); err != nil {
+		t.Fatalf("CreateBucket() returns err: %v", err)
+	}
+	writer, err := storage.NewBucketFileWriter(cloud.RawVideoBucketName, "old.mp4")
+	if err != nil {
+		t.Fatalf("NewBucketFileWriter() returns err: %v", err)
+	}
+	if _, err := writer.Write([]byte("video")); err != nil {
+		t.Fatalf("Write() returns err: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close() returns err: %v", err)
+	}
+
+	now := time.Now()
+	ago := func(d time.Duration) int64 {
+		return util.TimeToMilliseconds(now.Add(-d))
+	}
+	create := func(tableName constants.TableName, object interface{}) string {
+		id, err := sql.Create(tableName, object)
+		if err != nil {
+			t.Fatalf("Create() returns err: %v", err)
+		}
+		return id
+	}
+
+	oldTripID := create(constants.TripTable, &st.TripInternal{UserId: "2", EndTimeMs: ago(4 * 365 * day)})
+	keptTripID := create(constants.TripTable, &st.TripInternal{UserId: "2", EndTimeMs: ago(4 * 365 * day)})
+	wantExpired := map[constants.TableName][]string{
+		constants.RawFramesTable: {create(constants.RawFramesTable, &st.RawFrame{UserId: "2", TimestampMs: ago(40 * day)})},
+		constants.RawVideosTable: {create(constants.RawVideosTable, &st.RawVideo{UserId: "2", CreateTimeMs: ago(40 * day), CloudStorageFileName: fmt.Sprintf("file://%s/old.mp4", cloud.RawVideoBucketName)})},
+		constants.EventTable:     {create(constants.EventTable, &st.EventInternal{UserId: "2", TripId: oldTripID, TimestampMs: ago(4 * 365 * day)})},
+		constants.TripTable:      {oldTripID},
+	}
+	wantKept := map[constants.TableName][]string{
+		constants.RawFramesTable: {
+			// User 1 keeps raw frames for longer.
+			create(constants.RawFramesTable, &st.RawFrame{UserId: "1", TimestampMs: ago(40 * day)}),
+			create(constants.RawFramesTable, &st.RawFrame{UserId: "2", TimestampMs: ago(10 * day)}),
+		},
+		constants.RawMotionsTable: {create(constants.RawMotionsTable, &st.RawMotion{UserId: "2", TimestampMs: ago(4 * 365 * day)})},
+		constants.EventTable:      {create(constants.EventTable, &st.EventInternal{UserId: "2", TripId: keptTripID, TimestampMs: ago(2 * 365 * day)})},
+		// The trip still has an event.
+		constants.TripTable: {keptTripID},
+	}
+
+	policy := &Policy{
+		TombstoneTTL: Duration(7 * day),
+		Tables: map[constants.TableName]Duration{
+			constants.RawFramesTable: Duration(30 * day),
+			constants.RawVideosTable: Duration(30 * day),
+			constants.EventTable:     Duration(3 * 365 * day),
+			constants.TripTable:      Duration(30 * day),
+		},
+		Users: map[string]map[constants.TableName]Duration{
+			"1": {constants.RawFramesTable: Duration(90 * day)},
+		},
+	}
+	reaper := NewReaper(sql, storage, policy, logging.NewLocalLogger(true))
+	reaper.now = func() time.Time { return now }
+
+	report, err := reaper.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() returns err: %v", err)
+	}
+	for tableName, ids := range wantExpired {
+		if report.Expired[tableName] != len(ids) {
+			t.Fatalf("Want %d expired objects in table %q, got %d", len(ids), tableName, report.Expired[tableName])
+		}
+		for _, id := range ids {
+			if object, err := sql.GetByID(tableName, id); err != nil || object != nil {
+				t.Fatalf("Want object %q of table %q to be deleted, got %v, %v", id, tableName, object, err)
+			}
+		}
+	}
+	for tableName, ids := range wantKept {
+		for _, id := range ids {
+			if object, err := sql.GetByID(tableName, id); err != nil || object == nil {
+				t.Fatalf("Want object %q of table %q to be kept, got %v, %v", id, tableName, object, err)
+			}
+		}
+	}
+	if len(report.Purged) != 0 {
+		t.Fatalf("Want no tombstones purged before their TTL, got %v", report.Purged)
+	}
+	if _, err := storage.NewBucketFileReader(cloud.RawVideoBucketName, "old.mp4"); err != nil {
+		t.Fatalf("Want the video file kept until its tombstone is purged, got err: %v", err)
+	}
+
+	reaper.now = func() time.Time { return now.Add(8 * day) }
+	report, err = reaper.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() returns err: %v", err)
+	}
+	if len(report.Expired) != 0 {
+		t.Fatalf("Want nothing else expired, got %v", report.Expired)
+	}
+	for tableName, ids := range wantExpired {
+		if report.Purged[tableName] != len(ids) {
+			t.Fatalf("Want %d purged tombstones of table %q, got %d", len(ids), tableName, report.Purged[tableName])
+		}
+	}
+	if report.FilesDeleted != 1 {
+		t.Fatalf("Want 1 file deleted, got %d", report.FilesDeleted)
+	}
+	if _, err := storage.NewBucketFileReader(cloud.RawVideoBucketName, "old.mp4"); err == nil {
+		t.Fatalf("Want the video file deleted")
+	}
+
+	tombstoneIDs, _, err := sql.ListIDsByQuery(database.NewQuery(constants.TombstonesTable))
+	if err != nil {
+		t.Fatalf("ListIDsByQuery() returns err: %v", err)
+	}
+	if len(tombstoneIDs) != 0 {
+		t.Fatalf("Want all tombstones purged, got %d", len(tombstoneIDs))
+	}
+	auditIDs, _, err := sql.ListIDsByQuery(database.NewQuery(constants.AuditTable))
+	if err != nil {
+		t.Fatalf("ListIDsByQuery() returns err: %v", err)
+	}
+	if len(auditIDs) != 4 {
+		t.Fatalf("Want an audit record for each of the 4 purges, got %d", len(auditIDs))
+	}
+	records, err := sql.GetByIDs(constants.AuditTable, auditIDs)
+	if err != nil {
+		t.Fatalf("GetByIDs() returns err: %v", err)
+	}
+	for _, object := range records {
+		record := object.(*database.AuditRecord)
+		if record.Actor != ReaperActor || record.Action != database.PurgeAction || record.UserId != "2" || record.ObjectId == "" {
+			t.Fatalf("Want a purge audit record by the reaper, got %v", record)
+		}
+	}
+}
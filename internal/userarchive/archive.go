@@ -0,0 +1,176 @@
+// Package userarchive exports all of a user's data into a portable zip archive.
+//
+// An archive holds:
+// 	manifest.json: the Manifest, which describes everything else
+// 	records/<TableName>.jsonl or records/<TableName>.binpb: the user's objects in each table
+// 	media/<TableName>/<ID><extension>: the files of RawVideos and RawFrames, if they were included
+package userarchive
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"path"
+	"seneca/api/constants"
+	"seneca/api/senecaerror"
+	"strings"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+)
+
+const (
+	// FormatVersion is the version of the archive layout, it changes whenever readers of old archives would break.
+	FormatVersion = 1
+	// ManifestPath is where the manifest is stored in the archive.
+	ManifestPath = "manifest.json"
+
+	// maxRecordSize bounds the size of a protobuf record, so that a corrupt length can't exhaust memory.
+	maxRecordSize = 64 << 20
+)
+
+// 	RecordFormat is how the objects of a table are encoded.
+type RecordFormat string
+
+const (
+	// JSONRecordFormat stores one object per line in the protobuf JSON mapping.
+	JSONRecordFormat RecordFormat = "json"
+	// ProtoRecordFormat stores each object in the protobuf wire format, preceded by its size as a varint.
+	ProtoRecordFormat RecordFormat = "proto"
+)
+
+//	ParseRecordFormat parses "json" or "proto".
+//	Returns:
+//		RecordFormat
+//		senecaerror.UserError
+func ParseRecordFormat(s string) (RecordFormat, error) {
+	switch RecordFormat(s) {
+	case JSONRecordFormat, ProtoRecordFormat:
+		return RecordFormat(s), nil
+	default:
+		return "", senecaerror.NewUserError("", fmt.Errorf("unsupported record format %q", s), fmt.Sprintf("Unsupported format %q, must be one of [json, proto].", s))
+	}
+}
+
+func (rf RecordFormat) extension() string {
+	if rf == ProtoRecordFormat {
+		return ".binpb"
+	}
+	return ".jsonl"
+}
+
+// 	Manifest describes the contents of an archive.
+type Manifest struct {
+	FormatVersion int    `json:"format_version"`
+	UserID        string `json:"user_id"`
+	// CreateTimeMs is when the export started.
+	CreateTimeMs int64         `json:"create_time_ms"`
+	RecordFormat RecordFormat  `json:"record_format"`
+	Tables       []*TableEntry `json:"tables"`
+	Media        []*MediaEntry `json:"media,omitempty"`
+}
+
+// 	TableEntry describes the file holding the user's objects in a table.
+type TableEntry struct {
+	TableName constants.TableName `json:"table_name"`
+	Path      string              `json:"path"`
+	Count     int                 `json:"count"`
+}
+
+// 	MediaEntry describes a file from storage.
+type MediaEntry struct {
+	// TableName and RecordID identify the object the file belongs to.
+	TableName constants.TableName `json:"table_name"`
+	RecordID  string              `json:"record_id"`
+	// SourceURL is the CloudStorageFileName of the object when it was exported.
+	SourceURL string `json:"source_url"`
+	Path      string `json:"path"`
+	SizeBytes int64  `json:"size_bytes"`
+	// SHA256 is the hex encoded checksum of the file.
+	SHA256 string `json:"sha256"`
+}
+
+func recordsPath(tableName constants.TableName, format RecordFormat) string {
+	return path.Join("records", tableName.String()+format.extension())
+}
+
+func mediaPath(tableName constants.TableName, recordID, sourceURL string) string {
+	return path.Join("media", tableName.String(), recordID+strings.ToLower(path.Ext(sourceURL)))
+}
+
+// writeRecord appends the message to a records file.
+func writeRecord(w io.Writer, format RecordFormat, message proto.Message) error {
+	switch format {
+	case JSONRecordFormat:
+		line, err := (&jsonpb.Marshaler{OrigName: true}).MarshalToString(message)
+		if err != nil {
+			return fmt.Errorf("error marshalling %T to JSON - err: %w", message, err)
+		}
+		_, err = io.WriteString(w, line+"\n")
+		return err
+	case ProtoRecordFormat:
+		data, err := proto.Marshal(message)
+		if err != nil {
+			return fmt.Errorf("error marshalling %T - err: %w", message, err)
+		}
+		size := make([]byte, binary.MaxVarintLen64)
+		if _, err := w.Write(size[:binary.PutUvarint(size, uint64(len(data)))]); err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	default:
+		return senecaerror.NewDevError(fmt.Errorf("unsupported record format %q", format))
+	}
+}
+
+//	ReadRecords decodes the messages in a records file, one at a time.
+//	Params:
+//		r io.Reader: the records file
+//		format RecordFormat
+//		newMessage func() proto.Message: returns an empty message of the type in the file
+//		f func(proto.Message) error: called with each message, an error stops reading
+//	Returns:
+//		senecaerror.UserError: if the file is corrupt
+//		error: from f
+func ReadRecords(r io.Reader, format RecordFormat, newMessage func() proto.Message, f func(proto.Message) error) error {
+	reader := bufio.NewReader(r)
+	for i := 0; ; i++ {
+		message := newMessage()
+		switch format {
+		case JSONRecordFormat:
+			line, err := reader.ReadString('\n')
+			if err == io.EOF && line == "" {
+				return nil
+			}
+			if err != nil && err != io.EOF {
+				return fmt.Errorf("error reading record %d: %w", i, err)
+			}
+			if err := jsonpb.UnmarshalString(line, message); err != nil {
+				return senecaerror.NewUserError("", fmt.Errorf("error unmarshalling record %d - err: %w", i, err), "The archive is corrupt.")
+			}
+		case ProtoRecordFormat:
+			size, err := binary.ReadUvarint(reader)
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil || size > maxRecordSize {
+				return senecaerror.NewUserError("", fmt.Errorf("invalid size of record %d", i), "The archive is corrupt.")
+			}
+			data := make([]byte, size)
+			if _, err := io.ReadFull(reader, data); err != nil {
+				return senecaerror.NewUserError("", fmt.Errorf("error reading record %d - err: %w", i, err), "The archive is corrupt.")
+			}
+			if err := proto.Unmarshal(data, message); err != nil {
+				return senecaerror.NewUserError("", fmt.Errorf("error unmarshalling record %d - err: %w", i, err), "The archive is corrupt.")
+			}
+		default:
+			return senecaerror.NewDevError(fmt.Errorf("unsupported record format %q", format))
+		}
+
+		if err := f(message); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package userarchive
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"seneca/api/constants"
+	"seneca/api/senecaerror"
+	"seneca/internal/client/cloud"
+	"seneca/internal/client/database"
+	"seneca/internal/client/logging"
+	"seneca/internal/util"
+	"seneca/internal/util/data"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// exportPageSize is how many objects are read from the database at a time.
+const exportPageSize = 500
+
+// 	ExportOptions configures an export.
+type ExportOptions struct {
+	RecordFormat RecordFormat
+	// IncludeMedia adds the files of the user's RawVideos and RawFrames from storage.
+	IncludeMedia bool
+}
+
+// 	Exporter writes archives of users' data.
+type Exporter struct {
+	sql database.SQLInterface
+	// simpleStorage is only used if media is included.
+	simpleStorage cloud.SimpleStorageInterface
+	logger        logging.LoggingInterface
+}
+
+func NewExporter(sqlInterface database.SQLInterface, simpleStorage cloud.SimpleStorageInterface, logger logging.LoggingInterface) *Exporter {
+	return &Exporter{
+		sql:           sqlInterface,
+		simpleStorage: simpleStorage,
+		logger:        logger,
+	}
+}
+
+// media is a file to export with its object.
+type media struct {
+	tableName constants.TableName
+	recordID  string
+	sourceURL string
+}
+
+//	Export writes the archive of the user's data to w.  Nothing is written to w if the user doesn't exist.
+//	Params:
+//		ctx context.Context
+//		userID string
+//		options *ExportOptions
+//		w io.Writer
+//	Returns:
+//		*Manifest: the manifest written to the archive
+//		senecaerror.NotFoundError: if the user doesn't exist
+//		error
+func (e *Exporter) Export(ctx context.Context, userID string, options *ExportOptions, w io.Writer) (*Manifest, error) {
+	user, err := e.sql.GetByID(constants.UsersTable, userID)
+	var nfe *senecaerror.NotFoundError
+	if errors.As(err, &nfe) || (err == nil && user == nil) {
+		return nil, senecaerror.NewNotFoundError(fmt.Errorf("user %q not found", userID))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting user %q: %w", userID, err)
+	}
+
+	manifest := &Manifest{
+		FormatVersion: FormatVersion,
+		UserID:        userID,
+		CreateTimeMs:  util.TimeToMilliseconds(time.Now()),
+		RecordFormat:  options.RecordFormat,
+	}
+	archive := zip.NewWriter(w)
+
+	medias := []*media{}
+	for _, tableName := range constants.DataTableNames {
+		recordsFile, err := archive.Create(recordsPath(tableName, options.RecordFormat))
+		if err != nil {
+			return nil, fmt.Errorf("error creating records file for table %q: %w", tableName, err)
+		}
+		entry := &TableEntry{
+			TableName: tableName,
+			Path:      recordsPath(tableName, options.RecordFormat),
+		}
+
+		if err := e.forEachUserObject(ctx, userID, tableName, user, func(id string, object interface{}) error {
+			message, ok := object.(proto.Message)
+			if !ok {
+				return senecaerror.NewBadStateError(fmt.Errorf("object %q in table %q of type %T is not a proto.Message", id, tableName, object))
+			}
+			if err := writeRecord(recordsFile, options.RecordFormat, message); err != nil {
+				return fmt.Errorf("error writing object %q of table %q: %w", id, tableName, err)
+			}
+			entry.Count++
+
+			if sourceURL := data.CloudStorageFileName(object); sourceURL != "" {
+				medias = append(medias, &media{tableName: tableName, recordID: id, sourceURL: sourceURL})
+			}
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+		manifest.Tables = append(manifest.Tables, entry)
+	}
+
+	if options.IncludeMedia {
+		for _, m := range medias {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			entry, err := e.writeMedia(archive, m)
+			if err != nil {
+				return nil, err
+			}
+			manifest.Media = append(manifest.Media, entry)
+		}
+	}
+
+	manifestFile, err := archive.Create(ManifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("error creating manifest: %w", err)
+	}
+	encoder := json.NewEncoder(manifestFile)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return nil, fmt.Errorf("error writing manifest: %w", err)
+	}
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("error closing archive: %w", err)
+	}
+
+	e.logger.Log(fmt.Sprintf("Exported user %q: %d tables and %d media files", userID, len(manifest.Tables), len(manifest.Media)))
+	return manifest, nil
+}
+
+// forEachUserObject calls f with each of the user's objects in the table, a page at a time.
+func (e *Exporter) forEachUserObject(ctx context.Context, userID string, tableName constants.TableName, user interface{}, f func(id string, object interface{}) error) error {
+	// The user is the only object of theirs in the users table.
+	if tableName == constants.UsersTable {
+		return f(userID, user)
+	}
+
+	query := database.NewQuery(tableName).Where(constants.UserIDFieldName, "=", userID).WithLimit(exportPageSize)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		ids, nextCursor, err := e.sql.ListIDsByQuery(query)
+		if err != nil {
+			return fmt.Errorf("error listing IDs of user %q in table %q: %w", userID, tableName, err)
+		}
+		if len(ids) > 0 {
+			objects, err := e.sql.GetByIDs(tableName, ids)
+			if err != nil {
+				return fmt.Errorf("error getting %d objects from table %q: %w", len(ids), tableName, err)
+			}
+			for i, object := range objects {
+				if err := f(ids[i], object); err != nil {
+					return err
+				}
+			}
+		}
+
+		if nextCursor == "" {
+			return nil
+		}
+		query.WithCursor(nextCursor)
+	}
+}
+
+// writeMedia copies the file from storage into the archive.
+func (e *Exporter) writeMedia(archive *zip.Writer, m *media) (*MediaEntry, error) {
+	bucketName, fileName, err := data.GCSURLToBucketNameAndFileName(m.sourceURL)
+	if err != nil {
+		return nil, senecaerror.NewBadStateError(fmt.Errorf("object %q in table %q has invalid CloudStorageFileName %q - err: %w", m.recordID, m.tableName, m.sourceURL, err))
+	}
+
+	reader, err := e.simpleStorage.NewBucketFileReader(bucketName, fileName)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %q: %w", m.sourceURL, err)
+	}
+	defer reader.Close()
+
+	entry := &MediaEntry{
+		TableName: m.tableName,
+		RecordID:  m.recordID,
+		SourceURL: m.sourceURL,
+		Path:      mediaPath(m.tableName, m.recordID, m.sourceURL),
+	}
+	mediaFile, err := archive.CreateHeader(&zip.FileHeader{
+		Name: entry.Path,
+		// Videos and images are already compressed.
+		Method: zip.Store,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating %q in archive: %w", entry.Path, err)
+	}
+
+	hash := sha256.New()
+	entry.SizeBytes, err = io.Copy(io.MultiWriter(mediaFile, hash), reader)
+	if err != nil {
+		return nil, fmt.Errorf("error copying %q to archive: %w", m.sourceURL, err)
+	}
+	entry.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return entry, nil
+}
@@ -0,0 +1,174 @@
+package userarchive
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"seneca/api/constants"
+	"seneca/api/senecaerror"
+	st "seneca/api/type"
+	"seneca/internal/client/cloud"
+	"seneca/internal/client/cloud/local"
+	"seneca/internal/client/database"
+	"seneca/internal/client/logging"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+)
+
+func TestExport(t *testing.T) {
+	fakeSQL := database.NewFake()
+	storage, err := local.NewFileSystemStorageClient(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("NewFileSystemStorageClient() returns err: %v", err)
+	}
+	bucketName := cloud.RawVideoBucketName
+	if err := storage.CreateBucket(bucketName); err != nil {
+		t.Fatalf("CreateBucket() returns err: %v", err)
+	}
+	videoContents := []byte("not really an mp4")
+	writer, err := storage.NewBucketFileWriter(bucketName, "videos/a.MP4")
+	if err != nil {
+		t.Fatalf("NewBucketFileWriter() returns err: %v", err)
+	}
+	if _, err := writer.Write(videoContents); err != nil {
+		t.Fatalf("Write() returns err: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close() returns err: %v", err)
+	}
+
+	userID, err := fakeSQL.Create(constants.UsersTable, &st.User{Email: "user@seneca.dev"})
+	if err != nil {
+		t.Fatalf("Create() returns err: %v", err)
+	}
+	rawVideoID, err := fakeSQL.Create(constants.RawVideosTable, &st.RawVideo{UserId: userID, CloudStorageFileName: fmt.Sprintf("file://%s/videos/a.MP4", bucketName)})
+	if err != nil {
+		t.Fatalf("Create() returns err: %v", err)
+	}
+	// More events than fit in a page.
+	for i := 0; i < exportPageSize+1; i++ {
+		if _, err := fakeSQL.Create(constants.EventTable, &st.EventInternal{UserId: userID, TimestampMs: int64(i)}); err != nil {
+			t.Fatalf("Create() returns err: %v", err)
+		}
+	}
+	if _, err := fakeSQL.Create(constants.EventTable, &st.EventInternal{UserId: "otheruser"}); err != nil {
+		t.Fatalf("Create() returns err: %v", err)
+	}
+
+	exporter := NewExporter(fakeSQL, storage, logging.NewLocalLogger(true))
+	for _, format := range []RecordFormat{JSONRecordFormat, ProtoRecordFormat} {
+		t.Run(string(format), func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			manifest, err := exporter.Export(context.Background(), userID, &ExportOptions{RecordFormat: format, IncludeMedia: true}, buf)
+			if err != nil {
+				t.Fatalf("Export() returns err: %v", err)
+			}
+			archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			if err != nil {
+				t.Fatalf("zip.NewReader() returns err: %v", err)
+			}
+			files := map[string]*zip.File{}
+			for _, file := range archive.File {
+				files[file.Name] = file
+			}
+
+			readManifest := &Manifest{}
+			if err := json.Unmarshal(readFile(t, files[ManifestPath]), readManifest); err != nil {
+				t.Fatalf("Unmarshal() of the manifest returns err: %v", err)
+			}
+			if readManifest.FormatVersion != FormatVersion || readManifest.UserID != userID || readManifest.RecordFormat != format {
+				t.Fatalf("Want a manifest of user %q in format %q, got %+v", userID, format, readManifest)
+			}
+			if len(readManifest.Tables) != len(constants.DataTableNames) {
+				t.Fatalf("Want %d tables in the manifest, got %d", len(constants.DataTableNames), len(readManifest.Tables))
+			}
+
+			wantCounts := map[constants.TableName]int{constants.UsersTable: 1, constants.RawVideosTable: 1, constants.EventTable: exportPageSize + 1}
+			for _, entry := range manifest.Tables {
+				if entry.Count != wantCounts[entry.TableName] {
+					t.Fatalf("Want %d objects in table %q, got %d", wantCounts[entry.TableName], entry.TableName, entry.Count)
+				}
+				count := 0
+				if err := ReadRecords(bytes.NewReader(readFile(t, files[entry.Path])), format, func() proto.Message {
+					object, err := database.NewObjectForTable(entry.TableName)
+					if err != nil {
+						t.Fatalf("NewObjectForTable() returns err: %v", err)
+					}
+					return object.(proto.Message)
+				}, func(message proto.Message) error {
+					count++
+					if event, ok := message.(*st.EventInternal); ok && event.UserId != userID {
+						return fmt.Errorf("exported event of user %q", event.UserId)
+					}
+					return nil
+				}); err != nil {
+					t.Fatalf("ReadRecords(%q) returns err: %v", entry.Path, err)
+				}
+				if count != entry.Count {
+					t.Fatalf("Want %d records in %q, got %d", entry.Count, entry.Path, count)
+				}
+			}
+
+			if len(manifest.Media) != 1 {
+				t.Fatalf("Want 1 media file, got %d", len(manifest.Media))
+			}
+			media := manifest.Media[0]
+			if want := fmt.Sprintf("media/RawVideos/%s.mp4", rawVideoID); media.Path != want {
+				t.Fatalf("Want media path %q, got %q", want, media.Path)
+			}
+			sum := sha256.Sum256(videoContents)
+			if media.SHA256 != hex.EncodeToString(sum[:]) || media.SizeBytes != int64(len(videoContents)) {
+				t.Fatalf("Want the checksum and size of the video, got %+v", media)
+			}
+			if got := readFile(t, files[media.Path]); !bytes.Equal(got, videoContents) {
+				t.Fatalf("Want the video in the archive, got %q", got)
+			}
+		})
+	}
+}
+
+func TestExportErrors(t *testing.T) {
+	exporter := NewExporter(database.NewFake(), nil, logging.NewLocalLogger(true))
+
+	buf := &bytes.Buffer{}
+	_, err := exporter.Export(context.Background(), "missing", &ExportOptions{RecordFormat: JSONRecordFormat}, buf)
+	var nfe *senecaerror.NotFoundError
+	if !errors.As(err, &nfe) {
+		t.Fatalf("Want NotFoundError for a missing user, got %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("Want nothing written for a missing user, got %d bytes", buf.Len())
+	}
+
+	var ue *senecaerror.UserError
+	if _, err := ParseRecordFormat("xml"); !errors.As(err, &ue) {
+		t.Fatalf("Want UserError from ParseRecordFormat(%q), got %v", "xml", err)
+	}
+	if err := ReadRecords(bytes.NewReader([]byte{0xff}), ProtoRecordFormat, func() proto.Message { return &st.User{} }, func(proto.Message) error { return nil }); !errors.As(err, &ue) {
+		t.Fatalf("Want UserError for a corrupt records file, got %v", err)
+	}
+}
+
+func readFile(t *testing.T, file *zip.File) []byte {
+	t.Helper()
+	if file == nil {
+		t.Fatalf("File missing from the archive")
+	}
+	reader, err := file.Open()
+	if err != nil {
+		t.Fatalf("Open(%q) returns err: %v", file.Name, err)
+	}
+	defer reader.Close()
+	contents, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("ReadAll(%q) returns err: %v", file.Name, err)
+	}
+	return contents
+}
@@ -0,0 +1,542 @@
+package userarchive
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"seneca/api/constants"
+	"seneca/api/senecaerror"
+	st "seneca/api/type"
+	"seneca/internal/client/cloud"
+	"seneca/internal/client/database"
+	"seneca/internal/client/logging"
+	"seneca/internal/dao"
+	"seneca/internal/dao/integrity"
+	"seneca/internal/util/data"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// importBatchSize is how many RawLocations, RawMotions, RawFrames or RawVehicleSignals are inserted at a time.
+const importBatchSize = 500
+
+// importOrder is the order tables are imported in, so that every Source and TripId refers to an object
+// that was already imported.
+var importOrder = []constants.TableName{
+	constants.UsersTable,
+	constants.RawVideosTable,
+	constants.RawTelemetryFilesTable,
+	constants.RawLocationsTable,
+	constants.RawMotionsTable,
+	constants.RawFramesTable,
+	constants.RawVehicleSignalsTable,
+	constants.TripTable,
+	constants.DrivingConditionTable,
+	constants.EventTable,
+}
+
+// 	ImportOptions configures an import.
+type ImportOptions struct {
+	// UserID is the existing user to import the data into.  If empty, the user in the archive is created,
+	// which fails if a user with the same email already exists.
+	UserID string
+	// IncludeMedia uploads the files in the archive to storage.  Objects whose files weren't uploaded keep
+	// the CloudStorageFileName they were exported with.
+	IncludeMedia bool
+}
+
+// 	ImportResult describes the imported objects.
+type ImportResult struct {
+	UserID string
+	// IDs maps the IDs of the objects in the archive to the IDs of the imported objects, per table.
+	IDs           map[constants.TableName]map[string]string
+	MediaUploaded int
+}
+
+// 	Importer recreates the data in archives through the DAOs.
+type Importer struct {
+	daos *dao.AllDAOSet
+	// simpleStorage is only used if media is included.
+	simpleStorage cloud.SimpleStorageInterface
+	logger        logging.LoggingInterface
+	projectID     string
+}
+
+func NewImporter(daos *dao.AllDAOSet, simpleStorage cloud.SimpleStorageInterface, logger logging.LoggingInterface, projectID string) *Importer {
+	return &Importer{
+		daos:          daos,
+		simpleStorage: simpleStorage,
+		logger:        logger,
+		projectID:     projectID,
+	}
+}
+
+// importer holds the state of a single import.
+type importer struct {
+	*Importer
+	ctx      context.Context
+	options  *ImportOptions
+	manifest *Manifest
+	files    map[string]*zip.File
+	// media maps tables to the IDs of objects in the archive to their files.
+	media     map[constants.TableName]map[string]*MediaEntry
+	oldUserID string
+	result    *ImportResult
+	// The pending objects are inserted in batches, with their IDs in the archive.
+	pendingRawLocations      []*st.RawLocation
+	pendingRawMotions        []*st.RawMotion
+	pendingRawFrames         []*st.RawFrame
+	pendingRawVehicleSignals []*database.RawVehicleSignal
+	pendingIDs               []string
+}
+
+//	Import recreates the data in the archive with new IDs.  An import isn't atomic, if it fails the partially
+//	imported data can be removed with data.DeleteAllUserData.
+//	Params:
+//		ctx context.Context
+//		r io.ReaderAt: the archive
+//		size int64: the size of the archive
+//		options *ImportOptions
+//	Returns:
+//		*ImportResult: also returned with an error, to describe what was imported before it
+//		senecaerror.UserError: if the archive is corrupt or from a newer version
+//		error
+func (i *Importer) Import(ctx context.Context, r io.ReaderAt, size int64, options *ImportOptions) (*ImportResult, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, senecaerror.NewUserError(options.UserID, fmt.Errorf("error opening archive - err: %w", err), "The archive is not a zip file.")
+	}
+
+	imp := &importer{
+		Importer: i,
+		ctx:      ctx,
+		options:  options,
+		files:    map[string]*zip.File{},
+		media:    map[constants.TableName]map[string]*MediaEntry{},
+		result: &ImportResult{
+			UserID: options.UserID,
+			IDs:    map[constants.TableName]map[string]string{},
+		},
+	}
+	for _, file := range archive.File {
+		imp.files[file.Name] = file
+	}
+	if err := imp.readManifest(); err != nil {
+		return nil, err
+	}
+	imp.oldUserID = imp.manifest.UserID
+	for _, entry := range imp.manifest.Media {
+		if imp.media[entry.TableName] == nil {
+			imp.media[entry.TableName] = map[string]*MediaEntry{}
+		}
+		imp.media[entry.TableName][entry.RecordID] = entry
+	}
+	for _, tableName := range importOrder {
+		imp.result.IDs[tableName] = map[string]string{}
+	}
+
+	for _, tableName := range importOrder {
+		if err := imp.importTable(tableName); err != nil {
+			return imp.result, fmt.Errorf("error importing table %q: %w", tableName, err)
+		}
+		if imp.result.UserID == "" {
+			return nil, corruptArchiveError(fmt.Errorf("archive has no user"))
+		}
+	}
+
+	i.logger.Log(fmt.Sprintf("Imported user %q of the archive as user %q with %d media files", imp.oldUserID, imp.result.UserID, imp.result.MediaUploaded))
+	return imp.result, nil
+}
+
+func (imp *importer) readManifest() error {
+	contents, err := imp.readFile(ManifestPath)
+	if err != nil {
+		return err
+	}
+	imp.manifest = &Manifest{}
+	if err := json.Unmarshal(contents, imp.manifest); err != nil {
+		return corruptArchiveError(fmt.Errorf("error unmarshalling manifest - err: %w", err))
+	}
+	if imp.manifest.FormatVersion > FormatVersion {
+		return senecaerror.NewUserError(imp.options.UserID, fmt.Errorf("archive has format version %d, newer than %d", imp.manifest.FormatVersion, FormatVersion), "The archive is from a newer version of Seneca.")
+	}
+	if _, err := ParseRecordFormat(string(imp.manifest.RecordFormat)); err != nil {
+		return corruptArchiveError(err)
+	}
+	return nil
+}
+
+func (imp *importer) readFile(name string) ([]byte, error) {
+	reader, err := imp.openFile(name)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	contents, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, corruptArchiveError(fmt.Errorf("error reading %q - err: %w", name, err))
+	}
+	return contents, nil
+}
+
+func (imp *importer) openFile(name string) (io.ReadCloser, error) {
+	file, ok := imp.files[name]
+	if !ok {
+		return nil, corruptArchiveError(fmt.Errorf("%q is missing", name))
+	}
+	reader, err := file.Open()
+	if err != nil {
+		return nil, corruptArchiveError(fmt.Errorf("error opening %q - err: %w", name, err))
+	}
+	return reader, nil
+}
+
+func (imp *importer) importTable(tableName constants.TableName) error {
+	var entry *TableEntry
+	for _, e := range imp.manifest.Tables {
+		if e.TableName == tableName {
+			entry = e
+		}
+	}
+	if entry == nil {
+		return nil
+	}
+
+	reader, err := imp.openFile(entry.Path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	count := 0
+	if err := ReadRecords(reader, imp.manifest.RecordFormat, func() proto.Message {
+		// The table names were already checked.
+		object, _ := database.NewObjectForTable(tableName)
+		return object.(proto.Message)
+	}, func(message proto.Message) error {
+		if err := imp.ctx.Err(); err != nil {
+			return err
+		}
+		count++
+		return imp.importObject(message)
+	}); err != nil {
+		return err
+	}
+	if err := imp.flush(); err != nil {
+		return err
+	}
+
+	if count != entry.Count {
+		return corruptArchiveError(fmt.Errorf("manifest lists %d objects in %q, found %d", entry.Count, entry.Path, count))
+	}
+	return nil
+}
+
+// importObject imports the object or adds it to the pending batch.
+func (imp *importer) importObject(message proto.Message) error {
+	switch object := message.(type) {
+	case *st.User:
+		return imp.importUser(object)
+	case *st.RawVideo:
+		oldID := object.Id
+		if err := imp.remapRawObject(constants.RawVideosTable, &object.Id, &object.UserId, nil, &object.CloudStorageFileName); err != nil {
+			return err
+		}
+		rawVideo, err := imp.daos.RawVideoDAO.InsertUniqueRawVideo(object)
+		if err != nil {
+			return fmt.Errorf("error inserting RawVideo %q: %w", oldID, err)
+		}
+		imp.result.IDs[constants.RawVideosTable][oldID] = rawVideo.Id
+	case *database.RawTelemetryFile:
+		oldID := object.Id
+		if err := imp.remapRawObject(constants.RawTelemetryFilesTable, &object.Id, &object.UserId, nil, &object.CloudStorageFileName); err != nil {
+			return err
+		}
+		rawTelemetryFile, err := imp.daos.RawTelemetryFileDAO.InsertUniqueRawTelemetryFile(object)
+		if err != nil {
+			return fmt.Errorf("error inserting RawTelemetryFile %q: %w", oldID, err)
+		}
+		imp.result.IDs[constants.RawTelemetryFilesTable][oldID] = rawTelemetryFile.Id
+	case *st.RawLocation:
+		imp.pendingIDs = append(imp.pendingIDs, object.Id)
+		if err := imp.remapRawObject(constants.RawLocationsTable, &object.Id, &object.UserId, object.Source, nil); err != nil {
+			return err
+		}
+		imp.pendingRawLocations = append(imp.pendingRawLocations, object)
+	case *st.RawMotion:
+		imp.pendingIDs = append(imp.pendingIDs, object.Id)
+		if err := imp.remapRawObject(constants.RawMotionsTable, &object.Id, &object.UserId, object.Source, nil); err != nil {
+			return err
+		}
+		imp.pendingRawMotions = append(imp.pendingRawMotions, object)
+	case *st.RawFrame:
+		imp.pendingIDs = append(imp.pendingIDs, object.Id)
+		if err := imp.remapRawObject(constants.RawFramesTable, &object.Id, &object.UserId, object.Source, &object.CloudStorageFileName); err != nil {
+			return err
+		}
+		imp.pendingRawFrames = append(imp.pendingRawFrames, object)
+	case *database.RawVehicleSignal:
+		imp.pendingIDs = append(imp.pendingIDs, object.Id)
+		if err := imp.remapRawObject(constants.RawVehicleSignalsTable, &object.Id, &object.UserId, object.Source, nil); err != nil {
+			return err
+		}
+		imp.pendingRawVehicleSignals = append(imp.pendingRawVehicleSignals, object)
+	case *st.TripInternal:
+		oldID := object.Id
+		object.Id = ""
+		object.UserId = imp.result.UserID
+		trip, err := imp.daos.TripDAO.CreateUniqueTrip(imp.ctx, object)
+		if err != nil {
+			return fmt.Errorf("error creating trip %q: %w", oldID, err)
+		}
+		imp.result.IDs[constants.TripTable][oldID] = trip.Id
+	case *st.DrivingConditionInternal:
+		oldID, oldTripID := object.Id, object.TripId
+		object.Id = ""
+		object.UserId = imp.result.UserID
+		if err := imp.remapSource(object.Source); err != nil {
+			return err
+		}
+		// The condition is assigned to the imported trip it's in.
+		drivingCondition, err := imp.daos.DrivingConditionDAO.CreateDrivingCondition(imp.ctx, object)
+		if err != nil {
+			return fmt.Errorf("error creating driving condition %q: %w", oldID, err)
+		}
+		if err := imp.checkTripID(constants.DrivingConditionTable, oldID, oldTripID, drivingCondition.TripId); err != nil {
+			return err
+		}
+		imp.result.IDs[constants.DrivingConditionTable][oldID] = drivingCondition.Id
+	case *st.EventInternal:
+		oldID, oldTripID := object.Id, object.TripId
+		object.Id = ""
+		object.UserId = imp.result.UserID
+		if err := imp.remapSource(object.Source); err != nil {
+			return err
+		}
+		// The event is assigned to the imported trip it's in.
+		event, err := imp.daos.EventDAO.CreateEvent(imp.ctx, object)
+		if err != nil {
+			return fmt.Errorf("error creating event %q: %w", oldID, err)
+		}
+		if err := imp.checkTripID(constants.EventTable, oldID, oldTripID, event.TripId); err != nil {
+			return err
+		}
+		imp.result.IDs[constants.EventTable][oldID] = event.Id
+	default:
+		return senecaerror.NewDevError(fmt.Errorf("importing %T is not supported", message))
+	}
+
+	if len(imp.pendingIDs) >= importBatchSize {
+		return imp.flush()
+	}
+	return nil
+}
+
+func (imp *importer) importUser(user *st.User) error {
+	if imp.options.UserID != "" {
+		if _, err := imp.daos.UserDAO.GetUserByID(imp.options.UserID); err != nil {
+			return fmt.Errorf("error getting user %q: %w", imp.options.UserID, err)
+		}
+		imp.result.IDs[constants.UsersTable][user.Id] = imp.options.UserID
+		return nil
+	}
+
+	oldID := user.Id
+	user.Id = ""
+	newUser, err := imp.daos.UserDAO.InsertUniqueUser(user)
+	if err != nil {
+		return fmt.Errorf("error inserting user %q: %w", oldID, err)
+	}
+	imp.result.UserID = newUser.Id
+	imp.result.IDs[constants.UsersTable][oldID] = newUser.Id
+	return nil
+}
+
+// remapRawObject clears the ID of the raw object, moves it to the imported user, remaps its Source and
+// uploads its file if it has one.
+func (imp *importer) remapRawObject(tableName constants.TableName, id, userID *string, source *st.Source, cloudStorageFileName *string) error {
+	oldID := *id
+	*id = ""
+	*userID = imp.result.UserID
+	oldSourceID := source.GetSourceId()
+	if err := imp.remapSource(source); err != nil {
+		return err
+	}
+	if cloudStorageFileName == nil || !imp.options.IncludeMedia {
+		return nil
+	}
+	entry, ok := imp.media[tableName][oldID]
+	if !ok {
+		return nil
+	}
+
+	newURL, err := imp.uploadMedia(entry, oldSourceID, source.GetSourceId())
+	if err != nil {
+		return err
+	}
+	*cloudStorageFileName = newURL
+	return nil
+}
+
+// remapSource points the source to the imported object.
+func (imp *importer) remapSource(source *st.Source) error {
+	if source == nil || source.SourceId == "" {
+		return nil
+	}
+	tableName, ok := integrity.SourceTableName(source.SourceType)
+	if !ok {
+		return senecaerror.NewBadStateError(fmt.Errorf("source %q has unsupported type %s", source.SourceId, source.SourceType))
+	}
+	newID, ok := imp.result.IDs[tableName][source.SourceId]
+	if !ok {
+		return senecaerror.NewBadStateError(fmt.Errorf("source %q in table %q is not in the archive", source.SourceId, tableName))
+	}
+	source.SourceId = newID
+	return nil
+}
+
+// checkTripID verifies that the object was assigned to the trip it was in when it was exported.
+func (imp *importer) checkTripID(tableName constants.TableName, oldID, oldTripID, newTripID string) error {
+	if oldTripID == "" {
+		return nil
+	}
+	if want := imp.result.IDs[constants.TripTable][oldTripID]; want != newTripID {
+		return senecaerror.NewBadStateError(fmt.Errorf("object %q in table %q was in trip %q, imported as %q, but was assigned trip %q", oldID, tableName, oldTripID, want, newTripID))
+	}
+	return nil
+}
+
+// flush inserts the pending batch.
+func (imp *importer) flush() error {
+	if len(imp.pendingIDs) == 0 {
+		return nil
+	}
+
+	var tableName constants.TableName
+	newIDs := []string{}
+	switch {
+	case len(imp.pendingRawLocations) > 0:
+		tableName = constants.RawLocationsTable
+		rawLocations, err := imp.daos.RawLocationDAO.InsertUniqueRawLocations(imp.pendingRawLocations)
+		if err != nil {
+			return fmt.Errorf("error inserting %d RawLocations: %w", len(imp.pendingRawLocations), err)
+		}
+		for _, rawLocation := range rawLocations {
+			newIDs = append(newIDs, rawLocation.Id)
+		}
+	case len(imp.pendingRawMotions) > 0:
+		tableName = constants.RawMotionsTable
+		rawMotions, err := imp.daos.RawMotionDAO.InsertUniqueRawMotions(imp.pendingRawMotions)
+		if err != nil {
+			return fmt.Errorf("error inserting %d RawMotions: %w", len(imp.pendingRawMotions), err)
+		}
+		for _, rawMotion := range rawMotions {
+			newIDs = append(newIDs, rawMotion.Id)
+		}
+	case len(imp.pendingRawFrames) > 0:
+		tableName = constants.RawFramesTable
+		rawFrames, err := imp.daos.RawFrameDAO.InsertUniqueRawFrames(imp.pendingRawFrames)
+		if err != nil {
+			return fmt.Errorf("error inserting %d RawFrames: %w", len(imp.pendingRawFrames), err)
+		}
+		for _, rawFrame := range rawFrames {
+			newIDs = append(newIDs, rawFrame.Id)
+		}
+	case len(imp.pendingRawVehicleSignals) > 0:
+		tableName = constants.RawVehicleSignalsTable
+		rawVehicleSignals, err := imp.daos.RawVehicleSignalDAO.InsertUniqueRawVehicleSignals(imp.pendingRawVehicleSignals)
+		if err != nil {
+			return fmt.Errorf("error inserting %d RawVehicleSignals: %w", len(imp.pendingRawVehicleSignals), err)
+		}
+		for _, rawVehicleSignal := range rawVehicleSignals {
+			newIDs = append(newIDs, rawVehicleSignal.Id)
+		}
+	}
+
+	for i, oldID := range imp.pendingIDs {
+		imp.result.IDs[tableName][oldID] = newIDs[i]
+	}
+	imp.pendingRawLocations, imp.pendingRawMotions, imp.pendingRawFrames, imp.pendingRawVehicleSignals, imp.pendingIDs = nil, nil, nil, nil, nil
+	return nil
+}
+
+// renameMediaFile renames a media file for the imported user and source.  File names are dot separated, starting with
+// the user ID and, for RawFrames, followed by the RawVideo ID, e.g. "<userID>.<rawVideoID>.<timestampMs>.png".  Only
+// those components are replaced, since IDs may also appear in timestamps or other IDs.  Files that don't start with
+// the old user ID are prefixed with the new one.
+func renameMediaFile(fileName, oldUserID, newUserID, oldSourceID, newSourceID string) string {
+	components := strings.Split(fileName, ".")
+	if components[0] != oldUserID {
+		components = append([]string{newUserID}, components...)
+	}
+	components[0] = newUserID
+	// The last component is the extension.
+	if oldSourceID != "" && len(components) > 2 && components[1] == oldSourceID {
+		components[1] = newSourceID
+	}
+	return strings.Join(components, ".")
+}
+
+// uploadMedia uploads the file of the entry and returns its new CloudStorageFileName.  The file is renamed
+// for the imported user and, for RawFrames, the imported RawVideo, since both IDs are part of the file names.
+func (imp *importer) uploadMedia(entry *MediaEntry, oldSourceID, newSourceID string) (string, error) {
+	bucketName, oldFileName, err := data.GCSURLToBucketNameAndFileName(entry.SourceURL)
+	if err != nil {
+		return "", corruptArchiveError(fmt.Errorf("media %q has invalid source URL %q - err: %w", entry.Path, entry.SourceURL, err))
+	}
+	fileName := renameMediaFile(path.Base(oldFileName), imp.oldUserID, imp.result.UserID, oldSourceID, newSourceID)
+
+	if bucketExists, err := imp.simpleStorage.BucketExists(bucketName); err != nil {
+		return "", fmt.Errorf("BucketExists(%s) returns err: %w", bucketName, err)
+	} else if !bucketExists {
+		if err := imp.simpleStorage.CreateBucket(bucketName); err != nil {
+			return "", fmt.Errorf("CreateBucket(%s) returns err: %w", bucketName, err)
+		}
+	}
+	if exists, err := imp.simpleStorage.BucketFileExists(bucketName, fileName); err != nil {
+		return "", fmt.Errorf("error checking if file %q in bucket %q exists: %w", fileName, bucketName, err)
+	} else if exists {
+		return "", senecaerror.NewBadStateError(fmt.Errorf("attempting to overwrite existing file %q", fileName))
+	}
+
+	reader, err := imp.openFile(entry.Path)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	w, err := imp.simpleStorage.NewBucketFileWriter(bucketName, fileName)
+	if err != nil {
+		return "", fmt.Errorf("NewBucketFileWriter(%s, %s) returns err: %w", bucketName, fileName, err)
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(w, hash), reader); err != nil {
+		w.Abort()
+		return "", fmt.Errorf("error streaming %q to bucket %q - err: %w", fileName, bucketName, err)
+	}
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("error closing writer for %q in bucket %q - err: %w", fileName, bucketName, err)
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != entry.SHA256 {
+		imp.simpleStorage.DeleteBucketFile(bucketName, fileName)
+		return "", corruptArchiveError(fmt.Errorf("media %q has checksum %s, manifest lists %s", entry.Path, sum, entry.SHA256))
+	}
+	imp.result.MediaUploaded++
+
+	// Like rawvideohandler, videos are stored with the bare bucket name and frames with the real one.
+	scheme := imp.simpleStorage.URLScheme()
+	if entry.TableName == constants.RawFramesTable {
+		return scheme.BucketFileURL(bucketName.RealNameForScheme(scheme, imp.projectID), fileName), nil
+	}
+	return scheme.BucketFileURL(bucketName.String(), fileName), nil
+}
+
+func corruptArchiveError(err error) error {
+	return senecaerror.NewUserError("", err, "The archive is corrupt.")
+}
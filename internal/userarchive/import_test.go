@@ -0,0 +1,262 @@
+package userarchive
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"seneca/api/constants"
+	"seneca/api/senecaerror"
+	st "seneca/api/type"
+	"seneca/internal/client/cloud"
+	"seneca/internal/client/cloud/local"
+	"seneca/internal/client/database"
+	"seneca/internal/client/logging"
+	"seneca/internal/dao/sqldaoset"
+	"seneca/internal/util/data"
+	"testing"
+	"time"
+)
+
+const testProjectID = "test-project"
+
+func TestImportRemapsIDs(t *testing.T) {
+	logger := logging.NewLocalLogger(true)
+	sourceSQL := database.NewFake()
+	sourceStorage := newTestStorage(t)
+	sourceDAOs := sqldaoset.New(sourceSQL, logger, time.Minute)
+
+	user, err := sourceDAOs.UserDAO.InsertUniqueUser(&st.User{Email: "user@seneca.dev"})
+	if err != nil {
+		t.Fatalf("InsertUniqueUser() returns err: %v", err)
+	}
+	rawVideo, err := sourceDAOs.RawVideoDAO.InsertUniqueRawVideo(&st.RawVideo{
+		UserId:               user.Id,
+		CreateTimeMs:         1000,
+		CloudStorageFileName: fmt.Sprintf("file://%s/%s.1000.RAW_VIDEO.mp4", cloud.RawVideoBucketName, user.Id),
+	})
+	if err != nil {
+		t.Fatalf("InsertUniqueRawVideo() returns err: %v", err)
+	}
+	videoSource := &st.Source{SourceId: rawVideo.Id, SourceType: st.Source_RAW_VIDEO}
+	rawFrames, err := sourceDAOs.RawFrameDAO.InsertUniqueRawFrames([]*st.RawFrame{{
+		UserId:               user.Id,
+		TimestampMs:          1000,
+		CloudStorageFileName: fmt.Sprintf("file://%s/%s.%s.1000.png", cloud.RawFrameBucketName.RealName(testProjectID), user.Id, rawVideo.Id),
+		Source:               videoSource,
+	}})
+	if err != nil {
+		t.Fatalf("InsertUniqueRawFrames() returns err: %v", err)
+	}
+	writeTestFile(t, sourceStorage, rawVideo.CloudStorageFileName, "video")
+	writeTestFile(t, sourceStorage, rawFrames[0].CloudStorageFileName, "frame")
+	rawLocations, err := sourceDAOs.RawLocationDAO.InsertUniqueRawLocations([]*st.RawLocation{{UserId: user.Id, TimestampMs: 1000, Source: videoSource}})
+	if err != nil {
+		t.Fatalf("InsertUniqueRawLocations() returns err: %v", err)
+	}
+	rawMotions, err := sourceDAOs.RawMotionDAO.InsertUniqueRawMotions([]*st.RawMotion{{UserId: user.Id, TimestampMs: 1000, Source: videoSource}})
+	if err != nil {
+		t.Fatalf("InsertUniqueRawMotions() returns err: %v", err)
+	}
+	drivingCondition, err := sourceDAOs.DrivingConditionDAO.CreateDrivingCondition(context.Background(), &st.DrivingConditionInternal{
+		UserId:      user.Id,
+		StartTimeMs: 1000,
+		EndTimeMs:   5000,
+		Source:      &st.Source{SourceId: rawLocations[0].Id, SourceType: st.Source_RAW_LOCATION},
+	})
+	if err != nil {
+		t.Fatalf("CreateDrivingCondition() returns err: %v", err)
+	}
+	event, err := sourceDAOs.EventDAO.CreateEvent(context.Background(), &st.EventInternal{
+		UserId:      user.Id,
+		TimestampMs: 2000,
+		Source:      &st.Source{SourceId: rawMotions[0].Id, SourceType: st.Source_RAW_MOTION},
+	})
+	if err != nil {
+		t.Fatalf("CreateEvent() returns err: %v", err)
+	}
+
+	archive := &bytes.Buffer{}
+	if _, err := NewExporter(sourceSQL, sourceStorage, logger).Export(context.Background(), user.Id, &ExportOptions{RecordFormat: ProtoRecordFormat, IncludeMedia: true}, archive); err != nil {
+		t.Fatalf("Export() returns err: %v", err)
+	}
+
+	targetStorage := newTestStorage(t)
+	targetDAOs := sqldaoset.New(database.NewFake(), logger, time.Minute)
+	importer := NewImporter(targetDAOs, targetStorage, logger, testProjectID)
+	result, err := importer.Import(context.Background(), bytes.NewReader(archive.Bytes()), int64(archive.Len()), &ImportOptions{IncludeMedia: true})
+	if err != nil {
+		t.Fatalf("Import() returns err: %v", err)
+	}
+	if result.UserID == "" || result.UserID == user.Id || result.MediaUploaded != 2 {
+		t.Fatalf("Want a new user with 2 media files, got %+v", result)
+	}
+	newID := func(tableName constants.TableName, oldID string) string {
+		id, ok := result.IDs[tableName][oldID]
+		if !ok {
+			t.Fatalf("Object %q in table %q wasn't imported", oldID, tableName)
+		}
+		return id
+	}
+
+	newUser, err := targetDAOs.UserDAO.GetUserByID(result.UserID)
+	if err != nil || newUser.Email != user.Email {
+		t.Fatalf("Want the imported user, got %v, %v", newUser, err)
+	}
+
+	newRawVideo, err := targetDAOs.RawVideoDAO.GetRawVideoByID(newID(constants.RawVideosTable, rawVideo.Id))
+	if err != nil {
+		t.Fatalf("GetRawVideoByID() returns err: %v", err)
+	}
+	if want := fmt.Sprintf("file://%s/%s.1000.RAW_VIDEO.mp4", cloud.RawVideoBucketName, result.UserID); newRawVideo.CloudStorageFileName != want || newRawVideo.UserId != result.UserID {
+		t.Fatalf("Want the RawVideo of user %q in %q, got %v", result.UserID, want, newRawVideo)
+	}
+	readTestFile(t, targetStorage, newRawVideo.CloudStorageFileName, "video")
+
+	newRawFrame, err := targetDAOs.RawFrameDAO.GetRawFrameByID(newID(constants.RawFramesTable, rawFrames[0].Id))
+	if err != nil {
+		t.Fatalf("GetRawFrameByID() returns err: %v", err)
+	}
+	if newRawFrame.Source.SourceId != newRawVideo.Id {
+		t.Fatalf("Want the RawFrame sourced from RawVideo %q, got %v", newRawVideo.Id, newRawFrame.Source)
+	}
+	if want := fmt.Sprintf("file://%s/%s.%s.1000.png", cloud.RawFrameBucketName.RealName(testProjectID), result.UserID, newRawVideo.Id); newRawFrame.CloudStorageFileName != want {
+		t.Fatalf("Want the RawFrame in %q, got %q", want, newRawFrame.CloudStorageFileName)
+	}
+	readTestFile(t, targetStorage, newRawFrame.CloudStorageFileName, "frame")
+
+	newRawLocation, err := targetDAOs.RawLocationDAO.GetRawLocationByID(newID(constants.RawLocationsTable, rawLocations[0].Id))
+	if err != nil || newRawLocation.Source.SourceId != newRawVideo.Id {
+		t.Fatalf("Want the RawLocation sourced from RawVideo %q, got %v, %v", newRawVideo.Id, newRawLocation, err)
+	}
+	newRawMotionID := newID(constants.RawMotionsTable, rawMotions[0].Id)
+
+	newTripID := newID(constants.TripTable, drivingCondition.TripId)
+	trip, err := targetDAOs.TripDAO.GetTripByID(result.UserID, newTripID)
+	if err != nil || trip.StartTimeMs != 1000 || trip.EndTimeMs != 5000 {
+		t.Fatalf("Want the trip from 1000 to 5000, got %v, %v", trip, err)
+	}
+	newDrivingCondition, err := targetDAOs.DrivingConditionDAO.GetDrivingConditionByID(result.UserID, newTripID, newID(constants.DrivingConditionTable, drivingCondition.Id))
+	if err != nil || newDrivingCondition.Source.SourceId != newRawLocation.Id {
+		t.Fatalf("Want the driving condition sourced from RawLocation %q, got %v, %v", newRawLocation.Id, newDrivingCondition, err)
+	}
+	newEvent, err := targetDAOs.EventDAO.GetEventByID(result.UserID, newTripID, newID(constants.EventTable, event.Id))
+	if err != nil || newEvent.Source.SourceId != newRawMotionID {
+		t.Fatalf("Want the event sourced from RawMotion %q, got %v, %v", newRawMotionID, newEvent, err)
+	}
+
+	// The user already exists, so only importing into it can restore its data.
+	if _, err := importer.Import(context.Background(), bytes.NewReader(archive.Bytes()), int64(archive.Len()), &ImportOptions{}); err == nil {
+		t.Fatalf("Want err importing a user with an existing email")
+	}
+
+	// Restore the deleted data of the source user.
+	if err := data.DeleteAllUserData(user.Id, false, sourceSQL, sourceStorage, logger); err != nil {
+		t.Fatalf("DeleteAllUserData() returns err: %v", err)
+	}
+	result, err = NewImporter(sourceDAOs, sourceStorage, logger, testProjectID).Import(context.Background(), bytes.NewReader(archive.Bytes()), int64(archive.Len()), &ImportOptions{UserID: user.Id, IncludeMedia: true})
+	if err != nil {
+		t.Fatalf("Import() into the existing user returns err: %v", err)
+	}
+	rawVideoIDs, err := sourceDAOs.RawVideoDAO.ListUserRawVideoIDs(user.Id)
+	if err != nil || len(rawVideoIDs) != 1 || rawVideoIDs[0] != newID(constants.RawVideosTable, rawVideo.Id) {
+		t.Fatalf("Want the restored RawVideo, got %v, %v", rawVideoIDs, err)
+	}
+	readTestFile(t, sourceStorage, rawVideo.CloudStorageFileName, "video")
+}
+
+func TestImportRejectsNewerArchives(t *testing.T) {
+	archive := &bytes.Buffer{}
+	w := zip.NewWriter(archive)
+	f, err := w.Create(ManifestPath)
+	if err != nil {
+		t.Fatalf("Create() returns err: %v", err)
+	}
+	fmt.Fprintf(f, `{"format_version": %d, "user_id": "1", "record_format": "json"}`, FormatVersion+1)
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() returns err: %v", err)
+	}
+
+	importer := NewImporter(sqldaoset.New(database.NewFake(), logging.NewLocalLogger(true), time.Minute), nil, logging.NewLocalLogger(true), testProjectID)
+	_, err = importer.Import(context.Background(), bytes.NewReader(archive.Bytes()), int64(archive.Len()), &ImportOptions{})
+	var ue *senecaerror.UserError
+	if !errors.As(err, &ue) {
+		t.Fatalf("Want UserError for a newer archive, got %v", err)
+	}
+}
+
+func newTestStorage(t *testing.T) *local.FileSystemStorageClient {
+	t.Helper()
+	storage, err := local.NewFileSystemStorageClient(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("NewFileSystemStorageClient() returns err: %v", err)
+	}
+	return storage
+}
+
+func writeTestFile(t *testing.T, storage cloud.SimpleStorageInterface, url, contents string) {
+	t.Helper()
+	bucketName, fileName, err := data.GCSURLToBucketNameAndFileName(url)
+	if err != nil {
+		t.Fatalf("GCSURLToBucketNameAndFileName(%q) returns err: %v", url, err)
+	}
+	if exists, err := storage.BucketExists(bucketName); err != nil {
+		t.Fatalf("BucketExists() returns err: %v", err)
+	} else if !exists {
+		if err := storage.CreateBucket(bucketName); err != nil {
+			t.Fatalf("CreateBucket() returns err: %v", err)
+		}
+	}
+	w, err := storage.NewBucketFileWriter(bucketName, fileName)
+	if err != nil {
+		t.Fatalf("NewBucketFileWriter() returns err: %v", err)
+	}
+	if _, err := w.Write([]byte(contents)); err != nil {
+		t.Fatalf("Write() returns err: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() returns err: %v", err)
+	}
+}
+
+func readTestFile(t *testing.T, storage cloud.SimpleStorageInterface, url, want string) {
+	t.Helper()
+	bucketName, fileName, err := data.GCSURLToBucketNameAndFileName(url)
+	if err != nil {
+		t.Fatalf("GCSURLToBucketNameAndFileName(%q) returns err: %v", url, err)
+	}
+	r, err := storage.NewBucketFileReader(bucketName, fileName)
+	if err != nil {
+		t.Fatalf("NewBucketFileReader(%q) returns err: %v", url, err)
+	}
+	defer r.Close()
+	got, err := ioutil.ReadAll(r)
+	if err != nil || string(got) != want {
+		t.Fatalf("Want %q in %q, got %q, %v", want, url, got, err)
+	}
+}
+
+func TestRenameMediaFile(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		fileName    string
+		oldSourceID string
+		newSourceID string
+		want        string
+	}{
+		{desc: "raw video", fileName: "1.1621234561000.RAW_VIDEO.mp4", want: "12.1621234561000.RAW_VIDEO.mp4"},
+		{desc: "raw frame", fileName: "1.2.1621234561000.png", oldSourceID: "2", newSourceID: "21", want: "12.21.1621234561000.png"},
+		{desc: "source ID in timestamp only", fileName: "1.3.1621234562000.png", oldSourceID: "2", newSourceID: "21", want: "12.3.1621234562000.png"},
+		{desc: "no user ID", fileName: "track.gpx", want: "12.track.gpx"},
+		{desc: "user ID not first", fileName: "2.1.png", want: "12.2.1.png"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := renameMediaFile(tc.fileName, "1", "12", tc.oldSourceID, tc.newSourceID); got != tc.want {
+				t.Errorf("renameMediaFile(%q) = %q, want %q", tc.fileName, got, tc.want)
+			}
+		})
+	}
+}
@@ -6,8 +6,9 @@ import (
 	st "seneca/api/type"
 	"seneca/internal/client/cloud"
 	"seneca/internal/util"
-	"strings"
 	"time"
+
+	"gopkg.in/ugjka/go-tz.v2/tz"
 )
 
 // 	ConstructCutVideoData data generates the st.CutVideo list based on the input raw video and how long the cut videos should be.
@@ -163,6 +164,82 @@ func degreesToFloat64(degrees int32, degreeMinutes int32, degreeSeconds float64)
 	return float64(degrees) + (float64(degreeMinutes) / 60) + (degreeSeconds / float64(3600))
 }
 
+//	Float64ToLatitude is the inverse of LatitudeToFloat64.
+//	Params:
+//		latitude float64: in degrees, negative in the south
+//	Returns:
+//		*st.Latitude
+func Float64ToLatitude(latitude float64) *st.Latitude {
+	degrees, degreeMinutes, degreeSeconds := float64ToDegrees(math.Abs(latitude))
+	lat := &st.Latitude{
+		Degrees:       degrees,
+		DegreeMinutes: degreeMinutes,
+		DegreeSeconds: degreeSeconds,
+		LatDirection:  st.Latitude_NORTH,
+	}
+	if latitude < 0 {
+		lat.LatDirection = st.Latitude_SOUTH
+	}
+	return lat
+}
+
+//	Float64ToLongitude is the inverse of LongitudeToFloat64.
+//	Params:
+//		longitude float64: in degrees, negative in the west
+//	Returns:
+//		*st.Longitude
+func Float64ToLongitude(longitude float64) *st.Longitude {
+	degrees, degreeMinutes, degreeSeconds := float64ToDegrees(math.Abs(longitude))
+	long := &st.Longitude{
+		Degrees:       degrees,
+		DegreeMinutes: degreeMinutes,
+		DegreeSeconds: degreeSeconds,
+		LongDirection: st.Longitude_EAST,
+	}
+	if longitude < 0 {
+		long.LongDirection = st.Longitude_WEST
+	}
+	return long
+}
+
+func float64ToDegrees(absl float64) (int32, int32, float64) {
+	degrees := math.Floor(absl)
+	minutes := math.Floor((absl - degrees) * 60)
+	seconds := (absl - degrees - minutes/60) * 3600
+	return int32(degrees), int32(minutes), seconds
+}
+
+//	TZOffset returns the offset from UTC of the time zone at the location, at time t.  Times are stored in the
+//	local time of where they were recorded, so GPS times, which are in UTC, are shifted by it.
+//	Params:
+//		t time.Time
+//		location *st.Location
+//	Returns:
+//		time.Duration
+//		error
+func TZOffset(t time.Time, location *st.Location) (time.Duration, error) {
+	latFloat64 := LatitudeToFloat64(location.Lat)
+	longFloat64 := LongitudeToFloat64(location.Long)
+
+	timeZoneIDs, err := tz.GetZone(tz.Point{Lat: latFloat64, Lon: longFloat64})
+	if err != nil {
+		return 0, fmt.Errorf("tz.GetZone(%f, %f) returns err: %w", latFloat64, longFloat64, err)
+	}
+
+	if len(timeZoneIDs) == 0 {
+		return 0, fmt.Errorf("tz.GetZone(%f, %f) returns 0 timeZoneIDs", latFloat64, longFloat64)
+	}
+
+	tzLocation, err := time.LoadLocation(timeZoneIDs[0])
+	if err != nil {
+		return 0, fmt.Errorf("time.LoadLocation(%s) returns err: %w", timeZoneIDs[0], err)
+	}
+
+	_, offset := t.In(tzLocation).Zone()
+
+	return time.Second * time.Duration(offset), nil
+}
+
 func DistanceMiles(lat1 *st.Latitude, long1 *st.Longitude, lat2 *st.Latitude, long2 *st.Longitude) float64 {
 	// Source: https://www.geodatasource.com/developers/go
 	const PI float64 = 3.141592653589793
@@ -186,18 +263,12 @@ func DistanceMiles(lat1 *st.Latitude, long1 *st.Longitude, lat2 *st.Latitude, lo
 	return dist
 }
 
+// GCSURLToBucketNameAndFileName splits a CloudStorageFileName URL into its BucketName and file name.
+// Despite the name, URLs of any cloud.URLScheme (gs://, s3://, file://) are accepted.
 func GCSURLToBucketNameAndFileName(url string) (cloud.BucketName, string, error) {
-	if !strings.HasPrefix(url, "gs://") {
-		return "", "", fmt.Errorf("%q is not a GCS URL", url)
-	}
-
-	url = strings.TrimPrefix(url, "gs://")
-	urlParts := strings.Split(url, "/")
-
-	bucketName, err := cloud.ParseBucketName(urlParts[0])
+	_, bucketName, fileName, err := cloud.ParseBucketFileURL(url)
 	if err != nil {
-		return "", "", fmt.Errorf("%q is not a GCS URL", url)
+		return "", "", err
 	}
-
-	return bucketName, strings.Join(urlParts[1:], "/"), nil
+	return bucketName, fileName, nil
 }
@@ -2,7 +2,9 @@ package data
 
 import (
 	"fmt"
+	"math"
 	st "seneca/api/type"
+	"seneca/internal/client/cloud"
 	"seneca/internal/util"
 	"testing"
 	"time"
@@ -149,6 +151,22 @@ func TestLatitudeToFloat(t *testing.T) {
 	}
 }
 
+func TestFloat64ToLatitudeAndLongitude(t *testing.T) {
+	for _, degrees := range []float64{0, 15, 40.437033, -33.8688, 89.999999, -0.5} {
+		if got := LatitudeToFloat64(Float64ToLatitude(degrees)); math.Abs(got-degrees) > 1e-9 {
+			t.Errorf("Want latitude %f after round trip, got %f", degrees, got)
+		}
+		if got := LongitudeToFloat64(Float64ToLongitude(degrees * 2)); math.Abs(got-degrees*2) > 1e-9 {
+			t.Errorf("Want longitude %f after round trip, got %f", degrees*2, got)
+		}
+	}
+
+	lat := Float64ToLatitude(-15.11)
+	if lat.Degrees != 15 || lat.DegreeMinutes != 6 || math.Abs(lat.DegreeSeconds-36) > 1e-6 || lat.LatDirection != st.Latitude_SOUTH {
+		t.Errorf("Want 15° 6' 36\" S, got %v", lat)
+	}
+}
+
 func TestDistanceMiles(t *testing.T) {
 	testCases := []struct {
 		desc  string
@@ -196,3 +214,66 @@ func TestDistanceMiles(t *testing.T) {
 		})
 	}
 }
+
+func TestGCSURLToBucketNameAndFileName(t *testing.T) {
+	testCases := []struct {
+		desc           string
+		url            string
+		wantBucketName cloud.BucketName
+		wantFileName   string
+		wantErr        bool
+	}{
+		{
+			desc:           "gcs raw video",
+			url:            "gs://raw_videos/user.123.RAW_VIDEO.mp4",
+			wantBucketName: cloud.RawVideoBucketName,
+			wantFileName:   "user.123.RAW_VIDEO.mp4",
+		},
+		{
+			desc:           "gcs raw frame with real bucket name",
+			url:            "gs://project-raw_frames/user.video.0.png",
+			wantBucketName: cloud.RawFrameBucketName,
+			wantFileName:   "user.video.0.png",
+		},
+		{
+			desc:           "s3 raw frame with real bucket name",
+			url:            "s3://project-raw-frames/user.video.0.png",
+			wantBucketName: cloud.RawFrameBucketName,
+			wantFileName:   "user.video.0.png",
+		},
+		{
+			desc:           "local raw video",
+			url:            "file://raw_videos/user.123.RAW_VIDEO.mp4",
+			wantBucketName: cloud.RawVideoBucketName,
+			wantFileName:   "user.123.RAW_VIDEO.mp4",
+		},
+		{
+			desc:    "unsupported scheme",
+			url:     "https://raw_videos/user.123.RAW_VIDEO.mp4",
+			wantErr: true,
+		},
+		{
+			desc:    "unknown bucket",
+			url:     "s3://other/user.123.RAW_VIDEO.mp4",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			gotBucketName, gotFileName, err := GCSURLToBucketNameAndFileName(tc.url)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("Want err from GCSURLToBucketNameAndFileName(%s), got nil", tc.url)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GCSURLToBucketNameAndFileName(%s) returns err: %v", tc.url, err)
+			}
+			if gotBucketName != tc.wantBucketName || gotFileName != tc.wantFileName {
+				t.Errorf("Want %q, %q, got %q, %q", tc.wantBucketName, tc.wantFileName, gotBucketName, gotFileName)
+			}
+		})
+	}
+}
@@ -4,12 +4,15 @@ import (
 	"context"
 	"fmt"
 	"seneca/api/constants"
+	st "seneca/api/type"
 	"seneca/internal/client/cloud"
 	"seneca/internal/client/database"
 	"seneca/internal/client/logging"
 	"seneca/internal/dao/rawframedao"
 	"seneca/internal/dao/rawlocationdao"
 	"seneca/internal/dao/rawmotiondao"
+	"seneca/internal/dao/rawtelemetryfiledao"
+	"seneca/internal/dao/rawvehiclesignaldao"
 	"seneca/internal/dao/rawvideodao"
 )
 
@@ -60,12 +63,37 @@ func DeleteAllUserData(userID string, includeUser bool, sqlInterface database.SQ
 
 		storageClient.DeleteBucketFile(bucketName, fileName)
 	}
+	rawTelemetryFileDAO := rawtelemetryfiledao.NewSQLRawTelemetryFileDAO(sqlInterface)
+	rawTelemetryFileIDs, err := rawTelemetryFileDAO.ListUserRawTelemetryFileIDs(userID)
+	if err != nil {
+		return fmt.Errorf("ListUserRawTelemetryFileIDs(%s) returns err: %v", userID, err)
+	}
+	for _, rtfid := range rawTelemetryFileIDs {
+		rawTelemetryFile, err := rawTelemetryFileDAO.GetRawTelemetryFileByID(rtfid)
+		if err != nil {
+			return fmt.Errorf("GetRawTelemetryFileByID(%s) returns err: %v", rtfid, err)
+		}
+
+		if rawTelemetryFile.CloudStorageFileName == "" {
+			continue
+		}
+
+		bucketName, fileName, err := GCSURLToBucketNameAndFileName(rawTelemetryFile.CloudStorageFileName)
+		if err != nil {
+			return fmt.Errorf("GCSURLToBucketNameAndFileName(%s) returns err: %v", rawTelemetryFile.CloudStorageFileName, err)
+		}
+
+		storageClient.DeleteBucketFile(bucketName, fileName)
+	}
 
 	for _, tableName := range constants.DataTableNames {
-		if tableName == constants.UsersTable && includeUser {
-			if err := sqlInterface.DeleteByID(tableName, userID); err != nil {
-				return fmt.Errorf("DeleteByID(%s, %s) returns err: %w", tableName, userID, err)
+		if tableName == constants.UsersTable {
+			if includeUser {
+				if err := sqlInterface.DeleteByID(tableName, userID); err != nil {
+					return fmt.Errorf("DeleteByID(%s, %s) returns err: %w", tableName, userID, err)
+				}
 			}
+			continue
 		}
 
 		ids, err := sqlInterface.ListIDs(tableName, []*database.QueryParam{{FieldName: constants.UserIDFieldName, Operand: "=", Value: userID}})
@@ -79,14 +107,61 @@ func DeleteAllUserData(userID string, includeUser bool, sqlInterface database.SQ
 		}
 	}
 
+	// Soft deleted objects and their files are deleted too.
+	tombstoneIDs, err := sqlInterface.ListIDs(constants.TombstonesTable, []*database.QueryParam{{FieldName: constants.UserIDFieldName, Operand: "=", Value: userID}})
+	if err != nil {
+		return fmt.Errorf("ListIDs(%s, %s) returns err: %w", constants.TombstonesTable, userID, err)
+	}
+	for _, id := range tombstoneIDs {
+		tombstoneObj, err := sqlInterface.GetByID(constants.TombstonesTable, id)
+		if err != nil {
+			return fmt.Errorf("GetByID(%s, %s) returns err: %w", constants.TombstonesTable, id, err)
+		}
+		if tombstone, ok := tombstoneObj.(*database.Tombstone); ok {
+			object, err := tombstone.UnmarshalObject()
+			if err != nil {
+				return fmt.Errorf("UnmarshalObject() of tombstone %s returns err: %w", id, err)
+			}
+			if url := CloudStorageFileName(object); url != "" {
+				bucketName, fileName, err := GCSURLToBucketNameAndFileName(url)
+				if err != nil {
+					return fmt.Errorf("GCSURLToBucketNameAndFileName(%s) returns err: %v", url, err)
+				}
+				storageClient.DeleteBucketFile(bucketName, fileName)
+			}
+		}
+		if err := sqlInterface.DeleteByID(constants.TombstonesTable, id); err != nil {
+			return fmt.Errorf("DeleteByID(%s, %s) returns err: %w", constants.TombstonesTable, id, err)
+		}
+	}
+
 	return nil
 }
 
+//	CloudStorageFileName returns the storage URL of objects that have a file in storage, or "" if the object has none.
+//	Params:
+//		object interface{}: an object from one of the constants.DataTableNames
+//	Returns:
+//		string
+func CloudStorageFileName(object interface{}) string {
+	switch o := object.(type) {
+	case *st.RawVideo:
+		return o.CloudStorageFileName
+	case *st.RawFrame:
+		return o.CloudStorageFileName
+	case *database.RawTelemetryFile:
+		return o.CloudStorageFileName
+	default:
+		return ""
+	}
+}
+
 func RemoveAllUserAlgoTagsInDB(userID string, dbClient database.SQLInterface, logger logging.LoggingInterface) error {
 	rawVideoDAO := rawvideodao.NewSQLRawVideoDAO(dbClient, logger, 0)
 	rawLocationDAO := rawlocationdao.NewSQLRawLocationDAO(dbClient)
 	rawMotionDAO := rawmotiondao.NewSQLRawMotionDAO(dbClient, logger)
 	rawFrameDAO := rawframedao.NewSQLRawFrameDAO(dbClient)
+	rawVehicleSignalDAO := rawvehiclesignaldao.NewSQLRawVehicleSignalDAO(dbClient)
 
 	unprocessedRawVideoIDs, err := rawVideoDAO.ListUserRawVideoIDs(userID)
 	if err != nil {
@@ -162,5 +237,24 @@ func RemoveAllUserAlgoTagsInDB(userID string, dbClient database.SQLInterface, lo
 		}
 	}
 
+	rawVehicleSignalIDs, err := rawVehicleSignalDAO.ListUserRawVehicleSignalIDs(userID)
+	if err != nil {
+		logger.Error(fmt.Sprintf("ListUserRawVehicleSignalIDs(%s) returns err: %v", userID, err))
+	}
+
+	for _, rvsid := range rawVehicleSignalIDs {
+		rawVehicleSignal, err := rawVehicleSignalDAO.GetRawVehicleSignalByID(rvsid)
+		if err != nil {
+			logger.Error(fmt.Sprintf("GetRawVehicleSignalByID(%s) returns err: %v", rvsid, err))
+			continue
+		}
+		if rawVehicleSignal.AlgosVersion != 0 {
+			rawVehicleSignal.AlgosVersion = 0
+			if err := rawVehicleSignalDAO.PutRawVehicleSignalByID(context.TODO(), rawVehicleSignal.Id, rawVehicleSignal); err != nil {
+				return fmt.Errorf("PutRawVehicleSignalByID() returns err: %w", err)
+			}
+		}
+	}
+
 	return nil
 }
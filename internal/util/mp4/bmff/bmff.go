@@ -0,0 +1,143 @@
+// Package bmff reads the ISO base media file format (ISO/IEC 14496-12) boxes of MP4s that Seneca needs, e.g. the
+// creation time and duration in moov/mvhd and the samples of timed metadata tracks, without decoding any media.
+package bmff
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	headerSize      = 8
+	largeHeaderSize = 16
+	// maxDataSize is the largest box ReadData reads, so a corrupt size can't exhaust memory.
+	maxDataSize = 64 << 20
+	// maxSampleCount bounds the samples of a track whose samples all have the same size, which has no table to
+	// check the count against.
+	maxSampleCount = 1 << 24
+)
+
+// macEpoch is the epoch of the times in mvhd, tkhd and mdhd.
+var macEpoch = time.Date(1904, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// 	Box is the header of a box.
+type Box struct {
+	// Type is the box's four character code, e.g. "moov".
+	Type string
+	// Offset is where the box's header starts in the file.
+	Offset int64
+	// Size includes the header.
+	Size       int64
+	HeaderSize int64
+}
+
+// DataOffset is where the box's data starts in the file.
+func (b *Box) DataOffset() int64 {
+	return b.Offset + b.HeaderSize
+}
+
+// DataSize is the size of the box without its header.
+func (b *Box) DataSize() int64 {
+	return b.Size - b.HeaderSize
+}
+
+//	ReadBoxes reads the headers of the boxes between start and end, e.g. the top level boxes of a file or the
+//	children of a box.
+//	Params:
+//		r io.ReaderAt
+//		start int64
+//		end int64
+//	Returns:
+//		[]*Box
+//		error: if a box doesn't fit between start and end
+func ReadBoxes(r io.ReaderAt, start, end int64) ([]*Box, error) {
+	boxes := []*Box{}
+	header := make([]byte, largeHeaderSize)
+	for offset := start; offset+headerSize <= end; {
+		if _, err := r.ReadAt(header[:headerSize], offset); err != nil {
+			return nil, fmt.Errorf("error reading box header at %d: %w", offset, err)
+		}
+		box := &Box{
+			Type:       string(header[4:8]),
+			Offset:     offset,
+			Size:       int64(binary.BigEndian.Uint32(header[0:4])),
+			HeaderSize: headerSize,
+		}
+		switch box.Size {
+		case 0:
+			// The box extends to the end, e.g. the mdat of a recording that was cut off.
+			box.Size = end - offset
+		case 1:
+			if _, err := r.ReadAt(header[headerSize:largeHeaderSize], offset+headerSize); err != nil {
+				return nil, fmt.Errorf("error reading large size of box %q at %d: %w", box.Type, offset, err)
+			}
+			box.Size = int64(binary.BigEndian.Uint64(header[headerSize:largeHeaderSize]))
+			box.HeaderSize = largeHeaderSize
+		}
+		if box.Size < box.HeaderSize || box.Size > end-offset {
+			return nil, fmt.Errorf("box %q at %d has invalid size %d", box.Type, offset, box.Size)
+		}
+		boxes = append(boxes, box)
+		offset += box.Size
+	}
+	return boxes, nil
+}
+
+//	ReadChildren reads the headers of the box's children.
+//	Params:
+//		r io.ReaderAt
+//		box *Box
+//	Returns:
+//		[]*Box
+//		error
+func ReadChildren(r io.ReaderAt, box *Box) ([]*Box, error) {
+	return ReadBoxes(r, box.DataOffset(), box.Offset+box.Size)
+}
+
+//	ReadData reads the box without its header.
+//	Params:
+//		r io.ReaderAt
+//		box *Box
+//	Returns:
+//		[]byte
+//		error
+func ReadData(r io.ReaderAt, box *Box) ([]byte, error) {
+	if box.DataSize() > maxDataSize {
+		return nil, fmt.Errorf("box %q at %d is too large to read, size %d", box.Type, box.Offset, box.Size)
+	}
+	data := make([]byte, box.DataSize())
+	if _, err := r.ReadAt(data, box.DataOffset()); err != nil {
+		return nil, fmt.Errorf("error reading box %q at %d: %w", box.Type, box.Offset, err)
+	}
+	return data, nil
+}
+
+// Find returns the first box of the type, or nil if there's none.
+func Find(boxes []*Box, boxType string) *Box {
+	for _, box := range boxes {
+		if box.Type == boxType {
+			return box
+		}
+	}
+	return nil
+}
+
+// macTime converts seconds since macEpoch to a time, 0 is the zero time.
+func macTime(seconds uint64) time.Time {
+	if seconds == 0 {
+		return time.Time{}
+	}
+	return macEpoch.Add(time.Duration(seconds) * time.Second)
+}
+
+// scaledDuration converts a duration in timescale units per second to a time.Duration.
+func scaledDuration(value uint64, timescale uint32) time.Duration {
+	if timescale == 0 {
+		return 0
+	}
+	seconds := value / uint64(timescale)
+	remainder := value % uint64(timescale)
+	return time.Duration(seconds)*time.Second + time.Duration(remainder)*time.Second/time.Duration(timescale)
+}
@@ -0,0 +1,182 @@
+package bmff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func box(boxType string, payloads ...[]byte) []byte {
+	data := bytes.Join(payloads, nil)
+	return append(append(u32(uint32(len(data)+headerSize)), boxType...), data...)
+}
+
+func u16(v uint16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	return b
+}
+
+func u32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
+
+func u64(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+func macSeconds(t time.Time) uint64 {
+	return uint64(t.Sub(macEpoch) / time.Second)
+}
+
+// sampleEntry is a sample description of the format, with a compressorname if it's a visual sample entry.
+func sampleEntry(format, compressorName string) []byte {
+	entry := make([]byte, 8)
+	if compressorName != "" {
+		visual := make([]byte, 34+32)
+		visual[34] = byte(len(compressorName))
+		copy(visual[35:], compressorName)
+		entry = append(entry, visual...)
+	}
+	return box(format, entry)
+}
+
+func TestReadMovie(t *testing.T) {
+	createTime := time.Date(2021, time.February, 13, 17, 47, 49, 0, time.UTC)
+	ftyp := box("ftyp", []byte("avc1"), u32(0), []byte("isomavc1"))
+	samples := [][]byte{[]byte("abc"), []byte("defg"), []byte("hijkl"), []byte("mnopqr"), []byte("stuvwxy")}
+	mdat := box("mdat", samples...)
+	mdatData := uint32(len(ftyp) + headerSize)
+
+	metaTrack := box("trak",
+		// Version 1 header.
+		box("tkhd", []byte{1, 0, 0, 7}, u64(macSeconds(createTime)), u64(0), u32(2), u32(0), u64(60000)),
+		box("mdia",
+			box("mdhd", u32(0), u32(0), u32(0), u32(1000), u32(2500)),
+			box("hdlr", u32(0), u32(0), []byte("meta"), make([]byte, 12)),
+			box("minf", box("stbl",
+				box("stsd", u32(0), u32(1), sampleEntry("gpmd", "")),
+				box("stts", u32(0), u32(1), u32(5), u32(500)),
+				// Two samples in the first chunk, three in the second.
+				box("stsc", u32(0), u32(2), u32(1), u32(2), u32(1), u32(2), u32(3), u32(1)),
+				box("stsz", u32(0), u32(0), u32(5), u32(3), u32(4), u32(5), u32(6), u32(7)),
+				box("co64", u32(0), u32(2), u64(uint64(mdatData)), u64(uint64(mdatData+7))),
+			)),
+		),
+	)
+	videoTrack := box("trak",
+		box("tkhd", u32(0), u32(uint32(macSeconds(createTime))), u32(0), u32(1), u32(0), u32(59000)),
+		box("mdia",
+			box("hdlr", u32(0), u32(0), []byte("vide"), make([]byte, 12)),
+			box("minf", box("stbl",
+				box("stsd", u32(0), u32(1), sampleEntry("avc1", "Ambarella AVC encoder")),
+			)),
+		),
+	)
+	moov := box("moov",
+		box("mvhd", u32(0), u32(uint32(macSeconds(createTime))), u32(0), u32(1000), u32(60000), make([]byte, 80)),
+		videoTrack,
+		metaTrack,
+		box("udta", box("cprt", u16(0), []byte("Seneca"))),
+	)
+	file := bytes.Join([][]byte{ftyp, mdat, moov}, nil)
+	r := bytes.NewReader(file)
+
+	movie, err := ReadMovie(r, int64(len(file)))
+	if err != nil {
+		t.Fatalf("ReadMovie() returns err: %v", err)
+	}
+
+	if movie.MajorBrand != "avc1" || !movie.CreationTime.Equal(createTime) || movie.Duration != time.Minute {
+		t.Errorf("Want brand avc1, creation time %v and duration 1m, got %q, %v and %v", createTime, movie.MajorBrand, movie.CreationTime, movie.Duration)
+	}
+	if len(movie.Boxes) != 3 || len(movie.UserData) != 1 || movie.UserData[0].Type != "cprt" {
+		t.Errorf("Want 3 top level boxes and a cprt in moov/udta, got %v and %v", movie.Boxes, movie.UserData)
+	}
+	if len(movie.Tracks) != 2 {
+		t.Fatalf("Want 2 tracks, got %d", len(movie.Tracks))
+	}
+
+	video := movie.Tracks[0]
+	if video.ID != 1 || video.Duration != time.Second*59 || video.HandlerType != "vide" || video.Format != "avc1" || video.CompressorName != "Ambarella AVC encoder" || len(video.Samples) != 0 {
+		t.Errorf("Unexpected video track %+v", video)
+	}
+
+	meta := movie.Tracks[1]
+	if meta.ID != 2 || !meta.CreationTime.Equal(createTime) || meta.Duration != time.Minute || meta.HandlerType != "meta" || meta.Format != "gpmd" || meta.CompressorName != "" {
+		t.Errorf("Unexpected meta track %+v", meta)
+	}
+	if len(meta.Samples) != len(samples) {
+		t.Fatalf("Want %d samples, got %d", len(samples), len(meta.Samples))
+	}
+	for i, sample := range meta.Samples {
+		if sample.Time != time.Duration(i)*time.Millisecond*500 || sample.Duration != time.Millisecond*500 {
+			t.Errorf("Want sample %d at %v for 500ms, got %v for %v", i, time.Duration(i)*time.Millisecond*500, sample.Time, sample.Duration)
+		}
+		data, err := ReadSample(r, sample)
+		if err != nil {
+			t.Fatalf("ReadSample() returns err: %v", err)
+		}
+		if !bytes.Equal(data, samples[i]) {
+			t.Errorf("Want sample %d %q, got %q", i, samples[i], data)
+		}
+	}
+}
+
+func TestReadBoxesLargeAndOpenEndedSizes(t *testing.T) {
+	large := append(append(u32(1), "mdat"...), u64(20)...)
+	large = append(large, "abcd"...)
+	openEnded := append(append(u32(0), "free"...), "rest of file"...)
+	file := append(large, openEnded...)
+
+	boxes, err := ReadBoxes(bytes.NewReader(file), 0, int64(len(file)))
+	if err != nil {
+		t.Fatalf("ReadBoxes() returns err: %v", err)
+	}
+	if len(boxes) != 2 {
+		t.Fatalf("Want 2 boxes, got %d", len(boxes))
+	}
+	if boxes[0].Type != "mdat" || boxes[0].Size != 20 || boxes[0].DataOffset() != 16 || boxes[0].DataSize() != 4 {
+		t.Errorf("Unexpected large box %+v", boxes[0])
+	}
+	if boxes[1].Type != "free" || boxes[1].Offset != 20 || boxes[1].Size != int64(len(openEnded)) {
+		t.Errorf("Unexpected open ended box %+v", boxes[1])
+	}
+}
+
+func TestReadMovieRejectsMalformedFiles(t *testing.T) {
+	testCases := []struct {
+		desc string
+		file []byte
+	}{
+		{
+			desc: "box overruns file",
+			file: append(u32(100), "ftyp"...),
+		},
+		{
+			desc: "no moov",
+			file: box("ftyp", []byte("avc1")),
+		},
+		{
+			desc: "no mvhd",
+			file: box("moov", box("trak")),
+		},
+		{
+			desc: "truncated mvhd",
+			file: box("moov", box("mvhd", u32(0), u32(0))),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if _, err := ReadMovie(bytes.NewReader(tc.file), int64(len(tc.file))); err == nil {
+				t.Errorf("Want err from ReadMovie(), got nil")
+			}
+		})
+	}
+}
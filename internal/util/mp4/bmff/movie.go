@@ -0,0 +1,482 @@
+package bmff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// 	Movie is what Seneca reads from an MP4's ftyp and moov boxes.
+type Movie struct {
+	// MajorBrand is ftyp's major brand, e.g. "avc1".
+	MajorBrand   string
+	CreationTime time.Time
+	Duration     time.Duration
+	Tracks       []*Track
+	// Boxes are the top level boxes, e.g. the "free" box dashcams store their own data in.
+	Boxes []*Box
+	// UserData are the children of moov/udta, if any.
+	UserData []*Box
+}
+
+// 	Track is what Seneca reads from a moov/trak box.
+type Track struct {
+	ID           uint32
+	CreationTime time.Time
+	// Duration is tkhd's duration.
+	Duration time.Duration
+	// HandlerType is hdlr's handler type, e.g. "vide" or "meta".
+	HandlerType string
+	// Format is the format of the first sample description, e.g. "avc1" or "gpmd".
+	Format string
+	// CompressorName is the compressor of a video track's first sample description, e.g. "Ambarella AVC encoder".
+	CompressorName string
+	Samples        []*Sample
+}
+
+// 	Sample is where a sample of a track is stored and when it's played.
+type Sample struct {
+	Offset int64
+	Size   int64
+	// Time is the sample's decode time from the start of the track.
+	Time     time.Duration
+	Duration time.Duration
+}
+
+//	ReadMovie reads the movie of the MP4.
+//	Params:
+//		r io.ReaderAt
+//		size int64: the size of the MP4
+//	Returns:
+//		*Movie
+//		error: if the MP4 is malformed or has no moov/mvhd box
+func ReadMovie(r io.ReaderAt, size int64) (*Movie, error) {
+	boxes, err := ReadBoxes(r, 0, size)
+	if err != nil {
+		return nil, fmt.Errorf("error reading top level boxes: %w", err)
+	}
+	movie := &Movie{Boxes: boxes}
+
+	if ftyp := Find(boxes, "ftyp"); ftyp != nil {
+		data, err := ReadData(r, ftyp)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) >= 4 {
+			movie.MajorBrand = string(data[:4])
+		}
+	}
+
+	moov := Find(boxes, "moov")
+	if moov == nil {
+		return nil, fmt.Errorf("no moov box")
+	}
+	moovChildren, err := ReadChildren(r, moov)
+	if err != nil {
+		return nil, fmt.Errorf("error reading moov: %w", err)
+	}
+
+	mvhd := Find(moovChildren, "mvhd")
+	if mvhd == nil {
+		return nil, fmt.Errorf("no moov/mvhd box")
+	}
+	data, err := ReadData(r, mvhd)
+	if err != nil {
+		return nil, err
+	}
+	header, err := readTimeHeader(data, false)
+	if err != nil {
+		return nil, fmt.Errorf("error reading mvhd: %w", err)
+	}
+	movie.CreationTime = header.creationTime
+	movie.Duration = scaledDuration(header.duration, header.timescale)
+
+	for _, box := range moovChildren {
+		switch box.Type {
+		case "trak":
+			track, err := readTrack(r, box, header.timescale)
+			if err != nil {
+				return nil, fmt.Errorf("error reading trak at %d: %w", box.Offset, err)
+			}
+			movie.Tracks = append(movie.Tracks, track)
+		case "udta":
+			if movie.UserData, err = ReadChildren(r, box); err != nil {
+				return nil, fmt.Errorf("error reading moov/udta: %w", err)
+			}
+		}
+	}
+
+	return movie, nil
+}
+
+//	ReadSample reads the sample's data.
+//	Params:
+//		r io.ReaderAt
+//		sample *Sample
+//	Returns:
+//		[]byte
+//		error
+func ReadSample(r io.ReaderAt, sample *Sample) ([]byte, error) {
+	if sample.Size > maxDataSize {
+		return nil, fmt.Errorf("sample at %d is too large to read, size %d", sample.Offset, sample.Size)
+	}
+	data := make([]byte, sample.Size)
+	if _, err := r.ReadAt(data, sample.Offset); err != nil {
+		return nil, fmt.Errorf("error reading sample at %d: %w", sample.Offset, err)
+	}
+	return data, nil
+}
+
+func readTrack(r io.ReaderAt, trak *Box, movieTimescale uint32) (*Track, error) {
+	track := &Track{}
+	children, err := ReadChildren(r, trak)
+	if err != nil {
+		return nil, err
+	}
+
+	if tkhd := Find(children, "tkhd"); tkhd != nil {
+		data, err := ReadData(r, tkhd)
+		if err != nil {
+			return nil, err
+		}
+		header, err := readTimeHeader(data, true)
+		if err != nil {
+			return nil, fmt.Errorf("error reading tkhd: %w", err)
+		}
+		track.ID = header.trackID
+		track.CreationTime = header.creationTime
+		track.Duration = scaledDuration(header.duration, movieTimescale)
+	}
+
+	mdia := Find(children, "mdia")
+	if mdia == nil {
+		return track, nil
+	}
+	mdiaChildren, err := ReadChildren(r, mdia)
+	if err != nil {
+		return nil, err
+	}
+
+	timescale := uint32(0)
+	if mdhd := Find(mdiaChildren, "mdhd"); mdhd != nil {
+		data, err := ReadData(r, mdhd)
+		if err != nil {
+			return nil, err
+		}
+		header, err := readTimeHeader(data, false)
+		if err != nil {
+			return nil, fmt.Errorf("error reading mdhd: %w", err)
+		}
+		timescale = header.timescale
+	}
+
+	if hdlr := Find(mdiaChildren, "hdlr"); hdlr != nil {
+		data, err := ReadData(r, hdlr)
+		if err != nil {
+			return nil, err
+		}
+		// version and flags, then pre_defined, then handler_type.
+		if len(data) < 12 {
+			return nil, fmt.Errorf("hdlr is too short, length %d", len(data))
+		}
+		track.HandlerType = string(data[8:12])
+	}
+
+	minf := Find(mdiaChildren, "minf")
+	if minf == nil {
+		return track, nil
+	}
+	minfChildren, err := ReadChildren(r, minf)
+	if err != nil {
+		return nil, err
+	}
+	stbl := Find(minfChildren, "stbl")
+	if stbl == nil {
+		return track, nil
+	}
+	if err := readSampleTable(r, stbl, timescale, track); err != nil {
+		return nil, fmt.Errorf("error reading stbl: %w", err)
+	}
+
+	return track, nil
+}
+
+// timeHeader holds the fields mvhd, tkhd and mdhd have in common, and tkhd's track ID.
+type timeHeader struct {
+	creationTime time.Time
+	trackID      uint32
+	timescale    uint32
+	duration     uint64
+}
+
+// readTimeHeader reads an mvhd or mdhd, or a tkhd if isTrackHeader.
+func readTimeHeader(data []byte, isTrackHeader bool) (*timeHeader, error) {
+	fr := &fieldReader{data: data}
+	version := fr.uint8()
+	fr.skip(3)
+
+	header := &timeHeader{}
+	if version == 1 {
+		header.creationTime = macTime(fr.uint64())
+		fr.skip(8)
+	} else {
+		header.creationTime = macTime(uint64(fr.uint32()))
+		fr.skip(4)
+	}
+	if isTrackHeader {
+		// tkhd has the track ID and a reserved field instead of a timescale.
+		header.trackID = fr.uint32()
+		fr.skip(4)
+	} else {
+		header.timescale = fr.uint32()
+	}
+	if version == 1 {
+		header.duration = fr.uint64()
+	} else {
+		header.duration = uint64(fr.uint32())
+	}
+
+	if fr.err != nil {
+		return nil, fr.err
+	}
+	return header, nil
+}
+
+// readSampleTable reads the track's sample description and where its samples are.
+func readSampleTable(r io.ReaderAt, stbl *Box, timescale uint32, track *Track) error {
+	children, err := ReadChildren(r, stbl)
+	if err != nil {
+		return err
+	}
+	tables := map[string]*fieldReader{}
+	for _, name := range []string{"stsd", "stts", "stsc", "stsz", "stco", "co64"} {
+		box := Find(children, name)
+		if box == nil {
+			continue
+		}
+		data, err := ReadData(r, box)
+		if err != nil {
+			return err
+		}
+		tables[name] = &fieldReader{data: data}
+		// Every table starts with a version and flags.
+		tables[name].skip(4)
+	}
+
+	if stsd, ok := tables["stsd"]; ok && stsd.uint32() > 0 {
+		entryStart := stsd.offset
+		stsd.skip(4)
+		track.Format = string(stsd.bytes(4))
+		if track.HandlerType == "vide" {
+			// The visual sample entry's compressorname is a 32 byte Pascal string after 8 bytes of the sample
+			// entry and 34 bytes of the visual sample entry.
+			stsd.offset = entryStart + 8 + 8 + 34
+			name := stsd.bytes(32)
+			if len(name) == 32 && int(name[0]) < 32 {
+				track.CompressorName = string(bytes.TrimRight(name[1:1+name[0]], "\x00"))
+			}
+		}
+		if stsd.err != nil {
+			return fmt.Errorf("error reading stsd: %w", stsd.err)
+		}
+	}
+
+	sizes, err := readSampleSizes(tables["stsz"])
+	if err != nil {
+		return err
+	}
+	if len(sizes) == 0 {
+		return nil
+	}
+	chunkOffsets, err := readChunkOffsets(tables["stco"], tables["co64"])
+	if err != nil {
+		return err
+	}
+	samplesPerChunk, err := readSamplesPerChunk(tables["stsc"], len(chunkOffsets))
+	if err != nil {
+		return err
+	}
+	deltas, err := readSampleDeltas(tables["stts"], len(sizes))
+	if err != nil {
+		return err
+	}
+
+	sampleIndex := 0
+	decodeTime := uint64(0)
+	for chunk, chunkOffset := range chunkOffsets {
+		offset := chunkOffset
+		for i := uint32(0); i < samplesPerChunk[chunk] && sampleIndex < len(sizes); i++ {
+			track.Samples = append(track.Samples, &Sample{
+				Offset:   offset,
+				Size:     sizes[sampleIndex],
+				Time:     scaledDuration(decodeTime, timescale),
+				Duration: scaledDuration(deltas[sampleIndex], timescale),
+			})
+			offset += sizes[sampleIndex]
+			decodeTime += deltas[sampleIndex]
+			sampleIndex++
+		}
+	}
+	if sampleIndex != len(sizes) {
+		return fmt.Errorf("chunks hold %d samples, stsz has %d", sampleIndex, len(sizes))
+	}
+	return nil
+}
+
+func readSampleSizes(stsz *fieldReader) ([]int64, error) {
+	if stsz == nil {
+		return nil, nil
+	}
+	size := stsz.uint32()
+	count := 0
+	if size != 0 {
+		// Every sample has the same size, so there are no entries.
+		count = int(stsz.uint32())
+		if count > maxSampleCount {
+			return nil, fmt.Errorf("stsz has too many samples, %d", count)
+		}
+	} else {
+		count = stsz.count(4)
+	}
+	sizes := make([]int64, 0, count)
+	for i := 0; i < count; i++ {
+		if size != 0 {
+			sizes = append(sizes, int64(size))
+		} else {
+			sizes = append(sizes, int64(stsz.uint32()))
+		}
+	}
+	if stsz.err != nil {
+		return nil, fmt.Errorf("error reading stsz: %w", stsz.err)
+	}
+	return sizes, nil
+}
+
+func readChunkOffsets(stco, co64 *fieldReader) ([]int64, error) {
+	offsets := []int64{}
+	switch {
+	case stco != nil:
+		count := stco.count(4)
+		for i := 0; i < count; i++ {
+			offsets = append(offsets, int64(stco.uint32()))
+		}
+		if stco.err != nil {
+			return nil, fmt.Errorf("error reading stco: %w", stco.err)
+		}
+	case co64 != nil:
+		count := co64.count(8)
+		for i := 0; i < count; i++ {
+			offsets = append(offsets, int64(co64.uint64()))
+		}
+		if co64.err != nil {
+			return nil, fmt.Errorf("error reading co64: %w", co64.err)
+		}
+	default:
+		return nil, fmt.Errorf("no stco or co64 box")
+	}
+	return offsets, nil
+}
+
+// readSamplesPerChunk expands stsc's runs into the number of samples of each chunk.
+func readSamplesPerChunk(stsc *fieldReader, chunkCount int) ([]uint32, error) {
+	if stsc == nil {
+		return nil, fmt.Errorf("no stsc box")
+	}
+	samplesPerChunk := make([]uint32, chunkCount)
+	count := stsc.count(12)
+	for i := 0; i < count; i++ {
+		firstChunk := int(stsc.uint32())
+		samples := stsc.uint32()
+		stsc.skip(4)
+		if firstChunk < 1 || firstChunk > chunkCount {
+			return nil, fmt.Errorf("stsc entry %d has invalid first chunk %d", i, firstChunk)
+		}
+		// Each run lasts until the next one starts.
+		for chunk := firstChunk - 1; chunk < chunkCount; chunk++ {
+			samplesPerChunk[chunk] = samples
+		}
+	}
+	if stsc.err != nil {
+		return nil, fmt.Errorf("error reading stsc: %w", stsc.err)
+	}
+	return samplesPerChunk, nil
+}
+
+// readSampleDeltas expands stts's runs into the duration of each sample.
+func readSampleDeltas(stts *fieldReader, sampleCount int) ([]uint64, error) {
+	deltas := make([]uint64, 0, sampleCount)
+	if stts != nil {
+		count := stts.count(8)
+		for i := 0; i < count; i++ {
+			samples := stts.uint32()
+			delta := stts.uint32()
+			for j := uint32(0); j < samples && len(deltas) < sampleCount; j++ {
+				deltas = append(deltas, uint64(delta))
+			}
+		}
+		if stts.err != nil {
+			return nil, fmt.Errorf("error reading stts: %w", stts.err)
+		}
+	}
+	for len(deltas) < sampleCount {
+		deltas = append(deltas, 0)
+	}
+	return deltas, nil
+}
+
+// fieldReader reads big-endian fields, remembering the first read past the end of the data.
+type fieldReader struct {
+	data   []byte
+	offset int
+	err    error
+}
+
+func (fr *fieldReader) bytes(n int) []byte {
+	if fr.err != nil {
+		return nil
+	}
+	if n < 0 || fr.offset+n > len(fr.data) {
+		fr.err = fmt.Errorf("reading %d bytes at %d overruns length %d", n, fr.offset, len(fr.data))
+		return nil
+	}
+	b := fr.data[fr.offset : fr.offset+n]
+	fr.offset += n
+	return b
+}
+
+func (fr *fieldReader) skip(n int) {
+	fr.bytes(n)
+}
+
+func (fr *fieldReader) uint8() uint8 {
+	if b := fr.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (fr *fieldReader) uint32() uint32 {
+	if b := fr.bytes(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (fr *fieldReader) uint64() uint64 {
+	if b := fr.bytes(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+// count reads an entry count, failing if fewer entries of entrySize remain.
+func (fr *fieldReader) count(entrySize int) int {
+	count := int(fr.uint32())
+	if fr.err == nil && count > (len(fr.data)-fr.offset)/entrySize {
+		fr.err = fmt.Errorf("%d entries of %d bytes overrun length %d", count, entrySize, len(fr.data))
+		return 0
+	}
+	return count
+}
@@ -0,0 +1,406 @@
+// Package gpmf decodes GPMF, the key-length-value metadata format GoPro-style cameras store in "gpmd" tracks,
+// e.g. GPS5 GPS fixes and ACCL and GYRO IMU samples.
+package gpmf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	// nestedType is the type of elements whose data are more elements, e.g. DEVC and STRM.
+	nestedType = 0
+	headerSize = 8
+
+	deviceKey      = "DEVC"
+	streamKey      = "STRM"
+	streamNameKey  = "STNM"
+	scaleKey       = "SCAL"
+	gpsTimeKey     = "GPSU"
+	gpsFixKey      = "GPSF"
+	gpsSamplesKey  = "GPS5"
+	gpsTimeLayout  = "060102150405.000"
+	gpsSampleWidth = 5
+
+	accelerometerKey = "ACCL"
+	gyroscopeKey     = "GYRO"
+	orientationKey   = "ORIN"
+	imuSampleWidth   = 3
+)
+
+// 	Element is a GPMF key-length-value.
+type Element struct {
+	// Key is the element's four character code, e.g. "GPS5".
+	Key string
+	// Type is the element's type character, e.g. 'l' for int32, or 0 if it's nested.
+	Type byte
+	// Size is the size of each of the element's samples.
+	Size int
+	// Repeat is the number of samples.
+	Repeat int
+	// Data is the element's data without padding.
+	Data     []byte
+	Children []*Element
+}
+
+//	Parse parses GPMF, e.g. a sample of a gpmd track.
+//	Params:
+//		data []byte
+//	Returns:
+//		[]*Element
+//		error
+func Parse(data []byte) ([]*Element, error) {
+	elements := []*Element{}
+	for offset := 0; offset+headerSize <= len(data); {
+		element := &Element{
+			Key:    string(data[offset : offset+4]),
+			Type:   data[offset+4],
+			Size:   int(data[offset+5]),
+			Repeat: int(binary.BigEndian.Uint16(data[offset+6 : offset+8])),
+		}
+		length := element.Size * element.Repeat
+		// Data is padded to 32 bits.
+		padded := (length + 3) &^ 3
+		if offset+headerSize+padded > len(data) {
+			return nil, fmt.Errorf("element %q at %d overruns length %d", element.Key, offset, len(data))
+		}
+		element.Data = data[offset+headerSize : offset+headerSize+length]
+		if element.Type == nestedType {
+			children, err := Parse(element.Data)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing %q: %w", element.Key, err)
+			}
+			element.Children = children
+		}
+		elements = append(elements, element)
+		offset += headerSize + padded
+	}
+	return elements, nil
+}
+
+// typeSize is the size of the numeric types.
+var typeSize = map[byte]int{
+	'b': 1, 'B': 1,
+	's': 2, 'S': 2,
+	'l': 4, 'L': 4, 'f': 4,
+	'd': 8, 'j': 8, 'J': 8,
+}
+
+//	Values decodes the element's numeric samples, each of which has Size divided by the type's size values.
+//	Returns:
+//		[][]float64
+//		error: if the element's type isn't numeric
+func (e *Element) Values() ([][]float64, error) {
+	size, ok := typeSize[e.Type]
+	if !ok {
+		return nil, fmt.Errorf("element %q has non-numeric type %q", e.Key, e.Type)
+	}
+	if e.Size == 0 || e.Size%size != 0 {
+		return nil, fmt.Errorf("element %q has size %d, not a multiple of %d", e.Key, e.Size, size)
+	}
+	width := e.Size / size
+	values := make([][]float64, e.Repeat)
+	for i := range values {
+		values[i] = make([]float64, width)
+		for j := range values[i] {
+			values[i][j] = decodeNumber(e.Type, e.Data[i*e.Size+j*size:])
+		}
+	}
+	return values, nil
+}
+
+// String decodes the element's characters, e.g. of STNM or GPSU.
+func (e *Element) String() string {
+	return strings.TrimRight(string(e.Data), "\x00 ")
+}
+
+func decodeNumber(typ byte, b []byte) float64 {
+	switch typ {
+	case 'b':
+		return float64(int8(b[0]))
+	case 'B':
+		return float64(b[0])
+	case 's':
+		return float64(int16(binary.BigEndian.Uint16(b)))
+	case 'S':
+		return float64(binary.BigEndian.Uint16(b))
+	case 'l':
+		return float64(int32(binary.BigEndian.Uint32(b)))
+	case 'L':
+		return float64(binary.BigEndian.Uint32(b))
+	case 'f':
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b)))
+	case 'd':
+		return math.Float64frombits(binary.BigEndian.Uint64(b))
+	case 'j':
+		return float64(int64(binary.BigEndian.Uint64(b)))
+	case 'J':
+		return float64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+// 	Stream is a STRM of a GPMF payload: its samples, and the elements describing them.
+type Stream struct {
+	// Key is the key of the samples, e.g. "GPS5".
+	Key string
+	// Name is the stream's STNM, if any.
+	Name string
+	// Samples are the stream's values, divided by SCAL.
+	Samples [][]float64
+	// Metadata are the stream's other elements by key, e.g. GPSU.
+	Metadata map[string]*Element
+}
+
+//	ReadStreams reads the streams of a GPMF payload.  The samples of a stream are its last element, streams whose
+//	samples aren't numeric are skipped.
+//	Params:
+//		data []byte
+//	Returns:
+//		[]*Stream
+//		error
+func ReadStreams(data []byte) ([]*Stream, error) {
+	elements, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	streams := []*Stream{}
+	for _, device := range elements {
+		if device.Key != deviceKey {
+			continue
+		}
+		for _, strm := range device.Children {
+			if strm.Key != streamKey || len(strm.Children) == 0 {
+				continue
+			}
+			stream, err := readStream(strm.Children)
+			if err != nil {
+				return nil, err
+			}
+			if stream != nil {
+				streams = append(streams, stream)
+			}
+		}
+	}
+	return streams, nil
+}
+
+func readStream(elements []*Element) (*Stream, error) {
+	samples := elements[len(elements)-1]
+	if _, ok := typeSize[samples.Type]; !ok {
+		return nil, nil
+	}
+	stream := &Stream{
+		Key:      samples.Key,
+		Metadata: map[string]*Element{},
+	}
+	for _, element := range elements[:len(elements)-1] {
+		stream.Metadata[element.Key] = element
+	}
+	if name, ok := stream.Metadata[streamNameKey]; ok {
+		stream.Name = name.String()
+	}
+
+	values, err := samples.Values()
+	if err != nil {
+		return nil, err
+	}
+	if scal, ok := stream.Metadata[scaleKey]; ok {
+		if err := scale(values, scal); err != nil {
+			return nil, fmt.Errorf("error scaling %q: %w", stream.Key, err)
+		}
+	}
+	stream.Samples = values
+	return stream, nil
+}
+
+// scale divides the values by SCAL, which has either one divisor or one for each value of a sample.
+func scale(values [][]float64, scal *Element) error {
+	divisors, err := scal.Values()
+	if err != nil {
+		return err
+	}
+	flat := []float64{}
+	for _, divisor := range divisors {
+		flat = append(flat, divisor...)
+	}
+	for _, sample := range values {
+		if len(flat) != 1 && len(flat) != len(sample) {
+			return fmt.Errorf("%d divisors for samples of %d values", len(flat), len(sample))
+		}
+		for i := range sample {
+			divisor := flat[0]
+			if len(flat) > 1 {
+				divisor = flat[i]
+			}
+			if divisor == 0 {
+				return fmt.Errorf("divisor of 0")
+			}
+			sample[i] /= divisor
+		}
+	}
+	return nil
+}
+
+// 	GPSSample is a GPS5 sample.
+type GPSSample struct {
+	Latitude  float64
+	Longitude float64
+	// AltitudeMeters is above the WGS 84 ellipsoid.
+	AltitudeMeters float64
+	// Speed2DMetersPerSecond is the ground speed.
+	Speed2DMetersPerSecond float64
+	Speed3DMetersPerSecond float64
+}
+
+// 	GPS is the GPS5 stream of a GPMF payload.
+type GPS struct {
+	// Time is GPSU, the UTC time of the first sample.
+	Time time.Time
+	// Fix is GPSF, 0 for no fix, 2 for 2D and 3 for 3D, or -1 if the stream doesn't have one.
+	Fix     int
+	Samples []*GPSSample
+}
+
+//	ReadGPS reads the GPS5 stream of a GPMF payload.
+//	Params:
+//		data []byte
+//	Returns:
+//		*GPS: nil if there's no GPS5 stream with a GPSU
+//		error
+func ReadGPS(data []byte) (*GPS, error) {
+	streams, err := ReadStreams(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, stream := range streams {
+		if stream.Key != gpsSamplesKey {
+			continue
+		}
+		gpsu, ok := stream.Metadata[gpsTimeKey]
+		if !ok {
+			continue
+		}
+		gps := &GPS{Fix: -1}
+		if gps.Time, err = time.Parse(gpsTimeLayout, gpsu.String()); err != nil {
+			return nil, fmt.Errorf("error parsing %s %q: %w", gpsTimeKey, gpsu.String(), err)
+		}
+		if gpsf, ok := stream.Metadata[gpsFixKey]; ok {
+			fix, err := gpsf.Values()
+			if err != nil {
+				return nil, fmt.Errorf("error reading %s: %w", gpsFixKey, err)
+			}
+			if len(fix) > 0 && len(fix[0]) > 0 {
+				gps.Fix = int(fix[0][0])
+			}
+		}
+		for _, sample := range stream.Samples {
+			if len(sample) != gpsSampleWidth {
+				return nil, fmt.Errorf("%s sample has %d values, want %d", gpsSamplesKey, len(sample), gpsSampleWidth)
+			}
+			gps.Samples = append(gps.Samples, &GPSSample{
+				Latitude:               sample[0],
+				Longitude:              sample[1],
+				AltitudeMeters:         sample[2],
+				Speed2DMetersPerSecond: sample[3],
+				Speed3DMetersPerSecond: sample[4],
+			})
+		}
+		return gps, nil
+	}
+	return nil, nil
+}
+
+// 	Vector is a sample of a 3-axis sensor in the camera's axes.
+type Vector struct {
+	X float64
+	Y float64
+	Z float64
+}
+
+// 	IMU is the ACCL and GYRO streams of a GPMF payload, whose samples are evenly spaced over the payload's
+// 	duration.
+type IMU struct {
+	// Accelerometer samples are in m/s², including gravity.
+	Accelerometer []*Vector
+	// Gyroscope samples are in rad/s.
+	Gyroscope []*Vector
+}
+
+//	ReadIMU reads the ACCL and GYRO streams of a GPMF payload.  Samples are put in the camera's axes using ORIN
+//	if the stream has one, e.g. "ZXY" means the first value is Z, and are in X, Y, Z order otherwise.
+//	Params:
+//		data []byte
+//	Returns:
+//		*IMU: nil if there's neither an ACCL nor a GYRO stream
+//		error
+func ReadIMU(data []byte) (*IMU, error) {
+	streams, err := ReadStreams(data)
+	if err != nil {
+		return nil, err
+	}
+	var imu *IMU
+	for _, stream := range streams {
+		if stream.Key != accelerometerKey && stream.Key != gyroscopeKey {
+			continue
+		}
+		orientation := ""
+		if orin, ok := stream.Metadata[orientationKey]; ok {
+			orientation = orin.String()
+		}
+		vectors := []*Vector{}
+		for _, sample := range stream.Samples {
+			vector, err := orient(sample, orientation)
+			if err != nil {
+				return nil, fmt.Errorf("error orienting %s sample: %w", stream.Key, err)
+			}
+			vectors = append(vectors, vector)
+		}
+
+		if imu == nil {
+			imu = &IMU{}
+		}
+		if stream.Key == accelerometerKey {
+			imu.Accelerometer = append(imu.Accelerometer, vectors...)
+		} else {
+			imu.Gyroscope = append(imu.Gyroscope, vectors...)
+		}
+	}
+	return imu, nil
+}
+
+// orient maps a sample's values to the camera's axes, lowercase axes in the orientation are inverted.
+func orient(sample []float64, orientation string) (*Vector, error) {
+	if len(sample) != imuSampleWidth {
+		return nil, fmt.Errorf("sample has %d values, want %d", len(sample), imuSampleWidth)
+	}
+	if orientation == "" {
+		return &Vector{X: sample[0], Y: sample[1], Z: sample[2]}, nil
+	}
+	if len(orientation) != imuSampleWidth {
+		return nil, fmt.Errorf("invalid %s %q", orientationKey, orientation)
+	}
+
+	vector := &Vector{}
+	for i, axis := range orientation {
+		value := sample[i]
+		if axis >= 'x' && axis <= 'z' {
+			value = -value
+			axis -= 'x' - 'X'
+		}
+		switch axis {
+		case 'X':
+			vector.X = value
+		case 'Y':
+			vector.Y = value
+		case 'Z':
+			vector.Z = value
+		default:
+			return nil, fmt.Errorf("invalid %s %q", orientationKey, orientation)
+		}
+	}
+	return vector, nil
+}
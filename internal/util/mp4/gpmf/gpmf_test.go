@@ -0,0 +1,169 @@
+package gpmf
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+)
+
+// klv encodes a GPMF element, padding its data to 32 bits.
+func klv(key string, typ byte, size, repeat int, data []byte) []byte {
+	out := append([]byte(key), typ, byte(size), byte(repeat>>8), byte(repeat))
+	out = append(out, data...)
+	for len(out)%4 != 0 {
+		out = append(out, 0)
+	}
+	return out
+}
+
+func int32s(values ...int32) []byte {
+	out := []byte{}
+	for _, v := range values {
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, uint32(v))
+		out = append(out, b...)
+	}
+	return out
+}
+
+func nested(key string, children ...[]byte) []byte {
+	data := []byte{}
+	for _, child := range children {
+		data = append(data, child...)
+	}
+	return klv(key, nestedType, 1, len(data), data)
+}
+
+func TestReadGPS(t *testing.T) {
+	gps5 := int32s(
+		404931000, -744306944, 12000, 10500, 10600,
+		404931100, -744307000, 12010, 10600, 10700,
+	)
+	payload := nested("DEVC",
+		klv("DVNM", 'c', 6, 1, []byte("Garmin")),
+		nested("STRM",
+			klv("STNM", 'c', 3, 1, []byte("GPS")),
+			klv("GPSF", 'L', 4, 1, int32s(3)),
+			klv("GPSU", 'U', 16, 1, []byte("210213224750.125")),
+			klv("SCAL", 'l', 4, 5, int32s(10000000, 10000000, 1000, 1000, 1000)),
+			klv("GPS5", 'l', 20, 2, gps5),
+		),
+		nested("STRM",
+			klv("STNM", 'c', 12, 1, []byte("Temperature ")),
+			klv("TMPC", 'f', 4, 1, int32s(int32(math.Float32bits(21.5)))),
+		),
+	)
+
+	streams, err := ReadStreams(payload)
+	if err != nil {
+		t.Fatalf("ReadStreams() returns err: %v", err)
+	}
+	if len(streams) != 2 || streams[0].Key != "GPS5" || streams[0].Name != "GPS" || streams[1].Key != "TMPC" || streams[1].Samples[0][0] != 21.5 {
+		t.Fatalf("Want the GPS5 and TMPC streams, got %v", streams)
+	}
+
+	gps, err := ReadGPS(payload)
+	if err != nil {
+		t.Fatalf("ReadGPS() returns err: %v", err)
+	}
+	if gps == nil {
+		t.Fatalf("Want GPS, got nil")
+	}
+	if want := time.Date(2021, time.February, 13, 22, 47, 50, 125000000, time.UTC); !gps.Time.Equal(want) {
+		t.Errorf("Want GPS time %v, got %v", want, gps.Time)
+	}
+	if gps.Fix != 3 {
+		t.Errorf("Want fix 3, got %d", gps.Fix)
+	}
+	want := []*GPSSample{
+		{Latitude: 40.4931, Longitude: -74.4306944, AltitudeMeters: 12, Speed2DMetersPerSecond: 10.5, Speed3DMetersPerSecond: 10.6},
+		{Latitude: 40.49311, Longitude: -74.4307, AltitudeMeters: 12.01, Speed2DMetersPerSecond: 10.6, Speed3DMetersPerSecond: 10.7},
+	}
+	if len(gps.Samples) != len(want) {
+		t.Fatalf("Want %d samples, got %d", len(want), len(gps.Samples))
+	}
+	for i, sample := range gps.Samples {
+		if *sample != *want[i] {
+			t.Errorf("Want sample %d %v, got %v", i, want[i], sample)
+		}
+	}
+}
+
+func TestReadGPSWithoutGPS(t *testing.T) {
+	payload := nested("DEVC", nested("STRM", klv("TMPC", 'f', 4, 1, int32s(0))))
+	gps, err := ReadGPS(payload)
+	if err != nil || gps != nil {
+		t.Errorf("Want nil, nil from ReadGPS() without a GPS5 stream, got %v, %v", gps, err)
+	}
+}
+
+func TestParseRejectsTruncatedData(t *testing.T) {
+	payload := klv("GPS5", 'l', 20, 2, int32s(1, 2, 3, 4, 5, 6, 7, 8, 9, 10))
+	if _, err := Parse(payload[:len(payload)-4]); err == nil {
+		t.Errorf("Want err from Parse() of truncated data, got nil")
+	}
+}
+
+func int16s(values ...int16) []byte {
+	out := []byte{}
+	for _, v := range values {
+		b := make([]byte, 2)
+		binary.BigEndian.PutUint16(b, uint16(v))
+		out = append(out, b...)
+	}
+	return out
+}
+
+func TestReadIMU(t *testing.T) {
+	payload := nested("DEVC",
+		nested("STRM",
+			klv("STNM", 'c', 13, 1, []byte("Accelerometer")),
+			klv("ORIN", 'c', 3, 1, []byte("ZxY")),
+			klv("SCAL", 's', 2, 1, int16s(100)),
+			klv("ACCL", 's', 6, 2, int16s(981, 25, -50, 980, 0, 10)),
+		),
+		nested("STRM",
+			klv("STNM", 'c', 9, 1, []byte("Gyroscope")),
+			klv("ORIN", 'c', 3, 1, []byte("ZxY")),
+			klv("SCAL", 's', 2, 1, int16s(1000)),
+			klv("GYRO", 's', 6, 2, int16s(1, 2, 3, -40, 50, 60)),
+		),
+	)
+
+	imu, err := ReadIMU(payload)
+	if err != nil {
+		t.Fatalf("ReadIMU() returns err: %v", err)
+	}
+	if imu == nil {
+		t.Fatalf("Want IMU, got nil")
+	}
+	wantAccelerometer := []*Vector{{X: -0.25, Y: -0.5, Z: 9.81}, {X: 0, Y: 0.1, Z: 9.8}}
+	if len(imu.Accelerometer) != len(wantAccelerometer) {
+		t.Fatalf("Want %d accelerometer samples, got %d", len(wantAccelerometer), len(imu.Accelerometer))
+	}
+	for i, sample := range imu.Accelerometer {
+		if *sample != *wantAccelerometer[i] {
+			t.Errorf("Want accelerometer sample %d %v, got %v", i, wantAccelerometer[i], sample)
+		}
+	}
+	wantGyroscope := []*Vector{{X: -0.002, Y: 0.003, Z: 0.001}, {X: -0.05, Y: 0.06, Z: -0.04}}
+	if len(imu.Gyroscope) != len(wantGyroscope) {
+		t.Fatalf("Want %d gyroscope samples, got %d", len(wantGyroscope), len(imu.Gyroscope))
+	}
+	for i, sample := range imu.Gyroscope {
+		if *sample != *wantGyroscope[i] {
+			t.Errorf("Want gyroscope sample %d %v, got %v", i, wantGyroscope[i], sample)
+		}
+	}
+}
+
+func TestReadIMURejectsInvalidOrientation(t *testing.T) {
+	payload := nested("DEVC", nested("STRM",
+		klv("ORIN", 'c', 3, 1, []byte("XXW")),
+		klv("ACCL", 's', 6, 1, int16s(1, 2, 3)),
+	))
+	if _, err := ReadIMU(payload); err == nil {
+		t.Errorf("Want err from ReadIMU() with ORIN %q, got nil", "XXW")
+	}
+}
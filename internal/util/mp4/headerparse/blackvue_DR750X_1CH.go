@@ -5,14 +5,31 @@ import (
 	"fmt"
 	st "seneca/api/type"
 	"seneca/internal/util"
+	"seneca/internal/util/data"
 	"time"
 )
 
+var blackVueDR750X1CHDashCam = &dashCam{
+	name: BlackVueDR750X1CH,
+	detect: func(rawData map[string]interface{}) bool {
+		return mainStringContains(rawData, exifCopyrightKey, "Pittasoft")
+	},
+	layout: &parserValues{
+		videoStartTimeKey:    exifStartTimeKey,
+		gpsTimeKey:           exifGPSDateTimeKey,
+		videoStartTimeLayout: "2006:01:02 15:04:05.000",
+		gpsTimeLayout:        "2006:01:02 15:04:05.00Z",
+	},
+	newParser: func() exifParserInterface { return &blackVueDR750X1CHExifParser{} },
+}
+
 type blackVueDR750X1CHExifParser struct {
+	layout              *parserValues
 	unprocessedExifData *unprocessedExifData
 }
 
-func (prs *blackVueDR750X1CHExifParser) init(unprocessedExifData *unprocessedExifData) {
+func (prs *blackVueDR750X1CHExifParser) init(layout *parserValues, unprocessedExifData *unprocessedExifData) {
+	prs.layout = layout
 	prs.unprocessedExifData = unprocessedExifData
 }
 
@@ -35,7 +52,7 @@ func (prs *blackVueDR750X1CHExifParser) parseOutRawVideoMetadata() (*st.RawVideo
 }
 
 func (prs *blackVueDR750X1CHExifParser) getVideoCreationTime(timeString string) (int64, error) {
-	t, err := time.Parse("2006:01:02 15:04:05.000", timeString)
+	t, err := time.Parse(prs.layout.videoStartTimeLayout, timeString)
 	if err != nil {
 		return 0, fmt.Errorf("error parsing CreationTime - err: %v", err)
 	}
@@ -50,7 +67,7 @@ func (prs *blackVueDR750X1CHExifParser) getVideoCreationTime(timeString string)
 }
 
 func (prs *blackVueDR750X1CHExifParser) parseOutGPSMetadata(rawVideo *st.RawVideo) ([]*st.Location, []*st.Motion, []time.Time, error) {
-	locations, motions, times, err := getLocationsMotionsTimes("2006:01:02 15:04:05.00Z", prs.unprocessedExifData)
+	locations, motions, times, err := getLocationsMotionsTimes(prs.layout.gpsTimeLayout, prs.unprocessedExifData)
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("getLocationsMotionsTimes() returns err: %w", err)
 	}
@@ -59,9 +76,9 @@ func (prs *blackVueDR750X1CHExifParser) parseOutGPSMetadata(rawVideo *st.RawVide
 		return nil, nil, nil, fmt.Errorf("got 0 times")
 	}
 
-	tzOffset, err := getTZOffset(times[0], locations[0])
+	tzOffset, err := data.TZOffset(times[0], locations[0])
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("getTZOffset(%v, %v) returns err: %w", times[0], locations[0], err)
+		return nil, nil, nil, fmt.Errorf("data.TZOffset(%v, %v) returns err: %w", times[0], locations[0], err)
 	}
 
 	// For some reason it's still off an hour for BlackVue.
@@ -1,17 +1,20 @@
 // Package headerparse extracts MP4 metadata by:
-//		1. 	Running exiftool (exif_wrapper.go)
+//		1. 	Reading the MP4's boxes (native.go), or running exiftool (exif_wrapper.go) if that fails
 //		2. 	Extracting the data into unstructured string values (exif_extract.go)
 //		3.	Parsing the data into real values (exif_parse.go)
 //		4.	Putting it all together into Seneca types (exif.go)
 //
 //	Some notes:
 //		1. All times should be in UTC rooted at the video's 'CreateTime' (or similar field).
+//		2. Each supported dashcam is registered in registry.go with how it's detected, its layout and its parser.
 package headerparse
 
 // TODO(lucaloncar): run a bunch of other videos through to make sure timestamps aren't messed up
 
 import (
 	"fmt"
+	"os"
+	"seneca/api/senecaerror"
 	st "seneca/api/type"
 	"seneca/internal/client/logging"
 	"time"
@@ -22,6 +25,10 @@ type DashCamName string
 var (
 	Garmin55          DashCamName = "Garmin55"
 	BlackVueDR750X1CH DashCamName = "BlackVue_DR750X-1CH"
+	Nextbase622GW     DashCamName = "Nextbase_622GW"
+	ThinkwareU1000    DashCamName = "Thinkware_U1000"
+	VantrueN4         DashCamName = "Vantrue_N4"
+	ViofoA129Plus     DashCamName = "Viofo_A129_Plus"
 )
 
 func (dcn DashCamName) String() string {
@@ -33,30 +40,61 @@ var (
 )
 
 type exifParserInterface interface {
-	init(unprocessedExifData *unprocessedExifData)
+	init(layout *parserValues, unprocessedExifData *unprocessedExifData)
 	parseOutRawVideoMetadata() (*st.RawVideo, error)
 	parseOutGPSMetadata(rawVideo *st.RawVideo) ([]*st.Location, []*st.Motion, []time.Time, error)
 }
 
 type ExifMP4Tool struct {
-	logger  logging.LoggingInterface
-	parsers map[DashCamName]exifParserInterface
+	logger   logging.LoggingInterface
+	dashCams *dashCamRegistry
+	// exifToolFallback is whether exiftool is run for videos whose boxes can't be read natively.
+	exifToolFallback bool
 }
 
+// NewExifMP4Tool creates an ExifMP4Tool that reads MP4s natively, falling back to exiftool.
 func NewExifMP4Tool(logger logging.LoggingInterface) *ExifMP4Tool {
 	return &ExifMP4Tool{
-		logger: logger,
-		parsers: map[DashCamName]exifParserInterface{
-			BlackVueDR750X1CH: &blackVueDR750X1CHExifParser{},
-			Garmin55:          &Garmin55ExifParser{},
-		},
+		logger:           logger,
+		dashCams:         defaultDashCams,
+		exifToolFallback: true,
 	}
 }
 
+// NewNativeMP4Tool creates an ExifMP4Tool that only reads MP4s natively, for servers without exiftool.
+func NewNativeMP4Tool(logger logging.LoggingInterface) *ExifMP4Tool {
+	emt := NewExifMP4Tool(logger)
+	emt.exifToolFallback = false
+	return emt
+}
+
 func (emt *ExifMP4Tool) ParseVideoMetadata(pathToVideo string) (*st.RawVideo, []*st.Location, []*st.Motion, []time.Time, error) {
-	exifRawData, err := runExifCommand(pathToVideo)
+	if _, err := os.Stat(pathToVideo); os.IsNotExist(err) {
+		return nil, nil, nil, nil, senecaerror.NewBadStateError(fmt.Errorf("%q does not exist", pathToVideo))
+	}
+
+	rawVideo, locations, motions, times, err := emt.parseVideoMetadata(pathToVideo, readNativeMetadata)
+	if err == nil || !emt.exifToolFallback {
+		return rawVideo, locations, motions, times, err
+	}
+	emt.logger.Warning(fmt.Sprintf("Reading %q natively failed, falling back to exiftool - err: %v", pathToVideo, err))
+
+	rawVideo, locations, motions, times, exifToolErr := emt.parseVideoMetadata(pathToVideo, runExifCommand)
+	if exifToolErr != nil {
+		// The native error is returned, e.g. a UserError for a video without GPS data, since the servers may not
+		// have exiftool.
+		emt.logger.Warning(fmt.Sprintf("Reading %q with exiftool failed - err: %v", pathToVideo, exifToolErr))
+		return nil, nil, nil, nil, err
+	}
+	return rawVideo, locations, motions, times, nil
+}
+
+// parseVideoMetadata parses the video's metadata as read by readRawData, which is readNativeMetadata or
+// runExifCommand.
+func (emt *ExifMP4Tool) parseVideoMetadata(pathToVideo string, readRawData func(filePath string) (map[string]interface{}, error)) (*st.RawVideo, []*st.Location, []*st.Motion, []time.Time, error) {
+	exifRawData, err := readRawData(pathToVideo)
 	if err != nil {
-		return nil, nil, nil, nil, fmt.Errorf("error running exif command: %w", err)
+		return nil, nil, nil, nil, fmt.Errorf("error reading metadata: %w", err)
 	}
 
 	dashCamName, unprocessedExifData, err := emt.extractData(exifRawData)
@@ -64,8 +102,9 @@ func (emt *ExifMP4Tool) ParseVideoMetadata(pathToVideo string) (*st.RawVideo, []
 		return nil, nil, nil, nil, fmt.Errorf("error extracting unprocessed data: %w", err)
 	}
 
-	parser := emt.parsers[dashCamName]
-	parser.init(unprocessedExifData)
+	dashCam := emt.dashCams.get(dashCamName)
+	parser := dashCam.newParser()
+	parser.init(dashCam.layout, unprocessedExifData)
 
 	rawVideo, err := parser.parseOutRawVideoMetadata()
 	if err != nil {
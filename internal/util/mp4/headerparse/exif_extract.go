@@ -2,7 +2,6 @@ package headerparse
 
 import (
 	"fmt"
-	"strings"
 )
 
 const (
@@ -13,35 +12,40 @@ const (
 	exifGPSSpeedKey         = "GPSSpeed"
 	exifGPSSpeedRefKey      = "GPSSpeedRef"
 	exifGPSSampleTimeKey    = "SampleTime"
+	exifGPSDateTimeKey      = "GPSDateTime"
+	exifCreateDateKey       = "CreateDate"
+	exifStartTimeKey        = "StartTime"
+	exifMajorBrandKey       = "MajorBrand"
+	exifCompressorNameKey   = "CompressorName"
+	exifCopyrightKey        = "Copyright"
+	exifMakeKey             = "Make"
+	exifModelKey            = "Model"
+	// exifLongitudinalAccelerationKey, exifLateralAccelerationKey and exifYawRateKey aren't printed by exiftool,
+	// they're the vehicle's mean acceleration in m/s² and yaw rate in rad/s from the GPS doc's time to the next
+	// that readNativeMetadata adds from the dashcam's IMU.
+	exifLongitudinalAccelerationKey = "LongitudinalAcceleration"
+	exifLateralAccelerationKey      = "LateralAcceleration"
+	exifYawRateKey                  = "YawRate"
 )
 
+// 	parserValues are where a dashcam's times are in its metadata and how they're formatted.
 type parserValues struct {
 	videoStartTimeKey string
+	gpsTimeKey        string
 	// time.Parse requires the first arugment to be a string
 	// representing what the datetime 15:04 on 1/2/2006 would be.
-	gpsTimeKey string
-	// gpsTimeLayout        string
+	videoStartTimeLayout string
+	gpsTimeLayout        string
 }
 
-var (
-	cameraDataLayouts = map[DashCamName]*parserValues{
-		Garmin55: {
-			videoStartTimeKey: "CreateDate",
-			gpsTimeKey:        "GPSDateTime",
-		},
-		BlackVueDR750X1CH: {
-			videoStartTimeKey: "StartTime",
-			gpsTimeKey:        "GPSDateTime",
-		},
-	}
-)
-
 type unprocessedExifGPSData struct {
 	datetime  string
 	latitude  string
 	longitude string
 	speed     float64
 	speedRef  string
+	// longitudinalAcceleration is in m/s², or nil if the dashcam has no accelerometer data.
+	longitudinalAcceleration *float64
 }
 
 type unprocessedExifData struct {
@@ -51,7 +55,7 @@ type unprocessedExifData struct {
 }
 
 func (emt *ExifMP4Tool) extractData(rawData map[string]interface{}) (DashCamName, *unprocessedExifData, error) {
-	dashCamName, err := inferDashCamName(rawData)
+	dashCam, err := emt.dashCams.infer(rawData)
 	if err != nil {
 		return "", nil, fmt.Errorf("error inferring dashcam name: %w", err)
 	}
@@ -63,7 +67,7 @@ func (emt *ExifMP4Tool) extractData(rawData map[string]interface{}) (DashCamName
 		return "", nil, fmt.Errorf("no %q data", exifToolMetadataMainKey)
 	}
 
-	unprocessedData.startTime, unprocessedData.duration, err = extractMainMetadata(dashCamName, mainDataObj)
+	unprocessedData.startTime, unprocessedData.duration, err = extractMainMetadata(dashCam.layout, mainDataObj)
 	if err != nil {
 		return "", nil, fmt.Errorf("error extracting %q data - err: %w", exifToolMetadataMainKey, err)
 	}
@@ -74,7 +78,7 @@ func (emt *ExifMP4Tool) extractData(rawData map[string]interface{}) (DashCamName
 			emt.logger.Warning("Expected map[string]interface{}")
 		}
 
-		gpsData, err := extractGPSData(dashCamName, subMap)
+		gpsData, err := extractGPSData(dashCam.layout, subMap)
 		if err != nil {
 			return "", nil, fmt.Errorf("error extracting GPS data: %w", err)
 		}
@@ -84,56 +88,7 @@ func (emt *ExifMP4Tool) extractData(rawData map[string]interface{}) (DashCamName
 	}
 
 	unprocessedData.gpsData = removeDuplicates(unprocessedData.gpsData)
-	return dashCamName, unprocessedData, nil
-}
-
-func inferDashCamName(rawData map[string]interface{}) (DashCamName, error) {
-	for name, fn := range dashCamInferencesFuncMap {
-		if fn(rawData) {
-			return name, nil
-		}
-	}
-	return "", fmt.Errorf("dashCam could not be inferred")
-}
-
-var dashCamInferencesFuncMap = map[DashCamName]func(rawData map[string]interface{}) bool{
-	BlackVueDR750X1CH: func(rawData map[string]interface{}) bool {
-		mainMetadataMapObj, ok := rawData[exifToolMetadataMainKey]
-		if !ok {
-			return false
-		}
-		mainMetadataMap, ok := mainMetadataMapObj.(map[string]interface{})
-		if !ok {
-			return false
-		}
-		copyright, ok := stringExists("Copyright", mainMetadataMap)
-		if !ok {
-			return false
-		}
-
-		return strings.Contains(copyright, "Pittasoft")
-	},
-	Garmin55: func(rawData map[string]interface{}) bool {
-		mainMetadataMapObj, ok := rawData[exifToolMetadataMainKey]
-		if !ok {
-			return false
-		}
-		mainMetadataMap, ok := mainMetadataMapObj.(map[string]interface{})
-		if !ok {
-			return false
-		}
-
-		// These are identifiers that I hope are unique to this camera.
-		majorBrand, ok := stringExists("MajorBrand", mainMetadataMap)
-		if !ok {
-			return false
-		}
-		compressorName, ok := stringExists("CompressorName", mainMetadataMap)
-		if !ok {
-			return false
-		}
-		return strings.Contains(majorBrand, "MP4 Base w/ AVC ext [ISO 14496-12:2005]") && strings.Contains(compressorName, "Ambarella AVC encoder")
-	},
+	return dashCam.name, unprocessedData, nil
 }
 
 func removeDuplicates(dataList []*unprocessedExifGPSData) []*unprocessedExifGPSData {
@@ -149,7 +104,7 @@ func removeDuplicates(dataList []*unprocessedExifGPSData) []*unprocessedExifGPSD
 	return newList
 }
 
-func extractMainMetadata(dashCamName DashCamName, obj interface{}) (string, string, error) {
+func extractMainMetadata(layout *parserValues, obj interface{}) (string, string, error) {
 	startTime := ""
 	duration := ""
 
@@ -158,13 +113,13 @@ func extractMainMetadata(dashCamName DashCamName, obj interface{}) (string, stri
 		return "", "", fmt.Errorf("expected map[string]interface{} for main metadata %q, got %T", exifToolMetadataMainKey, obj)
 	}
 
-	startTimeObj, ok := mainData[cameraDataLayouts[dashCamName].videoStartTimeKey]
+	startTimeObj, ok := mainData[layout.videoStartTimeKey]
 	if !ok {
-		return "", "", fmt.Errorf("no %q data", cameraDataLayouts[dashCamName].videoStartTimeKey)
+		return "", "", fmt.Errorf("no %q data", layout.videoStartTimeKey)
 	}
 	startTime, ok = startTimeObj.(string)
 	if !ok {
-		return "", "", fmt.Errorf("expected string for %q, got %T", cameraDataLayouts[dashCamName].videoStartTimeKey, startTimeObj)
+		return "", "", fmt.Errorf("expected string for %q, got %T", layout.videoStartTimeKey, startTimeObj)
 	}
 
 	durationObj, ok := mainData[exifDurationKey]
@@ -179,19 +134,19 @@ func extractMainMetadata(dashCamName DashCamName, obj interface{}) (string, stri
 	return startTime, duration, nil
 }
 
-func extractGPSData(dashCamName DashCamName, gpsMap map[string]interface{}) (*unprocessedExifGPSData, error) {
+func extractGPSData(layout *parserValues, gpsMap map[string]interface{}) (*unprocessedExifGPSData, error) {
 	gpsData := &unprocessedExifGPSData{}
 
-	gpsKeys := []string{cameraDataLayouts[dashCamName].gpsTimeKey, exifGPSLatKey, exifGPSLongKey, exifGPSSpeedKey, exifGPSSpeedRefKey, exifGPSSampleTimeKey}
+	gpsKeys := []string{layout.gpsTimeKey, exifGPSLatKey, exifGPSLongKey, exifGPSSpeedKey, exifGPSSpeedRefKey, exifGPSSampleTimeKey}
 	for _, key := range gpsKeys {
 		if _, ok := gpsMap[key]; !ok {
 			return nil, nil
 		}
 	}
 
-	datetime, ok := gpsMap[cameraDataLayouts[dashCamName].gpsTimeKey].(string)
+	datetime, ok := gpsMap[layout.gpsTimeKey].(string)
 	if !ok {
-		return nil, fmt.Errorf("expected string for %q, got %T", cameraDataLayouts[dashCamName].gpsTimeKey, gpsMap[cameraDataLayouts[dashCamName].gpsTimeKey])
+		return nil, fmt.Errorf("expected string for %q, got %T", layout.gpsTimeKey, gpsMap[layout.gpsTimeKey])
 	}
 	gpsData.datetime = datetime
 
@@ -228,5 +183,13 @@ func extractGPSData(dashCamName DashCamName, gpsMap map[string]interface{}) (*un
 	}
 	gpsData.speedRef = speedRef
 
+	if accelerationObj, ok := gpsMap[exifLongitudinalAccelerationKey]; ok {
+		acceleration, ok := accelerationObj.(float64)
+		if !ok {
+			return nil, fmt.Errorf("expected float64 for %q, got %T", exifLongitudinalAccelerationKey, accelerationObj)
+		}
+		gpsData.longitudinalAcceleration = &acceleration
+	}
+
 	return gpsData, nil
 }
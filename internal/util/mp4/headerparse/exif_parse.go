@@ -66,6 +66,8 @@ type locationMotionTime struct {
 	location *st.Location
 	motion   *st.Motion
 	gpsTime  time.Time
+	// imuAccelerationMphS is the acceleration measured by the dashcam's accelerometer, or nil.
+	imuAccelerationMphS *float64
 }
 
 func getLocationMotionTime(gpsDateTimeFormat string, unprocessedGPSData *unprocessedExifGPSData) (*locationMotionTime, error) {
@@ -101,6 +103,11 @@ func getLocationMotionTime(gpsDateTimeFormat string, unprocessedGPSData *unproce
 		return nil, fmt.Errorf("invalid speedRef %q", unprocessedGPSData.speedRef)
 	}
 
+	if unprocessedGPSData.longitudinalAcceleration != nil {
+		accelerationMphS := *unprocessedGPSData.longitudinalAcceleration * metersPerSecondToKilometersPerHour / constants.KilometersToMiles
+		locationMotionTime.imuAccelerationMphS = &accelerationMphS
+	}
+
 	return locationMotionTime, nil
 }
 
@@ -125,6 +132,13 @@ func getLocationsMotionsTimes(gpsDateTimeFormat string, unprocessedExifData *unp
 		times = append(times, lmt.gpsTime)
 	}
 	populateAccelerations(motions)
+	// The accelerometer measures the acceleration from each fix on directly, without the GPS speeds' noise, so it's
+	// used where there is some.
+	for i, lmt := range locationsMotionsTimes {
+		if lmt.imuAccelerationMphS != nil {
+			motions[i].AccelerationMphS = *lmt.imuAccelerationMphS
+		}
+	}
 
 	return locations, motions, times, nil
 }
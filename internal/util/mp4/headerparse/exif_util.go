@@ -5,11 +5,8 @@ import (
 	"seneca/api/senecaerror"
 	st "seneca/api/type"
 	"seneca/internal/util"
-	"seneca/internal/util/data"
 	"strings"
 	"time"
-
-	"gopkg.in/ugjka/go-tz.v2/tz"
 )
 
 func stringToLatitude(latString string) (*st.Latitude, error) {
@@ -106,26 +103,3 @@ func stringExists(key string, data map[string]interface{}) (string, bool) {
 	val, ok := valObj.(string)
 	return val, ok
 }
-
-func getTZOffset(t time.Time, location *st.Location) (time.Duration, error) {
-	latFloat64 := data.LatitudeToFloat64(location.Lat)
-	longFloat64 := data.LongitudeToFloat64(location.Long)
-
-	timeZoneIDs, err := tz.GetZone(tz.Point{Lat: latFloat64, Lon: longFloat64})
-	if err != nil {
-		return 0, fmt.Errorf("tz.GetZone(%f, %f) returns err: %w", latFloat64, longFloat64, err)
-	}
-
-	if len(timeZoneIDs) == 0 {
-		return 0, fmt.Errorf("tz.GetZone(%f, %f) returns 0 timeZoneIDs", latFloat64, longFloat64)
-	}
-
-	tzLocation, err := time.LoadLocation(timeZoneIDs[0])
-	if err != nil {
-		return 0, fmt.Errorf("time.LoadLocation(%s) returns err: %w", timeZoneIDs[0], err)
-	}
-
-	_, offset := t.In(tzLocation).Zone()
-
-	return time.Second * time.Duration(offset), nil
-}
@@ -1,47 +1,34 @@
 package headerparse
 
 import (
-	"bufio"
 	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
 	"seneca/api/senecaerror"
-	"strings"
 )
 
-const exifCommand = "exiftool -ee -g3 -j %s"
+var exifCommandArgs = []string{"-ee", "-g3", "-j"}
 
 func runExifCommand(filePath string) (map[string]interface{}, error) {
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		return nil, senecaerror.NewBadStateError(fmt.Errorf("%q does not exist", filePath))
 	}
 
-	commandString := fmt.Sprintf(exifCommand, filePath)
-	commandStringParts := strings.Split(commandString, " ")
-	cmd := exec.Command(commandStringParts[0], commandStringParts[1:]...)
-
-	stdOut, err := cmd.StdoutPipe()
+	// The path is its own argument, so it may have spaces.
+	cmd := exec.Command("exiftool", append(exifCommandArgs, filePath)...)
+	output, err := cmd.Output()
 	if err != nil {
-		return nil, fmt.Errorf("error fetching cmd.StdoutPipe()")
-	}
-
-	cmd.Start()
-
-	scanner := bufio.NewScanner(stdOut)
-	scanner.Split(bufio.ScanWords)
-
-	output := ""
-	for scanner.Scan() {
-		// Add a space between words.
-		out := scanner.Text() + " "
-		output = output + out
+		return nil, fmt.Errorf("error running exiftool on %q: %w, exiftool may not be installed", filePath, err)
 	}
 
-	cmd.Wait()
+	return decodeExifToolOutput(output)
+}
 
+// decodeExifToolOutput decodes the JSON exiftool prints for one file.
+func decodeExifToolOutput(output []byte) (map[string]interface{}, error) {
 	var topLevelArray []interface{}
-	if err := json.NewDecoder(strings.NewReader(output)).Decode(&topLevelArray); err != nil {
+	if err := json.Unmarshal(output, &topLevelArray); err != nil {
 		return nil, fmt.Errorf("error parsing json: %w, exiftool may not be installed", err)
 	}
 
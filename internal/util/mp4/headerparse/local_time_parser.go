@@ -0,0 +1,88 @@
+package headerparse
+
+import (
+	"errors"
+	"fmt"
+	st "seneca/api/type"
+	"seneca/internal/util"
+	"seneca/internal/util/data"
+	"time"
+)
+
+// createDateLayout is the layout of dashcams whose start time is exiftool's CreateDate.  The GPS times may have
+// fractional seconds of any precision, which time.Parse accepts even though the layout has none.
+var createDateLayout = &parserValues{
+	videoStartTimeKey:    exifCreateDateKey,
+	gpsTimeKey:           exifGPSDateTimeKey,
+	videoStartTimeLayout: "2006:01:02 15:04:05",
+	gpsTimeLayout:        "2006:01:02 15:04:05Z",
+}
+
+// 	localTimeExifParser parses the metadata of dashcams that record their local time as the video's start time and
+// 	UTC GPS times, which are shifted to local time using the time zone of the first location.
+type localTimeExifParser struct {
+	layout              *parserValues
+	unprocessedExifData *unprocessedExifData
+}
+
+func (prs *localTimeExifParser) init(layout *parserValues, unprocessedExifData *unprocessedExifData) {
+	prs.layout = layout
+	prs.unprocessedExifData = unprocessedExifData
+}
+
+func (prs *localTimeExifParser) parseOutRawVideoMetadata() (*st.RawVideo, error) {
+	rawVideo := &st.RawVideo{}
+
+	creationTimeMs, err := prs.getVideoCreationTime(prs.unprocessedExifData.startTime)
+	if err != nil {
+		return nil, fmt.Errorf("error getting creationTimeMs: %w", err)
+	}
+	rawVideo.CreateTimeMs = creationTimeMs
+
+	durationMs, err := getDurationMs(prs.unprocessedExifData.duration)
+	if err != nil {
+		return nil, fmt.Errorf("error getting durationMs: %w", err)
+	}
+	rawVideo.DurationMs = durationMs
+
+	return rawVideo, nil
+}
+
+func (prs *localTimeExifParser) getVideoCreationTime(timeString string) (int64, error) {
+	t, err := time.Parse(prs.layout.videoStartTimeLayout, timeString)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing CreationTime - err: %v", err)
+	}
+	t = t.In(time.UTC).Round(time.Second)
+
+	if t.Equal(time.Unix(0, 0)) {
+		return 0, errors.New("creationTime of 0 is not allowed")
+	}
+	t = t.In(time.UTC)
+
+	return util.TimeToMilliseconds(t), nil
+}
+
+func (prs *localTimeExifParser) parseOutGPSMetadata(rawVideo *st.RawVideo) ([]*st.Location, []*st.Motion, []time.Time, error) {
+	locations, motions, times, err := getLocationsMotionsTimes(prs.layout.gpsTimeLayout, prs.unprocessedExifData)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("getLocationsMotionsTimes() returns err: %w", err)
+	}
+
+	if len(times) == 0 {
+		return nil, nil, nil, fmt.Errorf("got 0 times")
+	}
+
+	tzOffset, err := data.TZOffset(times[0], locations[0])
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("data.TZOffset(%v, %v) returns err: %w", times[0], locations[0], err)
+	}
+
+	newTimes := []time.Time{}
+	for _, t := range times {
+		newTime := t.Add(tzOffset)
+		newTimes = append(newTimes, newTime)
+	}
+
+	return locations, motions, newTimes, err
+}
@@ -0,0 +1,334 @@
+package headerparse
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"seneca/internal/util/mp4/bmff"
+	"seneca/internal/util/mp4/gpmf"
+	"seneca/internal/util/mp4/imu"
+	"seneca/internal/util/nmea"
+	"strings"
+	"time"
+)
+
+const (
+	// blackVueGPSBoxType is the box BlackVue dashcams log NMEA sentences in, each prefixed with a
+	// "[<unix milliseconds>]".
+	blackVueGPSBoxType = "gps "
+	copyrightBoxType   = "cprt"
+	gpmfFormat         = "gpmd"
+
+	// makeBoxType and modelBoxType are the QuickTime user data boxes exiftool reads Make and Model from.
+	makeBoxType  = "\xa9mak"
+	modelBoxType = "\xa9mod"
+
+	exifDateTimeLayout = "2006:01:02 15:04:05"
+	// exiftool prints GPS times with the precision of the source: NMEA has hundredths of a second, GPMF has
+	// milliseconds.
+	nmeaGPSDateTimeLayout = "2006:01:02 15:04:05.00Z"
+	gpmfGPSDateTimeLayout = "2006:01:02 15:04:05.000Z"
+
+	metersPerSecondToKilometersPerHour = float64(3.6)
+)
+
+// majorBrandDescriptions are how exiftool prints the major brands of dashcam MP4s.
+var majorBrandDescriptions = map[string]string{
+	"avc1": "MP4 Base w/ AVC ext [ISO 14496-12:2005]",
+	"isom": "MP4 Base Media v1 [IS0 14496-12:2003]",
+	"iso2": "MP4 Base Media v2 [ISO 14496-12:2005]",
+	"mp41": "MP4 v1 [ISO 14496-1:ch13]",
+	"mp42": "MP4 v2 [ISO 14496-14]",
+	"qt  ": "Apple QuickTime (.MOV/QT)",
+}
+
+//	readNativeMetadata reads the MP4's boxes into the same structure runExifCommand returns, so that exiftool
+//	isn't needed for the dashcams whose data we know how to find: the "Main" metadata, and a "Doc<n>" map for each
+//	GPS fix of a BlackVue NMEA "gps " box or a GPMF track.
+//	Params:
+//		filePath string
+//	Returns:
+//		map[string]interface{}
+//		error
+func readNativeMetadata(filePath string) (map[string]interface{}, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %q: %w", filePath, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("error getting size of %q: %w", filePath, err)
+	}
+
+	movie, err := bmff.ReadMovie(file, info.Size())
+	if err != nil {
+		return nil, fmt.Errorf("error reading MP4 boxes: %w", err)
+	}
+
+	mainData, err := nativeMainMetadata(file, movie)
+	if err != nil {
+		return nil, err
+	}
+	rawData := map[string]interface{}{
+		exifToolMetadataMainKey: mainData,
+	}
+
+	gpsDocs := []map[string]interface{}{}
+	if nmeaData, err := findVendorData(file, movie, blackVueGPSBoxType); err != nil {
+		return nil, err
+	} else if nmeaData != nil {
+		gpsDocs = append(gpsDocs, nmeaGPSDocs(nmeaData)...)
+	}
+	for _, track := range movie.Tracks {
+		if track.Format != gpmfFormat {
+			continue
+		}
+		docs, err := gpmfGPSDocs(file, track)
+		if err != nil {
+			return nil, fmt.Errorf("error reading GPMF track %d: %w", track.ID, err)
+		}
+		gpsDocs = append(gpsDocs, docs...)
+	}
+	for i, doc := range gpsDocs {
+		rawData[fmt.Sprintf("Doc%d", i+1)] = doc
+	}
+
+	return rawData, nil
+}
+
+func nativeMainMetadata(r io.ReaderAt, movie *bmff.Movie) (map[string]interface{}, error) {
+	if movie.CreationTime.IsZero() {
+		return nil, fmt.Errorf("movie has no creation time")
+	}
+
+	duration := movie.Duration
+	for _, track := range movie.Tracks {
+		// exiftool's TrackDuration is the first track's.
+		if track.Duration > 0 {
+			duration = track.Duration
+			break
+		}
+	}
+
+	mainData := map[string]interface{}{
+		// Dashcams write their local time as the creation time, which the parsers expect as is.
+		exifCreateDateKey: movie.CreationTime.Format(exifDateTimeLayout),
+		exifStartTimeKey:  movie.CreationTime.Format(exifDateTimeLayout + ".000"),
+		exifDurationKey:   formatExifDuration(duration),
+	}
+
+	if description, ok := majorBrandDescriptions[movie.MajorBrand]; ok {
+		mainData[exifMajorBrandKey] = description
+	} else if movie.MajorBrand != "" {
+		mainData[exifMajorBrandKey] = movie.MajorBrand
+	}
+
+	for _, track := range movie.Tracks {
+		if track.CompressorName != "" {
+			mainData[exifCompressorNameKey] = track.CompressorName
+			break
+		}
+	}
+
+	copyright, err := findVendorData(r, movie, copyrightBoxType)
+	if err != nil {
+		return nil, err
+	}
+	if copyright != nil {
+		mainData[exifCopyrightKey] = parseCopyright(copyright)
+	}
+
+	for key, boxType := range map[string]string{exifMakeKey: makeBoxType, exifModelKey: modelBoxType} {
+		data, err := findVendorData(r, movie, boxType)
+		if err != nil {
+			return nil, err
+		}
+		if data != nil {
+			mainData[key] = parseQuickTimeString(data)
+		}
+	}
+
+	return mainData, nil
+}
+
+//	findVendorData reads the first box of the type at the top level, in a top level "free" box, or in moov/udta,
+//	which is where dashcams store their own boxes.
+//	Params:
+//		r io.ReaderAt
+//		movie *bmff.Movie
+//		boxType string
+//	Returns:
+//		[]byte: nil if there's no such box
+//		error
+func findVendorData(r io.ReaderAt, movie *bmff.Movie, boxType string) ([]byte, error) {
+	candidates := append([]*bmff.Box{}, movie.Boxes...)
+	for _, box := range movie.Boxes {
+		if box.Type != "free" {
+			continue
+		}
+		// Not every free box has children, so ones that can't be read as boxes are ignored.
+		if children, err := bmff.ReadChildren(r, box); err == nil {
+			candidates = append(candidates, children...)
+		}
+	}
+	candidates = append(candidates, movie.UserData...)
+
+	box := bmff.Find(candidates, boxType)
+	if box == nil {
+		return nil, nil
+	}
+	data, err := bmff.ReadData(r, box)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %q box: %w", boxType, err)
+	}
+	return data, nil
+}
+
+// parseCopyright reads a BlackVue cprt, which is just text, or an ISO cprt, which is a full box with a language.
+func parseCopyright(data []byte) string {
+	if len(data) >= 6 && bytes.Equal(data[:4], []byte{0, 0, 0, 0}) {
+		data = data[6:]
+	}
+	return strings.TrimSpace(strings.Trim(string(data), "\x00"))
+}
+
+// parseQuickTimeString reads a QuickTime user data string, which has a 16 bit length and language before the text.
+func parseQuickTimeString(data []byte) string {
+	if len(data) >= 4 {
+		if length := int(binary.BigEndian.Uint16(data[:2])); 4+length <= len(data) {
+			data = data[4 : 4+length]
+		}
+	}
+	return strings.TrimSpace(strings.Trim(string(data), "\x00"))
+}
+
+//	nmeaGPSDocs converts the valid RMC sentences of a BlackVue "gps " box into exiftool's GPS docs.  Sentences that
+//	can't be parsed are skipped, dashcams sometimes cut off the last one.
+//	Params:
+//		data []byte
+//	Returns:
+//		[]map[string]interface{}
+func nmeaGPSDocs(data []byte) []map[string]interface{} {
+	docs := []map[string]interface{}{}
+	var firstTime time.Time
+	scanner := bufio.NewScanner(bytes.NewReader(bytes.Trim(data, "\x00")))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if end := strings.Index(line, "]"); strings.HasPrefix(line, "[") && end > 0 {
+			line = line[end+1:]
+		}
+		if !nmea.IsRMC(line) {
+			continue
+		}
+		rmc, err := nmea.ParseRMC(line)
+		if err != nil || !rmc.Valid {
+			continue
+		}
+		if firstTime.IsZero() {
+			firstTime = rmc.Time
+		}
+		docs = append(docs, gpsDoc(rmc.Time.Format(nmeaGPSDateTimeLayout), rmc.Latitude, rmc.Longitude, rmc.SpeedKnots*nmea.KnotsToKilometersPerHour, rmc.Time.Sub(firstTime)))
+	}
+	return docs
+}
+
+//	gpmfGPSDocs converts the first GPS5 sample of each sample of a GPMF track into exiftool's GPS docs, so there's
+//	one a second like the NMEA fixes of other dashcams.  Samples without a fix are skipped.  If the track has ACCL
+//	samples that can be calibrated against the GPS speeds, each doc also has the vehicle's mean longitudinal and
+//	lateral acceleration over its own sample, and its yaw rate if the sample has GYRO samples.
+//	Params:
+//		r io.ReaderAt
+//		track *bmff.Track
+//	Returns:
+//		[]map[string]interface{}
+//		error
+func gpmfGPSDocs(r io.ReaderAt, track *bmff.Track) ([]map[string]interface{}, error) {
+	docs := []map[string]interface{}{}
+	windows := []*imu.Window{}
+	for _, sample := range track.Samples {
+		data, err := bmff.ReadSample(r, sample)
+		if err != nil {
+			return nil, err
+		}
+		gps, err := gpmf.ReadGPS(data)
+		if err != nil {
+			return nil, fmt.Errorf("error reading GPMF sample at %v: %w", sample.Time, err)
+		}
+		if gps == nil || len(gps.Samples) == 0 || gps.Fix == 0 || gps.Fix == 1 {
+			continue
+		}
+		fix := gps.Samples[0]
+		docs = append(docs, gpsDoc(gps.Time.Format(gpmfGPSDateTimeLayout), fix.Latitude, fix.Longitude, fix.Speed2DMetersPerSecond*metersPerSecondToKilometersPerHour, sample.Time))
+
+		window := &imu.Window{
+			Time:                 gps.Time,
+			Duration:             sample.Duration,
+			SpeedMetersPerSecond: fix.Speed2DMetersPerSecond,
+		}
+		imuData, err := gpmf.ReadIMU(data)
+		if err != nil {
+			return nil, fmt.Errorf("error reading GPMF sample at %v: %w", sample.Time, err)
+		}
+		if imuData != nil {
+			window.Accelerometer = imuData.Accelerometer
+			window.Gyroscope = imuData.Gyroscope
+		}
+		windows = append(windows, window)
+	}
+
+	accelerations, err := imu.VehicleAccelerations(windows)
+	if errors.Is(err, imu.ErrUncalibrated) {
+		// The accelerations are derived from the GPS speeds instead.
+		return docs, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error calculating vehicle accelerations: %w", err)
+	}
+	for i, acceleration := range accelerations {
+		if acceleration == nil {
+			continue
+		}
+		docs[i][exifLongitudinalAccelerationKey] = acceleration.LongitudinalMetersPerSecondSquared
+		docs[i][exifLateralAccelerationKey] = acceleration.LateralMetersPerSecondSquared
+		if len(windows[i].Gyroscope) > 0 {
+			docs[i][exifYawRateKey] = acceleration.YawRateRadiansPerSecond
+		}
+	}
+	return docs, nil
+}
+
+// gpsDoc is a GPS fix the way exiftool prints it.
+func gpsDoc(dateTime string, latitude, longitude, speedKmh float64, sampleTime time.Duration) map[string]interface{} {
+	return map[string]interface{}{
+		exifGPSDateTimeKey:   dateTime,
+		exifGPSLatKey:        formatExifDegrees(latitude, "N", "S"),
+		exifGPSLongKey:       formatExifDegrees(longitude, "E", "W"),
+		exifGPSSpeedKey:      math.Round(speedKmh*1000) / 1000,
+		exifGPSSpeedRefKey:   "km/h",
+		exifGPSSampleTimeKey: fmt.Sprintf("%.2f s", sampleTime.Seconds()),
+	}
+}
+
+// formatExifDegrees formats degrees the way exiftool does, e.g. "40 deg 24' 55.86\" N".
+func formatExifDegrees(degrees float64, positive, negative string) string {
+	direction := positive
+	if degrees < 0 {
+		direction = negative
+	}
+	// Rounding to hundredths of a second before splitting keeps the seconds below 60.
+	hundredths := int64(math.Round(math.Abs(degrees) * 360000))
+	return fmt.Sprintf("%d deg %d' %.2f\" %s", hundredths/360000, hundredths%360000/6000, float64(hundredths%6000)/100, direction)
+}
+
+// formatExifDuration formats a duration the way exiftool does for durations of at least 30 seconds, e.g. "0:01:00".
+func formatExifDuration(duration time.Duration) string {
+	seconds := int64(math.Round(duration.Seconds()))
+	return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds%3600/60, seconds%60)
+}
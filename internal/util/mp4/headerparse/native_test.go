@@ -0,0 +1,337 @@
+package headerparse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"seneca/internal/client/logging"
+	"seneca/internal/util"
+	"sort"
+	"testing"
+	"time"
+)
+
+var testMacEpoch = time.Date(1904, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+func testBox(boxType string, payloads ...[]byte) []byte {
+	data := bytes.Join(payloads, nil)
+	return append(append(testU32(uint32(len(data)+8)), boxType...), data...)
+}
+
+func testU32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
+
+type testTrack struct {
+	handlerType    string
+	format         string
+	compressorName string
+	// samples are stored in one chunk, a second apart.
+	samples [][]byte
+}
+
+// writeTestMP4 writes an MP4 with the tracks, and the extra boxes at the top level, to a temp file.
+func writeTestMP4(t *testing.T, majorBrand string, createTime time.Time, duration time.Duration, extraBoxes []byte, tracks ...testTrack) string {
+	ftyp := testBox("ftyp", []byte(majorBrand), testU32(0))
+	mdatData := []byte{}
+	chunkOffsets := []uint32{}
+	for _, track := range tracks {
+		chunkOffsets = append(chunkOffsets, uint32(len(ftyp)+len(extraBoxes)+8+len(mdatData)))
+		mdatData = append(mdatData, bytes.Join(track.samples, nil)...)
+	}
+	mdat := testBox("mdat", mdatData)
+
+	createSeconds := testU32(uint32(createTime.Sub(testMacEpoch) / time.Second))
+	moovChildren := [][]byte{
+		testBox("mvhd", testU32(0), createSeconds, testU32(0), testU32(1000), testU32(uint32(duration.Milliseconds())), make([]byte, 80)),
+	}
+	for i, track := range tracks {
+		entry := make([]byte, 8)
+		if track.compressorName != "" {
+			visual := make([]byte, 34+32)
+			visual[34] = byte(len(track.compressorName))
+			copy(visual[35:], track.compressorName)
+			entry = append(entry, visual...)
+		}
+		sizes := []byte{}
+		for _, sample := range track.samples {
+			sizes = append(sizes, testU32(uint32(len(sample)))...)
+		}
+		moovChildren = append(moovChildren, testBox("trak",
+			testBox("tkhd", testU32(0), createSeconds, testU32(0), testU32(uint32(i+1)), testU32(0), testU32(uint32(duration.Milliseconds()))),
+			testBox("mdia",
+				testBox("mdhd", testU32(0), createSeconds, testU32(0), testU32(1), testU32(uint32(len(track.samples)))),
+				testBox("hdlr", testU32(0), testU32(0), []byte(track.handlerType), make([]byte, 12)),
+				testBox("minf", testBox("stbl",
+					testBox("stsd", testU32(0), testU32(1), testBox(track.format, entry)),
+					testBox("stts", testU32(0), testU32(1), testU32(uint32(len(track.samples))), testU32(1)),
+					testBox("stsc", testU32(0), testU32(1), testU32(1), testU32(uint32(len(track.samples))), testU32(1)),
+					testBox("stsz", testU32(0), testU32(0), testU32(uint32(len(track.samples))), sizes),
+					testBox("stco", testU32(0), testU32(1), testU32(chunkOffsets[i])),
+				)),
+			),
+		))
+	}
+
+	file := bytes.Join([][]byte{ftyp, extraBoxes, mdat, testBox("moov", moovChildren...)}, nil)
+	path := filepath.Join(t.TempDir(), "test video.mp4")
+	if err := ioutil.WriteFile(path, file, 0600); err != nil {
+		t.Fatalf("ioutil.WriteFile() returns err: %v", err)
+	}
+	return path
+}
+
+// testGPMF encodes a GPMF payload with one GPS5 sample, and an ACCL stream if there are accelerometer samples.
+func testGPMF(gpsTime time.Time, latitude, longitude, speedMetersPerSecond float64, accelerometer, gyroscope [][3]float64) []byte {
+	klv := func(key string, typ byte, size, repeat int, data []byte) []byte {
+		out := append([]byte(key), typ, byte(size), 0, byte(repeat))
+		out = append(out, data...)
+		for len(out)%4 != 0 {
+			out = append(out, 0)
+		}
+		return out
+	}
+	nested := func(key string, children ...[]byte) []byte {
+		data := bytes.Join(children, nil)
+		return append(append([]byte(key), 0, 1, byte(len(data)>>8), byte(len(data))), data...)
+	}
+	gps5 := bytes.Join([][]byte{
+		testU32(uint32(int32(latitude * 1e7))),
+		testU32(uint32(int32(longitude * 1e7))),
+		testU32(0),
+		testU32(uint32(int32(speedMetersPerSecond * 1000))),
+		testU32(uint32(int32(speedMetersPerSecond * 1000))),
+	}, nil)
+	scal := bytes.Join([][]byte{testU32(1e7), testU32(1e7), testU32(1000), testU32(1000), testU32(1000)}, nil)
+	streams := [][]byte{nested("STRM",
+		klv("GPSF", 'L', 4, 1, testU32(3)),
+		klv("GPSU", 'U', 16, 1, []byte(gpsTime.Format("060102150405.000"))),
+		klv("SCAL", 'l', 4, 5, scal),
+		klv("GPS5", 'l', 20, 1, gps5),
+	)}
+	if len(accelerometer) > 0 {
+		accl := []byte{}
+		for _, sample := range accelerometer {
+			for _, value := range sample {
+				// In cm/s².
+				accl = append(accl, testU32(uint32(int32(math.Round(value*100))))...)
+			}
+		}
+		streams = append(streams, nested("STRM",
+			klv("SCAL", 'l', 4, 1, testU32(100)),
+			klv("ACCL", 'l', 12, len(accelerometer), accl),
+		))
+	}
+	if len(gyroscope) > 0 {
+		gyro := []byte{}
+		for _, sample := range gyroscope {
+			for _, value := range sample {
+				// In mrad/s.
+				gyro = append(gyro, testU32(uint32(int32(math.Round(value*1000))))...)
+			}
+		}
+		streams = append(streams, nested("STRM",
+			klv("SCAL", 'l', 4, 1, testU32(1000)),
+			klv("GYRO", 'l', 12, len(gyroscope), gyro),
+		))
+	}
+	return nested("DEVC", streams...)
+}
+
+// testRMC encodes an RMC sentence the way BlackVue logs it.
+func testRMC(gpsTime time.Time, speedKnots float64) string {
+	body := fmt.Sprintf("GPRMC,%s,A,4024.93100,N,07425.83616,W,%.3f,,%s,,,A", gpsTime.Format("150405.00"), speedKnots, gpsTime.Format("020106"))
+	checksum := byte(0)
+	for i := 0; i < len(body); i++ {
+		checksum ^= body[i]
+	}
+	return fmt.Sprintf("[%d]$%s*%02X\n", util.TimeToMilliseconds(gpsTime), body, checksum)
+}
+
+func TestParseVideoMetadataNatively(t *testing.T) {
+	// Garmin's GPS time is UTC, which is 5 hours ahead of its local create time in New Jersey in February.
+	createTime := time.Date(2021, time.February, 13, 17, 47, 49, 0, time.UTC)
+	gpsStart := time.Date(2021, time.February, 13, 22, 47, 50, 0, time.UTC)
+	samples := [][]byte{}
+	speeds := []float64{10, 10, 11, 13, 12}
+	for i, speed := range speeds {
+		samples = append(samples, testGPMF(gpsStart.Add(time.Second*time.Duration(i)), 40.41551, -74.43060, speed, nil, nil))
+	}
+	path := writeTestMP4(t, "avc1", createTime, time.Minute, nil,
+		testTrack{handlerType: "vide", format: "avc1", compressorName: "Ambarella AVC encoder"},
+		testTrack{handlerType: "meta", format: "gpmd", samples: samples},
+	)
+
+	rawVideo, locations, motions, times, err := NewNativeMP4Tool(logging.NewLocalLogger(false)).ParseVideoMetadata(path)
+	if err != nil {
+		t.Fatalf("ParseVideoMetadata() returns err: %v", err)
+	}
+
+	if rawVideo.CreateTimeMs != util.TimeToMilliseconds(createTime) || rawVideo.DurationMs != time.Minute.Milliseconds() {
+		t.Errorf("Want create time %v and duration 1m, got %v and %dms", createTime, util.MillisecondsToTime(rawVideo.CreateTimeMs), rawVideo.DurationMs)
+	}
+	if len(locations) != len(speeds) || len(motions) != len(speeds) || len(times) != len(speeds) {
+		t.Fatalf("Want %d locations, motions and times, got %d, %d and %d", len(speeds), len(locations), len(motions), len(times))
+	}
+	if want := createTime.Add(time.Second); !times[0].Equal(want) {
+		t.Errorf("Want first time %v, got %v", want, times[0])
+	}
+	if lat := locations[0].Lat; lat.Degrees != 40 || lat.DegreeMinutes != 24 || lat.DegreeSeconds != 55.84 {
+		t.Errorf("Want latitude 40 deg 24' 55.84\", got %v", lat)
+	}
+	// 10, 11, 13 and 12 m/s are 22, 25, 29 and 27 mph.
+	wantAccelerations := []float64{0, 0, 3, 4, -2}
+	for i, motion := range motions {
+		if motion.AccelerationMphS != wantAccelerations[i] {
+			t.Errorf("Want acceleration %f at index %d, got %f", wantAccelerations[i], i, motion.AccelerationMphS)
+		}
+	}
+}
+
+func TestParseVideoMetadataNativelyWithAccelerometer(t *testing.T) {
+	createTime := time.Date(2021, time.February, 13, 17, 47, 49, 0, time.UTC)
+	gpsStart := time.Date(2021, time.February, 13, 22, 47, 50, 0, time.UTC)
+	// The camera's X axis is forward, Y is left and Z is up.
+	accelerations := []float64{3, 2, 0, -1, -5, -3, 1, 2, 0, 0}
+	lateralAccelerations := []float64{0, 1, 2, 1, 0, -1, -2, -1, 0, 0}
+	samples := [][]byte{}
+	yawRates := []float64{}
+	speed := 10.0
+	for i, acceleration := range accelerations {
+		accelerometer := [][3]float64{}
+		for j := 0; j < 20; j++ {
+			accelerometer = append(accelerometer, [3]float64{acceleration, lateralAccelerations[i] + float64(j%2) - 0.5, 9.81})
+		}
+		// The yaw rate that gives the lateral acceleration at the speed.
+		yawRate := math.Round(lateralAccelerations[i]/speed*1000) / 1000
+		gyroscope := [][3]float64{}
+		for j := 0; j < 40; j++ {
+			gyroscope = append(gyroscope, [3]float64{0, 0, yawRate})
+		}
+		samples = append(samples, testGPMF(gpsStart.Add(time.Second*time.Duration(i)), 40.41551, -74.43060, speed, accelerometer, gyroscope))
+		yawRates = append(yawRates, yawRate)
+		speed += acceleration
+	}
+	path := writeTestMP4(t, "avc1", createTime, time.Minute, nil,
+		testTrack{handlerType: "vide", format: "avc1", compressorName: "Ambarella AVC encoder"},
+		testTrack{handlerType: "meta", format: "gpmd", samples: samples},
+	)
+
+	_, _, motions, _, err := NewNativeMP4Tool(logging.NewLocalLogger(false)).ParseVideoMetadata(path)
+	if err != nil {
+		t.Fatalf("ParseVideoMetadata() returns err: %v", err)
+	}
+	if len(motions) != len(accelerations) {
+		t.Fatalf("Want %d motions, got %d", len(accelerations), len(motions))
+	}
+	// The first motion has the accelerometer's acceleration too, rather than no speed change.
+	if want := accelerations[0] * 2.237; math.Abs(motions[0].AccelerationMphS-want) > 0.05 {
+		t.Errorf("Want first acceleration %f mph/s, got %f", want, motions[0].AccelerationMphS)
+	}
+	for i, motion := range motions {
+		// Each motion has the mean acceleration from its fix to the next.  1 m/s² is 2.237 mph/s.
+		want := accelerations[i] * 2.237
+		if math.Abs(motion.AccelerationMphS-want) > 0.05 {
+			t.Errorf("Want acceleration %f mph/s at index %d, got %f", want, i, motion.AccelerationMphS)
+		}
+	}
+
+	rawData, err := readNativeMetadata(path)
+	if err != nil {
+		t.Fatalf("readNativeMetadata() returns err: %v", err)
+	}
+	for i := range accelerations {
+		doc, ok := rawData[fmt.Sprintf("Doc%d", i+1)].(map[string]interface{})
+		if !ok {
+			t.Fatalf("Want GPS doc %d, got %v", i+1, rawData[fmt.Sprintf("Doc%d", i+1)])
+		}
+		if lateral, ok := doc[exifLateralAccelerationKey].(float64); !ok || math.Abs(lateral-lateralAccelerations[i]) > 0.05 {
+			t.Errorf("Want lateral acceleration %f in GPS doc %d, got %v", lateralAccelerations[i], i+1, doc[exifLateralAccelerationKey])
+		}
+		if yawRate, ok := doc[exifYawRateKey].(float64); !ok || math.Abs(yawRate-yawRates[i]) > 0.001 {
+			t.Errorf("Want yaw rate %f in GPS doc %d, got %v", yawRates[i], i+1, doc[exifYawRateKey])
+		}
+	}
+}
+
+func TestReadNativeMetadataBlackVue(t *testing.T) {
+	createTime := time.Date(2021, time.April, 4, 16, 49, 30, 0, time.UTC)
+	gpsStart := time.Date(2021, time.April, 4, 20, 49, 30, 0, time.UTC)
+	nmeaLog := testRMC(gpsStart, 10) + testRMC(gpsStart.Add(time.Second), 12.5) +
+		// Sentences that aren't RMC, have no fix or are cut off are skipped.
+		"[1617569372000]$GPGGA,204932.00,4024.93100,N,07425.83616,W,1,08,0.9,545.4,M,46.9,M,,*47\n" +
+		"[1617569372000]$GPRMC,204932.00,V,,,,,,,040421,,,N*70\n" +
+		"[1617569373000]$GPRMC,204933.00,A,4024.93"
+	vendorBoxes := testBox("free",
+		testBox("cprt", []byte("Pittasoft Co., Ltd.;DR750X-1CH;1.004;English;")),
+		testBox("gps ", []byte(nmeaLog), make([]byte, 16)),
+	)
+	path := writeTestMP4(t, "isom", createTime, time.Minute, vendorBoxes,
+		testTrack{handlerType: "vide", format: "avc1", compressorName: "AVC Coding"},
+	)
+
+	rawData, err := readNativeMetadata(path)
+	if err != nil {
+		t.Fatalf("readNativeMetadata() returns err: %v", err)
+	}
+	dashCamName, got, err := NewNativeMP4Tool(logging.NewLocalLogger(false)).extractData(rawData)
+	if err != nil {
+		t.Fatalf("extractData() returns err: %v", err)
+	}
+	if dashCamName != BlackVueDR750X1CH {
+		t.Errorf("Want %s, got %s", BlackVueDR750X1CH, dashCamName)
+	}
+
+	want := &unprocessedExifData{
+		startTime: "2021:04:04 16:49:30.000",
+		duration:  "0:01:00",
+		gpsData: []*unprocessedExifGPSData{
+			{datetime: "2021:04:04 20:49:30.00Z", latitude: "40 deg 24' 55.86\" N", longitude: "74 deg 25' 50.17\" W", speed: 18.52, speedRef: "km/h"},
+			{datetime: "2021:04:04 20:49:31.00Z", latitude: "40 deg 24' 55.86\" N", longitude: "74 deg 25' 50.17\" W", speed: 23.15, speedRef: "km/h"},
+		},
+	}
+	if got.startTime != want.startTime || got.duration != want.duration {
+		t.Errorf("Want start time %q and duration %q, got %q and %q", want.startTime, want.duration, got.startTime, got.duration)
+	}
+	sort.Slice(got.gpsData, func(i, j int) bool { return got.gpsData[i].datetime < got.gpsData[j].datetime })
+	if len(got.gpsData) != len(want.gpsData) {
+		t.Fatalf("Want %d GPS data, got %d", len(want.gpsData), len(got.gpsData))
+	}
+	for i, gpsData := range got.gpsData {
+		if *gpsData != *want.gpsData[i] {
+			t.Errorf("Want GPS data %d %+v, got %+v", i, want.gpsData[i], gpsData)
+		}
+	}
+}
+
+func TestParseVideoMetadataNativelyRejectsVideoWithoutGPS(t *testing.T) {
+	path := writeTestMP4(t, "avc1", time.Date(2021, time.February, 13, 17, 47, 49, 0, time.UTC), time.Minute, nil,
+		testTrack{handlerType: "vide", format: "avc1", compressorName: "Ambarella AVC encoder"},
+	)
+	if _, _, _, _, err := NewNativeMP4Tool(logging.NewLocalLogger(false)).ParseVideoMetadata(path); err == nil {
+		t.Errorf("Want err from ParseVideoMetadata() of a video without GPS data, got nil")
+	}
+}
+
+func TestFormatExifDegrees(t *testing.T) {
+	testCases := []struct {
+		degrees float64
+		want    string
+	}{
+		{degrees: 40.41551, want: "40 deg 24' 55.84\" N"},
+		{degrees: -74.4306944, want: "74 deg 25' 50.50\" S"},
+		// Seconds that round up to 60 carry into the minutes.
+		{degrees: 10.9999999, want: "11 deg 0' 0.00\" N"},
+	}
+
+	for _, tc := range testCases {
+		if got := formatExifDegrees(tc.degrees, "N", "S"); got != tc.want {
+			t.Errorf("formatExifDegrees(%f) = %q, want %q", tc.degrees, got, tc.want)
+		}
+	}
+}
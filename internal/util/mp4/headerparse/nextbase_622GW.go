@@ -0,0 +1,10 @@
+package headerparse
+
+var nextbase622GWDashCam = &dashCam{
+	name: Nextbase622GW,
+	detect: func(rawData map[string]interface{}) bool {
+		return mainStringEquals(rawData, exifMakeKey, "Nextbase") && mainStringEquals(rawData, exifModelKey, "622GW")
+	},
+	layout:    createDateLayout,
+	newParser: func() exifParserInterface { return &localTimeExifParser{} },
+}
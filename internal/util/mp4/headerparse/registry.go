@@ -0,0 +1,130 @@
+package headerparse
+
+import (
+	"fmt"
+	"seneca/api/senecaerror"
+	"strings"
+)
+
+// 	dashCam is how the metadata of a dashcam model is recognized, laid out and parsed.
+type dashCam struct {
+	name DashCamName
+	// detect returns whether the metadata, in the form runExifCommand returns, is from this dashcam.
+	detect func(rawData map[string]interface{}) bool
+	layout *parserValues
+	// newParser creates a parser for one video, parsers hold the video's data so they can't be shared.
+	newParser func() exifParserInterface
+}
+
+// 	dashCamRegistry holds the supported dashcams in the order they're detected in, so that a dashcam with a more
+// 	specific predicate can be registered before a more general one.
+type dashCamRegistry struct {
+	dashCams []*dashCam
+	byName   map[DashCamName]*dashCam
+}
+
+// defaultDashCams are the dashcams ExifMP4Tool supports.
+var defaultDashCams = newDashCamRegistry(
+	blackVueDR750X1CHDashCam,
+	garmin55DashCam,
+	nextbase622GWDashCam,
+	thinkwareU1000DashCam,
+	vantrueN4DashCam,
+	viofoA129PlusDashCam,
+)
+
+func newDashCamRegistry(dashCams ...*dashCam) *dashCamRegistry {
+	registry := &dashCamRegistry{byName: map[DashCamName]*dashCam{}}
+	for _, dc := range dashCams {
+		registry.register(dc)
+	}
+	return registry
+}
+
+// register adds the dashcam, panicking if it's incomplete or its name is taken since that's a programming error.
+func (dcr *dashCamRegistry) register(dc *dashCam) {
+	if dc.name == "" || dc.detect == nil || dc.layout == nil || dc.newParser == nil {
+		panic(fmt.Sprintf("dashcam %q is missing its name, predicate, layout or parser", dc.name))
+	}
+	if _, ok := dcr.byName[dc.name]; ok {
+		panic(fmt.Sprintf("dashcam %q is registered twice", dc.name))
+	}
+	dcr.dashCams = append(dcr.dashCams, dc)
+	dcr.byName[dc.name] = dc
+}
+
+// get returns the registered dashcam, or nil.
+func (dcr *dashCamRegistry) get(name DashCamName) *dashCam {
+	return dcr.byName[name]
+}
+
+// names lists the registered dashcams.
+func (dcr *dashCamRegistry) names() []string {
+	names := []string{}
+	for _, dc := range dcr.dashCams {
+		names = append(names, dc.name.String())
+	}
+	return names
+}
+
+//	infer returns the first dashcam whose predicate matches the metadata.
+//	Params:
+//		rawData map[string]interface{}
+//	Returns:
+//		*dashCam
+//		error: UserError if no dashcam matches
+func (dcr *dashCamRegistry) infer(rawData map[string]interface{}) (*dashCam, error) {
+	for _, dc := range dcr.dashCams {
+		if dc.detect(rawData) {
+			return dc, nil
+		}
+	}
+
+	description := []string{}
+	if mainData, ok := mainMetadata(rawData); ok {
+		for _, key := range []string{exifMakeKey, exifModelKey, exifCopyrightKey, exifCompressorNameKey} {
+			if value, ok := stringExists(key, mainData); ok {
+				description = append(description, fmt.Sprintf("%s=%q", key, value))
+			}
+		}
+	}
+	return nil, senecaerror.NewUserError(
+		"",
+		fmt.Errorf("dashcam could not be inferred from metadata [%s]", strings.Join(description, ", ")),
+		fmt.Sprintf("The video is from an unsupported dashcam, supported dashcams are %s.", strings.Join(dcr.names(), ", ")),
+	)
+}
+
+// mainMetadata returns the metadata under exifToolMetadataMainKey.
+func mainMetadata(rawData map[string]interface{}) (map[string]interface{}, bool) {
+	mainDataObj, ok := rawData[exifToolMetadataMainKey]
+	if !ok {
+		return nil, false
+	}
+	mainData, ok := mainDataObj.(map[string]interface{})
+	return mainData, ok
+}
+
+// mainStringContains returns whether the main metadata has the string key and it contains substr, ignoring case.
+func mainStringContains(rawData map[string]interface{}, key, substr string) bool {
+	mainData, ok := mainMetadata(rawData)
+	if !ok {
+		return false
+	}
+	value, ok := stringExists(key, mainData)
+	if !ok {
+		return false
+	}
+	return strings.Contains(strings.ToLower(value), strings.ToLower(substr))
+}
+
+// mainStringEquals returns whether the main metadata has the string key and it equals value, ignoring case and surrounding
+// spaces, so that e.g. a Vantrue "N4 Pro" isn't taken for an "N4".
+func mainStringEquals(rawData map[string]interface{}, key, value string) bool {
+	mainData, ok := mainMetadata(rawData)
+	if !ok {
+		return false
+	}
+	got, ok := stringExists(key, mainData)
+	return ok && strings.EqualFold(strings.TrimSpace(got), value)
+}
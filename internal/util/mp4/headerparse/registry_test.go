@@ -0,0 +1,212 @@
+package headerparse
+
+import (
+	"errors"
+	"io/ioutil"
+	"seneca/api/senecaerror"
+	"seneca/internal/client/logging"
+	"seneca/internal/util"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readExifToolFixture reads exiftool output recorded in a JSON file, in place of runExifCommand.
+func readExifToolFixture(filePath string) (map[string]interface{}, error) {
+	output, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return decodeExifToolOutput(output)
+}
+
+// acmeDashCam is registered in tests to check that registered dashcams are detected and parsed.  Its fixture is
+// made up, it's the camera TestUnsupportedDashCamReturnsUserError rejects.
+var acmeDashCam = &dashCam{
+	name: "Acme_DC-1",
+	detect: func(rawData map[string]interface{}) bool {
+		mainData, ok := mainMetadata(rawData)
+		if !ok {
+			return false
+		}
+		maker, _ := stringExists(exifMakeKey, mainData)
+		model, _ := stringExists(exifModelKey, mainData)
+		return maker == "Acme" && model == "DC-1"
+	},
+	layout: &parserValues{
+		videoStartTimeKey:    exifCreateDateKey,
+		gpsTimeKey:           exifGPSDateTimeKey,
+		videoStartTimeLayout: "2006:01:02 15:04:05",
+		gpsTimeLayout:        "2006:01:02 15:04:05Z",
+	},
+	newParser: func() exifParserInterface { return &localTimeExifParser{} },
+}
+
+func TestRegisteredDashCamIsParsed(t *testing.T) {
+	exifMP4Tool := NewExifMP4Tool(logging.NewLocalLogger(false))
+	exifMP4Tool.dashCams = newDashCamRegistry(blackVueDR750X1CHDashCam, garmin55DashCam, acmeDashCam)
+
+	pathToFixture := "../../../../test/testdata/exiftool/unsupported_camera.json"
+	rawData, err := readExifToolFixture(pathToFixture)
+	if err != nil {
+		t.Fatalf("readExifToolFixture(%q) returns err: %v", pathToFixture, err)
+	}
+	dashCamName, _, err := exifMP4Tool.extractData(rawData)
+	if err != nil {
+		t.Fatalf("extractData() returns err: %v", err)
+	}
+	if dashCamName != acmeDashCam.name {
+		t.Errorf("Want dashcam %s, got %s", acmeDashCam.name, dashCamName)
+	}
+
+	rawVideo, locations, motions, times, err := exifMP4Tool.parseVideoMetadata(pathToFixture, readExifToolFixture)
+	if err != nil {
+		t.Fatalf("parseVideoMetadata() for fixture %q returns err: %v", pathToFixture, err)
+	}
+	wantCreateTime := time.Date(2021, time.August, 20, 7, 45, 10, 0, time.UTC)
+	if rawVideo.GetCreateTimeMs() != util.TimeToMilliseconds(wantCreateTime) || rawVideo.GetDurationMs() != time.Minute.Milliseconds() {
+		t.Errorf("Want a 1 minute video created at %v, got %v", wantCreateTime, rawVideo)
+	}
+	if len(locations) != 1 || len(motions) != 1 || len(times) != 1 {
+		t.Fatalf("Want 1 location, motion and time, got %d, %d and %d", len(locations), len(motions), len(times))
+	}
+	// The GPS time is shifted from UTC to the local time of Sydney.
+	if wantTime := time.Date(2021, time.August, 20, 7, 45, 11, 0, time.UTC); !times[0].Equal(wantTime) {
+		t.Errorf("Want time %v, got %v", wantTime, times[0])
+	}
+
+	// Models are matched exactly.
+	mainData, _ := mainMetadata(rawData)
+	mainData[exifModelKey] = "DC-10"
+	if _, _, err := exifMP4Tool.extractData(rawData); err == nil {
+		t.Errorf("Want err from extractData() for another Acme model")
+	}
+}
+
+// TestDashCamFixturesAreParsed reads small MP4s made up for the dashcams without real recordings in the repo.  Each
+// has the dashcam's make and model in QuickTime user data, and 3 NMEA fixes in a "gps " box, from a second after the
+// video starts in New Jersey.
+func TestDashCamFixturesAreParsed(t *testing.T) {
+	testCases := []struct {
+		desc            string
+		pathToFixture   string
+		wantDashCamName DashCamName
+		wantCreateTime  time.Time
+	}{
+		{
+			desc:            "nextbase",
+			pathToFixture:   "../../../../test/testdata/mp4/nextbase_622gw.mp4",
+			wantDashCamName: Nextbase622GW,
+			wantCreateTime:  time.Date(2021, time.June, 12, 9, 15, 0, 0, time.UTC),
+		},
+		{
+			desc:            "thinkware",
+			pathToFixture:   "../../../../test/testdata/mp4/thinkware_u1000.mp4",
+			wantDashCamName: ThinkwareU1000,
+			wantCreateTime:  time.Date(2021, time.June, 1, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			desc:            "vantrue",
+			pathToFixture:   "../../../../test/testdata/mp4/vantrue_n4.mp4",
+			wantDashCamName: VantrueN4,
+			wantCreateTime:  time.Date(2021, time.July, 4, 14, 30, 0, 0, time.UTC),
+		},
+		{
+			desc:            "viofo",
+			pathToFixture:   "../../../../test/testdata/mp4/viofo_a129_plus.mp4",
+			wantDashCamName: ViofoA129Plus,
+			wantCreateTime:  time.Date(2021, time.August, 20, 7, 45, 10, 0, time.UTC),
+		},
+	}
+
+	nativeMP4Tool := NewNativeMP4Tool(logging.NewLocalLogger(false))
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			rawData, err := readNativeMetadata(tc.pathToFixture)
+			if err != nil {
+				t.Fatalf("readNativeMetadata(%q) returns err: %v", tc.pathToFixture, err)
+			}
+			dashCamName, _, err := nativeMP4Tool.extractData(rawData)
+			if err != nil {
+				t.Fatalf("extractData() returns err: %v", err)
+			}
+			if dashCamName != tc.wantDashCamName {
+				t.Errorf("Want dashcam %s, got %s", tc.wantDashCamName, dashCamName)
+			}
+
+			rawVideo, locations, motions, times, err := nativeMP4Tool.ParseVideoMetadata(tc.pathToFixture)
+			if err != nil {
+				t.Fatalf("ParseVideoMetadata(%q) returns err: %v", tc.pathToFixture, err)
+			}
+			if rawVideo.GetCreateTimeMs() != util.TimeToMilliseconds(tc.wantCreateTime) || rawVideo.GetDurationMs() != time.Minute.Milliseconds() {
+				t.Errorf("Want a 1 minute video created at %v, got %v", tc.wantCreateTime, rawVideo)
+			}
+			if len(locations) != 3 || len(motions) != 3 || len(times) != 3 {
+				t.Fatalf("Want 3 locations, motions and times, got %d, %d and %d", len(locations), len(motions), len(times))
+			}
+			// The UTC GPS times are shifted to the local time of New Jersey.
+			if wantTime := tc.wantCreateTime.Add(time.Second); !times[0].Equal(wantTime) {
+				t.Errorf("Want first time %v, got %v", wantTime, times[0])
+			}
+		})
+	}
+}
+
+func TestDashCamModelsAreMatchedExactly(t *testing.T) {
+	pathToFixture := "../../../../test/testdata/mp4/vantrue_n4.mp4"
+	rawData, err := readNativeMetadata(pathToFixture)
+	if err != nil {
+		t.Fatalf("readNativeMetadata(%q) returns err: %v", pathToFixture, err)
+	}
+	mainData, _ := mainMetadata(rawData)
+
+	// Case and surrounding spaces don't matter.
+	mainData[exifModelKey] = " n4 "
+	if dashCamName, _, err := NewNativeMP4Tool(logging.NewLocalLogger(false)).extractData(rawData); err != nil || dashCamName != VantrueN4 {
+		t.Errorf("Want %s from extractData() for model %q, got %s, %v", VantrueN4, mainData[exifModelKey], dashCamName, err)
+	}
+
+	for _, model := range []string{"N4 Pro", "N4S", "N2"} {
+		mainData[exifModelKey] = model
+		var ue *senecaerror.UserError
+		if _, _, err := NewNativeMP4Tool(logging.NewLocalLogger(false)).extractData(rawData); !errors.As(err, &ue) {
+			t.Errorf("Want UserError from extractData() for Vantrue model %q, got %v", model, err)
+		}
+	}
+}
+
+func TestUnsupportedDashCamReturnsUserError(t *testing.T) {
+	exifMP4Tool := NewExifMP4Tool(logging.NewLocalLogger(false))
+
+	pathToFixture := "../../../../test/testdata/exiftool/unsupported_camera.json"
+	_, _, _, _, err := exifMP4Tool.parseVideoMetadata(pathToFixture, readExifToolFixture)
+	var ue *senecaerror.UserError
+	if !errors.As(err, &ue) {
+		t.Fatalf("Want UserError for fixture %q, got %v", pathToFixture, err)
+	}
+	if !strings.Contains(ue.Err.Error(), `Make="Acme"`) {
+		t.Errorf("Want the camera's make in the error, got %v", ue.Err)
+	}
+	for _, name := range []DashCamName{Garmin55, BlackVueDR750X1CH, Nextbase622GW, ThinkwareU1000, VantrueN4, ViofoA129Plus} {
+		if !strings.Contains(ue.ExternalMessage, name.String()) {
+			t.Errorf("Want %s in the external message, got %q", name, ue.ExternalMessage)
+		}
+	}
+
+	// Videos read natively are rejected the same way.
+	path := writeTestMP4(t, "mp42", time.Date(2021, time.February, 13, 17, 47, 49, 0, time.UTC), time.Minute, nil,
+		testTrack{handlerType: "vide", format: "avc1", compressorName: "Acme AVC"},
+	)
+	if _, _, _, _, err := NewNativeMP4Tool(logging.NewLocalLogger(false)).ParseVideoMetadata(path); !errors.As(err, &ue) {
+		t.Errorf("Want UserError from ParseVideoMetadata() of a video from an unsupported dashcam, got %v", err)
+	}
+}
+
+func TestDashCamRegistryRejectsDuplicates(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Want panic from registering %s twice, got none", Garmin55)
+		}
+	}()
+	newDashCamRegistry(garmin55DashCam, garmin55DashCam)
+}
@@ -0,0 +1,10 @@
+package headerparse
+
+var thinkwareU1000DashCam = &dashCam{
+	name: ThinkwareU1000,
+	detect: func(rawData map[string]interface{}) bool {
+		return mainStringEquals(rawData, exifMakeKey, "Thinkware") && mainStringEquals(rawData, exifModelKey, "U1000")
+	},
+	layout:    createDateLayout,
+	newParser: func() exifParserInterface { return &localTimeExifParser{} },
+}
@@ -0,0 +1,10 @@
+package headerparse
+
+var vantrueN4DashCam = &dashCam{
+	name: VantrueN4,
+	detect: func(rawData map[string]interface{}) bool {
+		return mainStringEquals(rawData, exifMakeKey, "Vantrue") && mainStringEquals(rawData, exifModelKey, "N4")
+	},
+	layout:    createDateLayout,
+	newParser: func() exifParserInterface { return &localTimeExifParser{} },
+}
@@ -0,0 +1,10 @@
+package headerparse
+
+var viofoA129PlusDashCam = &dashCam{
+	name: ViofoA129Plus,
+	detect: func(rawData map[string]interface{}) bool {
+		return mainStringEquals(rawData, exifMakeKey, "Viofo") && mainStringEquals(rawData, exifModelKey, "A129 Plus")
+	},
+	layout:    createDateLayout,
+	newParser: func() exifParserInterface { return &localTimeExifParser{} },
+}
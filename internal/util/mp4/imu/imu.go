@@ -0,0 +1,255 @@
+// Package imu converts a dashcam's accelerometer and gyroscope samples, which are in the camera's axes, into the
+// vehicle's longitudinal and lateral acceleration and yaw rate.
+package imu
+
+import (
+	"errors"
+	"math"
+	"seneca/internal/util/mp4/gpmf"
+	"time"
+)
+
+const (
+	// minGravity and maxGravity bound the magnitude of the mean accelerometer sample, outside of them the samples
+	// aren't in m/s².
+	minGravity = 7.0
+	maxGravity = 12.5
+	// minWindows is the fewest windows with a GPS speed change the forward axis is estimated from.
+	minWindows = 5
+	// minCorrelation is how closely the acceleration along the estimated forward axis has to follow the GPS speed
+	// changes for the axis to be trusted.
+	minCorrelation = 0.5
+	// ridgeFactor is the fraction of the horizontal acceleration's variance added to each axis when fitting the
+	// forward axis.
+	ridgeFactor = 0.01
+)
+
+// ErrUncalibrated is returned when the vehicle's axes can't be found from the samples, e.g. because the vehicle
+// didn't change speed.
+var ErrUncalibrated = errors.New("accelerometer could not be calibrated against GPS speed")
+
+// 	Window is the IMU samples over a period, and the GPS speed at its start, e.g. a GPMF payload.
+type Window struct {
+	// Time is when the window starts.
+	Time time.Time
+	// Duration is the period the samples are evenly spaced over.
+	Duration time.Duration
+	// SpeedMetersPerSecond is the GPS ground speed at Time.
+	SpeedMetersPerSecond float64
+	// Accelerometer samples are in m/s², including gravity.
+	Accelerometer []*gpmf.Vector
+	// Gyroscope samples are in rad/s, in the same axes as the accelerometer's.
+	Gyroscope []*gpmf.Vector
+}
+
+// 	Acceleration is the vehicle's acceleration over a window.
+type Acceleration struct {
+	// LongitudinalMetersPerSecondSquared is the mean over the window, positive when accelerating and negative
+	// when braking.
+	LongitudinalMetersPerSecondSquared float64
+	// LateralMetersPerSecondSquared is the mean over the window, positive when turning left and negative when
+	// turning right.
+	LateralMetersPerSecondSquared float64
+	// YawRateRadiansPerSecond is the mean over the window, positive when turning left, or 0 if the window has no
+	// gyroscope samples.
+	YawRateRadiansPerSecond float64
+}
+
+// 	frame is the vehicle's axes in the camera's.
+type frame struct {
+	forward vector
+	left    vector
+	up      vector
+	// longitudinalOffset corrects the part of gravity that's along the forward axis.
+	longitudinalOffset float64
+}
+
+//	VehicleAccelerations finds the vehicle's axes from the windows and returns the mean longitudinal and lateral
+//	acceleration and yaw rate of each.  The longitudinal acceleration is what the GPS speed change over the window
+//	measures, so accelerations from either mean the same.  Gravity is the mean of all samples, and the forward axis
+//	is the horizontal direction whose mean acceleration over each window best matches the GPS speed change to the
+//	next.  There's no reference for lateral acceleration, so it's only accurate if the vehicle's turns roughly
+//	cancel out over the windows.
+//	Params:
+//		windows []*Window: in time order
+//	Returns:
+//		[]*Acceleration: one per window, nil for windows without samples
+//		error: ErrUncalibrated if the vehicle's axes can't be found
+func VehicleAccelerations(windows []*Window) ([]*Acceleration, error) {
+	f, err := calibrate(windows)
+	if err != nil {
+		return nil, err
+	}
+
+	accelerations := make([]*Acceleration, len(windows))
+	for i, window := range windows {
+		if len(window.Accelerometer) == 0 {
+			continue
+		}
+		var mean vector
+		for _, sample := range window.Accelerometer {
+			mean = mean.add(fromSample(sample))
+		}
+		mean = mean.scale(1 / float64(len(window.Accelerometer)))
+		acceleration := &Acceleration{
+			LongitudinalMetersPerSecondSquared: mean.dot(f.forward) + f.longitudinalOffset,
+			LateralMetersPerSecondSquared:      mean.dot(f.left),
+		}
+		if len(window.Gyroscope) > 0 {
+			yawRate := 0.0
+			for _, sample := range window.Gyroscope {
+				yawRate += fromSample(sample).dot(f.up)
+			}
+			acceleration.YawRateRadiansPerSecond = yawRate / float64(len(window.Gyroscope))
+		}
+		accelerations[i] = acceleration
+	}
+	return accelerations, nil
+}
+
+func calibrate(windows []*Window) (*frame, error) {
+	var gravity vector
+	count := 0
+	for _, window := range windows {
+		for _, sample := range window.Accelerometer {
+			gravity = gravity.add(fromSample(sample))
+			count++
+		}
+	}
+	if count == 0 {
+		return nil, ErrUncalibrated
+	}
+	gravity = gravity.scale(1 / float64(count))
+	if g := gravity.norm(); g < minGravity || g > maxGravity {
+		return nil, ErrUncalibrated
+	}
+
+	// An accelerometer at rest reads 1 g upwards.
+	up := gravity.scale(1 / gravity.norm())
+	e1 := perpendicular(up)
+	e2 := up.cross(e1)
+
+	// Least squares of the GPS speed changes against the mean horizontal acceleration of each window.  The mean
+	// of the samples is slightly off gravity if the vehicle's speed changed over the windows, the intercept
+	// cancels that out along the forward axis.
+	means := [][2]float64{}
+	changes := []float64{}
+	var mx, my, md float64
+	for i := 0; i+1 < len(windows); i++ {
+		window, next := windows[i], windows[i+1]
+		elapsed := next.Time.Sub(window.Time).Seconds()
+		if len(window.Accelerometer) == 0 || elapsed <= 0 {
+			continue
+		}
+		var mean vector
+		for _, sample := range window.Accelerometer {
+			mean = mean.add(fromSample(sample))
+		}
+		mean = mean.scale(1 / float64(len(window.Accelerometer)))
+		x, y := mean.dot(e1), mean.dot(e2)
+		d := (next.SpeedMetersPerSecond - window.SpeedMetersPerSecond) / elapsed
+
+		means = append(means, [2]float64{x, y})
+		changes = append(changes, d)
+		mx, my, md = mx+x, my+y, md+d
+	}
+	if len(changes) < minWindows {
+		return nil, ErrUncalibrated
+	}
+	n := float64(len(changes))
+	mx, my, md = mx/n, my/n, md/n
+	var sxx, sxy, syy, sxd, syd float64
+	for i, mean := range means {
+		x, y, d := mean[0]-mx, mean[1]-my, changes[i]-md
+		sxx, sxy, syy = sxx+x*x, sxy+x*y, syy+y*y
+		sxd, syd = sxd+x*d, syd+y*d
+	}
+	// A straight drive only varies the acceleration along one axis, the ridge keeps the other from being fit to
+	// noise.
+	ridge := ridgeFactor * (sxx + syy)
+	sxx, syy = sxx+ridge, syy+ridge
+	det := sxx*syy - sxy*sxy
+	if det == 0 {
+		return nil, ErrUncalibrated
+	}
+	bx := (syy*sxd - sxy*syd) / det
+	by := (sxx*syd - sxy*sxd) / det
+	slope := math.Hypot(bx, by)
+	if slope == 0 {
+		return nil, ErrUncalibrated
+	}
+
+	forward := e1.scale(bx / slope).add(e2.scale(by / slope))
+	projected := make([]float64, len(means))
+	for i, mean := range means {
+		projected[i] = (mean[0]*bx + mean[1]*by) / slope
+	}
+	if correlation(projected, changes) < minCorrelation {
+		return nil, ErrUncalibrated
+	}
+
+	// The intercept, in the accelerometer's scale.
+	offset := (md - mx*bx - my*by) / slope
+	return &frame{forward: forward, left: up.cross(forward), up: up, longitudinalOffset: offset}, nil
+}
+
+// correlation is the Pearson correlation of xs and ys, or 0 if either is constant.
+func correlation(xs, ys []float64) float64 {
+	n := float64(len(xs))
+	var sx, sy float64
+	for i := range xs {
+		sx += xs[i]
+		sy += ys[i]
+	}
+	mx, my := sx/n, sy/n
+	var cov, vx, vy float64
+	for i := range xs {
+		cov += (xs[i] - mx) * (ys[i] - my)
+		vx += (xs[i] - mx) * (xs[i] - mx)
+		vy += (ys[i] - my) * (ys[i] - my)
+	}
+	if vx == 0 || vy == 0 {
+		return 0
+	}
+	return cov / math.Sqrt(vx*vy)
+}
+
+type vector [3]float64
+
+func fromSample(sample *gpmf.Vector) vector {
+	return vector{sample.X, sample.Y, sample.Z}
+}
+
+func (v vector) add(w vector) vector {
+	return vector{v[0] + w[0], v[1] + w[1], v[2] + w[2]}
+}
+
+func (v vector) scale(s float64) vector {
+	return vector{v[0] * s, v[1] * s, v[2] * s}
+}
+
+func (v vector) dot(w vector) float64 {
+	return v[0]*w[0] + v[1]*w[1] + v[2]*w[2]
+}
+
+func (v vector) cross(w vector) vector {
+	return vector{v[1]*w[2] - v[2]*w[1], v[2]*w[0] - v[0]*w[2], v[0]*w[1] - v[1]*w[0]}
+}
+
+func (v vector) norm() float64 {
+	return math.Sqrt(v.dot(v))
+}
+
+// perpendicular returns a unit vector perpendicular to the unit vector v.
+func perpendicular(v vector) vector {
+	// Crossing with the axis v is least aligned with keeps the result well conditioned.
+	axis := vector{1, 0, 0}
+	if math.Abs(v[0]) > math.Abs(v[1]) || math.Abs(v[0]) > math.Abs(v[2]) {
+		axis = vector{0, 1, 0}
+		if math.Abs(v[1]) > math.Abs(v[2]) {
+			axis = vector{0, 0, 1}
+		}
+	}
+	p := v.cross(axis)
+	return p.scale(1 / p.norm())
+}
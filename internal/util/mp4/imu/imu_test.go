@@ -0,0 +1,104 @@
+package imu
+
+import (
+	"errors"
+	"math"
+	"seneca/internal/util/mp4/gpmf"
+	"testing"
+	"time"
+)
+
+// cameraSample is a sample of a camera mounted with its Z axis forward, its X axis to the right and tilted 10
+// degrees down, so that gravity isn't along any of its axes.
+func cameraSample(longitudinal, lateral float64) *gpmf.Vector {
+	const gravity = 9.81
+	tilt := 10 * math.Pi / 180
+	// The vehicle's forward, left and up in the camera's axes, before the tilt.
+	up := gravity
+	forward := longitudinal*math.Cos(tilt) - up*math.Sin(tilt)
+	vertical := longitudinal*math.Sin(tilt) + up*math.Cos(tilt)
+	return &gpmf.Vector{X: -lateral, Y: -vertical, Z: forward}
+}
+
+// cameraRotation is a gyroscope sample of the camera of cameraSample while the vehicle turns at yawRate.
+func cameraRotation(yawRate float64) *gpmf.Vector {
+	tilt := 10 * math.Pi / 180
+	return &gpmf.Vector{X: 0, Y: -yawRate * math.Cos(tilt), Z: -yawRate * math.Sin(tilt)}
+}
+
+// testWindows has the vehicle turn at the yaw rate that gives the lateral acceleration at its speed.
+func testWindows(longitudinal, lateral []float64) []*Window {
+	start := time.Date(2021, time.February, 13, 22, 47, 50, 0, time.UTC)
+	windows := []*Window{}
+	speed := 10.0
+	for i := range longitudinal {
+		window := &Window{
+			Time:                 start.Add(time.Duration(i) * time.Second),
+			Duration:             time.Second,
+			SpeedMetersPerSecond: speed,
+		}
+		for j := 0; j < 200; j++ {
+			window.Accelerometer = append(window.Accelerometer, cameraSample(longitudinal[i], lateral[i]))
+		}
+		for j := 0; j < 400; j++ {
+			window.Gyroscope = append(window.Gyroscope, cameraRotation(lateral[i]/speed))
+		}
+		windows = append(windows, window)
+		speed += longitudinal[i]
+	}
+	return windows
+}
+
+func TestVehicleAccelerations(t *testing.T) {
+	longitudinal := []float64{2, 1.5, 0, -1, -4, -2, 0.5, 1, -0.5, 0}
+	// Turns don't change the longitudinal acceleration.
+	lateral := []float64{0, 0, 1, 2.5, 0, -1.5, -3, 0, 0.5, 0.5}
+	windows := testWindows(longitudinal, lateral)
+	// A pothole: a bump up and one down, which cancel out over the window.
+	windows[6].Accelerometer[100] = cameraSample(30, lateral[6])
+	windows[6].Accelerometer[150] = cameraSample(-29, lateral[6])
+
+	accelerations, err := VehicleAccelerations(windows)
+	if err != nil {
+		t.Fatalf("VehicleAccelerations() returns err: %v", err)
+	}
+	if len(accelerations) != len(windows) {
+		t.Fatalf("Want %d accelerations, got %d", len(windows), len(accelerations))
+	}
+	for i, acceleration := range accelerations {
+		if math.Abs(acceleration.LongitudinalMetersPerSecondSquared-longitudinal[i]) > 0.01 {
+			t.Errorf("Want window %d longitudinal acceleration %v, got %v", i, longitudinal[i], acceleration.LongitudinalMetersPerSecondSquared)
+		}
+		if math.Abs(acceleration.LateralMetersPerSecondSquared-lateral[i]) > 0.01 {
+			t.Errorf("Want window %d lateral acceleration %v, got %v", i, lateral[i], acceleration.LateralMetersPerSecondSquared)
+		}
+		wantYawRate := lateral[i] / windows[i].SpeedMetersPerSecond
+		if math.Abs(acceleration.YawRateRadiansPerSecond-wantYawRate) > 0.001 {
+			t.Errorf("Want window %d yaw rate %v, got %v", i, wantYawRate, acceleration.YawRateRadiansPerSecond)
+		}
+	}
+}
+
+func TestVehicleAccelerationsWithoutGyroscope(t *testing.T) {
+	windows := testWindows([]float64{2, 1.5, 0, -1, -4, -2, 0.5, 1, -0.5, 0}, []float64{0, 0, 1, 2.5, 0, -1.5, -3, 0, 0.5, 0.5})
+	for _, window := range windows {
+		window.Gyroscope = nil
+	}
+
+	accelerations, err := VehicleAccelerations(windows)
+	if err != nil {
+		t.Fatalf("VehicleAccelerations() returns err: %v", err)
+	}
+	for i, acceleration := range accelerations {
+		if acceleration.YawRateRadiansPerSecond != 0 {
+			t.Errorf("Want window %d yaw rate 0 without gyroscope samples, got %v", i, acceleration.YawRateRadiansPerSecond)
+		}
+	}
+}
+
+func TestVehicleAccelerationsAtConstantSpeed(t *testing.T) {
+	windows := testWindows(make([]float64, 10), []float64{0, 1, 2, 1, 0, -1, -2, -1, 0, 0})
+	if _, err := VehicleAccelerations(windows); !errors.Is(err, ErrUncalibrated) {
+		t.Errorf("Want ErrUncalibrated at constant speed, got %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+// Package nmea parses the NMEA 0183 sentences GPS receivers log, e.g. the RMC sentences BlackVue dashcams store
+// in their MP4s.
+package nmea
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// KnotsToKilometersPerHour is the ratio from knots to km/h.
+	KnotsToKilometersPerHour = float64(1.852)
+
+	rmcTimeLayout = "020106 150405.999999999"
+	rmcFieldCount = 10
+)
+
+// 	RMC is a recommended minimum specific GPS data sentence, e.g.
+// 	"$GPRMC,154930.00,A,4024.93100,N,07425.83616,W,0.123,,040421,,,A*7B".
+type RMC struct {
+	// Time is the UTC time of the fix.
+	Time time.Time
+	// Valid is whether the receiver had a fix, it didn't if the status is "V".
+	Valid bool
+	// Latitude is in degrees, negative in the south.
+	Latitude float64
+	// Longitude is in degrees, negative in the west.
+	Longitude  float64
+	SpeedKnots float64
+	// CourseDegrees is the track made good, from true north.
+	CourseDegrees float64
+}
+
+//	IsRMC returns whether the sentence is an RMC sentence of any talker, e.g. "$GPRMC" or "$GNRMC".
+//	Params:
+//		sentence string
+//	Returns:
+//		bool
+func IsRMC(sentence string) bool {
+	return len(sentence) > 6 && sentence[0] == '$' && sentence[3:6] == "RMC"
+}
+
+//	ParseRMC parses an RMC sentence.  The checksum is verified if there is one.
+//	Params:
+//		sentence string
+//	Returns:
+//		*RMC
+//		error
+func ParseRMC(sentence string) (*RMC, error) {
+	sentence = strings.TrimSpace(sentence)
+	if !IsRMC(sentence) {
+		return nil, fmt.Errorf("%q is not an RMC sentence", sentence)
+	}
+	body, err := verifyChecksum(sentence)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := strings.Split(body, ",")
+	if len(fields) < rmcFieldCount {
+		return nil, fmt.Errorf("RMC sentence %q has %d fields, want at least %d", sentence, len(fields), rmcFieldCount)
+	}
+
+	rmc := &RMC{Valid: fields[2] == "A"}
+	if rmc.Time, err = time.Parse(rmcTimeLayout, fields[9]+" "+fields[1]); err != nil {
+		return nil, fmt.Errorf("error parsing time of RMC sentence %q: %w", sentence, err)
+	}
+	if rmc.Latitude, err = parseCoordinate(fields[3], fields[4], "N", "S"); err != nil {
+		return nil, fmt.Errorf("error parsing latitude of RMC sentence %q: %w", sentence, err)
+	}
+	if rmc.Longitude, err = parseCoordinate(fields[5], fields[6], "E", "W"); err != nil {
+		return nil, fmt.Errorf("error parsing longitude of RMC sentence %q: %w", sentence, err)
+	}
+	if rmc.SpeedKnots, err = parseOptionalFloat(fields[7]); err != nil {
+		return nil, fmt.Errorf("error parsing speed of RMC sentence %q: %w", sentence, err)
+	}
+	if rmc.CourseDegrees, err = parseOptionalFloat(fields[8]); err != nil {
+		return nil, fmt.Errorf("error parsing course of RMC sentence %q: %w", sentence, err)
+	}
+
+	return rmc, nil
+}
+
+// verifyChecksum returns the sentence between "$" and "*", after checking its XOR checksum if there is one.
+func verifyChecksum(sentence string) (string, error) {
+	body := sentence[1:]
+	star := strings.LastIndex(body, "*")
+	if star < 0 {
+		return body, nil
+	}
+	want, err := strconv.ParseUint(body[star+1:], 16, 8)
+	if err != nil {
+		return "", fmt.Errorf("invalid checksum in sentence %q", sentence)
+	}
+	body = body[:star]
+	got := byte(0)
+	for i := 0; i < len(body); i++ {
+		got ^= body[i]
+	}
+	if got != byte(want) {
+		return "", fmt.Errorf("checksum of sentence %q is %02X, want %02X", sentence, got, want)
+	}
+	return body, nil
+}
+
+// parseCoordinate parses "ddmm.mmmm" or "dddmm.mmmm" and its hemisphere into degrees.
+func parseCoordinate(value, hemisphere, positive, negative string) (float64, error) {
+	dot := strings.Index(value, ".")
+	if dot < 0 {
+		dot = len(value)
+	}
+	if dot < 3 {
+		return 0, fmt.Errorf("invalid coordinate %q", value)
+	}
+	degrees, err := strconv.ParseFloat(value[:dot-2], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid degrees in coordinate %q", value)
+	}
+	minutes, err := strconv.ParseFloat(value[dot-2:], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid minutes in coordinate %q", value)
+	}
+	coordinate := degrees + minutes/60
+
+	switch hemisphere {
+	case positive:
+		return coordinate, nil
+	case negative:
+		return -coordinate, nil
+	}
+	return 0, fmt.Errorf("invalid hemisphere %q", hemisphere)
+}
+
+func parseOptionalFloat(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(value, 64)
+}
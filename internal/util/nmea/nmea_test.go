@@ -0,0 +1,74 @@
+package nmea
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestParseRMC(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		sentence string
+		want     *RMC
+		wantErr  bool
+	}{
+		{
+			desc:     "valid",
+			sentence: "$GPRMC,154930.00,A,4024.93100,N,07425.83616,W,10.5,87.3,040421,,,A*4A",
+			want: &RMC{
+				Time:          time.Date(2021, time.April, 4, 15, 49, 30, 0, time.UTC),
+				Valid:         true,
+				Latitude:      40 + 24.931/60,
+				Longitude:     -(74 + 25.83616/60),
+				SpeedKnots:    10.5,
+				CourseDegrees: 87.3,
+			},
+		},
+		{
+			desc:     "no fix without checksum",
+			sentence: "$GNRMC,000012.50,V,3350.000,S,15112.000,E,,,010121,,,N",
+			want: &RMC{
+				Time:      time.Date(2021, time.January, 1, 0, 0, 12, 500000000, time.UTC),
+				Latitude:  -(33 + 50.0/60),
+				Longitude: 151 + 12.0/60,
+			},
+		},
+		{
+			desc:     "bad checksum",
+			sentence: "$GPRMC,154930.00,A,4024.93100,N,07425.83616,W,10.5,87.3,040421,,,A*4B",
+			wantErr:  true,
+		},
+		{
+			desc:     "not RMC",
+			sentence: "$GPGGA,154930.00,4024.93100,N,07425.83616,W,1,08,0.9,545.4,M,46.9,M,,",
+			wantErr:  true,
+		},
+		{
+			desc:     "bad hemisphere",
+			sentence: "$GPRMC,154930.00,A,4024.93100,X,07425.83616,W,10.5,87.3,040421,,,A",
+			wantErr:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := ParseRMC(tc.sentence)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Want err from ParseRMC(%q), got %v", tc.sentence, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRMC(%q) returns err: %v", tc.sentence, err)
+			}
+			if !got.Time.Equal(tc.want.Time) || got.Valid != tc.want.Valid || got.SpeedKnots != tc.want.SpeedKnots || got.CourseDegrees != tc.want.CourseDegrees {
+				t.Errorf("Want %v, got %v", tc.want, got)
+			}
+			if math.Abs(got.Latitude-tc.want.Latitude) > 1e-9 || math.Abs(got.Longitude-tc.want.Longitude) > 1e-9 {
+				t.Errorf("Want coordinates %f, %f, got %f, %f", tc.want.Latitude, tc.want.Longitude, got.Latitude, got.Longitude)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package telemetry
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// csvTimeLayout is the layout of times without a zone, which are in UTC.
+const csvTimeLayout = "2006-01-02 15:04:05.999999999"
+
+var (
+	csvTimeColumns      = []string{"time", "timestamp", "datetime", "utc"}
+	csvLatitudeColumns  = []string{"latitude", "lat"}
+	csvLongitudeColumns = []string{"longitude", "lon", "lng", "long"}
+	// csvSpeedColumns are the speed columns by their ratio to m/s, "speed" without a unit is in m/s like GPX.
+	csvSpeedColumns = map[string]float64{
+		"speed":     1,
+		"speed_mps": 1,
+		"speed_kmh": 1 / 3.6,
+		"speed_mph": 1 / metersPerSecondToMph,
+	}
+)
+
+// parseCSV reads a table whose header names its columns, in any order and case:
+//	- time, timestamp, datetime or utc: RFC 3339, "2006-01-02 15:04:05" in UTC, or Unix seconds
+//	- latitude or lat, and longitude, lon, lng or long: in degrees
+//	- optionally speed or speed_mps, speed_kmh, or speed_mph, which may be empty
+// Other columns are ignored.
+func parseCSV(r io.Reader) ([]*Sample, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading CSV header: %w", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	timeColumn, err := findColumn(columns, csvTimeColumns)
+	if err != nil {
+		return nil, err
+	}
+	latitudeColumn, err := findColumn(columns, csvLatitudeColumns)
+	if err != nil {
+		return nil, err
+	}
+	longitudeColumn, err := findColumn(columns, csvLongitudeColumns)
+	if err != nil {
+		return nil, err
+	}
+	speedColumn, speedRatio := -1, 0.0
+	for name, ratio := range csvSpeedColumns {
+		if i, ok := columns[name]; ok {
+			if speedColumn >= 0 {
+				return nil, fmt.Errorf("CSV header %v has more than one speed column", header)
+			}
+			speedColumn, speedRatio = i, ratio
+		}
+	}
+
+	samples := []*Sample{}
+	// line is the line of the record, as long as there are no blank lines or fields spanning lines.
+	line := 1
+	for {
+		line++
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading CSV: %w", err)
+		}
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		if len(record) != len(header) {
+			return nil, fmt.Errorf("line %d has %d fields, the header has %d", line, len(record), len(header))
+		}
+
+		sample := &Sample{}
+		if sample.Time, err = parseCSVTime(record[timeColumn]); err != nil {
+			return nil, fmt.Errorf("error parsing time on line %d: %w", line, err)
+		}
+		if sample.Latitude, err = strconv.ParseFloat(strings.TrimSpace(record[latitudeColumn]), 64); err != nil {
+			return nil, fmt.Errorf("error parsing latitude on line %d: %w", line, err)
+		}
+		if sample.Longitude, err = strconv.ParseFloat(strings.TrimSpace(record[longitudeColumn]), 64); err != nil {
+			return nil, fmt.Errorf("error parsing longitude on line %d: %w", line, err)
+		}
+		if speedColumn >= 0 && strings.TrimSpace(record[speedColumn]) != "" {
+			speed, err := strconv.ParseFloat(strings.TrimSpace(record[speedColumn]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing speed on line %d: %w", line, err)
+			}
+			speed *= speedRatio
+			sample.SpeedMetersPerSecond = &speed
+		}
+		samples = append(samples, sample)
+	}
+	return samples, nil
+}
+
+func findColumn(columns map[string]int, names []string) (int, error) {
+	for _, name := range names {
+		if i, ok := columns[name]; ok {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("CSV header has none of the columns %v", names)
+}
+
+func parseCSVTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		whole, fraction := math.Modf(seconds)
+		return time.Unix(int64(whole), int64(math.Round(fraction*1e9))).UTC(), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t.UTC(), nil
+	}
+	t, err := time.Parse(csvTimeLayout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not an RFC 3339 time, %q or Unix seconds", value, csvTimeLayout)
+	}
+	return t, nil
+}
@@ -0,0 +1,64 @@
+package telemetry
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+// gpxFile is the part of a GPX document that's read: the points of its tracks.  Routes and waypoints have no
+// times, so they're ignored.
+type gpxFile struct {
+	Tracks []struct {
+		Segments []struct {
+			Points []*gpxPoint `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+type gpxPoint struct {
+	Latitude  float64 `xml:"lat,attr"`
+	Longitude float64 `xml:"lon,attr"`
+	Time      string  `xml:"time"`
+	// Speed is an element of GPX 1.0 points, 1.1 moved it to extensions, e.g. Garmin's TrackPointExtension.
+	Speed                    *float64 `xml:"speed"`
+	ExtensionSpeed           *float64 `xml:"extensions>speed"`
+	TrackPointExtensionSpeed *float64 `xml:"extensions>TrackPointExtension>speed"`
+}
+
+func parseGPX(r io.Reader) ([]*Sample, error) {
+	file := &gpxFile{}
+	if err := xml.NewDecoder(r).Decode(file); err != nil {
+		return nil, fmt.Errorf("error decoding GPX: %w", err)
+	}
+
+	samples := []*Sample{}
+	for _, track := range file.Tracks {
+		for _, segment := range track.Segments {
+			for _, point := range segment.Points {
+				if point.Time == "" {
+					return nil, fmt.Errorf("track point at %f, %f has no time", point.Latitude, point.Longitude)
+				}
+				t, err := time.Parse(time.RFC3339Nano, point.Time)
+				if err != nil {
+					return nil, fmt.Errorf("error parsing time of track point at %f, %f: %w", point.Latitude, point.Longitude, err)
+				}
+
+				sample := &Sample{
+					Time:      t.UTC(),
+					Latitude:  point.Latitude,
+					Longitude: point.Longitude,
+				}
+				for _, speed := range []*float64{point.Speed, point.ExtensionSpeed, point.TrackPointExtensionSpeed} {
+					if speed != nil {
+						sample.SpeedMetersPerSecond = speed
+						break
+					}
+				}
+				samples = append(samples, sample)
+			}
+		}
+	}
+	return samples, nil
+}
@@ -0,0 +1,57 @@
+package telemetry
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"seneca/internal/util/nmea"
+	"strings"
+)
+
+// knotsToMetersPerSecond is the ratio from knots to m/s.
+const knotsToMetersPerSecond = nmea.KnotsToKilometersPerHour / 3.6
+
+// parseNMEA reads the RMC sentences of the log.  Loggers often prefix sentences with their own timestamps and
+// write partial lines when they lose power, so anything before the "$" is ignored and sentences that don't parse
+// are skipped, as are fixes the receiver marked invalid.
+func parseNMEA(r io.Reader) ([]*Sample, error) {
+	samples := []*Sample{}
+	skipped := 0
+	var lastErr error
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		start := strings.Index(line, "$")
+		if start < 0 {
+			continue
+		}
+		line = line[start:]
+		if !nmea.IsRMC(line) {
+			continue
+		}
+
+		rmc, err := nmea.ParseRMC(line)
+		if err != nil {
+			skipped++
+			lastErr = err
+			continue
+		}
+		if !rmc.Valid {
+			continue
+		}
+		speed := rmc.SpeedKnots * knotsToMetersPerSecond
+		samples = append(samples, &Sample{
+			Time:                 rmc.Time,
+			Latitude:             rmc.Latitude,
+			Longitude:            rmc.Longitude,
+			SpeedMetersPerSecond: &speed,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading NMEA log: %w", err)
+	}
+	if len(samples) == 0 && skipped > 0 {
+		return nil, fmt.Errorf("none of the %d RMC sentences parse, the last error: %w", skipped, lastErr)
+	}
+	return samples, nil
+}
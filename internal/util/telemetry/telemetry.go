@@ -0,0 +1,157 @@
+// Package telemetry parses the GPS logs of vehicles without a dashcam, e.g. GPX tracks, raw NMEA logs and CSV
+// exports, into the locations, motions and times that are otherwise read from videos.
+package telemetry
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"seneca/api/constants"
+	st "seneca/api/type"
+	"seneca/internal/util/data"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Format is how a GPS log is encoded.
+type Format string
+
+const (
+	// GPX is a GPS Exchange Format track.
+	GPX Format = "gpx"
+	// NMEA is a log of NMEA 0183 sentences, one per line, of which the RMC sentences are read.
+	NMEA Format = "nmea"
+	// CSV is a table with a header row, see parseCSV() for its columns.
+	CSV Format = "csv"
+)
+
+// Formats are the supported formats, which are also the file extensions they're recognized by.
+var Formats = []Format{GPX, NMEA, CSV}
+
+// metersPerSecondToMph is the ratio from m/s to mph.
+const metersPerSecondToMph = 3.6 / constants.KilometersToMiles
+
+func (f Format) String() string {
+	return string(f)
+}
+
+// 	Sample is one GPS fix of a log.
+type Sample struct {
+	// Time is in UTC.
+	Time time.Time
+	// Latitude is in degrees, negative in the south.
+	Latitude float64
+	// Longitude is in degrees, negative in the west.
+	Longitude float64
+	// SpeedMetersPerSecond is the ground speed the logger recorded, or nil if it didn't.
+	SpeedMetersPerSecond *float64
+}
+
+//	FormatFromFileName returns the format of the file by its extension.
+//	Params:
+//		fileName string
+//	Returns:
+//		Format
+//		error: if the extension isn't one of Formats
+func FormatFromFileName(fileName string) (Format, error) {
+	extension := strings.ToLower(strings.TrimPrefix(filepath.Ext(fileName), "."))
+	for _, format := range Formats {
+		if extension == format.String() {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("file %q doesn't have one of the extensions %v", fileName, Formats)
+}
+
+//	Parse reads the samples of the log, sorted by time.  Samples with the same time as an earlier one are dropped.
+//	Params:
+//		format Format
+//		r io.Reader
+//	Returns:
+//		[]*Sample: at least one
+//		error
+func Parse(format Format, r io.Reader) ([]*Sample, error) {
+	var samples []*Sample
+	var err error
+	switch format {
+	case GPX:
+		samples, err = parseGPX(r)
+	case NMEA:
+		samples, err = parseNMEA(r)
+	case CSV:
+		samples, err = parseCSV(r)
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", format, err)
+	}
+
+	for i, sample := range samples {
+		if math.Abs(sample.Latitude) > 90 || math.Abs(sample.Longitude) > 180 || math.IsNaN(sample.Latitude) || math.IsNaN(sample.Longitude) {
+			return nil, fmt.Errorf("sample %d has invalid coordinates %f, %f", i, sample.Latitude, sample.Longitude)
+		}
+		if speed := sample.SpeedMetersPerSecond; speed != nil && (*speed < 0 || math.IsNaN(*speed)) {
+			return nil, fmt.Errorf("sample %d has invalid speed %f", i, *speed)
+		}
+	}
+
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].Time.Before(samples[j].Time) })
+	unique := []*Sample{}
+	for _, sample := range samples {
+		if len(unique) > 0 && unique[len(unique)-1].Time.Equal(sample.Time) {
+			continue
+		}
+		unique = append(unique, sample)
+	}
+	if len(unique) == 0 {
+		return nil, fmt.Errorf("no GPS samples in %s", format)
+	}
+	return unique, nil
+}
+
+//	ToLocationsMotionsTimes converts the samples to the data read from videos.  The speed of samples without one is
+//	the distance from the previous sample over the time between them, and acceleration is the change in speed from
+//	the previous sample over the time between them.  Times stay in UTC.
+//	Params:
+//		samples []*Sample: sorted by time, without duplicate times
+//	Returns:
+//		[]*st.Location
+//		[]*st.Motion
+//		[]time.Time
+func ToLocationsMotionsTimes(samples []*Sample) ([]*st.Location, []*st.Motion, []time.Time) {
+	locations := make([]*st.Location, len(samples))
+	motions := make([]*st.Motion, len(samples))
+	times := make([]time.Time, len(samples))
+	for i, sample := range samples {
+		locations[i] = &st.Location{
+			Lat:  data.Float64ToLatitude(sample.Latitude),
+			Long: data.Float64ToLongitude(sample.Longitude),
+		}
+		times[i] = sample.Time
+	}
+
+	for i, sample := range samples {
+		motion := &st.Motion{}
+		switch {
+		case sample.SpeedMetersPerSecond != nil:
+			motion.VelocityMph = *sample.SpeedMetersPerSecond * metersPerSecondToMph
+		case i > 0:
+			motion.VelocityMph = derivedSpeedMph(locations[i-1], locations[i], times[i].Sub(times[i-1]))
+		case len(samples) > 1:
+			// The first sample has no previous one, so it takes the speed to the next.
+			motion.VelocityMph = derivedSpeedMph(locations[0], locations[1], times[1].Sub(times[0]))
+		}
+		if i > 0 {
+			motion.AccelerationMphS = (motion.VelocityMph - motions[i-1].VelocityMph) / times[i].Sub(times[i-1]).Seconds()
+		}
+		motions[i] = motion
+	}
+	return locations, motions, times
+}
+
+func derivedSpeedMph(from, to *st.Location, elapsed time.Duration) float64 {
+	return data.DistanceMiles(from.Lat, from.Long, to.Lat, to.Long) / elapsed.Hours()
+}
@@ -0,0 +1,184 @@
+package telemetry
+
+import (
+	"math"
+	"seneca/internal/util/data"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testGPX = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1" xmlns:gpxtpx="http://www.garmin.com/xmlschemas/TrackPointExtension/v2">
+  <trk>
+    <trkseg>
+      <trkpt lat="40.4931" lon="-74.4306"><time>2021-02-13T22:47:51Z</time>
+        <extensions><gpxtpx:TrackPointExtension><gpxtpx:speed>11</gpxtpx:speed></gpxtpx:TrackPointExtension></extensions>
+      </trkpt>
+      <trkpt lat="40.4930" lon="-74.4305"><time>2021-02-13T17:47:50-05:00</time>
+        <extensions><gpxtpx:TrackPointExtension><gpxtpx:speed>10</gpxtpx:speed></gpxtpx:TrackPointExtension></extensions>
+      </trkpt>
+    </trkseg>
+    <trkseg>
+      <trkpt lat="40.4932" lon="-74.4307"><time>2021-02-13T22:47:52Z</time><speed>12.5</speed></trkpt>
+      <trkpt lat="40.4933" lon="-74.4308"><time>2021-02-13T22:47:52Z</time><speed>99</speed></trkpt>
+    </trkseg>
+  </trk>
+</gpx>`
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		format    Format
+		contents  string
+		wantTimes []time.Time
+		// wantSpeeds are in m/s, -1 for none.
+		wantSpeeds []float64
+		wantFirst  [2]float64
+	}{
+		{
+			desc:     "gpx",
+			format:   GPX,
+			contents: testGPX,
+			wantTimes: []time.Time{
+				time.Date(2021, time.February, 13, 22, 47, 50, 0, time.UTC),
+				time.Date(2021, time.February, 13, 22, 47, 51, 0, time.UTC),
+				time.Date(2021, time.February, 13, 22, 47, 52, 0, time.UTC),
+			},
+			wantSpeeds: []float64{10, 11, 12.5},
+			wantFirst:  [2]float64{40.4930, -74.4305},
+		},
+		{
+			desc:   "nmea",
+			format: NMEA,
+			contents: strings.Join([]string{
+				"2021-04-04 15:49:29 $GPGGA,154929.00,4024.93100,N,07425.83616,W,1,08,0.9,12.0,M,,,,",
+				"$GPRMC,154929.00,V,4024.93100,N,07425.83616,W,,,040421,,,N",
+				"$GPRMC,154930.00,A,4024.93100,N,07425.83616,W,10.5,87.3,040421,,,A*4A",
+				"2021-04-04 15:49:31 $GPRMC,154931.00,A,4024.93200,N,07425.83616,W,20,87.3,040421,,,A",
+				"$GPRMC,154932.00,A,4024.9",
+			}, "\n"),
+			wantTimes: []time.Time{
+				time.Date(2021, time.April, 4, 15, 49, 30, 0, time.UTC),
+				time.Date(2021, time.April, 4, 15, 49, 31, 0, time.UTC),
+			},
+			wantSpeeds: []float64{10.5 * 1.852 / 3.6, 20 * 1.852 / 3.6},
+			wantFirst:  [2]float64{40 + 24.931/60, -(74 + 25.83616/60)},
+		},
+		{
+			desc:   "csv",
+			format: CSV,
+			contents: strings.Join([]string{
+				"Lat, Lon, Timestamp, Speed_KMH, Heading",
+				"-33.85, 151.2, 2021-01-01T10:00:01+10:00, 36, 90",
+				"-33.86, 151.2, 1609459200, , 90",
+				"-33.87, 151.2, 2021-01-01 00:00:02.5, 72, 90",
+			}, "\n"),
+			wantTimes: []time.Time{
+				time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC),
+				time.Date(2021, time.January, 1, 0, 0, 1, 0, time.UTC),
+				time.Date(2021, time.January, 1, 0, 0, 2, 500000000, time.UTC),
+			},
+			wantSpeeds: []float64{-1, 10, 20},
+			wantFirst:  [2]float64{-33.86, 151.2},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			samples, err := Parse(tc.format, strings.NewReader(tc.contents))
+			if err != nil {
+				t.Fatalf("Parse() returns err: %v", err)
+			}
+			if len(samples) != len(tc.wantTimes) {
+				t.Fatalf("Want %d samples, got %d", len(tc.wantTimes), len(samples))
+			}
+			for i, sample := range samples {
+				if !sample.Time.Equal(tc.wantTimes[i]) || sample.Time.Location() != time.UTC {
+					t.Errorf("Want sample %d at %v, got %v", i, tc.wantTimes[i], sample.Time)
+				}
+				switch {
+				case tc.wantSpeeds[i] < 0 && sample.SpeedMetersPerSecond != nil:
+					t.Errorf("Want no speed for sample %d, got %f", i, *sample.SpeedMetersPerSecond)
+				case tc.wantSpeeds[i] >= 0 && (sample.SpeedMetersPerSecond == nil || math.Abs(*sample.SpeedMetersPerSecond-tc.wantSpeeds[i]) > 1e-9):
+					t.Errorf("Want speed %f for sample %d, got %v", tc.wantSpeeds[i], i, sample.SpeedMetersPerSecond)
+				}
+			}
+			if math.Abs(samples[0].Latitude-tc.wantFirst[0]) > 1e-9 || math.Abs(samples[0].Longitude-tc.wantFirst[1]) > 1e-9 {
+				t.Errorf("Want first sample at %v, got %f, %f", tc.wantFirst, samples[0].Latitude, samples[0].Longitude)
+			}
+		})
+	}
+}
+
+func TestParseRejectsInvalidLogs(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		format   Format
+		contents string
+	}{
+		{desc: "gpx point without time", format: GPX, contents: `<gpx><trk><trkseg><trkpt lat="1" lon="2"></trkpt></trkseg></trk></gpx>`},
+		{desc: "gpx without points", format: GPX, contents: `<gpx></gpx>`},
+		{desc: "malformed gpx", format: GPX, contents: `<gpx><trk>`},
+		{desc: "nmea without valid fixes", format: NMEA, contents: "$GPRMC,154929.00,V,4024.93100,N,07425.83616,W,,,040421,,,N\n"},
+		{desc: "nmea with bad checksums", format: NMEA, contents: "$GPRMC,154930.00,A,4024.93100,N,07425.83616,W,10.5,87.3,040421,,,A*4B\n"},
+		{desc: "csv without longitude", format: CSV, contents: "time,lat\n0,1\n"},
+		{desc: "csv with bad time", format: CSV, contents: "time,lat,lon\nyesterday,1,2\n"},
+		{desc: "csv with two speeds", format: CSV, contents: "time,lat,lon,speed,speed_mph\n0,1,2,3,4\n"},
+		{desc: "csv with invalid latitude", format: CSV, contents: "time,lat,lon\n0,91,2\n"},
+		{desc: "unknown format", format: Format("kml"), contents: "<kml></kml>"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if samples, err := Parse(tc.format, strings.NewReader(tc.contents)); err == nil {
+				t.Errorf("Want err from Parse(), got %d samples", len(samples))
+			}
+		})
+	}
+}
+
+func TestFormatFromFileName(t *testing.T) {
+	for fileName, want := range map[string]Format{"track.gpx": GPX, "LOG0001.NMEA": NMEA, "export.2021-01-01.csv": CSV} {
+		if got, err := FormatFromFileName(fileName); err != nil || got != want {
+			t.Errorf("Want %s from FormatFromFileName(%q), got %s, %v", want, fileName, got, err)
+		}
+	}
+	if _, err := FormatFromFileName("video.mp4"); err == nil {
+		t.Errorf("Want err from FormatFromFileName(%q), got nil", "video.mp4")
+	}
+}
+
+func TestToLocationsMotionsTimes(t *testing.T) {
+	start := time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+	logged := 4.4704
+	samples := []*Sample{
+		{Time: start, Latitude: 40, Longitude: -74},
+		// About 0.0138 miles north of the first.
+		{Time: start.Add(2 * time.Second), Latitude: 40.0002, Longitude: -74},
+		{Time: start.Add(4 * time.Second), Latitude: 40.0004, Longitude: -74, SpeedMetersPerSecond: &logged},
+	}
+
+	locations, motions, times := ToLocationsMotionsTimes(samples)
+	if len(locations) != 3 || len(motions) != 3 || len(times) != 3 {
+		t.Fatalf("Want 3 locations, motions and times, got %d, %d and %d", len(locations), len(motions), len(times))
+	}
+	if got := data.LatitudeToFloat64(locations[1].Lat); math.Abs(got-40.0002) > 1e-9 {
+		t.Errorf("Want latitude 40.0002, got %f", got)
+	}
+	if !times[2].Equal(start.Add(4 * time.Second)) {
+		t.Errorf("Want time %v, got %v", start.Add(4*time.Second), times[2])
+	}
+
+	derived := data.DistanceMiles(locations[0].Lat, locations[0].Long, locations[1].Lat, locations[1].Long) / (2 * time.Second).Hours()
+	if math.Abs(motions[0].VelocityMph-derived) > 1e-9 || math.Abs(motions[1].VelocityMph-derived) > 1e-9 {
+		t.Errorf("Want derived speed %f for the first two samples, got %f and %f", derived, motions[0].VelocityMph, motions[1].VelocityMph)
+	}
+	// 4.4704 m/s is 10 mph.
+	if math.Abs(motions[2].VelocityMph-10) > 0.01 {
+		t.Errorf("Want the logged speed of 10 mph, got %f", motions[2].VelocityMph)
+	}
+	if motions[0].AccelerationMphS != 0 || math.Abs(motions[2].AccelerationMphS-(motions[2].VelocityMph-derived)/2) > 1e-9 {
+		t.Errorf("Want accelerations 0 and %f, got %f and %f", (motions[2].VelocityMph-derived)/2, motions[0].AccelerationMphS, motions[2].AccelerationMphS)
+	}
+}
@@ -0,0 +1,172 @@
+package vehiclelog
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// obdResponseMode is the service byte of responses to OBD-II service 01 requests.
+	obdResponseMode = 0x41
+	// The service 01 PIDs that are read.
+	obdEngineSpeedPID  = 0x0C
+	obdVehicleSpeedPID = 0x0D
+	obdThrottlePID     = 0x11
+	// ECUs respond from 11-bit IDs 7E8 to 7EF, or from 29-bit IDs 18DAF1xx.
+	obdFirstResponseID   = 0x7E8
+	obdLastResponseID    = 0x7EF
+	obdExtendedResponses = 0x18DAF100
+
+	// The J1939 parameter groups of heavy vehicles that are read.
+	j1939ElectronicBrakeController1  = 0xF001
+	j1939ElectronicEngineController2 = 0xF003
+	j1939ElectronicEngineController1 = 0xF004
+	j1939CruiseControlVehicleSpeed   = 0xFEF1
+	// j1939MaxByte and j1939MaxWord are the highest valid values, higher ones mean errors or unavailable data.
+	j1939MaxByte = 0xFA
+	j1939MaxWord = 0xFAFF
+)
+
+// parseCandump reads the frames of a log written by candump -L, e.g. "(1617551369.123456) can0 7E8#03410D32", or by
+// candump -ta, e.g. "(1617551369.123456) can0 7E8 [4] 03 41 0D 32".  The frames read are:
+//	- OBD-II service 01 responses, from IDs 7E8 to 7EF or 18DAF1xx, for PIDs 0C (RPM), 0D (speed) and 11 (throttle)
+//	- J1939 EBC1 (brake pedal), EEC1 (RPM), EEC2 (accelerator pedal) and CCVS (speed and brake switch), for trucks
+// Other frames are ignored.  Times are Unix seconds.
+func parseCandump(r io.Reader) (*Log, error) {
+	log := &Log{}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		t, id, frame, err := parseCandumpLine(text)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing line %d: %w", line, err)
+		}
+		for _, sample := range decodeFrame(id, frame) {
+			sample.Time = t
+			log.Samples = append(log.Samples, sample)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading candump log: %w", err)
+	}
+	return log, nil
+}
+
+// parseCandumpLine returns the time, ID and data of the frame on the line.  The data of remote and CAN FD frames
+// is nil, since they're never read.
+func parseCandumpLine(text string) (time.Time, uint32, []byte, error) {
+	fields := strings.Fields(text)
+	if len(fields) < 3 || !strings.HasPrefix(fields[0], "(") || !strings.HasSuffix(fields[0], ")") {
+		return time.Time{}, 0, nil, fmt.Errorf("%q is not a timestamped frame, logs must be recorded with candump -L or -ta", text)
+	}
+	seconds, err := strconv.ParseFloat(strings.Trim(fields[0], "()"), 64)
+	if err != nil {
+		return time.Time{}, 0, nil, fmt.Errorf("error parsing timestamp %q: %w", fields[0], err)
+	}
+	whole, fraction := math.Modf(seconds)
+	t := time.Unix(int64(whole), int64(math.Round(fraction*1e6))*1e3).UTC()
+
+	// fields[1] is the interface.
+	idText, dataText := fields[2], ""
+	if i := strings.Index(idText, "#"); i >= 0 {
+		idText, dataText = fields[2][:i], fields[2][i+1:]
+		if strings.HasPrefix(dataText, "#") || strings.HasPrefix(dataText, "R") {
+			return t, 0, nil, nil
+		}
+	} else {
+		// The data bytes follow the length, e.g. "[4]".
+		if len(fields) < 4 || !strings.HasPrefix(fields[3], "[") {
+			return time.Time{}, 0, nil, fmt.Errorf("%q has no frame length", text)
+		}
+		if len(fields) > 4 && fields[4] == "remote" {
+			return t, 0, nil, nil
+		}
+		dataText = strings.Join(fields[4:], "")
+	}
+
+	id, err := strconv.ParseUint(idText, 16, 32)
+	if err != nil {
+		return time.Time{}, 0, nil, fmt.Errorf("error parsing ID %q: %w", idText, err)
+	}
+	data, err := hex.DecodeString(dataText)
+	if err != nil {
+		return time.Time{}, 0, nil, fmt.Errorf("error parsing data %q: %w", dataText, err)
+	}
+	return t, uint32(id), data, nil
+}
+
+// decodeFrame returns the samples in the frame, without their times.
+func decodeFrame(id uint32, data []byte) []*Sample {
+	if (id >= obdFirstResponseID && id <= obdLastResponseID) || id&^0xFF == obdExtendedResponses {
+		return decodeOBDResponse(data)
+	}
+	if id > 0x7FF && len(data) == 8 {
+		return decodeJ1939(id, data)
+	}
+	return nil
+}
+
+// decodeOBDResponse returns the sample in a single frame response to a service 01 request, whose first byte is
+// the length of the rest.
+func decodeOBDResponse(data []byte) []*Sample {
+	if len(data) < 4 || data[0] < 3 || int(data[0]) >= len(data) || data[1] != obdResponseMode {
+		return nil
+	}
+	a := float64(data[3])
+	switch data[2] {
+	case obdVehicleSpeedPID:
+		return []*Sample{{Signal: Speed, Value: a * kilometersPerHourToMph}}
+	case obdEngineSpeedPID:
+		if data[0] < 4 {
+			return nil
+		}
+		return []*Sample{{Signal: RPM, Value: (a*256 + float64(data[4])) / 4}}
+	case obdThrottlePID:
+		return []*Sample{{Signal: Throttle, Value: a * 100 / 255}}
+	}
+	return nil
+}
+
+// decodeJ1939 returns the samples in a J1939 frame, whose parameter group is in bits 8 to 25 of the ID.
+func decodeJ1939(id uint32, data []byte) []*Sample {
+	samples := []*Sample{}
+	switch pgn := (id >> 8) & 0x3FFFF; pgn {
+	case j1939ElectronicBrakeController1:
+		if data[1] <= j1939MaxByte {
+			samples = append(samples, &Sample{Signal: Brake, Value: float64(data[1]) * 0.4})
+		}
+	case j1939ElectronicEngineController2:
+		if data[1] <= j1939MaxByte {
+			samples = append(samples, &Sample{Signal: Throttle, Value: float64(data[1]) * 0.4})
+		}
+	case j1939ElectronicEngineController1:
+		if rpm := binary.LittleEndian.Uint16(data[3:5]); rpm <= j1939MaxWord {
+			samples = append(samples, &Sample{Signal: RPM, Value: float64(rpm) * 0.125})
+		}
+	case j1939CruiseControlVehicleSpeed:
+		if speed := binary.LittleEndian.Uint16(data[1:3]); speed <= j1939MaxWord {
+			samples = append(samples, &Sample{Signal: Speed, Value: float64(speed) / 256 * kilometersPerHourToMph})
+		}
+		// The brake switch is bits 5 and 6 of byte 4, 0 when released and 1 when pressed.
+		switch (data[3] >> 4) & 0x3 {
+		case 0:
+			samples = append(samples, &Sample{Signal: Brake, Value: 0})
+		case 1:
+			samples = append(samples, &Sample{Signal: Brake, Value: 100})
+		}
+	}
+	return samples
+}
@@ -0,0 +1,271 @@
+package vehiclelog
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	st "seneca/api/type"
+	"seneca/internal/util/data"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// elm327LocalTimeLayouts are the layouts of times without a zone, which are local times.
+var elm327LocalTimeLayouts = []string{"2006-01-02 15:04:05.999999999", "2006-01-02T15:04:05.999999999"}
+
+var (
+	elm327TimeColumns      = []string{"time", "timestamp", "datetime", "utc", "device_time", "gps_time"}
+	elm327LatitudeColumns  = []string{"latitude", "lat"}
+	elm327LongitudeColumns = []string{"longitude", "lon", "lng", "long"}
+	// elm327SignalColumns are the names of the signal columns, with their units removed.
+	elm327SignalColumns = map[string]Signal{
+		"speed":                      Speed,
+		"vehicle_speed":              Speed,
+		"speed_obd":                  Speed,
+		"obd_speed":                  Speed,
+		"rpm":                        RPM,
+		"engine_rpm":                 RPM,
+		"throttle":                   Throttle,
+		"throttle_position":          Throttle,
+		"relative_throttle_position": Throttle,
+		"accelerator_pedal_position": Throttle,
+		"brake":                      Brake,
+		"brake_pedal":                Brake,
+		"brake_pedal_position":       Brake,
+		"brake_switch":               Brake,
+	}
+	// elm327SpeedUnits are the ratios of speed units to mph.
+	elm327SpeedUnits = map[string]float64{
+		"mph":  1,
+		"km/h": kilometersPerHourToMph,
+		"kmh":  kilometersPerHourToMph,
+		"kph":  kilometersPerHourToMph,
+	}
+	// elm327SwitchValues are the values of on/off columns, as percentages.
+	elm327SwitchValues = map[string]float64{
+		"on":    100,
+		"true":  100,
+		"yes":   100,
+		"off":   0,
+		"false": 0,
+		"no":    0,
+	}
+)
+
+// elm327Columns are the indexes of the columns in the header, -1 for those it doesn't have.
+type elm327Columns struct {
+	time      int
+	latitude  int
+	longitude int
+	// signals are in the order of the header.
+	signals []elm327Column
+}
+
+// elm327Column is how the values of a signal column are read.
+type elm327Column struct {
+	index  int
+	signal Signal
+	// ratio converts the values to the unit of the signal.
+	ratio float64
+	// isSwitch is true for on/off columns, whose non-zero values are 100%.
+	isSwitch bool
+}
+
+// parseELM327 reads a table whose header names its columns, in any order and case, with their units either in
+// parentheses or brackets, e.g. "Speed (km/h)", or as a suffix, e.g. "speed_mph":
+//	- time, timestamp, datetime, utc, device_time or gps_time: RFC 3339, Unix seconds, or "2006-01-02 15:04:05" in
+//	  local time
+//	- any of the elm327SignalColumns, whose values may be empty or "-" since adapters poll one PID at a time.
+//	  Speeds without a unit are in km/h, the unit of PID 0x0D.
+//	- optionally latitude or lat, and longitude, lon, lng or long: in degrees
+// Other columns are ignored.  The delimiter may be ";", in which case values may have decimal commas.
+func parseELM327(r io.Reader) (*Log, error) {
+	fileBytes, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading CSV: %w", err)
+	}
+	reader := csvReader(fileBytes)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading CSV header: %w", err)
+	}
+
+	columns := parseHeader(header)
+	timeColumn, latitudeColumn, longitudeColumn := columns.time, columns.latitude, columns.longitude
+	if timeColumn < 0 {
+		return nil, fmt.Errorf("CSV header has none of the columns %v", elm327TimeColumns)
+	}
+	if len(columns.signals) == 0 {
+		return nil, fmt.Errorf("CSV header has no signal columns")
+	}
+
+	decimalComma := reader.Comma == ';'
+	log := &Log{}
+	sawTime := false
+	// line is the line of the record, as long as there are no blank lines or fields spanning lines.
+	line := 1
+	for {
+		line++
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading CSV: %w", err)
+		}
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		if len(record) != len(header) {
+			return nil, fmt.Errorf("line %d has %d fields, the header has %d", line, len(record), len(header))
+		}
+
+		t, local, err := parseELM327Time(record[timeColumn])
+		if err != nil {
+			return nil, fmt.Errorf("error parsing time on line %d: %w", line, err)
+		}
+		if !sawTime {
+			log.LocalTimes, sawTime = local, true
+		} else if local != log.LocalTimes {
+			return nil, fmt.Errorf("time %q on line %d doesn't have a time zone like the times before it", record[timeColumn], line)
+		}
+
+		for _, column := range columns.signals {
+			value, ok, err := parseELM327Value(record[column.index], decimalComma, column)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing %q on line %d: %w", header[column.index], line, err)
+			}
+			if !ok {
+				continue
+			}
+			log.Samples = append(log.Samples, &Sample{Time: t, Signal: column.signal, Value: value * column.ratio})
+		}
+
+		if log.Location == nil && latitudeColumn >= 0 && longitudeColumn >= 0 {
+			latitude, latitudeOK, _ := parseELM327Value(record[latitudeColumn], decimalComma, elm327Column{})
+			longitude, longitudeOK, _ := parseELM327Value(record[longitudeColumn], decimalComma, elm327Column{})
+			// Loggers write 0, 0 until they have a fix.
+			if latitudeOK && longitudeOK && (latitude != 0 || longitude != 0) {
+				log.Location = &st.Location{
+					Lat:  data.Float64ToLatitude(latitude),
+					Long: data.Float64ToLongitude(longitude),
+				}
+			}
+		}
+	}
+	return log, nil
+}
+
+func parseHeader(header []string) *elm327Columns {
+	columns := &elm327Columns{time: -1, latitude: -1, longitude: -1}
+	for i, name := range header {
+		normalized, _ := splitUnit(name)
+		switch {
+		case contains(elm327TimeColumns, normalized):
+			if columns.time < 0 {
+				columns.time = i
+			}
+		case contains(elm327LatitudeColumns, normalized):
+			columns.latitude = i
+		case contains(elm327LongitudeColumns, normalized):
+			columns.longitude = i
+		default:
+			if column, ok := parseColumn(name); ok {
+				column.index = i
+				columns.signals = append(columns.signals, column)
+			}
+		}
+	}
+	return columns
+}
+
+// parseColumn returns how to read the column with the header name, or false if it isn't a signal column.
+func parseColumn(name string) (elm327Column, bool) {
+	normalized, unit := splitUnit(name)
+	column := elm327Column{ratio: 1, isSwitch: strings.HasSuffix(normalized, "_switch")}
+	if signal, ok := elm327SignalColumns[normalized]; ok {
+		column.signal = signal
+	} else if strings.HasPrefix(normalized, "speed_") && unit == "" {
+		// The unit is the suffix, e.g. speed_mph.
+		column.signal, unit = Speed, strings.TrimPrefix(normalized, "speed_")
+	} else if signal := Signal(normalized); signal == Throttle || signal == Brake {
+		column.signal = signal
+	} else {
+		return elm327Column{}, false
+	}
+
+	if column.signal == Speed {
+		if unit == "" {
+			unit = "km/h"
+		}
+		ratio, ok := elm327SpeedUnits[unit]
+		if !ok {
+			return elm327Column{}, false
+		}
+		column.ratio = ratio
+	}
+	return column, true
+}
+
+// splitUnit returns the lowercase name of the column with spaces and dashes as underscores, and its unit if it's in
+// parentheses or brackets.
+func splitUnit(name string) (string, string) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	unit := ""
+	if i := strings.IndexAny(name, "(["); i >= 0 {
+		unit = strings.TrimSpace(strings.Trim(name[i:], "()[] "))
+		name = strings.TrimSpace(name[:i])
+	}
+	return strings.NewReplacer(" ", "_", "-", "_").Replace(name), unit
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseELM327Value returns the value of a cell in the column, before its ratio is applied, or false if it's empty.
+func parseELM327Value(value string, decimalComma bool, column elm327Column) (float64, bool, error) {
+	value = strings.TrimSpace(value)
+	if decimalComma {
+		value = strings.Replace(value, ",", ".", 1)
+	}
+	if value == "" || value == "-" {
+		return 0, false, nil
+	}
+	if switchValue, ok := elm327SwitchValues[strings.ToLower(value)]; ok && (column.isSwitch || column.signal == Brake) {
+		return switchValue, true, nil
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	if column.isSwitch && number != 0 {
+		return 100, true, nil
+	}
+	return number, true, nil
+}
+
+// parseELM327Time returns the time, which is in UTC unless it had no zone, and whether it had no zone.
+func parseELM327Time(value string) (time.Time, bool, error) {
+	value = strings.TrimSpace(value)
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		whole, fraction := math.Modf(seconds)
+		return time.Unix(int64(whole), int64(math.Round(fraction*1e9))).UTC(), false, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t.UTC(), false, nil
+	}
+	for _, layout := range elm327LocalTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true, nil
+		}
+	}
+	return time.Time{}, false, fmt.Errorf("%q is not an RFC 3339 time, %q or Unix seconds", value, elm327LocalTimeLayouts[0])
+}
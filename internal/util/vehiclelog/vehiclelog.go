@@ -0,0 +1,241 @@
+// Package vehiclelog parses the logs of what vehicles report about themselves, e.g. ELM327 OBD-II exports and
+// candump CAN logs, into speed, throttle, brake and RPM readings that are more precise than speeds derived from GPS.
+package vehiclelog
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"seneca/api/constants"
+	st "seneca/api/type"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Format is how a vehicle log is encoded.
+type Format string
+
+const (
+	// ELM327 is a CSV export of OBD-II PIDs polled through an ELM327 adapter, see parseELM327() for its columns.
+	ELM327 Format = "elm327"
+	// Candump is a log of CAN frames written by candump -L or candump -ta, see parseCandump() for the frames read.
+	Candump Format = "candump"
+)
+
+// Formats are the supported formats.
+var Formats = []Format{ELM327, Candump}
+
+// formatExtensions are the file extensions the formats are recognized by.  CSV files are also GPS logs of the
+// telemetry package, see FormatFromFile() for how they're told apart.
+var formatExtensions = map[Format]string{
+	ELM327:  "csv",
+	Candump: "log",
+}
+
+func (f Format) String() string {
+	return string(f)
+}
+
+// Extension is the file extension of the format, without a dot.
+func (f Format) Extension() string {
+	return formatExtensions[f]
+}
+
+// Signal is what a vehicle reported, named with its unit.
+type Signal string
+
+const (
+	// Speed is the vehicle speed in mph.
+	Speed Signal = "speed_mph"
+	// Throttle is the throttle or accelerator pedal position in percent.
+	Throttle Signal = "throttle_percent"
+	// Brake is the brake pedal position in percent.  Vehicles that only report a brake switch report 0 or 100.
+	Brake Signal = "brake_percent"
+	// RPM is the engine speed in revolutions per minute.
+	RPM Signal = "rpm"
+)
+
+// Signals are all the signals read from vehicle logs.
+var Signals = []Signal{Speed, Throttle, Brake, RPM}
+
+// kilometersPerHourToMph is the ratio from km/h, the unit vehicles report speeds in, to mph.
+const kilometersPerHourToMph = 1 / constants.KilometersToMiles
+
+// maxSpeedMph is the highest speed accepted from a log, faster ones are assumed to be misread.
+const maxSpeedMph = 300
+
+func (s Signal) String() string {
+	return string(s)
+}
+
+// 	Sample is one reading of a signal.
+type Sample struct {
+	// Time is in UTC, unless the Log has LocalTimes.
+	Time   time.Time
+	Signal Signal
+	// Value is in the unit of the Signal.
+	Value float64
+}
+
+// 	Log is what was read from a vehicle log.
+type Log struct {
+	// Samples are sorted by time.
+	Samples []*Sample
+	// LocalTimes is true if the log's times had no time zone, so they're the local times of the drive rather than
+	// UTC.
+	LocalTimes bool
+	// Location is the first GPS fix in the log, or nil if it has none.
+	Location *st.Location
+}
+
+//	FormatFromFile returns the format of the file if it's a vehicle log.  A CSV is an ELM327 export if its header
+//	has a throttle, brake or RPM column, or a speed column without the latitude and longitude of a GPS log.
+//	Params:
+//		fileName string
+//		fileBytes []byte
+//	Returns:
+//		Format
+//		bool: false if the file isn't a vehicle log
+func FormatFromFile(fileName string, fileBytes []byte) (Format, bool) {
+	switch strings.ToLower(strings.TrimPrefix(filepath.Ext(fileName), ".")) {
+	case Candump.Extension():
+		return Candump, true
+	case ELM327.Extension():
+		header, err := csvReader(fileBytes).Read()
+		if err != nil {
+			return "", false
+		}
+		columns := parseHeader(header)
+		for _, column := range columns.signals {
+			if column.signal != Speed || columns.latitude < 0 || columns.longitude < 0 {
+				return ELM327, true
+			}
+		}
+	}
+	return "", false
+}
+
+//	Parse reads the samples of the log, sorted by time.  Samples of a signal with the same time as an earlier one
+//	are dropped.
+//	Params:
+//		format Format
+//		r io.Reader
+//	Returns:
+//		*Log: with at least one sample
+//		error
+func Parse(format Format, r io.Reader) (*Log, error) {
+	var log *Log
+	var err error
+	switch format {
+	case ELM327:
+		log, err = parseELM327(r)
+	case Candump:
+		log, err = parseCandump(r)
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", format, err)
+	}
+
+	for i, sample := range log.Samples {
+		if err := validate(sample); err != nil {
+			return nil, fmt.Errorf("sample %d: %w", i, err)
+		}
+	}
+
+	sort.SliceStable(log.Samples, func(i, j int) bool { return log.Samples[i].Time.Before(log.Samples[j].Time) })
+	type key struct {
+		signal Signal
+		time   time.Time
+	}
+	seen := map[key]bool{}
+	unique := []*Sample{}
+	for _, sample := range log.Samples {
+		k := key{signal: sample.Signal, time: sample.Time}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		unique = append(unique, sample)
+	}
+	if len(unique) == 0 {
+		return nil, fmt.Errorf("no %v samples in %s", Signals, format)
+	}
+	log.Samples = unique
+	return log, nil
+}
+
+//	Downsample aggregates the samples of each signal into one per interval, at the start of the interval, since CAN
+//	buses report signals many times a second.  Brake positions are the highest of the interval, so no press is lost,
+//	and other signals are averaged.
+//	Params:
+//		samples []*Sample: sorted by time
+//		interval time.Duration
+//	Returns:
+//		[]*Sample: sorted by time
+func Downsample(samples []*Sample, interval time.Duration) []*Sample {
+	type key struct {
+		signal Signal
+		time   time.Time
+	}
+	type aggregate struct {
+		sample *Sample
+		count  int
+	}
+	aggregates := map[key]*aggregate{}
+	downsampled := []*Sample{}
+	for _, sample := range samples {
+		k := key{signal: sample.Signal, time: sample.Time.Truncate(interval)}
+		a, ok := aggregates[k]
+		if !ok {
+			a = &aggregate{sample: &Sample{Time: k.time, Signal: sample.Signal}}
+			aggregates[k] = a
+			downsampled = append(downsampled, a.sample)
+		}
+		a.count++
+		if sample.Signal == Brake {
+			a.sample.Value = math.Max(a.sample.Value, sample.Value)
+		} else {
+			a.sample.Value += (sample.Value - a.sample.Value) / float64(a.count)
+		}
+	}
+	return downsampled
+}
+
+func validate(sample *Sample) error {
+	if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) || sample.Value < 0 {
+		return fmt.Errorf("invalid %s %f", sample.Signal, sample.Value)
+	}
+	switch sample.Signal {
+	case Speed:
+		if sample.Value > maxSpeedMph {
+			return fmt.Errorf("speed %f mph is faster than %d mph", sample.Value, maxSpeedMph)
+		}
+	case Throttle, Brake:
+		if sample.Value > 100 {
+			return fmt.Errorf("%s %f is over 100%%", sample.Signal, sample.Value)
+		}
+	}
+	return nil
+}
+
+// csvReader reads the CSV in fileBytes, whose delimiter is ";" instead of "," if its header has more of them, as
+// exports from apps in locales with decimal commas do.
+func csvReader(fileBytes []byte) *csv.Reader {
+	reader := csv.NewReader(bytes.NewReader(fileBytes))
+	header := fileBytes
+	if i := bytes.IndexByte(fileBytes, '\n'); i >= 0 {
+		header = fileBytes[:i]
+	}
+	if bytes.Count(header, []byte(";")) > bytes.Count(header, []byte(",")) {
+		reader.Comma = ';'
+	}
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	return reader
+}
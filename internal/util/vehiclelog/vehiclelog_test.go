@@ -0,0 +1,203 @@
+package vehiclelog
+
+import (
+	"math"
+	"seneca/internal/util/data"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatFromFile(t *testing.T) {
+	testCases := []struct {
+		desc       string
+		fileName   string
+		contents   string
+		wantFormat Format
+		wantOK     bool
+	}{
+		{desc: "candump", fileName: "drive.LOG", wantFormat: Candump, wantOK: true},
+		{desc: "elm327", fileName: "drive.csv", contents: "Time,Speed (km/h),Engine RPM (rpm)\n", wantFormat: ELM327, wantOK: true},
+		{desc: "elm327 with semicolons", fileName: "drive.csv", contents: "Time;Brake Switch;Latitude;Longitude\n", wantFormat: ELM327, wantOK: true},
+		{desc: "speed without location", fileName: "drive.csv", contents: "time,speed_mph\n", wantFormat: ELM327, wantOK: true},
+		{desc: "gps csv", fileName: "drive.csv", contents: "time,lat,lon,speed_mph\n", wantOK: false},
+		{desc: "no signals", fileName: "drive.csv", contents: "time,heading\n", wantOK: false},
+		{desc: "gpx", fileName: "drive.gpx", contents: "time,rpm\n", wantOK: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			format, ok := FormatFromFile(tc.fileName, []byte(tc.contents))
+			if format != tc.wantFormat || ok != tc.wantOK {
+				t.Errorf("Want %q, %t, got %q, %t", tc.wantFormat, tc.wantOK, format, ok)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	start := time.Date(2021, time.April, 4, 15, 49, 29, 0, time.UTC)
+	// kmh is 50 km/h in mph.
+	kmh := 50 / 1.60934
+
+	testCases := []struct {
+		desc           string
+		format         Format
+		contents       string
+		wantSamples    []*Sample
+		wantLocalTimes bool
+		wantLocation   []float64
+	}{
+		{
+			desc:   "elm327",
+			format: ELM327,
+			contents: strings.Join([]string{
+				"Time,Latitude,Longitude,Speed (km/h),Engine RPM (rpm),Throttle Position (%),Brake Switch",
+				"2021-04-04T15:49:30Z,0,0,-,2000,,off",
+				"2021-04-04T15:49:29Z,0,0,50,,25.5,",
+				"2021-04-04T15:49:31Z,40.4155,-74.4306,,,,on",
+				"2021-04-04T15:49:31Z,40.4156,-74.4307,,,,off",
+			}, "\n"),
+			wantSamples: []*Sample{
+				{Time: start, Signal: Speed, Value: kmh},
+				{Time: start, Signal: Throttle, Value: 25.5},
+				{Time: start.Add(time.Second), Signal: RPM, Value: 2000},
+				{Time: start.Add(time.Second), Signal: Brake, Value: 0},
+				{Time: start.Add(2 * time.Second), Signal: Brake, Value: 100},
+			},
+			wantLocation: []float64{40.4155, -74.4306},
+		},
+		{
+			desc:   "elm327 with local times and decimal commas",
+			format: ELM327,
+			contents: strings.Join([]string{
+				"timestamp;speed_mph;brake_percent",
+				"2021-04-04 15:49:29;12,5;0",
+				"2021-04-04 15:49:29.5;;40",
+			}, "\n"),
+			wantSamples: []*Sample{
+				{Time: start, Signal: Speed, Value: 12.5},
+				{Time: start, Signal: Brake, Value: 0},
+				{Time: start.Add(500 * time.Millisecond), Signal: Brake, Value: 40},
+			},
+			wantLocalTimes: true,
+		},
+		{
+			desc:   "candump",
+			format: Candump,
+			contents: strings.Join([]string{
+				"# OBD-II",
+				"(1617551369.000000) can0 7DF#02010D0000000000",
+				"(1617551369.000000) can0 7E8#03410D32AAAAAAAA",
+				"(1617551369.500000) can0 7E8#04410C1F40AAAAAA",
+				" (1617551370.000000)  can0  7E9   [8]  03 41 11 80 AA AA AA AA",
+				"(1617551370.000000) can0 7E8#R",
+				"",
+				"# J1939",
+				"(1617551371.000000) can1 18FEF100#FF0032107FFFFFFF",
+				"(1617551371.000000) can1 0CF00400#FFFFFF803EFFFFFF",
+				"(1617551371.000000) can1 18F00100#FF64FFFFFFFFFFFF",
+				"(1617551371.000000) can1 0CF00300#FFFFFFFFFFFFFFFF",
+			}, "\n"),
+			wantSamples: []*Sample{
+				{Time: start, Signal: Speed, Value: kmh},
+				{Time: start.Add(500 * time.Millisecond), Signal: RPM, Value: 2000},
+				{Time: start.Add(time.Second), Signal: Throttle, Value: 0x80 * 100.0 / 255},
+				{Time: start.Add(2 * time.Second), Signal: Speed, Value: kmh},
+				{Time: start.Add(2 * time.Second), Signal: Brake, Value: 100},
+				{Time: start.Add(2 * time.Second), Signal: RPM, Value: 2000},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			log, err := Parse(tc.format, strings.NewReader(tc.contents))
+			if err != nil {
+				t.Fatalf("Parse() returns err: %v", err)
+			}
+			if log.LocalTimes != tc.wantLocalTimes {
+				t.Errorf("Want LocalTimes %t, got %t", tc.wantLocalTimes, log.LocalTimes)
+			}
+			if len(log.Samples) != len(tc.wantSamples) {
+				t.Fatalf("Want %d samples, got %d", len(tc.wantSamples), len(log.Samples))
+			}
+			for i, want := range tc.wantSamples {
+				got := log.Samples[i]
+				if !got.Time.Equal(want.Time) || got.Signal != want.Signal || math.Abs(got.Value-want.Value) > 0.001 {
+					t.Errorf("Want sample %d %v %s %f, got %v %s %f", i, want.Time, want.Signal, want.Value, got.Time, got.Signal, got.Value)
+				}
+			}
+
+			if tc.wantLocation == nil {
+				if log.Location != nil {
+					t.Errorf("Want no location, got %v", log.Location)
+				}
+				return
+			}
+			if log.Location == nil {
+				t.Fatalf("Want location %v, got nil", tc.wantLocation)
+			}
+			if lat, long := data.LatitudeToFloat64(log.Location.Lat), data.LongitudeToFloat64(log.Location.Long); math.Abs(lat-tc.wantLocation[0]) > 1e-6 || math.Abs(long-tc.wantLocation[1]) > 1e-6 {
+				t.Errorf("Want location %v, got %f, %f", tc.wantLocation, lat, long)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		format   Format
+		contents string
+	}{
+		{desc: "no time column", format: ELM327, contents: "speed,rpm\n10,2000"},
+		{desc: "no signal columns", format: ELM327, contents: "time,lat,lon\n1617551369,40,-74"},
+		{desc: "bad value", format: ELM327, contents: "time,rpm\n1617551369,fast"},
+		{desc: "mixed time zones", format: ELM327, contents: "time,rpm\n1617551369,2000\n2021-04-04 15:49:30,2000"},
+		{desc: "negative speed", format: ELM327, contents: "time,speed_mph\n1617551369,-1"},
+		{desc: "throttle over 100%", format: ELM327, contents: "time,throttle_percent\n1617551369,101"},
+		{desc: "no samples", format: ELM327, contents: "time,rpm\n1617551369,"},
+		{desc: "no timestamps", format: Candump, contents: "can0 7E8#03410D32"},
+		{desc: "bad data", format: Candump, contents: "(1617551369.000000) can0 7E8#0341ZZ"},
+		{desc: "no decoded frames", format: Candump, contents: "(1617551369.000000) can0 123#00"},
+		{desc: "unsupported format", format: "kml", contents: "time,rpm\n1617551369,2000"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if _, err := Parse(tc.format, strings.NewReader(tc.contents)); err == nil {
+				t.Errorf("Want err from Parse(), got nil")
+			}
+		})
+	}
+}
+
+func TestDownsample(t *testing.T) {
+	start := time.Date(2021, time.April, 4, 15, 49, 29, 0, time.UTC)
+	samples := []*Sample{}
+	// Speed and brake at 20 Hz, for 2 intervals of 500ms.
+	for i := 0; i < 20; i++ {
+		brake := 0.0
+		if i == 3 {
+			brake = 100
+		}
+		samples = append(samples,
+			&Sample{Time: start.Add(time.Millisecond * 50 * time.Duration(i)), Signal: Speed, Value: float64(30 - i)},
+			&Sample{Time: start.Add(time.Millisecond * 50 * time.Duration(i)), Signal: Brake, Value: brake},
+		)
+	}
+
+	want := []*Sample{
+		{Time: start, Signal: Speed, Value: 25.5},
+		{Time: start, Signal: Brake, Value: 100},
+		{Time: start.Add(time.Millisecond * 500), Signal: Speed, Value: 15.5},
+		{Time: start.Add(time.Millisecond * 500), Signal: Brake, Value: 0},
+	}
+	got := Downsample(samples, time.Millisecond*500)
+	if len(got) != len(want) {
+		t.Fatalf("Want %d samples, got %d", len(want), len(got))
+	}
+	for i, sample := range got {
+		if !sample.Time.Equal(want[i].Time) || sample.Signal != want[i].Signal || math.Abs(sample.Value-want[i].Value) > 1e-9 {
+			t.Errorf("Want sample %d to be %+v, got %+v", i, want[i], sample)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"seneca/internal/client/intraseneca/http"
+	"seneca/internal/jobqueue"
+	"strings"
+	"time"
+)
+
+// pollInterval is how often a job is polled while it's followed.
+const pollInterval = time.Second * 2
+
+// handleJobsMode handles the modes other than viewing trips, and returns whether it handled the mode.
+func handleJobsMode(client *http.Client, mode string) bool {
+	switch mode {
+	case "s", "r":
+		start := client.StartSyncer
+		if mode == "r" {
+			start = client.StartRunner
+		}
+		jobID, err := start()
+		if err != nil {
+			fmt.Printf("Error starting job: %v\n", err)
+			return true
+		}
+		fmt.Printf("Started job %q.\n", jobID)
+		followJob(client, jobID)
+	case "j":
+		fmt.Println("Enter the ID of the job:")
+		followJob(client, scanOrExit())
+	case "l":
+		fmt.Println("Enter the ID of the user, or 0 for the jobs of all users:")
+		userID := scanOrExit()
+		if userID == "0" {
+			userID = ""
+		}
+		statuses, err := client.ListJobs(userID)
+		if err != nil {
+			fmt.Printf("Error listing jobs: %v\n", err)
+			return true
+		}
+		if len(statuses) == 0 {
+			fmt.Println("There are no jobs.")
+		}
+		for _, status := range statuses {
+			printStatus(status, 0)
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// followJob prints the job every pollInterval until it's done.
+func followJob(client *http.Client, jobID string) {
+	for {
+		status, err := client.GetJob(jobID)
+		if err != nil {
+			fmt.Printf("Error getting job %q: %v\n", jobID, err)
+			return
+		}
+		printStatus(status, 0)
+		if status.Done {
+			return
+		}
+		fmt.Println(strings.Repeat("-", 40))
+		time.Sleep(pollInterval)
+	}
+}
+
+func printStatus(status *jobqueue.Status, depth int) {
+	indent := strings.Repeat("  ", depth)
+	fmt.Printf("%s%s job %q", indent, status.Type, status.ID)
+	if status.UserID != "" {
+		fmt.Printf(" for user %q", status.UserID)
+	}
+	fmt.Printf(": %s after %d of %d attempts", status.State, status.Attempts, status.MaxAttempts)
+	if status.StartTime != nil {
+		fmt.Printf(", started %v", status.StartTime.Local())
+	}
+	if status.EndTime != nil {
+		fmt.Printf(", ended %v", status.EndTime.Local())
+	}
+	if status.NextAttemptTime != nil {
+		fmt.Printf(", retrying %v", status.NextAttemptTime.Local())
+	}
+	fmt.Println()
+	if len(status.Payload) > 0 {
+		fmt.Printf("%s  payload: %s\n", indent, status.Payload)
+	}
+	if status.Error != "" {
+		fmt.Printf("%s  error: %s\n", indent, status.Error)
+	}
+	if len(status.Result) > 0 {
+		fmt.Printf("%s  result: %s\n", indent, status.Result)
+	}
+	if len(status.ChildStates) > 0 {
+		fmt.Printf("%s  children: %v\n", indent, status.ChildStates)
+	}
+	for _, child := range status.Children {
+		printStatus(child, depth+1)
+	}
+}
@@ -1,4 +1,5 @@
 // This CLI allows you to query APIServer.ListTrips, and formats the output to make the Trips more readable.
+// It can also start the syncer and runner, and poll their jobs until they're done.
 package main
 
 import (
@@ -34,6 +35,11 @@ func main() {
 		var err error
 
 		fmt.Println("At any point, enter -1 to exit.")
+		fmt.Println("Enter t to view trips, s or r to start the syncer or runner and follow its job, j to follow a job, or l to list a user's jobs:")
+		if handled := handleJobsMode(intraSenecaClient, scanOrExit()); handled {
+			continue
+		}
+
 		fmt.Println("Enter the width of you terminal in characters so we can correctly pretty print trips:")
 		widthString := scanOrExit()
 		screenWidth, err = strconv.Atoi(widthString)
@@ -21,13 +21,18 @@ import (
 	"seneca/internal/dao/rawframedao"
 	"seneca/internal/dao/rawlocationdao"
 	"seneca/internal/dao/rawmotiondao"
+	"seneca/internal/dao/rawtelemetryfiledao"
+	"seneca/internal/dao/rawvehiclesignaldao"
 	"seneca/internal/dao/rawvideodao"
+	"seneca/internal/dao/sqldaoset"
 	"seneca/internal/dao/tripdao"
 	"seneca/internal/dao/userdao"
 	"seneca/internal/dataaggregator/sanitizer"
 	"seneca/internal/datagatherer/rawvideohandler"
+	"seneca/internal/datagatherer/telemetryhandler"
 	"seneca/internal/dataprocessor"
 	"seneca/internal/dataprocessor/algorithms"
+	"seneca/internal/jobqueue"
 	"seneca/internal/util/data"
 	"seneca/internal/util/mp4"
 	"time"
@@ -72,7 +77,9 @@ func New(projectID string, serverConfig *intraseneca.ServerConfig, logger loggin
 	rawFrameDAO := rawframedao.NewSQLRawFrameDAO(sqlService)
 	tripDAO := tripdao.NewSQLTripDAO(sqlService, wrappedLogger)
 	eventDAO := eventdao.NewSQLEventDAO(sqlService, tripDAO, wrappedLogger)
-	dcDAO := drivingconditiondao.NewSQLDrivingConditionDAO(sqlService, tripDAO, eventDAO)
+	dcDAO := drivingconditiondao.NewSQLDrivingConditionDAO(sqlService, drivingconditiondao.SQLTripDAOs(wrappedLogger))
+	rawTelemetryFileDAO := rawtelemetryfiledao.NewSQLRawTelemetryFileDAO(sqlService)
+	rawVehicleSignalDAO := rawvehiclesignaldao.NewSQLRawVehicleSignalDAO(sqlService)
 	allDAOSet := &dao.AllDAOSet{
 		UserDAO:             userDAO,
 		RawVideoDAO:         rawVideoDAO,
@@ -82,18 +89,23 @@ func New(projectID string, serverConfig *intraseneca.ServerConfig, logger loggin
 		TripDAO:             tripDAO,
 		EventDAO:            eventDAO,
 		DrivingConditionDAO: dcDAO,
+		RawTelemetryFileDAO: rawTelemetryFileDAO,
+		RawVehicleSignalDAO: rawVehicleSignalDAO,
 	}
 
 	mp4Tool, err := mp4.NewMP4Tool(wrappedLogger)
 	if err != nil {
 		return nil, fmt.Errorf(fmt.Sprintf("mp4.NewMP4Tool() returns - err: %v", err))
 	}
-	rawVideoHandler, err := rawvideohandler.NewRawVideoHandler(gcsc, mp4Tool, rawVideoDAO, rawLocationDAO, rawMotionDAO, rawFrameDAO, wrappedLogger, projectID)
+	// Jobs aren't run in integration tests, which call the syncer and runner directly.
+	jobQueue := jobqueue.NewMemory(jobqueue.DefaultOptions())
+	rawVideoHandler, err := rawvideohandler.NewRawVideoHandler(gcsc, mp4Tool, rawVideoDAO, sqldaoset.NewTransactionRunner(sqlService, wrappedLogger, time.Second*5), jobQueue, wrappedLogger, projectID)
 	if err != nil {
 		return nil, fmt.Errorf(fmt.Sprintf("cloud.NewRawVideoHandler() returns - err: %v", err))
 	}
+	telemetryHandler := telemetryhandler.NewTelemetryHandler(gcsc, sqldaoset.NewTransactionRunner(sqlService, wrappedLogger, time.Second*5), jobQueue, wrappedLogger)
 	gDriveFactory := &googledrive.UserClientFactory{}
-	syncer := syncer.New(rawVideoHandler, gDriveFactory, userDAO, wrappedLogger)
+	syncer := syncer.New(rawVideoHandler, telemetryHandler, gDriveFactory, userDAO, jobQueue, wrappedLogger)
 
 	intraSenecaClient, err := http.New(serverConfig)
 	if err != nil {
@@ -105,7 +117,7 @@ func New(projectID string, serverConfig *intraseneca.ServerConfig, logger loggin
 		return nil, fmt.Errorf("algorithms.NewFactory() returns err: %v", err)
 	}
 	algos := []dataprocessor.AlgorithmInterface{}
-	algoTags := []string{"00000", "00001", "00002", "00003"}
+	algoTags := []string{"00000", "00001", "00002", "00003", "00005"}
 	for _, tag := range algoTags {
 		algo, err := algoFactory.GetAlgorithm(tag)
 		if err != nil {
@@ -118,8 +130,8 @@ func New(projectID string, serverConfig *intraseneca.ServerConfig, logger loggin
 	if err != nil {
 		return nil, fmt.Errorf("dataprocessor.New() returns err: %w", err)
 	}
-	runner := runner.New(userDAO, dataprocessor, wrappedLogger)
-	sanitizer := sanitizer.New(rawMotionDAO, rawLocationDAO, rawVideoDAO, rawFrameDAO, eventDAO, dcDAO)
+	runner := runner.New(userDAO, dataprocessor, sqlService, jobQueue, jobqueue.DefaultConcurrency, wrappedLogger)
+	sanitizer := sanitizer.New(rawMotionDAO, rawLocationDAO, rawVideoDAO, rawFrameDAO, eventDAO, dcDAO, gcsc)
 	apiserver := apiserver.New(sanitizer, tripDAO)
 
 	return &TestEnvironment{
@@ -104,7 +104,7 @@ func E2EAPIServer(testUserEmail string, testEnv *testenv.TestEnvironment) error
 		return fmt.Errorf("CreateDrivingCondition() returns err: %w", err)
 	}
 
-	trips, err := testEnv.APIServer.ListTrips(user.Id, tripStart, tripStart.Add(time.Minute*50))
+	trips, err := testEnv.APIServer.ListTrips(user.Id, tripStart, tripStart.Add(time.Minute*50), time.Hour)
 	if err != nil {
 		return fmt.Errorf("ListTrips() returns err: %w", err)
 	}
@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	st "seneca/api/type"
@@ -70,7 +71,9 @@ func E2ERunner(testUserEmail string, testEnv *testenv.TestEnvironment) error {
 		}
 	}
 
-	testEnv.Runner.Run()
+	if _, err := testEnv.Runner.Run(context.Background()); err != nil {
+		return fmt.Errorf("Runner.Run() returns err: %w", err)
+	}
 
 	tripIDs, err := testEnv.TripDAO.ListUserTripIDs(user.Id)
 	if err != nil {
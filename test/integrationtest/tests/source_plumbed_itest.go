@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"context"
 	"fmt"
 	"seneca/test/integrationtest/testenv"
 	"time"
@@ -16,9 +17,11 @@ func E2ESource(testUserEmail string, testEnv *testenv.TestEnvironment) error {
 	}
 
 	testEnv.Syncer.ScanAllUsers()
-	testEnv.Runner.Run()
+	if _, err := testEnv.Runner.Run(context.Background()); err != nil {
+		return fmt.Errorf("Runner.Run() returns err: %w", err)
+	}
 
-	trips, err := testEnv.APIServer.ListTrips(user.Id, time.Date(2021, 0, 0, 0, 0, 0, 0, time.UTC), time.Date(2022, 0, 0, 0, 0, 0, 0, time.UTC))
+	trips, err := testEnv.APIServer.ListTrips(user.Id, time.Date(2021, 0, 0, 0, 0, 0, 0, time.UTC), time.Date(2022, 0, 0, 0, 0, 0, 0, time.UTC), time.Hour)
 	if err != nil {
 		return fmt.Errorf("ListTrips(%s) returns err: %w", user.Id, err)
 	}
@@ -0,0 +1,57 @@
+package testutil
+
+import (
+	"testing"
+	"time"
+)
+
+// listByTimeStart is when the objects of CheckListUserIDsByTime are stored from.
+var listByTimeStart = time.Date(1996, time.May, 23, 0, 0, 0, 0, time.UTC)
+
+// CheckListUserIDsByTime tests the ListUser*IDsByTime of a DAO.  insert stores an object of the user at the time and
+// returns its ID, and list is the DAO's ListUser*IDsByTime.  Objects are stored a second apart, newest first, for
+// TestUserID and another user.
+func CheckListUserIDsByTime(t *testing.T, insert func(userID string, timestamp time.Time) (string, error), list func(userID string, start, end time.Time) ([]string, error)) {
+	t.Helper()
+	const otherUserID = "546"
+	ids := map[string][]string{TestUserID: make([]string, 10), otherUserID: make([]string, 10)}
+	for i := 9; i >= 0; i-- {
+		for userID := range ids {
+			id, err := insert(userID, listByTimeStart.Add(time.Second*time.Duration(i)))
+			if err != nil {
+				t.Fatalf("Inserting object %d of user %q returns err: %v", i, userID, err)
+			}
+			ids[userID][i] = id
+		}
+	}
+
+	testCases := []struct {
+		desc   string
+		userID string
+		// start and end are in seconds from listByTimeStart, the wanted IDs are the objects [first, last).
+		start, end  int
+		first, last int
+	}{
+		{desc: "middle", userID: TestUserID, start: 3, end: 7, first: 3, last: 7},
+		{desc: "end is exclusive", userID: TestUserID, start: 5, end: 6, first: 5, last: 6},
+		{desc: "all", userID: TestUserID, start: -1, end: 10, first: 0, last: 10},
+		{desc: "none", userID: TestUserID, start: 10, end: 20, first: 0, last: 0},
+		{desc: "other user", userID: otherUserID, start: 3, end: 7, first: 3, last: 7},
+	}
+	for _, tc := range testCases {
+		gotIDs, err := list(tc.userID, listByTimeStart.Add(time.Second*time.Duration(tc.start)), listByTimeStart.Add(time.Second*time.Duration(tc.end)))
+		if err != nil {
+			t.Fatalf("%s: listing IDs returns err: %v", tc.desc, err)
+		}
+		// Oldest first.
+		wantIDs := ids[tc.userID][tc.first:tc.last]
+		if len(gotIDs) != len(wantIDs) {
+			t.Fatalf("%s: want IDs %v, got %v", tc.desc, wantIDs, gotIDs)
+		}
+		for i := range gotIDs {
+			if gotIDs[i] != wantIDs[i] {
+				t.Fatalf("%s: want IDs %v, got %v", tc.desc, wantIDs, gotIDs)
+			}
+		}
+	}
+}